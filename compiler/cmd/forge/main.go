@@ -11,6 +11,7 @@ import (
 	"github.com/forge-lang/forge/compiler/internal/analyzer"
 	"github.com/forge-lang/forge/compiler/internal/diag"
 	"github.com/forge-lang/forge/compiler/internal/emitter"
+	"github.com/forge-lang/forge/compiler/internal/lsp"
 	"github.com/forge-lang/forge/compiler/internal/normalizer"
 	"github.com/forge-lang/forge/compiler/internal/parser"
 	"github.com/forge-lang/forge/compiler/internal/planner"
@@ -67,7 +68,7 @@ Commands:
   dev       Start development server with hot reload
   migrate   Apply database migrations
   run       Start the FORGE runtime server
-  test      Run invariant tests
+  test      Validate test declarations
   lsp       Start the Language Server Protocol server
   version   Print version information
   help      Show this help message
@@ -233,8 +234,26 @@ func doBuild(args []string, verbose bool) bool {
 		return false
 	}
 
+	// Load the previous build's migration so schema changes become a new step
+	outDir := ".forge-runtime"
+	artifactPath := filepath.Join(outDir, "artifact.json")
+	var previous *emitter.MigrationSchema
+	if content, err := os.ReadFile(artifactPath); err == nil {
+		var prev emitter.Artifact
+		if err := json.Unmarshal(content, &prev); err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to parse previous artifact: %v\n", err)
+			return false
+		}
+		previous = prev.Migration
+		previous.UpgradeLegacy()
+	}
+
 	// Plan
-	plan, planDiags := planner.PlanExecution(ast, scope, normalized)
+	p := planner.New(ast, scope, normalized)
+	if previous != nil && previous.Schema != nil {
+		p.SetPrevious(previous.Schema)
+	}
+	plan, planDiags := p.Plan()
 	allDiags.Merge(planDiags)
 
 	if planDiags.HasErrors() {
@@ -243,7 +262,9 @@ func doBuild(args []string, verbose bool) bool {
 	}
 
 	// Emit
-	output, emitDiags := emitter.Emit(scope, normalized, plan)
+	e := emitter.New(scope, normalized, plan)
+	e.SetPrevious(previous)
+	output, emitDiags := e.Emit()
 	allDiags.Merge(emitDiags)
 
 	if emitDiags.HasErrors() {
@@ -254,14 +275,12 @@ func doBuild(args []string, verbose bool) bool {
 	printDiagnostics(allDiags)
 
 	// Write outputs
-	outDir := ".forge-runtime"
 	if err := os.MkdirAll(outDir, 0755); err != nil {
 		fmt.Fprintf(os.Stderr, "error: failed to create output directory: %v\n", err)
 		return false
 	}
 
 	// Write artifact
-	artifactPath := filepath.Join(outDir, "artifact.json")
 	if err := os.WriteFile(artifactPath, []byte(output.ArtifactJSON), 0644); err != nil {
 		fmt.Fprintf(os.Stderr, "error: failed to write artifact: %v\n", err)
 		return false
@@ -347,16 +366,22 @@ func cmdMigrate(args []string) {
 		return
 	}
 
-	// Print migration SQL
-	fmt.Println("Migration SQL:")
-	fmt.Println("---")
-	for _, stmt := range artifact.Migration.Up {
-		fmt.Println(stmt)
+	// Print migration SQL, one block per version
+	steps := artifact.Migration.Steps
+	if len(steps) == 0 {
+		steps = []*emitter.MigrationStep{{Version: artifact.Migration.Version, Up: artifact.Migration.Up}}
 	}
-	fmt.Println("---")
-	fmt.Println()
-	fmt.Println("To apply this migration, run:")
-	fmt.Println("  psql $DATABASE_URL -f .forge-runtime/schema.sql")
+	for _, step := range steps {
+		fmt.Printf("Migration %s:\n", step.Version)
+		fmt.Println("---")
+		for _, stmt := range step.Up {
+			fmt.Println(stmt)
+		}
+		fmt.Println("---")
+		fmt.Println()
+	}
+	fmt.Println("To apply pending migrations, run the runtime CLI:")
+	fmt.Println("  forge migrate -apply")
 }
 
 func cmdRun(args []string) {
@@ -403,29 +428,31 @@ func cmdTest(args []string) {
 		return
 	}
 
+	_, analyzeDiags := analyzer.Analyze(ast)
+	if analyzeDiags.HasErrors() {
+		printDiagnostics(analyzeDiags)
+		os.Exit(1)
+	}
+
 	fmt.Printf("Found %d test(s)\n", len(ast.Tests))
 	fmt.Println()
 
-	// For now, just list the tests
+	// Execution needs the runtime, so the compiler CLI only validates tests
 	for _, test := range ast.Tests {
 		fmt.Printf("  test %s\n", test.Target.String())
 	}
 
 	fmt.Println()
-	fmt.Println("Test execution is not yet implemented.")
-	fmt.Println("Tests will be run against a real database using testcontainers.")
+	fmt.Println("Tests are valid. Run them with the runtime CLI's 'forge test',")
+	fmt.Println("which executes them against an ephemeral database.")
 }
 
 func cmdLSP(args []string) {
-	fmt.Println("Starting FORGE Language Server...")
-	fmt.Println()
-	fmt.Println("The LSP server is not yet implemented.")
-	fmt.Println("It will provide:")
-	fmt.Println("  - Syntax highlighting")
-	fmt.Println("  - Autocomplete")
-	fmt.Println("  - Go to definition")
-	fmt.Println("  - Error diagnostics")
-	fmt.Println("  - Hover documentation")
+	// stdout carries the protocol; anything else goes to stderr
+	if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "forge lsp: %v\n", err)
+		os.Exit(1)
+	}
 }
 
 func findForgeFiles(args []string) []string {
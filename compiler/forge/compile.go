@@ -2,6 +2,7 @@
 package forge
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 
@@ -42,8 +43,33 @@ type CompileResult struct {
 
 // Compile compiles multiple .forge files into runtime artifacts.
 func Compile(files []string) *CompileResult {
+	return CompileIncremental(files, nil)
+}
+
+// CompileIncremental compiles like Compile, diffing the schema against
+// previousArtifact (the artifact.json of the last build). Schema changes are
+// appended to the artifact's migration history as a new versioned step
+// instead of being folded into the initial one. A nil previousArtifact
+// starts a new history.
+func CompileIncremental(files []string, previousArtifact []byte) *CompileResult {
 	result := &CompileResult{}
 
+	var previous *emitter.MigrationSchema
+	if len(previousArtifact) > 0 {
+		var artifact emitter.Artifact
+		if err := json.Unmarshal(previousArtifact, &artifact); err != nil {
+			result.Diagnostics = append(result.Diagnostics, Diagnostic{
+				Severity: diag.Error.String(),
+				Code:     "E0003",
+				Message:  fmt.Sprintf("failed to read previous artifact: %v", err),
+			})
+			result.HasErrors = true
+			return result
+		}
+		previous = artifact.Migration
+		previous.UpgradeLegacy()
+	}
+
 	// Parse and analyze
 	combined, allDiags := parseAndAnalyze(files)
 
@@ -90,6 +116,9 @@ func Compile(files []string) *CompileResult {
 
 	// Plan
 	p := planner.New(combined, scope, normalized)
+	if previous != nil && previous.Schema != nil {
+		p.SetPrevious(previous.Schema)
+	}
 	plan, planDiags := p.Plan()
 	for _, d := range planDiags.All() {
 		result.Diagnostics = append(result.Diagnostics, Diagnostic{
@@ -107,6 +136,7 @@ func Compile(files []string) *CompileResult {
 
 	// Emit
 	e := emitter.New(scope, normalized, plan)
+	e.SetPrevious(previous)
 	output, emitDiags := e.Emit()
 	for _, d := range emitDiags.All() {
 		result.Diagnostics = append(result.Diagnostics, Diagnostic{
@@ -186,16 +216,7 @@ func parseAndAnalyze(files []string) (*ast.File, *diag.Diagnostics) {
 				combined.App = parsed.App
 			}
 		}
-		combined.Entities = append(combined.Entities, parsed.Entities...)
-		combined.Relations = append(combined.Relations, parsed.Relations...)
-		combined.Rules = append(combined.Rules, parsed.Rules...)
-		combined.Access = append(combined.Access, parsed.Access...)
-		combined.Actions = append(combined.Actions, parsed.Actions...)
-		combined.Messages = append(combined.Messages, parsed.Messages...)
-		combined.Jobs = append(combined.Jobs, parsed.Jobs...)
-		combined.Hooks = append(combined.Hooks, parsed.Hooks...)
-		combined.Views = append(combined.Views, parsed.Views...)
-		combined.Tests = append(combined.Tests, parsed.Tests...)
+		combined.Merge(parsed)
 	}
 
 	if allDiags.HasErrors() {
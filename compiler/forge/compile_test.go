@@ -1,8 +1,10 @@
 package forge
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -275,6 +277,590 @@ view TicketList {
 	}
 }
 
+func TestCompile_ScheduledAndDelayedJobs(t *testing.T) {
+	dir := t.TempDir()
+	content := `
+app TestApp {
+  auth: token
+  database: postgres
+}
+
+entity Ticket {
+  subject: string
+}
+
+job nightly_digest {
+  schedule: "0 7 * * *"
+  effect: email.send
+}
+
+job remind_agent {
+  input: Ticket
+  effect: email.send
+  retry: 4
+  backoff: exponential(2s, max 10m)
+  timeout: 2m
+}
+
+hook Ticket.after_create {
+  enqueue remind_agent in 24h
+}
+`
+	forgeFile := filepath.Join(dir, "app.forge")
+	if err := os.WriteFile(forgeFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := Compile([]string{forgeFile})
+	if result.HasErrors {
+		for _, d := range result.Diagnostics {
+			t.Logf("  %s: %s", d.Code, d.Message)
+		}
+		t.Fatal("expected no errors")
+	}
+
+	var artifact struct {
+		Jobs map[string]struct {
+			Schedule    string `json:"schedule"`
+			MaxAttempts int    `json:"max_attempts"`
+			TimeoutMs   int64  `json:"timeout_ms"`
+			Backoff     *struct {
+				Strategy string `json:"strategy"`
+				BaseMs   int64  `json:"base_ms"`
+				MaxMs    int64  `json:"max_ms"`
+			} `json:"backoff"`
+		} `json:"jobs"`
+		Hooks []struct {
+			Jobs    []string `json:"jobs"`
+			Delayed []struct {
+				Job     string `json:"job"`
+				DelayMs int64  `json:"delay_ms"`
+			} `json:"delayed"`
+		} `json:"hooks"`
+	}
+	if err := json.Unmarshal([]byte(result.Output.ArtifactJSON), &artifact); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := artifact.Jobs["nightly_digest"].Schedule; got != "0 7 * * *" {
+		t.Errorf("schedule = %q, want %q", got, "0 7 * * *")
+	}
+	if digest := artifact.Jobs["nightly_digest"]; digest.MaxAttempts != 0 || digest.Backoff != nil || digest.TimeoutMs != 0 {
+		t.Errorf("expected runtime defaults for nightly_digest, got %+v", digest)
+	}
+	remind := artifact.Jobs["remind_agent"]
+	if remind.MaxAttempts != 5 || remind.TimeoutMs != 2*60*1000 {
+		t.Errorf("remind_agent max_attempts = %d, timeout_ms = %d, want 5 and 120000", remind.MaxAttempts, remind.TimeoutMs)
+	}
+	if b := remind.Backoff; b == nil || b.Strategy != "exponential" || b.BaseMs != 2000 || b.MaxMs != 10*60*1000 {
+		t.Errorf("unexpected backoff %+v", remind.Backoff)
+	}
+	if len(artifact.Hooks) != 1 || len(artifact.Hooks[0].Jobs) != 0 || len(artifact.Hooks[0].Delayed) != 1 {
+		t.Fatalf("unexpected hooks %+v", artifact.Hooks)
+	}
+	if d := artifact.Hooks[0].Delayed[0]; d.Job != "remind_agent" || d.DelayMs != 24*60*60*1000 {
+		t.Errorf("delayed = %+v, want remind_agent after 24h", d)
+	}
+}
+
+func TestCompile_Imperatives(t *testing.T) {
+	dir := t.TempDir()
+	content := `
+app TestApp {
+  auth: token
+  database: postgres
+}
+
+entity Ticket {
+  subject: string
+}
+
+imperative export_csv {
+  input: Ticket
+  returns: file
+  effects: [email.send]
+}
+
+job nightly_export {
+  input: Ticket
+  effect: export_csv
+}
+`
+	forgeFile := filepath.Join(dir, "app.forge")
+	if err := os.WriteFile(forgeFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := Compile([]string{forgeFile})
+	if result.HasErrors {
+		for _, d := range result.Diagnostics {
+			t.Logf("  %s: %s", d.Code, d.Message)
+		}
+		t.Fatal("expected no errors")
+	}
+
+	var artifact struct {
+		Imperatives map[string]struct {
+			Route       string   `json:"route"`
+			InputEntity string   `json:"input_entity"`
+			Returns     string   `json:"returns"`
+			Effects     []string `json:"effects"`
+		} `json:"imperatives"`
+		Jobs map[string]struct {
+			Capabilities []string `json:"capabilities"`
+			Imperative   string   `json:"imperative"`
+		} `json:"jobs"`
+	}
+	if err := json.Unmarshal([]byte(result.Output.ArtifactJSON), &artifact); err != nil {
+		t.Fatal(err)
+	}
+
+	imp, ok := artifact.Imperatives["export_csv"]
+	if !ok {
+		t.Fatalf("expected export_csv in artifact, got %+v", artifact.Imperatives)
+	}
+	if imp.Route != "/api/imperative/export_csv" || imp.InputEntity != "Ticket" || imp.Returns != "file" {
+		t.Errorf("unexpected imperative %+v", imp)
+	}
+	if len(imp.Effects) != 1 || imp.Effects[0] != "email.send" {
+		t.Errorf("effects = %v, want [email.send]", imp.Effects)
+	}
+
+	job := artifact.Jobs["nightly_export"]
+	if job.Imperative != "export_csv" || len(job.Capabilities) != 1 || job.Capabilities[0] != "imperative.call" {
+		t.Errorf("unexpected job %+v", job)
+	}
+	if !contains(result.Output.TypeScriptClient, "this.requestBlob('/imperative/export_csv', input)") {
+		t.Error("expected a client method for export_csv")
+	}
+}
+
+func TestCompileIncremental_AppendsMigrationStep(t *testing.T) {
+	dir := t.TempDir()
+	forgeFile := filepath.Join(dir, "app.forge")
+	compile := func(content string, previous []byte) string {
+		t.Helper()
+		if err := os.WriteFile(forgeFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result := CompileIncremental([]string{forgeFile}, previous)
+		if result.HasErrors {
+			for _, d := range result.Diagnostics {
+				t.Logf("  %s: %s", d.Code, d.Message)
+			}
+			t.Fatal("expected no errors")
+		}
+		return result.Output.ArtifactJSON
+	}
+
+	v1 := compile(`
+app TestApp {
+  auth: token
+  database: postgres
+}
+
+entity Ticket {
+  subject: string
+  status: enum(open, closed) = open
+}
+`, nil)
+	v2 := compile(`
+app TestApp {
+  auth: token
+  database: postgres
+}
+
+entity Ticket {
+  subject: string
+  status: enum(open, pending, closed) = pending
+  priority: int = 0
+}
+
+entity Tag {
+  name: string unique
+}
+`, []byte(v1))
+	// Rebuilding without changes must not add a step
+	v3 := compile(`
+app TestApp {
+  auth: token
+  database: postgres
+}
+
+entity Ticket {
+  subject: string
+  status: enum(open, pending, closed) = pending
+  priority: int = 0
+}
+
+entity Tag {
+  name: string unique
+}
+`, []byte(v2))
+
+	type migration struct {
+		Version string `json:"version"`
+		Steps   []struct {
+			Version string   `json:"version"`
+			Up      []string `json:"up"`
+			Down    []string `json:"down"`
+		} `json:"steps"`
+	}
+	parse := func(artifactJSON string) migration {
+		t.Helper()
+		var artifact struct {
+			Migration migration `json:"migration"`
+		}
+		if err := json.Unmarshal([]byte(artifactJSON), &artifact); err != nil {
+			t.Fatal(err)
+		}
+		return artifact.Migration
+	}
+
+	first := parse(v1)
+	if first.Version != "001" || len(first.Steps) != 1 {
+		t.Fatalf("first build: version %s with %d steps, want 001 with 1", first.Version, len(first.Steps))
+	}
+
+	second := parse(v2)
+	if second.Version != "003" || len(second.Steps) != 3 {
+		t.Fatalf("second build: version %s with %d steps, want 003 with 3", second.Version, len(second.Steps))
+	}
+	// The new enum value is committed in its own step before the default
+	// that uses it
+	if enum := second.Steps[1]; len(enum.Up) != 1 || enum.Up[0] != "ALTER TYPE tickets_status ADD VALUE IF NOT EXISTS 'pending';" {
+		t.Errorf("step 002 up = %q, want only the added enum value", enum.Up)
+	}
+	step := second.Steps[2]
+	up := strings.Join(step.Up, "\n")
+	if strings.Contains(up, "ADD VALUE") {
+		t.Errorf("step 003 must not add enum values:\n%s", up)
+	}
+	for _, want := range []string{
+		"ALTER TABLE tickets ALTER COLUMN status SET DEFAULT 'pending';",
+		"ALTER TABLE tickets ADD COLUMN IF NOT EXISTS priority integer NOT NULL DEFAULT 0;",
+		"CREATE TABLE IF NOT EXISTS tags (",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_name ON tags (name);",
+	} {
+		if !strings.Contains(up, want) {
+			t.Errorf("step 003 up is missing %q:\n%s", want, up)
+		}
+	}
+	if strings.Contains(up, "CREATE TABLE IF NOT EXISTS tickets") {
+		t.Errorf("step 003 must not recreate existing tables:\n%s", up)
+	}
+	down := strings.Join(step.Down, "\n")
+	for _, want := range []string{
+		"ALTER TABLE tickets DROP COLUMN IF EXISTS priority;",
+		"DROP TABLE IF EXISTS tags CASCADE;",
+	} {
+		if !strings.Contains(down, want) {
+			t.Errorf("step 003 down is missing %q:\n%s", want, down)
+		}
+	}
+
+	if third := parse(v3); third.Version != "003" || len(third.Steps) != 3 {
+		t.Errorf("unchanged rebuild: version %s with %d steps, want 003 with 3", third.Version, len(third.Steps))
+	}
+}
+
+func TestCompileIncremental_DataMigration(t *testing.T) {
+	dir := t.TempDir()
+	forgeFile := filepath.Join(dir, "app.forge")
+	type step struct {
+		Version string   `json:"version"`
+		Up      []string `json:"up"`
+		Down    []string `json:"down"`
+	}
+	compile := func(content string, previous []byte) (string, []step) {
+		t.Helper()
+		if err := os.WriteFile(forgeFile, []byte("app TestApp {\n  database: postgres\n}\n"+content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result := CompileIncremental([]string{forgeFile}, previous)
+		if result.HasErrors {
+			for _, d := range result.Diagnostics {
+				t.Logf("  %s: %s", d.Code, d.Message)
+			}
+			t.Fatal("expected no errors")
+		}
+		var artifact struct {
+			Migration struct {
+				Steps []step `json:"steps"`
+			} `json:"migration"`
+		}
+		if err := json.Unmarshal([]byte(result.Output.ArtifactJSON), &artifact); err != nil {
+			t.Fatal(err)
+		}
+		return result.Output.ArtifactJSON, artifact.Migration.Steps
+	}
+	expect := func(name string, stmts []string, want ...string) {
+		t.Helper()
+		joined := strings.Join(stmts, "\n")
+		for _, w := range want {
+			if !strings.Contains(joined, w) {
+				t.Errorf("%s is missing %q:\n%s", name, w, joined)
+			}
+		}
+	}
+
+	v1, _ := compile(`
+entity Subscription {
+  plan: enum(free, pro) = free
+}
+`, nil)
+
+	v2Source := `
+entity Subscription {
+  tier: enum(free, starter, pro, enterprise) = free
+  seats: int = 1
+}
+`
+	migrateV2 := `
+migrate Subscription.v2 {
+  from: plan enum(free, pro)
+  to: tier enum(free, starter, pro, enterprise)
+
+  map:
+    pro -> starter
+}
+`
+	v2, steps := compile(v2Source+migrateV2, []byte(v1))
+	if len(steps) != 3 {
+		t.Fatalf("expected the data migration and schema change as steps 002 and 003, got %d steps", len(steps))
+	}
+	expect("data migration up", steps[1].Up,
+		"CREATE TYPE subscriptions_tier AS ENUM ('free', 'starter', 'pro', 'enterprise');",
+		"ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS tier subscriptions_tier;",
+		"CASE plan::text WHEN 'pro' THEN 'starter' WHEN 'free' THEN 'free' END",
+		"LIMIT 1000",
+		"RAISE EXCEPTION 'migrate Subscription.v2: subscriptions.plan has values with no mapping'",
+		"ALTER TABLE subscriptions DROP COLUMN IF EXISTS plan;",
+		"DROP TYPE IF EXISTS subscriptions_plan;",
+		"ALTER TABLE subscriptions ALTER COLUMN tier SET NOT NULL;",
+	)
+	expect("data migration down", steps[1].Down,
+		"ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS plan subscriptions_plan;",
+		"CASE tier::text WHEN 'starter' THEN 'pro' WHEN 'free' THEN 'free' END",
+		"DROP TYPE IF EXISTS subscriptions_tier;",
+	)
+	expect("schema change up", steps[2].Up, "ADD COLUMN IF NOT EXISTS seats integer NOT NULL DEFAULT 1;")
+	if up := strings.Join(steps[2].Up, "\n"); strings.Contains(up, "plan") || strings.Contains(up, "tier") {
+		t.Errorf("schema change must leave the migrated columns to the data migration:\n%s", up)
+	}
+
+	// Once recorded, the data migration is not planned again
+	v3, steps := compile(v2Source+migrateV2, []byte(v2))
+	if len(steps) != 3 {
+		t.Errorf("unchanged rebuild: %d steps, want 3", len(steps))
+	}
+
+	// Migrating a column in place goes through a temporary column and type
+	_, steps = compile(`
+entity Subscription {
+  tier: enum(free, starter, business) = free
+  seats: int = 1
+}
+`+migrateV2+`
+migrate Subscription.v3 {
+  from: tier enum(free, starter, pro, enterprise)
+  to: tier enum(free, starter, business)
+
+  map:
+    pro -> business
+    enterprise -> business
+}
+`, []byte(v3))
+	if len(steps) != 4 {
+		t.Fatalf("expected the in-place migration as step 004, got %d steps", len(steps))
+	}
+	expect("in-place migration up", steps[3].Up,
+		"CREATE TYPE subscriptions_tier_next AS ENUM ('free', 'starter', 'business');",
+		"ADD COLUMN IF NOT EXISTS tier_next subscriptions_tier_next;",
+		"ALTER TABLE subscriptions DROP COLUMN IF EXISTS tier;",
+		"ALTER TABLE subscriptions RENAME COLUMN tier_next TO tier;",
+		"ALTER TYPE subscriptions_tier_next RENAME TO subscriptions_tier;",
+		"ALTER TABLE subscriptions ALTER COLUMN tier SET DEFAULT 'free';",
+	)
+	expect("in-place migration down", steps[3].Down, "cannot be rolled back")
+}
+
+func TestCompileIncremental_LegacyArtifact(t *testing.T) {
+	dir := t.TempDir()
+	forgeFile := filepath.Join(dir, "app.forge")
+	type step struct {
+		Version string   `json:"version"`
+		Up      []string `json:"up"`
+		Down    []string `json:"down"`
+	}
+	compile := func(content string, previous []byte) (string, []step) {
+		t.Helper()
+		if err := os.WriteFile(forgeFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result := CompileIncremental([]string{forgeFile}, previous)
+		if result.HasErrors {
+			for _, d := range result.Diagnostics {
+				t.Logf("  %s: %s", d.Code, d.Message)
+			}
+			t.Fatal("expected no errors")
+		}
+		var artifact struct {
+			Migration struct {
+				Steps []step `json:"steps"`
+			} `json:"migration"`
+		}
+		if err := json.Unmarshal([]byte(result.Output.ArtifactJSON), &artifact); err != nil {
+			t.Fatal(err)
+		}
+		return result.Output.ArtifactJSON, artifact.Migration.Steps
+	}
+
+	source := `
+app TestApp {
+  auth: token
+  database: postgres
+}
+
+entity User {
+  email: string unique
+}
+
+entity Ticket {
+  subject: string
+  status: enum(open, closed) = open
+}
+
+relation Ticket.author -> User
+
+access Ticket {
+  read: user == author
+  write: user == author
+}
+`
+	v1, _ := compile(source, nil)
+
+	// An artifact built before migrations were versioned has only up and down
+	var legacy map[string]any
+	if err := json.Unmarshal([]byte(v1), &legacy); err != nil {
+		t.Fatal(err)
+	}
+	migration := legacy["migration"].(map[string]any)
+	delete(migration, "steps")
+	delete(migration, "schema")
+	previous, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, steps := compile(strings.Replace(source, "subject: string", "subject: string\n  priority: int = 0", 1), previous)
+	if len(steps) != 2 || steps[0].Version != "001" || steps[1].Version != "002" {
+		t.Fatalf("expected the legacy migration as step 001 and the change as 002, got %+v", steps)
+	}
+	if len(steps[0].Up) != len(migration["up"].([]any)) {
+		t.Error("step 001 must be the legacy up statements")
+	}
+	up := strings.Join(steps[1].Up, "\n")
+	if want := "ALTER TABLE tickets ADD COLUMN IF NOT EXISTS priority integer NOT NULL DEFAULT 0;"; up != want {
+		t.Errorf("step 002 up = %q, want only %q", up, want)
+	}
+	if down := strings.Join(steps[1].Down, "\n"); down != "ALTER TABLE tickets DROP COLUMN IF EXISTS priority;" {
+		t.Errorf("unexpected step 002 down: %q", down)
+	}
+}
+
+func TestCompileIncremental_LegacyTableNames(t *testing.T) {
+	dir := t.TempDir()
+	forgeFile := filepath.Join(dir, "app.forge")
+	if err := os.WriteFile(forgeFile, []byte(`
+app TestApp {
+  auth: token
+  database: postgres
+}
+
+entity Category {
+  name: string unique
+  kind: enum(bug, task) = bug
+}
+
+entity Ticket {
+  subject: string
+}
+
+relation Ticket.category -> Category
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same app as built before tables were named by naming.TableName
+	previous, err := json.Marshal(map[string]any{
+		"migration": map[string]any{
+			"version": "001",
+			"up": []string{
+				"CREATE TYPE categorys_kind AS ENUM ('bug', 'task');",
+				"CREATE TABLE IF NOT EXISTS categorys (\n    id uuid NOT NULL DEFAULT gen_random_uuid(),\n    created_at timestamp with time zone NOT NULL DEFAULT now(),\n    updated_at timestamp with time zone NOT NULL DEFAULT now(),\n    name text NOT NULL,\n    kind categorys_kind NOT NULL DEFAULT 'bug',\n    PRIMARY KEY (id)\n);",
+				"CREATE TABLE IF NOT EXISTS tickets (\n    id uuid NOT NULL DEFAULT gen_random_uuid(),\n    created_at timestamp with time zone NOT NULL DEFAULT now(),\n    updated_at timestamp with time zone NOT NULL DEFAULT now(),\n    subject text NOT NULL,\n    category_id uuid NOT NULL REFERENCES categorys(id) ON DELETE cascade,\n    PRIMARY KEY (id)\n);",
+				"CREATE UNIQUE INDEX IF NOT EXISTS idx_categorys_name ON categorys (name);",
+				"CREATE INDEX IF NOT EXISTS idx_tickets_category_id ON tickets (category_id);",
+				"ALTER TABLE categorys ENABLE ROW LEVEL SECURITY;",
+				"ALTER TABLE tickets ENABLE ROW LEVEL SECURITY;",
+			},
+			"down": []string{
+				"DROP TABLE IF EXISTS tickets CASCADE;",
+				"DROP TABLE IF EXISTS categorys CASCADE;",
+				"DROP TYPE IF EXISTS categorys_kind;",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := CompileIncremental([]string{forgeFile}, previous)
+	if result.HasErrors {
+		for _, d := range result.Diagnostics {
+			t.Logf("  %s: %s", d.Code, d.Message)
+		}
+		t.Fatal("expected no errors")
+	}
+	var artifact struct {
+		Migration struct {
+			Steps []struct {
+				Up   []string `json:"up"`
+				Down []string `json:"down"`
+			} `json:"steps"`
+		} `json:"migration"`
+	}
+	if err := json.Unmarshal([]byte(result.Output.ArtifactJSON), &artifact); err != nil {
+		t.Fatal(err)
+	}
+	steps := artifact.Migration.Steps
+	if len(steps) != 3 {
+		t.Fatalf("expected the legacy migration, the renames and the index changes, got %d steps", len(steps))
+	}
+
+	if up, want := strings.Join(steps[1].Up, "\n"), "ALTER TABLE categorys RENAME TO categories;\nALTER TYPE categorys_kind RENAME TO categories_kind;"; up != want {
+		t.Errorf("step 002 up = %q, want %q", up, want)
+	}
+	if down, want := strings.Join(steps[1].Down, "\n"), "ALTER TABLE categories RENAME TO categorys;\nALTER TYPE categories_kind RENAME TO categorys_kind;"; down != want {
+		t.Errorf("step 002 down = %q, want %q", down, want)
+	}
+	up := strings.Join(steps[2].Up, "\n")
+	for _, want := range []string{
+		"DROP INDEX IF EXISTS idx_categorys_name;",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_name ON categories (name);",
+	} {
+		if !strings.Contains(up, want) {
+			t.Errorf("step 003 up is missing %q:\n%s", want, up)
+		}
+	}
+	for _, step := range steps[1:] {
+		if all := strings.Join(append(step.Up, step.Down...), "\n"); strings.Contains(all, "TABLE IF") || strings.Contains(all, "COLUMN") {
+			t.Errorf("renamed tables must keep their rows:\n%s", all)
+		}
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && searchSubstring(s, substr)
 }
@@ -0,0 +1,13 @@
+package forge
+
+import (
+	"io"
+
+	"github.com/forge-lang/forge/compiler/internal/lsp"
+)
+
+// ServeLSP runs the FORGE language server, reading JSON-RPC requests from in
+// and writing responses to out until the client exits.
+func ServeLSP(in io.Reader, out io.Writer) error {
+	return lsp.Serve(in, out)
+}
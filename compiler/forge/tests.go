@@ -0,0 +1,113 @@
+package forge
+
+import (
+	"github.com/forge-lang/forge/compiler/internal/analyzer"
+	"github.com/forge-lang/forge/compiler/internal/ast"
+	"github.com/forge-lang/forge/compiler/internal/diag"
+)
+
+// TestCase is a test declaration resolved for execution by the runtime.
+type TestCase struct {
+	Name     string // the test's target, e.g. "Ticket.update"
+	Filename string
+	Line     int
+	Column   int
+	Given    []TestValue
+	When     TestWhen
+	Expect   TestExpect
+}
+
+// TestValue sets or reads a field. Value is a string (also for enum
+// values), int64, float64, bool or nil.
+type TestValue struct {
+	Entity string
+	Field  string
+	Value  any
+}
+
+// TestWhen is the operation a test performs: create, update or delete of
+// the entity Target, or action to run the action Target.
+type TestWhen struct {
+	Operation string
+	Target    string
+}
+
+// TestExpect is the outcome a test asserts: a rejection, optionally with a
+// message code, or a field value after the operation.
+type TestExpect struct {
+	Reject  bool
+	Message string
+	TestValue
+}
+
+// TestSuite contains the tests declared in a set of .forge files.
+type TestSuite struct {
+	Tests       []*TestCase
+	Diagnostics []Diagnostic
+	HasErrors   bool
+}
+
+// Tests parses and analyzes files and returns their test declarations.
+// Tests are only returned when the files have no errors.
+func Tests(files []string) *TestSuite {
+	suite := &TestSuite{}
+
+	combined, allDiags := parseAndAnalyze(files)
+
+	for _, d := range allDiags.All() {
+		suite.Diagnostics = append(suite.Diagnostics, Diagnostic{
+			Filename: d.Range.Start.Filename,
+			Line:     d.Range.Start.Line,
+			Column:   d.Range.Start.Column,
+			Severity: d.Severity.String(),
+			Code:     d.Code,
+			Message:  d.Message,
+		})
+		if d.Severity == diag.Error {
+			suite.HasErrors = true
+		}
+	}
+
+	if combined == nil || suite.HasErrors {
+		return suite
+	}
+
+	// Get scope from analyzer
+	a := analyzer.New(combined)
+	a.Analyze()
+	scope := a.Scope()
+
+	for _, test := range combined.Tests {
+		tc := &TestCase{
+			Name:     test.Target.String(),
+			Filename: test.Pos().Filename,
+			Line:     test.Pos().Line,
+			Column:   test.Pos().Column,
+			When: TestWhen{
+				Operation: test.When.Action.Name,
+				Target:    test.When.Target.Name,
+			},
+			Expect: TestExpect{Reject: test.Expect.Reject},
+		}
+		for _, given := range test.Given {
+			tc.Given = append(tc.Given, testValue(scope, test, given.Path, given.Value))
+		}
+		if test.Expect.Reject {
+			if test.Expect.Message != nil {
+				tc.Expect.Message = test.Expect.Message.Name
+			}
+		} else {
+			tc.Expect.TestValue = testValue(scope, test, test.Expect.Path, test.Expect.Value)
+		}
+		suite.Tests = append(suite.Tests, tc)
+	}
+
+	return suite
+}
+
+// testValue resolves a given or expect clause of test.
+func testValue(scope *analyzer.Scope, test *ast.TestDecl, path *ast.PathExpr, value ast.Expr) TestValue {
+	entity, field := scope.TestField(test, path)
+	v, _ := analyzer.LiteralValue(value)
+	return TestValue{Entity: entity, Field: field, Value: v}
+}
@@ -0,0 +1,75 @@
+package forge
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTests(t *testing.T) {
+	dir := t.TempDir()
+	content := `
+app TestApp {
+  auth: token
+  database: postgres
+}
+
+entity Ticket {
+  subject: string
+  status: enum(open, closed) = open
+  score: int = 0
+}
+
+action close_ticket {
+  input: Ticket
+  updates: Ticket
+}
+
+test Ticket.update {
+  given status = closed
+  when update Ticket
+  expect reject TICKET_CLOSED
+}
+
+test close_ticket {
+  given Ticket.score = -2
+  when action close_ticket
+  expect Ticket.status = closed
+}
+`
+	forgeFile := filepath.Join(dir, "app.forge")
+	if err := os.WriteFile(forgeFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	suite := Tests([]string{forgeFile})
+	if suite.HasErrors {
+		t.Fatalf("unexpected errors: %+v", suite.Diagnostics)
+	}
+	if len(suite.Tests) != 2 {
+		t.Fatalf("expected 2 tests, got %d", len(suite.Tests))
+	}
+
+	update := suite.Tests[0]
+	if update.Name != "Ticket.update" || update.Filename != forgeFile || update.Line != 18 {
+		t.Errorf("unexpected test %s at %s:%d", update.Name, update.Filename, update.Line)
+	}
+	if !reflect.DeepEqual(update.Given, []TestValue{{Entity: "Ticket", Field: "status", Value: "closed"}}) {
+		t.Errorf("given = %+v", update.Given)
+	}
+	if update.When != (TestWhen{Operation: "update", Target: "Ticket"}) {
+		t.Errorf("when = %+v", update.When)
+	}
+	if !update.Expect.Reject || update.Expect.Message != "TICKET_CLOSED" {
+		t.Errorf("expect = %+v", update.Expect)
+	}
+
+	action := suite.Tests[1]
+	if !reflect.DeepEqual(action.Given, []TestValue{{Entity: "Ticket", Field: "score", Value: int64(-2)}}) {
+		t.Errorf("given = %+v", action.Given)
+	}
+	if action.Expect.Reject || action.Expect.TestValue != (TestValue{Entity: "Ticket", Field: "status", Value: "closed"}) {
+		t.Errorf("expect = %+v", action.Expect)
+	}
+}
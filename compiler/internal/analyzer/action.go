@@ -0,0 +1,260 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"github.com/forge-lang/forge/compiler/internal/ast"
+	"github.com/forge-lang/forge/compiler/internal/diag"
+)
+
+// actionScalarTypes are the types an action input field may have besides an
+// entity, which makes the field a reference to a record of it.
+var actionScalarTypes = map[string]bool{
+	"string": true,
+	"int":    true,
+	"float":  true,
+	"bool":   true,
+	"time":   true,
+	"uuid":   true,
+	"enum":   true,
+}
+
+// actionCRUDProperties are the properties of an action operating on a single
+// entity, which an action with an input block or steps replaces.
+var actionCRUDProperties = map[string]bool{
+	"input":   true,
+	"creates": true,
+	"updates": true,
+	"deletes": true,
+}
+
+// validateAction checks the input block and steps of an action. Steps refer
+// to the records of the action by their input fields: set ticket.status
+// changes the Ticket whose id the ticket input field holds.
+func (a *Analyzer) validateAction(action *ast.ActionDecl) {
+	if action.Input == nil && len(action.Steps) == 0 {
+		return
+	}
+	name := action.Name.Name
+
+	for _, prop := range action.Properties {
+		if actionCRUDProperties[prop.Key.Name] {
+			a.diag.AddError(diag.Range{Start: prop.Pos(), End: prop.End()}, diag.ErrInvalidActionStep,
+				fmt.Sprintf("action %s: %s cannot be combined with an input block or steps", name, prop.Key.Name))
+		}
+	}
+
+	if action.Input != nil {
+		seen := make(map[string]bool)
+		for _, field := range action.Input.Fields {
+			rng := diag.Range{Start: field.Pos(), End: field.End()}
+			switch fieldName := field.Name.Name; {
+			case seen[fieldName]:
+				a.diag.AddError(rng, diag.ErrDuplicateField,
+					fmt.Sprintf("duplicate field %s in input of action %s", fieldName, name))
+				continue
+			case fieldName == "user" || fieldName == "input":
+				a.diag.AddError(rng, diag.ErrInvalidActionInput,
+					fmt.Sprintf("input field %s of action %s is reserved", fieldName, name))
+			case field.Hidden || field.Read != nil:
+				a.diag.AddError(rng, diag.ErrInvalidActionInput,
+					fmt.Sprintf("input field %s of action %s cannot be hidden or have a read condition", fieldName, name))
+			}
+			seen[field.Name.Name] = true
+
+			typeName := field.Type.Name
+			if _, isEntity := a.scope.Entities[typeName.Name]; !isEntity && !actionScalarTypes[typeName.Name] {
+				a.reportUndefined(typeName, diag.ErrInvalidActionInput,
+					fmt.Sprintf("unknown type %s of input field %s in action %s", typeName.Name, field.Name.Name, name),
+					names(a.scope.Entities))
+			}
+		}
+	}
+
+	for _, step := range action.Steps {
+		a.validateActionStep(action, step)
+		if step.Condition != nil {
+			a.validateActionExpr(action, step.Condition)
+		}
+	}
+}
+
+func (a *Analyzer) validateActionStep(action *ast.ActionDecl, step *ast.ActionStep) {
+	name := action.Name.Name
+	rng := diag.Range{Start: step.Pos(), End: step.End()}
+
+	switch step.Kind {
+	case "emit", "reject":
+		if _, exists := a.scope.Messages[step.Target.Name]; !exists {
+			a.reportUndefined(step.Target, diag.ErrUndefinedMessage,
+				fmt.Sprintf("undefined message %s in action %s", step.Target.Name, name),
+				names(a.scope.Messages))
+		}
+
+	case "set":
+		a.validateActionExpr(action, step.Value)
+		if len(step.Path.Parts) != 2 {
+			a.diag.AddError(rng, diag.ErrInvalidActionStep,
+				fmt.Sprintf("action %s: set %s must name a record and one of its fields, as in set ticket.status", name, step.Path.String()))
+			return
+		}
+		record := step.Path.Parts[0]
+		_, entityName := a.scope.ActionRecord(action, record.Name)
+		if entityName == "" {
+			a.reportUndefined(record, diag.ErrInvalidActionStep,
+				fmt.Sprintf("action %s: %s is not a record input of the action", name, record.Name),
+				a.scope.actionRecordNames(action))
+			return
+		}
+		entity := a.scope.Entities[entityName]
+		field := step.Path.Parts[1]
+		if !a.scope.isWritableMember(entity, field.Name) {
+			a.reportUndefined(field, diag.ErrUndefinedField,
+				fmt.Sprintf("undefined field %s in %s (context: action %s)", field.Name, entityName, name),
+				a.scope.memberNames(entity))
+		}
+
+	case "create":
+		entity, exists := a.scope.Entities[step.Target.Name]
+		if !exists {
+			a.reportUndefined(step.Target, diag.ErrUndefinedEntity,
+				fmt.Sprintf("undefined entity %s in action %s", step.Target.Name, name),
+				names(a.scope.Entities))
+		}
+		for _, m := range step.Mappings {
+			if exists && !a.scope.isWritableMember(entity, m.Field.Name) {
+				a.reportUndefined(m.Field, diag.ErrUndefinedField,
+					fmt.Sprintf("undefined field %s in %s (context: action %s)", m.Field.Name, entity.Name, name),
+					a.scope.memberNames(entity))
+			}
+			a.validateActionExpr(action, m.Value)
+		}
+	}
+}
+
+// validateActionExpr checks the paths of an action step expression. A path
+// starts at the user, at input, or at an input field; a path through a
+// record input continues through the fields and relations of its entity.
+func (a *Analyzer) validateActionExpr(action *ast.ActionDecl, expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.PathExpr:
+		parts := e.Parts
+		switch {
+		case len(parts) < 2 || parts[0].Name == "user":
+			return
+		case parts[0].Name == "input":
+			parts = parts[1:]
+		}
+
+		field := actionInputField(action, parts[0].Name)
+		if field == nil {
+			a.reportUndefined(parts[0], diag.ErrUndefinedField,
+				fmt.Sprintf("undefined input field %s in action %s", parts[0].Name, action.Name.Name),
+				actionInputNames(action))
+			return
+		}
+		if len(parts) == 1 {
+			return
+		}
+		entity, isRecord := a.scope.Entities[field.Type.Name.Name]
+		if !isRecord {
+			a.diag.AddError(diag.Range{Start: e.Pos(), End: e.End()}, diag.ErrInvalidPath,
+				fmt.Sprintf("input field %s of action %s is not a record", parts[0].Name, action.Name.Name))
+			return
+		}
+		a.validatePath(&ast.PathExpr{Parts: append([]*ast.Ident{{Name: entity.Name}}, parts[1:]...)},
+			"action "+action.Name.Name)
+
+	case *ast.BinaryExpr:
+		a.validateActionExpr(action, e.Left)
+		a.validateActionExpr(action, e.Right)
+
+	case *ast.UnaryExpr:
+		a.validateActionExpr(action, e.Operand)
+
+	case *ast.InExpr:
+		a.validateActionExpr(action, e.Left)
+		a.validateActionExpr(action, e.Right)
+
+	case *ast.ParenExpr:
+		a.validateActionExpr(action, e.Inner)
+
+	case *ast.CallExpr:
+		for _, arg := range e.Args {
+			a.validateActionExpr(action, arg)
+		}
+	}
+}
+
+// isWritableMember reports whether name is a field or a to-one relation of
+// entity, which a step may set.
+func (s *Scope) isWritableMember(entity *Entity, name string) bool {
+	if _, ok := entity.Fields[name]; ok {
+		return true
+	}
+	rel, ok := s.Relations[entity.Name+"."+name]
+	return ok && !rel.IsMany
+}
+
+// ActionRecord resolves the record a set step of action names to the input
+// field holding its id and the field's entity. The record is named by the
+// input field, or by its entity when exactly one input field refers to it.
+// Both are empty when name is neither.
+func (s *Scope) ActionRecord(action *ast.ActionDecl, name string) (field, entity string) {
+	if f := actionInputField(action, name); f != nil {
+		if _, ok := s.Entities[f.Type.Name.Name]; ok {
+			return f.Name.Name, f.Type.Name.Name
+		}
+		return "", ""
+	}
+	if _, ok := s.Entities[name]; !ok || action.Input == nil {
+		return "", ""
+	}
+	for _, f := range action.Input.Fields {
+		if f.Type.Name.Name != name {
+			continue
+		}
+		if field != "" {
+			return "", ""
+		}
+		field, entity = f.Name.Name, name
+	}
+	return field, entity
+}
+
+// actionRecordNames returns the input fields of action referring to records.
+func (s *Scope) actionRecordNames(action *ast.ActionDecl) []string {
+	var records []string
+	if action.Input != nil {
+		for _, f := range action.Input.Fields {
+			if _, ok := s.Entities[f.Type.Name.Name]; ok {
+				records = append(records, f.Name.Name)
+			}
+		}
+	}
+	return records
+}
+
+// actionInputField returns the input field of action named name, or nil.
+func actionInputField(action *ast.ActionDecl, name string) *ast.FieldDecl {
+	if action.Input == nil {
+		return nil
+	}
+	for _, f := range action.Input.Fields {
+		if f.Name.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// actionInputNames returns the names of the input fields of action.
+func actionInputNames(action *ast.ActionDecl) []string {
+	var fields []string
+	if action.Input != nil {
+		for _, f := range action.Input.Fields {
+			fields = append(fields, f.Name.Name)
+		}
+	}
+	return fields
+}
@@ -4,9 +4,11 @@ package analyzer
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/forge-lang/forge/compiler/internal/ast"
 	"github.com/forge-lang/forge/compiler/internal/diag"
+	"github.com/forge-lang/forge/compiler/naming"
 )
 
 // FieldType represents a field's resolved type.
@@ -15,11 +17,14 @@ type FieldType struct {
 	IsEnum     bool
 	EnumValues []string
 	IsUnique   bool
+	Hidden     bool
+	Read       ast.Expr // condition on the user reading the field, or nil
 }
 
 // Entity represents an analyzed entity.
 type Entity struct {
 	Name   string
+	Table  string // from @table, or derived from Name
 	Fields map[string]*FieldType
 	Decl   *ast.EntityDecl
 }
@@ -30,18 +35,48 @@ type Relation struct {
 	FromField  string
 	ToEntity   string
 	IsMany     bool
+	Column     string // foreign key of a to-one relation, from @column or derived from FromField
 	Decl       *ast.RelationDecl
 }
 
+// JoinTable returns the table holding the links of a many relation, named
+// after the owning entity and the relation, and its columns referencing the
+// owning record and the target record: "organization_members",
+// "organization_id" and "user_id" for Organization.members -> User. The target
+// column of a relation from an entity to itself is named after the relation.
+func (r *Relation) JoinTable() (table, key, targetKey string) {
+	owner := naming.Snake(r.FromEntity)
+	key = naming.ForeignKey(owner)
+	targetKey = naming.ForeignKey(naming.Snake(r.ToEntity))
+	if targetKey == key {
+		targetKey = naming.ForeignKey(r.FromField)
+	}
+	return owner + "_" + r.FromField, key, targetKey
+}
+
 // Scope represents the analysis scope.
 type Scope struct {
-	Entities  map[string]*Entity
-	Relations map[string]*Relation // key: "Entity.field"
-	Actions   map[string]*ast.ActionDecl
-	Messages  map[string]*ast.MessageDecl
-	Jobs      map[string]*ast.JobDecl
-	Views     map[string]*ast.ViewDecl
-	Webhooks  map[string]*ast.WebhookDecl
+	Entities    map[string]*Entity
+	Relations   map[string]*Relation // key: "Entity.field"
+	Actions     map[string]*ast.ActionDecl
+	Messages    map[string]*ast.MessageDecl
+	Jobs        map[string]*ast.JobDecl
+	Views       map[string]*ast.ViewDecl
+	Presences   map[string]*Presence
+	Webhooks    map[string]*ast.WebhookDecl
+	Imperatives map[string]*ast.ImperativeDecl
+	Migrations  map[string]*ast.MigrateDecl // key: "Entity.version"
+}
+
+// TableName returns the table of an entity, the one it declares with @table
+// or else the one derived from its name.
+func (s *Scope) TableName(entity string) string {
+	if s != nil {
+		if e, ok := s.Entities[entity]; ok {
+			return e.Table
+		}
+	}
+	return naming.TableName(entity)
 }
 
 // Analyzer performs semantic analysis on a FORGE AST.
@@ -56,13 +91,16 @@ func New(file *ast.File) *Analyzer {
 	return &Analyzer{
 		file: file,
 		scope: &Scope{
-			Entities:  make(map[string]*Entity),
-			Relations: make(map[string]*Relation),
-			Actions:   make(map[string]*ast.ActionDecl),
-			Messages:  make(map[string]*ast.MessageDecl),
-			Jobs:      make(map[string]*ast.JobDecl),
-			Views:     make(map[string]*ast.ViewDecl),
-			Webhooks:  make(map[string]*ast.WebhookDecl),
+			Entities:    make(map[string]*Entity),
+			Relations:   make(map[string]*Relation),
+			Actions:     make(map[string]*ast.ActionDecl),
+			Messages:    make(map[string]*ast.MessageDecl),
+			Jobs:        make(map[string]*ast.JobDecl),
+			Views:       make(map[string]*ast.ViewDecl),
+			Presences:   make(map[string]*Presence),
+			Webhooks:    make(map[string]*ast.WebhookDecl),
+			Imperatives: make(map[string]*ast.ImperativeDecl),
+			Migrations:  make(map[string]*ast.MigrateDecl),
 		},
 		diag: diag.New(),
 	}
@@ -104,9 +142,13 @@ func (a *Analyzer) collectDeclarations() {
 
 		e := &Entity{
 			Name:   entity.Name.Name,
+			Table:  naming.TableName(entity.Name.Name),
 			Fields: make(map[string]*FieldType),
 			Decl:   entity,
 		}
+		if entity.Table != nil {
+			e.Table = entity.Table.Name
+		}
 
 		for _, field := range entity.Fields {
 			if _, exists := e.Fields[field.Name.Name]; exists {
@@ -119,7 +161,9 @@ func (a *Analyzer) collectDeclarations() {
 			}
 
 			ft := &FieldType{
-				Name: field.Type.Name.Name,
+				Name:   field.Type.Name.Name,
+				Hidden: field.Hidden,
+				Read:   field.Read,
 			}
 
 			if field.Type.Name.Name == "enum" {
@@ -162,13 +206,20 @@ func (a *Analyzer) collectDeclarations() {
 			continue
 		}
 
-		a.scope.Relations[key] = &Relation{
+		r := &Relation{
 			FromEntity: rel.From.Parts[0].Name,
 			FromField:  rel.From.Parts[1].Name,
 			ToEntity:   rel.To.Name,
 			IsMany:     rel.Many,
 			Decl:       rel,
 		}
+		if !rel.Many {
+			r.Column = naming.ForeignKey(r.FromField)
+			if rel.Column != nil {
+				r.Column = rel.Column.Name
+			}
+		}
+		a.scope.Relations[key] = r
 	}
 
 	// Collect actions
@@ -207,6 +258,11 @@ func (a *Analyzer) collectDeclarations() {
 		a.scope.Views[view.Name.Name] = view
 	}
 
+	// Collect presences
+	for _, presence := range a.file.Presences {
+		a.collectPresence(presence)
+	}
+
 	// Collect webhooks
 	for _, webhook := range a.file.Webhooks {
 		if _, exists := a.scope.Webhooks[webhook.Name.Name]; exists {
@@ -219,9 +275,101 @@ func (a *Analyzer) collectDeclarations() {
 		}
 		a.scope.Webhooks[webhook.Name.Name] = webhook
 	}
+
+	// Collect imperatives
+	for _, imp := range a.file.Imperatives {
+		if _, exists := a.scope.Imperatives[imp.Name.Name]; exists {
+			a.diag.AddError(
+				diag.Range{Start: imp.Pos(), End: imp.End()},
+				diag.ErrDuplicateImperative,
+				fmt.Sprintf("duplicate imperative: %s", imp.Name.Name),
+			)
+			continue
+		}
+		a.scope.Imperatives[imp.Name.Name] = imp
+	}
+
+	// Collect migrations
+	for _, mig := range a.file.Migrations {
+		if mig.Target == nil {
+			continue
+		}
+		key := mig.Target.String()
+		if _, exists := a.scope.Migrations[key]; exists {
+			a.diag.AddError(
+				diag.Range{Start: mig.Pos(), End: mig.End()},
+				diag.ErrDuplicateMigration,
+				fmt.Sprintf("duplicate migration: %s", key),
+			)
+			continue
+		}
+		a.scope.Migrations[key] = mig
+	}
+}
+
+// validateTables checks that no two entities share a table and that every
+// relation column is free to hold the foreign key.
+func (a *Analyzer) validateTables() {
+	tables := make(map[string]string)
+	for _, decl := range a.file.Entities {
+		entity, ok := a.scope.Entities[decl.Name.Name]
+		if !ok || entity.Decl != decl {
+			continue
+		}
+		if other, exists := tables[entity.Table]; exists {
+			a.diag.AddError(
+				diag.Range{Start: decl.Pos(), End: decl.End()},
+				diag.ErrDuplicateTable,
+				fmt.Sprintf("entities %s and %s are both stored in table %s", other, entity.Name, entity.Table),
+			)
+			continue
+		}
+		tables[entity.Table] = entity.Name
+	}
+
+	columns := make(map[string]string) // "Entity.column" -> relation field
+	for _, decl := range a.file.Relations {
+		rel, ok := a.scope.Relations[decl.From.String()]
+		if !ok || rel.Decl != decl {
+			continue
+		}
+		if decl.Column != nil && rel.IsMany {
+			a.diag.AddError(
+				diag.Range{Start: decl.Column.Pos(), End: decl.Column.End()},
+				diag.ErrInvalidColumn,
+				fmt.Sprintf("many relation %s has no column, its links are stored in a join table", decl.From.String()),
+			)
+			continue
+		}
+		if rel.Column == "" {
+			continue
+		}
+		if entity, exists := a.scope.Entities[rel.FromEntity]; exists {
+			if _, clash := entity.Fields[rel.Column]; clash {
+				a.diag.AddError(
+					diag.Range{Start: decl.Pos(), End: decl.End()},
+					diag.ErrInvalidColumn,
+					fmt.Sprintf("column %s of relation %s is already a field of %s", rel.Column, decl.From.String(), rel.FromEntity),
+				)
+				continue
+			}
+		}
+		key := rel.FromEntity + "." + rel.Column
+		if other, exists := columns[key]; exists {
+			a.diag.AddError(
+				diag.Range{Start: decl.Pos(), End: decl.End()},
+				diag.ErrInvalidColumn,
+				fmt.Sprintf("relations %s.%s and %s both use column %s", rel.FromEntity, other, decl.From.String(), rel.Column),
+			)
+			continue
+		}
+		columns[key] = rel.FromField
+	}
 }
 
 func (a *Analyzer) resolveReferences() {
+	a.validateTables()
+
 	// Validate relation references
 	for key, rel := range a.scope.Relations {
 		if _, exists := a.scope.Entities[rel.FromEntity]; !exists {
@@ -255,17 +403,16 @@ func (a *Analyzer) resolveReferences() {
 				}
 			}
 		}
+		a.validateAction(action)
 	}
 
 	// Validate job references
 	for _, job := range a.file.Jobs {
 		if job.Input != nil {
 			if _, exists := a.scope.Entities[job.Input.Name]; !exists {
-				a.diag.AddError(
-					diag.Range{Start: job.Input.Pos(), End: job.Input.End()},
-					diag.ErrUndefinedEntity,
+				a.reportUndefined(job.Input, diag.ErrUndefinedEntity,
 					fmt.Sprintf("undefined entity %s in job %s", job.Input.Name, job.Name.Name),
-				)
+					names(a.scope.Entities))
 			}
 		}
 
@@ -273,15 +420,36 @@ func (a *Analyzer) resolveReferences() {
 			a.validatePath(job.Needs.Path, job.Name.Name)
 		}
 
+		// A single-name effect calls an imperative instead of a provider
+		// capability.
+		if job.Effect != nil && len(job.Effect.Parts) == 1 {
+			name := job.Effect.Parts[0]
+			if _, exists := a.scope.Imperatives[name.Name]; !exists {
+				a.reportUndefined(name, diag.ErrUndefinedImperative,
+					fmt.Sprintf("undefined imperative %s in job %s", name.Name, job.Name.Name),
+					names(a.scope.Imperatives))
+			}
+		}
+
 		if job.Creates != nil {
 			if _, exists := a.scope.Entities[job.Creates.Entity.Name]; !exists {
-				a.diag.AddError(
-					diag.Range{Start: job.Creates.Entity.Pos(), End: job.Creates.Entity.End()},
-					diag.ErrUndefinedEntity,
+				a.reportUndefined(job.Creates.Entity, diag.ErrUndefinedEntity,
 					fmt.Sprintf("undefined target entity %s in job %s creates clause", job.Creates.Entity.Name, job.Name.Name),
+					names(a.scope.Entities))
+			}
+		}
+
+		if job.Schedule != nil {
+			if err := validateCron(job.Schedule.Value); err != nil {
+				a.diag.AddError(
+					diag.Range{Start: job.Schedule.Pos(), End: job.Schedule.End()},
+					diag.ErrInvalidSchedule,
+					fmt.Sprintf("invalid schedule in job %s: %v", job.Name.Name, err),
 				)
 			}
 		}
+
+		a.validateRetryPolicy(job)
 	}
 
 	// Validate hook references
@@ -297,28 +465,91 @@ func (a *Analyzer) resolveReferences() {
 			}
 		}
 
+		var entityName string
+		if len(hook.Target.Parts) >= 1 {
+			entityName = hook.Target.Parts[0].Name
+		}
+		var timing string
+		if len(hook.Target.Parts) >= 2 {
+			timing = hook.Target.Parts[1].Name
+		}
+		isBefore := strings.HasPrefix(timing, "before_")
+
 		for _, action := range hook.Actions {
-			if action.Kind == "enqueue" {
+			switch action.Kind {
+			case "enqueue":
 				if _, exists := a.scope.Jobs[action.Target.Name]; !exists {
-					a.diag.AddError(
-						diag.Range{Start: action.Target.Pos(), End: action.Target.End()},
-						diag.ErrUndefinedJob,
+					a.reportUndefined(action.Target, diag.ErrUndefinedJob,
 						fmt.Sprintf("undefined job %s in hook", action.Target.Name),
+						names(a.scope.Jobs))
+				}
+				if action.Delay != nil && action.Delay.Value <= 0 {
+					a.diag.AddError(
+						diag.Range{Start: action.Delay.Pos(), End: action.Delay.End()},
+						diag.ErrInvalidHookAction,
+						fmt.Sprintf("enqueue delay must be positive, got %s", action.Delay.Literal),
 					)
 				}
+
+			case "emit", "reject":
+				if _, exists := a.scope.Messages[action.Target.Name]; !exists {
+					a.reportUndefined(action.Target, diag.ErrUndefinedMessage,
+						fmt.Sprintf("undefined message %s in hook", action.Target.Name),
+						names(a.scope.Messages))
+				}
+
+			case "set":
+				if entity, exists := a.scope.Entities[entityName]; exists {
+					if _, hasField := entity.Fields[action.Target.Name]; !hasField {
+						a.reportUndefined(action.Target, diag.ErrUndefinedField,
+							fmt.Sprintf("undefined field %s in %s hook", action.Target.Name, entityName),
+							names(entity.Fields))
+					}
+				}
+				if action.Value != nil {
+					a.validateExprPaths(action.Value, entityName)
+				}
+			}
+
+			// reject and set change the pending write, so they only make
+			// sense before it happens.
+			if (action.Kind == "reject" || action.Kind == "set") && !isBefore {
+				a.diag.AddError(
+					diag.Range{Start: action.StartPos, End: action.EndPos},
+					diag.ErrInvalidHookAction,
+					fmt.Sprintf("%s is only allowed in before_* hooks", action.Kind),
+				)
+			} else if action.Kind == "set" && timing == "before_delete" {
+				a.diag.AddError(
+					diag.Range{Start: action.StartPos, End: action.EndPos},
+					diag.ErrInvalidHookAction,
+					"set has no effect in before_delete hooks",
+				)
+			}
+
+			if action.Condition != nil {
+				a.validateExprPaths(action.Condition, entityName)
 			}
 		}
 	}
 
-	// Validate view references
+	// Validate presences
+	for _, presence := range a.scope.Presences {
+		a.validatePresence(presence)
+	}
+
+	// Validate view references; a view may read a presence as well
 	for _, view := range a.file.Views {
 		if view.Source != nil {
-			if _, exists := a.scope.Entities[view.Source.Name]; !exists {
-				a.diag.AddError(
-					diag.Range{Start: view.Source.Pos(), End: view.Source.End()},
-					diag.ErrUndefinedEntity,
+			_, isEntity := a.scope.Entities[view.Source.Name]
+			_, isPresence := a.scope.Presences[view.Source.Name]
+			if !isEntity && !isPresence {
+				a.reportUndefined(view.Source, diag.ErrUndefinedEntity,
 					fmt.Sprintf("undefined source entity %s in view %s", view.Source.Name, view.Name.Name),
-				)
+					append(names(a.scope.Entities), names(a.scope.Presences)...))
+			}
+			if isEntity {
+				a.validateViewVisibility(view)
 			}
 		}
 	}
@@ -347,11 +578,9 @@ func (a *Analyzer) resolveReferences() {
 		// Validate triggers action reference
 		if webhook.Triggers != nil {
 			if _, exists := a.scope.Actions[webhook.Triggers.Name]; !exists {
-				a.diag.AddError(
-					diag.Range{Start: webhook.Triggers.Pos(), End: webhook.Triggers.End()},
-					diag.ErrUndefinedAction,
+				a.reportUndefined(webhook.Triggers, diag.ErrUndefinedAction,
 					fmt.Sprintf("undefined action %s in webhook %s", webhook.Triggers.Name, webhook.Name.Name),
-				)
+					names(a.scope.Actions))
 			}
 		} else {
 			a.diag.AddError(
@@ -361,6 +590,38 @@ func (a *Analyzer) resolveReferences() {
 			)
 		}
 	}
+
+	// Validate imperatives
+	for _, imp := range a.file.Imperatives {
+		if imp.Input != nil {
+			if _, exists := a.scope.Entities[imp.Input.Name]; !exists {
+				a.reportUndefined(imp.Input, diag.ErrUndefinedEntity,
+					fmt.Sprintf("undefined entity %s in imperative %s", imp.Input.Name, imp.Name.Name),
+					names(a.scope.Entities))
+			}
+		}
+
+		// Effects name provider capabilities, which are always provider.action
+		for _, effect := range imp.Effects {
+			if !strings.Contains(effect.Name, ".") {
+				a.diag.AddError(
+					diag.Range{Start: effect.Pos(), End: effect.End()},
+					diag.ErrInvalidEffect,
+					fmt.Sprintf("invalid effect %s in imperative %s: expected provider.action", effect.Name, imp.Name.Name),
+				)
+			}
+		}
+	}
+
+	// Validate migrations
+	for _, mig := range a.scope.Migrations {
+		a.validateMigration(mig)
+	}
+
+	// Validate tests
+	for _, test := range a.file.Tests {
+		a.validateTest(test)
+	}
 }
 
 func (a *Analyzer) validateRulesAndAccess() {
@@ -381,11 +642,9 @@ func (a *Analyzer) validateRulesAndAccess() {
 			// Validate emit references message
 			if clause.Emit != nil {
 				if _, exists := a.scope.Messages[clause.Emit.Name]; !exists {
-					a.diag.AddError(
-						diag.Range{Start: clause.Emit.Pos(), End: clause.Emit.End()},
-						diag.ErrUndefinedMessage,
+					a.reportUndefined(clause.Emit, diag.ErrUndefinedMessage,
 						fmt.Sprintf("undefined message %s in rule", clause.Emit.Name),
-					)
+						names(a.scope.Messages))
 				}
 			}
 
@@ -396,14 +655,17 @@ func (a *Analyzer) validateRulesAndAccess() {
 		}
 	}
 
+	// Validate field read conditions
+	for _, entity := range a.file.Entities {
+		a.validateFieldReads(entity)
+	}
+
 	// Validate access rules
 	for _, access := range a.file.Access {
 		if _, exists := a.scope.Entities[access.Entity.Name]; !exists {
-			a.diag.AddError(
-				diag.Range{Start: access.Entity.Pos(), End: access.Entity.End()},
-				diag.ErrUndefinedEntity,
+			a.reportUndefined(access.Entity, diag.ErrUndefinedEntity,
 				fmt.Sprintf("undefined entity %s in access rule", access.Entity.Name),
-			)
+				names(a.scope.Entities))
 		}
 
 		if access.Read != nil {
@@ -434,7 +696,9 @@ func (a *Analyzer) validateDependencies() {
 		path[entity] = true
 
 		for key, rel := range a.scope.Relations {
-			if rel.FromEntity == entity {
+			// A many relation lives in its own join table, so it adds no
+			// column to either entity
+			if rel.FromEntity == entity && !rel.IsMany {
 				if checkCycle(rel.ToEntity) {
 					a.diag.AddError(
 						diag.Range{Start: rel.Decl.Pos(), End: rel.Decl.End()},
@@ -455,6 +719,40 @@ func (a *Analyzer) validateDependencies() {
 	}
 }
 
+// backoffStrategies are the strategies a job's backoff may use.
+var backoffStrategies = map[string]bool{
+	"exponential": true,
+	"linear":      true,
+	"fixed":       true,
+}
+
+// validateRetryPolicy checks a job's backoff and timeout. Durations must be
+// positive and a backoff's max may not be below its base.
+func (a *Analyzer) validateRetryPolicy(job *ast.JobDecl) {
+	if b := job.Backoff; b != nil {
+		rng := diag.Range{Start: b.Pos(), End: b.End()}
+		switch {
+		case !backoffStrategies[b.Strategy.Name]:
+			a.diag.AddError(rng, diag.ErrInvalidRetryPolicy,
+				fmt.Sprintf("unknown backoff strategy %s in job %s (expected exponential, linear or fixed)", b.Strategy.Name, job.Name.Name))
+		case b.Base != nil && b.Base.Value <= 0:
+			a.diag.AddError(rng, diag.ErrInvalidRetryPolicy,
+				fmt.Sprintf("backoff in job %s must start above zero, got %s", job.Name.Name, b.Base.Literal))
+		case b.Base != nil && b.Max != nil && b.Max.Value < b.Base.Value:
+			a.diag.AddError(rng, diag.ErrInvalidRetryPolicy,
+				fmt.Sprintf("backoff max %s in job %s is below its base %s", b.Max.Literal, job.Name.Name, b.Base.Literal))
+		}
+	}
+
+	if t := job.Timeout; t != nil && t.Value <= 0 {
+		a.diag.AddError(
+			diag.Range{Start: t.Pos(), End: t.End()},
+			diag.ErrInvalidRetryPolicy,
+			fmt.Sprintf("timeout in job %s must be positive, got %s", job.Name.Name, t.Literal),
+		)
+	}
+}
+
 func (a *Analyzer) validatePath(path *ast.PathExpr, context string) {
 	if path == nil || len(path.Parts) == 0 {
 		return
@@ -488,12 +786,10 @@ func (a *Analyzer) validatePath(path *ast.PathExpr, context string) {
 			}
 		}
 
-		a.diag.AddError(
-			diag.Range{Start: path.Parts[i].Pos(), End: path.Parts[i].End()},
-			diag.ErrUndefinedField,
+		a.reportUndefined(path.Parts[i], diag.ErrUndefinedField,
 			fmt.Sprintf("undefined field or relation %s in %s (context: %s)",
 				fieldName, currentEntity.Name, context),
-		)
+			a.scope.memberNames(currentEntity))
 		return
 	}
 }
@@ -501,8 +797,8 @@ func (a *Analyzer) validatePath(path *ast.PathExpr, context string) {
 func (a *Analyzer) validateExprPaths(expr ast.Expr, entityContext string) {
 	switch e := expr.(type) {
 	case *ast.PathExpr:
-		// First part could be 'user' (special), a field, or a relation
-		if len(e.Parts) > 0 && e.Parts[0].Name != "user" {
+		// First part could be 'user' or 'input' (special), a field, or a relation
+		if len(e.Parts) > 0 && e.Parts[0].Name != "user" && e.Parts[0].Name != "input" {
 			a.validatePath(e, entityContext)
 		}
 
@@ -189,6 +189,100 @@ rule Ticket.update {
 	}
 }
 
+func TestAnalyzer_UndefinedReferenceFix(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		code  string
+		fix   string // empty if no fix is expected
+	}{
+		{"misspelled message", `
+entity Ticket {
+	status: enum(open, closed) = open
+}
+
+rule Ticket.update {
+	forbid if status == closed
+		emit TICKET_CLOSD
+}
+
+message TICKET_CLOSED {
+	level: error
+	default: "Closed"
+}
+`, diag.ErrUndefinedMessage, "TICKET_CLOSED"},
+		{"misspelled field", `
+entity Ticket {
+	status: enum(open, closed) = open
+}
+
+rule Ticket.update {
+	forbid if Ticket.stauts == closed
+		emit TICKET_CLOSED
+}
+
+message TICKET_CLOSED {
+	level: error
+	default: "Closed"
+}
+`, diag.ErrUndefinedField, "status"},
+		{"misspelled entity", `
+entity Ticket {
+	subject: string
+}
+
+access ticket {
+	read: true
+}
+`, diag.ErrUndefinedEntity, "Ticket"},
+		{"unrelated name", `
+entity Ticket {
+	subject: string
+}
+
+view Inbox {
+	source: Notification
+	fields: subject
+}
+`, diag.ErrUndefinedEntity, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, parseDiags := parser.Parse(tt.input, "test.forge")
+			if parseDiags.HasErrors() {
+				t.Fatalf("parse errors: %v", parseDiags.Errors())
+			}
+			_, diags := Analyze(file)
+
+			var d *diag.Diagnostic
+			for _, e := range diags.Errors() {
+				if e.Code == tt.code {
+					d = &e
+					break
+				}
+			}
+			if d == nil {
+				t.Fatalf("expected %s, got %v", tt.code, diags.Errors())
+			}
+
+			if tt.fix == "" {
+				if d.FixHint != nil {
+					t.Errorf("expected no fix, got %q", d.FixHint.Title)
+				}
+				return
+			}
+			if d.FixHint == nil || len(d.FixHint.Edits) != 1 {
+				t.Fatalf("expected a single-edit fix, got %+v", d.FixHint)
+			}
+			edit := d.FixHint.Edits[0]
+			if edit.NewText != tt.fix || edit.Range != d.Range {
+				t.Errorf("fix = %q over %v, want %q over %v", edit.NewText, edit.Range, tt.fix, d.Range)
+			}
+		})
+	}
+}
+
 func TestAnalyzer_DuplicateRelation(t *testing.T) {
 	input := `
 entity User {
@@ -254,6 +348,357 @@ hook Ticket.after_create {
 	}
 }
 
+func TestAnalyzer_JobSchedules(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		wantCode string // empty means no errors
+	}{
+		{"cron", "job digest {\n\tschedule: \"*/15 7-19 * * 1-5\"\n}", ""},
+		{"descriptor", "job digest {\n\tschedule: \"@daily\"\n}", ""},
+		{"too few fields", "job digest {\n\tschedule: \"0 7 * *\"\n}", diag.ErrInvalidSchedule},
+		{"out of range", "job digest {\n\tschedule: \"0 24 * * *\"\n}", diag.ErrInvalidSchedule},
+		{"bad step", "job digest {\n\tschedule: \"*/0 * * * *\"\n}", diag.ErrInvalidSchedule},
+		{"unknown descriptor", "job digest {\n\tschedule: \"@sometimes\"\n}", diag.ErrInvalidSchedule},
+		{"delayed enqueue", "job remind {\n}\nhook Ticket.after_create {\n\tenqueue remind in 24h\n}", ""},
+		{"zero delay", "job remind {\n}\nhook Ticket.after_create {\n\tenqueue remind in 0s\n}", diag.ErrInvalidHookAction},
+		{"retry policy", "job sync {\n\tretry: 5\n\tbackoff: exponential(2s, max 10m)\n\ttimeout: 2m\n}", ""},
+		{"unknown backoff", "job sync {\n\tbackoff: random(2s)\n}", diag.ErrInvalidRetryPolicy},
+		{"zero backoff", "job sync {\n\tbackoff: linear(0s)\n}", diag.ErrInvalidRetryPolicy},
+		{"backoff max below base", "job sync {\n\tbackoff: exponential(1m, max 10s)\n}", diag.ErrInvalidRetryPolicy},
+		{"zero timeout", "job sync {\n\ttimeout: 0ms\n}", diag.ErrInvalidRetryPolicy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "entity Ticket {\n\tsubject: string\n}\n" + tt.src
+
+			file, parseDiags := parser.Parse(input, "test.forge")
+			if parseDiags.HasErrors() {
+				t.Fatalf("parse errors: %v", parseDiags.Errors())
+			}
+			_, diags := Analyze(file)
+
+			if tt.wantCode == "" {
+				if diags.HasErrors() {
+					t.Fatalf("unexpected errors: %v", diags.Errors())
+				}
+				return
+			}
+			for _, d := range diags.Errors() {
+				if d.Code == tt.wantCode {
+					return
+				}
+			}
+			t.Errorf("expected %s, got %v", tt.wantCode, diags.Errors())
+		})
+	}
+}
+
+func TestAnalyzer_Imperatives(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		wantCode string // empty means no errors
+	}{
+		{"valid", "imperative export_csv {\n\tinput: Ticket\n\treturns: file\n\teffects: [email.send]\n}", ""},
+		{"job effect", "imperative export_csv {\n\tinput: Ticket\n}\njob nightly_export {\n\tinput: Ticket\n\teffect: export_csv\n}", ""},
+		{"undefined input", "imperative export_csv {\n\tinput: Tciket\n}", diag.ErrUndefinedEntity},
+		{"duplicate", "imperative export_csv {\n}\nimperative export_csv {\n}", diag.ErrDuplicateImperative},
+		{"bare effect", "imperative export_csv {\n\teffects: [email]\n}", diag.ErrInvalidEffect},
+		{"undefined job effect", "job nightly_export {\n\teffect: export_csv\n}", diag.ErrUndefinedImperative},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "entity Ticket {\n\tsubject: string\n}\n" + tt.src
+
+			file, parseDiags := parser.Parse(input, "test.forge")
+			if parseDiags.HasErrors() {
+				t.Fatalf("parse errors: %v", parseDiags.Errors())
+			}
+			scope, diags := Analyze(file)
+
+			if tt.wantCode == "" {
+				if diags.HasErrors() {
+					t.Fatalf("unexpected errors: %v", diags.Errors())
+				}
+				if scope.Imperatives["export_csv"] == nil {
+					t.Error("expected export_csv in scope")
+				}
+				return
+			}
+			for _, d := range diags.Errors() {
+				if d.Code == tt.wantCode {
+					return
+				}
+			}
+			t.Errorf("expected %s, got %v", tt.wantCode, diags.Errors())
+		})
+	}
+}
+
+func TestAnalyzer_Presences(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		wantCode string // empty means no errors
+		wantVia  string
+	}{
+		{"scope from source", "relation User.workspace -> Workspace\npresence UserPresence {\n\tsource: User\n\tstatus: enum(online, offline) = offline\n\tscope: workspace\n}", "", "source"},
+		{"scope from scope entity", "relation Workspace.members -> User many\npresence UserPresence {\n\tsource: User\n\tttl: 30s\n\tscope: workspace\n}", "", "scope"},
+		{"view over presence", "relation User.workspace -> Workspace\npresence UserPresence {\n\tsource: User\n\tscope: workspace\n}\nview Online {\n\tsource: UserPresence\n\tfields: user.name\n}", "", "source"},
+		{"undefined source", "presence UserPresence {\n\tsource: Usr\n\tscope: workspace\n}", diag.ErrUndefinedEntity, ""},
+		{"missing scope", "presence UserPresence {\n\tsource: User\n}", diag.ErrInvalidPresence, ""},
+		{"unrelated scope", "presence UserPresence {\n\tsource: User\n\tscope: workspace\n}", diag.ErrUndefinedRelation, ""},
+		{"many scope on source", "relation User.workspace -> Workspace many\npresence UserPresence {\n\tsource: User\n\tscope: workspace\n}", diag.ErrInvalidPresence, ""},
+		{"ambiguous scope", "relation Workspace.members -> User many\nrelation Workspace.guests -> User many\npresence UserPresence {\n\tsource: User\n\tscope: workspace\n}", diag.ErrInvalidPresence, ""},
+		{"zero ttl", "relation User.workspace -> Workspace\npresence UserPresence {\n\tsource: User\n\tttl: 0s\n\tscope: workspace\n}", diag.ErrInvalidPresence, ""},
+		{"reserved field", "relation User.workspace -> Workspace\npresence UserPresence {\n\tsource: User\n\tupdated_at: time\n\tscope: workspace\n}", diag.ErrInvalidPresence, ""},
+		{"duplicate", "relation User.workspace -> Workspace\npresence UserPresence {\n\tsource: User\n\tscope: workspace\n}\npresence UserPresence {\n\tsource: User\n\tscope: workspace\n}", diag.ErrDuplicatePresence, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "entity User {\n\tname: string\n}\nentity Workspace {\n\tname: string\n}\n" + tt.src
+
+			file, parseDiags := parser.Parse(input, "test.forge")
+			if parseDiags.HasErrors() {
+				t.Fatalf("parse errors: %v", parseDiags.Errors())
+			}
+			scope, diags := Analyze(file)
+
+			if tt.wantCode == "" {
+				if diags.HasErrors() {
+					t.Fatalf("unexpected errors: %v", diags.Errors())
+				}
+				p := scope.Presences["UserPresence"]
+				if p == nil {
+					t.Fatal("expected UserPresence in scope")
+				}
+				if p.SourceField != "user" || p.ScopeEntity != "Workspace" || p.ScopeVia != tt.wantVia {
+					t.Errorf("unexpected presence %+v", p)
+				}
+				return
+			}
+			for _, d := range diags.Errors() {
+				if d.Code == tt.wantCode {
+					return
+				}
+			}
+			t.Errorf("expected %s, got %v", tt.wantCode, diags.Errors())
+		})
+	}
+}
+
+func TestAnalyzer_HookSteps(t *testing.T) {
+	tests := []struct {
+		name     string
+		hook     string
+		wantCode string
+	}{
+		{
+			name:     "valid before hook",
+			hook:     "hook Ticket.before_create {\n\treject CLOSED if status == closed\n\tset status = open\n}",
+			wantCode: "",
+		},
+		{
+			name:     "set in after hook",
+			hook:     "hook Ticket.after_create {\n\tset status = open\n}",
+			wantCode: diag.ErrInvalidHookAction,
+		},
+		{
+			name:     "set in before_delete hook",
+			hook:     "hook Ticket.before_delete {\n\tset status = open\n}",
+			wantCode: diag.ErrInvalidHookAction,
+		},
+		{
+			name:     "reject in after hook",
+			hook:     "hook Ticket.after_update {\n\treject CLOSED\n}",
+			wantCode: diag.ErrInvalidHookAction,
+		},
+		{
+			name:     "undefined message",
+			hook:     "hook Ticket.before_create {\n\treject NOPE\n}",
+			wantCode: diag.ErrUndefinedMessage,
+		},
+		{
+			name:     "undefined field",
+			hook:     "hook Ticket.before_create {\n\tset nope = 1\n}",
+			wantCode: diag.ErrUndefinedField,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := `
+entity Ticket {
+	status: enum(open, closed) = open
+}
+
+message CLOSED {
+	level: error
+	default: "Closed"
+}
+` + tt.hook
+
+			file, parseDiags := parser.Parse(input, "test.forge")
+			if parseDiags.HasErrors() {
+				t.Fatalf("parse errors: %v", parseDiags.Errors())
+			}
+			_, diags := Analyze(file)
+
+			if tt.wantCode == "" {
+				if diags.HasErrors() {
+					t.Fatalf("unexpected errors: %v", diags.Errors())
+				}
+				return
+			}
+
+			found := false
+			for _, d := range diags.Errors() {
+				if d.Code == tt.wantCode {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Errorf("expected %s, got %v", tt.wantCode, diags.Errors())
+			}
+		})
+	}
+}
+
+func TestAnalyzer_ActionSteps(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   string
+		wantCode string
+	}{
+		{"valid steps", "input {\n\tticket: Ticket\n\treason: string\n}\nreject CLOSED if ticket.status == closed\nset ticket.status = closed\ncreate Comment { ticket: input.ticket, body: input.reason }\nemit CLOSED", ""},
+		{"record named by entity", "input {\n\tticket: Ticket\n}\nset Ticket.status = closed", ""},
+		{"unknown input type", "input {\n\tticket: Tickt\n}", diag.ErrInvalidActionInput},
+		{"reserved input field", "input {\n\tuser: User\n}", diag.ErrInvalidActionInput},
+		{"duplicate input field", "input {\n\tticket: Ticket\n\tticket: Ticket\n}", diag.ErrDuplicateField},
+		{"mixed with input property", "input: Ticket\ninput {\n\tticket: Ticket\n}", diag.ErrInvalidActionStep},
+		{"set on scalar input", "input {\n\treason: string\n}\nset reason.body = \"x\"", diag.ErrInvalidActionStep},
+		{"set without field", "input {\n\tticket: Ticket\n}\nset ticket = closed", diag.ErrInvalidActionStep},
+		{"set undefined field", "input {\n\tticket: Ticket\n}\nset ticket.nope = 1", diag.ErrUndefinedField},
+		{"create undefined entity", "create Note { body: \"x\" }", diag.ErrUndefinedEntity},
+		{"create undefined field", "create Comment { nope: \"x\" }", diag.ErrUndefinedField},
+		{"undefined input in expression", "input {\n\tticket: Ticket\n}\nset ticket.status = closed if input.reason == \"x\"", diag.ErrUndefinedField},
+		{"undefined message", "emit NOPE", diag.ErrUndefinedMessage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := `
+entity User {
+	name: string
+}
+
+entity Ticket {
+	status: enum(open, closed) = open
+}
+
+entity Comment {
+	body: string
+}
+
+relation Comment.ticket -> Ticket
+
+message CLOSED {
+	level: error
+	default: "Closed"
+}
+
+action close_ticket {
+` + tt.action + "\n}"
+
+			file, parseDiags := parser.Parse(input, "test.forge")
+			if parseDiags.HasErrors() {
+				t.Fatalf("parse errors: %v", parseDiags.Errors())
+			}
+			_, diags := Analyze(file)
+
+			if tt.wantCode == "" {
+				if diags.HasErrors() {
+					t.Fatalf("unexpected errors: %v", diags.Errors())
+				}
+				return
+			}
+			for _, d := range diags.Errors() {
+				if d.Code == tt.wantCode {
+					return
+				}
+			}
+			t.Errorf("expected %s, got %v", tt.wantCode, diags.Errors())
+		})
+	}
+}
+
+func TestAnalyzer_FieldVisibility(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    string
+		view     string
+		wantCode string
+	}{
+		{"hidden field", "password_hash: string hidden", "source: User\n\tfields: name", ""},
+		{"read condition on the user", "ssn: string read: user.role == admin", "source: User\n\tfields: name, ssn", ""},
+		{"read condition on the record", "ssn: string read: user == name", "source: User\n\tfields: name", diag.ErrInvalidAccessExpr},
+		{"read condition on a field", "ssn: string read: name == \"x\"", "source: User\n\tfields: name", diag.ErrInvalidAccessExpr},
+		{"hidden with read condition", "ssn: string hidden read: user.role == admin", "source: User\n\tfields: name", diag.ErrInvalidAccessExpr},
+		{"hidden field shown", "password_hash: string hidden", "source: User\n\tfields: name, password_hash", diag.ErrFieldVisibility},
+		{"hidden field of relation shown", "password_hash: string hidden", "source: Ticket\n\tfields: subject, owner.password_hash", diag.ErrFieldVisibility},
+		{"hidden field filtered", "password_hash: string hidden", "source: User\n\tfields: name\n\tfilter: password_hash == param.hash", diag.ErrFieldVisibility},
+		{"hidden field sorted", "password_hash: string hidden", "source: User\n\tfields: name\n\tsort: password_hash", diag.ErrFieldVisibility},
+		{"read condition field filtered", "ssn: string read: user.role == admin", "source: User\n\tfields: name\n\tfilter: ssn == param.ssn", diag.ErrFieldVisibility},
+		{"read condition field sorted", "ssn: string read: user.role == admin", "source: User\n\tfields: name, ssn\n\tsort: ssn", diag.ErrFieldVisibility},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := `
+entity User {
+	name: string
+	role: enum(admin, member) = member
+	` + tt.field + `
+}
+
+entity Ticket {
+	subject: string
+}
+
+relation Ticket.owner -> User
+
+view Listing {
+	` + tt.view + `
+}
+`
+
+			file, parseDiags := parser.Parse(input, "test.forge")
+			if parseDiags.HasErrors() {
+				t.Fatalf("parse errors: %v", parseDiags.Errors())
+			}
+			_, diags := Analyze(file)
+
+			if tt.wantCode == "" {
+				if diags.HasErrors() {
+					t.Fatalf("unexpected errors: %v", diags.Errors())
+				}
+				return
+			}
+			for _, d := range diags.Errors() {
+				if d.Code == tt.wantCode {
+					return
+				}
+			}
+			t.Errorf("expected %s, got %v", tt.wantCode, diags.Errors())
+		})
+	}
+}
+
 func TestAnalyzer_EntityFields(t *testing.T) {
 	input := `
 entity User {
@@ -300,6 +745,80 @@ entity User {
 	}
 }
 
+func TestAnalyzer_TableNames(t *testing.T) {
+	input := `
+entity Category {
+	name: string
+}
+
+entity Person {
+	@table: legacy_people
+	name: string
+}
+
+entity Ticket {
+	subject: string
+}
+
+relation Person.category -> Category
+relation Ticket.author -> Person @column: created_by
+relation Category.people -> Person many
+`
+
+	file, _ := parser.Parse(input, "test.forge")
+	scope, diags := Analyze(file)
+
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %v", diags.Errors())
+	}
+
+	if got := scope.TableName("Category"); got != "categories" {
+		t.Errorf("Category table = %q, want categories", got)
+	}
+	if got := scope.TableName("Person"); got != "legacy_people" {
+		t.Errorf("Person table = %q, want legacy_people", got)
+	}
+
+	columns := map[string]string{"Person.category": "category_id", "Ticket.author": "created_by", "Category.people": ""}
+	for key, want := range columns {
+		if got := scope.Relations[key].Column; got != want {
+			t.Errorf("%s column = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestAnalyzer_TableNameErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantCode string
+	}{
+		{"shared table", "entity Person {\n\t@table: users\n\tname: string\n}", diag.ErrDuplicateTable},
+		{"column on many relation", "relation Ticket.watchers -> User many @column: watcher_ids", diag.ErrInvalidColumn},
+		{"column clashing with a field", "relation Ticket.author -> User @column: subject", diag.ErrInvalidColumn},
+		{"column shared by relations", "relation Ticket.author -> User\nrelation Ticket.owner -> User @column: author_id", diag.ErrInvalidColumn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "entity User {\n\temail: string\n}\n\nentity Ticket {\n\tsubject: string\n}\n\n" + tt.input
+
+			file, parseDiags := parser.Parse(input, "test.forge")
+			if parseDiags.HasErrors() {
+				t.Fatalf("parse errors: %v", parseDiags.Errors())
+			}
+			_, diags := Analyze(file)
+
+			for _, d := range diags.Errors() {
+				if d.Code == tt.wantCode {
+					return
+				}
+			}
+			t.Errorf("expected %s, got %v", tt.wantCode, diags.Errors())
+		})
+	}
+}
+
 func TestAnalyzer_JobCreatesValidEntity(t *testing.T) {
 	input := `
 entity Ticket {
@@ -372,3 +891,221 @@ job log_activity {
 		t.Error("expected diag.ErrUndefinedEntity for undefined entity in creates clause")
 	}
 }
+
+func TestAnalyzer_Migration(t *testing.T) {
+	entity := `
+entity Subscription {
+	tier: enum(free, starter, pro, enterprise) = free
+	legacy: string
+}
+`
+	tests := []struct {
+		name    string
+		migrate string
+		code    string
+	}{
+		{"valid", `migrate Subscription.v2 {
+	from: plan enum(free, pro)
+	to: tier enum(free, starter, pro, enterprise)
+	map:
+		pro -> starter
+}`, ""},
+		{"undefined entity", `migrate Plan.v2 {
+	from: plan enum(free, pro)
+	to: tier enum(free, starter)
+	map:
+		pro -> starter
+}`, diag.ErrUndefinedEntity},
+		{"bad version", `migrate Subscription.next {
+	from: plan enum(free, pro)
+	to: tier enum(free, starter, pro, enterprise)
+}`, diag.ErrInvalidMigration},
+		{"missing field names", `migrate Subscription.v2 {
+	from: enum(free, pro)
+	to: enum(free, starter, pro, enterprise)
+}`, diag.ErrInvalidMigration},
+		{"type mismatch", `migrate Subscription.v2 {
+	from: plan enum(free, pro)
+	to: tier enum(free, starter)
+	map:
+		pro -> starter
+}`, diag.ErrTypeMismatch},
+		{"in place", `migrate Subscription.v2 {
+	from: tier enum(free, pro)
+	to: tier enum(free, starter, pro, enterprise)
+}`, ""},
+		{"old field still declared", `migrate Subscription.v2 {
+	from: legacy string
+	to: tier enum(free, starter, pro, enterprise)
+	map:
+		gold -> pro
+}`, diag.ErrInvalidMigration},
+		{"unknown value", `migrate Subscription.v2 {
+	from: plan enum(free, pro)
+	to: tier enum(free, starter, pro, enterprise)
+	map:
+		premium -> starter
+}`, diag.ErrInvalidMigrationMap},
+		{"unknown target value", `migrate Subscription.v2 {
+	from: plan enum(free, pro)
+	to: tier enum(free, starter, pro, enterprise)
+	map:
+		pro -> gold
+}`, diag.ErrInvalidMigrationMap},
+		{"nothing mapped", `migrate Subscription.v2 {
+	from: plan enum(basic, premium)
+	to: tier enum(free, starter, pro, enterprise)
+}`, diag.ErrInvalidMigrationMap},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, parseDiags := parser.Parse(entity+tt.migrate, "test.forge")
+			if parseDiags.HasErrors() {
+				t.Fatalf("parse errors: %v", parseDiags.Errors())
+			}
+
+			_, analyzerDiags := Analyze(file)
+
+			if tt.code == "" {
+				if analyzerDiags.HasErrors() {
+					t.Fatalf("unexpected errors: %v", analyzerDiags.Errors())
+				}
+				return
+			}
+			for _, d := range analyzerDiags.Errors() {
+				if d.Code == tt.code {
+					return
+				}
+			}
+			t.Errorf("expected %s, got %v", tt.code, analyzerDiags.Errors())
+		})
+	}
+}
+
+func TestAnalyzer_MigrationHistory(t *testing.T) {
+	input := `
+entity Subscription {
+	level: enum(basic, premium) = basic
+}
+
+migrate Subscription.v2 {
+	from: plan enum(free, pro)
+	to: tier enum(free, starter, pro)
+	map:
+		pro -> starter
+}
+
+migrate Subscription.v3 {
+	from: tier enum(free, starter, pro)
+	to: level enum(basic, premium)
+	map:
+		free -> basic
+		starter -> premium
+		pro -> premium
+}
+
+migrate Subscription.v3 {
+	from: tier enum(free, starter, pro)
+	to: level enum(basic, premium)
+	map:
+		free -> basic
+}
+`
+	file, parseDiags := parser.Parse(input, "test.forge")
+	if parseDiags.HasErrors() {
+		t.Fatalf("parse errors: %v", parseDiags.Errors())
+	}
+
+	_, analyzerDiags := Analyze(file)
+
+	// v2 migrates to a field v3 migrates again, so only the duplicate is reported
+	errs := analyzerDiags.Errors()
+	if len(errs) != 1 || errs[0].Code != diag.ErrDuplicateMigration {
+		t.Errorf("expected only %s, got %v", diag.ErrDuplicateMigration, errs)
+	}
+}
+
+func TestAnalyzer_Test(t *testing.T) {
+	decls := `
+entity Ticket {
+	subject: string
+	status: enum(open, closed) = open
+}
+
+action close_ticket {
+	input: Ticket
+}
+`
+	tests := []struct {
+		name string
+		test string
+		code string
+	}{
+		{"reject", `test Ticket.update {
+	given status = closed
+	when update Ticket
+	expect reject TICKET_CLOSED
+}`, ""},
+		{"action with qualified paths", `test close_ticket {
+	given Ticket.status = open
+	when action close_ticket
+	expect Ticket.status = closed
+}`, ""},
+		{"action input entity", `test close_ticket {
+	given subject = "Printer"
+	when action close_ticket
+	expect subject = "Printer"
+}`, ""},
+		{"unknown operation", `test Ticket.archive {
+	when archive Ticket
+	expect reject TICKET_CLOSED
+}`, diag.ErrInvalidTest},
+		{"undefined entity", `test Invoice.create {
+	when create Invoice
+	expect reject NOPE
+}`, diag.ErrUndefinedEntity},
+		{"undefined action", `test reopen_ticket {
+	when action reopen_ticket
+	expect reject NOPE
+}`, diag.ErrUndefinedAction},
+		{"undefined field", `test Ticket.create {
+	when create Ticket
+	expect priority = high
+}`, diag.ErrUndefinedField},
+		{"missing expect", `test Ticket.create {
+	when create Ticket
+}`, diag.ErrInvalidTest},
+		{"missing when", `test Ticket.create {
+	expect status = open
+}`, diag.ErrInvalidTest},
+		{"value not a literal", `test Ticket.create {
+	when create Ticket
+	expect subject = status == open
+}`, diag.ErrInvalidTest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, parseDiags := parser.Parse(decls+tt.test, "test.forge")
+			if parseDiags.HasErrors() {
+				t.Fatalf("parse errors: %v", parseDiags.Errors())
+			}
+
+			_, analyzerDiags := Analyze(file)
+
+			if tt.code == "" {
+				if analyzerDiags.HasErrors() {
+					t.Fatalf("unexpected errors: %v", analyzerDiags.Errors())
+				}
+				return
+			}
+			for _, d := range analyzerDiags.Errors() {
+				if d.Code == tt.code {
+					return
+				}
+			}
+			t.Errorf("expected %s, got %v", tt.code, analyzerDiags.Errors())
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package analyzer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cronDescriptors are the shorthand schedules accepted in place of five fields.
+var cronDescriptors = map[string]bool{
+	"@yearly": true, "@annually": true, "@monthly": true,
+	"@weekly": true, "@daily": true, "@midnight": true, "@hourly": true,
+}
+
+// cronFields lists the five cron fields with their allowed ranges.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// validateCron checks a five-field cron expression (minute hour dom month
+// dow) or a descriptor such as @daily. The runtime scheduler parses the same
+// syntax: *, numbers, ranges (1-5), lists (1,3) and steps (*/15, 0-30/5).
+func validateCron(spec string) error {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@") {
+		if !cronDescriptors[spec] {
+			return fmt.Errorf("unknown descriptor %s", spec)
+		}
+		return nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return fmt.Errorf("expected 5 fields (minute hour day-of-month month day-of-week), got %d", len(fields))
+	}
+
+	for i, field := range fields {
+		f := cronFields[i]
+		for _, part := range strings.Split(field, ",") {
+			if err := validateCronPart(part, f.min, f.max); err != nil {
+				return fmt.Errorf("%s field %q: %v", f.name, field, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateCronPart(part string, min, max int) error {
+	rng, step, hasStep := strings.Cut(part, "/")
+	if hasStep {
+		n, err := strconv.Atoi(step)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid step %q", step)
+		}
+	}
+	if rng == "*" {
+		return nil
+	}
+
+	lo, hi, isRange := strings.Cut(rng, "-")
+	for _, v := range []string{lo, hi} {
+		if v == "" && !isRange {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid value %q", v)
+		}
+		if n < min || n > max {
+			return fmt.Errorf("value %d out of range %d-%d", n, min, max)
+		}
+	}
+	if isRange {
+		a, _ := strconv.Atoi(lo)
+		b, _ := strconv.Atoi(hi)
+		if a > b {
+			return fmt.Errorf("range %s is reversed", rng)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/forge-lang/forge/compiler/internal/ast"
+	"github.com/forge-lang/forge/compiler/internal/diag"
+)
+
+// migrationVersion matches the version part of a migration target.
+var migrationVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// validateMigration checks a migrate declaration against the entity it
+// targets. The to field must be declared with the migration's new type, and
+// the from field must no longer be declared unless it is migrated in place,
+// since the migration drops it. A migration whose to field a later version
+// migrates again is history and only checked against its own types. Every
+// mapped value must belong to its type.
+func (a *Analyzer) validateMigration(mig *ast.MigrateDecl) {
+	rng := diag.Range{Start: mig.Pos(), End: mig.End()}
+	name := mig.Target.String()
+
+	if len(mig.Target.Parts) != 2 || !migrationVersion.MatchString(mig.Target.Parts[1].Name) {
+		a.diag.AddError(rng, diag.ErrInvalidMigration,
+			fmt.Sprintf("migration target %s must be Entity.vN", name))
+		return
+	}
+	entityName := mig.Target.Parts[0].Name
+	entity, exists := a.scope.Entities[entityName]
+	if !exists {
+		a.diag.AddError(rng, diag.ErrUndefinedEntity,
+			fmt.Sprintf("undefined entity %s in migration %s", entityName, name))
+		return
+	}
+
+	if mig.FromField == nil || mig.From == nil || mig.ToField == nil || mig.To == nil {
+		a.diag.AddError(rng, diag.ErrInvalidMigration,
+			fmt.Sprintf("migration %s must name the old and new field with their types, e.g. from: plan enum(free, pro)", name))
+		return
+	}
+
+	toValues := identNames(mig.To.EnumValues)
+	if !a.migrationSuperseded(mig) {
+		to, exists := entity.Fields[mig.ToField.Name]
+		if !exists {
+			a.diag.AddError(diag.Range{Start: mig.ToField.Pos(), End: mig.ToField.End()}, diag.ErrUndefinedField,
+				fmt.Sprintf("undefined field %s in %s (context: migration %s)", mig.ToField.Name, entityName, name))
+			return
+		}
+		if to.Name != mig.To.Name.Name || !slices.Equal(to.EnumValues, toValues) {
+			a.diag.AddError(diag.Range{Start: mig.To.Pos(), End: mig.To.End()}, diag.ErrTypeMismatch,
+				fmt.Sprintf("migration %s: type of %s.%s does not match the declared field", name, entityName, mig.ToField.Name))
+		}
+		if mig.FromField.Name != mig.ToField.Name {
+			if _, exists := entity.Fields[mig.FromField.Name]; exists {
+				a.diag.AddError(diag.Range{Start: mig.FromField.Pos(), End: mig.FromField.End()}, diag.ErrInvalidMigration,
+					fmt.Sprintf("migration %s drops %s.%s, so the field must be removed from the entity", name, entityName, mig.FromField.Name))
+			}
+		}
+	}
+
+	fromValues := identNames(mig.From.EnumValues)
+	mapped := make(map[string]bool)
+	for _, m := range mig.Mappings {
+		from, _ := m.From.(*ast.Ident)
+		target, _ := m.To.(*ast.Ident)
+		if from == nil || target == nil {
+			continue
+		}
+		mrng := diag.Range{Start: m.Pos(), End: m.End()}
+		switch {
+		case mapped[from.Name]:
+			a.diag.AddError(mrng, diag.ErrInvalidMigrationMap,
+				fmt.Sprintf("migration %s maps %s more than once", name, from.Name))
+		case len(fromValues) > 0 && !slices.Contains(fromValues, from.Name):
+			a.diag.AddError(mrng, diag.ErrInvalidMigrationMap,
+				fmt.Sprintf("migration %s maps %s, which is not a value of %s", name, from.Name, mig.FromField.Name))
+		case len(toValues) > 0 && !slices.Contains(toValues, target.Name):
+			a.diag.AddError(mrng, diag.ErrInvalidMigrationMap,
+				fmt.Sprintf("migration %s maps to %s, which is not a value of %s", name, target.Name, mig.ToField.Name))
+		}
+		mapped[from.Name] = true
+	}
+
+	// Values present in both types are kept as they are
+	for _, v := range fromValues {
+		if slices.Contains(toValues, v) {
+			mapped[v] = true
+		}
+	}
+	if len(mapped) == 0 {
+		a.diag.AddError(rng, diag.ErrInvalidMigrationMap,
+			fmt.Sprintf("migration %s maps no values", name))
+	}
+}
+
+// migrationSuperseded reports whether a later version of mig's entity
+// migrates the field mig migrates to.
+func (a *Analyzer) migrationSuperseded(mig *ast.MigrateDecl) bool {
+	version := migrationNumber(mig)
+	for _, other := range a.scope.Migrations {
+		if other.Target.Parts[0].Name == mig.Target.Parts[0].Name && other.FromField != nil &&
+			other.FromField.Name == mig.ToField.Name && migrationNumber(other) > version {
+			return true
+		}
+	}
+	return false
+}
+
+// migrationNumber returns N of a migration targeting Entity.vN, or -1.
+func migrationNumber(mig *ast.MigrateDecl) int {
+	if len(mig.Target.Parts) != 2 || !migrationVersion.MatchString(mig.Target.Parts[1].Name) {
+		return -1
+	}
+	n, _ := strconv.Atoi(mig.Target.Parts[1].Name[1:])
+	return n
+}
+
+// identNames returns the names of idents.
+func identNames(idents []*ast.Ident) []string {
+	var names []string
+	for _, id := range idents {
+		names = append(names, id.Name)
+	}
+	return names
+}
@@ -0,0 +1,170 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/forge-lang/forge/compiler/internal/ast"
+	"github.com/forge-lang/forge/compiler/internal/diag"
+	"github.com/forge-lang/forge/compiler/naming"
+)
+
+// Presence represents an analyzed presence declaration. Each record of the
+// source entity holds one entry per scope record it belongs to. The scope is
+// linked to the source by a relation, either from the source (ScopeVia
+// "source", as with relation User.workspace -> Workspace) or from the scope
+// entity (ScopeVia "scope", as with relation Workspace.members -> User many).
+type Presence struct {
+	Name          string
+	Source        string // entity holding the presence, e.g. "User"
+	SourceField   string // name entries refer to the source by, e.g. "user"
+	Scope         string // name entries refer to the scope by, e.g. "workspace"
+	ScopeEntity   string
+	ScopeRelation string // the relation linking source and scope
+	ScopeVia      string // "source" or "scope": the entity declaring ScopeRelation
+	Fields        map[string]*FieldType
+	Decl          *ast.PresenceDecl
+}
+
+// collectPresence adds a presence declaration to the scope. Its scope is
+// resolved by validatePresence once every relation is known.
+func (a *Analyzer) collectPresence(decl *ast.PresenceDecl) {
+	name := decl.Name.Name
+	_, isPresence := a.scope.Presences[name]
+	_, isEntity := a.scope.Entities[name]
+	if isPresence || isEntity {
+		a.diag.AddError(
+			diag.Range{Start: decl.Pos(), End: decl.End()},
+			diag.ErrDuplicatePresence,
+			fmt.Sprintf("duplicate presence: %s", name),
+		)
+		return
+	}
+
+	p := &Presence{
+		Name:   name,
+		Fields: make(map[string]*FieldType),
+		Decl:   decl,
+	}
+	for _, field := range decl.Fields {
+		if _, exists := p.Fields[field.Name.Name]; exists {
+			a.diag.AddError(
+				diag.Range{Start: field.Pos(), End: field.End()},
+				diag.ErrDuplicateField,
+				fmt.Sprintf("duplicate field %s in presence %s", field.Name.Name, name),
+			)
+			continue
+		}
+		ft := &FieldType{Name: field.Type.Name.Name}
+		if ft.Name == "enum" {
+			ft.IsEnum = true
+			ft.EnumValues = identNames(field.Type.EnumValues)
+		}
+		p.Fields[field.Name.Name] = ft
+	}
+	a.scope.Presences[name] = p
+}
+
+// validatePresence checks a presence's source and TTL and resolves its
+// scope to the relation linking the two.
+func (a *Analyzer) validatePresence(p *Presence) {
+	decl := p.Decl
+	rng := diag.Range{Start: decl.Pos(), End: decl.End()}
+
+	if decl.Source == nil {
+		a.diag.AddError(rng, diag.ErrInvalidPresence,
+			fmt.Sprintf("presence %s is missing required source", p.Name))
+		return
+	}
+	if _, exists := a.scope.Entities[decl.Source.Name]; !exists {
+		a.reportUndefined(decl.Source, diag.ErrUndefinedEntity,
+			fmt.Sprintf("undefined source entity %s in presence %s", decl.Source.Name, p.Name),
+			names(a.scope.Entities))
+		return
+	}
+	p.Source = decl.Source.Name
+	p.SourceField = naming.Snake(p.Source)
+
+	if decl.TTL != nil && decl.TTL.Value <= 0 {
+		a.diag.AddError(diag.Range{Start: decl.TTL.Pos(), End: decl.TTL.End()}, diag.ErrInvalidPresence,
+			fmt.Sprintf("ttl of presence %s must be positive, got %s", p.Name, decl.TTL.Literal))
+	}
+
+	if decl.Scope == nil {
+		a.diag.AddError(rng, diag.ErrInvalidPresence,
+			fmt.Sprintf("presence %s is missing required scope", p.Name))
+		return
+	}
+	p.Scope = decl.Scope.Name
+	if !a.resolvePresenceScope(p) {
+		return
+	}
+
+	for _, name := range []string{"id", "updated_at", p.SourceField, p.Scope} {
+		if _, exists := p.Fields[name]; exists {
+			a.diag.AddError(rng, diag.ErrInvalidPresence,
+				fmt.Sprintf("field %s of presence %s is reserved for the entry itself", name, p.Name))
+		}
+	}
+}
+
+// resolvePresenceScope finds the relation between the source and the scope
+// of p: a relation of the source named after the scope, otherwise the
+// relations to the source of the entity named after the scope, preferring
+// many relations. It reports and returns false when there is none or more
+// than one.
+func (a *Analyzer) resolvePresenceScope(p *Presence) bool {
+	ident := p.Decl.Scope
+	if rel, ok := a.scope.Relations[p.Source+"."+p.Scope]; ok {
+		if rel.IsMany {
+			a.diag.AddError(diag.Range{Start: ident.Pos(), End: ident.End()}, diag.ErrInvalidPresence,
+				fmt.Sprintf("scope %s of presence %s is a many relation of %s; declare the relation on the scope entity", p.Scope, p.Name, p.Source))
+			return false
+		}
+		p.ScopeEntity = rel.ToEntity
+		p.ScopeRelation = rel.FromField
+		p.ScopeVia = "source"
+		return true
+	}
+
+	var entity string
+	for name := range a.scope.Entities {
+		if naming.Snake(name) == p.Scope {
+			entity = name
+		}
+	}
+	var single, many []string
+	for _, rel := range a.scope.Relations {
+		if entity == "" || rel.FromEntity != entity || rel.ToEntity != p.Source {
+			continue
+		}
+		if rel.IsMany {
+			many = append(many, rel.FromField)
+		} else {
+			single = append(single, rel.FromField)
+		}
+	}
+	candidates := many
+	if len(candidates) == 0 {
+		candidates = single
+	}
+	sort.Strings(candidates)
+
+	switch len(candidates) {
+	case 0:
+		a.reportUndefined(ident, diag.ErrUndefinedRelation,
+			fmt.Sprintf("presence %s: no relation links %s to scope %s", p.Name, p.Source, p.Scope),
+			a.scope.memberNames(a.scope.Entities[p.Source]))
+		return false
+	case 1:
+		p.ScopeEntity = entity
+		p.ScopeRelation = candidates[0]
+		p.ScopeVia = "scope"
+		return true
+	default:
+		a.diag.AddError(diag.Range{Start: ident.Pos(), End: ident.End()}, diag.ErrInvalidPresence,
+			fmt.Sprintf("presence %s: scope %s is ambiguous, %s links it to %s by %s", p.Name, p.Scope, entity, p.Source, strings.Join(candidates, ", ")))
+		return false
+	}
+}
@@ -0,0 +1,89 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/forge-lang/forge/compiler/internal/ast"
+	"github.com/forge-lang/forge/compiler/internal/diag"
+)
+
+// reportUndefined reports an undefined reference to ident. When one of the
+// declared names is a likely misspelling of it, the diagnostic carries a
+// quick fix that replaces the reference.
+func (a *Analyzer) reportUndefined(ident *ast.Ident, code, message string, declared []string) {
+	rng := diag.Range{Start: ident.Pos(), End: ident.End()}
+	d := diag.Diagnostic{
+		Range:    rng,
+		Severity: diag.Error,
+		Code:     code,
+		Message:  message,
+		Source:   "forge-compiler",
+	}
+	if name := closestName(ident.Name, declared); name != "" {
+		a.diag.AddWithFix(d, fmt.Sprintf("Change to %s", name), diag.TextEdit{Range: rng, NewText: name})
+		return
+	}
+	a.diag.Add(d)
+}
+
+// names returns the keys of m.
+func names[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// memberNames returns the fields and relations of entity.
+func (s *Scope) memberNames(entity *Entity) []string {
+	members := names(entity.Fields)
+	for _, rel := range s.Relations {
+		if rel.FromEntity == entity.Name {
+			members = append(members, rel.FromField)
+		}
+	}
+	return members
+}
+
+// closestName returns the candidate nearest to name by edit distance, or ""
+// if none is close enough to be a typo. Ties go to the first name in
+// sorted order.
+func closestName(name string, candidates []string) string {
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted)
+
+	best, bestDist := "", min(2, len(name)/3+1)+1
+	for _, c := range sorted {
+		if c == name {
+			continue
+		}
+		if d := editDistance(strings.ToLower(name), strings.ToLower(c)); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,158 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"github.com/forge-lang/forge/compiler/internal/ast"
+	"github.com/forge-lang/forge/compiler/internal/diag"
+	"github.com/forge-lang/forge/compiler/internal/token"
+)
+
+// testOperations are the operations a test's when clause may perform.
+var testOperations = map[string]bool{
+	"create": true,
+	"update": true,
+	"delete": true,
+	"action": true,
+}
+
+// validateTest checks a test declaration: its when clause must name an
+// operation on a declared entity or a declared action, every given and
+// expect path must resolve to an entity field, and values must be literals.
+func (a *Analyzer) validateTest(test *ast.TestDecl) {
+	name := test.Target.String()
+	rng := diag.Range{Start: test.Pos(), End: test.End()}
+
+	if test.When == nil || test.When.Action == nil || test.When.Target == nil {
+		a.diag.AddError(rng, diag.ErrInvalidTest, fmt.Sprintf("test %s is missing a when clause", name))
+		return
+	}
+	whenRng := diag.Range{Start: test.When.Pos(), End: test.When.End()}
+	op, target := test.When.Action.Name, test.When.Target.Name
+	switch {
+	case !testOperations[op]:
+		a.diag.AddError(whenRng, diag.ErrInvalidTest,
+			fmt.Sprintf("test %s: unknown operation %s (expected create, update, delete or action)", name, op))
+		return
+	case op == "action":
+		if _, exists := a.scope.Actions[target]; !exists {
+			a.diag.AddError(whenRng, diag.ErrUndefinedAction, fmt.Sprintf("undefined action %s in test %s", target, name))
+			return
+		}
+	default:
+		if _, exists := a.scope.Entities[target]; !exists {
+			a.diag.AddError(whenRng, diag.ErrUndefinedEntity, fmt.Sprintf("undefined entity %s in test %s", target, name))
+			return
+		}
+	}
+
+	for _, given := range test.Given {
+		a.validateTestValue(test, given.Path, given.Value, diag.Range{Start: given.Pos(), End: given.End()})
+	}
+
+	if test.Expect == nil {
+		a.diag.AddError(rng, diag.ErrInvalidTest, fmt.Sprintf("test %s is missing an expect clause", name))
+		return
+	}
+	if !test.Expect.Reject {
+		a.validateTestValue(test, test.Expect.Path, test.Expect.Value, diag.Range{Start: test.Expect.Pos(), End: test.Expect.End()})
+	}
+}
+
+// validateTestValue checks that path names a field and value is a literal.
+func (a *Analyzer) validateTestValue(test *ast.TestDecl, path *ast.PathExpr, value ast.Expr, rng diag.Range) {
+	if path == nil {
+		return
+	}
+	entity, field := a.scope.TestField(test, path)
+	if entity == "" {
+		a.diag.AddError(rng, diag.ErrInvalidTest,
+			fmt.Sprintf("cannot resolve %s in test %s; write Entity.field", path.String(), test.Target.String()))
+		return
+	}
+	e, exists := a.scope.Entities[entity]
+	if !exists {
+		a.diag.AddError(rng, diag.ErrUndefinedEntity,
+			fmt.Sprintf("undefined entity %s in test %s", entity, test.Target.String()))
+		return
+	}
+	if _, exists := e.Fields[field]; !exists {
+		a.diag.AddError(rng, diag.ErrUndefinedField,
+			fmt.Sprintf("undefined field %s in %s (context: test %s)", field, entity, test.Target.String()))
+		return
+	}
+	if _, ok := LiteralValue(value); !ok {
+		a.diag.AddError(rng, diag.ErrInvalidTest,
+			fmt.Sprintf("value of %s in test %s must be a literal", path.String(), test.Target.String()))
+	}
+}
+
+// TestSubject returns the entity a test operates on: the target of a create,
+// update or delete, or the input entity of an action. The subject of an
+// action with an input block is the entity of its first record input.
+func (s *Scope) TestSubject(test *ast.TestDecl) string {
+	if test.When == nil || test.When.Action == nil || test.When.Target == nil {
+		return ""
+	}
+	if test.When.Action.Name != "action" {
+		return test.When.Target.Name
+	}
+	action, exists := s.Actions[test.When.Target.Name]
+	if !exists {
+		return ""
+	}
+	for _, prop := range action.Properties {
+		if prop.Key.Name == "input" {
+			if ident, ok := prop.Value.(*ast.Ident); ok {
+				return ident.Name
+			}
+		}
+	}
+	if records := s.actionRecordNames(action); len(records) > 0 {
+		return actionInputField(action, records[0]).Type.Name.Name
+	}
+	return ""
+}
+
+// TestField resolves a given or expect path of test to an entity and field.
+// A bare field belongs to the test's subject entity.
+func (s *Scope) TestField(test *ast.TestDecl, path *ast.PathExpr) (entity, field string) {
+	switch len(path.Parts) {
+	case 1:
+		return s.TestSubject(test), path.Parts[0].Name
+	case 2:
+		return path.Parts[0].Name, path.Parts[1].Name
+	}
+	return "", ""
+}
+
+// LiteralValue returns the Go value of a literal test value: enum values
+// and null as identifiers, strings, numbers (optionally negated) and bools.
+func LiteralValue(expr ast.Expr) (any, bool) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if e.Name == "null" {
+			return nil, true
+		}
+		return e.Name, true
+	case *ast.StringLit:
+		return e.Value, true
+	case *ast.IntLit:
+		return e.Value, true
+	case *ast.FloatLit:
+		return e.Value, true
+	case *ast.BoolLit:
+		return e.Value, true
+	case *ast.UnaryExpr:
+		if e.Op != token.MINUS {
+			return nil, false
+		}
+		switch v := e.Operand.(type) {
+		case *ast.IntLit:
+			return -v.Value, true
+		case *ast.FloatLit:
+			return -v.Value, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,168 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/forge-lang/forge/compiler/internal/ast"
+	"github.com/forge-lang/forge/compiler/internal/diag"
+)
+
+// validateFieldReads checks the read conditions of the fields of entity.
+// A condition decides who may read the field, not which records show it, so
+// it may only depend on the user: ssn: string read: user.role == admin. Which
+// records a user reads is up to the entity's access rules.
+func (a *Analyzer) validateFieldReads(entity *ast.EntityDecl) {
+	e, ok := a.scope.Entities[entity.Name.Name]
+	if !ok || e.Decl != entity {
+		return
+	}
+	for _, field := range entity.Fields {
+		if field.Read == nil {
+			continue
+		}
+		if field.Hidden {
+			a.diag.AddError(diag.Range{Start: field.Pos(), End: field.End()}, diag.ErrInvalidAccessExpr,
+				fmt.Sprintf("field %s in %s is hidden and cannot have a read condition", field.Name.Name, e.Name))
+			continue
+		}
+		a.validateFieldRead(e, field.Name.Name, field.Read)
+	}
+}
+
+// validateFieldRead reports the paths of a read condition that do not start
+// at the user. A bare name that is not a member of entity is an enum value.
+func (a *Analyzer) validateFieldRead(entity *Entity, field string, expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if e.Name != "user" && a.scope.isMember(entity, e.Name) {
+			a.reportFieldRead(entity, field, e, e.Name)
+		}
+
+	case *ast.PathExpr:
+		if e.Parts[0].Name != "user" {
+			a.reportFieldRead(entity, field, e, e.String())
+		}
+
+	case *ast.BinaryExpr:
+		a.validateFieldRead(entity, field, e.Left)
+		a.validateFieldRead(entity, field, e.Right)
+
+	case *ast.UnaryExpr:
+		a.validateFieldRead(entity, field, e.Operand)
+
+	case *ast.InExpr:
+		a.validateFieldRead(entity, field, e.Left)
+		a.validateFieldRead(entity, field, e.Right)
+
+	case *ast.ParenExpr:
+		a.validateFieldRead(entity, field, e.Inner)
+
+	case *ast.CallExpr:
+		for _, arg := range e.Args {
+			a.validateFieldRead(entity, field, arg)
+		}
+	}
+}
+
+func (a *Analyzer) reportFieldRead(entity *Entity, field string, node ast.Node, path string) {
+	a.diag.AddError(diag.Range{Start: node.Pos(), End: node.End()}, diag.ErrInvalidAccessExpr,
+		fmt.Sprintf("read condition of field %s in %s may only refer to the user, not %s", field, entity.Name, path))
+}
+
+// validateViewVisibility reports the hidden fields a view shows, filters or
+// sorts on, and the fields with a read condition it filters or sorts on.
+// Filtering on a field would reveal its values as surely as showing it, to
+// every user of the view.
+func (a *Analyzer) validateViewVisibility(view *ast.ViewDecl) {
+	source := view.Source.Name
+	for _, field := range view.Fields {
+		a.checkViewField(view, source, field.Name, field, false)
+	}
+	for _, sort := range view.Sort {
+		a.checkViewField(view, source, sort.Field.Name, sort.Field, true)
+	}
+	if view.Filter != nil {
+		a.checkViewFilter(view, source, view.Filter)
+	}
+}
+
+func (a *Analyzer) checkViewFilter(view *ast.ViewDecl, source string, expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		a.checkViewField(view, source, e.Name, e, true)
+
+	case *ast.PathExpr:
+		if first := e.Parts[0].Name; first != "user" && first != "param" {
+			a.checkViewField(view, source, e.String(), e, true)
+		}
+
+	case *ast.BinaryExpr:
+		a.checkViewFilter(view, source, e.Left)
+		a.checkViewFilter(view, source, e.Right)
+
+	case *ast.UnaryExpr:
+		a.checkViewFilter(view, source, e.Operand)
+
+	case *ast.InExpr:
+		a.checkViewFilter(view, source, e.Left)
+		a.checkViewFilter(view, source, e.Right)
+
+	case *ast.ParenExpr:
+		a.checkViewFilter(view, source, e.Inner)
+
+	case *ast.CallExpr:
+		for _, arg := range e.Args {
+			a.checkViewFilter(view, source, arg)
+		}
+	}
+}
+
+// checkViewField reports path, a field of source or of a related entity as
+// in author.email, when it is hidden, or when it has a read condition and
+// the view filters or sorts on it.
+func (a *Analyzer) checkViewField(view *ast.ViewDecl, source, path string, node ast.Node, filtered bool) {
+	entity, field := a.scope.viewFieldOwner(source, path)
+	if entity == nil {
+		return
+	}
+	ft, ok := entity.Fields[field]
+	if !ok {
+		return
+	}
+	switch {
+	case ft.Hidden:
+		a.diag.AddError(diag.Range{Start: node.Pos(), End: node.End()}, diag.ErrFieldVisibility,
+			fmt.Sprintf("view %s cannot use hidden field %s of %s", view.Name.Name, field, entity.Name))
+	case ft.Read != nil && filtered:
+		a.diag.AddError(diag.Range{Start: node.Pos(), End: node.End()}, diag.ErrFieldVisibility,
+			fmt.Sprintf("view %s cannot filter or sort on field %s of %s, which not every user may read", view.Name.Name, field, entity.Name))
+	}
+}
+
+// viewFieldOwner resolves a view field path to the entity declaring the field
+// and the field's name: author.email is the email of the author relation's
+// target. The entity is nil when path does not resolve.
+func (s *Scope) viewFieldOwner(source, path string) (*Entity, string) {
+	parts := strings.Split(path, ".")
+	switch len(parts) {
+	case 1:
+		return s.Entities[source], parts[0]
+	case 2:
+		rel, ok := s.Relations[source+"."+parts[0]]
+		if !ok {
+			return nil, ""
+		}
+		return s.Entities[rel.ToEntity], parts[1]
+	}
+	return nil, ""
+}
+
+// isMember reports whether name is a field or relation of entity.
+func (s *Scope) isMember(entity *Entity, name string) bool {
+	if _, ok := entity.Fields[name]; ok {
+		return true
+	}
+	_, ok := s.Relations[entity.Name+"."+name]
+	return ok
+}
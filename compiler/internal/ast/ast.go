@@ -1,7 +1,11 @@
 // Package ast defines the Abstract Syntax Tree for the FORGE language.
 package ast
 
-import "github.com/forge-lang/forge/compiler/internal/token"
+import (
+	"time"
+
+	"github.com/forge-lang/forge/compiler/internal/token"
+)
 
 // Node is the interface implemented by all AST nodes.
 type Node interface {
@@ -41,6 +45,7 @@ type File struct {
 	Jobs        []*JobDecl
 	Hooks       []*HookDecl
 	Views       []*ViewDecl
+	Presences   []*PresenceDecl
 	Webhooks    []*WebhookDecl
 	Imperatives []*ImperativeDecl
 	Migrations  []*MigrateDecl
@@ -60,6 +65,27 @@ func (f *File) End() token.Position {
 	return token.Position{}
 }
 
+// Merge appends the declarations of other to f, for analyzing the files of
+// a project as one unit. The app declaration is not merged; callers decide
+// how to treat a second one.
+func (f *File) Merge(other *File) {
+	f.Entities = append(f.Entities, other.Entities...)
+	f.Relations = append(f.Relations, other.Relations...)
+	f.Rules = append(f.Rules, other.Rules...)
+	f.Access = append(f.Access, other.Access...)
+	f.Actions = append(f.Actions, other.Actions...)
+	f.Messages = append(f.Messages, other.Messages...)
+	f.Jobs = append(f.Jobs, other.Jobs...)
+	f.Hooks = append(f.Hooks, other.Hooks...)
+	f.Views = append(f.Views, other.Views...)
+	f.Presences = append(f.Presences, other.Presences...)
+	f.Webhooks = append(f.Webhooks, other.Webhooks...)
+	f.Imperatives = append(f.Imperatives, other.Imperatives...)
+	f.Migrations = append(f.Migrations, other.Migrations...)
+	f.Tests = append(f.Tests, other.Tests...)
+	f.Comments = append(f.Comments, other.Comments...)
+}
+
 // Comment represents a comment.
 type Comment struct {
 	Start token.Position
@@ -87,6 +113,7 @@ func (d *AppDecl) End() token.Position { return d.EndPos }
 type EntityDecl struct {
 	Name     *Ident
 	Fields   []*FieldDecl
+	Table    *Ident // from @table: name; nil to derive the table from Name
 	StartPos token.Position
 	EndPos   token.Position
 }
@@ -97,11 +124,15 @@ func (d *EntityDecl) Pos() token.Position { return d.StartPos }
 func (d *EntityDecl) End() token.Position { return d.EndPos }
 
 // FieldDecl represents a field declaration within an entity.
+// A hidden field is written but never read back; a field with a Read
+// condition is only read by users satisfying it.
 type FieldDecl struct {
 	Name        *Ident
 	Type        *TypeExpr
 	Constraints []*Constraint
 	Default     Expr
+	Hidden      bool
+	Read        Expr // nil if the field is readable with its record
 	StartPos    token.Position
 	EndPos      token.Position
 }
@@ -141,6 +172,7 @@ type RelationDecl struct {
 	From     *PathExpr // Entity.field
 	To       *Ident    // Target entity
 	Many     bool      // Whether it's a many relation
+	Column   *Ident    // from @column: name; nil to derive the foreign key from the field
 	StartPos token.Position
 	EndPos   token.Position
 }
@@ -191,10 +223,26 @@ func (d *AccessDecl) decl()              {}
 func (d *AccessDecl) Pos() token.Position { return d.StartPos }
 func (d *AccessDecl) End() token.Position { return d.EndPos }
 
-// ActionDecl represents an action declaration.
+// ActionDecl represents an action declaration. An action either takes an
+// entity (input: Ticket) and performs one operation on it, or declares typed
+// input fields and a body of steps run in order in one transaction.
+//
+// Example:
+//
+//	action close_ticket {
+//	    input {
+//	        ticket: Ticket
+//	        reason: string
+//	    }
+//	    set ticket.status = closed
+//	    create Comment { ticket: input.ticket, body: input.reason }
+//	    emit TICKET_CLOSED
+//	}
 type ActionDecl struct {
 	Name       *Ident
 	Properties []*Property
+	Input      *ActionInput // nil unless the action declares an input block
+	Steps      []*ActionStep
 	StartPos   token.Position
 	EndPos     token.Position
 }
@@ -204,6 +252,40 @@ func (d *ActionDecl) decl()              {}
 func (d *ActionDecl) Pos() token.Position { return d.StartPos }
 func (d *ActionDecl) End() token.Position { return d.EndPos }
 
+// ActionInput represents the input block of an action. A field whose type
+// is an entity holds the id of one of its records.
+type ActionInput struct {
+	Fields   []*FieldDecl
+	StartPos token.Position
+	EndPos   token.Position
+}
+
+func (i *ActionInput) node()              {}
+func (i *ActionInput) Pos() token.Position { return i.StartPos }
+func (i *ActionInput) End() token.Position { return i.EndPos }
+
+// ActionStep represents a statement in an action body.
+//
+//	set record.field = v [if c]   - Path is the input record and its field, Value the expression
+//	create Entity { f: v } [if c] - Target is the entity, Mappings its field values
+//	emit CODE [if c]              - Target is the message code
+//	reject CODE [if c]            - Target is the message code
+type ActionStep struct {
+	Kind      string // "set", "create", "emit", "reject"
+	Target    *Ident
+	Path      *PathExpr       // set only
+	Value     Expr            // set only
+	Mappings  []*FieldMapping // create only
+	Condition Expr            // optional guard
+	StartPos  token.Position
+	EndPos    token.Position
+}
+
+func (s *ActionStep) node()              {}
+func (s *ActionStep) stmt()              {}
+func (s *ActionStep) Pos() token.Position { return s.StartPos }
+func (s *ActionStep) End() token.Position { return s.EndPos }
+
 // MessageDecl represents a message declaration.
 type MessageDecl struct {
 	Code       *Ident
@@ -225,6 +307,10 @@ type JobDecl struct {
 	Needs      *NeedsClause
 	Effect     *PathExpr
 	Creates    *JobCreatesClause
+	Schedule   *StringLit   // cron expression (schedule: "0 7 * * *")
+	Retry      *IntLit      // retries after the first attempt (retry: 5)
+	Backoff    *BackoffSpec // delay between retries
+	Timeout    *DurationLit // per-attempt timeout (timeout: 2m)
 	StartPos   token.Position
 	EndPos     token.Position
 }
@@ -234,6 +320,23 @@ func (d *JobDecl) decl()              {}
 func (d *JobDecl) Pos() token.Position { return d.StartPos }
 func (d *JobDecl) End() token.Position { return d.EndPos }
 
+// BackoffSpec represents a job's retry backoff.
+//
+// Example:
+//
+//	backoff: exponential(2s, max 10m)
+type BackoffSpec struct {
+	Strategy *Ident       // exponential, linear or fixed
+	Base     *DurationLit // delay before the first retry
+	Max      *DurationLit // optional cap on the delay
+	StartPos token.Position
+	EndPos   token.Position
+}
+
+func (b *BackoffSpec) node()              {}
+func (b *BackoffSpec) Pos() token.Position { return b.StartPos }
+func (b *BackoffSpec) End() token.Position { return b.EndPos }
+
 // NeedsClause represents a needs clause in a job.
 type NeedsClause struct {
 	Path      *PathExpr
@@ -292,11 +395,19 @@ func (d *HookDecl) decl()              {}
 func (d *HookDecl) Pos() token.Position { return d.StartPos }
 func (d *HookDecl) End() token.Position { return d.EndPos }
 
-// HookAction represents an action in a hook (enqueue, emit).
+// HookAction represents a statement in a hook body.
+//
+//	enqueue job [in d]  - Target is the job, Delay the optional delay (after hooks)
+//	emit CODE [if c]    - Target is the message code
+//	reject CODE [if c]  - Target is the message code (before hooks)
+//	set f = v [if c]    - Target is the field, Value the expression (before hooks)
 type HookAction struct {
-	Kind     string // "enqueue", "emit"
-	Target   *Ident
-	StartPos token.Position
+	Kind      string // "enqueue", "emit", "reject", "set"
+	Target    *Ident
+	Value     Expr         // set only
+	Delay     *DurationLit // enqueue only
+	Condition Expr         // optional guard
+	StartPos  token.Position
 	EndPos   token.Position
 }
 
@@ -334,6 +445,33 @@ func (f *ViewSortField) node()              {}
 func (f *ViewSortField) Pos() token.Position { return f.StartPos }
 func (f *ViewSortField) End() token.Position { return f.EndPos }
 
+// PresenceDecl represents a presence declaration: short-lived state each
+// source record holds in a scope, reset to the field defaults when it is not
+// refreshed within the TTL.
+//
+// Example:
+//
+//	presence UserPresence {
+//	    source: User
+//	    status: enum(online, away, dnd, offline) = offline
+//	    ttl: 5m
+//	    scope: workspace
+//	}
+type PresenceDecl struct {
+	Name     *Ident
+	Source   *Ident       // entity holding the presence
+	Fields   []*FieldDecl // state fields
+	TTL      *DurationLit // optional; the runtime default applies when nil
+	Scope    *Ident       // relation partitioning the presence
+	StartPos token.Position
+	EndPos   token.Position
+}
+
+func (d *PresenceDecl) node()              {}
+func (d *PresenceDecl) decl()              {}
+func (d *PresenceDecl) Pos() token.Position { return d.StartPos }
+func (d *PresenceDecl) End() token.Position { return d.EndPos }
+
 // WebhookDecl represents a webhook declaration for inbound external events.
 // The provider handles data normalization - no field mappings needed.
 //
@@ -358,11 +496,21 @@ func (d *WebhookDecl) decl()               {}
 func (d *WebhookDecl) Pos() token.Position { return d.StartPos }
 func (d *WebhookDecl) End() token.Position { return d.EndPos }
 
-// ImperativeDecl represents an imperative declaration.
+// ImperativeDecl represents an imperative declaration: a Go function
+// registered with the runtime, callable over HTTP and from jobs.
+//
+// Example:
+//
+//	imperative export_csv {
+//	    input: Ticket
+//	    returns: file
+//	    effects: [email.send]
+//	}
 type ImperativeDecl struct {
 	Name       *Ident
 	Input      *Ident
 	Returns    *Ident
+	Effects    []*Ident // capabilities the function may use (e.g., email.send)
 	StartPos   token.Position
 	EndPos     token.Position
 }
@@ -374,9 +522,11 @@ func (d *ImperativeDecl) End() token.Position { return d.EndPos }
 
 // MigrateDecl represents a migration declaration.
 type MigrateDecl struct {
-	Target   *PathExpr // Entity.version
-	From     *TypeExpr
-	To       *TypeExpr
+	Target    *PathExpr // Entity.version
+	FromField *Ident    // field holding the old values
+	From      *TypeExpr
+	ToField   *Ident // field receiving the new values
+	To        *TypeExpr
 	Mappings []*MapClause
 	StartPos token.Position
 	EndPos   token.Position
@@ -526,6 +676,19 @@ func (e *FloatLit) expr()              {}
 func (e *FloatLit) Pos() token.Position { return e.StartPos }
 func (e *FloatLit) End() token.Position { return e.EndPos }
 
+// DurationLit represents a duration literal such as 24h or 1h30m.
+type DurationLit struct {
+	Value    time.Duration
+	Literal  string
+	StartPos token.Position
+	EndPos   token.Position
+}
+
+func (e *DurationLit) node()              {}
+func (e *DurationLit) expr()              {}
+func (e *DurationLit) Pos() token.Position { return e.StartPos }
+func (e *DurationLit) End() token.Position { return e.EndPos }
+
 // StringLit represents a string literal.
 type StringLit struct {
 	Value    string
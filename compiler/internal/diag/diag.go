@@ -221,6 +221,7 @@ const (
 	ErrExpectedBlock     = "E0206"
 	ErrInvalidDecl       = "E0207"
 	ErrDuplicateField    = "E0208"
+	ErrInvalidAnnotation = "E0209"
 
 	// Semantic errors (E03xx)
 	ErrUndefinedEntity    = "E0301"
@@ -237,6 +238,8 @@ const (
 	ErrTypeMismatch       = "E0312"
 	ErrInvalidPath        = "E0313"
 	ErrCircularDep        = "E0314"
+	ErrDuplicateTable     = "E0315"
+	ErrInvalidColumn      = "E0316"
 
 	// Rule errors (E04xx)
 	ErrInvalidRuleExpr    = "E0401"
@@ -246,11 +249,14 @@ const (
 	// Access errors (E05xx)
 	ErrInvalidAccessExpr  = "E0501"
 	ErrInvalidAccessPath  = "E0502"
+	ErrFieldVisibility    = "E0503"
 
 	// Job errors (E06xx)
 	ErrInvalidCapability  = "E0601"
 	ErrMissingInput       = "E0602"
 	ErrMissingEffect      = "E0603"
+	ErrInvalidSchedule    = "E0604"
+	ErrInvalidRetryPolicy = "E0605"
 
 	// Webhook errors (E07xx)
 	ErrDuplicateWebhook   = "E0701"
@@ -259,6 +265,30 @@ const (
 	ErrMissingTriggers    = "E0704"
 	ErrInvalidWebhookMap  = "E0705"
 
+	// Hook errors (E08xx)
+	ErrInvalidHookAction  = "E0801"
+
+	// Migration errors (E09xx)
+	ErrInvalidMigration    = "E0901"
+	ErrInvalidMigrationMap = "E0902"
+	ErrDuplicateMigration  = "E0903"
+
+	// Test errors (E10xx)
+	ErrInvalidTest = "E1001"
+
+	// Imperative errors (E11xx)
+	ErrDuplicateImperative = "E1101"
+	ErrUndefinedImperative = "E1102"
+	ErrInvalidEffect       = "E1103"
+
+	// Presence errors (E12xx)
+	ErrDuplicatePresence = "E1201"
+	ErrInvalidPresence   = "E1202"
+
+	// Action errors (E13xx)
+	ErrInvalidActionInput = "E1301"
+	ErrInvalidActionStep  = "E1302"
+
 	// Warning codes (W01xx)
 	WarnUnusedEntity     = "W0101"
 	WarnUnusedField      = "W0102"
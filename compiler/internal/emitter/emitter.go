@@ -4,6 +4,7 @@ package emitter
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/forge-lang/forge/compiler/internal/analyzer"
@@ -14,20 +15,22 @@ import (
 
 // Artifact is the compiled runtime artifact.
 type Artifact struct {
-	Version     string                      `json:"version"`
-	AppName     string                      `json:"app_name"`
-	Auth        string                      `json:"auth"`
-	Database    string                      `json:"database"`
-	Entities    map[string]*EntitySchema    `json:"entities"`
-	Actions     map[string]*ActionSchema    `json:"actions"`
-	Rules       []*RuleSchema               `json:"rules"`
-	Access      map[string]*AccessSchema    `json:"access"`
-	Views       map[string]*ViewSchema      `json:"views"`
-	Jobs        map[string]*JobSchema       `json:"jobs"`
-	Hooks       []*HookSchema               `json:"hooks"`
-	Webhooks    map[string]*WebhookSchema   `json:"webhooks"`
-	Messages    map[string]*MessageSchema   `json:"messages"`
-	Migration   *MigrationSchema            `json:"migration"`
+	Version     string                       `json:"version"`
+	AppName     string                       `json:"app_name"`
+	Auth        string                       `json:"auth"`
+	Database    string                       `json:"database"`
+	Entities    map[string]*EntitySchema     `json:"entities"`
+	Actions     map[string]*ActionSchema     `json:"actions"`
+	Rules       []*RuleSchema                `json:"rules"`
+	Access      map[string]*AccessSchema     `json:"access"`
+	Views       map[string]*ViewSchema       `json:"views"`
+	Presences   map[string]*PresenceSchema   `json:"presences,omitempty"`
+	Jobs        map[string]*JobSchema        `json:"jobs"`
+	Hooks       []*HookSchema                `json:"hooks"`
+	Webhooks    map[string]*WebhookSchema    `json:"webhooks"`
+	Imperatives map[string]*ImperativeSchema `json:"imperatives"`
+	Messages    map[string]*MessageSchema    `json:"messages"`
+	Migration   *MigrationSchema             `json:"migration"`
 }
 
 // EntitySchema represents an entity in the artifact.
@@ -48,6 +51,8 @@ type FieldSchema struct {
 	Default    interface{} `json:"default,omitempty"`
 	EnumValues []string    `json:"enum_values,omitempty"`
 	MaxLength  int         `json:"max_length,omitempty"`
+	Hidden     bool        `json:"hidden,omitempty"` // never read through the API
+	Read       string      `json:"read,omitempty"`   // CEL condition on the user reading the field
 }
 
 // RelSchema represents a relation in the artifact.
@@ -58,16 +63,42 @@ type RelSchema struct {
 	ForeignKey string `json:"foreign_key"`
 	IsMany     bool   `json:"is_many"`
 	OnDelete   string `json:"on_delete"`
+	JoinTable  string `json:"join_table,omitempty"` // many relations only
+	JoinKey    string `json:"join_key,omitempty"`
+	TargetKey  string `json:"target_key,omitempty"`
 }
 
 // ActionSchema represents an action in the artifact.
 type ActionSchema struct {
-	Name         string   `json:"name"`
-	InputEntity  string   `json:"input_entity"`
-	Operation    string   `json:"operation,omitempty"`    // "create", "update", "delete"
-	TargetEntity string   `json:"target_entity,omitempty"` // entity being created/updated/deleted
-	Rules        []string `json:"rules"`
-	Hooks        []string `json:"hooks"`
+	Name         string               `json:"name"`
+	InputEntity  string               `json:"input_entity"`
+	Operation    string               `json:"operation,omitempty"`     // "create", "update", "delete"
+	TargetEntity string               `json:"target_entity,omitempty"` // entity being created/updated/deleted
+	Rules        []string             `json:"rules"`
+	Hooks        []string             `json:"hooks"`
+	Input        []*ActionInputSchema `json:"input,omitempty"`
+	Steps        []*ActionStepSchema  `json:"steps,omitempty"`
+}
+
+// ActionInputSchema represents a field of an action's input block. A field
+// referring to a record holds its id and names its entity.
+type ActionInputSchema struct {
+	FieldSchema
+	Entity    string `json:"entity,omitempty"`
+	MinLength int    `json:"min_length,omitempty"`
+}
+
+// ActionStepSchema represents a set, create, emit or reject statement in an
+// action.
+type ActionStepSchema struct {
+	Kind      string            `json:"kind"`
+	Entity    string            `json:"entity,omitempty"`
+	Record    string            `json:"record,omitempty"`
+	Field     string            `json:"field,omitempty"`
+	Value     string            `json:"value,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Message   string            `json:"message,omitempty"`
+	Condition string            `json:"condition,omitempty"`
 }
 
 // RuleSchema represents a rule in the artifact.
@@ -100,8 +131,26 @@ type ViewSchema struct {
 	Joins        []ViewJoin  `json:"joins,omitempty"`
 	Filter       string      `json:"filter,omitempty"`
 	Params       []string    `json:"params,omitempty"`
+	ParamColumns []string    `json:"param_columns,omitempty"`
 	DefaultSort  []ViewSort  `json:"default_sort,omitempty"`
 	Dependencies []string    `json:"dependencies"`
+	Presence     bool        `json:"presence,omitempty"`  // reads the presence store instead of SQL
+	Condition    string      `json:"condition,omitempty"` // CEL filter of a presence view
+}
+
+// PresenceSchema represents a presence in the artifact. Entries refer to
+// their source and scope by SourceField and Scope; ScopeVia names the entity
+// declaring ScopeRelation, "source" or "scope".
+type PresenceSchema struct {
+	Name          string                  `json:"name"`
+	Source        string                  `json:"source"`
+	SourceField   string                  `json:"source_field"`
+	Scope         string                  `json:"scope"`
+	ScopeEntity   string                  `json:"scope_entity"`
+	ScopeRelation string                  `json:"scope_relation"`
+	ScopeVia      string                  `json:"scope_via"`
+	TTLMs         int64                   `json:"ttl_ms,omitempty"`
+	Fields        map[string]*FieldSchema `json:"fields"`
 }
 
 // ViewField represents a resolved field in a view.
@@ -112,6 +161,7 @@ type ViewField struct {
 	Type       string `json:"type"`
 	Filterable bool   `json:"filterable"`
 	Sortable   bool   `json:"sortable"`
+	Read       string `json:"read,omitempty"`
 }
 
 // ViewJoin represents a JOIN required by a view.
@@ -135,16 +185,44 @@ type JobSchema struct {
 	NeedsPath     string            `json:"needs_path,omitempty"`
 	NeedsFilter   string            `json:"needs_filter,omitempty"`
 	Capabilities  []string          `json:"capabilities"`
+	Imperative    string            `json:"imperative,omitempty"`
 	TargetEntity  string            `json:"target_entity,omitempty"`
 	FieldMappings map[string]string `json:"field_mappings,omitempty"`
+	Schedule      string            `json:"schedule,omitempty"`
+	MaxAttempts   int               `json:"max_attempts,omitempty"`
+	Backoff       *BackoffSchema    `json:"backoff,omitempty"`
+	TimeoutMs     int64             `json:"timeout_ms,omitempty"`
+}
+
+// BackoffSchema is a job's retry backoff.
+type BackoffSchema struct {
+	Strategy string `json:"strategy"` // "exponential", "linear" or "fixed"
+	BaseMs   int64  `json:"base_ms"`
+	MaxMs    int64  `json:"max_ms,omitempty"`
 }
 
 // HookSchema represents a hook in the artifact.
 type HookSchema struct {
 	Entity    string   `json:"entity"`
 	Timing    string   `json:"timing"`
-	Operation string   `json:"operation"`
-	Jobs      []string `json:"jobs"`
+	Operation string            `json:"operation"`
+	Jobs      []string            `json:"jobs"`
+	Delayed   []*DelayedJobSchema `json:"delayed,omitempty"`
+	Steps     []*HookStepSchema   `json:"steps,omitempty"`
+}
+
+// DelayedJobSchema represents "enqueue job in duration" in a hook.
+type DelayedJobSchema struct {
+	Job     string `json:"job"`
+	DelayMs int64  `json:"delay_ms"`
+}
+
+// HookStepSchema represents an emit, reject or set statement in a hook.
+type HookStepSchema struct {
+	Kind      string `json:"kind"`
+	Target    string `json:"target"`
+	Value     string `json:"value,omitempty"`
+	Condition string `json:"condition,omitempty"`
 }
 
 // MessageSchema represents a message in the artifact.
@@ -164,8 +242,30 @@ type WebhookSchema struct {
 	Action   string   `json:"action"`
 }
 
-// MigrationSchema represents the migration plan in the artifact.
+// ImperativeSchema represents an imperative function in the artifact. The
+// runtime refuses to start unless a Go implementation is registered for it.
+type ImperativeSchema struct {
+	Name        string   `json:"name"`
+	Route       string   `json:"route"`
+	InputEntity string   `json:"input_entity,omitempty"`
+	Returns     string   `json:"returns,omitempty"`
+	Effects     []string `json:"effects,omitempty"`
+}
+
+// MigrationSchema represents the migration plan in the artifact. Up and Down
+// hold the full schema; Steps hold the ordered migrations that reach it from
+// an empty database, one per build that changed the schema.
 type MigrationSchema struct {
+	Version string           `json:"version"`
+	Up      []string         `json:"up"`
+	Down    []string         `json:"down"`
+	Steps   []*MigrationStep `json:"steps,omitempty"`
+	Schema  *planner.Schema  `json:"schema,omitempty"`
+}
+
+// MigrationStep is one versioned migration, recorded in _forge_migrations
+// once applied.
+type MigrationStep struct {
 	Version string   `json:"version"`
 	Up      []string `json:"up"`
 	Down    []string `json:"down"`
@@ -185,6 +285,7 @@ type Emitter struct {
 	scope      *analyzer.Scope
 	normalized *normalizer.Output
 	plan       *planner.Plan
+	previous   *MigrationSchema
 	diag       *diag.Diagnostics
 }
 
@@ -198,6 +299,12 @@ func New(scope *analyzer.Scope, normalized *normalizer.Output, plan *planner.Pla
 	}
 }
 
+// SetPrevious sets the migration of the previous build. Its steps are
+// carried over and the plan's schema changes appended as the next step.
+func (e *Emitter) SetPrevious(migration *MigrationSchema) {
+	e.previous = migration
+}
+
 // Emit generates all outputs.
 func (e *Emitter) Emit() (*Output, *diag.Diagnostics) {
 	out := &Output{}
@@ -227,24 +334,26 @@ func (e *Emitter) Emit() (*Output, *diag.Diagnostics) {
 
 func (e *Emitter) generateArtifact() *Artifact {
 	artifact := &Artifact{
-		Version:  "1.0.0",
-		AppName:  e.normalized.AppName,
-		Auth:     e.normalized.Auth,
-		Database: e.normalized.Database,
-		Entities: make(map[string]*EntitySchema),
-		Actions:  make(map[string]*ActionSchema),
-		Access:   make(map[string]*AccessSchema),
-		Views:    make(map[string]*ViewSchema),
-		Jobs:     make(map[string]*JobSchema),
-		Webhooks: make(map[string]*WebhookSchema),
-		Messages: make(map[string]*MessageSchema),
+		Version:     "1.0.0",
+		AppName:     e.normalized.AppName,
+		Auth:        e.normalized.Auth,
+		Database:    e.normalized.Database,
+		Entities:    make(map[string]*EntitySchema),
+		Actions:     make(map[string]*ActionSchema),
+		Access:      make(map[string]*AccessSchema),
+		Views:       make(map[string]*ViewSchema),
+		Presences:   make(map[string]*PresenceSchema),
+		Jobs:        make(map[string]*JobSchema),
+		Webhooks:    make(map[string]*WebhookSchema),
+		Imperatives: make(map[string]*ImperativeSchema),
+		Messages:    make(map[string]*MessageSchema),
 	}
 
 	// Generate entity schemas
 	for _, entity := range e.normalized.Entities {
 		es := &EntitySchema{
 			Name:      entity.Name,
-			Table:     e.tableName(entity.Name),
+			Table:     e.scope.TableName(entity.Name),
 			Fields:    make(map[string]*FieldSchema),
 			Relations: make(map[string]*RelSchema),
 		}
@@ -259,18 +368,25 @@ func (e *Emitter) generateArtifact() *Artifact {
 				Default:    field.Default,
 				EnumValues: field.EnumValues,
 				MaxLength:  field.MaxLength,
+				Hidden:     field.Hidden,
+				Read:       field.Read,
 			}
 		}
 
 		for _, rel := range entity.Relations {
-			es.Relations[rel.Name] = &RelSchema{
+			rs := &RelSchema{
 				Name:        rel.Name,
 				Target:      rel.Target,
-				TargetTable: e.tableName(rel.Target),
-				ForeignKey:  fmt.Sprintf("%s_id", rel.Name),
+				TargetTable: e.scope.TableName(rel.Target),
 				IsMany:      rel.IsMany,
 				OnDelete:    rel.OnDelete,
 			}
+			if rel.IsMany {
+				rs.JoinTable, rs.JoinKey, rs.TargetKey = rel.JoinTable, rel.JoinKey, rel.TargetKey
+			} else {
+				rs.ForeignKey = rel.Column
+			}
+			es.Relations[rel.Name] = rs
 		}
 
 		artifact.Entities[entity.Name] = es
@@ -289,6 +405,34 @@ func (e *Emitter) generateArtifact() *Artifact {
 			as.Rules = append(as.Rules, rule.Entity+"_"+rule.Operation)
 		}
 
+		for _, input := range action.Input {
+			field := input.Field
+			as.Input = append(as.Input, &ActionInputSchema{
+				FieldSchema: FieldSchema{
+					Name:       field.Name,
+					Type:       e.forgeType(field.Type),
+					SQLType:    field.Type,
+					Default:    field.Default,
+					EnumValues: field.EnumValues,
+					MaxLength:  field.MaxLength,
+				},
+				Entity:    input.Entity,
+				MinLength: field.MinLength,
+			})
+		}
+		for _, step := range action.Steps {
+			as.Steps = append(as.Steps, &ActionStepSchema{
+				Kind:      step.Kind,
+				Entity:    step.Entity,
+				Record:    step.Record,
+				Field:     step.Field,
+				Value:     step.Value,
+				Fields:    step.Fields,
+				Message:   step.Message,
+				Condition: step.Condition,
+			})
+		}
+
 		artifact.Actions[name] = as
 	}
 
@@ -311,7 +455,7 @@ func (e *Emitter) generateArtifact() *Artifact {
 	for entity, access := range e.plan.Access {
 		artifact.Access[entity] = &AccessSchema{
 			Entity:   entity,
-			Table:    e.tableName(entity),
+			Table:    e.scope.TableName(entity),
 			ReadSQL:  access.ReadSQL,
 			WriteSQL: access.WriteSQL,
 			ReadCEL:  access.ReadCEL,
@@ -327,7 +471,10 @@ func (e *Emitter) generateArtifact() *Artifact {
 			SourceTable:  view.SourceTable,
 			Filter:       view.Filter,
 			Params:       view.Params,
+			ParamColumns: view.ParamColumns,
 			Dependencies: view.Dependencies,
+			Presence:     view.Presence,
+			Condition:    view.Condition,
 		}
 
 		// Convert resolved fields
@@ -339,6 +486,7 @@ func (e *Emitter) generateArtifact() *Artifact {
 				Type:       f.Type,
 				Filterable: f.Filterable,
 				Sortable:   f.Sortable,
+				Read:       f.Read,
 			})
 		}
 
@@ -363,6 +511,32 @@ func (e *Emitter) generateArtifact() *Artifact {
 		artifact.Views[name] = vs
 	}
 
+	// Generate presence schemas
+	for _, presence := range e.normalized.Presences {
+		ps := &PresenceSchema{
+			Name:          presence.Name,
+			Source:        presence.Source,
+			SourceField:   presence.SourceField,
+			Scope:         presence.Scope,
+			ScopeEntity:   presence.ScopeEntity,
+			ScopeRelation: presence.ScopeRelation,
+			ScopeVia:      presence.ScopeVia,
+			TTLMs:         presence.TTL.Milliseconds(),
+			Fields:        make(map[string]*FieldSchema),
+		}
+		for _, field := range presence.Fields {
+			ps.Fields[field.Name] = &FieldSchema{
+				Name:       field.Name,
+				Type:       e.forgeType(field.Type),
+				SQLType:    field.Type,
+				Default:    field.Default,
+				EnumValues: field.EnumValues,
+				MaxLength:  field.MaxLength,
+			}
+		}
+		artifact.Presences[presence.Name] = ps
+	}
+
 	// Generate job schemas
 	for _, job := range e.normalized.Jobs {
 		js := &JobSchema{
@@ -371,6 +545,17 @@ func (e *Emitter) generateArtifact() *Artifact {
 			NeedsPath:    job.NeedsPath,
 			NeedsFilter:  job.NeedsFilter,
 			Capabilities: job.Capabilities,
+			Imperative:   job.Imperative,
+			Schedule:     job.Schedule,
+			MaxAttempts:  job.MaxAttempts,
+			TimeoutMs:    job.Timeout.Milliseconds(),
+		}
+		if job.Backoff != nil {
+			js.Backoff = &BackoffSchema{
+				Strategy: job.Backoff.Strategy,
+				BaseMs:   job.Backoff.Base.Milliseconds(),
+				MaxMs:    job.Backoff.Max.Milliseconds(),
+			}
 		}
 		if job.TargetEntity != "" {
 			js.TargetEntity = job.TargetEntity
@@ -381,12 +566,27 @@ func (e *Emitter) generateArtifact() *Artifact {
 
 	// Generate hook schemas
 	for _, hook := range e.plan.Hooks {
-		artifact.Hooks = append(artifact.Hooks, &HookSchema{
+		hs := &HookSchema{
 			Entity:    hook.Entity,
 			Timing:    hook.Timing,
 			Operation: hook.Operation,
 			Jobs:      hook.Jobs,
-		})
+		}
+		for _, d := range hook.Delayed {
+			hs.Delayed = append(hs.Delayed, &DelayedJobSchema{
+				Job:     d.Job,
+				DelayMs: d.Delay.Milliseconds(),
+			})
+		}
+		for _, step := range hook.Steps {
+			hs.Steps = append(hs.Steps, &HookStepSchema{
+				Kind:      step.Kind,
+				Target:    step.Target,
+				Value:     step.Value,
+				Condition: step.Condition,
+			})
+		}
+		artifact.Hooks = append(artifact.Hooks, hs)
 	}
 
 	// Generate message schemas
@@ -419,6 +619,24 @@ func (e *Emitter) generateArtifact() *Artifact {
 		artifact.Webhooks[name] = ws
 	}
 
+	// Generate imperative schemas
+	for name, imp := range e.scope.Imperatives {
+		is := &ImperativeSchema{
+			Name:  name,
+			Route: fmt.Sprintf("/api/imperative/%s", name),
+		}
+		if imp.Input != nil {
+			is.InputEntity = imp.Input.Name
+		}
+		if imp.Returns != nil {
+			is.Returns = imp.Returns.Name
+		}
+		for _, effect := range imp.Effects {
+			is.Effects = append(is.Effects, effect.Name)
+		}
+		artifact.Imperatives[name] = is
+	}
+
 	// Generate migration schema
 	artifact.Migration = e.generateMigrationSchema()
 
@@ -519,6 +737,9 @@ $$ LANGUAGE plpgsql;`)
 
 	m.Up = upStatements
 	m.Down = downStatements
+	m.Schema = e.plan.Migration.Schema
+	m.Steps = e.migrationSteps(m)
+	m.Version = m.Steps[len(m.Steps)-1].Version
 
 	return m
 }
@@ -527,22 +748,7 @@ func (e *Emitter) generateCreateTable(table *planner.CreateTable) string {
 	var columns []string
 
 	for _, col := range table.Columns {
-		colDef := fmt.Sprintf("    %s %s", col.Name, col.Type)
-
-		if !col.Nullable {
-			colDef += " NOT NULL"
-		}
-
-		if col.Default != "" {
-			colDef += fmt.Sprintf(" DEFAULT %s", col.Default)
-		}
-
-		if col.References != nil {
-			colDef += fmt.Sprintf(" REFERENCES %s(%s) ON DELETE %s",
-				col.References.Table, col.References.Column, col.References.OnDelete)
-		}
-
-		columns = append(columns, colDef)
+		columns = append(columns, "    "+e.columnDefinition(col))
 	}
 
 	// Add primary key
@@ -553,6 +759,26 @@ func (e *Emitter) generateCreateTable(table *planner.CreateTable) string {
 		strings.Join(columns, ",\n"))
 }
 
+// columnDefinition renders a column as used in CREATE TABLE and ADD COLUMN.
+func (e *Emitter) columnDefinition(col *planner.Column) string {
+	colDef := fmt.Sprintf("%s %s", col.Name, col.Type)
+
+	if !col.Nullable {
+		colDef += " NOT NULL"
+	}
+
+	if col.Default != "" {
+		colDef += fmt.Sprintf(" DEFAULT %s", col.Default)
+	}
+
+	if col.References != nil {
+		colDef += fmt.Sprintf(" REFERENCES %s(%s) ON DELETE %s",
+			col.References.Table, col.References.Column, col.References.OnDelete)
+	}
+
+	return colDef
+}
+
 func (e *Emitter) generateSchemaSQL() string {
 	if e.plan.Migration == nil {
 		return ""
@@ -573,9 +799,14 @@ func (e *Emitter) generateTypeScriptClient() string {
 	for _, entity := range e.normalized.Entities {
 		b.WriteString(fmt.Sprintf("export interface %s {\n", entity.Name))
 		for _, field := range entity.Fields {
+			// Hidden fields never reach the client, and a field with a read
+			// condition is left out for the users it does not hold for
+			if field.Hidden {
+				continue
+			}
 			tsType := e.toTypeScriptType(field.Type, field.EnumValues)
 			nullable := ""
-			if field.Nullable {
+			if field.Nullable || field.Read != "" {
 				nullable = "?"
 			}
 			b.WriteString(fmt.Sprintf("  %s%s: %s;\n", field.Name, nullable, tsType))
@@ -583,10 +814,10 @@ func (e *Emitter) generateTypeScriptClient() string {
 		for _, rel := range entity.Relations {
 			if rel.IsMany {
 				b.WriteString(fmt.Sprintf("  %s?: %s[];\n", rel.Name, rel.Target))
-			} else {
-				b.WriteString(fmt.Sprintf("  %s?: %s;\n", rel.Name, rel.Target))
+				continue
 			}
-			b.WriteString(fmt.Sprintf("  %s_id: string;\n", rel.Name))
+			b.WriteString(fmt.Sprintf("  %s?: %s;\n", rel.Name, rel.Target))
+			b.WriteString(fmt.Sprintf("  %s: string;\n", rel.Column))
 		}
 		b.WriteString("}\n\n")
 	}
@@ -598,6 +829,16 @@ func (e *Emitter) generateTypeScriptClient() string {
 		if action.InputType != "" {
 			b.WriteString(fmt.Sprintf("  %s: %s | string;\n", e.camelCase(action.InputType), action.InputType))
 		}
+		// A record input takes the record's id; a field with a default may
+		// be left out
+		for _, input := range action.Input {
+			field := input.Field
+			optional := ""
+			if field.Default != nil {
+				optional = "?"
+			}
+			b.WriteString(fmt.Sprintf("  %s%s: %s;\n", field.Name, optional, e.toTypeScriptType(field.Type, field.EnumValues)))
+		}
 		b.WriteString("}\n\n")
 	}
 
@@ -606,20 +847,40 @@ func (e *Emitter) generateTypeScriptClient() string {
 	for _, view := range e.normalized.Views {
 		b.WriteString(fmt.Sprintf("export interface %sItem {\n", view.Name))
 		b.WriteString("  id: string;\n")
+		restricted := make(map[string]bool)
+		if node, ok := e.plan.Views[view.Name]; ok {
+			for _, f := range node.Fields {
+				restricted[f.Name] = f.Read != ""
+			}
+		}
 		for _, field := range view.Fields {
 			if field == "id" {
 				continue
 			}
+			optional := ""
+			if restricted[field] {
+				optional = "?"
+			}
 			// Use bracket notation for dotted fields
 			if strings.Contains(field, ".") {
-				b.WriteString(fmt.Sprintf("  '%s': any;\n", field))
+				b.WriteString(fmt.Sprintf("  '%s'%s: any;\n", field, optional))
 			} else {
-				b.WriteString(fmt.Sprintf("  %s: any;\n", field))
+				b.WriteString(fmt.Sprintf("  %s%s: any;\n", field, optional))
 			}
 		}
 		b.WriteString("}\n\n")
 	}
 
+	// Generate presence state types
+	b.WriteString("// Presence State Types\n")
+	for _, presence := range e.normalized.Presences {
+		b.WriteString(fmt.Sprintf("export interface %sState {\n", presence.Name))
+		for _, field := range presence.Fields {
+			b.WriteString(fmt.Sprintf("  %s?: %s;\n", field.Name, e.toTypeScriptType(field.Type, field.EnumValues)))
+		}
+		b.WriteString("}\n\n")
+	}
+
 	// Generate view params types
 	b.WriteString("// View Params Types\n")
 	for _, view := range e.normalized.Views {
@@ -680,12 +941,41 @@ export interface ForgeResponse<T> {
   data: T;
 }
 
-// Subscription Options
+// Subscription Options: the query of a view subscription, as for the view
+// methods, and the callbacks receiving its page
 export interface SubscriptionOptions<T> {
+  params?: Record<string, string>;
+  filter?: Record<string, unknown>;
+  sort?: string;
+  limit?: number;
   onData: (data: T[]) => void;
   onError?: (error: ForgeError) => void;
 }
 
+// A change to the page of a view subscription. Positions index the page as
+// it is when the change is applied.
+export interface ViewChange<T> {
+  op: 'insert' | 'update' | 'delete';
+  id: string;
+  position: number;
+  data?: T;
+}
+
+// Applies the changes of an update message to a page, in order
+export function applyViewChanges<T>(items: T[], changes: ViewChange<T>[]): T[] {
+  const next = [...items];
+  for (const change of changes) {
+    if (change.op !== 'insert') {
+      const index = next.findIndex((item) => String((item as { id?: unknown }).id) === change.id);
+      if (index >= 0) next.splice(index, 1);
+    }
+    if (change.op !== 'delete' && change.data) {
+      next.splice(change.position, 0, change.data);
+    }
+  }
+  return next;
+}
+
 // Forge Client
 export class ForgeClient {
   private config: ForgeClientConfig;
@@ -737,6 +1027,23 @@ export class ForgeClient {
     return data.data;
   }
 
+  private async requestBlob(path: string, body?: unknown): Promise<Blob> {
+    const response = await fetch(` + "`${this.config.url}${path}`" + `, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+        ...(this.config.token ? { 'Authorization': ` + "`Bearer ${this.config.token}`" + ` } : {}),
+      },
+      body: body ? JSON.stringify(body) : undefined,
+    });
+    if (!response.ok) {
+      const data = await response.json();
+      if (this.config.onError) this.config.onError(data);
+      throw data;
+    }
+    return response.blob();
+  }
+
   // Actions
   actions = {
 `)
@@ -751,6 +1058,31 @@ export class ForgeClient {
 
 	b.WriteString(`  };
 
+  // Imperatives
+  imperatives = {
+`)
+
+	// Generate imperative methods; file and bytes results come back raw
+	impNames := make([]string, 0, len(e.scope.Imperatives))
+	for name := range e.scope.Imperatives {
+		impNames = append(impNames, name)
+	}
+	sort.Strings(impNames)
+	for _, name := range impNames {
+		imp := e.scope.Imperatives[name]
+		inputType := "Record<string, unknown>"
+		if imp.Input != nil {
+			inputType = "Partial<" + imp.Input.Name + ">"
+		}
+		call := fmt.Sprintf("this.request<unknown>('POST', '/imperative/%s', input)", name)
+		if imp.Returns != nil && (imp.Returns.Name == "file" || imp.Returns.Name == "bytes") {
+			call = fmt.Sprintf("this.requestBlob('/imperative/%s', input)", name)
+		}
+		b.WriteString(fmt.Sprintf("    %s: (input: %s) => %s,\n", e.camelCase(name), inputType, call))
+	}
+
+	b.WriteString(`  };
+
   // Views
   views = {
 `)
@@ -765,19 +1097,57 @@ export class ForgeClient {
 
 	b.WriteString(`  };
 
-  // Subscriptions
+  // Presence: sets the caller's state in a scope and refreshes its TTL.
+  // Entries not updated within the TTL return to their defaults.
+  presence = {
+`)
+
+	// Generate presence methods
+	for _, presence := range e.normalized.Presences {
+		b.WriteString(fmt.Sprintf("    %s: (scope: string, state: %sState) => this.sendPresence('%s', scope, state),\n",
+			e.camelCase(presence.Name), presence.Name, presence.Name))
+	}
+
+	b.WriteString(`  };
+
+  // Presence updates go over the socket of the subscriptions, once it is open
+  private sendPresence(presence: string, scope: string, data: unknown): void {
+    const ws = this.ws;
+    if (!ws) {
+      throw new Error('subscribe before updating presence');
+    }
+    const message = JSON.stringify({ type: 'presence', presence, scope, data });
+    if (ws.readyState === WebSocket.CONNECTING) {
+      ws.addEventListener('open', () => ws.send(message), { once: true });
+    } else {
+      ws.send(message);
+    }
+  }
+
+  // Subscriptions: a view sends a snapshot of its first page, then the
+  // changes to it
   subscribe<T>(viewName: string, options: SubscriptionOptions<T>): () => void {
     const wsUrl = this.config.url.replace('http', 'ws') + '/ws';
     this.ws = new WebSocket(wsUrl);
+    let items: T[] = [];
 
     this.ws.onopen = () => {
-      this.ws?.send(JSON.stringify({ type: 'subscribe', view: viewName }));
+      // Authenticate before subscribing so pushes are filtered for this user
+      if (this.config.token) {
+        this.ws?.send(JSON.stringify({ type: 'auth', token: this.config.token }));
+      }
+      const { params, filter, sort, limit } = options;
+      this.ws?.send(JSON.stringify({ type: 'subscribe', view: viewName, params, filter, sort, limit }));
     };
 
     this.ws.onmessage = (event) => {
       const data = JSON.parse(event.data);
-      if (data.type === 'data') {
-        options.onData(data.items);
+      if (data.type === 'snapshot' || (data.type === 'data' && data.items)) {
+        items = data.items;
+        options.onData(items);
+      } else if (data.type === 'update') {
+        items = applyViewChanges(items, data.changes);
+        options.onData(items);
       } else if (data.type === 'error' && options.onError) {
         options.onError(data);
       }
@@ -1095,17 +1465,6 @@ export function useAction<TInput>(actionName: string): UseActionResult<TInput> {
 	return b.String()
 }
 
-func (e *Emitter) tableName(entityName string) string {
-	var result []rune
-	for i, r := range entityName {
-		if i > 0 && r >= 'A' && r <= 'Z' {
-			result = append(result, '_')
-		}
-		result = append(result, r)
-	}
-	return strings.ToLower(string(result)) + "s"
-}
-
 func (e *Emitter) forgeType(sqlType string) string {
 	switch sqlType {
 	case "text":
@@ -0,0 +1,345 @@
+package emitter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/forge-lang/forge/compiler/internal/planner"
+)
+
+// migrationSteps returns the migration history for m. The first build emits
+// the full schema as version 001. Later builds carry over the previous
+// build's steps and append the new ones under the next versions: the renames
+// of legacy tables, the values added to enum types, one per pending data
+// migration, then the incremental schema change. Enum values get a step of
+// their own since PostgreSQL cannot use a value in the transaction that adds
+// it; the runtime commits such a step before applying the next.
+func (e *Emitter) migrationSteps(m *MigrationSchema) []*MigrationStep {
+	if e.previous == nil || len(e.previous.Steps) == 0 {
+		return []*MigrationStep{{Version: "001", Up: m.Up, Down: m.Down}}
+	}
+
+	steps := append([]*MigrationStep(nil), e.previous.Steps...)
+	if e.plan.Changes == nil {
+		return steps
+	}
+
+	last, _ := strconv.Atoi(steps[len(steps)-1].Version)
+	next := func(up, down []string) {
+		last++
+		steps = append(steps, &MigrationStep{Version: fmt.Sprintf("%03d", last), Up: up, Down: down})
+	}
+	if up, down := e.generateRenames(e.plan.Changes); len(up) > 0 {
+		next(up, down)
+	}
+	if up := e.generateEnumAdditions(e.plan.Changes.Up); len(up) > 0 {
+		next(up, nil)
+	}
+	for _, dm := range e.plan.Changes.Data {
+		next(e.generateDataMigration(dm), e.generateDataRollback(dm))
+	}
+	if up := e.generateChangeStatements(e.plan.Changes.Up); len(up) > 0 {
+		next(up, e.generateChangeStatements(e.plan.Changes.Down))
+	}
+	return steps
+}
+
+// UpgradeLegacy fills in the steps and schema of a migration read from an
+// artifact built before migrations were versioned. Its Up was applied as
+// version 001, so it becomes step 001, and the schema it created is rebuilt
+// from its statements for the next build to diff against. Migrations that
+// already have steps are left as they are.
+func (m *MigrationSchema) UpgradeLegacy() {
+	if m == nil || len(m.Steps) > 0 || len(m.Up) == 0 {
+		return
+	}
+	m.Steps = []*MigrationStep{{Version: "001", Up: m.Up, Down: m.Down}}
+	if m.Schema == nil {
+		m.Schema = parseSchema(m.Up)
+	}
+}
+
+var (
+	createTypePattern   = regexp.MustCompile(`^CREATE TYPE (\S+) AS ENUM \((.*)\);$`)
+	createTablePattern  = regexp.MustCompile(`(?s)^CREATE TABLE IF NOT EXISTS (\S+) \(\n(.*)\n\);$`)
+	createIndexPattern  = regexp.MustCompile(`^CREATE (UNIQUE )?INDEX IF NOT EXISTS (\S+) ON (\S+) \((.*)\);$`)
+	createPolicyPattern = regexp.MustCompile(`(?s)^CREATE POLICY (\S+) ON (\S+) FOR (\S+) USING \((.*?)\)(?: WITH CHECK \((.*)\))?;$`)
+	referencesPattern   = regexp.MustCompile(`^(\S+)\((\S+)\) ON DELETE (.+)$`)
+)
+
+// parseSchema rebuilds the schema created by statements in the form
+// generateMigrationSchema renders them. Statements it does not recognize,
+// such as triggers and the helper function, are not part of the schema.
+func parseSchema(stmts []string) *planner.Schema {
+	schema := &planner.Schema{}
+	for _, stmt := range stmts {
+		if m := createTypePattern.FindStringSubmatch(stmt); m != nil {
+			ct := &planner.CreateType{Name: m[1], Kind: "enum"}
+			for _, v := range strings.Split(m[2], ", ") {
+				ct.Values = append(ct.Values, strings.Trim(v, "'"))
+			}
+			schema.Types = append(schema.Types, ct)
+		} else if m := createTablePattern.FindStringSubmatch(stmt); m != nil {
+			table := &planner.CreateTable{Name: m[1]}
+			for _, line := range strings.Split(m[2], ",\n") {
+				line = strings.TrimSpace(line)
+				if pk, ok := strings.CutPrefix(line, "PRIMARY KEY ("); ok {
+					table.PrimaryKey = strings.TrimSuffix(pk, ")")
+					continue
+				}
+				table.Columns = append(table.Columns, parseColumn(line))
+			}
+			schema.Tables = append(schema.Tables, table)
+		} else if m := createIndexPattern.FindStringSubmatch(stmt); m != nil {
+			schema.Indexes = append(schema.Indexes, &planner.CreateIndex{
+				Name:    m[2],
+				Table:   m[3],
+				Columns: strings.Split(m[4], ", "),
+				Unique:  m[1] != "",
+			})
+		} else if m := createPolicyPattern.FindStringSubmatch(stmt); m != nil {
+			schema.Policies = append(schema.Policies, &planner.CreatePolicy{
+				Name:      m[1],
+				Table:     m[2],
+				Command:   m[3],
+				Using:     m[4],
+				WithCheck: m[5],
+			})
+		}
+	}
+	return schema
+}
+
+// parseColumn is the reverse of columnDefinition.
+func parseColumn(def string) *planner.Column {
+	col := &planner.Column{Nullable: true}
+	if rest, ref, ok := strings.Cut(def, " REFERENCES "); ok {
+		def = rest
+		if m := referencesPattern.FindStringSubmatch(ref); m != nil {
+			col.References = &planner.ForeignKey{Table: m[1], Column: m[2], OnDelete: m[3]}
+		}
+	}
+	if rest, value, ok := strings.Cut(def, " DEFAULT "); ok {
+		def = rest
+		col.Default = value
+	}
+	if rest, ok := strings.CutSuffix(def, " NOT NULL"); ok {
+		def = rest
+		col.Nullable = false
+	}
+	col.Name, col.Type, _ = strings.Cut(def, " ")
+	return col
+}
+
+// generateRenames renders the renames of tables and enum types that precede
+// the other schema changes, and their reverse.
+func (e *Emitter) generateRenames(c *planner.SchemaChanges) ([]string, []string) {
+	var up, down []string
+	for _, r := range c.RenameTables {
+		up = append(up, fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", r.From, r.To))
+		down = append(down, fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", r.To, r.From))
+	}
+	for _, r := range c.RenameTypes {
+		up = append(up, fmt.Sprintf("ALTER TYPE %s RENAME TO %s;", r.From, r.To))
+		down = append(down, fmt.Sprintf("ALTER TYPE %s RENAME TO %s;", r.To, r.From))
+	}
+	return up, down
+}
+
+// dataMigrationBatchSize is the number of rows each backfill statement of a
+// data migration updates.
+const dataMigrationBatchSize = 1000
+
+// generateDataMigration renders a data migration. It creates the new column
+// and its type, backfills it through the value map in batches, fails if any
+// old value was left unmapped, then drops the old column and applies the new
+// column's default and NOT NULL constraint. A column migrated in place goes
+// through a temporary column and type that take the old names at the end.
+func (e *Emitter) generateDataMigration(dm *planner.DataMigration) []string {
+	stmts := []string{fmt.Sprintf("-- migrate %s: %s.%s -> %s.%s", dm.Name, dm.Table, dm.From.Name, dm.Table, dm.To.Name)}
+
+	column, columnType := dm.To.Name, dm.To.Type
+	inPlace := dm.From.Name == dm.To.Name
+	if inPlace {
+		column += "_next"
+	}
+	renameType := dm.ToType != nil && dm.FromType != nil && dm.ToType.Name == dm.FromType.Name
+	if renameType {
+		columnType += "_next"
+	}
+	if dm.ToType != nil {
+		stmts = append(stmts, fmt.Sprintf("CREATE TYPE %s AS ENUM (%s);", columnType, e.formatEnumValues(dm.ToType.Values)))
+	}
+	stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s;", dm.Table, column, columnType))
+
+	// Backfill in batches. Unmapped values are skipped so the loop ends;
+	// the check below reports them.
+	var cases, values []string
+	for _, m := range dm.Map {
+		cases = append(cases, fmt.Sprintf("WHEN '%s' THEN '%s'", m.From, m.To))
+		values = append(values, fmt.Sprintf("'%s'", m.From))
+	}
+	stmts = append(stmts, fmt.Sprintf(`DO $$
+DECLARE
+    batch integer;
+BEGIN
+    LOOP
+        UPDATE %[1]s SET %[2]s = (CASE %[3]s::text %[4]s END)::%[5]s
+        WHERE id IN (SELECT id FROM %[1]s WHERE %[2]s IS NULL AND %[3]s::text IN (%[6]s) LIMIT %[7]d);
+        GET DIAGNOSTICS batch = ROW_COUNT;
+        EXIT WHEN batch = 0;
+    END LOOP;
+END;
+$$;`, dm.Table, column, dm.From.Name, strings.Join(cases, " "), columnType, strings.Join(values, ", "), dataMigrationBatchSize))
+
+	stmts = append(stmts, fmt.Sprintf(`DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM %[1]s WHERE %[2]s IS NULL AND %[3]s IS NOT NULL) THEN
+        RAISE EXCEPTION 'migrate %[4]s: %[1]s.%[3]s has values with no mapping';
+    END IF;
+END;
+$$;`, dm.Table, column, dm.From.Name, dm.Name))
+
+	stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS %s;", dm.Table, dm.From.Name))
+	if dm.FromType != nil {
+		stmts = append(stmts, fmt.Sprintf("DROP TYPE IF EXISTS %s;", dm.FromType.Name))
+	}
+	if inPlace {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", dm.Table, column, dm.To.Name))
+	}
+	if renameType {
+		stmts = append(stmts, fmt.Sprintf("ALTER TYPE %s RENAME TO %s;", columnType, dm.ToType.Name))
+	}
+
+	prefix := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s", dm.Table, dm.To.Name)
+	if dm.To.Default != "" {
+		stmts = append(stmts, prefix+fmt.Sprintf(" SET DEFAULT %s;", dm.To.Default))
+		if !dm.To.Nullable {
+			// Rows whose old value was NULL take the default
+			stmts = append(stmts, fmt.Sprintf("UPDATE %s SET %s = DEFAULT WHERE %s IS NULL;", dm.Table, dm.To.Name, dm.To.Name))
+		}
+	}
+	if !dm.To.Nullable {
+		stmts = append(stmts, prefix+" SET NOT NULL;")
+	}
+	return stmts
+}
+
+// generateDataRollback renders the reverse of a data migration. A migration
+// that maps several old values to one new value cannot be reversed, so its
+// rollback fails instead of guessing.
+func (e *Emitter) generateDataRollback(dm *planner.DataMigration) []string {
+	if r := dm.Reverse(); r != nil {
+		return e.generateDataMigration(r)
+	}
+	return []string{fmt.Sprintf(`DO $$
+BEGIN
+    RAISE EXCEPTION 'migrate %s cannot be rolled back: it maps several values to the same value';
+END;
+$$;`, dm.Name)}
+}
+
+// generateEnumAdditions renders the values m adds to existing enum types.
+// They cannot be dropped again, so they have no down statements.
+func (e *Emitter) generateEnumAdditions(m *planner.MigrationPlan) []string {
+	var stmts []string
+	for _, at := range m.AlterTypes {
+		for _, v := range at.AddValues {
+			stmts = append(stmts, fmt.Sprintf("ALTER TYPE %s ADD VALUE IF NOT EXISTS '%s';", at.Name, v))
+		}
+	}
+	return stmts
+}
+
+// generateChangeStatements renders an incremental migration. Statements are
+// ordered so that each one only depends on objects that already exist: types
+// before the tables that use them, columns before their indexes and policies,
+// and drops after everything that might still reference the dropped object.
+func (e *Emitter) generateChangeStatements(m *planner.MigrationPlan) []string {
+	var stmts []string
+
+	for _, ct := range m.CreateTypes {
+		stmts = append(stmts, fmt.Sprintf("CREATE TYPE %s AS ENUM (%s);", ct.Name, e.formatEnumValues(ct.Values)))
+	}
+	for _, at := range m.AlterTypes {
+		for _, v := range at.RemovedValues {
+			stmts = append(stmts, fmt.Sprintf("-- %s: value '%s' is no longer declared but cannot be dropped from the type", at.Name, v))
+		}
+	}
+
+	for _, policy := range m.DropPolicies {
+		stmts = append(stmts, fmt.Sprintf("DROP POLICY IF EXISTS %s ON %s;", policy.Name, policy.Table))
+	}
+
+	for _, table := range m.CreateTables {
+		stmts = append(stmts, e.generateCreateTable(table))
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ENABLE ROW LEVEL SECURITY;", table.Name))
+	}
+	for _, trigger := range m.CreateTriggers {
+		stmts = append(stmts, fmt.Sprintf(
+			"CREATE TRIGGER %s %s %s ON %s FOR EACH ROW EXECUTE FUNCTION %s;",
+			trigger.Name, trigger.Timing, trigger.Event, trigger.Table, trigger.Function,
+		))
+	}
+
+	for _, alter := range m.AlterTables {
+		for _, col := range alter.AddColumns {
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s;", alter.Name, e.columnDefinition(col)))
+		}
+		for _, ac := range alter.AlterColumns {
+			prefix := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s", alter.Name, ac.Name)
+			if ac.NewType != "" {
+				// Drop the default first; it may not cast to the new type
+				stmts = append(stmts, prefix+" DROP DEFAULT;")
+				stmts = append(stmts, fmt.Sprintf("%s TYPE %s USING %s::text::%s;", prefix, ac.NewType, ac.Name, ac.NewType))
+			}
+			if ac.SetDefault != "" {
+				stmts = append(stmts, fmt.Sprintf("%s SET DEFAULT %s;", prefix, ac.SetDefault))
+			}
+			if ac.DropDefault && ac.NewType == "" {
+				stmts = append(stmts, prefix+" DROP DEFAULT;")
+			}
+			if ac.SetNotNull {
+				stmts = append(stmts, prefix+" SET NOT NULL;")
+			}
+			if ac.DropNotNull {
+				stmts = append(stmts, prefix+" DROP NOT NULL;")
+			}
+		}
+		for _, name := range alter.DropColumns {
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS %s;", alter.Name, name))
+		}
+	}
+
+	for _, name := range m.DropIndexes {
+		stmts = append(stmts, fmt.Sprintf("DROP INDEX IF EXISTS %s;", name))
+	}
+	for _, idx := range m.CreateIndexes {
+		uniqueStr := ""
+		if idx.Unique {
+			uniqueStr = "UNIQUE "
+		}
+		stmts = append(stmts, fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s ON %s (%s);",
+			uniqueStr, idx.Name, idx.Table, strings.Join(idx.Columns, ", ")))
+	}
+
+	for _, name := range m.DropTables {
+		stmts = append(stmts, fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE;", name))
+	}
+	for _, name := range m.DropTypes {
+		stmts = append(stmts, fmt.Sprintf("DROP TYPE IF EXISTS %s;", name))
+	}
+
+	for _, policy := range m.CreatePolicies {
+		stmt := fmt.Sprintf("CREATE POLICY %s ON %s FOR %s USING (%s)",
+			policy.Name, policy.Table, policy.Command, policy.Using)
+		if policy.WithCheck != "" {
+			stmt += fmt.Sprintf(" WITH CHECK (%s)", policy.WithCheck)
+		}
+		stmts = append(stmts, stmt+";")
+	}
+
+	return stmts
+}
@@ -4,6 +4,7 @@ package lexer
 
 import (
 	"fmt"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
@@ -273,6 +274,12 @@ func (l *Lexer) NextToken() token.Token {
 		l.readChar()
 		tok.End = l.position()
 
+	case '@':
+		tok.Type = token.AT
+		tok.Literal = "@"
+		l.readChar()
+		tok.End = l.position()
+
 	case '"':
 		tok = l.readString()
 
@@ -327,6 +334,18 @@ func (l *Lexer) readNumber() token.Token {
 		l.readChar()
 	}
 
+	if n := durationLength(l.input[start:]); n > 0 {
+		for l.pos < start+n {
+			l.readChar()
+		}
+		return token.Token{
+			Type:    token.DURATION,
+			Literal: l.input[start:l.pos],
+			Pos:     startPos,
+			End:     l.position(),
+		}
+	}
+
 	if l.ch == '.' && isDigit(l.peekChar()) {
 		tokType = token.FLOAT
 		l.readChar() // consume '.'
@@ -343,6 +362,40 @@ func (l *Lexer) readNumber() token.Token {
 	}
 }
 
+// durationUnits are the units accepted in duration literals.
+var durationUnits = []string{"ms", "s", "m", "h", "d"}
+
+// durationLength returns the length of the duration literal at the start of
+// s, such as 30s, 24h or 1h30m, or 0 if s does not start with one. A number
+// followed by anything other than a unit stays a plain number.
+func durationLength(s string) int {
+	n := 0
+	for n < len(s) && isDigit(rune(s[n])) {
+		i := n
+		for i < len(s) && isDigit(rune(s[i])) {
+			i++
+		}
+		unit := ""
+		for _, u := range durationUnits {
+			if strings.HasPrefix(s[i:], u) {
+				unit = u
+				break
+			}
+		}
+		if unit == "" {
+			break
+		}
+		n = i + len(unit)
+	}
+	// The literal must end at a word boundary: "5min" is not "5m" + "in".
+	if n > 0 && n < len(s) {
+		if r := rune(s[n]); isLetter(r) || isDigit(r) {
+			return 0
+		}
+	}
+	return n
+}
+
 // readString reads a string literal.
 func (l *Lexer) readString() token.Token {
 	startPos := l.position()
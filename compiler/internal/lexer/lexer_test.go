@@ -34,10 +34,10 @@ func TestLexer_BasicTokens(t *testing.T) {
 		},
 		{
 			name:  "delimiters",
-			input: "{ } ( ) [ ] , ;",
+			input: "{ } ( ) [ ] , ; @",
 			expected: []token.Type{
 				token.LBRACE, token.RBRACE, token.LPAREN, token.RPAREN,
-				token.LBRACKET, token.RBRACKET, token.COMMA, token.SEMICOLON, token.EOF,
+				token.LBRACKET, token.RBRACKET, token.COMMA, token.SEMICOLON, token.AT, token.EOF,
 			},
 		},
 		{
@@ -121,6 +121,13 @@ func TestLexer_Numbers(t *testing.T) {
 		{"3.14", token.FLOAT, "3.14"},
 		{"0.5", token.FLOAT, "0.5"},
 		{"100.0", token.FLOAT, "100.0"},
+		{"30s", token.DURATION, "30s"},
+		{"24h", token.DURATION, "24h"},
+		{"250ms", token.DURATION, "250ms"},
+		{"1h30m", token.DURATION, "1h30m"},
+		{"7d", token.DURATION, "7d"},
+		{"5min", token.INT, "5"},
+		{"1h30", token.INT, "1"},
 	}
 
 	for _, tt := range tests {
@@ -278,7 +285,7 @@ func TestLexer_Errors(t *testing.T) {
 		},
 		{
 			name:        "invalid character",
-			input:       "entity @ Ticket",
+			input:       "entity $ Ticket",
 			expectError: true,
 		},
 	}
@@ -0,0 +1,361 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testModel = `entity User {
+	email: string unique
+}
+
+entity Ticket {
+	subject: string
+	status: enum(open, closed) = open
+}
+
+relation Ticket.author -> User
+
+message TICKET_CLOSED {
+	level: error
+	default: "Closed"
+}
+`
+
+const testRules = `rule Ticket.update {
+	forbid if status == closed
+		emit TICKET_CLOSED
+}
+
+access Ticket {
+	read: user == author or Ticket.author.email == user.email
+	write: user == author
+}
+`
+
+// session scripts a client: messages are queued, then the server runs over
+// them and its output is split back into messages.
+type session struct {
+	t      *testing.T
+	dir    string
+	in     bytes.Buffer
+	nextID int
+}
+
+func newSession(t *testing.T) *session {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{"model.forge": testModel, "rules.forge": testRules} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &session{t: t, dir: dir}
+}
+
+func (s *session) uri(name string) string {
+	return pathToURI(filepath.Join(s.dir, name))
+}
+
+func (s *session) send(msg map[string]any) {
+	msg["jsonrpc"] = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	fmt.Fprintf(&s.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *session) notify(method string, params any) {
+	s.send(map[string]any{"method": method, "params": params})
+}
+
+// request queues a request and returns its id.
+func (s *session) request(method string, params any) int {
+	s.nextID++
+	s.send(map[string]any{"id": s.nextID, "method": method, "params": params})
+	return s.nextID
+}
+
+func (s *session) open(name, text string) {
+	s.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": s.uri(name), "version": 1, "text": text},
+	})
+}
+
+// at queues a position request for the n-th occurrence (from 1) of needle
+// in the document, offset by shift characters.
+func (s *session) at(method, name, text, needle string, n, shift int) int {
+	return s.request(method, map[string]any{
+		"textDocument": map[string]any{"uri": s.uri(name)},
+		"position":     positionOf(s.t, text, needle, n, shift),
+	})
+}
+
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// run serves the queued messages and returns the server's output.
+func (s *session) run() []message {
+	s.t.Helper()
+	s.notify("exit", nil)
+	var out bytes.Buffer
+	if err := Serve(&s.in, &out); err != nil {
+		s.t.Fatalf("Serve: %v", err)
+	}
+
+	var msgs []message
+	server := &Server{in: bufio.NewReader(&out)}
+	for {
+		body, err := server.read()
+		if err != nil {
+			break
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.t.Fatalf("invalid message %s: %v", body, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func result(t *testing.T, msgs []message, id int, v any) {
+	t.Helper()
+	for _, msg := range msgs {
+		if msg.ID != nil && *msg.ID == id {
+			if msg.Error != nil {
+				t.Fatalf("request %d failed: %s", id, msg.Error.Message)
+			}
+			if err := json.Unmarshal(msg.Result, v); err != nil {
+				t.Fatalf("request %d: %v", id, err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no response to request %d", id)
+}
+
+// published returns the diagnostics published for uri, in order.
+func published(t *testing.T, msgs []message, uri string) [][]Diagnostic {
+	t.Helper()
+	var all [][]Diagnostic
+	for _, msg := range msgs {
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params PublishDiagnosticsParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			t.Fatal(err)
+		}
+		if params.URI == uri {
+			all = append(all, params.Diagnostics)
+		}
+	}
+	return all
+}
+
+func positionOf(t *testing.T, text, needle string, n, shift int) Position {
+	t.Helper()
+	off := -1
+	for i := 0; i < n; i++ {
+		next := strings.Index(text[off+1:], needle)
+		if next < 0 {
+			t.Fatalf("occurrence %d of %q not found", n, needle)
+		}
+		off += next + 1
+	}
+	off += shift
+	line := strings.Count(text[:off], "\n")
+	return Position{Line: line, Character: off - strings.LastIndex(text[:off], "\n") - 1}
+}
+
+func TestServer_Initialize(t *testing.T) {
+	s := newSession(t)
+	id := s.request("initialize", map[string]any{"capabilities": map[string]any{}})
+	unknown := s.request("textDocument/formatting", map[string]any{})
+	msgs := s.run()
+
+	var init struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	result(t, msgs, id, &init)
+	for _, capability := range []string{"definitionProvider", "hoverProvider", "completionProvider", "codeActionProvider"} {
+		if init.Capabilities[capability] == nil {
+			t.Errorf("missing capability %s", capability)
+		}
+	}
+
+	for _, msg := range msgs {
+		if msg.ID != nil && *msg.ID == unknown {
+			if msg.Error == nil || msg.Error.Code != codeMethodNotFound {
+				t.Errorf("expected method not found, got %+v", msg.Error)
+			}
+			return
+		}
+	}
+	t.Error("no response to the unsupported request")
+}
+
+func TestServer_Diagnostics(t *testing.T) {
+	s := newSession(t)
+	broken := strings.Replace(testRules, "emit TICKET_CLOSED", "emit TICKET_CLOSD", 1)
+	s.open("rules.forge", broken)
+	fix := s.request("textDocument/codeAction", map[string]any{
+		"textDocument": map[string]any{"uri": s.uri("rules.forge")},
+		"range":        Range{Start: positionOf(t, broken, "TICKET_CLOSD", 1, 0), End: positionOf(t, broken, "TICKET_CLOSD", 1, 0)},
+	})
+	s.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": s.uri("rules.forge"), "version": 2},
+		"contentChanges": []map[string]any{{"text": testRules}},
+	})
+	msgs := s.run()
+
+	rounds := published(t, msgs, s.uri("rules.forge"))
+	if len(rounds) != 2 {
+		t.Fatalf("expected diagnostics published twice, got %d", len(rounds))
+	}
+	if len(rounds[0]) != 1 {
+		t.Fatalf("expected one diagnostic, got %+v", rounds[0])
+	}
+	d := rounds[0][0]
+	start := positionOf(t, broken, "TICKET_CLOSD", 1, 0)
+	want := Range{Start: start, End: Position{Line: start.Line, Character: start.Character + len("TICKET_CLOSD")}}
+	if d.Severity != SeverityError || d.Range != want {
+		t.Errorf("diagnostic = %+v, want an error over %+v", d, want)
+	}
+	if len(rounds[1]) != 0 {
+		t.Errorf("expected the fixed file to be cleared, got %+v", rounds[1])
+	}
+
+	var actions []CodeAction
+	result(t, msgs, fix, &actions)
+	if len(actions) != 1 {
+		t.Fatalf("expected one quick fix, got %+v", actions)
+	}
+	edits := actions[0].Edit.Changes[s.uri("rules.forge")]
+	if actions[0].Kind != "quickfix" || len(edits) != 1 || edits[0].NewText != "TICKET_CLOSED" || edits[0].Range != want {
+		t.Errorf("unexpected quick fix %+v", actions[0])
+	}
+}
+
+func TestServer_Definition(t *testing.T) {
+	tests := []struct {
+		name   string
+		needle string
+		n      int
+		want   string // declaration the location must point at
+	}{
+		{"message", "TICKET_CLOSED", 1, "TICKET_CLOSED {"},
+		{"bare field", "status", 1, "status: enum"},
+		{"relation in access", "author", 1, "author -> User"},
+		{"entity", "Ticket", 3, "Ticket {"},
+		{"field through relation", "email", 1, "email: string"},
+		{"user field", "email", 2, "email: string"},
+	}
+
+	s := newSession(t)
+	s.open("rules.forge", testRules)
+	ids := make([]int, len(tests))
+	for i, tt := range tests {
+		ids[i] = s.at("textDocument/definition", "rules.forge", testRules, tt.needle, tt.n, 1)
+	}
+	msgs := s.run()
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var loc Location
+			result(t, msgs, ids[i], &loc)
+			if loc.URI != s.uri("model.forge") {
+				t.Fatalf("location in %s, want model.forge", loc.URI)
+			}
+			want := positionOf(t, testModel, tt.want, 1, 0)
+			if loc.Range.Start != want {
+				t.Errorf("location starts at %+v, want %+v", loc.Range.Start, want)
+			}
+		})
+	}
+}
+
+func TestServer_Hover(t *testing.T) {
+	s := newSession(t)
+	s.open("rules.forge", testRules)
+	status := s.at("textDocument/hover", "rules.forge", testRules, "status", 1, 0)
+	relation := s.at("textDocument/hover", "rules.forge", testRules, "author", 1, 0)
+	keyword := s.at("textDocument/hover", "rules.forge", testRules, "forbid", 1, 0)
+	msgs := s.run()
+
+	var hover Hover
+	result(t, msgs, status, &hover)
+	if !strings.Contains(hover.Contents.Value, "field Ticket.status: enum(open, closed)") ||
+		!strings.Contains(hover.Contents.Value, "status: enum(open, closed) = open") {
+		t.Errorf("unexpected hover %q", hover.Contents.Value)
+	}
+
+	result(t, msgs, relation, &hover)
+	if !strings.Contains(hover.Contents.Value, "relation Ticket.author -> User") {
+		t.Errorf("unexpected hover %q", hover.Contents.Value)
+	}
+
+	var none *Hover
+	result(t, msgs, keyword, &none)
+	if none != nil {
+		t.Errorf("expected no hover on a keyword, got %q", none.Contents.Value)
+	}
+}
+
+func TestServer_Completion(t *testing.T) {
+	tests := []struct {
+		name   string
+		typed  string
+		want   []string
+		absent []string
+	}{
+		{"relation path", "Ticket.author.", []string{"email"}, []string{"subject"}},
+		{"entity fields", "Ticket.", []string{"subject", "status", "author"}, []string{"email"}},
+		{"user", "user.", []string{"email"}, []string{"status"}},
+		{"bare", "", []string{"user", "Ticket", "User", "status", "author"}, nil},
+	}
+
+	s := newSession(t)
+	s.open("rules.forge", testRules) // analyzed before the edits break it
+	ids := make([]int, len(tests))
+	for i, tt := range tests {
+		text := strings.Replace(testRules, "write: user == author", "write: "+tt.typed, 1)
+		s.open("rules.forge", text)
+		ids[i] = s.at("textDocument/completion", "rules.forge", text, "write: "+tt.typed, 1, len("write: "+tt.typed))
+	}
+	msgs := s.run()
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var list CompletionList
+			result(t, msgs, ids[i], &list)
+			labels := make(map[string]bool)
+			for _, item := range list.Items {
+				labels[item.Label] = true
+			}
+			for _, label := range tt.want {
+				if !labels[label] {
+					t.Errorf("missing completion %s in %+v", label, list.Items)
+				}
+			}
+			for _, label := range tt.absent {
+				if labels[label] {
+					t.Errorf("unexpected completion %s", label)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,425 @@
+package lsp
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/forge-lang/forge/compiler/internal/analyzer"
+	"github.com/forge-lang/forge/compiler/internal/ast"
+	"github.com/forge-lang/forge/compiler/internal/diag"
+	"github.com/forge-lang/forge/compiler/internal/lexer"
+	"github.com/forge-lang/forge/compiler/internal/parser"
+	"github.com/forge-lang/forge/compiler/internal/token"
+)
+
+// target is a declaration a reference resolves to.
+type target struct {
+	title string     // one-line summary, e.g. "field Ticket.status: string"
+	ident *ast.Ident // declared name; nil if there is nothing to jump to
+	decl  ast.Node   // declaration shown on hover
+}
+
+// cursor is a position in an open document, resolved against its project.
+type cursor struct {
+	proj   *project
+	path   string
+	text   string
+	offset int
+}
+
+func (s *Server) cursor(params TextDocumentPositionParams) *cursor {
+	path := uriToPath(params.TextDocument.URI)
+	proj := s.projects[filepath.Dir(path)]
+	if proj == nil || proj.scope == nil {
+		return nil
+	}
+	text, ok := proj.sources[path]
+	if !ok {
+		return nil
+	}
+	return &cursor{proj: proj, path: path, text: text, offset: offset(text, params.Position)}
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) any {
+	c := s.cursor(params)
+	if c == nil {
+		return nil
+	}
+	parts, _ := reference(c.text, c.offset)
+	t := c.resolve(parts)
+	if t == nil || t.ident == nil {
+		return nil
+	}
+	file := t.ident.StartPos.Filename
+	return Location{
+		URI:   pathToURI(file),
+		Range: toRange(c.proj.fileSources[file], diag.Range{Start: t.ident.Pos(), End: t.ident.End()}),
+	}
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) any {
+	c := s.cursor(params)
+	if c == nil {
+		return nil
+	}
+	parts, tok := reference(c.text, c.offset)
+	t := c.resolve(parts)
+	if t == nil {
+		return nil
+	}
+
+	value := "`" + t.title + "`"
+	if snippet := c.proj.snippet(t.decl); snippet != "" && snippet != t.title {
+		value += "\n\n```forge\n" + snippet + "\n```"
+	}
+	rng := toRange(c.text, diag.Range{Start: tok.Pos, End: tok.End})
+	return Hover{Contents: MarkupContent{Kind: "markdown", Value: value}, Range: &rng}
+}
+
+// pathPrefix matches the dotted path being typed before the cursor.
+var pathPrefix = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_.]*$`)
+
+func (s *Server) completion(params TextDocumentPositionParams) any {
+	c := s.cursor(params)
+	if c == nil {
+		return CompletionList{Items: []CompletionItem{}}
+	}
+	scope := c.proj.scope
+
+	line := c.text[:c.offset]
+	if i := strings.LastIndexByte(line, '\n'); i >= 0 {
+		line = line[i+1:]
+	}
+	parts := strings.Split(pathPrefix.FindString(line), ".")
+	parts = parts[:len(parts)-1] // the part being typed is filtered by the client
+
+	items := []CompletionItem{}
+	var entity *analyzer.Entity
+	if len(parts) == 0 {
+		entity = scope.Entities[c.contextEntity()]
+		items = append(items, CompletionItem{Label: "user", Kind: CompletionVariable, Detail: "the current user"})
+		for _, name := range sortedKeys(scope.Entities) {
+			items = append(items, CompletionItem{Label: name, Kind: CompletionClass, Detail: "entity"})
+		}
+	} else {
+		entity = c.entityAt(parts)
+	}
+	if entity == nil {
+		return CompletionList{Items: items}
+	}
+
+	for _, name := range sortedKeys(entity.Fields) {
+		items = append(items, CompletionItem{Label: name, Kind: CompletionField, Detail: typeString(entity.Fields[name])})
+	}
+	for _, key := range sortedKeys(scope.Relations) {
+		if rel := scope.Relations[key]; rel.FromEntity == entity.Name {
+			items = append(items, CompletionItem{Label: rel.FromField, Kind: CompletionReference, Detail: "-> " + rel.ToEntity})
+		}
+	}
+	return CompletionList{Items: items}
+}
+
+func (s *Server) codeActions(params CodeActionParams) []CodeAction {
+	actions := []CodeAction{}
+	path := uriToPath(params.TextDocument.URI)
+	proj := s.projects[filepath.Dir(path)]
+	if proj == nil {
+		return actions
+	}
+
+	for _, d := range proj.diagnostics[path] {
+		if d.FixHint == nil {
+			continue
+		}
+		converted := proj.convert(d)
+		if !overlaps(converted.Range, params.Range) {
+			continue
+		}
+		var edits []TextEdit
+		for _, edit := range d.FixHint.Edits {
+			edits = append(edits, TextEdit{Range: proj.lspRange(edit.Range), NewText: edit.NewText})
+		}
+		actions = append(actions, CodeAction{
+			Title:       d.FixHint.Title,
+			Kind:        "quickfix",
+			Diagnostics: []Diagnostic{converted},
+			Edit:        WorkspaceEdit{Changes: map[string][]TextEdit{params.TextDocument.URI: edits}},
+		})
+	}
+	return actions
+}
+
+// reference returns the dotted path ending at the name under the cursor,
+// e.g. [Ticket author] for the cursor on "author" in Ticket.author.email,
+// and the token of that name.
+func reference(text string, off int) ([]string, token.Token) {
+	all, _ := lexer.Tokenize(text, "")
+	var tokens []token.Token
+	for _, tok := range all {
+		if tok.Type != token.COMMENT {
+			tokens = append(tokens, tok)
+		}
+	}
+
+	for i, tok := range tokens {
+		if !isName(tok) || off < tok.Pos.Offset || off > tok.End.Offset {
+			continue
+		}
+		parts := []string{tok.Literal}
+		for j := i; j >= 2; j -= 2 {
+			dot, prev := tokens[j-1], tokens[j-2]
+			if dot.Type != token.DOT || !isName(prev) ||
+				prev.End.Offset != dot.Pos.Offset || dot.End.Offset != tokens[j].Pos.Offset {
+				break
+			}
+			parts = append([]string{prev.Literal}, parts...)
+		}
+		return parts, tok
+	}
+	return nil, token.Token{}
+}
+
+func isName(tok token.Token) bool {
+	return tok.Type == token.IDENT || tok.Type.IsKeyword()
+}
+
+// resolve finds the declaration a dotted path refers to. The first part may
+// be an entity, user, input, a named declaration, or a field or relation
+// of the entity the cursor's declaration is about.
+func (c *cursor) resolve(parts []string) *target {
+	if len(parts) == 0 {
+		return nil
+	}
+	scope := c.proj.scope
+
+	var entity *analyzer.Entity
+	first, rest := parts[0], parts[1:]
+	switch {
+	case scope.Entities[first] != nil:
+		entity = scope.Entities[first]
+	case first == "user":
+		entity = scope.Entities["User"]
+	case first == "input":
+		entity = scope.Entities[c.contextEntity()]
+	default:
+		if len(parts) == 1 {
+			if t := namedTarget(scope, first); t != nil {
+				return t
+			}
+		}
+		entity, rest = scope.Entities[c.contextEntity()], parts
+	}
+	if entity == nil {
+		return nil
+	}
+	if len(rest) == 0 {
+		return entityTarget(entity)
+	}
+
+	for i, name := range rest {
+		if _, ok := entity.Fields[name]; ok {
+			if i == len(rest)-1 {
+				return fieldTarget(entity, name)
+			}
+			return nil
+		}
+		rel := scope.Relations[entity.Name+"."+name]
+		if rel == nil {
+			return nil
+		}
+		if i == len(rest)-1 {
+			return relationTarget(rel)
+		}
+		if entity = scope.Entities[rel.ToEntity]; entity == nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// entityAt resolves a path of relations to the entity it ends at.
+func (c *cursor) entityAt(parts []string) *analyzer.Entity {
+	t := c.resolve(parts)
+	if t == nil {
+		return nil
+	}
+	switch decl := t.decl.(type) {
+	case *ast.EntityDecl:
+		return c.proj.scope.Entities[decl.Name.Name]
+	case *ast.RelationDecl:
+		return c.proj.scope.Entities[decl.To.Name]
+	}
+	return nil
+}
+
+func namedTarget(scope *analyzer.Scope, name string) *target {
+	if msg := scope.Messages[name]; msg != nil {
+		return &target{title: "message " + name, ident: msg.Code, decl: msg}
+	}
+	if job := scope.Jobs[name]; job != nil {
+		return &target{title: "job " + name, ident: job.Name, decl: job}
+	}
+	if action := scope.Actions[name]; action != nil {
+		return &target{title: "action " + name, ident: action.Name, decl: action}
+	}
+	if view := scope.Views[name]; view != nil {
+		return &target{title: "view " + name, ident: view.Name, decl: view}
+	}
+	if presence := scope.Presences[name]; presence != nil {
+		return &target{title: "presence " + name, ident: presence.Decl.Name, decl: presence.Decl}
+	}
+	if webhook := scope.Webhooks[name]; webhook != nil {
+		return &target{title: "webhook " + name, ident: webhook.Name, decl: webhook}
+	}
+	if imp := scope.Imperatives[name]; imp != nil {
+		return &target{title: "imperative " + name, ident: imp.Name, decl: imp}
+	}
+	return nil
+}
+
+func entityTarget(entity *analyzer.Entity) *target {
+	return &target{title: "entity " + entity.Name, ident: entity.Decl.Name, decl: entity.Decl}
+}
+
+func fieldTarget(entity *analyzer.Entity, name string) *target {
+	t := &target{title: fmt.Sprintf("field %s.%s: %s", entity.Name, name, typeString(entity.Fields[name]))}
+	for _, field := range entity.Decl.Fields {
+		if field.Name.Name == name {
+			t.ident, t.decl = field.Name, field
+		}
+	}
+	return t
+}
+
+func relationTarget(rel *analyzer.Relation) *target {
+	title := fmt.Sprintf("relation %s.%s -> %s", rel.FromEntity, rel.FromField, rel.ToEntity)
+	if rel.IsMany {
+		title += " many"
+	}
+	from := rel.Decl.From.Parts
+	return &target{title: title, ident: from[len(from)-1], decl: rel.Decl}
+}
+
+func typeString(ft *analyzer.FieldType) string {
+	s := ft.Name
+	if ft.IsEnum {
+		s = "enum(" + strings.Join(ft.EnumValues, ", ") + ")"
+	}
+	if ft.IsUnique {
+		s += " unique"
+	}
+	return s
+}
+
+// contextEntity returns the entity the declaration around the cursor is
+// about, which bare field names in it refer to. The document is parsed as
+// it is now, so the enclosing declaration is found even while the project
+// has errors.
+func (c *cursor) contextEntity() string {
+	file, _ := parser.Parse(c.text, c.path)
+	in := func(n ast.Node) bool {
+		return n.Pos().Offset <= c.offset && c.offset <= n.End().Offset
+	}
+	first := func(p *ast.PathExpr) string {
+		if p == nil || len(p.Parts) == 0 {
+			return ""
+		}
+		return p.Parts[0].Name
+	}
+	name := func(i *ast.Ident) string {
+		if i == nil {
+			return ""
+		}
+		return i.Name
+	}
+
+	for _, d := range file.Entities {
+		if in(d) {
+			return name(d.Name)
+		}
+	}
+	for _, d := range file.Rules {
+		if in(d) {
+			return first(d.Target)
+		}
+	}
+	for _, d := range file.Access {
+		if in(d) {
+			return name(d.Entity)
+		}
+	}
+	for _, d := range file.Hooks {
+		if in(d) {
+			return first(d.Target)
+		}
+	}
+	for _, d := range file.Views {
+		if in(d) {
+			return name(d.Source)
+		}
+	}
+	for _, d := range file.Presences {
+		if in(d) {
+			return name(d.Source)
+		}
+	}
+	for _, d := range file.Jobs {
+		if in(d) {
+			return name(d.Input)
+		}
+	}
+	for _, d := range file.Migrations {
+		if in(d) {
+			return first(d.Target)
+		}
+	}
+	for _, d := range file.Tests {
+		if in(d) {
+			return c.proj.scope.TestSubject(d)
+		}
+	}
+	for _, d := range file.Actions {
+		if !in(d) {
+			continue
+		}
+		for _, prop := range d.Properties {
+			if ident, ok := prop.Value.(*ast.Ident); ok && prop.Key.Name == "input" {
+				return ident.Name
+			}
+		}
+	}
+	return ""
+}
+
+// snippet returns the source text of decl from the last good analysis.
+func (p *project) snippet(decl ast.Node) string {
+	if decl == nil {
+		return ""
+	}
+	text := p.fileSources[decl.Pos().Filename]
+	start, end := decl.Pos().Offset, decl.End().Offset
+	if start < 0 || end > len(text) || start >= end {
+		return ""
+	}
+	return strings.TrimSpace(text[start:end])
+}
+
+func overlaps(a, b Range) bool {
+	return !before(a.End, b.Start) && !before(b.End, a.Start)
+}
+
+func before(a, b Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
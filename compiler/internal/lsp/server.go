@@ -0,0 +1,235 @@
+// Package lsp implements a Language Server Protocol server for FORGE.
+// It speaks JSON-RPC over stdio and answers from the same parser, analyzer
+// and diagnostics the compiler uses.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Server is a FORGE language server. Requests are handled one at a time in
+// the order they arrive.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	docs     map[string]string   // open documents by path
+	projects map[string]*project // analyzed projects by directory
+
+	err error // first write error; ends the session
+}
+
+// Serve runs a language server reading requests from in and writing
+// responses to out until the client sends exit or closes in.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &Server{
+		in:       bufio.NewReader(in),
+		out:      out,
+		docs:     make(map[string]string),
+		projects: make(map[string]*project),
+	}
+	return s.run()
+}
+
+func (s *Server) run() error {
+	for {
+		body, err := s.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+			if s.err != nil {
+				return s.err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+
+		result, rerr := s.handle(&req)
+		if req.ID != nil { // notifications get no response
+			s.reply(req.ID, result, rerr)
+		}
+		if s.err != nil {
+			return s.err
+		}
+	}
+}
+
+// handle dispatches a request or notification to its handler.
+func (s *Server) handle(req *request) (any, *responseError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": map[string]any{
+					"openClose": true,
+					"change":    1, // full document
+					"save":      true,
+				},
+				"definitionProvider": true,
+				"hoverProvider":      true,
+				"completionProvider": map[string]any{"triggerCharacters": []string{"."}},
+				"codeActionProvider": true,
+			},
+			"serverInfo": map[string]any{"name": "forge-lsp"},
+		}, nil
+	case "initialized", "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		path := uriToPath(params.TextDocument.URI)
+		s.docs[path] = params.TextDocument.Text
+		s.refresh(path)
+		return nil, nil
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			path := uriToPath(params.TextDocument.URI)
+			s.docs[path] = params.ContentChanges[n-1].Text
+			s.refresh(path)
+		}
+		return nil, nil
+	case "textDocument/didSave":
+		var params DidSaveTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.refresh(uriToPath(params.TextDocument.URI))
+		return nil, nil
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		path := uriToPath(params.TextDocument.URI)
+		delete(s.docs, path)
+		s.refresh(path)
+		return nil, nil
+
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.definition(params), nil
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.hover(params), nil
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.completion(params), nil
+	case "textDocument/codeAction":
+		var params CodeActionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.codeActions(params), nil
+	}
+
+	if req.ID != nil && !strings.HasPrefix(req.Method, "$/") {
+		return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %s not supported", req.Method)}
+	}
+	return nil, nil
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+// refresh re-analyzes the project containing path and publishes its
+// diagnostics.
+func (s *Server) refresh(path string) {
+	published := s.analyze(path)
+	uris := make([]string, 0, len(published))
+	for uri := range published {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	for _, uri := range uris {
+		s.write(notification{
+			JSONRPC: "2.0",
+			Method:  "textDocument/publishDiagnostics",
+			Params:  PublishDiagnosticsParams{URI: uri, Diagnostics: published[uri]},
+		})
+	}
+}
+
+func (s *Server) reply(id *json.RawMessage, result any, rerr *responseError) {
+	if id == nil {
+		null := json.RawMessage("null")
+		id = &null
+	}
+	s.write(response{JSONRPC: "2.0", ID: id, Result: result, Error: rerr})
+}
+
+// read reads one Content-Length framed message.
+func (s *Server) read() ([]byte, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if v, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+			if length, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", v)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("message without Content-Length header")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// write sends msg with a Content-Length header. Once a write fails the
+// rest are dropped and the session ends.
+func (s *Server) write(msg any) {
+	if s.err != nil {
+		return
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		s.err = err
+		return
+	}
+	_, s.err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
@@ -0,0 +1,228 @@
+package lsp
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/forge-lang/forge/compiler/internal/analyzer"
+	"github.com/forge-lang/forge/compiler/internal/ast"
+	"github.com/forge-lang/forge/compiler/internal/diag"
+	"github.com/forge-lang/forge/compiler/internal/parser"
+	"github.com/forge-lang/forge/compiler/internal/token"
+)
+
+// project is the analysis of the .forge files in one directory, which the
+// compiler builds as a single app.
+type project struct {
+	sources     map[string]string            // text of every file, open documents included
+	diagnostics map[string][]diag.Diagnostic // last diagnostics by path
+
+	// The last analysis without errors. Navigation keeps working from it
+	// while the files are being edited into a broken state.
+	scope       *analyzer.Scope
+	fileSources map[string]string
+}
+
+// analyze re-analyzes the project containing path and returns the LSP
+// diagnostics to publish by URI. Every file that had diagnostics before
+// is included so that fixed files are cleared.
+func (s *Server) analyze(path string) map[string][]Diagnostic {
+	dir := filepath.Dir(path)
+	proj := s.projects[dir]
+	if proj == nil {
+		proj = &project{}
+		s.projects[dir] = proj
+	}
+
+	proj.sources = s.sources(dir)
+	previous := proj.diagnostics
+	proj.diagnostics = make(map[string][]diag.Diagnostic)
+
+	combined, diags := parseProject(proj.sources)
+	if !diags.HasErrors() {
+		a := analyzer.New(combined)
+		diags.Merge(a.Analyze())
+		if !diags.HasErrors() {
+			proj.scope, proj.fileSources = a.Scope(), proj.sources
+		}
+	}
+
+	for _, d := range diags.All() {
+		file := d.Range.Start.Filename
+		if file == "" {
+			file = path // project-wide errors show on the edited file
+		}
+		proj.diagnostics[file] = append(proj.diagnostics[file], d)
+	}
+
+	published := make(map[string][]Diagnostic)
+	for file := range previous {
+		published[pathToURI(file)] = []Diagnostic{}
+	}
+	if _, open := s.docs[path]; open {
+		published[pathToURI(path)] = []Diagnostic{}
+	}
+	for file, list := range proj.diagnostics {
+		converted := make([]Diagnostic, 0, len(list))
+		for _, d := range list {
+			converted = append(converted, proj.convert(d))
+		}
+		published[pathToURI(file)] = converted
+	}
+	return published
+}
+
+// sources returns the .forge files in dir, with open documents in place of
+// their saved contents.
+func (s *Server) sources(dir string) map[string]string {
+	sources := make(map[string]string)
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".forge") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if content, err := os.ReadFile(path); err == nil {
+			sources[path] = string(content)
+		}
+	}
+	for path, text := range s.docs {
+		if filepath.Dir(path) == dir {
+			sources[path] = text
+		}
+	}
+	return sources
+}
+
+// parseProject parses and merges sources the way the compiler does.
+func parseProject(sources map[string]string) (*ast.File, *diag.Diagnostics) {
+	paths := make([]string, 0, len(sources))
+	for path := range sources {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	diags := diag.New()
+	combined := &ast.File{}
+	for _, path := range paths {
+		p := parser.New(sources[path], path)
+		parsed := p.ParseFile()
+		diags.Merge(p.Diagnostics())
+
+		if parsed.App != nil {
+			if combined.App != nil {
+				diags.AddError(diag.Range{Start: parsed.App.Pos(), End: parsed.App.Name.End()},
+					"E0002", "multiple app declarations found")
+			} else {
+				combined.App = parsed.App
+			}
+		}
+		combined.Merge(parsed)
+	}
+	return combined, diags
+}
+
+// convert turns a compiler diagnostic into an LSP one.
+func (p *project) convert(d diag.Diagnostic) Diagnostic {
+	severity := SeverityError
+	switch d.Severity {
+	case diag.Warning:
+		severity = SeverityWarning
+	case diag.Info:
+		severity = SeverityInformation
+	case diag.Hint:
+		severity = SeverityHint
+	}
+
+	out := Diagnostic{
+		Range:    p.lspRange(d.Range),
+		Severity: severity,
+		Code:     d.Code,
+		Source:   "forge",
+		Message:  d.Message,
+	}
+	for _, rel := range d.Related {
+		out.RelatedInformation = append(out.RelatedInformation, DiagnosticRelatedInformation{
+			Location: Location{URI: pathToURI(rel.Range.Start.Filename), Range: p.lspRange(rel.Range)},
+			Message:  rel.Message,
+		})
+	}
+	return out
+}
+
+// lspRange converts a source range using the current text of its file.
+func (p *project) lspRange(r diag.Range) Range {
+	return toRange(p.sources[r.Start.Filename], r)
+}
+
+// toRange converts a range in text. A range without an end is empty.
+func toRange(text string, r diag.Range) Range {
+	start := lspPosition(text, r.Start)
+	if r.End.Line == 0 {
+		return Range{Start: start, End: start}
+	}
+	return Range{Start: start, End: lspPosition(text, r.End)}
+}
+
+// lspPosition converts a source position to a 0-indexed position counting
+// UTF-16 code units. It goes by the byte offset, which is exact where the
+// lexer's columns are not.
+func lspPosition(text string, pos token.Position) Position {
+	if pos.Line == 0 {
+		return Position{}
+	}
+	off := min(pos.Offset, len(text))
+	lineStart := strings.LastIndexByte(text[:off], '\n') + 1
+	return Position{
+		Line:      strings.Count(text[:lineStart], "\n"),
+		Character: utf16Len(text[lineStart:off]),
+	}
+}
+
+// offset converts an LSP position to a byte offset in text.
+func offset(text string, pos Position) int {
+	start := 0
+	for i := 0; i < pos.Line; i++ {
+		next := strings.IndexByte(text[start:], '\n')
+		if next < 0 {
+			return len(text)
+		}
+		start += next + 1
+	}
+
+	off, units := start, 0
+	for off < len(text) && text[off] != '\n' && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[off:])
+		units += utf16Len(string(r))
+		off += size
+	}
+	return off
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
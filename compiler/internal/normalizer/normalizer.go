@@ -3,11 +3,15 @@ package normalizer
 
 import (
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/forge-lang/forge/compiler/internal/analyzer"
 	"github.com/forge-lang/forge/compiler/internal/ast"
 	"github.com/forge-lang/forge/compiler/internal/diag"
 	"github.com/forge-lang/forge/compiler/internal/token"
+	"github.com/forge-lang/forge/compiler/naming"
 )
 
 // NormalizedEntity contains normalized entity information.
@@ -27,6 +31,11 @@ type NormalizedField struct {
 	EnumValues []string
 	MaxLength  int
 	MinLength  int
+
+	// Hidden fields are never read through the API; a field with a read
+	// condition is read only by the users it holds for
+	Hidden bool
+	Read   string // CEL
 }
 
 // NormalizedRelation contains normalized relation information.
@@ -36,6 +45,12 @@ type NormalizedRelation struct {
 	IsMany     bool
 	OnDelete   string // "cascade", "restrict", "set_null"
 	IsRequired bool
+	Column     string // foreign key of a to-one relation
+
+	// A many relation is stored in a join table rather than a column
+	JoinTable string
+	JoinKey   string // column referencing the owning record
+	TargetKey string // column referencing the target record
 }
 
 // NormalizedRule contains normalized rule information.
@@ -60,9 +75,31 @@ type NormalizedAccess struct {
 type NormalizedAction struct {
 	Name         string
 	InputType    string
-	Operation    string // "create", "update", "delete"
-	TargetEntity string // entity being created/updated/deleted
-	Hooks        []string // hook names to trigger
+	Operation    string                   // "create", "update", "delete"
+	TargetEntity string                   // entity being created/updated/deleted
+	Hooks        []string                 // hook names to trigger
+	Input        []*NormalizedActionInput // fields of an input block
+	Steps        []*NormalizedActionStep
+}
+
+// NormalizedActionInput is a field of an action's input block. A field typed
+// by an entity holds the id of one of its records.
+type NormalizedActionInput struct {
+	Field  *NormalizedField
+	Entity string // referenced entity (empty for scalar fields)
+}
+
+// NormalizedActionStep is a set, create, emit or reject statement in an
+// action body.
+type NormalizedActionStep struct {
+	Kind      string            // "set", "create", "emit", "reject"
+	Entity    string            // entity set or created
+	Record    string            // input field holding the id of the record set
+	Field     string            // field or to-one relation set (set only)
+	Value     string            // CEL expression (set only)
+	Fields    map[string]string // field -> CEL expression (create only)
+	Message   string            // message code (emit and reject)
+	Condition string            // CEL guard (empty means always)
 }
 
 // NormalizedJob contains normalized job information.
@@ -72,8 +109,44 @@ type NormalizedJob struct {
 	NeedsPath     string
 	NeedsFilter   string // CEL expression
 	Capabilities  []string
+	Imperative    string            // imperative the effect calls (empty for provider capabilities)
 	TargetEntity  string            // Entity to create (from creates clause)
 	FieldMappings map[string]string // field name -> expression string
+	Schedule      string            // cron expression (empty if not scheduled)
+	MaxAttempts   int               // 0 uses the runtime default
+	Backoff       *NormalizedBackoff
+	Timeout       time.Duration // per attempt; 0 uses the runtime default
+}
+
+// NormalizedBackoff is a job's retry backoff.
+type NormalizedBackoff struct {
+	Strategy string        // "exponential", "linear" or "fixed"
+	Base     time.Duration // delay before the first retry
+	Max      time.Duration // cap on the delay; 0 means uncapped
+}
+
+// NormalizedHook contains normalized hook information.
+type NormalizedHook struct {
+	Entity    string
+	Timing    string // "before" or "after"
+	Operation string // "create", "update", "delete"
+	Jobs      []string
+	Delayed   []*NormalizedDelayedJob
+	Steps     []*NormalizedHookStep
+}
+
+// NormalizedDelayedJob is an "enqueue job in duration" statement.
+type NormalizedDelayedJob struct {
+	Job   string
+	Delay time.Duration
+}
+
+// NormalizedHookStep is an emit, reject or set statement in a hook body.
+type NormalizedHookStep struct {
+	Kind      string // "emit", "reject", "set"
+	Target    string // message code, or field name for set
+	Value     string // CEL expression (set only)
+	Condition string // CEL guard (empty means always)
 }
 
 // NormalizedView contains normalized view information.
@@ -83,16 +156,48 @@ type NormalizedView struct {
 	Fields      []string
 	Filter      string           // CEL expression for static filter (empty if none)
 	Params      []string         // param names extracted from filter (e.g., ["org_id"])
+	ParamFields []string         // field each param is compared with, in Params order; nil unless the filter is only such comparisons
 	DefaultSort []NormalizedSort // default sort fields
 	Dependency  []string         // entities this view depends on
 }
 
+// NormalizedPresence contains normalized presence information. Entries
+// expire to the field defaults after TTL without an update.
+type NormalizedPresence struct {
+	Name          string
+	Source        string
+	SourceField   string
+	Scope         string
+	ScopeEntity   string
+	ScopeRelation string
+	ScopeVia      string // "source" or "scope"
+	Fields        []*NormalizedField
+	TTL           time.Duration // 0 uses the runtime default
+}
+
 // NormalizedSort represents a sort field.
 type NormalizedSort struct {
 	Field     string // field name (may be dotted, e.g. "created_at")
 	Direction string // "asc" or "desc"
 }
 
+// NormalizedMigration is a migrate declaration: it moves the values of an
+// entity's old field into its new field through a value map.
+type NormalizedMigration struct {
+	Name       string // "Entity.version"
+	Entity     string
+	FromField  string
+	FromValues []string // old enum values (empty if not an enum)
+	ToField    string
+	Mappings   []*NormalizedValueMap
+}
+
+// NormalizedValueMap maps an old field value to a new one.
+type NormalizedValueMap struct {
+	From string
+	To   string
+}
+
 // Output contains all normalized data.
 type Output struct {
 	AppName  string
@@ -105,8 +210,11 @@ type Output struct {
 	Access    []*NormalizedAccess
 	Actions   []*NormalizedAction
 	Jobs      []*NormalizedJob
+	Hooks     []*NormalizedHook
 	Views     []*NormalizedView
+	Presences []*NormalizedPresence
 	Messages  map[string]*MessageDef
+	Migrations []*NormalizedMigration
 }
 
 // MessageDef contains message definition.
@@ -156,12 +264,21 @@ func (n *Normalizer) Normalize() (*Output, *diag.Diagnostics) {
 	// Normalize jobs
 	n.normalizeJobs(out)
 
+	// Normalize hooks
+	n.normalizeHooks(out)
+
+	// Normalize presences
+	n.normalizePresences(out)
+
 	// Normalize views
 	n.normalizeViews(out)
 
 	// Normalize messages
 	n.normalizeMessages(out)
 
+	// Normalize migrations
+	n.normalizeMigrations(out)
+
 	// Derive implicit hooks and effects
 	n.deriveImplicitEffects(out)
 
@@ -236,46 +353,7 @@ func (n *Normalizer) normalizeEntities(out *Output) {
 
 		// Normalize declared fields
 		for _, field := range entity.Fields {
-			nf := &NormalizedField{
-				Name: field.Name.Name,
-			}
-
-			// Normalize type
-			if field.Type.Name.Name == "enum" {
-				nf.Type = "enum"
-				for _, v := range field.Type.EnumValues {
-					nf.EnumValues = append(nf.EnumValues, v.Name)
-				}
-			} else {
-				nf.Type = n.normalizeTypeName(field.Type.Name.Name)
-			}
-
-			// Process constraints
-			for _, c := range field.Constraints {
-				switch c.Kind {
-				case "unique":
-					nf.Unique = true
-				case "length":
-					if intLit, ok := c.Value.(*ast.IntLit); ok {
-						switch c.Operator {
-						case "<=", "<":
-							nf.MaxLength = int(intLit.Value)
-						case ">=", ">":
-							nf.MinLength = int(intLit.Value)
-						case "==":
-							nf.MaxLength = int(intLit.Value)
-							nf.MinLength = int(intLit.Value)
-						}
-					}
-				}
-			}
-
-			// Process default
-			if field.Default != nil {
-				nf.Default = n.extractDefaultValue(field.Default)
-			}
-
-			ne.Fields = append(ne.Fields, nf)
+			ne.Fields = append(ne.Fields, n.normalizeField(field))
 		}
 
 		// Collect relations for this entity
@@ -288,6 +366,11 @@ func (n *Normalizer) normalizeEntities(out *Output) {
 					OnDelete:   "cascade", // default
 					IsRequired: true,      // default for relations without ?
 				}
+				if rel.IsMany {
+					nr.JoinTable, nr.JoinKey, nr.TargetKey = rel.JoinTable()
+				} else {
+					nr.Column = rel.Column
+				}
 
 				// Check if field name ends with _id for foreign key inference
 				_ = key // silence unused warning
@@ -299,6 +382,55 @@ func (n *Normalizer) normalizeEntities(out *Output) {
 	}
 }
 
+// normalizeField normalizes a declared field of an entity or presence.
+func (n *Normalizer) normalizeField(field *ast.FieldDecl) *NormalizedField {
+	nf := &NormalizedField{
+		Name: field.Name.Name,
+	}
+
+	// Normalize type
+	if field.Type.Name.Name == "enum" {
+		nf.Type = "enum"
+		for _, v := range field.Type.EnumValues {
+			nf.EnumValues = append(nf.EnumValues, v.Name)
+		}
+	} else {
+		nf.Type = n.normalizeTypeName(field.Type.Name.Name)
+	}
+
+	// Process constraints
+	for _, c := range field.Constraints {
+		switch c.Kind {
+		case "unique":
+			nf.Unique = true
+		case "length":
+			if intLit, ok := c.Value.(*ast.IntLit); ok {
+				switch c.Operator {
+				case "<=", "<":
+					nf.MaxLength = int(intLit.Value)
+				case ">=", ">":
+					nf.MinLength = int(intLit.Value)
+				case "==":
+					nf.MaxLength = int(intLit.Value)
+					nf.MinLength = int(intLit.Value)
+				}
+			}
+		}
+	}
+
+	// Process default
+	if field.Default != nil {
+		nf.Default = n.extractDefaultValue(field.Default)
+	}
+
+	nf.Hidden = field.Hidden
+	if field.Read != nil {
+		nf.Read = n.exprToCEL(field.Read)
+	}
+
+	return nf
+}
+
 func (n *Normalizer) normalizeTypeName(name string) string {
 	switch name {
 	case "string":
@@ -423,10 +555,50 @@ func (n *Normalizer) normalizeActions(out *Output) {
 			}
 		}
 
+		if action.Input != nil {
+			for _, field := range action.Input.Fields {
+				input := &NormalizedActionInput{Field: n.normalizeField(field)}
+				if _, ok := n.scope.Entities[field.Type.Name.Name]; ok {
+					input.Entity = field.Type.Name.Name
+					input.Field.Type = "uuid"
+				}
+				na.Input = append(na.Input, input)
+			}
+		}
+		for _, step := range action.Steps {
+			na.Steps = append(na.Steps, n.normalizeActionStep(action, step))
+		}
+
 		out.Actions = append(out.Actions, na)
 	}
 }
 
+// normalizeActionStep resolves the record a set step names to the input
+// field holding its id.
+func (n *Normalizer) normalizeActionStep(action *ast.ActionDecl, step *ast.ActionStep) *NormalizedActionStep {
+	ns := &NormalizedActionStep{Kind: step.Kind}
+	switch step.Kind {
+	case "set":
+		if len(step.Path.Parts) == 2 {
+			ns.Record, ns.Entity = n.scope.ActionRecord(action, step.Path.Parts[0].Name)
+			ns.Field = step.Path.Parts[1].Name
+		}
+		ns.Value = n.exprToCEL(step.Value)
+	case "create":
+		ns.Entity = step.Target.Name
+		ns.Fields = make(map[string]string)
+		for _, m := range step.Mappings {
+			ns.Fields[m.Field.Name] = n.exprToCEL(m.Value)
+		}
+	default:
+		ns.Message = step.Target.Name
+	}
+	if step.Condition != nil {
+		ns.Condition = n.exprToCEL(step.Condition)
+	}
+	return ns
+}
+
 func (n *Normalizer) normalizeJobs(out *Output) {
 	for _, job := range n.file.Jobs {
 		nj := &NormalizedJob{
@@ -445,7 +617,32 @@ func (n *Normalizer) normalizeJobs(out *Output) {
 		}
 
 		if job.Effect != nil {
-			nj.Capabilities = append(nj.Capabilities, job.Effect.String())
+			if _, ok := n.scope.Imperatives[job.Effect.String()]; ok {
+				nj.Imperative = job.Effect.String()
+				nj.Capabilities = append(nj.Capabilities, "imperative.call")
+			} else {
+				nj.Capabilities = append(nj.Capabilities, job.Effect.String())
+			}
+		}
+
+		if job.Schedule != nil {
+			nj.Schedule = job.Schedule.Value
+		}
+
+		if job.Retry != nil {
+			nj.MaxAttempts = int(job.Retry.Value) + 1
+		}
+		if job.Backoff != nil && job.Backoff.Base != nil {
+			nj.Backoff = &NormalizedBackoff{
+				Strategy: job.Backoff.Strategy.Name,
+				Base:     job.Backoff.Base.Value,
+			}
+			if job.Backoff.Max != nil {
+				nj.Backoff.Max = job.Backoff.Max.Value
+			}
+		}
+		if job.Timeout != nil {
+			nj.Timeout = job.Timeout.Value
 		}
 
 		if job.Creates != nil {
@@ -461,6 +658,89 @@ func (n *Normalizer) normalizeJobs(out *Output) {
 	}
 }
 
+func (n *Normalizer) normalizeHooks(out *Output) {
+	for _, hook := range n.file.Hooks {
+		if len(hook.Target.Parts) < 2 {
+			continue
+		}
+
+		// Parse hook target like "Ticket.after_create"
+		nh := &NormalizedHook{
+			Entity:    hook.Target.Parts[0].Name,
+			Timing:    "after",
+			Operation: "create",
+		}
+		if timing, operation, ok := strings.Cut(hook.Target.Parts[1].Name, "_"); ok {
+			switch timing {
+			case "before", "after":
+				nh.Timing = timing
+			}
+			switch operation {
+			case "create", "update", "delete":
+				nh.Operation = operation
+			}
+		}
+
+		for _, action := range hook.Actions {
+			if action.Target == nil {
+				continue
+			}
+			if action.Kind == "enqueue" {
+				if action.Delay != nil {
+					nh.Delayed = append(nh.Delayed, &NormalizedDelayedJob{
+						Job:   action.Target.Name,
+						Delay: action.Delay.Value,
+					})
+				} else {
+					nh.Jobs = append(nh.Jobs, action.Target.Name)
+				}
+				continue
+			}
+
+			step := &NormalizedHookStep{
+				Kind:   action.Kind,
+				Target: action.Target.Name,
+			}
+			if action.Value != nil {
+				step.Value = n.exprToCEL(action.Value)
+			}
+			if action.Condition != nil {
+				step.Condition = n.exprToCEL(action.Condition)
+			}
+			nh.Steps = append(nh.Steps, step)
+		}
+
+		out.Hooks = append(out.Hooks, nh)
+	}
+}
+
+func (n *Normalizer) normalizePresences(out *Output) {
+	for _, presence := range n.file.Presences {
+		p, ok := n.scope.Presences[presence.Name.Name]
+		if !ok || p.Decl != presence {
+			continue
+		}
+
+		np := &NormalizedPresence{
+			Name:          p.Name,
+			Source:        p.Source,
+			SourceField:   p.SourceField,
+			Scope:         p.Scope,
+			ScopeEntity:   p.ScopeEntity,
+			ScopeRelation: p.ScopeRelation,
+			ScopeVia:      p.ScopeVia,
+		}
+		for _, field := range presence.Fields {
+			np.Fields = append(np.Fields, n.normalizeField(field))
+		}
+		if presence.TTL != nil {
+			np.TTL = presence.TTL.Value
+		}
+
+		out.Presences = append(out.Presences, np)
+	}
+}
+
 func (n *Normalizer) normalizeViews(out *Output) {
 	for _, view := range n.file.Views {
 		nv := &NormalizedView{
@@ -480,6 +760,7 @@ func (n *Normalizer) normalizeViews(out *Output) {
 		if view.Filter != nil {
 			nv.Filter = n.exprToCEL(view.Filter)
 			nv.Params = n.extractParams(view.Filter)
+			nv.ParamFields = paramFields(view.Filter, nv.Params)
 		}
 
 		// Normalize sort fields
@@ -534,6 +815,59 @@ func (n *Normalizer) extractParams(expr ast.Expr) []string {
 	return params
 }
 
+// paramFields returns the field each of params is compared with when expr is
+// nothing but `and`ed comparisons of a field with a param, such as
+// `channel == param.channel_id and author == param.user_id`. A row's fields
+// then decide which parameterization of the view it belongs to. It returns
+// nil for any other filter.
+func paramFields(expr ast.Expr, params []string) []string {
+	bound := make(map[string]string)
+	var walk func(ast.Expr) bool
+	walk = func(e ast.Expr) bool {
+		switch ex := e.(type) {
+		case *ast.ParenExpr:
+			return walk(ex.Inner)
+		case *ast.BinaryExpr:
+			switch ex.Op {
+			case token.AND:
+				return walk(ex.Left) && walk(ex.Right)
+			case token.EQ:
+				field, param := ex.Left, ex.Right
+				if _, ok := paramName(field); ok {
+					field, param = param, field
+				}
+				name, ok := paramName(param)
+				ident, isField := field.(*ast.Ident)
+				if !ok || !isField || bound[name] != "" {
+					return false
+				}
+				bound[name] = ident.Name
+				return true
+			}
+		}
+		return false
+	}
+	if len(params) == 0 || !walk(expr) {
+		return nil
+	}
+
+	fields := make([]string, len(params))
+	for i, name := range params {
+		fields[i] = bound[name]
+	}
+	return fields
+}
+
+// paramName returns the name of the param e refers to, as `param.org_id`
+// refers to org_id.
+func paramName(e ast.Expr) (string, bool) {
+	path, ok := e.(*ast.PathExpr)
+	if !ok || len(path.Parts) != 2 || path.Parts[0].Name != "param" {
+		return "", false
+	}
+	return path.Parts[1].Name, true
+}
+
 func (n *Normalizer) normalizeMessages(out *Output) {
 	for _, msg := range n.file.Messages {
 		md := &MessageDef{
@@ -554,6 +888,52 @@ func (n *Normalizer) normalizeMessages(out *Output) {
 	}
 }
 
+// normalizeMigrations resolves each migrate declaration's value map. Old
+// values that also exist in the new type and are not mapped explicitly keep
+// their value.
+func (n *Normalizer) normalizeMigrations(out *Output) {
+	for _, mig := range n.file.Migrations {
+		if mig.Target == nil || len(mig.Target.Parts) != 2 || mig.FromField == nil || mig.ToField == nil {
+			continue
+		}
+
+		nm := &NormalizedMigration{
+			Name:      mig.Target.String(),
+			Entity:    mig.Target.Parts[0].Name,
+			FromField: mig.FromField.Name,
+			ToField:   mig.ToField.Name,
+		}
+
+		mapped := make(map[string]bool)
+		for _, m := range mig.Mappings {
+			from, _ := m.From.(*ast.Ident)
+			to, _ := m.To.(*ast.Ident)
+			if from == nil || to == nil {
+				continue
+			}
+			nm.Mappings = append(nm.Mappings, &NormalizedValueMap{From: from.Name, To: to.Name})
+			mapped[from.Name] = true
+		}
+
+		var toValues []string
+		if mig.To != nil {
+			for _, v := range mig.To.EnumValues {
+				toValues = append(toValues, v.Name)
+			}
+		}
+		if mig.From != nil {
+			for _, v := range mig.From.EnumValues {
+				nm.FromValues = append(nm.FromValues, v.Name)
+				if !mapped[v.Name] && slices.Contains(toValues, v.Name) {
+					nm.Mappings = append(nm.Mappings, &NormalizedValueMap{From: v.Name, To: v.Name})
+				}
+			}
+		}
+
+		out.Migrations = append(out.Migrations, nm)
+	}
+}
+
 func (n *Normalizer) deriveImplicitEffects(out *Output) {
 	// Derive cascade delete rules from relations
 	for _, entity := range out.Entities {
@@ -612,6 +992,13 @@ func (n *Normalizer) exprToCEL(expr ast.Expr) string {
 	case *ast.ParenExpr:
 		return fmt.Sprintf("(%s)", n.exprToCEL(e.Inner))
 
+	case *ast.CallExpr:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = n.exprToCEL(arg)
+		}
+		return fmt.Sprintf("%s(%s)", n.exprToCEL(e.Func), strings.Join(args, ", "))
+
 	default:
 		return ""
 	}
@@ -627,7 +1014,10 @@ func (n *Normalizer) exprToSQL(expr ast.Expr, entityName string) string {
 		}
 		// Check if this is a relation field for the current entity
 		if entityName != "" && n.isRelation(entityName, e.Name) {
-			return e.Name + "_id"
+			if column := n.scope.Relations[entityName+"."+e.Name].Column; column != "" {
+				return column
+			}
+			return naming.ForeignKey(e.Name)
 		}
 		return e.Name
 
@@ -635,8 +1025,8 @@ func (n *Normalizer) exprToSQL(expr ast.Expr, entityName string) string {
 		// Handle path expressions for SQL
 		if len(e.Parts) > 0 && e.Parts[0].Name == "user" {
 			if len(e.Parts) > 1 {
-				return fmt.Sprintf("(SELECT %s FROM users WHERE id = current_setting('app.user_id')::uuid)",
-					e.Parts[1].Name)
+				return fmt.Sprintf("(SELECT %s FROM %s WHERE id = current_setting('app.user_id')::uuid)",
+					e.Parts[1].Name, n.scope.TableName("User"))
 			}
 			return "current_setting('app.user_id')::uuid"
 		}
@@ -671,7 +1061,7 @@ func (n *Normalizer) exprToSQL(expr ast.Expr, entityName string) string {
 		left := n.exprToSQL(e.Left, entityName)
 		// Handle "user in org.members" style expressions
 		// This generates a subquery to check membership
-		return n.inExprToSQL(left, e.Right)
+		return n.inExprToSQL(left, e.Right, entityName)
 
 	case *ast.ParenExpr:
 		return fmt.Sprintf("(%s)", n.exprToSQL(e.Inner, entityName))
@@ -686,13 +1076,16 @@ func (n *Normalizer) exprToSQL(expr ast.Expr, entityName string) string {
 //   - "user in members" -> user is in this entity's members
 //   - "user in org.members" -> user is in the org's members (for Ticket context)
 //   - "user in ticket.org.members" -> user is in the ticket's org's members (for Comment context)
-func (n *Normalizer) inExprToSQL(left string, right ast.Expr) string {
+func (n *Normalizer) inExprToSQL(left string, right ast.Expr, entityName string) string {
 	switch e := right.(type) {
 	case *ast.PathExpr:
 		parts := make([]string, len(e.Parts))
 		for i, p := range e.Parts {
 			parts[i] = p.Name
 		}
+		if sql, ok := n.relationMembership(left, entityName, parts); ok {
+			return sql
+		}
 
 		// Build nested subquery for path traversal
 		// For "org.members": SELECT members_id FROM organizations WHERE id = org_id
@@ -700,9 +1093,12 @@ func (n *Normalizer) inExprToSQL(left string, right ast.Expr) string {
 		return n.buildMembershipQuery(left, parts)
 
 	case *ast.Ident:
+		if sql, ok := n.relationMembership(left, entityName, []string{e.Name}); ok {
+			return sql
+		}
 		// Simple identifier like "members" - reference the FK column directly
 		// This means "user is one of this entity's members"
-		return fmt.Sprintf("(%s = %s_id)", left, e.Name)
+		return fmt.Sprintf("(%s = %s)", left, n.relationColumn(e.Name))
 
 	default:
 		// Fallback
@@ -711,6 +1107,51 @@ func (n *Normalizer) inExprToSQL(left string, right ast.Expr) string {
 	}
 }
 
+// relationMembership builds the membership check of userExpr along a path of
+// relations from a row of entityName, following many relations through their
+// join table. For Ticket and "org.members" it gives
+//
+//	(user IN (SELECT user_id FROM organization_members WHERE organization_id = tickets.org_id))
+//
+// It reports false when a part of the path is not a relation.
+func (n *Normalizer) relationMembership(userExpr, entityName string, path []string) (string, bool) {
+	if entityName == "" || len(path) == 0 {
+		return "", false
+	}
+
+	// ids selects the records reached so far: the row's own id, a single
+	// id, or a set of ids once a many relation was followed
+	table := n.scope.TableName(entityName)
+	ids, set := table+".id", false
+	entity := entityName
+	for i, name := range path {
+		rel, ok := n.scope.Relations[entity+"."+name]
+		if !ok {
+			return "", false
+		}
+		match := "= " + ids
+		if set {
+			match = "IN " + ids
+		}
+		switch {
+		case rel.IsMany:
+			joinTable, key, targetKey := rel.JoinTable()
+			ids = fmt.Sprintf("(SELECT %s FROM %s WHERE %s %s)", targetKey, joinTable, key, match)
+			set = true
+		case i == 0:
+			ids = fmt.Sprintf("%s.%s", table, rel.Column)
+		default:
+			ids = fmt.Sprintf("(SELECT %s FROM %s WHERE id %s)", rel.Column, n.scope.TableName(entity), match)
+		}
+		entity = rel.ToEntity
+	}
+
+	if set {
+		return fmt.Sprintf("(%s IN %s)", userExpr, ids), true
+	}
+	return fmt.Sprintf("(%s = %s)", userExpr, ids), true
+}
+
 // buildMembershipQuery builds a SQL subquery for checking membership along a relation path.
 func (n *Normalizer) buildMembershipQuery(userExpr string, path []string) string {
 	if len(path) == 0 {
@@ -724,7 +1165,7 @@ func (n *Normalizer) buildMembershipQuery(userExpr string, path []string) string
 
 	if len(entityPath) == 0 {
 		// Just "members" - check against members_id column directly
-		return fmt.Sprintf("(%s = %s_id)", userExpr, memberRelation)
+		return fmt.Sprintf("(%s = %s)", userExpr, n.relationColumn(memberRelation))
 	}
 
 	// Build the nested subquery
@@ -733,14 +1174,14 @@ func (n *Normalizer) buildMembershipQuery(userExpr string, path []string) string
 
 	// Start from the innermost entity and work outward
 	// The innermost is the first in the path (e.g., "org" or "ticket")
-	fkColumn := fmt.Sprintf("%s_id", entityPath[0])
+	fkColumn := n.relationColumn(entityPath[0])
 
 	if len(entityPath) == 1 {
 		// Single hop: "org.members"
 		// SQL: user IN (SELECT members_id FROM organizations WHERE id = org_id)
-		table := n.tableName(entityPath[0])
-		return fmt.Sprintf("(%s IN (SELECT %s_id FROM %s WHERE id = %s))",
-			userExpr, memberRelation, table, fkColumn)
+		table := n.relationTable(entityPath[0])
+		return fmt.Sprintf("(%s IN (SELECT %s FROM %s WHERE id = %s))",
+			userExpr, n.relationColumn(memberRelation), table, fkColumn)
 	}
 
 	// Multi-hop: "ticket.org.members"
@@ -748,28 +1189,49 @@ func (n *Normalizer) buildMembershipQuery(userExpr string, path []string) string
 	// SQL: user IN (SELECT members_id FROM organizations WHERE id = (SELECT org_id FROM tickets WHERE id = ticket_id))
 	innerQuery := fkColumn
 	for i := 1; i < len(entityPath); i++ {
-		prevTable := n.tableName(entityPath[i-1])
-		nextFK := fmt.Sprintf("%s_id", entityPath[i])
+		prevTable := n.relationTable(entityPath[i-1])
+		nextFK := n.relationColumn(entityPath[i])
 		innerQuery = fmt.Sprintf("(SELECT %s FROM %s WHERE id = %s)", nextFK, prevTable, innerQuery)
 	}
 
 	// Final query: check membership in the target relation
-	lastTable := n.tableName(entityPath[len(entityPath)-1])
-	return fmt.Sprintf("(%s IN (SELECT %s_id FROM %s WHERE id = %s))",
-		userExpr, memberRelation, lastTable, innerQuery)
+	lastTable := n.relationTable(entityPath[len(entityPath)-1])
+	return fmt.Sprintf("(%s IN (SELECT %s FROM %s WHERE id = %s))",
+		userExpr, n.relationColumn(memberRelation), lastTable, innerQuery)
 }
 
-// tableName converts an entity/relation name to its table name.
-// e.g., "org" -> "organizations", "ticket" -> "tickets"
-func (n *Normalizer) tableName(name string) string {
-	// Handle common abbreviations
-	switch name {
-	case "org":
-		return "organizations"
-	default:
-		// Simple pluralization
-		return name + "s"
+// relationNamed returns the relation declared under name, when every
+// relation of that name leads to the same entity.
+func (n *Normalizer) relationNamed(name string) (*analyzer.Relation, bool) {
+	var found *analyzer.Relation
+	for _, rel := range n.scope.Relations {
+		if rel.FromField != name {
+			continue
+		}
+		if found != nil && (found.ToEntity != rel.ToEntity || found.Column != rel.Column) {
+			return nil, false
+		}
+		found = rel
+	}
+	return found, found != nil
+}
+
+// relationTable returns the table of the entity a relation named name leads
+// to, e.g. "organizations" for org -> Organization.
+func (n *Normalizer) relationTable(name string) string {
+	if rel, ok := n.relationNamed(name); ok {
+		return n.scope.TableName(rel.ToEntity)
+	}
+	return naming.TableName(name)
+}
+
+// relationColumn returns the foreign key of a relation named name, e.g.
+// "org_id" for org.
+func (n *Normalizer) relationColumn(name string) string {
+	if rel, ok := n.relationNamed(name); ok && rel.Column != "" {
+		return rel.Column
 	}
+	return naming.ForeignKey(name)
 }
 
 // isRelation checks if a field name is a relation for the given entity.
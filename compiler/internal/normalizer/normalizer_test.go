@@ -459,3 +459,242 @@ entity Project {
 		}
 	}
 }
+
+func TestExprToSQL_ManyMembership(t *testing.T) {
+	source := `
+app Test {}
+
+entity User {
+  email: string
+}
+
+entity Organization {
+  name: string
+}
+
+entity Ticket {
+  subject: string
+}
+
+relation Organization.members -> User many
+relation Ticket.org -> Organization
+
+access Organization {
+  read: user in members
+}
+
+access Ticket {
+  read: user in org.members
+}
+`
+
+	p := parser.New(source, "test.forge")
+	file := p.ParseFile()
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("parse errors: %v", p.Diagnostics().Errors())
+	}
+	a := analyzer.New(file)
+	if diags := a.Analyze(); diags.HasErrors() {
+		t.Fatalf("analysis errors: %v", diags.Errors())
+	}
+	output, normDiags := New(file, a.Scope()).Normalize()
+	if normDiags.HasErrors() {
+		t.Fatalf("normalization errors: %v", normDiags.Errors())
+	}
+
+	want := map[string]string{
+		"Organization": "IN (SELECT user_id FROM organization_members WHERE organization_id = organizations.id))",
+		"Ticket":       "IN (SELECT user_id FROM organization_members WHERE organization_id = tickets.org_id))",
+	}
+	for _, access := range output.Access {
+		w, ok := want[access.Entity]
+		if !ok {
+			continue
+		}
+		delete(want, access.Entity)
+		if !strings.HasSuffix(access.ReadExpr, w) {
+			t.Errorf("%s read = %q, want it to end with %q", access.Entity, access.ReadExpr, w)
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("no access expressions for %v", want)
+	}
+
+	for _, entity := range output.Entities {
+		for _, rel := range entity.Relations {
+			if rel.Name == "members" && (rel.JoinTable != "organization_members" || rel.JoinKey != "organization_id" || rel.TargetKey != "user_id") {
+				t.Errorf("members join table = %s(%s, %s)", rel.JoinTable, rel.JoinKey, rel.TargetKey)
+			}
+		}
+	}
+}
+
+func TestExprToSQL_TableNames(t *testing.T) {
+	source := `
+app Test {}
+
+entity User {
+  email: string
+}
+
+entity Category {
+  name: string
+}
+
+entity Person {
+  @table: staff_people
+  name: string
+}
+
+relation Category.members -> User many
+relation Person.category -> Category @column: category_ref
+
+access Category {
+  read: user in members
+}
+
+access Person {
+  read: user in category.members or user == category
+}
+`
+
+	p := parser.New(source, "test.forge")
+	file := p.ParseFile()
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("parse errors: %v", p.Diagnostics().Errors())
+	}
+	a := analyzer.New(file)
+	if diags := a.Analyze(); diags.HasErrors() {
+		t.Fatalf("analysis errors: %v", diags.Errors())
+	}
+	output, normDiags := New(file, a.Scope()).Normalize()
+	if normDiags.HasErrors() {
+		t.Fatalf("normalization errors: %v", normDiags.Errors())
+	}
+
+	want := map[string]string{
+		"Category": "(SELECT user_id FROM category_members WHERE category_id = categories.id)",
+		"Person":   "(SELECT user_id FROM category_members WHERE category_id = staff_people.category_ref)",
+	}
+	for _, access := range output.Access {
+		w, ok := want[access.Entity]
+		if !ok {
+			continue
+		}
+		delete(want, access.Entity)
+		if !strings.Contains(access.ReadExpr, w) {
+			t.Errorf("%s read = %q, want it to contain %q", access.Entity, access.ReadExpr, w)
+		}
+		if access.Entity == "Person" && !strings.Contains(access.ReadExpr, "= category_ref)") {
+			t.Errorf("Person read = %q, want the relation compared by category_ref", access.ReadExpr)
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("no access expressions for %v", want)
+	}
+}
+
+func TestNormalizeAction_Steps(t *testing.T) {
+	source := `
+app Test {}
+
+entity Ticket {
+	status: enum(open, closed) = open
+}
+
+entity Comment {
+	body: string
+}
+
+relation Comment.ticket -> Ticket
+
+action close_ticket {
+	input {
+		ticket: Ticket
+		reason: string = ""
+	}
+	set Ticket.status = closed
+	create Comment { ticket: input.ticket, body: input.reason } if input.reason != ""
+}
+`
+	p := parser.New(source, "test.forge")
+	file := p.ParseFile()
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("parse errors: %v", p.Diagnostics().Errors())
+	}
+	a := analyzer.New(file)
+	if diags := a.Analyze(); diags.HasErrors() {
+		t.Fatalf("analysis errors: %v", diags.Errors())
+	}
+	output, normDiags := New(file, a.Scope()).Normalize()
+	if normDiags.HasErrors() {
+		t.Fatalf("normalization errors: %v", normDiags.Errors())
+	}
+
+	action := output.Actions[0]
+	if len(action.Input) != 2 {
+		t.Fatalf("expected 2 input fields, got %d", len(action.Input))
+	}
+	if ticket := action.Input[0]; ticket.Entity != "Ticket" || ticket.Field.Type != "uuid" {
+		t.Errorf("ticket input = %+v %+v, want a uuid referring to Ticket", ticket, ticket.Field)
+	}
+	if reason := action.Input[1]; reason.Entity != "" || reason.Field.Type != "text" || reason.Field.Default != "" {
+		t.Errorf("reason input = %+v %+v, want text defaulting to empty", reason, reason.Field)
+	}
+
+	if len(action.Steps) != 2 {
+		t.Fatalf("expected 2 steps, got %d", len(action.Steps))
+	}
+	set := action.Steps[0]
+	if set.Kind != "set" || set.Entity != "Ticket" || set.Record != "ticket" || set.Field != "status" || set.Value != "closed" {
+		t.Errorf("set step = %+v, want ticket.status = closed", set)
+	}
+	create := action.Steps[1]
+	if create.Kind != "create" || create.Entity != "Comment" || create.Fields["ticket"] != "input.ticket" || create.Condition != `(input.reason != "")` {
+		t.Errorf("create step = %+v", create)
+	}
+}
+
+func TestNormalizeField_Visibility(t *testing.T) {
+	source := `
+app Test {}
+
+entity User {
+  role: enum(agent, admin)
+  password_hash: string hidden
+  ssn: string read: user.role == admin
+}
+`
+
+	p := parser.New(source, "test.forge")
+	file := p.ParseFile()
+	if p.Diagnostics().HasErrors() {
+		t.Fatalf("parse errors: %v", p.Diagnostics().Errors())
+	}
+
+	a := analyzer.New(file)
+	diags := a.Analyze()
+	if diags.HasErrors() {
+		t.Fatalf("analysis errors: %v", diags.Errors())
+	}
+
+	n := New(file, a.Scope())
+	output, normDiags := n.Normalize()
+	if normDiags.HasErrors() {
+		t.Fatalf("normalization errors: %v", normDiags.Errors())
+	}
+
+	fields := map[string]*NormalizedField{}
+	for _, field := range output.Entities[0].Fields {
+		fields[field.Name] = field
+	}
+	if !fields["password_hash"].Hidden || fields["password_hash"].Read != "" {
+		t.Errorf("password_hash = %+v, want hidden", fields["password_hash"])
+	}
+	if fields["ssn"].Hidden || fields["ssn"].Read != "(user.role == admin)" {
+		t.Errorf("ssn read = %q, want %q", fields["ssn"].Read, "(user.role == admin)")
+	}
+	if fields["role"].Hidden || fields["role"].Read != "" {
+		t.Errorf("role = %+v, want a plain field", fields["role"])
+	}
+}
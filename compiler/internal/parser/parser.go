@@ -5,6 +5,8 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/forge-lang/forge/compiler/internal/ast"
 	"github.com/forge-lang/forge/compiler/internal/diag"
@@ -67,6 +69,7 @@ func New(input, filename string) *Parser {
 
 	p.prefixParseFns = make(map[token.Type]func() ast.Expr)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
+	p.registerPrefix(token.INPUT, p.parseIdentifier) // input.field in conditions
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
 	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
@@ -191,6 +194,8 @@ func (p *Parser) ParseFile() *ast.File {
 				file.Hooks = append(file.Hooks, d)
 			case *ast.ViewDecl:
 				file.Views = append(file.Views, d)
+			case *ast.PresenceDecl:
+				file.Presences = append(file.Presences, d)
 			case *ast.WebhookDecl:
 				file.Webhooks = append(file.Webhooks, d)
 			case *ast.ImperativeDecl:
@@ -229,6 +234,8 @@ func (p *Parser) parseDeclaration() ast.Decl {
 		return p.parseHookDecl()
 	case token.VIEW:
 		return p.parseViewDecl()
+	case token.PRESENCE:
+		return p.parsePresenceDecl()
 	case token.WEBHOOK:
 		return p.parseWebhookDecl()
 	case token.IMPERATIVE:
@@ -279,6 +286,13 @@ func (p *Parser) parseEntityDecl() *ast.EntityDecl {
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		if p.curTokenIs(token.AT) {
+			if name, value := p.parseAnnotation("table"); name != "" {
+				decl.Table = value
+			}
+			p.nextToken()
+			continue
+		}
 		field := p.parseFieldDecl()
 		if field != nil {
 			decl.Fields = append(decl.Fields, field)
@@ -290,6 +304,26 @@ func (p *Parser) parseEntityDecl() *ast.EntityDecl {
 	return decl
 }
 
+// parseAnnotation parses: @name: value, where name is one of allowed. It
+// returns an empty name when the annotation is invalid.
+func (p *Parser) parseAnnotation(allowed ...string) (string, *ast.Ident) {
+	if !p.expectPeek(token.IDENT) {
+		return "", nil
+	}
+	name := p.curToken
+	if !p.expectPeek(token.COLON) || !p.expectPeek(token.IDENT) {
+		return "", nil
+	}
+	for _, a := range allowed {
+		if a == name.Literal {
+			return name.Literal, p.parseIdent()
+		}
+	}
+	p.diag.AddErrorAt(name.Pos, diag.ErrInvalidAnnotation,
+		fmt.Sprintf("unknown annotation @%s, expected @%s", name.Literal, strings.Join(allowed, ", @")))
+	return "", nil
+}
+
 func (p *Parser) parseFieldDecl() *ast.FieldDecl {
 	if !p.curTokenIs(token.IDENT) {
 		return nil
@@ -305,26 +339,56 @@ func (p *Parser) parseFieldDecl() *ast.FieldDecl {
 	p.nextToken()
 	field.Type = p.parseTypeExpr()
 
-	// Parse optional constraints
-	for p.peekTokenIs(token.LENGTH) || p.peekTokenIs(token.UNIQUE) {
+	// Parse optional constraints and modifiers
+	for p.peekTokenIs(token.LENGTH) || p.peekTokenIs(token.UNIQUE) || p.peekIsFieldModifier() {
 		p.nextToken()
-		constraint := p.parseConstraint()
-		if constraint != nil {
-			field.Constraints = append(field.Constraints, constraint)
+		if p.curTokenIs(token.LENGTH) || p.curTokenIs(token.UNIQUE) {
+			if constraint := p.parseConstraint(); constraint != nil {
+				field.Constraints = append(field.Constraints, constraint)
+			}
+			continue
 		}
+		p.parseFieldModifier(field)
 	}
 
-	// Parse optional default value
+	// Parse optional default value, which modifiers may follow
 	if p.peekTokenIs(token.ASSIGN) {
 		p.nextToken()
 		p.nextToken()
 		field.Default = p.parseExpression(LOWEST)
+		for p.peekIsFieldModifier() {
+			p.nextToken()
+			p.parseFieldModifier(field)
+		}
 	}
 
 	field.EndPos = p.curToken.End
 	return field
 }
 
+// peekIsFieldModifier reports whether the next token starts a field
+// modifier: hidden or read: <condition>. A modifier is on the line of its
+// field, so that a field named hidden on the next line is not taken for one.
+func (p *Parser) peekIsFieldModifier() bool {
+	if p.peekToken.Pos.Line != p.curToken.Pos.Line {
+		return false
+	}
+	return p.peekTokenIs(token.READ) || (p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "hidden")
+}
+
+// parseFieldModifier parses: hidden | read: <condition>
+func (p *Parser) parseFieldModifier(field *ast.FieldDecl) {
+	if p.curTokenIs(token.IDENT) {
+		field.Hidden = true
+		return
+	}
+	if !p.expectPeek(token.COLON) {
+		return
+	}
+	p.nextToken()
+	field.Read = p.parseExpression(LOWEST)
+}
+
 func (p *Parser) parseTypeExpr() *ast.TypeExpr {
 	typeExpr := &ast.TypeExpr{StartPos: p.curToken.Pos}
 
@@ -410,6 +474,13 @@ func (p *Parser) parseRelationDecl() *ast.RelationDecl {
 		decl.Many = true
 	}
 
+	if p.peekTokenIs(token.AT) && p.peekToken.Pos.Line == p.curToken.Pos.Line {
+		p.nextToken()
+		if name, value := p.parseAnnotation("column"); name != "" {
+			decl.Column = value
+		}
+	}
+
 	decl.EndPos = p.curToken.End
 	return decl
 }
@@ -507,7 +578,7 @@ func (p *Parser) parseAccessDecl() *ast.AccessDecl {
 	return decl
 }
 
-// parseActionDecl parses: action name { properties... }
+// parseActionDecl parses: action name { properties..., input { fields... }, steps... }
 func (p *Parser) parseActionDecl() *ast.ActionDecl {
 	decl := &ast.ActionDecl{StartPos: p.curToken.Pos}
 
@@ -520,12 +591,125 @@ func (p *Parser) parseActionDecl() *ast.ActionDecl {
 		return nil
 	}
 
-	decl.Properties = p.parseProperties()
-	decl.EndPos = p.curToken.End
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		switch {
+		case p.curTokenIs(token.INPUT) && p.peekTokenIs(token.LBRACE):
+			decl.Input = p.parseActionInput()
 
+		case p.isActionStepStart():
+			if step := p.parseActionStep(); step != nil {
+				decl.Steps = append(decl.Steps, step)
+			}
+
+		case p.curTokenIs(token.IDENT) || p.curToken.Type.IsKeyword():
+			prop := &ast.Property{StartPos: p.curToken.Pos}
+			prop.Key = &ast.Ident{
+				Name:     p.curToken.Literal,
+				StartPos: p.curToken.Pos,
+				EndPos:   p.curToken.End,
+			}
+			if !p.expectPeek(token.COLON) {
+				p.nextToken()
+				continue
+			}
+			p.nextToken()
+			prop.Value = p.parseExpression(LOWEST)
+			prop.EndPos = p.curToken.End
+			decl.Properties = append(decl.Properties, prop)
+		}
+		p.nextToken()
+	}
+
+	decl.EndPos = p.curToken.End
 	return decl
 }
 
+// isActionStepStart reports whether the current token begins an action
+// step rather than a property with the same name.
+func (p *Parser) isActionStepStart() bool {
+	if p.peekTokenIs(token.COLON) {
+		return false
+	}
+	switch p.curToken.Type {
+	case token.CREATE, token.EMIT, token.REJECT:
+		return true
+	case token.IDENT:
+		return p.curToken.Literal == "set"
+	}
+	return false
+}
+
+// parseActionInput parses: input { field: type ... }
+func (p *Parser) parseActionInput() *ast.ActionInput {
+	input := &ast.ActionInput{StartPos: p.curToken.Pos}
+	p.nextToken()
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		if field := p.parseFieldDecl(); field != nil {
+			input.Fields = append(input.Fields, field)
+		}
+		p.nextToken()
+	}
+
+	input.EndPos = p.curToken.End
+	return input
+}
+
+// parseActionStep parses one action statement:
+//
+//	set record.field = expr [if expr]
+//	create Entity { field: expr, ... } [if expr]
+//	emit MESSAGE_CODE [if expr]
+//	reject MESSAGE_CODE [if expr]
+func (p *Parser) parseActionStep() *ast.ActionStep {
+	step := &ast.ActionStep{StartPos: p.curToken.Pos}
+
+	switch p.curToken.Type {
+	case token.CREATE:
+		step.Kind = "create"
+	case token.EMIT:
+		step.Kind = "emit"
+	case token.REJECT:
+		step.Kind = "reject"
+	default:
+		step.Kind = "set"
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	switch step.Kind {
+	case "set":
+		step.Path = p.parsePathExpr()
+		if !p.expectPeek(token.ASSIGN) {
+			return nil
+		}
+		p.nextToken()
+		step.Value = p.parseExpression(LOWEST)
+
+	case "create":
+		clause := p.parseJobCreatesClause()
+		step.Target = clause.Entity
+		step.Mappings = clause.Mappings
+
+	default:
+		step.Target = p.parseIdent()
+	}
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		step.Condition = p.parseExpression(LOWEST)
+	}
+
+	step.EndPos = p.curToken.End
+	return step
+}
+
 // parseMessageDecl parses: message CODE { level: x, default: "..." }
 func (p *Parser) parseMessageDecl() *ast.MessageDecl {
 	decl := &ast.MessageDecl{StartPos: p.curToken.Pos}
@@ -616,7 +800,8 @@ func (p *Parser) parseJobDecl() *ast.JobDecl {
 			decl.Effect = p.parsePathExpr()
 
 		case token.IDENT:
-			if p.curToken.Literal == "creates" {
+			switch p.curToken.Literal {
+			case "creates":
 				if !p.expectPeek(token.COLON) {
 					p.nextToken()
 					continue
@@ -626,6 +811,48 @@ func (p *Parser) parseJobDecl() *ast.JobDecl {
 					continue
 				}
 				decl.Creates = p.parseJobCreatesClause()
+			case "schedule":
+				if !p.expectPeek(token.COLON) {
+					p.nextToken()
+					continue
+				}
+				if !p.expectPeek(token.STRING) {
+					p.nextToken()
+					continue
+				}
+				decl.Schedule = p.parseStringLiteral().(*ast.StringLit)
+			case "retry":
+				if !p.expectPeek(token.COLON) {
+					p.nextToken()
+					continue
+				}
+				if !p.expectPeek(token.INT) {
+					p.nextToken()
+					continue
+				}
+				if lit, ok := p.parseIntegerLiteral().(*ast.IntLit); ok {
+					decl.Retry = lit
+				}
+			case "backoff":
+				if !p.expectPeek(token.COLON) {
+					p.nextToken()
+					continue
+				}
+				if !p.expectPeek(token.IDENT) {
+					p.nextToken()
+					continue
+				}
+				decl.Backoff = p.parseBackoffSpec()
+			case "timeout":
+				if !p.expectPeek(token.COLON) {
+					p.nextToken()
+					continue
+				}
+				if !p.expectPeek(token.DURATION) {
+					p.nextToken()
+					continue
+				}
+				decl.Timeout = p.parseDurationLiteral()
 			}
 		}
 		p.nextToken()
@@ -635,6 +862,43 @@ func (p *Parser) parseJobDecl() *ast.JobDecl {
 	return decl
 }
 
+// parseBackoffSpec parses: strategy(base[, max limit])
+// Called with the strategy IDENT as the current token.
+func (p *Parser) parseBackoffSpec() *ast.BackoffSpec {
+	spec := &ast.BackoffSpec{StartPos: p.curToken.Pos}
+	spec.Strategy = p.parseIdent()
+
+	if !p.expectPeek(token.LPAREN) {
+		return spec
+	}
+	if !p.expectPeek(token.DURATION) {
+		return spec
+	}
+	spec.Base = p.parseDurationLiteral()
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return spec
+		}
+		if p.curToken.Literal != "max" {
+			p.diag.AddErrorAt(p.curToken.Pos, diag.ErrUnexpectedToken,
+				fmt.Sprintf("expected max, got %s", p.curToken.Literal))
+			return spec
+		}
+		if !p.expectPeek(token.DURATION) {
+			return spec
+		}
+		spec.Max = p.parseDurationLiteral()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return spec
+	}
+	spec.EndPos = p.curToken.End
+	return spec
+}
+
 func (p *Parser) parseNeedsClause() *ast.NeedsClause {
 	clause := &ast.NeedsClause{StartPos: p.curToken.Pos}
 	clause.Path = p.parsePathExpr()
@@ -701,16 +965,8 @@ func (p *Parser) parseHookDecl() *ast.HookDecl {
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-		if p.curTokenIs(token.IDENT) && p.curToken.Literal == "enqueue" {
-			action := &ast.HookAction{
-				Kind:     "enqueue",
-				StartPos: p.curToken.Pos,
-			}
-			if p.expectPeek(token.IDENT) {
-				action.Target = p.parseIdent()
-				action.EndPos = p.curToken.End
-				decl.Actions = append(decl.Actions, action)
-			}
+		if action := p.parseHookAction(); action != nil {
+			decl.Actions = append(decl.Actions, action)
 		}
 		p.nextToken()
 	}
@@ -719,6 +975,63 @@ func (p *Parser) parseHookDecl() *ast.HookDecl {
 	return decl
 }
 
+// parseHookAction parses one hook statement:
+//
+//	enqueue job_name [in duration]
+//	emit MESSAGE_CODE [if expr]
+//	reject MESSAGE_CODE [if expr]
+//	set field = expr [if expr]
+func (p *Parser) parseHookAction() *ast.HookAction {
+	action := &ast.HookAction{StartPos: p.curToken.Pos}
+
+	switch {
+	case p.curTokenIs(token.IDENT) && p.curToken.Literal == "enqueue":
+		action.Kind = "enqueue"
+	case p.curTokenIs(token.EMIT):
+		action.Kind = "emit"
+	case p.curTokenIs(token.REJECT):
+		action.Kind = "reject"
+	case p.curTokenIs(token.IDENT) && p.curToken.Literal == "set":
+		action.Kind = "set"
+	default:
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	action.Target = p.parseIdent()
+
+	if action.Kind == "enqueue" {
+		if p.peekTokenIs(token.IN) {
+			p.nextToken()
+			if !p.expectPeek(token.DURATION) {
+				return nil
+			}
+			action.Delay = p.parseDurationLiteral()
+		}
+		action.EndPos = p.curToken.End
+		return action
+	}
+
+	if action.Kind == "set" {
+		if !p.expectPeek(token.ASSIGN) {
+			return nil
+		}
+		p.nextToken()
+		action.Value = p.parseExpression(LOWEST)
+	}
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		action.Condition = p.parseExpression(LOWEST)
+	}
+
+	action.EndPos = p.curToken.End
+	return action
+}
+
 // parseViewDecl parses: view Name { source: Entity, fields: f1, f2, filter: expr, sort: -f1, f2 }
 func (p *Parser) parseViewDecl() *ast.ViewDecl {
 	decl := &ast.ViewDecl{StartPos: p.curToken.Pos}
@@ -778,6 +1091,68 @@ func (p *Parser) parseViewDecl() *ast.ViewDecl {
 	return decl
 }
 
+// parsePresenceDecl parses: presence Name { source: Entity, fields..., ttl: d, scope: rel }
+func (p *Parser) parsePresenceDecl() *ast.PresenceDecl {
+	decl := &ast.PresenceDecl{StartPos: p.curToken.Pos}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	decl.Name = p.parseIdent()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		switch {
+		case p.curTokenIs(token.SOURCE):
+			if !p.expectPeek(token.COLON) {
+				p.nextToken()
+				continue
+			}
+			if !p.expectPeek(token.IDENT) {
+				p.nextToken()
+				continue
+			}
+			decl.Source = p.parseIdent()
+
+		case p.curTokenIs(token.IDENT) && p.curToken.Literal == "ttl":
+			if !p.expectPeek(token.COLON) {
+				p.nextToken()
+				continue
+			}
+			if !p.expectPeek(token.DURATION) {
+				p.nextToken()
+				continue
+			}
+			decl.TTL = p.parseDurationLiteral()
+
+		case p.curTokenIs(token.IDENT) && p.curToken.Literal == "scope":
+			if !p.expectPeek(token.COLON) {
+				p.nextToken()
+				continue
+			}
+			if !p.expectPeek(token.IDENT) {
+				p.nextToken()
+				continue
+			}
+			decl.Scope = p.parseIdent()
+
+		default:
+			if field := p.parseFieldDecl(); field != nil {
+				decl.Fields = append(decl.Fields, field)
+			}
+		}
+		p.nextToken()
+	}
+
+	decl.EndPos = p.curToken.End
+	return decl
+}
+
 // parseViewFieldList parses a comma-separated list of field names,
 // including dotted paths like author.name, author.avatar_url.
 func (p *Parser) parseViewFieldList() []*ast.Ident {
@@ -964,7 +1339,7 @@ func (p *Parser) parseEventList() []*ast.Ident {
 	return events
 }
 
-// parseImperativeDecl parses: imperative name { input: x, returns: y }
+// parseImperativeDecl parses: imperative name { input: x, returns: y, effects: [a.b] }
 func (p *Parser) parseImperativeDecl() *ast.ImperativeDecl {
 	decl := &ast.ImperativeDecl{StartPos: p.curToken.Pos}
 
@@ -997,11 +1372,33 @@ func (p *Parser) parseImperativeDecl() *ast.ImperativeDecl {
 				p.nextToken()
 				continue
 			}
-			if !p.expectPeek(token.IDENT) {
+			p.nextToken()
+			// Builtin type keywords such as file are valid return types.
+			if !p.curTokenIs(token.IDENT) && !(p.curToken.Type >= token.STRING_TYPE && p.curToken.Type <= token.FILE_TYPE) {
+				p.diag.AddErrorAt(p.curToken.Pos, diag.ErrExpectedType,
+					fmt.Sprintf("expected return type, got %s", p.curToken.Type))
 				p.nextToken()
 				continue
 			}
-			decl.Returns = p.parseIdent()
+			decl.Returns = &ast.Ident{
+				Name:     p.curToken.Literal,
+				StartPos: p.curToken.Pos,
+				EndPos:   p.curToken.End,
+			}
+
+		case token.IDENT:
+			if p.curToken.Literal == "effects" {
+				if !p.expectPeek(token.COLON) {
+					p.nextToken()
+					continue
+				}
+				if !p.expectPeek(token.LBRACKET) {
+					p.nextToken()
+					continue
+				}
+				p.nextToken()
+				decl.Effects = p.parseEventList()
+			}
 		}
 		p.nextToken()
 	}
@@ -1010,7 +1407,7 @@ func (p *Parser) parseImperativeDecl() *ast.ImperativeDecl {
 	return decl
 }
 
-// parseMigrateDecl parses: migrate Entity.version { from: ..., to: ..., map: ... }
+// parseMigrateDecl parses: migrate Entity.version { from: field type, to: field type, map: ... }
 func (p *Parser) parseMigrateDecl() *ast.MigrateDecl {
 	decl := &ast.MigrateDecl{StartPos: p.curToken.Pos}
 
@@ -1031,6 +1428,7 @@ func (p *Parser) parseMigrateDecl() *ast.MigrateDecl {
 				continue
 			}
 			p.nextToken()
+			decl.FromField = p.parseMigrateField()
 			decl.From = p.parseTypeExpr()
 
 		case token.TO:
@@ -1039,6 +1437,7 @@ func (p *Parser) parseMigrateDecl() *ast.MigrateDecl {
 				continue
 			}
 			p.nextToken()
+			decl.ToField = p.parseMigrateField()
 			decl.To = p.parseTypeExpr()
 
 		case token.MAP:
@@ -1065,6 +1464,17 @@ func (p *Parser) parseMigrateDecl() *ast.MigrateDecl {
 	return decl
 }
 
+// parseMigrateField parses the optional field name in front of a migration
+// type, as in "from: plan enum(free, pro)", and advances to the type.
+func (p *Parser) parseMigrateField() *ast.Ident {
+	if !p.curTokenIs(token.IDENT) || !(p.peekTokenIs(token.ENUM) || p.peekTokenIs(token.IDENT)) {
+		return nil
+	}
+	field := p.parseIdent()
+	p.nextToken()
+	return field
+}
+
 func (p *Parser) parseMapClause() *ast.MapClause {
 	if !p.curTokenIs(token.IDENT) {
 		return nil
@@ -1322,6 +1732,44 @@ func (p *Parser) parseFloatLiteral() ast.Expr {
 	}
 }
 
+// parseDurationLiteral parses a DURATION token such as 30s, 24h or 1h30m.
+// The d unit is 24 hours.
+func (p *Parser) parseDurationLiteral() *ast.DurationLit {
+	lit := &ast.DurationLit{
+		Literal:  p.curToken.Literal,
+		StartPos: p.curToken.Pos,
+		EndPos:   p.curToken.End,
+	}
+
+	rest := p.curToken.Literal
+	for rest != "" {
+		i := strings.IndexFunc(rest, func(r rune) bool { return r < '0' || r > '9' })
+		n, err := strconv.ParseInt(rest[:i], 10, 64)
+		if err != nil {
+			p.diag.AddErrorAt(p.curToken.Pos, diag.ErrInvalidNumber,
+				fmt.Sprintf("invalid duration literal: %s", p.curToken.Literal))
+			return lit
+		}
+		rest = rest[i:]
+
+		var unit time.Duration
+		switch {
+		case strings.HasPrefix(rest, "ms"):
+			unit, rest = time.Millisecond, rest[2:]
+		case rest[0] == 's':
+			unit, rest = time.Second, rest[1:]
+		case rest[0] == 'm':
+			unit, rest = time.Minute, rest[1:]
+		case rest[0] == 'h':
+			unit, rest = time.Hour, rest[1:]
+		default: // 'd'
+			unit, rest = 24*time.Hour, rest[1:]
+		}
+		lit.Value += time.Duration(n) * unit
+	}
+	return lit
+}
+
 func (p *Parser) parseStringLiteral() ast.Expr {
 	return &ast.StringLit{
 		Value:    p.curToken.Literal,
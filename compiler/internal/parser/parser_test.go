@@ -2,8 +2,11 @@ package parser
 
 import (
 	"testing"
+	"time"
 
 	"github.com/forge-lang/forge/compiler/internal/ast"
+	"github.com/forge-lang/forge/compiler/internal/diag"
+	"github.com/forge-lang/forge/compiler/internal/token"
 )
 
 func TestParser_AppDecl(t *testing.T) {
@@ -85,6 +88,88 @@ func TestParser_EntityDecl(t *testing.T) {
 	}
 }
 
+func TestParser_FieldModifiers(t *testing.T) {
+	input := `entity User {
+		password_hash: string hidden
+		ssn: string length <= 11 read: user.role == admin
+		tier: enum(free, pro) = free read: user == owner hidden
+		hidden: bool
+	}`
+
+	file, diags := Parse(input, "test.forge")
+
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %v", diags.Errors())
+	}
+
+	fields := file.Entities[0].Fields
+	if len(fields) != 4 {
+		t.Fatalf("expected 4 fields, got %d", len(fields))
+	}
+
+	if password := fields[0]; !password.Hidden || password.Read != nil {
+		t.Errorf("expected password_hash to be hidden, got %#v", password)
+	}
+
+	ssn := fields[1]
+	if ssn.Hidden || len(ssn.Constraints) != 1 {
+		t.Errorf("expected ssn with a length constraint, got %#v", ssn)
+	}
+	if cond, ok := ssn.Read.(*ast.BinaryExpr); !ok || cond.Op != token.EQ {
+		t.Errorf("expected read condition user.role == admin, got %#v", ssn.Read)
+	}
+
+	if tier := fields[2]; tier.Default == nil || tier.Read == nil || !tier.Hidden {
+		t.Errorf("expected modifiers after the default of tier, got %#v", tier)
+	}
+
+	// A field named hidden on its own line is a field, not a modifier
+	if f := fields[3]; f.Name.Name != "hidden" || f.Type.Name.Name != "bool" {
+		t.Errorf("expected field hidden: bool, got %s: %s", f.Name.Name, f.Type.Name.Name)
+	}
+}
+
+func TestParser_Annotations(t *testing.T) {
+	input := `entity Person {
+		@table: people
+		name: string
+	}
+
+	relation Ticket.author -> Person @column: created_by
+	relation Ticket.watchers -> Person many
+	`
+
+	file, diags := Parse(input, "test.forge")
+
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %v", diags.Errors())
+	}
+
+	person := file.Entities[0]
+	if person.Table == nil || person.Table.Name != "people" {
+		t.Errorf("expected table people, got %#v", person.Table)
+	}
+	if len(person.Fields) != 1 || person.Fields[0].Name.Name != "name" {
+		t.Errorf("expected the field name after the annotation, got %d fields", len(person.Fields))
+	}
+
+	if column := file.Relations[0].Column; column == nil || column.Name != "created_by" {
+		t.Errorf("expected column created_by, got %#v", column)
+	}
+	if column := file.Relations[1].Column; column != nil {
+		t.Errorf("expected no column, got %#v", column)
+	}
+}
+
+func TestParser_UnknownAnnotation(t *testing.T) {
+	_, diags := Parse("entity Person {\n\t@schema: legacy\n}", "test.forge")
+
+	errs := diags.Errors()
+	if len(errs) != 1 || errs[0].Code != diag.ErrInvalidAnnotation {
+		t.Fatalf("expected one %s error, got %v", diag.ErrInvalidAnnotation, errs)
+	}
+}
+
 func TestParser_RelationDecl(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -222,6 +307,66 @@ func TestParser_ActionDecl(t *testing.T) {
 	}
 }
 
+func TestParser_ActionSteps(t *testing.T) {
+	input := `action close_ticket {
+		input {
+			ticket: Ticket
+			reason: string
+		}
+		reject TICKET_CLOSED if ticket.status == closed
+		set ticket.status = closed
+		create Comment { ticket: input.ticket, body: input.reason } if input.reason != ""
+		emit TICKET_CLOSED_OK
+	}`
+
+	file, diags := Parse(input, "test.forge")
+
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %v", diags.Errors())
+	}
+
+	action := file.Actions[0]
+	if len(action.Properties) != 0 {
+		t.Errorf("expected no properties, got %d", len(action.Properties))
+	}
+	if action.Input == nil || len(action.Input.Fields) != 2 {
+		t.Fatalf("expected 2 input fields, got %#v", action.Input)
+	}
+	if f := action.Input.Fields[0]; f.Name.Name != "ticket" || f.Type.Name.Name != "Ticket" {
+		t.Errorf("expected ticket: Ticket, got %s: %s", f.Name.Name, f.Type.Name.Name)
+	}
+
+	if len(action.Steps) != 4 {
+		t.Fatalf("expected 4 steps, got %d", len(action.Steps))
+	}
+
+	reject := action.Steps[0]
+	if reject.Kind != "reject" || reject.Target.Name != "TICKET_CLOSED" || reject.Condition == nil {
+		t.Errorf("expected conditional reject TICKET_CLOSED, got %#v", reject)
+	}
+
+	set := action.Steps[1]
+	if set.Kind != "set" || set.Path.String() != "ticket.status" {
+		t.Errorf("expected set ticket.status, got %s %v", set.Kind, set.Path)
+	}
+	if ident, ok := set.Value.(*ast.Ident); !ok || ident.Name != "closed" {
+		t.Errorf("expected set value 'closed', got %#v", set.Value)
+	}
+
+	create := action.Steps[2]
+	if create.Kind != "create" || create.Target.Name != "Comment" || len(create.Mappings) != 2 {
+		t.Errorf("expected create Comment with 2 fields, got %#v", create)
+	}
+	if create.Condition == nil {
+		t.Error("expected create condition")
+	}
+
+	emit := action.Steps[3]
+	if emit.Kind != "emit" || emit.Target.Name != "TICKET_CLOSED_OK" || emit.Condition != nil {
+		t.Errorf("expected unconditional emit TICKET_CLOSED_OK, got %#v", emit)
+	}
+}
+
 func TestParser_MessageDecl(t *testing.T) {
 	input := `message TICKET_CLOSED {
 		level: error
@@ -314,6 +459,140 @@ func TestParser_HookDecl(t *testing.T) {
 	}
 }
 
+func TestParser_ScheduledJobAndDelayedEnqueue(t *testing.T) {
+	input := `job nightly_digest {
+		schedule: "0 7 * * *"
+		effect: email.send
+	}
+
+	hook Ticket.after_create {
+		enqueue notify_agent
+		enqueue remind_agent in 1h30m
+	}`
+
+	file, diags := Parse(input, "test.forge")
+
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %v", diags.Errors())
+	}
+
+	if job := file.Jobs[0]; job.Schedule == nil || job.Schedule.Value != "0 7 * * *" {
+		t.Errorf("expected schedule '0 7 * * *', got %#v", job.Schedule)
+	}
+
+	actions := file.Hooks[0].Actions
+	if len(actions) != 2 {
+		t.Fatalf("expected 2 actions, got %d", len(actions))
+	}
+	if actions[0].Delay != nil {
+		t.Errorf("expected no delay on plain enqueue, got %v", actions[0].Delay.Value)
+	}
+	if d := actions[1].Delay; d == nil || d.Value != 90*time.Minute || d.Literal != "1h30m" {
+		t.Errorf("expected delay 1h30m, got %#v", d)
+	}
+}
+
+func TestParser_JobRetryPolicy(t *testing.T) {
+	input := `job sync_to_crm {
+		effect: http.call
+		retry: 5
+		backoff: exponential(2s, max 10m)
+		timeout: 2m
+	}
+
+	job ping {
+		effect: http.call
+		backoff: fixed(30s)
+	}`
+
+	file, diags := Parse(input, "test.forge")
+
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %v", diags.Errors())
+	}
+
+	job := file.Jobs[0]
+	if job.Retry == nil || job.Retry.Value != 5 {
+		t.Errorf("expected retry 5, got %#v", job.Retry)
+	}
+	if job.Timeout == nil || job.Timeout.Value != 2*time.Minute {
+		t.Errorf("expected timeout 2m, got %#v", job.Timeout)
+	}
+	b := job.Backoff
+	if b == nil || b.Strategy.Name != "exponential" || b.Base.Value != 2*time.Second || b.Max == nil || b.Max.Value != 10*time.Minute {
+		t.Fatalf("expected exponential(2s, max 10m), got %#v", b)
+	}
+
+	b = file.Jobs[1].Backoff
+	if b == nil || b.Strategy.Name != "fixed" || b.Base.Value != 30*time.Second || b.Max != nil {
+		t.Errorf("expected fixed(30s), got %#v", b)
+	}
+}
+
+func TestParser_JobBackoffErrors(t *testing.T) {
+	for _, src := range []string{
+		"job j {\n\tbackoff: exponential(2s, limit 10m)\n}",
+		"job j {\n\tbackoff: exponential(2)\n}",
+		"job j {\n\ttimeout: 120\n}",
+	} {
+		if _, diags := Parse(src, "test.forge"); !diags.HasErrors() {
+			t.Errorf("expected parse error for %q", src)
+		}
+	}
+}
+
+func TestParser_BeforeHookSteps(t *testing.T) {
+	input := `hook Ticket.before_create {
+		reject MAINTENANCE if org.maintenance == true
+		set priority = high if input.subject == "urgent"
+		emit TICKET_RECEIVED
+	}`
+
+	file, diags := Parse(input, "test.forge")
+
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %v", diags.Errors())
+	}
+
+	if len(file.Hooks) != 1 {
+		t.Fatalf("expected 1 hook, got %d", len(file.Hooks))
+	}
+
+	actions := file.Hooks[0].Actions
+	if len(actions) != 3 {
+		t.Fatalf("expected 3 actions, got %d", len(actions))
+	}
+
+	reject := actions[0]
+	if reject.Kind != "reject" || reject.Target.Name != "MAINTENANCE" {
+		t.Errorf("expected reject MAINTENANCE, got %s %s", reject.Kind, reject.Target.Name)
+	}
+	if reject.Condition == nil {
+		t.Error("expected reject condition")
+	}
+
+	set := actions[1]
+	if set.Kind != "set" || set.Target.Name != "priority" {
+		t.Errorf("expected set priority, got %s %s", set.Kind, set.Target.Name)
+	}
+	if ident, ok := set.Value.(*ast.Ident); !ok || ident.Name != "high" {
+		t.Errorf("expected set value 'high', got %#v", set.Value)
+	}
+	if cond, ok := set.Condition.(*ast.BinaryExpr); !ok {
+		t.Errorf("expected binary set condition, got %#v", set.Condition)
+	} else if path, ok := cond.Left.(*ast.PathExpr); !ok || path.Parts[0].Name != "input" {
+		t.Errorf("expected input.subject path, got %#v", cond.Left)
+	}
+
+	emit := actions[2]
+	if emit.Kind != "emit" || emit.Target.Name != "TICKET_RECEIVED" {
+		t.Errorf("expected emit TICKET_RECEIVED, got %s %s", emit.Kind, emit.Target.Name)
+	}
+	if emit.Condition != nil {
+		t.Error("expected unconditional emit")
+	}
+}
+
 func TestParser_ViewDecl(t *testing.T) {
 	input := `view TicketList {
 		source: Ticket
@@ -777,3 +1056,128 @@ func TestParser_WebhookGeneric(t *testing.T) {
 		t.Errorf("expected action 'handle_push', got %q", wh.Triggers.Name)
 	}
 }
+
+func TestParser_MigrateDecl(t *testing.T) {
+	input := `migrate Subscription.v2 {
+		from: plan enum(free, pro)
+		to: tier enum(free, starter, pro, enterprise)
+
+		map:
+			free -> free
+			pro -> starter
+	}`
+
+	file, diags := Parse(input, "test.forge")
+
+	if diags.HasErrors() {
+		for _, d := range diags.Errors() {
+			t.Logf("error: %s", d)
+		}
+		t.Fatal("unexpected errors during parsing")
+	}
+
+	if len(file.Migrations) != 1 {
+		t.Fatalf("expected 1 migration, got %d", len(file.Migrations))
+	}
+
+	mig := file.Migrations[0]
+	if mig.Target.String() != "Subscription.v2" {
+		t.Errorf("expected target 'Subscription.v2', got %q", mig.Target.String())
+	}
+	if mig.FromField == nil || mig.FromField.Name != "plan" || len(mig.From.EnumValues) != 2 {
+		t.Errorf("unexpected from clause: field %v, type %+v", mig.FromField, mig.From)
+	}
+	if mig.ToField == nil || mig.ToField.Name != "tier" || len(mig.To.EnumValues) != 4 {
+		t.Errorf("unexpected to clause: field %v, type %+v", mig.ToField, mig.To)
+	}
+	if len(mig.Mappings) != 2 {
+		t.Fatalf("expected 2 mappings, got %d", len(mig.Mappings))
+	}
+	if from, to := mig.Mappings[1].From.(*ast.Ident), mig.Mappings[1].To.(*ast.Ident); from.Name != "pro" || to.Name != "starter" {
+		t.Errorf("expected pro -> starter, got %s -> %s", from.Name, to.Name)
+	}
+}
+
+func TestParser_ImperativeDecl(t *testing.T) {
+	input := `imperative export_csv {
+		input: Ticket
+		returns: file
+		effects: [email.send, http.call]
+	}
+
+	imperative calculate_metrics {
+		input: Organization
+		returns: MetricsResult
+	}`
+
+	file, diags := Parse(input, "test.forge")
+
+	if diags.HasErrors() {
+		for _, d := range diags.Errors() {
+			t.Logf("error: %s", d)
+		}
+		t.Fatal("unexpected errors during parsing")
+	}
+
+	if len(file.Imperatives) != 2 {
+		t.Fatalf("expected 2 imperatives, got %d", len(file.Imperatives))
+	}
+
+	imp := file.Imperatives[0]
+	if imp.Name.Name != "export_csv" || imp.Input.Name != "Ticket" {
+		t.Errorf("unexpected imperative %s with input %v", imp.Name.Name, imp.Input)
+	}
+	if imp.Returns == nil || imp.Returns.Name != "file" {
+		t.Errorf("expected returns 'file', got %v", imp.Returns)
+	}
+	if len(imp.Effects) != 2 || imp.Effects[0].Name != "email.send" || imp.Effects[1].Name != "http.call" {
+		t.Errorf("unexpected effects %v", imp.Effects)
+	}
+
+	if got := file.Imperatives[1].Returns; got == nil || got.Name != "MetricsResult" {
+		t.Errorf("expected returns 'MetricsResult', got %v", got)
+	}
+	if len(file.Imperatives[1].Effects) != 0 {
+		t.Errorf("expected no effects, got %v", file.Imperatives[1].Effects)
+	}
+}
+
+func TestParser_PresenceDecl(t *testing.T) {
+	input := `presence UserPresence {
+		source: User
+		status: enum(online, away, dnd, offline) = offline
+		typing_in: string
+		ttl: 5m
+		scope: workspace
+	}`
+
+	file, diags := Parse(input, "test.forge")
+
+	if diags.HasErrors() {
+		for _, d := range diags.Errors() {
+			t.Logf("error: %s", d)
+		}
+		t.Fatal("unexpected errors during parsing")
+	}
+
+	if len(file.Presences) != 1 {
+		t.Fatalf("expected 1 presence, got %d", len(file.Presences))
+	}
+
+	p := file.Presences[0]
+	if p.Name.Name != "UserPresence" || p.Source == nil || p.Source.Name != "User" {
+		t.Errorf("unexpected presence %s with source %v", p.Name.Name, p.Source)
+	}
+	if p.Scope == nil || p.Scope.Name != "workspace" {
+		t.Errorf("expected scope 'workspace', got %v", p.Scope)
+	}
+	if p.TTL == nil || p.TTL.Value != 5*time.Minute {
+		t.Errorf("expected ttl 5m, got %v", p.TTL)
+	}
+	if len(p.Fields) != 2 || p.Fields[0].Name.Name != "status" || p.Fields[1].Name.Name != "typing_in" {
+		t.Fatalf("unexpected fields %v", p.Fields)
+	}
+	if got := p.Fields[0].Type.EnumValues; len(got) != 4 {
+		t.Errorf("expected 4 enum values, got %d", len(got))
+	}
+}
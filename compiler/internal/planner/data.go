@@ -0,0 +1,128 @@
+package planner
+
+import "slices"
+
+// planDataMigrations returns the declared data migrations that still have to
+// run against schema from: those it does not record yet and whose old column
+// it still has. A migration whose old column is already gone has nothing to
+// move and is only recorded.
+func (p *Planner) planDataMigrations(from, to *Schema) []*DataMigration {
+	var data []*DataMigration
+	for _, mig := range p.normalized.Migrations {
+		if slices.Contains(from.Migrations, mig.Name) {
+			continue
+		}
+		table := p.scope.TableName(mig.Entity)
+		oldCol := findTable(from, table).column(mig.FromField)
+		newCol := findTable(to, table).column(mig.ToField)
+		if oldCol == nil || newCol == nil {
+			continue
+		}
+
+		dm := &DataMigration{
+			Name:     mig.Name,
+			Table:    table,
+			From:     oldCol,
+			FromType: from.enumType(oldCol.Type),
+			To:       newCol,
+		}
+		// The new column's type is created unless it already exists and
+		// is not the one being replaced
+		if t := to.enumType(newCol.Type); t != nil && (from.enumType(t.Name) == nil || t.Name == oldCol.Type) {
+			dm.ToType = t
+		}
+		for _, m := range mig.Mappings {
+			dm.Map = append(dm.Map, &ValueMap{From: m.From, To: m.To})
+		}
+		data = append(data, dm)
+	}
+	return data
+}
+
+// exclude removes the changes to dm's columns and types from m, which the
+// data migration makes itself.
+func (dm *DataMigration) exclude(m *MigrationPlan) {
+	types := []string{dm.From.Type, dm.To.Type}
+	columns := []string{dm.From.Name, dm.To.Name}
+
+	m.CreateTypes = slices.DeleteFunc(m.CreateTypes, func(t *CreateType) bool {
+		return slices.Contains(types, t.Name)
+	})
+	m.AlterTypes = slices.DeleteFunc(m.AlterTypes, func(t *AlterType) bool {
+		return slices.Contains(types, t.Name)
+	})
+	m.DropTypes = slices.DeleteFunc(m.DropTypes, func(name string) bool {
+		return slices.Contains(types, name)
+	})
+
+	m.AlterTables = slices.DeleteFunc(m.AlterTables, func(alter *AlterTable) bool {
+		if alter.Name != dm.Table {
+			return false
+		}
+		alter.AddColumns = slices.DeleteFunc(alter.AddColumns, func(c *Column) bool {
+			return slices.Contains(columns, c.Name)
+		})
+		alter.DropColumns = slices.DeleteFunc(alter.DropColumns, func(name string) bool {
+			return slices.Contains(columns, name)
+		})
+		alter.AlterColumns = slices.DeleteFunc(alter.AlterColumns, func(ac *AlterColumn) bool {
+			return slices.Contains(columns, ac.Name)
+		})
+		return len(alter.AddColumns) == 0 && len(alter.DropColumns) == 0 && len(alter.AlterColumns) == 0
+	})
+}
+
+// Reverse returns the data migration that undoes dm, or nil if dm maps
+// several old values to the same new value and cannot be undone.
+func (dm *DataMigration) Reverse() *DataMigration {
+	r := &DataMigration{
+		Name:     dm.Name,
+		Table:    dm.Table,
+		From:     dm.To,
+		FromType: dm.ToType,
+		To:       dm.From,
+		ToType:   dm.FromType,
+	}
+	seen := make(map[string]bool)
+	for _, m := range dm.Map {
+		if seen[m.To] {
+			return nil
+		}
+		seen[m.To] = true
+		r.Map = append(r.Map, &ValueMap{From: m.To, To: m.From})
+	}
+	return r
+}
+
+// findTable returns the table named name in s, or nil.
+func findTable(s *Schema, name string) *CreateTable {
+	for _, t := range s.Tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// column returns the column named name, or nil. It is safe on a nil table.
+func (t *CreateTable) column(name string) *Column {
+	if t == nil {
+		return nil
+	}
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// enumType returns the enum type named name in s, or nil.
+func (s *Schema) enumType(name string) *CreateType {
+	for _, t := range s.Types {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
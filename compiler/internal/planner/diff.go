@@ -0,0 +1,294 @@
+package planner
+
+import (
+	"slices"
+	"strings"
+)
+
+// diffSchema returns the migration that turns schema from into schema to.
+// Tables and columns are matched by name, so a rename is planned as a drop
+// and an add. Foreign key targets of existing columns are not compared.
+func (p *Planner) diffSchema(from, to *Schema) *MigrationPlan {
+	m := &MigrationPlan{}
+
+	// Enum types
+	fromTypes := make(map[string]*CreateType)
+	for _, t := range from.Types {
+		fromTypes[t.Name] = t
+	}
+	toTypes := make(map[string]bool)
+	for _, t := range to.Types {
+		toTypes[t.Name] = true
+		old, ok := fromTypes[t.Name]
+		if !ok {
+			m.CreateTypes = append(m.CreateTypes, t)
+			continue
+		}
+		alter := &AlterType{Name: t.Name}
+		for _, v := range t.Values {
+			if !slices.Contains(old.Values, v) {
+				alter.AddValues = append(alter.AddValues, v)
+			}
+		}
+		for _, v := range old.Values {
+			if !slices.Contains(t.Values, v) {
+				alter.RemovedValues = append(alter.RemovedValues, v)
+			}
+		}
+		if len(alter.AddValues) > 0 || len(alter.RemovedValues) > 0 {
+			m.AlterTypes = append(m.AlterTypes, alter)
+		}
+	}
+	for _, t := range from.Types {
+		if !toTypes[t.Name] {
+			m.DropTypes = append(m.DropTypes, t.Name)
+		}
+	}
+
+	// Tables and columns
+	fromTables := make(map[string]*CreateTable)
+	for _, t := range from.Tables {
+		fromTables[t.Name] = t
+	}
+	toTables := make(map[string]bool)
+	var created []*CreateTable
+	for _, t := range to.Tables {
+		toTables[t.Name] = true
+		old, ok := fromTables[t.Name]
+		if !ok {
+			created = append(created, t)
+			continue
+		}
+		if alter := diffColumns(old, t); alter != nil {
+			m.AlterTables = append(m.AlterTables, alter)
+		}
+	}
+	m.CreateTables = p.sortTablesByDependencies(created)
+	// Drop dependent tables first
+	for i := len(from.Tables) - 1; i >= 0; i-- {
+		if name := from.Tables[i].Name; !toTables[name] {
+			m.DropTables = append(m.DropTables, name)
+		}
+	}
+
+	// Triggers for new tables; join tables have no updated_at
+	for _, t := range m.CreateTables {
+		if !slices.ContainsFunc(t.Columns, func(c *Column) bool { return c.Name == "updated_at" }) {
+			continue
+		}
+		m.CreateTriggers = append(m.CreateTriggers, &CreateTrigger{
+			Name:     t.Name + "_updated_at",
+			Table:    t.Name,
+			Timing:   "BEFORE",
+			Event:    "UPDATE",
+			Function: "update_updated_at()",
+		})
+	}
+
+	// Indexes: a changed index is dropped and recreated
+	fromIndexes := make(map[string]*CreateIndex)
+	for _, idx := range from.Indexes {
+		fromIndexes[idx.Name] = idx
+	}
+	toIndexes := make(map[string]bool)
+	for _, idx := range to.Indexes {
+		toIndexes[idx.Name] = true
+		old, ok := fromIndexes[idx.Name]
+		if ok && old.Table == idx.Table && old.Unique == idx.Unique && slices.Equal(old.Columns, idx.Columns) {
+			continue
+		}
+		if ok {
+			m.DropIndexes = append(m.DropIndexes, idx.Name)
+		}
+		m.CreateIndexes = append(m.CreateIndexes, idx)
+	}
+	for _, idx := range from.Indexes {
+		if !toIndexes[idx.Name] {
+			m.DropIndexes = append(m.DropIndexes, idx.Name)
+		}
+	}
+
+	// Policies: a changed policy is dropped and recreated. Policies of
+	// dropped tables go with the table.
+	fromPolicies := make(map[string]*CreatePolicy)
+	for _, pol := range from.Policies {
+		fromPolicies[pol.Name] = pol
+	}
+	toPolicies := make(map[string]bool)
+	for _, pol := range to.Policies {
+		toPolicies[pol.Name] = true
+		old, ok := fromPolicies[pol.Name]
+		if ok && *old == *pol {
+			continue
+		}
+		if ok {
+			m.DropPolicies = append(m.DropPolicies, old)
+		}
+		m.CreatePolicies = append(m.CreatePolicies, pol)
+	}
+	for _, pol := range from.Policies {
+		if !toPolicies[pol.Name] && toTables[pol.Table] {
+			m.DropPolicies = append(m.DropPolicies, pol)
+		}
+	}
+
+	return m
+}
+
+// renameLegacyTables returns schema with the tables of entities named before
+// table names were pluralized by naming.TableName, as "categorys" for
+// Category, renamed to their current names, along with the renames. Diffed by
+// name, such a table would be dropped and created again, losing its rows.
+// The enum types named after a renamed table are renamed with it. A table is
+// only renamed when schema has no table of the current name.
+func (p *Planner) renameLegacyTables(schema *Schema) (*Schema, []*Rename, []*Rename) {
+	tables := make(map[string]string)
+	var tableRenames []*Rename
+	for _, entity := range p.normalized.Entities {
+		legacy, current := legacyTableName(entity.Name), p.scope.TableName(entity.Name)
+		if legacy == current || findTable(schema, legacy) == nil || findTable(schema, current) != nil {
+			continue
+		}
+		tables[legacy] = current
+		tableRenames = append(tableRenames, &Rename{From: legacy, To: current})
+	}
+	if len(tables) == 0 {
+		return schema, nil, nil
+	}
+	rename := func(table string) string {
+		if to, ok := tables[table]; ok {
+			return to
+		}
+		return table
+	}
+
+	renamed := *schema
+	types := make(map[string]string)
+	var typeRenames []*Rename
+	renamed.Types = nil
+	for _, t := range schema.Types {
+		for _, r := range tableRenames {
+			from, to := r.From, r.To
+			if field, ok := strings.CutPrefix(t.Name, from+"_"); ok && schema.enumType(to+"_"+field) == nil {
+				types[t.Name] = to + "_" + field
+				typeRenames = append(typeRenames, &Rename{From: t.Name, To: to + "_" + field})
+				copied := *t
+				copied.Name = to + "_" + field
+				t = &copied
+				break
+			}
+		}
+		renamed.Types = append(renamed.Types, t)
+	}
+
+	renamed.Tables = nil
+	for _, t := range schema.Tables {
+		copied := *t
+		copied.Name = rename(t.Name)
+		copied.Columns = nil
+		for _, c := range t.Columns {
+			col := *c
+			if to, ok := types[c.Type]; ok {
+				col.Type = to
+			}
+			if c.References != nil {
+				ref := *c.References
+				ref.Table = rename(ref.Table)
+				col.References = &ref
+			}
+			copied.Columns = append(copied.Columns, &col)
+		}
+		renamed.Tables = append(renamed.Tables, &copied)
+	}
+	// Indexes and policies keep their names, so the diff recreates them
+	// under the current ones
+	renamed.Indexes = nil
+	for _, idx := range schema.Indexes {
+		copied := *idx
+		copied.Table = rename(idx.Table)
+		renamed.Indexes = append(renamed.Indexes, &copied)
+	}
+	renamed.Policies = nil
+	for _, pol := range schema.Policies {
+		copied := *pol
+		copied.Table = rename(pol.Table)
+		renamed.Policies = append(renamed.Policies, &copied)
+	}
+	return &renamed, tableRenames, typeRenames
+}
+
+// legacyTableName returns the table name given to entity before
+// naming.TableName: an underscore before every capital and an "s" appended.
+func legacyTableName(entity string) string {
+	var b strings.Builder
+	for i, r := range entity {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToLower(b.String()) + "s"
+}
+
+// diffColumns returns the changes from table from to table to, or nil if
+// their columns are the same.
+func diffColumns(from, to *CreateTable) *AlterTable {
+	alter := &AlterTable{Name: to.Name}
+
+	fromCols := make(map[string]*Column)
+	for _, c := range from.Columns {
+		fromCols[c.Name] = c
+	}
+	toCols := make(map[string]bool)
+	for _, c := range to.Columns {
+		toCols[c.Name] = true
+		old, ok := fromCols[c.Name]
+		if !ok {
+			alter.AddColumns = append(alter.AddColumns, c)
+			continue
+		}
+
+		ac := &AlterColumn{Name: c.Name}
+		changed := false
+		if old.Type != c.Type {
+			ac.NewType = c.Type
+			changed = true
+		}
+		if old.Default != c.Default || (ac.NewType != "" && c.Default != "") {
+			// A type change drops the default, so it is set again
+			if c.Default == "" {
+				ac.DropDefault = true
+			} else {
+				ac.SetDefault = c.Default
+			}
+			changed = true
+		}
+		if old.Nullable != c.Nullable {
+			ac.SetNotNull = !c.Nullable
+			ac.DropNotNull = c.Nullable
+			changed = true
+		}
+		if changed {
+			alter.AlterColumns = append(alter.AlterColumns, ac)
+		}
+	}
+	for _, c := range from.Columns {
+		if !toCols[c.Name] {
+			alter.DropColumns = append(alter.DropColumns, c.Name)
+		}
+	}
+
+	if len(alter.AddColumns) == 0 && len(alter.DropColumns) == 0 && len(alter.AlterColumns) == 0 {
+		return nil
+	}
+	return alter
+}
+
+// empty reports whether the plan changes nothing.
+func (m *MigrationPlan) empty() bool {
+	return len(m.CreateTables) == 0 && len(m.AlterTables) == 0 &&
+		len(m.CreateIndexes) == 0 && len(m.CreateTypes) == 0 &&
+		len(m.CreatePolicies) == 0 && len(m.AlterTypes) == 0 &&
+		len(m.DropTables) == 0 && len(m.DropIndexes) == 0 &&
+		len(m.DropTypes) == 0 && len(m.DropPolicies) == 0
+}
@@ -0,0 +1,137 @@
+package planner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSchema(t *testing.T) {
+	from := &Schema{
+		Types: []*CreateType{
+			{Name: "tickets_status", Kind: "enum", Values: []string{"open", "closed"}},
+			{Name: "tickets_kind", Kind: "enum", Values: []string{"bug", "task"}},
+		},
+		Tables: []*CreateTable{
+			{Name: "users", PrimaryKey: "id", Columns: []*Column{
+				{Name: "id", Type: "uuid"},
+				{Name: "email", Type: "text"},
+			}},
+			{Name: "tickets", PrimaryKey: "id", Columns: []*Column{
+				{Name: "id", Type: "uuid"},
+				{Name: "subject", Type: "text"},
+				{Name: "status", Type: "tickets_status", Default: "'open'"},
+				{Name: "kind", Type: "tickets_kind", Nullable: true},
+				{Name: "score", Type: "integer"},
+			}},
+			{Name: "notes", PrimaryKey: "id", Columns: []*Column{{Name: "id", Type: "uuid"}}},
+		},
+		Indexes: []*CreateIndex{
+			{Name: "idx_users_email", Table: "users", Columns: []string{"email"}, Unique: true},
+		},
+		Policies: []*CreatePolicy{
+			{Name: "tickets_read_policy", Table: "tickets", Command: "SELECT", Using: "true"},
+			{Name: "notes_read_policy", Table: "notes", Command: "SELECT", Using: "true"},
+		},
+	}
+	to := &Schema{
+		Types: []*CreateType{
+			{Name: "tickets_status", Kind: "enum", Values: []string{"open", "pending"}},
+		},
+		Tables: []*CreateTable{
+			{Name: "users", PrimaryKey: "id", Columns: []*Column{
+				{Name: "id", Type: "uuid"},
+				{Name: "email", Type: "text"},
+			}},
+			{Name: "tickets", PrimaryKey: "id", Columns: []*Column{
+				{Name: "id", Type: "uuid"},
+				{Name: "subject", Type: "text", Nullable: true},
+				{Name: "status", Type: "tickets_status", Default: "'pending'"},
+				{Name: "score", Type: "float", Default: "0"},
+			}},
+		},
+		Indexes: []*CreateIndex{
+			{Name: "idx_users_email", Table: "users", Columns: []string{"email"}},
+		},
+		Policies: []*CreatePolicy{
+			{Name: "tickets_read_policy", Table: "tickets", Command: "SELECT", Using: "false"},
+		},
+	}
+
+	m := New(nil, nil, nil).diffSchema(from, to)
+
+	if len(m.AlterTypes) != 1 || !reflect.DeepEqual(m.AlterTypes[0], &AlterType{
+		Name: "tickets_status", AddValues: []string{"pending"}, RemovedValues: []string{"closed"},
+	}) {
+		t.Errorf("alter types = %+v", m.AlterTypes)
+	}
+	if !reflect.DeepEqual(m.DropTypes, []string{"tickets_kind"}) {
+		t.Errorf("drop types = %v", m.DropTypes)
+	}
+	if !reflect.DeepEqual(m.DropTables, []string{"notes"}) {
+		t.Errorf("drop tables = %v", m.DropTables)
+	}
+	if len(m.CreateTables) != 0 || len(m.CreateTriggers) != 0 {
+		t.Errorf("expected no new tables, got %d", len(m.CreateTables))
+	}
+
+	if len(m.AlterTables) != 1 || m.AlterTables[0].Name != "tickets" {
+		t.Fatalf("alter tables = %+v", m.AlterTables)
+	}
+	alter := m.AlterTables[0]
+	if !reflect.DeepEqual(alter.DropColumns, []string{"kind"}) {
+		t.Errorf("drop columns = %v", alter.DropColumns)
+	}
+	wantCols := []*AlterColumn{
+		{Name: "subject", DropNotNull: true},
+		{Name: "status", SetDefault: "'pending'"},
+		{Name: "score", NewType: "float", SetDefault: "0"},
+	}
+	if !reflect.DeepEqual(alter.AlterColumns, wantCols) {
+		for _, ac := range alter.AlterColumns {
+			t.Logf("  %+v", ac)
+		}
+		t.Errorf("unexpected column changes")
+	}
+
+	// The changed index is dropped and recreated
+	if !reflect.DeepEqual(m.DropIndexes, []string{"idx_users_email"}) || len(m.CreateIndexes) != 1 {
+		t.Errorf("indexes: drop %v, create %d", m.DropIndexes, len(m.CreateIndexes))
+	}
+
+	// The changed policy is replaced; the dropped table's policy goes with it
+	if len(m.DropPolicies) != 1 || m.DropPolicies[0].Name != "tickets_read_policy" {
+		t.Errorf("drop policies = %+v", m.DropPolicies)
+	}
+	if len(m.CreatePolicies) != 1 || m.CreatePolicies[0].Using != "false" {
+		t.Errorf("create policies = %+v", m.CreatePolicies)
+	}
+}
+
+func TestDiffSchema_Unchanged(t *testing.T) {
+	plan := planFromSource(t, `
+app Test {}
+entity User {
+  email: string unique
+  role: enum(admin, member) = member
+}
+entity Ticket {
+  subject: string
+}
+relation Ticket.author -> User
+access Ticket {
+  read: user == author
+}
+`)
+	p := New(nil, nil, nil)
+	if m := p.diffSchema(plan.Migration.Schema, plan.Migration.Schema); !m.empty() {
+		t.Errorf("diff of a schema with itself is not empty: %+v", m)
+	}
+
+	m := p.diffSchema(&Schema{}, plan.Migration.Schema)
+	if len(m.CreateTables) != 2 || m.CreateTables[0].Name != "users" {
+		t.Fatalf("expected users to be created before tickets, got %+v", m.CreateTables)
+	}
+	if len(m.CreateTriggers) != 2 || len(m.CreateTypes) != 1 || len(m.CreatePolicies) != 1 {
+		t.Errorf("triggers %d, types %d, policies %d", len(m.CreateTriggers), len(m.CreateTypes), len(m.CreatePolicies))
+	}
+}
@@ -0,0 +1,106 @@
+package planner
+
+import "testing"
+
+func TestPlanMigration_ManyRelation(t *testing.T) {
+	src := `
+app Test { auth: none, database: postgres }
+entity User { email: string }
+entity Organization { name: string }
+relation Organization.members -> User many
+relation User.friends -> User many`
+
+	plan := planFromSource(t, src)
+
+	tables := map[string]*CreateTable{}
+	for _, table := range plan.Migration.CreateTables {
+		tables[table.Name] = table
+	}
+	for _, column := range tables["organizations"].Columns {
+		if column.Name == "members_id" {
+			t.Error("many relation must not add a column to its owner")
+		}
+	}
+
+	tests := []struct {
+		table, key, targetKey, target string
+	}{
+		{"organization_members", "organization_id", "user_id", "users"},
+		{"user_friends", "user_id", "friends_id", "users"},
+	}
+	for _, tt := range tests {
+		table, ok := tables[tt.table]
+		if !ok {
+			t.Fatalf("expected join table %s", tt.table)
+		}
+		if table.PrimaryKey != tt.key+", "+tt.targetKey {
+			t.Errorf("%s primary key = %q", tt.table, table.PrimaryKey)
+		}
+		if len(table.Columns) != 2 || table.Columns[0].Name != tt.key || table.Columns[1].Name != tt.targetKey {
+			t.Fatalf("%s columns = %+v", tt.table, table.Columns)
+		}
+		if ref := table.Columns[1].References; ref == nil || ref.Table != tt.target || ref.OnDelete != "cascade" {
+			t.Errorf("%s.%s references %+v", tt.table, tt.targetKey, ref)
+		}
+	}
+
+	indexed := false
+	for _, index := range plan.Migration.CreateIndexes {
+		if index.Name == "idx_organization_members_user_id" && index.Table == "organization_members" {
+			indexed = true
+		}
+	}
+	if !indexed {
+		t.Error("expected an index on organization_members.user_id")
+	}
+}
+
+func TestPlanMigration_TableNames(t *testing.T) {
+	src := `
+app Test { auth: none, database: postgres }
+entity Category { name: string }
+entity Person {
+	@table: staff
+	name: string
+}
+relation Person.category -> Category @column: category_ref
+view People {
+	source: Person
+	fields: name, category.name
+	filter: category == param.category
+}`
+
+	plan := planFromSource(t, src)
+
+	tables := map[string]*CreateTable{}
+	for _, table := range plan.Migration.CreateTables {
+		tables[table.Name] = table
+	}
+	if _, ok := tables["categories"]; !ok {
+		t.Error("expected table categories")
+	}
+	staff, ok := tables["staff"]
+	if !ok {
+		t.Fatal("expected table staff for Person")
+	}
+	var ref *ForeignKey
+	for _, column := range staff.Columns {
+		if column.Name == "category_ref" {
+			ref = column.References
+		}
+	}
+	if ref == nil || ref.Table != "categories" {
+		t.Errorf("staff.category_ref references %+v, want categories", ref)
+	}
+
+	view := plan.Views["People"]
+	if view.SourceTable != "staff" {
+		t.Errorf("view source table = %q, want staff", view.SourceTable)
+	}
+	if len(view.Joins) != 1 || view.Joins[0].Table != "categories" || view.Joins[0].On != "j_category.id = t.category_ref" {
+		t.Errorf("view joins = %+v", view.Joins)
+	}
+	if view.Filter != "(t.category_ref = $1)" {
+		t.Errorf("view filter = %q", view.Filter)
+	}
+}
@@ -3,9 +3,11 @@ package planner
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/forge-lang/forge/compiler/internal/analyzer"
 	"github.com/forge-lang/forge/compiler/internal/ast"
@@ -23,6 +25,28 @@ type ActionNode struct {
 	PreHooks     []*HookNode
 	PostHooks    []*HookNode
 	AccessCheck  *AccessNode
+	Input        []*ActionInput // fields of an input block
+	Steps        []*ActionStep
+}
+
+// ActionInput is a field of an action's input block, validated by the
+// runtime before any step runs.
+type ActionInput struct {
+	Field  *normalizer.NormalizedField
+	Entity string // referenced entity (empty for scalar fields)
+}
+
+// ActionStep is a set, create, emit or reject statement of an action,
+// executed by the runtime in order within one transaction.
+type ActionStep struct {
+	Kind      string            // "set", "create", "emit", "reject"
+	Entity    string            // entity set or created
+	Record    string            // input field holding the id of the record set
+	Field     string            // field or to-one relation set (set only)
+	Value     string            // CEL expression (set only)
+	Fields    map[string]string // field -> CEL expression (create only)
+	Message   string            // message code (emit and reject)
+	Condition string            // CEL guard (empty means always)
 }
 
 // RuleNode represents a rule to be evaluated.
@@ -41,6 +65,22 @@ type HookNode struct {
 	Timing    string // "before" or "after"
 	Operation string // "create", "update", "delete"
 	Jobs      []string
+	Delayed   []*DelayedJob
+	Steps     []*HookStep
+}
+
+// DelayedJob is a job a hook enqueues to run after a delay.
+type DelayedJob struct {
+	Job   string
+	Delay time.Duration
+}
+
+// HookStep is an emit, reject or set statement evaluated by the runtime.
+type HookStep struct {
+	Kind      string // "emit", "reject", "set"
+	Target    string // message code, or field name for set
+	Value     string // CEL expression (set only)
+	Condition string // CEL guard (empty means always)
 }
 
 // AccessNode represents access control for an entity.
@@ -61,9 +101,16 @@ type ViewNode struct {
 	Joins        []*ResolvedViewJoin
 	Filter       string   // SQL WHERE template with $param.xxx placeholders
 	Params       []string // ordered param names for positional args
+	ParamColumns []string // source column each param is compared with, when the filter is only such comparisons
 	DefaultSort  []*ResolvedViewSort
 	Dependencies []string // entities this view depends on
 	Query        string   // legacy: generated SQL query (deprecated)
+
+	// A view over a presence reads the presence store, not a table: field
+	// columns and sort columns are paths into an entry and Condition is the
+	// filter as CEL
+	Presence  bool
+	Condition string
 }
 
 // ResolvedViewField represents a field resolved to a SQL expression.
@@ -74,6 +121,11 @@ type ResolvedViewField struct {
 	Type       string // field type for cursor encoding
 	Filterable bool
 	Sortable   bool
+
+	// Read is the read condition of the field as CEL. A field some users
+	// cannot read is neither filterable nor sortable, or the order of the
+	// rows would reveal its values
+	Read string
 }
 
 // ResolvedViewJoin represents a JOIN needed for a view.
@@ -99,29 +151,84 @@ type MigrationPlan struct {
 	CreateTypes  []*CreateType
 	CreatePolicies []*CreatePolicy
 	CreateTriggers []*CreateTrigger
+	AlterTypes   []*AlterType
+	DropTables   []string
+	DropIndexes  []string
+	DropTypes    []string
+	DropPolicies []*CreatePolicy
+	Schema       *Schema // schema the plan produces; set on full plans only
+}
+
+// Schema is the layout of tables, enum types, indexes and policies a
+// migration plan produces. It is recorded in the artifact so the next build
+// can diff against it.
+type Schema struct {
+	Types    []*CreateType   `json:"types"`
+	Tables   []*CreateTable  `json:"tables"`
+	Indexes  []*CreateIndex  `json:"indexes"`
+	Policies []*CreatePolicy `json:"policies"`
+	// Migrations lists the data migrations already reflected in the schema
+	Migrations []string `json:"migrations,omitempty"`
+}
+
+// SchemaChanges is the difference between the previous build's schema and
+// the current one.
+type SchemaChanges struct {
+	Up   *MigrationPlan   // brings the previous schema to the current one
+	Down *MigrationPlan   // reverts the current schema to the previous one
+	Data []*DataMigration // data migrations to run before Up
+	// Tables and enum types of the previous schema to rename before Data
+	// and Up, which refer to them by their current names
+	RenameTables []*Rename
+	RenameTypes  []*Rename
+}
+
+// Rename renames a table or type.
+type Rename struct {
+	From string
+	To   string
+}
+
+// DataMigration moves the values of a column into a new column through a
+// value map, then drops the old column. From and To have the same name when
+// a column's type is migrated in place.
+type DataMigration struct {
+	Name     string // "Entity.version"
+	Table    string
+	From     *Column
+	FromType *CreateType // enum type of From, dropped with it; nil if not an enum
+	To       *Column
+	ToType   *CreateType // enum type to create for To; nil if not an enum or it exists
+	Map      []*ValueMap
+}
+
+// ValueMap maps a value of a data migration's old column to the new column.
+type ValueMap struct {
+	From string
+	To   string
 }
 
 // CreateTable represents a new table to create.
 type CreateTable struct {
-	Name    string
-	Columns []*Column
-	PrimaryKey string
+	Name    string `json:"name"`
+	Columns []*Column `json:"columns"`
+	PrimaryKey string `json:"primary_key"`
 }
 
 // Column represents a table column.
 type Column struct {
-	Name       string
-	Type       string
-	Nullable   bool
-	Default    string
-	References *ForeignKey
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Nullable   bool `json:"nullable,omitempty"`
+	Default    string `json:"default,omitempty"`
+	References *ForeignKey `json:"references,omitempty"`
 }
 
 // ForeignKey represents a foreign key reference.
 type ForeignKey struct {
-	Table    string
-	Column   string
-	OnDelete string
+	Table    string `json:"table"`
+	Column   string `json:"column"`
+	OnDelete string `json:"on_delete,omitempty"`
 }
 
 // AlterTable represents changes to an existing table.
@@ -144,26 +251,34 @@ type AlterColumn struct {
 
 // CreateIndex represents an index to create.
 type CreateIndex struct {
-	Name    string
-	Table   string
-	Columns []string
-	Unique  bool
+	Name    string `json:"name"`
+	Table   string `json:"table"`
+	Columns []string `json:"columns"`
+	Unique  bool `json:"unique,omitempty"`
 }
 
 // CreateType represents a custom type (e.g., enum).
 type CreateType struct {
-	Name   string
-	Kind   string // "enum"
-	Values []string
+	Name   string `json:"name"`
+	Kind   string `json:"kind"` // "enum"
+	Values []string `json:"values"`
+}
+
+// AlterType represents values added to an existing enum type. PostgreSQL
+// cannot drop enum values, so removed values are only reported.
+type AlterType struct {
+	Name          string
+	AddValues     []string
+	RemovedValues []string
 }
 
 // CreatePolicy represents a RLS policy.
 type CreatePolicy struct {
-	Name       string
-	Table      string
-	Command    string // "SELECT", "INSERT", "UPDATE", "DELETE", "ALL"
-	Using      string // SQL expression
-	WithCheck  string // SQL expression for INSERT/UPDATE
+	Name       string `json:"name"`
+	Table      string `json:"table"`
+	Command    string `json:"command"` // "SELECT", "INSERT", "UPDATE", "DELETE", "ALL"
+	Using      string `json:"using"` // SQL expression
+	WithCheck  string `json:"with_check,omitempty"` // SQL expression for INSERT/UPDATE
 }
 
 // CreateTrigger represents a trigger.
@@ -181,6 +296,7 @@ type Plan struct {
 	Views      map[string]*ViewNode
 	Access     map[string]*AccessNode
 	Migration  *MigrationPlan
+	Changes    *SchemaChanges // nil without a previous schema or when it is unchanged
 	Hooks      []*HookNode
 }
 
@@ -189,6 +305,7 @@ type Planner struct {
 	file       *ast.File
 	scope      *analyzer.Scope
 	normalized *normalizer.Output
+	previous   *Schema
 	diag       *diag.Diagnostics
 }
 
@@ -202,6 +319,12 @@ func New(file *ast.File, scope *analyzer.Scope, normalized *normalizer.Output) *
 	}
 }
 
+// SetPrevious sets the schema of the previous build. The migration plan is
+// then diffed against it and the difference reported in Plan.Changes.
+func (p *Planner) SetPrevious(schema *Schema) {
+	p.previous = schema
+}
+
 // Plan generates the execution plan.
 func (p *Planner) Plan() (*Plan, *diag.Diagnostics) {
 	plan := &Plan{
@@ -268,13 +391,34 @@ func (p *Planner) planActions(plan *Plan) {
 			}
 		}
 
+		for _, input := range action.Input {
+			node.Input = append(node.Input, &ActionInput{Field: input.Field, Entity: input.Entity})
+		}
+		for _, step := range action.Steps {
+			node.Steps = append(node.Steps, &ActionStep{
+				Kind:      step.Kind,
+				Entity:    step.Entity,
+				Record:    step.Record,
+				Field:     step.Field,
+				Value:     step.Value,
+				Fields:    step.Fields,
+				Message:   step.Message,
+				Condition: step.Condition,
+			})
+		}
+
 		plan.Actions[action.Name] = node
 	}
 }
 
 func (p *Planner) planViews(plan *Plan) {
 	for _, view := range p.normalized.Views {
-		sourceTable := p.tableName(view.Source)
+		if presence, ok := p.scope.Presences[view.Source]; ok {
+			plan.Views[view.Name] = p.planPresenceView(view, presence)
+			continue
+		}
+
+		sourceTable := p.scope.TableName(view.Source)
 		sourceAlias := "t"
 
 		node := &ViewNode{
@@ -303,6 +447,10 @@ func (p *Planner) planViews(plan *Plan) {
 			}
 			field, join := p.resolveViewField(fieldName, view.Source, sourceAlias)
 			if field != nil {
+				if field.Read != "" {
+					field.Filterable = false
+					field.Sortable = false
+				}
 				node.Fields = append(node.Fields, field)
 			}
 			if join != nil {
@@ -325,6 +473,7 @@ func (p *Planner) planViews(plan *Plan) {
 		// Resolve filter expression to SQL template
 		if view.Filter != "" {
 			node.Filter, node.Params = p.resolveViewFilter(view, sourceAlias)
+			node.ParamColumns = p.resolveViewParamColumns(view)
 		}
 
 		// Resolve sort fields
@@ -359,6 +508,9 @@ func (p *Planner) planViews(plan *Plan) {
 // resolveViewField resolves a field name to a SQL expression and optional JOIN.
 func (p *Planner) resolveViewField(field, sourceEntity, sourceAlias string) (*ResolvedViewField, *ResolvedViewJoin) {
 	parts := strings.Split(field, ".")
+	if rel, ok := p.scope.Relations[sourceEntity+"."+parts[0]]; ok && rel.IsMany && len(parts) <= 2 {
+		return p.resolveManyViewField(field, rel, sourceAlias), nil
+	}
 	if len(parts) == 1 {
 		// Simple field: t.field_name
 		return &ResolvedViewField{
@@ -368,6 +520,7 @@ func (p *Planner) resolveViewField(field, sourceEntity, sourceAlias string) (*Re
 			Type:       p.resolveFieldType(sourceEntity, field),
 			Filterable: true,
 			Sortable:   true,
+			Read:       p.resolveFieldRead(sourceEntity, field),
 		}, nil
 	}
 
@@ -385,7 +538,7 @@ func (p *Planner) resolveViewField(field, sourceEntity, sourceAlias string) (*Re
 			}, nil
 		}
 
-		targetTable := p.tableName(rel.ToEntity)
+		targetTable := p.scope.TableName(rel.ToEntity)
 		joinAlias := fmt.Sprintf("j_%s", relName)
 		return &ResolvedViewField{
 			Name:       field,
@@ -394,10 +547,11 @@ func (p *Planner) resolveViewField(field, sourceEntity, sourceAlias string) (*Re
 			Type:       p.resolveFieldType(rel.ToEntity, targetField),
 			Filterable: true,
 			Sortable:   true,
+			Read:       p.resolveFieldRead(rel.ToEntity, targetField),
 		}, &ResolvedViewJoin{
 			Table: targetTable,
 			Alias: joinAlias,
-			On:    fmt.Sprintf("%s.id = %s.%s_id", joinAlias, sourceAlias, relName),
+			On:    fmt.Sprintf("%s.id = %s.%s", joinAlias, sourceAlias, rel.Column),
 			Type:  "LEFT",
 		}
 	}
@@ -411,6 +565,29 @@ func (p *Planner) resolveViewField(field, sourceEntity, sourceAlias string) (*Re
 	}, nil
 }
 
+// resolveManyViewField resolves a many relation, or a field of its targets,
+// to an array gathered through the relation's join table, in target id order.
+// Joining the targets instead would repeat the source row once per target.
+func (p *Planner) resolveManyViewField(field string, rel *analyzer.Relation, sourceAlias string) *ResolvedViewField {
+	joinTable, key, targetKey := rel.JoinTable()
+	column := fmt.Sprintf("(SELECT array_agg(m.%s ORDER BY m.%s) FROM %s m WHERE m.%s = %s.id)",
+		targetKey, targetKey, joinTable, key, sourceAlias)
+	fieldType, read := "uuid", ""
+	if _, targetField, ok := strings.Cut(field, "."); ok {
+		column = fmt.Sprintf("(SELECT array_agg(j.%s ORDER BY j.id) FROM %s m JOIN %s j ON j.id = m.%s WHERE m.%s = %s.id)",
+			targetField, joinTable, p.scope.TableName(rel.ToEntity), targetKey, key, sourceAlias)
+		fieldType = p.resolveFieldType(rel.ToEntity, targetField)
+		read = p.resolveFieldRead(rel.ToEntity, targetField)
+	}
+	return &ResolvedViewField{
+		Name:   field,
+		Column: column,
+		Alias:  field,
+		Type:   fieldType,
+		Read:   read,
+	}
+}
+
 // resolveFieldType looks up the type of a field on an entity.
 func (p *Planner) resolveFieldType(entityName, fieldName string) string {
 	for _, entity := range p.normalized.Entities {
@@ -425,6 +602,20 @@ func (p *Planner) resolveFieldType(entityName, fieldName string) string {
 	return "text" // default
 }
 
+// resolveFieldRead looks up the read condition of a field on an entity.
+func (p *Planner) resolveFieldRead(entityName, fieldName string) string {
+	for _, entity := range p.normalized.Entities {
+		if entity.Name == entityName {
+			for _, field := range entity.Fields {
+				if field.Name == fieldName {
+					return field.Read
+				}
+			}
+		}
+	}
+	return ""
+}
+
 // resolveViewFilter converts a normalized filter to SQL template + param list.
 func (p *Planner) resolveViewFilter(view *normalizer.NormalizedView, sourceAlias string) (string, []string) {
 	if view.Filter == "" {
@@ -456,9 +647,79 @@ func (p *Planner) resolveViewFilter(view *normalizer.NormalizedView, sourceAlias
 	filter = strings.ReplaceAll(filter, "&&", "AND")
 	filter = strings.ReplaceAll(filter, "||", "OR")
 
+	// Qualify source fields, compare relations by their foreign key and
+	// quote string literals as SQL does
+	entity := p.scope.Entities[view.Source]
+	filter = filterTokenPattern.ReplaceAllStringFunc(filter, func(tok string) string {
+		if strings.HasPrefix(tok, `"`) {
+			return "'" + strings.ReplaceAll(strings.Trim(tok, `"`), "'", "''") + "'"
+		}
+		if rel, ok := p.scope.Relations[view.Source+"."+tok]; ok && !rel.IsMany {
+			return fmt.Sprintf("%s.%s", sourceAlias, rel.Column)
+		}
+		if entity != nil {
+			if _, ok := entity.Fields[tok]; ok || tok == "id" {
+				return fmt.Sprintf("%s.%s", sourceAlias, tok)
+			}
+		}
+		return tok
+	})
+
+	// A many relation holds the param when its join table links the two:
+	// "members = $1" and "$1 in members" select the rows $1 is a member of
+	filter = manyFilterPattern.ReplaceAllStringFunc(filter, func(match string) string {
+		m := manyFilterPattern.FindStringSubmatch(match)
+		name, param := m[1], m[2]
+		if name == "" {
+			name, param = m[4], m[3]
+		}
+		rel, ok := p.scope.Relations[view.Source+"."+name]
+		if !ok || !rel.IsMany {
+			return match
+		}
+		joinTable, key, targetKey := rel.JoinTable()
+		return fmt.Sprintf("%s.id IN (SELECT %s FROM %s WHERE %s = %s)", sourceAlias, key, joinTable, targetKey, param)
+	})
+
 	return filter, params
 }
 
+// resolveViewParamColumns resolves the fields a view's params are compared
+// with to the source columns holding them. It returns nil unless every
+// field is stored on the source row.
+func (p *Planner) resolveViewParamColumns(view *normalizer.NormalizedView) []string {
+	if len(view.ParamFields) == 0 {
+		return nil
+	}
+	entity := p.scope.Entities[view.Source]
+	columns := make([]string, len(view.ParamFields))
+	for i, field := range view.ParamFields {
+		if rel, ok := p.scope.Relations[view.Source+"."+field]; ok {
+			if rel.IsMany {
+				return nil
+			}
+			columns[i] = rel.Column
+			continue
+		}
+		if entity == nil {
+			return nil
+		}
+		if _, ok := entity.Fields[field]; !ok && field != "id" {
+			return nil
+		}
+		columns[i] = field
+	}
+	return columns
+}
+
+// filterTokenPattern matches the string literals and bare identifiers of a
+// view filter. Qualified names such as param.x are matched whole.
+var filterTokenPattern = regexp.MustCompile(`"[^"]*"|[A-Za-z_][\w.]*`)
+
+// manyFilterPattern matches a relation compared with a param, either way
+// round, in a view filter converted to SQL.
+var manyFilterPattern = regexp.MustCompile(`\b([A-Za-z_]\w*) = (\$\d+)|(\$\d+) in ([A-Za-z_]\w*)\b`)
+
 // resolveViewSortColumn resolves a sort field name to a SQL column expression.
 func (p *Planner) resolveViewSortColumn(field, sourceAlias string, joinMap map[string]*ResolvedViewJoin) string {
 	parts := strings.Split(field, ".")
@@ -498,6 +759,68 @@ func (p *Planner) calculateViewDependencies(view *normalizer.NormalizedView, joi
 	return result
 }
 
+// planPresenceView plans a view over a presence. Entries refer to their
+// source and scope by the presence's SourceField and Scope, and paths through
+// them are resolved by the runtime as relations. The view depends on both
+// entities, since their rows decide who belongs to a scope.
+func (p *Planner) planPresenceView(view *normalizer.NormalizedView, presence *analyzer.Presence) *ViewNode {
+	node := &ViewNode{
+		Name:      view.Name,
+		Source:    view.Source,
+		Presence:  true,
+		Condition: view.Filter,
+		Params:    view.Params,
+	}
+
+	related := map[string]string{
+		presence.SourceField: presence.Source,
+		presence.Scope:       presence.ScopeEntity,
+	}
+
+	node.Fields = append(node.Fields, &ResolvedViewField{Name: "id", Column: "id", Alias: "id", Type: "uuid"})
+	for _, fieldName := range view.Fields {
+		if fieldName == "id" {
+			continue
+		}
+		field := &ResolvedViewField{Name: fieldName, Column: fieldName, Alias: fieldName, Type: "text"}
+		head, rest, nested := strings.Cut(fieldName, ".")
+		switch entity, isRelated := related[head]; {
+		case isRelated && nested:
+			field.Type = p.resolveFieldType(entity, rest)
+		case isRelated:
+			field.Type = "uuid"
+		case head == "updated_at":
+			field.Type = "timestamp with time zone"
+		default:
+			if ft, ok := presence.Fields[head]; ok {
+				field.Type = ft.Name
+			}
+		}
+		node.Fields = append(node.Fields, field)
+	}
+
+	for _, s := range view.DefaultSort {
+		dir := "ASC"
+		if s.Direction == "desc" {
+			dir = "DESC"
+		}
+		node.DefaultSort = append(node.DefaultSort, &ResolvedViewSort{Column: s.Field, Direction: dir})
+	}
+	if len(node.DefaultSort) == 0 {
+		node.DefaultSort = append(node.DefaultSort,
+			&ResolvedViewSort{Column: "updated_at", Direction: "DESC"},
+			&ResolvedViewSort{Column: "id", Direction: "DESC"},
+		)
+	}
+
+	node.Dependencies = []string{view.Source, presence.Source}
+	if presence.ScopeEntity != presence.Source {
+		node.Dependencies = append(node.Dependencies, presence.ScopeEntity)
+	}
+	sort.Strings(node.Dependencies)
+	return node
+}
+
 func (p *Planner) planAccess(plan *Plan) {
 	for _, access := range p.normalized.Access {
 		node := &AccessNode{
@@ -521,14 +844,20 @@ func (p *Planner) planMigration(plan *Plan) {
 	for _, entity := range p.normalized.Entities {
 		for _, field := range entity.Fields {
 			if field.Type == "enum" && len(field.EnumValues) > 0 {
-				typeName := fmt.Sprintf("%s_%s", p.tableName(entity.Name), field.Name)
+				typeName := fmt.Sprintf("%s_%s", p.scope.TableName(entity.Name), field.Name)
 				enumTypes[typeName] = field.EnumValues
 			}
 		}
 	}
 
-	// Create enum types
-	for name, values := range enumTypes {
+	// Create enum types, sorted so the recorded schema is stable
+	typeNames := make([]string, 0, len(enumTypes))
+	for name := range enumTypes {
+		typeNames = append(typeNames, name)
+	}
+	sort.Strings(typeNames)
+	for _, name := range typeNames {
+		values := enumTypes[name]
 		migration.CreateTypes = append(migration.CreateTypes, &CreateType{
 			Name:   name,
 			Kind:   "enum",
@@ -537,9 +866,10 @@ func (p *Planner) planMigration(plan *Plan) {
 	}
 
 	// Create tables
+	var joinTables []*CreateTable
 	for _, entity := range p.normalized.Entities {
 		table := &CreateTable{
-			Name:       p.tableName(entity.Name),
+			Name:       p.scope.TableName(entity.Name),
 			PrimaryKey: "id",
 		}
 
@@ -557,13 +887,17 @@ func (p *Planner) planMigration(plan *Plan) {
 			table.Columns = append(table.Columns, col)
 		}
 
-		// Add foreign keys for relations
+		// Add foreign keys for relations; many relations get a join table
 		for _, rel := range entity.Relations {
+			if rel.IsMany {
+				joinTables = append(joinTables, p.joinTable(entity.Name, rel))
+				continue
+			}
 			col := &Column{
-				Name: fmt.Sprintf("%s_id", rel.Name),
+				Name: rel.Column,
 				Type: "uuid",
 				References: &ForeignKey{
-					Table:    p.tableName(rel.Target),
+					Table:    p.scope.TableName(rel.Target),
 					Column:   "id",
 					OnDelete: rel.OnDelete,
 				},
@@ -573,13 +907,15 @@ func (p *Planner) planMigration(plan *Plan) {
 
 		migration.CreateTables = append(migration.CreateTables, table)
 	}
+	sort.Slice(joinTables, func(i, j int) bool { return joinTables[i].Name < joinTables[j].Name })
+	migration.CreateTables = append(migration.CreateTables, joinTables...)
 
 	// Sort tables by foreign key dependencies (topological sort)
 	migration.CreateTables = p.sortTablesByDependencies(migration.CreateTables)
 
 	// Create indexes for unique fields and foreign keys
 	for _, entity := range p.normalized.Entities {
-		tableName := p.tableName(entity.Name)
+		tableName := p.scope.TableName(entity.Name)
 
 		for _, field := range entity.Fields {
 			if field.Unique && field.Name != "id" {
@@ -593,10 +929,20 @@ func (p *Planner) planMigration(plan *Plan) {
 		}
 
 		for _, rel := range entity.Relations {
+			if rel.IsMany {
+				// The primary key leads with the owning record; index the
+				// target side for lookups of the records a target belongs to
+				migration.CreateIndexes = append(migration.CreateIndexes, &CreateIndex{
+					Name:    fmt.Sprintf("idx_%s_%s", rel.JoinTable, rel.TargetKey),
+					Table:   rel.JoinTable,
+					Columns: []string{rel.TargetKey},
+				})
+				continue
+			}
 			migration.CreateIndexes = append(migration.CreateIndexes, &CreateIndex{
-				Name:    fmt.Sprintf("idx_%s_%s_id", tableName, rel.Name),
+				Name:    fmt.Sprintf("idx_%s_%s", tableName, rel.Column),
 				Table:   tableName,
-				Columns: []string{fmt.Sprintf("%s_id", rel.Name)},
+				Columns: []string{rel.Column},
 				Unique:  false, // FK indexes are never unique - many records can reference the same target
 			})
 		}
@@ -604,7 +950,7 @@ func (p *Planner) planMigration(plan *Plan) {
 
 	// Create RLS policies
 	for _, access := range p.normalized.Access {
-		tableName := p.tableName(access.Entity)
+		tableName := p.scope.TableName(access.Entity)
 
 		if access.ReadExpr != "" {
 			migration.CreatePolicies = append(migration.CreatePolicies, &CreatePolicy{
@@ -628,7 +974,7 @@ func (p *Planner) planMigration(plan *Plan) {
 
 	// Create updated_at triggers for all tables
 	for _, entity := range p.normalized.Entities {
-		tableName := p.tableName(entity.Name)
+		tableName := p.scope.TableName(entity.Name)
 		migration.CreateTriggers = append(migration.CreateTriggers, &CreateTrigger{
 			Name:     fmt.Sprintf("%s_updated_at", tableName),
 			Table:    tableName,
@@ -638,68 +984,77 @@ func (p *Planner) planMigration(plan *Plan) {
 		})
 	}
 
+	migration.Schema = &Schema{
+		Types:    migration.CreateTypes,
+		Tables:   migration.CreateTables,
+		Indexes:  migration.CreateIndexes,
+		Policies: migration.CreatePolicies,
+	}
+	for _, mig := range p.normalized.Migrations {
+		migration.Schema.Migrations = append(migration.Schema.Migrations, mig.Name)
+	}
 	plan.Migration = migration
-}
 
-func (p *Planner) planHooks(plan *Plan) {
-	for _, hook := range p.file.Hooks {
-		if len(hook.Target.Parts) < 2 {
-			continue
+	if p.previous != nil {
+		previous, tables, types := p.renameLegacyTables(p.previous)
+		data := p.planDataMigrations(previous, migration.Schema)
+		up := p.diffSchema(previous, migration.Schema)
+		down := p.diffSchema(migration.Schema, previous)
+		for _, dm := range data {
+			dm.exclude(up)
+			dm.exclude(down)
 		}
-
-		entity := hook.Target.Parts[0].Name
-		timing := "after"
-		operation := "create"
-
-		// Parse hook target like "Ticket.after_create"
-		targetPart := hook.Target.Parts[1].Name
-		switch targetPart {
-		case "before_create":
-			timing = "before"
-			operation = "create"
-		case "after_create":
-			timing = "after"
-			operation = "create"
-		case "before_update":
-			timing = "before"
-			operation = "update"
-		case "after_update":
-			timing = "after"
-			operation = "update"
-		case "before_delete":
-			timing = "before"
-			operation = "delete"
-		case "after_delete":
-			timing = "after"
-			operation = "delete"
+		if !up.empty() || len(data) > 0 || len(tables) > 0 {
+			plan.Changes = &SchemaChanges{Up: up, Down: down, Data: data, RenameTables: tables, RenameTypes: types}
 		}
+	}
+}
 
+func (p *Planner) planHooks(plan *Plan) {
+	for _, hook := range p.normalized.Hooks {
 		node := &HookNode{
-			Entity:    entity,
-			Timing:    timing,
-			Operation: operation,
+			Entity:    hook.Entity,
+			Timing:    hook.Timing,
+			Operation: hook.Operation,
+			Jobs:      hook.Jobs,
 		}
 
-		for _, action := range hook.Actions {
-			if action.Kind == "enqueue" && action.Target != nil {
-				node.Jobs = append(node.Jobs, action.Target.Name)
-			}
+		for _, d := range hook.Delayed {
+			node.Delayed = append(node.Delayed, &DelayedJob{Job: d.Job, Delay: d.Delay})
+		}
+
+		for _, step := range hook.Steps {
+			node.Steps = append(node.Steps, &HookStep{
+				Kind:      step.Kind,
+				Target:    step.Target,
+				Value:     step.Value,
+				Condition: step.Condition,
+			})
 		}
 
 		plan.Hooks = append(plan.Hooks, node)
 	}
 }
 
-func (p *Planner) tableName(entityName string) string {
-	// Convert PascalCase to snake_case and pluralize
-	var result []rune
-	for i, r := range entityName {
-		if i > 0 && r >= 'A' && r <= 'Z' {
-			result = append(result, '_')
-		}
-		result = append(result, r)
+// joinTable plans the join table of a many relation of entityName: a row per
+// link, keyed by both records and removed with either of them.
+func (p *Planner) joinTable(entityName string, rel *normalizer.NormalizedRelation) *CreateTable {
+	return &CreateTable{
+		Name: rel.JoinTable,
+		Columns: []*Column{
+			{
+				Name:       rel.JoinKey,
+				Type:       "uuid",
+				References: &ForeignKey{Table: p.scope.TableName(entityName), Column: "id", OnDelete: "cascade"},
+			},
+			{
+				Name:       rel.TargetKey,
+				Type:       "uuid",
+				References: &ForeignKey{Table: p.scope.TableName(rel.Target), Column: "id", OnDelete: "cascade"},
+			},
+		},
+		PrimaryKey: rel.JoinKey + ", " + rel.TargetKey,
 	}
-	return strings.ToLower(string(result)) + "s"
 }
 
 // sortTablesByDependencies performs a topological sort of tables based on foreign key references.
@@ -834,7 +1189,7 @@ func (p *Planner) sortTablesByDependencies(tables []*CreateTable) []*CreateTable
 func (p *Planner) sqlType(field *normalizer.NormalizedField, entityName string) string {
 	switch field.Type {
 	case "enum":
-		return fmt.Sprintf("%s_%s", p.tableName(entityName), field.Name)
+		return fmt.Sprintf("%s_%s", p.scope.TableName(entityName), field.Name)
 	default:
 		return field.Type
 	}
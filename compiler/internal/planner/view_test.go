@@ -2,6 +2,7 @@ package planner
 
 import (
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/forge-lang/forge/compiler/internal/analyzer"
@@ -432,9 +433,9 @@ view OpenTickets {
 		t.Fatal("expected view 'OpenTickets' in plan")
 	}
 
-	// Filter should be set (converted from CEL to SQL template)
-	if view.Filter == "" {
-		t.Error("expected non-empty filter")
+	// Filter should be converted from CEL to a SQL template
+	if view.Filter != "(t.status = $1)" {
+		t.Errorf("expected filter '(t.status = $1)', got %q", view.Filter)
 	}
 
 	// Params should contain the extracted param name
@@ -446,6 +447,64 @@ view OpenTickets {
 	}
 }
 
+func TestPlanView_FilterRelation(t *testing.T) {
+	src := `
+app Test { auth: none, database: postgres }
+entity Org { name: string }
+entity Ticket { status: string }
+relation Ticket.org -> Org
+view OrgTickets {
+	source: Ticket
+	fields: status
+	filter: org == param.org_id and status == "open"
+}`
+
+	plan := planFromSource(t, src)
+
+	view := plan.Views["OrgTickets"]
+	want := "((t.org_id = $1) AND (t.status = 'open'))"
+	if view == nil || view.Filter != want {
+		t.Fatalf("expected filter %q, got %+v", want, view)
+	}
+}
+
+func TestPlanView_ParamColumns(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		want   []string
+	}{
+		{"relation", "org == param.org_id", []string{"org_id"}},
+		{"conjunction", "brand_id == param.brand and param.status == status", []string{"brand_id", "status"}},
+		{"other conditions", `org == param.org_id and status == "open"`, nil},
+		{"disjunction", "org == param.org_id or brand_id == param.org_id", nil},
+		{"not a comparison", "status != param.status", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := `
+app Test { auth: none, database: postgres }
+entity Org { name: string }
+entity Ticket { status: string, brand_id: string }
+relation Ticket.org -> Org
+view OrgTickets {
+	source: Ticket
+	fields: status
+	filter: ` + tt.filter + `
+}`
+
+			view := planFromSource(t, src).Views["OrgTickets"]
+			if view == nil {
+				t.Fatal("expected view 'OrgTickets' in plan")
+			}
+			if strings.Join(view.ParamColumns, ",") != strings.Join(tt.want, ",") || (tt.want == nil) != (view.ParamColumns == nil) {
+				t.Errorf("param columns = %v, want %v", view.ParamColumns, tt.want)
+			}
+		})
+	}
+}
+
 func TestPlanView_FieldType(t *testing.T) {
 	src := `
 app Test { auth: none, database: postgres }
@@ -488,3 +547,144 @@ view TicketList {
 		t.Errorf("expected active type 'boolean', got %q", fieldTypes["active"])
 	}
 }
+
+func TestPlanView_Presence(t *testing.T) {
+	src := `
+app Test { auth: password, database: postgres }
+entity User { display_name: string }
+entity Workspace { name: string }
+relation Workspace.members -> User many
+presence UserPresence {
+	source: User
+	status: enum(online, away, offline) = offline
+	scope: workspace
+}
+view OnlineUsers {
+	source: UserPresence
+	fields: user.display_name, status
+	filter: workspace == param.workspace and status != offline
+}`
+
+	plan := planFromSource(t, src)
+
+	view, ok := plan.Views["OnlineUsers"]
+	if !ok {
+		t.Fatal("expected view 'OnlineUsers' in plan")
+	}
+	if !view.Presence {
+		t.Error("expected a presence view")
+	}
+	if len(view.Joins) != 0 || view.Filter != "" {
+		t.Errorf("expected no SQL joins or filter, got %v and %q", view.Joins, view.Filter)
+	}
+	if view.Condition == "" || len(view.Params) != 1 || view.Params[0] != "workspace" {
+		t.Errorf("unexpected condition %q with params %v", view.Condition, view.Params)
+	}
+
+	columns := map[string]string{}
+	for _, f := range view.Fields {
+		columns[f.Name] = f.Column
+	}
+	if columns["user.display_name"] != "user.display_name" || columns["status"] != "status" {
+		t.Errorf("unexpected field columns %v", columns)
+	}
+
+	if len(view.DefaultSort) == 0 || view.DefaultSort[0].Column != "updated_at" || view.DefaultSort[0].Direction != "DESC" {
+		t.Errorf("expected default sort by updated_at DESC, got %+v", view.DefaultSort)
+	}
+
+	want := []string{"User", "UserPresence", "Workspace"}
+	if len(view.Dependencies) != len(want) {
+		t.Fatalf("expected dependencies %v, got %v", want, view.Dependencies)
+	}
+	for i, dep := range want {
+		if view.Dependencies[i] != dep {
+			t.Errorf("expected dependencies %v, got %v", want, view.Dependencies)
+		}
+	}
+}
+
+func TestPlanView_ManyRelation(t *testing.T) {
+	src := `
+app Test { auth: none, database: postgres }
+entity User { email: string }
+entity Organization { name: string }
+relation Organization.members -> User many
+view OrgMembers {
+	source: Organization
+	fields: name, members, members.email
+	filter: param.member in members
+}`
+
+	plan := planFromSource(t, src)
+
+	view := plan.Views["OrgMembers"]
+	if view == nil {
+		t.Fatal("expected view 'OrgMembers' in plan")
+	}
+	if len(view.Joins) != 0 {
+		t.Errorf("many relations must not join the source rows, got %v", view.Joins)
+	}
+
+	columns := map[string]*ResolvedViewField{}
+	for _, f := range view.Fields {
+		columns[f.Name] = f
+	}
+	want := map[string]string{
+		"members":       "(SELECT array_agg(m.user_id ORDER BY m.user_id) FROM organization_members m WHERE m.organization_id = t.id)",
+		"members.email": "(SELECT array_agg(j.email ORDER BY j.id) FROM organization_members m JOIN users j ON j.id = m.user_id WHERE m.organization_id = t.id)",
+	}
+	for name, column := range want {
+		f := columns[name]
+		if f.Column != column {
+			t.Errorf("%s column = %q, want %q", name, f.Column, column)
+		}
+		if f.Filterable || f.Sortable {
+			t.Errorf("%s must be neither filterable nor sortable", name)
+		}
+	}
+
+	if want := "t.id IN (SELECT organization_id FROM organization_members WHERE user_id = $1)"; view.Filter != want {
+		t.Errorf("filter = %q, want %q", view.Filter, want)
+	}
+}
+
+func TestPlanView_FieldRead(t *testing.T) {
+	src := `
+app Test { auth: none, database: postgres }
+entity User {
+	name: string
+	role: enum(agent, admin)
+	ssn: string read: user.role == admin
+}
+entity Ticket { subject: string }
+relation Ticket.owner -> User
+view TicketList {
+	source: Ticket
+	fields: subject, owner.name, owner.ssn
+}`
+
+	plan := planFromSource(t, src)
+
+	view := plan.Views["TicketList"]
+	if view == nil {
+		t.Fatal("expected view 'TicketList' in plan")
+	}
+	columns := map[string]*ResolvedViewField{}
+	for _, f := range view.Fields {
+		columns[f.Name] = f
+	}
+
+	ssn := columns["owner.ssn"]
+	if ssn.Read != "(user.role == admin)" {
+		t.Errorf("owner.ssn read = %q, want %q", ssn.Read, "(user.role == admin)")
+	}
+	if ssn.Filterable || ssn.Sortable {
+		t.Error("owner.ssn must be neither filterable nor sortable")
+	}
+	for _, name := range []string{"subject", "owner.name"} {
+		if f := columns[name]; f.Read != "" || !f.Filterable || !f.Sortable {
+			t.Errorf("%s = %+v, want a field everyone reads", name, f)
+		}
+	}
+}
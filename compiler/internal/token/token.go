@@ -11,11 +11,12 @@ const (
 	COMMENT
 
 	// Literals
-	IDENT   // identifier (e.g., Ticket, subject)
-	INT     // integer literal
-	FLOAT   // float literal
-	STRING  // string literal
-	BOOL    // true, false
+	IDENT    // identifier (e.g., Ticket, subject)
+	INT      // integer literal
+	FLOAT    // float literal
+	DURATION // duration literal (e.g., 30s, 24h, 1h30m)
+	STRING   // string literal
+	BOOL     // true, false
 
 	// Keywords - declarations
 	APP
@@ -32,6 +33,7 @@ const (
 	IMPERATIVE
 	MIGRATE
 	TEST
+	PRESENCE
 
 	// Keywords - modifiers
 	MANY
@@ -122,6 +124,7 @@ const (
 	RPAREN     // )
 	LBRACKET   // [
 	RBRACKET   // ]
+	AT         // @
 	PLUS       // +
 	MINUS      // -
 	STAR       // *
@@ -137,11 +140,12 @@ var tokenNames = map[Type]string{
 	EOF:     "EOF",
 	COMMENT: "COMMENT",
 
-	IDENT:  "IDENT",
-	INT:    "INT",
-	FLOAT:  "FLOAT",
-	STRING: "STRING",
-	BOOL:   "BOOL",
+	IDENT:    "IDENT",
+	INT:      "INT",
+	FLOAT:    "FLOAT",
+	DURATION: "DURATION",
+	STRING:   "STRING",
+	BOOL:     "BOOL",
 
 	APP:        "app",
 	ENTITY:     "entity",
@@ -157,6 +161,7 @@ var tokenNames = map[Type]string{
 	IMPERATIVE: "imperative",
 	MIGRATE:    "migrate",
 	TEST:       "test",
+	PRESENCE:   "presence",
 
 	MANY:    "many",
 	UNIQUE:  "unique",
@@ -235,6 +240,7 @@ var tokenNames = map[Type]string{
 	RPAREN:    ")",
 	LBRACKET:  "[",
 	RBRACKET:  "]",
+	AT:        "@",
 	PLUS:      "+",
 	MINUS:     "-",
 	STAR:      "*",
@@ -268,6 +274,7 @@ var keywords = map[string]Type{
 	"imperative": IMPERATIVE,
 	"migrate":    MIGRATE,
 	"test":       TEST,
+	"presence":   PRESENCE,
 
 	"many":    MANY,
 	"unique":  UNIQUE,
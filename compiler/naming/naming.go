@@ -0,0 +1,136 @@
+// Package naming derives the SQL names of FORGE declarations. The compiler
+// names tables and columns with it and the runtime falls back on it for
+// names an artifact does not carry, so both always agree.
+package naming
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Snake converts a PascalCase or camelCase name to snake_case. A run of
+// capitals is one word: "AuditLog" is "audit_log" and "HTTPRequest" is
+// "http_request".
+func Snake(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prev != '_' && (!unicode.IsUpper(prev) || nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// TableName returns the table of an entity: its snake_case name with the
+// last word in the plural, as "categories" for Category and "people" for
+// Person. An entity may declare another with @table.
+func TableName(entity string) string {
+	snake := Snake(entity)
+	i := strings.LastIndexByte(snake, '_')
+	return snake[:i+1] + Plural(snake[i+1:])
+}
+
+// ForeignKey returns the column holding the target id of a to-one relation,
+// as "author_id" for author. A relation may declare another with @column.
+func ForeignKey(relation string) string {
+	return relation + "_id"
+}
+
+// Plural returns the English plural of a lowercase word. A word that is
+// already plural, as "settings", is returned as is.
+func Plural(word string) string {
+	if word == "" || uncountable[word] {
+		return word
+	}
+	if plural, ok := irregular[word]; ok {
+		return plural
+	}
+	for _, irr := range irregular {
+		if irr == word {
+			return word
+		}
+	}
+
+	for _, rule := range pluralRules {
+		if stem, ok := strings.CutSuffix(word, rule.suffix); ok && (rule.after == nil || rule.after(stem)) {
+			return stem + rule.replace
+		}
+	}
+	return word + "s"
+}
+
+var uncountable = map[string]bool{
+	"equipment":   true,
+	"information": true,
+	"metadata":    true,
+	"data":        true,
+	"feedback":    true,
+	"media":       true,
+	"money":       true,
+	"news":        true,
+	"series":      true,
+	"species":     true,
+	"sheep":       true,
+	"fish":        true,
+	"deer":        true,
+	"staff":       true,
+	"software":    true,
+}
+
+var irregular = map[string]string{
+	"alias":  "aliases",
+	"canvas": "canvases",
+	"person": "people",
+	"man":    "men",
+	"woman":  "women",
+	"child":  "children",
+	"mouse":  "mice",
+	"goose":  "geese",
+	"foot":   "feet",
+	"tooth":  "teeth",
+	"ox":     "oxen",
+	"quiz":   "quizzes",
+	"hero":   "heroes",
+	"potato": "potatoes",
+	"tomato": "tomatoes",
+	"half":   "halves",
+	"knife":  "knives",
+	"leaf":   "leaves",
+	"life":   "lives",
+	"shelf":  "shelves",
+	"wife":   "wives",
+	"wolf":   "wolves",
+}
+
+// pluralRules are tried in order: the first whose suffix ends the word, and
+// whose condition holds for the rest of it, replaces the suffix.
+var pluralRules = []struct {
+	suffix  string
+	replace string
+	after   func(stem string) bool
+}{
+	{"sis", "ses", nil},        // analysis
+	{"ss", "sses", nil},        // address
+	{"us", "uses", nil},        // status
+	{"s", "s", nil},            // settings, already plural
+	{"x", "xes", nil},          // box
+	{"z", "zes", nil},          // waltz
+	{"ch", "ches", nil},        // batch
+	{"sh", "shes", nil},        // wish
+	{"y", "ies", consonantEnd}, // category, but not day
+}
+
+// consonantEnd reports whether stem ends in a consonant, as the stem "categor"
+// of category does.
+func consonantEnd(stem string) bool {
+	if stem == "" {
+		return false
+	}
+	return !strings.ContainsRune("aeiou", rune(stem[len(stem)-1]))
+}
@@ -0,0 +1,54 @@
+package naming
+
+import "testing"
+
+func TestSnake(t *testing.T) {
+	tests := map[string]string{
+		"Ticket":          "ticket",
+		"AuditLog":        "audit_log",
+		"UserPreferences": "user_preferences",
+		"HTTPRequest":     "http_request",
+		"UserID":          "user_id",
+		"org":             "org",
+		"assigned_to":     "assigned_to",
+	}
+	for name, want := range tests {
+		if got := Snake(name); got != want {
+			t.Errorf("Snake(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestTableName(t *testing.T) {
+	tests := map[string]string{
+		"Ticket":            "tickets",
+		"User":              "users",
+		"AuditLog":          "audit_logs",
+		"Category":          "categories",
+		"Person":            "people",
+		"Address":           "addresses",
+		"Status":            "statuses",
+		"Day":               "days",
+		"Box":               "boxes",
+		"Batch":             "batches",
+		"Analysis":          "analyses",
+		"UserPreferences":   "user_preferences",
+		"WorkspaceSettings": "workspace_settings",
+		"SalesPerson":       "sales_people",
+		"Equipment":         "equipment",
+		"HTTPRequest":       "http_requests",
+	}
+	for entity, want := range tests {
+		if got := TableName(entity); got != want {
+			t.Errorf("TableName(%q) = %q, want %q", entity, got, want)
+		}
+	}
+}
+
+func TestPlural_AlreadyPlural(t *testing.T) {
+	for _, word := range []string{"people", "categories", "settings", "children"} {
+		if got := Plural(word); got != word {
+			t.Errorf("Plural(%q) = %q, want it unchanged", word, got)
+		}
+	}
+}
@@ -23,7 +23,6 @@ export interface Workspace {
   owner?: User;
   owner_id: string;
   members?: User[];
-  members_id: string;
 }
 
 export interface Channel {
@@ -39,7 +38,6 @@ export interface Channel {
   workspace?: Workspace;
   workspace_id: string;
   members?: User[];
-  members_id: string;
   creator?: User;
   creator_id: string;
 }
@@ -350,17 +348,18 @@ export class ForgeClient {
   actions = {
     createWorkspace: async (input: CreateWorkspaceInput): Promise<Workspace> => {
       const userId = this.getUserIdFromToken();
-      return this.request<Workspace>('POST', '/api/entities/Workspace', {
+      const workspace = await this.request<Workspace>('POST', '/api/entities/Workspace', {
         name: input.name,
         slug: input.slug,
         description: input.description || '',
         owner_id: userId,
-        members_id: userId,
       });
+      await this.request('POST', `/api/entities/Workspace/${workspace.id}/members`, { id: userId });
+      return workspace;
     },
     createChannel: async (input: CreateChannelInput): Promise<Channel> => {
       const userId = this.getUserIdFromToken();
-      return this.request<Channel>('POST', '/api/entities/Channel', {
+      const channel = await this.request<Channel>('POST', '/api/entities/Channel', {
         workspace_id: input.workspace_id,
         name: input.name,
         slug: input.slug,
@@ -369,8 +368,9 @@ export class ForgeClient {
         is_default: false,
         archived: false,
         creator_id: userId,
-        members_id: userId,
       });
+      await this.request('POST', `/api/entities/Channel/${channel.id}/members`, { id: userId });
+      return channel;
     },
     joinChannel: (input: JoinChannelInput) =>
       this.request<void>('POST', '/api/actions/join_channel', input),
@@ -570,10 +570,13 @@ export class ForgeClient {
       this.wsConnecting = false;
       this.reconnectAttempts = 0;
 
+      // Authenticate before subscribing so pushes are filtered for this user
+      ws.send(JSON.stringify({ type: 'auth', token: this.config.token }));
+
       // Resubscribe to all views
       for (const [viewKey] of this.subscriptions) {
         console.log('[WS] Subscribing to', viewKey);
-        ws.send(JSON.stringify({ type: 'subscribe', view: viewKey }));
+        ws.send(JSON.stringify({ type: 'subscribe', id: viewKey, view: viewKey }));
       }
 
       // Send any pending messages
@@ -590,11 +593,13 @@ export class ForgeClient {
       console.log('[WS] Received:', event.data);
       try {
         const msg = JSON.parse(event.data);
-        if (msg.type === 'data') {
+        // Declared views send a snapshot, then updates; topics send data.
+        // Subscribers refetch on any of them.
+        if (msg.type === 'data' || msg.type === 'snapshot' || msg.type === 'update') {
           const subs = this.subscriptions.get(msg.view);
           console.log('[WS] Data for view', msg.view, 'subscribers:', subs?.length || 0);
           if (subs) {
-            const payload = msg.data || msg.items;
+            const payload = msg.data || msg.items || msg.changes;
             // Notify all subscribers
             for (const sub of subs) {
               sub.options.onData(payload);
@@ -672,10 +677,10 @@ export class ForgeClient {
     if (isFirstSubscriber) {
       if (this.ws?.readyState === WebSocket.OPEN) {
         console.log('[WS] Already open, sending subscribe');
-        this.ws.send(JSON.stringify({ type: 'subscribe', view: viewKey }));
+        this.ws.send(JSON.stringify({ type: 'subscribe', id: viewKey, view: viewKey }));
       } else if (this.wsConnecting) {
         console.log('[WS] Connecting, queueing subscribe');
-        this.pendingMessages.push(JSON.stringify({ type: 'subscribe', view: viewKey }));
+        this.pendingMessages.push(JSON.stringify({ type: 'subscribe', id: viewKey, view: viewKey }));
       } else {
         console.log('[WS] Not connected, starting connection');
         // Reset reconnect attempts when new subscription is added
@@ -693,7 +698,7 @@ export class ForgeClient {
           // Last subscriber removed, unsubscribe from server
           this.subscriptions.delete(viewKey);
           if (this.ws?.readyState === WebSocket.OPEN) {
-            this.ws.send(JSON.stringify({ type: 'unsubscribe', view: viewKey }));
+            this.ws.send(JSON.stringify({ type: 'unsubscribe', id: viewKey, view: viewKey }));
           }
         } else {
           this.subscriptions.set(viewKey, filtered);
@@ -175,7 +175,9 @@ export function useWorkspaceList(): UseQueryResult<WorkspaceListItem[]> {
 
   useEffect(() => {
     const unsubscribe = client.subscribe<WorkspaceListItem>('WorkspaceList', {
-      onData: setData,
+      onData: () => {
+        client.views.workspaceList().then(setData).catch(() => {});
+      },
       onError: setError,
     });
     return unsubscribe;
@@ -214,8 +216,11 @@ export function useChannelList(workspaceId: string | undefined): UseQueryResult<
 
   useEffect(() => {
     if (!workspaceId) return;
-    const unsubscribe = client.subscribe<ChannelListItem>(`ChannelList:${workspaceId}`, {
-      onData: setData,
+    const unsubscribe = client.subscribe<ChannelListItem>(`WorkspaceChannels:${workspaceId}`, {
+      onData: () => {
+        // Pushes carry the changed channel, so refetch the whole list
+        client.views.channelList(workspaceId).then(setData).catch(() => {});
+      },
       onError: setError,
     });
     return unsubscribe;
@@ -257,16 +262,24 @@ export function useMessageFeed(channelId: string | undefined): UseQueryResult<Me
   // WebSocket subscription for real-time updates
   useEffect(() => {
     if (!channelId) return;
-    const unsubscribe = client.subscribe<MessageFeedItem>(`MessageFeed:${channelId}`, {
-      onData: () => {
-        // Refetch to get properly formatted data with author info
-        client.views.messageFeed(channelId).then((result) => {
-          setData(result);
-        }).catch(() => {});
-      },
+    // Refetch to get properly formatted data with author info
+    const refetch = () => {
+      client.views.messageFeed(channelId).then((result) => {
+        setData(result);
+      }).catch(() => {});
+    };
+    const unsubscribe = client.subscribe<MessageFeedItem>(`ChannelMessages:${channelId}`, {
+      onData: refetch,
       onError: setError,
     });
-    return unsubscribe;
+    // New threads change the reply counts
+    const unsubscribeThreads = client.subscribe<unknown>('Thread:create', {
+      onData: refetch,
+    });
+    return () => {
+      unsubscribe();
+      unsubscribeThreads();
+    };
   }, [client, channelId]);
 
   return { data, loading, error, refetch: fetch };
@@ -303,7 +316,7 @@ export function useThreadList(messageId: string | undefined): UseQueryResult<Thr
   // WebSocket subscription for real-time updates
   useEffect(() => {
     if (!messageId) return;
-    const unsubscribe = client.subscribe<ThreadListItem>(`ThreadList:${messageId}`, {
+    const unsubscribe = client.subscribe<ThreadListItem>(`MessageThreads:${messageId}`, {
       onData: () => {
         // Refetch to get properly formatted data
         client.views.threadList(messageId).then(setData).catch(() => {});
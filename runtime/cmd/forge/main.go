@@ -2,12 +2,14 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -44,8 +46,14 @@ func main() {
 		cmdRun(os.Args[2:])
 	case "dev":
 		cmdDev(os.Args[2:])
+	case "test":
+		cmdTest(os.Args[2:])
 	case "migrate":
 		cmdMigrate(os.Args[2:])
+	case "jobs":
+		cmdJobs(os.Args[2:])
+	case "lsp":
+		cmdLSP(os.Args[2:])
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", os.Args[1])
 		printUsage()
@@ -65,7 +73,10 @@ Commands:
   build             Compile .forge files to runtime artifact
   run               Start the runtime server
   dev               Build, run, and watch for changes
+  test              Run test declarations against a throwaway database
   migrate           Show or apply database migrations
+  jobs              List, inspect, replay or discard failed jobs
+  lsp               Start the language server on stdio
   version           Print version information
   help              Show this help
 
@@ -273,7 +284,7 @@ Examples:
 		fatal("no .forge files found")
 	}
 
-	result := forge.Compile(files)
+	result := compile(files, *outDir)
 	if result.HasErrors {
 		printDiagnostics(result.Diagnostics)
 		os.Exit(1)
@@ -527,32 +538,46 @@ Examples:
 	}
 }
 
-// cmdMigrate shows or applies migrations
+// cmdMigrate shows, applies or rolls back migrations
 func cmdMigrate(args []string) {
 	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
 	apply := fs.Bool("apply", false, "Apply pending migrations")
+	plan := fs.Bool("plan", false, "Show the SQL of pending migrations")
+	rollback := fs.Bool("rollback", false, "Roll back the latest applied migration")
+	to := fs.String("to", "", "With -rollback, roll back every migration after this version")
+	allowDangerous := fs.Bool("allow-dangerous", false, "Apply statements that drop or rewrite data")
 	dryRun := fs.Bool("dry-run", false, "Show what would be done without applying")
 	verbose := fs.Bool("verbose", false, "Show detailed output")
 	artifactPath := fs.String("artifact", ".forge-runtime/artifact.json", "Path to artifact.json")
 	databaseURL := fs.String("database", "", "Database URL (overrides config)")
 	fs.Usage = func() {
-		fmt.Print(`Show or apply database migrations
+		fmt.Print(`Show, apply or roll back database migrations
+
+Each build that changes the schema adds a numbered migration to the
+artifact. Applied versions are recorded in the _forge_migrations table.
+Migrations run in one transaction under an advisory lock.
 
 Usage:
   forge migrate [options]
 
 Options:
-  -apply           Apply pending migrations (default: show only)
-  -dry-run         Show what would be done without applying
-  -verbose         Show detailed output
-  -artifact path   Path to artifact.json
-  -database url    Database URL (overrides forge.toml and env)
+  -apply             Apply pending migrations (default: show status)
+  -plan              Show the SQL of pending migrations
+  -rollback          Roll back the latest applied migration
+  -to version        With -rollback, roll back every migration after version
+  -allow-dangerous   Apply statements that drop tables, columns or change types
+  -dry-run           Show what would be done without applying
+  -verbose           Show detailed output
+  -artifact path     Path to artifact.json
+  -database url      Database URL (overrides forge.runtime.toml and env)
 
 Examples:
-  forge migrate                    # Show pending migrations
-  forge migrate -apply             # Apply migrations
-  forge migrate -apply -dry-run    # Show what would be applied
-  forge migrate -apply -verbose    # Apply with detailed output
+  forge migrate                         # Show pending migrations
+  forge migrate -plan                   # Show the SQL that would run
+  forge migrate -apply                  # Apply migrations
+  forge migrate -apply -allow-dangerous # Apply migrations that drop data
+  forge migrate -rollback               # Revert the latest migration
+  forge migrate -rollback -to 002       # Revert everything after 002
 `)
 	}
 	fs.Parse(args)
@@ -563,16 +588,21 @@ Examples:
 		fatal("failed to get working directory: %v", err)
 	}
 
-	if *apply {
-		// Apply migrations using the runtime API
-		cfg := &runtimeforge.MigrationConfig{
-			ArtifactPath: *artifactPath,
-			ProjectDir:   projectDir,
-			DatabaseURL:  *databaseURL,
-			DryRun:       *dryRun,
-			Verbose:      *verbose,
-		}
+	cfg := &runtimeforge.MigrationConfig{
+		ArtifactPath:   *artifactPath,
+		ProjectDir:     projectDir,
+		DatabaseURL:    *databaseURL,
+		DryRun:         *dryRun,
+		Verbose:        *verbose,
+		AllowDangerous: *allowDangerous,
+		RollbackTo:     *to,
+	}
 
+	switch {
+	case *apply && *rollback:
+		fatal("-apply and -rollback cannot be combined")
+
+	case *apply:
 		if *dryRun {
 			fmt.Println("Dry run - showing what would be applied...")
 		} else {
@@ -589,8 +619,13 @@ Examples:
 		}
 
 		if *dryRun {
-			fmt.Printf("Would apply %d statements\n", result.Applied)
+			fmt.Printf("Would apply %s (%d statements)\n", versionList(result.Versions), result.Applied)
 		} else {
+			if len(result.Versions) > 0 {
+				fmt.Printf("Applied versions: %s\n", strings.Join(result.Versions, ", "))
+			} else {
+				fmt.Println("Database is up to date.")
+			}
 			fmt.Printf("Applied: %d statements\n", result.Applied)
 			if result.Skipped > 0 {
 				fmt.Printf("Skipped: %d statements (already applied)\n", result.Skipped)
@@ -598,13 +633,22 @@ Examples:
 			fmt.Printf("Duration: %v\n", result.Duration)
 			fmt.Println("Migration complete!")
 		}
-	} else {
-		// Just show migration status
-		cfg := &runtimeforge.MigrationConfig{
-			ArtifactPath: *artifactPath,
-			ProjectDir:   projectDir,
+
+	case *rollback:
+		result, err := runtimeforge.RollbackMigration(cfg)
+		if err != nil {
+			fatal("Rollback failed: %v", err)
+		}
+
+		if *dryRun {
+			fmt.Printf("Would roll back %s (%d statements)\n", versionList(result.Versions), result.Applied)
+		} else {
+			fmt.Printf("Rolled back: %s\n", versionList(result.Versions))
+			fmt.Printf("Duration: %v\n", result.Duration)
 		}
 
+	default:
+		// Just show migration status
 		status, err := runtimeforge.CheckMigration(cfg)
 		if err != nil {
 			fatal("Failed to check migrations: %v", err)
@@ -616,6 +660,21 @@ Examples:
 		}
 
 		fmt.Printf("Migration version: %s\n", status.ArtifactVersion)
+		if status.DatabaseError != nil {
+			fmt.Printf("Could not read applied versions (%v); listing every migration.\n", status.DatabaseError)
+		} else {
+			fmt.Printf("Applied versions: %s\n", versionList(status.AppliedVersions))
+		}
+		for _, step := range status.PendingSteps {
+			fmt.Printf("Pending: %s\n", step.Version)
+			if *plan {
+				fmt.Println("---")
+				for _, stmt := range step.Statements {
+					fmt.Println(stmt)
+				}
+				fmt.Println("---")
+			}
+		}
 		fmt.Printf("Pending statements: %d\n", status.PendingStatements)
 
 		if len(status.DangerousChanges) > 0 {
@@ -626,13 +685,294 @@ Examples:
 		}
 
 		if status.HasPendingChanges {
-			fmt.Println("\nRun 'forge migrate -apply' to apply these migrations.")
+			if len(status.DangerousChanges) > 0 {
+				fmt.Println("\nRun 'forge migrate -apply -allow-dangerous' to apply these migrations.")
+			} else {
+				fmt.Println("\nRun 'forge migrate -apply' to apply these migrations.")
+			}
 		} else {
 			fmt.Println("\nNo pending migrations.")
 		}
 	}
 }
 
+// cmdTest runs the test declarations of the project
+func cmdTest(args []string) {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	databaseURL := fs.String("database", "", "Database URL (default: ephemeral embedded database)")
+	verbose := fs.Bool("v", false, "Show passing tests")
+	fs.Usage = func() {
+		fmt.Print(`Run test declarations against a throwaway database
+
+Each test seeds its given values, performs its when operation through the
+same pipeline as the HTTP API, and checks its expect clause. Tests run
+against an ephemeral embedded database with the artifact's migrations
+applied, and each test starts from empty tables. Jobs are not executed.
+
+Usage:
+  forge test [options] [files...]
+
+Options:
+  -database url    Run against this database instead (its entity tables are emptied)
+  -v               Show passing tests
+
+If no files are specified, all .forge files in the current directory are used.
+Exits with status 1 if any test fails.
+
+Examples:
+  forge test
+  forge test -v
+`)
+	}
+	fs.Parse(args)
+
+	paths := fs.Args()
+	var files []string
+	var err error
+	if len(paths) == 0 {
+		files, err = findForgeFiles(".")
+		if err != nil {
+			fatal("failed to find .forge files: %v", err)
+		}
+	} else {
+		files, err = resolveForgeFiles(paths)
+		if err != nil {
+			fatal("%v", err)
+		}
+	}
+
+	if len(files) == 0 {
+		fatal("no .forge files found")
+	}
+
+	suite := forge.Tests(files)
+	if suite.HasErrors {
+		printDiagnostics(suite.Diagnostics)
+		os.Exit(1)
+	}
+	if len(suite.Tests) == 0 {
+		fmt.Println("no tests found")
+		return
+	}
+
+	// Tests always run against a fresh migration history
+	result := forge.Compile(files)
+	if result.HasErrors {
+		printDiagnostics(result.Diagnostics)
+		os.Exit(1)
+	}
+	tmpDir, err := os.MkdirTemp("", "forge-test-*")
+	if err != nil {
+		fatal("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	artifactPath := filepath.Join(tmpDir, "artifact.json")
+	if err := os.WriteFile(artifactPath, []byte(result.Output.ArtifactJSON), 0644); err != nil {
+		fatal("failed to write artifact: %v", err)
+	}
+
+	projectDir, err := os.Getwd()
+	if err != nil {
+		fatal("failed to get working directory: %v", err)
+	}
+
+	tests := make([]*runtimeforge.TestCase, len(suite.Tests))
+	for i, tc := range suite.Tests {
+		tests[i] = &runtimeforge.TestCase{
+			Name:   tc.Name,
+			When:   runtimeforge.TestWhen{Operation: tc.When.Operation, Target: tc.When.Target},
+			Expect: runtimeforge.TestExpect{Reject: tc.Expect.Reject, Message: tc.Expect.Message},
+		}
+		for _, g := range tc.Given {
+			tests[i].Given = append(tests[i].Given, runtimeforge.TestValue{Entity: g.Entity, Field: g.Field, Value: g.Value})
+		}
+		tests[i].Expect.TestValue = runtimeforge.TestValue{Entity: tc.Expect.Entity, Field: tc.Expect.Field, Value: tc.Expect.Value}
+	}
+
+	start := time.Now()
+	results, err := runtimeforge.RunTests(&runtimeforge.TestConfig{
+		ArtifactPath: artifactPath,
+		ProjectDir:   projectDir,
+		DatabaseURL:  *databaseURL,
+	}, tests)
+	if err != nil {
+		fatal("failed to start test runtime: %v", err)
+	}
+
+	failed := 0
+	for i, r := range results {
+		tc := suite.Tests[i]
+		loc := fmt.Sprintf("%s:%d:%d", tc.Filename, tc.Line, tc.Column)
+		if r.Passed {
+			if *verbose {
+				fmt.Printf("PASS  %s  %s (%s)\n", loc, r.Name, r.Duration.Round(time.Millisecond))
+			}
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL  %s  %s\n      %s\n", loc, r.Name, r.Message)
+	}
+
+	fmt.Printf("\n%d passed, %d failed (%s)\n", len(results)-failed, failed, time.Since(start).Round(time.Millisecond))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// versionList formats migration versions for display.
+func versionList(versions []string) string {
+	if len(versions) == 0 {
+		return "none"
+	}
+	return strings.Join(versions, ", ")
+}
+
+// cmdJobs manages jobs that exhausted their attempts
+func cmdJobs(args []string) {
+	fs := flag.NewFlagSet("jobs", flag.ExitOnError)
+	limit := fs.Int("limit", 50, "Maximum number of jobs to list")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	databaseURL := fs.String("database", "", "Database URL (overrides config)")
+	fs.Usage = func() {
+		fmt.Print(`List, inspect, replay or discard failed jobs
+
+Jobs that exhaust their attempts are kept in the dead-letter store. This
+command reads the postgres job queue (jobs.backend = "postgres"); for the
+in-memory queue use /_dev/jobs/dead on the running server.
+
+Usage:
+  forge jobs list [options]
+  forge jobs inspect [options] <id>
+  forge jobs replay [options] <id>
+  forge jobs discard [options] <id>
+
+Options:
+  -limit n         Maximum number of jobs to list (default: 50)
+  -json            Print JSON
+  -database url    Database URL (overrides forge.toml and env)
+
+Examples:
+  forge jobs list                  # Show recently failed jobs
+  forge jobs inspect job_1234      # Show payload and error history
+  forge jobs replay job_1234       # Run the job again
+  forge jobs discard job_1234      # Delete the job
+`)
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	sub := args[0]
+	fs.Parse(args[1:])
+
+	projectDir, err := os.Getwd()
+	if err != nil {
+		fatal("failed to get working directory: %v", err)
+	}
+	cfg := &runtimeforge.JobsConfig{
+		ProjectDir:  projectDir,
+		DatabaseURL: *databaseURL,
+	}
+
+	id := fs.Arg(0)
+	if (sub == "inspect" || sub == "replay" || sub == "discard") && id == "" {
+		fatal("forge jobs %s requires a job id", sub)
+	}
+
+	switch sub {
+	case "list":
+		dead, err := runtimeforge.ListDeadJobs(cfg, *limit)
+		if err != nil {
+			fatal("Failed to list jobs: %v", err)
+		}
+		if *asJSON {
+			printJSON(dead)
+			return
+		}
+		if len(dead) == 0 {
+			fmt.Println("No failed jobs.")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tJOB\tCAPABILITY\tATTEMPTS\tFAILED AT\tLAST ERROR")
+		for _, j := range dead {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d/%d\t%s\t%s\n",
+				j.ID, j.Name, j.Capability, j.Attempts, j.MaxAttempts,
+				j.FailedAt.Local().Format(time.DateTime), j.LastError)
+		}
+		tw.Flush()
+
+	case "inspect":
+		j, err := runtimeforge.InspectDeadJob(cfg, id)
+		if err != nil {
+			fatal("Failed to inspect job: %v", err)
+		}
+		if *asJSON {
+			printJSON(j)
+			return
+		}
+		fmt.Printf("ID:          %s\n", j.ID)
+		fmt.Printf("Job:         %s\n", j.Name)
+		fmt.Printf("Capability:  %s\n", j.Capability)
+		if j.TargetEntity != "" {
+			fmt.Printf("Creates:     %s\n", j.TargetEntity)
+		}
+		fmt.Printf("Attempts:    %d/%d\n", j.Attempts, j.MaxAttempts)
+		fmt.Printf("Enqueued:    %s\n", j.EnqueuedAt.Local().Format(time.DateTime))
+		fmt.Printf("Failed:      %s\n", j.FailedAt.Local().Format(time.DateTime))
+		fmt.Println("\nPayload:")
+		printJSON(j.Data)
+		fmt.Println("\nErrors:")
+		for _, e := range j.Errors {
+			fmt.Printf("  #%d  %s  %s\n", e.Attempt, e.At.Local().Format(time.DateTime), e.Error)
+		}
+
+	case "replay":
+		if err := runtimeforge.ReplayDeadJob(cfg, id); err != nil {
+			fatal("Failed to replay job: %v", err)
+		}
+		fmt.Printf("Job %s queued for replay.\n", id)
+
+	case "discard":
+		if err := runtimeforge.DiscardDeadJob(cfg, id); err != nil {
+			fatal("Failed to discard job: %v", err)
+		}
+		fmt.Printf("Job %s discarded.\n", id)
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown jobs command: %s\n\n", sub)
+		fs.Usage()
+		os.Exit(1)
+	}
+}
+
+// cmdLSP serves the language server over stdio
+func cmdLSP(args []string) {
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Print(`Start the language server
+
+Speaks the Language Server Protocol over stdin and stdout. Editors start it
+as a subprocess; each directory of .forge files is analyzed as one app.
+
+Usage:
+  forge lsp
+
+Provides:
+  diagnostics as you type, with quick fixes for misspelled names
+  go to definition and hover for entities, fields, relations, messages,
+  jobs, actions, views and webhooks
+  completion of field paths in rules, access and other expressions
+`)
+	}
+	fs.Parse(args)
+
+	if err := forge.ServeLSP(os.Stdin, os.Stdout); err != nil {
+		fatal("language server: %v", err)
+	}
+}
+
 // ============================================================================
 // Helper Functions
 // ============================================================================
@@ -688,9 +1028,16 @@ func resolveForgeFiles(paths []string) ([]string, error) {
 	return files, nil
 }
 
+// compile compiles files against the artifact of the previous build in
+// outDir, so schema changes are appended to its migration history.
+func compile(files []string, outDir string) *forge.CompileResult {
+	previous, _ := os.ReadFile(filepath.Join(outDir, "artifact.json"))
+	return forge.CompileIncremental(files, previous)
+}
+
 // build compiles files and writes output, returns true on success
 func build(files []string, outDir string) bool {
-	result := forge.Compile(files)
+	result := compile(files, outDir)
 	if result.HasErrors {
 		printDiagnostics(result.Diagnostics)
 		return false
@@ -730,6 +1077,12 @@ func printDiagnostics(diags []forge.Diagnostic) {
 	}
 }
 
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
 func fatal(format string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
 	os.Exit(1)
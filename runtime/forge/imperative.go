@@ -0,0 +1,37 @@
+package forge
+
+import (
+	"github.com/forge-lang/forge/runtime/internal/imperative"
+)
+
+// ImperativeFunc implements an imperative declared in the app spec.
+//
+//	func init() {
+//	    forge.RegisterImperative("export_csv", func(ctx *forge.ImperativeContext, input map[string]any) (any, error) {
+//	        rows, err := ctx.Query("SELECT subject, status FROM tickets")
+//	        if err != nil {
+//	            return nil, err
+//	        }
+//	        return renderCSV(rows), nil // []byte is sent as-is
+//	    })
+//	}
+type ImperativeFunc = imperative.Func
+
+// ImperativeContext is what an imperative function can reach: read-only
+// queries as the calling user, and the effects its declaration lists.
+type ImperativeContext = imperative.Context
+
+// ImperativeError rejects a call with a message the client may see.
+type ImperativeError = imperative.Error
+
+// ErrUndeclaredEffect is returned by ImperativeContext.Effect for effects
+// the declaration does not list.
+var ErrUndeclaredEffect = imperative.ErrUndeclaredEffect
+
+// RegisterImperative registers the function implementing the imperative
+// name. Call it from init(): the server refuses to start if the artifact
+// declares an imperative that has no registered function.
+// Panics if name is already registered.
+func RegisterImperative(name string, fn ImperativeFunc) {
+	imperative.Register(name, fn)
+}
@@ -0,0 +1,103 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/forge-lang/forge/runtime/internal/config"
+	"github.com/forge-lang/forge/runtime/internal/db"
+	"github.com/forge-lang/forge/runtime/internal/jobs"
+)
+
+// DeadJob is a job that exhausted its attempts.
+type DeadJob = jobs.DeadJob
+
+// AttemptError records why one attempt of a job failed.
+type AttemptError = jobs.AttemptError
+
+// ErrJobNotFound is returned when no failed job has the given ID.
+var ErrJobNotFound = jobs.ErrJobNotFound
+
+// JobsConfig holds configuration for dead-letter job operations.
+type JobsConfig struct {
+	ProjectDir  string
+	DatabaseURL string // Optional override
+}
+
+// ListDeadJobs returns up to limit failed jobs, most recently failed first.
+func ListDeadJobs(cfg *JobsConfig, limit int) ([]*DeadJob, error) {
+	var dead []*DeadJob
+	err := withDeadLetters(cfg, func(ctx context.Context, q *jobs.PostgresQueue) error {
+		var err error
+		dead, err = q.ListDead(ctx, limit)
+		return err
+	})
+	return dead, err
+}
+
+// InspectDeadJob returns a failed job with its payload and error history.
+func InspectDeadJob(cfg *JobsConfig, id string) (*DeadJob, error) {
+	var dead *DeadJob
+	err := withDeadLetters(cfg, func(ctx context.Context, q *jobs.PostgresQueue) error {
+		var err error
+		dead, err = q.GetDead(ctx, id)
+		return err
+	})
+	return dead, err
+}
+
+// ReplayDeadJob returns a failed job to the queue with its attempts reset.
+// A running server picks it up on its next poll.
+func ReplayDeadJob(cfg *JobsConfig, id string) error {
+	return withDeadLetters(cfg, func(ctx context.Context, q *jobs.PostgresQueue) error {
+		return q.Replay(ctx, id)
+	})
+}
+
+// DiscardDeadJob deletes a failed job.
+func DiscardDeadJob(cfg *JobsConfig, id string) error {
+	return withDeadLetters(cfg, func(ctx context.Context, q *jobs.PostgresQueue) error {
+		return q.Discard(ctx, id)
+	})
+}
+
+// withDeadLetters connects to the project's job queue database and runs fn.
+// Only the postgres backend keeps failed jobs outside the server process.
+func withDeadLetters(cfg *JobsConfig, fn func(context.Context, *jobs.PostgresQueue) error) error {
+	runtimeConf, err := config.Load(cfg.ProjectDir)
+	if err != nil {
+		runtimeConf = config.LoadFromEnv()
+	}
+
+	if runtimeConf.Jobs.Backend != "postgres" {
+		return fmt.Errorf("jobs backend is %q: failed jobs are only stored in the database with jobs.backend = \"postgres\" (use /_dev/jobs/dead for the in-memory queue)", runtimeConf.Jobs.Backend)
+	}
+
+	// Override database URL if provided
+	if cfg.DatabaseURL != "" {
+		runtimeConf.Database.Adapter = "postgres"
+		runtimeConf.Database.Postgres.URL = cfg.DatabaseURL
+	}
+
+	runtimeConf.ResolveSecrets()
+
+	database, err := db.New(&runtimeConf.Database)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := database.Connect(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer database.Close()
+
+	queue, err := jobs.NewPostgresQueue(ctx, database)
+	if err != nil {
+		return err
+	}
+	return fn(ctx, queue)
+}
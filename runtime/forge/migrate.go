@@ -4,9 +4,11 @@ package forge
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/forge-lang/forge/runtime/internal/config"
@@ -16,6 +18,7 @@ import (
 // MigrationResult contains the result of a migration operation.
 type MigrationResult struct {
 	Version  string
+	Versions []string // migration versions applied (or rolled back) by this run
 	Applied  int
 	Skipped  int
 	Duration time.Duration
@@ -24,95 +27,143 @@ type MigrationResult struct {
 
 // MigrationConfig holds configuration for migration operations.
 type MigrationConfig struct {
-	ArtifactPath string
-	ProjectDir   string
-	DatabaseURL  string // Optional override
-	DryRun       bool   // If true, show what would be done without applying
-	Verbose      bool   // If true, log each statement
+	ArtifactPath   string
+	ProjectDir     string
+	DatabaseURL    string // Optional override
+	DryRun         bool   // If true, show what would be done without applying
+	Verbose        bool   // If true, log each statement
+	AllowDangerous bool   // If true, apply statements flagged as dangerous
+	RollbackTo     string // Version to roll back to; empty rolls back the latest step
 }
 
-// ApplyMigration loads the artifact and applies migrations to the database.
+// MigrationStep is a versioned migration and the statements it runs.
+type MigrationStep struct {
+	Version    string
+	Statements []string
+}
+
+// ErrDangerousMigration is returned when a migration contains dangerous
+// statements and MigrationConfig.AllowDangerous is not set.
+var ErrDangerousMigration = errors.New("migration contains dangerous changes (review them with 'forge migrate -plan' and rerun with -allow-dangerous)")
+
+// errDatabaseUnavailable wraps failures to reach the database. Read-only
+// operations then fall back to treating every step as pending.
+var errDatabaseUnavailable = errors.New("database unavailable")
+
+// ApplyMigration loads the artifact and applies the pending migration steps
+// to the database in one transaction. With DryRun it only counts them.
 func ApplyMigration(cfg *MigrationConfig) (*MigrationResult, error) {
 	start := time.Now()
 	result := &MigrationResult{}
 
-	// Load artifact
-	artifactData, err := os.ReadFile(cfg.ArtifactPath)
+	migration, err := loadMigration(cfg.ArtifactPath)
 	if err != nil {
-		result.Error = fmt.Errorf("failed to load artifact: %w", err)
+		result.Error = err
 		return result, result.Error
 	}
-
-	var artifact struct {
-		Migration *db.Migration `json:"migration"`
-	}
-	if err := json.Unmarshal(artifactData, &artifact); err != nil {
-		result.Error = fmt.Errorf("failed to parse artifact: %w", err)
-		return result, result.Error
-	}
-
-	if artifact.Migration == nil {
+	if migration == nil {
 		return result, nil // No migrations to apply
 	}
+	result.Version = migration.Version
 
-	result.Version = artifact.Migration.Version
-
-	// If dry run, just return the plan
+	// If dry run, just report the pending steps. Without a database every
+	// step is pending.
 	if cfg.DryRun {
-		result.Applied = len(artifact.Migration.Up)
+		status, err := CheckMigration(cfg)
+		if err != nil {
+			result.Error = err
+			return result, result.Error
+		}
+		for _, step := range status.PendingSteps {
+			result.Versions = append(result.Versions, step.Version)
+		}
+		result.Applied = status.PendingStatements
 		return result, nil
 	}
 
-	// Load runtime configuration
-	runtimeConf, err := config.Load(cfg.ProjectDir)
+	err = withMigrationDB(cfg, func(ctx context.Context, database db.Database, logger *slog.Logger) error {
+		migrationResult, err := db.ApplyMigrations(ctx, database, migration, cfg.AllowDangerous, logger)
+		var dangerous *db.DangerousMigrationError
+		if errors.As(err, &dangerous) {
+			return ErrDangerousMigration
+		}
+		if err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+		result.Versions = migrationResult.Versions
+		result.Applied = migrationResult.Applied
+		result.Skipped = migrationResult.Skipped
+		return nil
+	})
 	if err != nil {
-		runtimeConf = config.LoadFromEnv()
+		result.Error = err
+		return result, result.Error
 	}
 
-	// Override database URL if provided
-	if cfg.DatabaseURL != "" {
-		runtimeConf.Database.Adapter = "postgres"
-		runtimeConf.Database.Postgres.URL = cfg.DatabaseURL
-	}
+	result.Duration = time.Since(start)
+	return result, nil
+}
 
-	// Resolve secrets from environment
-	runtimeConf.ResolveSecrets()
+// RollbackMigration reverts applied migration steps using the Down
+// statements the artifact carries: the latest step, or every step after
+// cfg.RollbackTo. With DryRun it only counts them.
+func RollbackMigration(cfg *MigrationConfig) (*MigrationResult, error) {
+	start := time.Now()
+	result := &MigrationResult{}
 
-	// Create database connection
-	database, err := db.New(&runtimeConf.Database)
+	migration, err := loadMigration(cfg.ArtifactPath)
 	if err != nil {
-		result.Error = fmt.Errorf("failed to create database: %w", err)
+		result.Error = err
 		return result, result.Error
 	}
-
-	// Connect to database
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	if err := database.Connect(ctx); err != nil {
-		result.Error = fmt.Errorf("failed to connect to database: %w", err)
+	if migration == nil {
+		result.Error = errors.New("artifact has no migrations")
 		return result, result.Error
 	}
-	defer database.Close()
 
-	// Setup logger
-	logLevel := slog.LevelInfo
-	if cfg.Verbose {
-		logLevel = slog.LevelDebug
-	}
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
+	err = withMigrationDB(cfg, func(ctx context.Context, database db.Database, logger *slog.Logger) error {
+		applied, err := db.GetAppliedMigrations(ctx, database)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			return errors.New("no migrations have been applied")
+		}
+		steps, err := db.RollbackSteps(migration, applied, cfg.RollbackTo)
+		if err != nil {
+			return err
+		}
+
+		var stmts []string
+		for _, step := range steps {
+			stmts = append(stmts, step.Down...)
+		}
+		if len(db.ValidateStatements(stmts)) > 0 && !cfg.AllowDangerous {
+			return ErrDangerousMigration
+		}
 
-	// Apply migration
-	migrationResult, err := db.ApplyMigrationWithLog(ctx, database, artifact.Migration, logger)
+		if cfg.DryRun {
+			for _, step := range steps {
+				result.Versions = append(result.Versions, step.Version)
+				result.Applied += countStatements(step.Down)
+			}
+			return nil
+		}
+
+		rollbackResult, err := db.RollbackMigrations(ctx, database, steps, logger)
+		if err != nil {
+			return fmt.Errorf("rollback failed: %w", err)
+		}
+		result.Versions = rollbackResult.Versions
+		result.Applied = rollbackResult.Applied
+		return nil
+	})
 	if err != nil {
-		result.Error = fmt.Errorf("migration failed: %w", err)
+		result.Error = err
 		return result, result.Error
 	}
 
-	result.Applied = migrationResult.Applied
-	result.Skipped = migrationResult.Skipped
 	result.Duration = time.Since(start)
-
 	return result, nil
 }
 
@@ -121,8 +172,10 @@ type MigrationStatus struct {
 	ArtifactVersion    string
 	PendingStatements  int
 	AppliedVersions    []string
+	PendingSteps       []MigrationStep
 	HasPendingChanges  bool
 	DangerousChanges   []DangerousChange
+	DatabaseError      error // set when the database could not be reached; every step is then pending
 }
 
 type DangerousChange struct {
@@ -130,12 +183,58 @@ type DangerousChange struct {
 	Reason    string
 }
 
-// CheckMigration checks the migration status without applying changes.
+// CheckMigration compares the artifact's migration steps with the versions
+// recorded in the database, without applying changes. If the database
+// cannot be reached, every step is reported as pending and DatabaseError
+// is set.
 func CheckMigration(cfg *MigrationConfig) (*MigrationStatus, error) {
 	status := &MigrationStatus{}
 
-	// Load artifact
-	artifactData, err := os.ReadFile(cfg.ArtifactPath)
+	migration, err := loadMigration(cfg.ArtifactPath)
+	if err != nil {
+		return nil, err
+	}
+	if migration == nil {
+		return status, nil
+	}
+	status.ArtifactVersion = migration.Version
+
+	var applied []string
+	err = withMigrationDB(cfg, func(ctx context.Context, database db.Database, logger *slog.Logger) error {
+		var err error
+		applied, err = db.GetAppliedMigrations(ctx, database)
+		return err
+	})
+	if errors.Is(err, errDatabaseUnavailable) {
+		status.DatabaseError = err
+	} else if err != nil {
+		return nil, err
+	}
+	status.AppliedVersions = applied
+
+	var stmts []string
+	for _, step := range db.PendingSteps(migration, applied) {
+		status.PendingSteps = append(status.PendingSteps, MigrationStep{Version: step.Version, Statements: step.Up})
+		status.PendingStatements += countStatements(step.Up)
+		stmts = append(stmts, step.Up...)
+	}
+	status.HasPendingChanges = len(status.PendingSteps) > 0
+
+	// Check for dangerous changes
+	for _, d := range db.ValidateStatements(stmts) {
+		status.DangerousChanges = append(status.DangerousChanges, DangerousChange{
+			Statement: d.Statement,
+			Reason:    d.Reason,
+		})
+	}
+
+	return status, nil
+}
+
+// loadMigration reads the migration from the artifact at path. It returns
+// nil if the artifact has none.
+func loadMigration(path string) (*db.Migration, error) {
+	artifactData, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load artifact: %w", err)
 	}
@@ -146,23 +245,60 @@ func CheckMigration(cfg *MigrationConfig) (*MigrationStatus, error) {
 	if err := json.Unmarshal(artifactData, &artifact); err != nil {
 		return nil, fmt.Errorf("failed to parse artifact: %w", err)
 	}
+	return artifact.Migration, nil
+}
 
-	if artifact.Migration == nil {
-		return status, nil
+// withMigrationDB connects to the project's database and runs fn.
+func withMigrationDB(cfg *MigrationConfig, fn func(context.Context, db.Database, *slog.Logger) error) error {
+	// Load runtime configuration
+	runtimeConf, err := config.Load(cfg.ProjectDir)
+	if err != nil {
+		runtimeConf = config.LoadFromEnv()
 	}
 
-	status.ArtifactVersion = artifact.Migration.Version
-	status.PendingStatements = len(artifact.Migration.Up)
-	status.HasPendingChanges = len(artifact.Migration.Up) > 0
+	// Override database URL if provided
+	if cfg.DatabaseURL != "" {
+		runtimeConf.Database.Adapter = "postgres"
+		runtimeConf.Database.Postgres.URL = cfg.DatabaseURL
+	}
 
-	// Check for dangerous changes
-	dangerous := db.ValidateMigration(artifact.Migration)
-	for _, d := range dangerous {
-		status.DangerousChanges = append(status.DangerousChanges, DangerousChange{
-			Statement: d.Statement,
-			Reason:    d.Reason,
-		})
+	// Resolve secrets from environment
+	runtimeConf.ResolveSecrets()
+
+	// Create database connection
+	database, err := db.New(&runtimeConf.Database)
+	if err != nil {
+		return fmt.Errorf("%w: failed to create database: %w", errDatabaseUnavailable, err)
 	}
 
-	return status, nil
+	// Connect to database
+	connectCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := database.Connect(connectCtx); err != nil {
+		return fmt.Errorf("%w: failed to connect to database: %w", errDatabaseUnavailable, err)
+	}
+	defer database.Close()
+
+	// Setup logger
+	logLevel := slog.LevelInfo
+	if cfg.Verbose {
+		logLevel = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
+
+	// Migrations are not bounded by the connect timeout
+	return fn(context.Background(), database, logger)
+}
+
+// countStatements counts the statements in stmts, skipping blanks and comments.
+func countStatements(stmts []string) int {
+	n := 0
+	for _, stmt := range stmts {
+		stmt = strings.TrimSpace(stmt)
+		if stmt != "" && !strings.HasPrefix(stmt, "--") {
+			n++
+		}
+	}
+	return n
 }
@@ -0,0 +1,53 @@
+package forge
+
+import (
+	"context"
+
+	"github.com/forge-lang/forge/runtime/internal/server"
+)
+
+// TestCase is a compiled test declaration to run against the runtime.
+type TestCase = server.TestCase
+
+// TestValue is a field value a test seeds or expects.
+type TestValue = server.TestValue
+
+// TestWhen is the operation a test performs.
+type TestWhen = server.TestWhen
+
+// TestExpect is the outcome a test asserts.
+type TestExpect = server.TestExpect
+
+// TestResult is the outcome of one test.
+type TestResult = server.TestResult
+
+// TestConfig holds configuration for running tests.
+type TestConfig struct {
+	ArtifactPath string
+	ProjectDir   string
+	DatabaseURL  string // Optional; defaults to an ephemeral embedded database
+}
+
+// RunTests starts the runtime against a test database, applies the
+// artifact's migrations and runs each test in order through the same
+// request pipeline as the HTTP API. A test failure is reported in its
+// result; the error is only set if the runtime could not start.
+func RunTests(cfg *TestConfig, tests []*TestCase) ([]*TestResult, error) {
+	srv, err := server.New(&server.Config{
+		ArtifactPath: cfg.ArtifactPath,
+		DatabaseURL:  cfg.DatabaseURL,
+		ProjectDir:   cfg.ProjectDir,
+		Testing:      true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer srv.Close()
+
+	ctx := context.Background()
+	results := make([]*TestResult, 0, len(tests))
+	for _, tc := range tests {
+		results = append(results, srv.RunTest(ctx, tc))
+	}
+	return results, nil
+}
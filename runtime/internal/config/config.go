@@ -31,6 +31,12 @@ type Config struct {
 	// Jobs configuration for background processing
 	Jobs JobsConfig `toml:"jobs"`
 
+	// Realtime configuration for WebSocket pushes across replicas
+	Realtime RealtimeConfig `toml:"realtime"`
+
+	// Presence configuration for the presence store
+	Presence PresenceConfig `toml:"presence"`
+
 	// Auth configuration for identity management
 	Auth AuthConfig `toml:"auth"`
 
@@ -76,6 +82,32 @@ type JobsConfig struct {
 
 	// Concurrency is the number of concurrent workers
 	Concurrency int `toml:"concurrency"`
+
+	// VisibilityTimeoutSeconds is how long a leased job stays hidden from
+	// other workers before it is handed out again (postgres backend, default 300)
+	VisibilityTimeoutSeconds int `toml:"visibility_timeout_seconds"`
+
+	// PollIntervalMs is how often idle workers poll for jobs (postgres backend, default 1000)
+	PollIntervalMs int `toml:"poll_interval_ms"`
+}
+
+// RealtimeConfig holds WebSocket hub configuration.
+type RealtimeConfig struct {
+	// Backplane relays broadcasts between runtime replicas: "memory" keeps
+	// them in this process, "postgres" fans them out with LISTEN/NOTIFY on
+	// the database
+	Backplane string `toml:"backplane"`
+}
+
+// PresenceConfig holds presence store configuration.
+type PresenceConfig struct {
+	// Backend: "memory" keeps entries in this process, "postgres" shares
+	// them between replicas in an unlogged table
+	Backend string `toml:"backend"`
+
+	// DefaultTTL is how long an update lasts for presences declaring no
+	// ttl, as a Go duration (default "5m")
+	DefaultTTL string `toml:"default_ttl"`
 }
 
 // AuthConfig holds authentication adapter configuration.
@@ -190,6 +222,8 @@ type EnvironmentOverride struct {
 	Database  db.Config                  `toml:"database"`
 	Email     EmailConfig                `toml:"email"`
 	Jobs      JobsConfig                 `toml:"jobs"`
+	Realtime  RealtimeConfig             `toml:"realtime"`
+	Presence  PresenceConfig             `toml:"presence"`
 	Auth      AuthConfig                 `toml:"auth"`
 	Providers map[string]ProviderConfig  `toml:"providers"`
 }
@@ -265,6 +299,13 @@ func defaultConfig() *Config {
 			Backend:     "memory",
 			Concurrency: 10,
 		},
+		Realtime: RealtimeConfig{
+			Backplane: "memory",
+		},
+		Presence: PresenceConfig{
+			Backend:    "memory",
+			DefaultTTL: "5m",
+		},
 		Auth: AuthConfig{
 			Provider: "jwt",
 			Password: PasswordConfig{
@@ -313,6 +354,17 @@ func (c *Config) applyDefaults() {
 		c.Jobs.Concurrency = defaults.Jobs.Concurrency
 	}
 
+	if c.Realtime.Backplane == "" {
+		c.Realtime.Backplane = defaults.Realtime.Backplane
+	}
+
+	if c.Presence.Backend == "" {
+		c.Presence.Backend = defaults.Presence.Backend
+	}
+	if c.Presence.DefaultTTL == "" {
+		c.Presence.DefaultTTL = defaults.Presence.DefaultTTL
+	}
+
 	if c.Auth.Provider == "" {
 		c.Auth.Provider = defaults.Auth.Provider
 	}
@@ -419,6 +471,25 @@ func (c *Config) applyOverride(override *EnvironmentOverride) {
 	if override.Jobs.Concurrency != 0 {
 		c.Jobs.Concurrency = override.Jobs.Concurrency
 	}
+	if override.Jobs.VisibilityTimeoutSeconds != 0 {
+		c.Jobs.VisibilityTimeoutSeconds = override.Jobs.VisibilityTimeoutSeconds
+	}
+	if override.Jobs.PollIntervalMs != 0 {
+		c.Jobs.PollIntervalMs = override.Jobs.PollIntervalMs
+	}
+
+	// Realtime overrides
+	if override.Realtime.Backplane != "" {
+		c.Realtime.Backplane = override.Realtime.Backplane
+	}
+
+	// Presence overrides
+	if override.Presence.Backend != "" {
+		c.Presence.Backend = override.Presence.Backend
+	}
+	if override.Presence.DefaultTTL != "" {
+		c.Presence.DefaultTTL = override.Presence.DefaultTTL
+	}
 
 	// Auth overrides
 	if override.Auth.Provider != "" {
@@ -53,6 +53,23 @@ type Database interface {
 	IsEmbedded() bool
 }
 
+// Listener is implemented by databases that deliver PostgreSQL
+// notifications. Each Listen holds a connection of its own for as long as it
+// runs.
+type Listener interface {
+	// Listen calls handle with the payload of every notification sent on
+	// channel until ctx is done, when it returns nil, or the connection
+	// fails.
+	Listen(ctx context.Context, channel string, handle func(payload string)) error
+}
+
+// Querier is the query interface shared by Database and Tx.
+type Querier interface {
+	Query(ctx context.Context, query string, args ...any) (Rows, error)
+	QueryRow(ctx context.Context, query string, args ...any) Row
+	Exec(ctx context.Context, query string, args ...any) (Result, error)
+}
+
 // Tx represents a database transaction.
 type Tx interface {
 	// Query executes a SELECT query within the transaction.
@@ -109,8 +126,17 @@ type Result interface {
 	RowsAffected() int64
 }
 
-// Migration represents a database migration from the artifact.
+// Migration represents a database migration from the artifact. Up and Down
+// hold the full schema; Steps hold the versioned migrations that reach it.
 type Migration struct {
+	Version string           `json:"version"`
+	Up      []string         `json:"up"`
+	Down    []string         `json:"down"`
+	Steps   []*MigrationStep `json:"steps,omitempty"`
+}
+
+// MigrationStep is one versioned migration from the artifact.
+type MigrationStep struct {
 	Version string   `json:"version"`
 	Up      []string `json:"up"`
 	Down    []string `json:"down"`
@@ -153,6 +153,11 @@ func (e *Embedded) Begin(ctx context.Context) (Tx, error) {
 	return e.inner.Begin(ctx)
 }
 
+// Listen delegates to the inner Postgres adapter.
+func (e *Embedded) Listen(ctx context.Context, channel string, handle func(payload string)) error {
+	return e.inner.Listen(ctx, channel, handle)
+}
+
 // IsEmbedded returns true for embedded PostgreSQL.
 func (e *Embedded) IsEmbedded() bool {
 	return true
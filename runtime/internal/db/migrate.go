@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 )
 
@@ -11,6 +12,7 @@ import (
 type MigrationResult struct {
 	Applied    int
 	Skipped    int
+	Versions   []string // migration versions applied by this run
 	Statements []StatementResult
 }
 
@@ -33,7 +35,211 @@ func ApplyMigrationWithLog(ctx context.Context, db Database, migration *Migratio
 
 	logger.Info("applying migration", "version", migration.Version, "statements", len(migration.Up))
 
-	for i, stmt := range migration.Up {
+	if err := applyStatements(ctx, db, migration.Up, true, result, logger); err != nil {
+		return result, err
+	}
+
+	logger.Info("migration complete", "applied", result.Applied, "skipped", result.Skipped)
+	return result, nil
+}
+
+// migrationLockKey is the advisory lock held while migrating, so servers and
+// CLI invocations starting at the same time do not migrate concurrently.
+const migrationLockKey int64 = 0x666f726765 // "forge"
+
+// ApplyMigrations applies the migration steps that are not yet recorded in
+// _forge_migrations, in order, and records each one. An artifact without
+// steps is treated as a single step holding the full schema. Unless
+// allowDangerous is set, pending steps making dangerous changes are refused
+// with a *DangerousMigrationError before any step is applied; the check sees
+// the steps pending once the advisory lock is held.
+//
+// All pending steps run in one transaction under an advisory lock: either
+// every step is applied and recorded or none is. The exception is a step
+// adding enum values, which is committed before the steps after it run in a
+// new transaction, since PostgreSQL cannot use a value in the transaction
+// that adds it. The first step creates the schema from scratch. It tolerates
+// objects that already exist, since databases migrated before versions were
+// recorded already have them. Later steps are incremental and fail on any
+// error.
+func ApplyMigrations(ctx context.Context, db Database, migration *Migration, allowDangerous bool, logger *slog.Logger) (*MigrationResult, error) {
+	result := &MigrationResult{}
+	if migration == nil {
+		return result, nil
+	}
+
+	baseline := migrationSteps(migration)[0]
+	for done := false; !done; {
+		var versions []string
+		err := inMigrationTx(ctx, db, func(tx Tx, applied []string) error {
+			done = true
+			pending := PendingSteps(migration, applied)
+			if !allowDangerous {
+				var stmts []string
+				for _, step := range pending {
+					stmts = append(stmts, step.Up...)
+				}
+				if dangerous := ValidateStatements(stmts); len(dangerous) > 0 {
+					return &DangerousMigrationError{Changes: dangerous}
+				}
+			}
+			for _, step := range pending {
+				logger.Info("applying migration", "version", step.Version, "statements", len(step.Up))
+
+				if err := applyStatements(ctx, tx, step.Up, step == baseline, result, logger); err != nil {
+					return fmt.Errorf("migration %s: %w", step.Version, err)
+				}
+				if err := RecordMigration(ctx, tx, step.Version); err != nil {
+					return fmt.Errorf("failed to record migration %s: %w", step.Version, err)
+				}
+				versions = append(versions, step.Version)
+				if addsEnumValues(step) {
+					done = false
+					return nil
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Versions = append(result.Versions, versions...)
+	}
+
+	logger.Info("migrations complete", "versions", len(result.Versions), "applied", result.Applied, "skipped", result.Skipped)
+	return result, nil
+}
+
+// addsEnumValues reports whether step adds values to an enum type.
+func addsEnumValues(step *MigrationStep) bool {
+	for _, stmt := range step.Up {
+		stmt = strings.ToUpper(strings.TrimSpace(stmt))
+		if strings.HasPrefix(stmt, "ALTER TYPE") && strings.Contains(stmt, " ADD VALUE") {
+			return true
+		}
+	}
+	return false
+}
+
+// RollbackMigrations reverts steps, newest first, by running their Down
+// statements and removing their versions from _forge_migrations. Like
+// ApplyMigrations it runs in one transaction under the advisory lock. Steps
+// that are no longer recorded as applied are skipped.
+func RollbackMigrations(ctx context.Context, db Database, steps []*MigrationStep, logger *slog.Logger) (*MigrationResult, error) {
+	result := &MigrationResult{}
+
+	err := inMigrationTx(ctx, db, func(tx Tx, applied []string) error {
+		for _, step := range steps {
+			if !slices.Contains(applied, step.Version) {
+				continue
+			}
+			logger.Info("rolling back migration", "version", step.Version, "statements", len(step.Down))
+
+			if err := applyStatements(ctx, tx, step.Down, false, result, logger); err != nil {
+				return fmt.Errorf("rollback %s: %w", step.Version, err)
+			}
+			if _, err := tx.Exec(ctx, "DELETE FROM _forge_migrations WHERE version = $1", step.Version); err != nil {
+				return fmt.Errorf("failed to unrecord migration %s: %w", step.Version, err)
+			}
+			result.Versions = append(result.Versions, step.Version)
+		}
+		return nil
+	})
+	if err != nil {
+		result.Versions = nil
+		return result, err
+	}
+
+	logger.Info("rollback complete", "versions", len(result.Versions), "applied", result.Applied)
+	return result, nil
+}
+
+// inMigrationTx runs fn in a transaction holding the migration advisory lock,
+// passing the versions recorded as applied once the lock is held. The
+// transaction is committed if fn succeeds and rolled back otherwise.
+func inMigrationTx(ctx context.Context, db Database, fn func(tx Tx, applied []string) error) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	if err := CreateMigrationTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create migration table: %w", err)
+	}
+	applied, err := GetAppliedMigrations(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	if err := fn(tx, applied); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit migration: %w", err)
+	}
+	return nil
+}
+
+// RollbackSteps returns the applied steps to revert, newest first, to get
+// back to version to. An empty to reverts only the latest applied step.
+func RollbackSteps(migration *Migration, applied []string, to string) ([]*MigrationStep, error) {
+	steps := migrationSteps(migration)
+	if to != "" && !slices.ContainsFunc(steps, func(s *MigrationStep) bool { return s.Version == to }) {
+		return nil, fmt.Errorf("migration %s is not in the artifact", to)
+	}
+
+	var revert []*MigrationStep
+	for i := len(applied) - 1; i >= 0; i-- {
+		version := applied[i]
+		if version == to {
+			break
+		}
+		idx := slices.IndexFunc(steps, func(s *MigrationStep) bool { return s.Version == version })
+		if idx < 0 {
+			return nil, fmt.Errorf("applied migration %s is not in the artifact", version)
+		}
+		revert = append(revert, steps[idx])
+		if to == "" {
+			break
+		}
+	}
+	return revert, nil
+}
+
+// PendingSteps returns the steps of migration whose versions are not in
+// applied, in order.
+func PendingSteps(migration *Migration, applied []string) []*MigrationStep {
+	var pending []*MigrationStep
+	for _, step := range migrationSteps(migration) {
+		if !slices.Contains(applied, step.Version) {
+			pending = append(pending, step)
+		}
+	}
+	return pending
+}
+
+// migrationSteps returns the migration's steps, or the full schema as a
+// single step for artifacts built before steps were emitted.
+func migrationSteps(migration *Migration) []*MigrationStep {
+	if len(migration.Steps) > 0 {
+		return migration.Steps
+	}
+	return []*MigrationStep{{Version: migration.Version, Up: migration.Up, Down: migration.Down}}
+}
+
+// applyStatements executes stmts in order, skipping blanks and comments.
+// With tolerateExisting, "already exists" errors are counted as skipped;
+// inside a transaction each statement then runs under a savepoint so the
+// error does not abort the transaction.
+func applyStatements(ctx context.Context, db Querier, stmts []string, tolerateExisting bool, result *MigrationResult, logger *slog.Logger) error {
+	_, inTx := db.(Tx)
+	savepoint := tolerateExisting && inTx
+
+	for i, stmt := range stmts {
 		stmt = strings.TrimSpace(stmt)
 		if stmt == "" || strings.HasPrefix(stmt, "--") {
 			continue
@@ -43,17 +249,31 @@ func ApplyMigrationWithLog(ctx context.Context, db Database, migration *Migratio
 			Statement: truncateSQL(stmt),
 		}
 
+		if savepoint {
+			if _, err := db.Exec(ctx, "SAVEPOINT forge_migration"); err != nil {
+				return err
+			}
+		}
 		_, err := db.Exec(ctx, stmt)
+		if savepoint {
+			release := "RELEASE SAVEPOINT forge_migration"
+			if err != nil {
+				release = "ROLLBACK TO SAVEPOINT forge_migration"
+			}
+			if _, serr := db.Exec(ctx, release); serr != nil && err == nil {
+				err = serr
+			}
+		}
 		if err != nil {
 			// Check if it's an "already exists" error - that's OK
-			if isAlreadyExistsError(err) {
+			if tolerateExisting && isAlreadyExistsError(err) {
 				stmtResult.Applied = false
 				result.Skipped++
 				logger.Debug("skipped (already exists)", "statement", i+1)
 			} else {
 				stmtResult.Error = err
 				result.Statements = append(result.Statements, stmtResult)
-				return result, fmt.Errorf("migration statement %d failed: %w", i+1, err)
+				return fmt.Errorf("migration statement %d failed: %w", i+1, err)
 			}
 		} else {
 			stmtResult.Applied = true
@@ -63,9 +283,7 @@ func ApplyMigrationWithLog(ctx context.Context, db Database, migration *Migratio
 
 		result.Statements = append(result.Statements, stmtResult)
 	}
-
-	logger.Info("migration complete", "applied", result.Applied, "skipped", result.Skipped)
-	return result, nil
+	return nil
 }
 
 // ValidateMigration checks if migration would be safe to apply.
@@ -79,10 +297,14 @@ func ValidateMigration(migration *Migration) []DangerousChange {
 	if migration == nil {
 		return nil
 	}
+	return ValidateStatements(migration.Up)
+}
 
+// ValidateStatements returns the dangerous changes among stmts.
+func ValidateStatements(stmts []string) []DangerousChange {
 	var dangerous []DangerousChange
 
-	for _, stmt := range migration.Up {
+	for _, stmt := range stmts {
 		stmt = strings.ToUpper(strings.TrimSpace(stmt))
 		if stmt == "" {
 			continue
@@ -103,7 +325,7 @@ func ValidateMigration(migration *Migration) []DangerousChange {
 			})
 		}
 
-		if strings.HasPrefix(stmt, "ALTER") && strings.Contains(stmt, "TYPE") {
+		if strings.Contains(stmt, "ALTER COLUMN") && strings.Contains(stmt, " TYPE ") {
 			dangerous = append(dangerous, DangerousChange{
 				Statement: truncateSQL(stmt),
 				Reason:    "changes column type (may lose data)",
@@ -121,8 +343,18 @@ func ValidateMigration(migration *Migration) []DangerousChange {
 	return dangerous
 }
 
+// DangerousMigrationError is returned by ApplyMigrations when pending steps
+// make dangerous changes it was not allowed to apply.
+type DangerousMigrationError struct {
+	Changes []DangerousChange
+}
+
+func (e *DangerousMigrationError) Error() string {
+	return fmt.Sprintf("pending migrations contain %d dangerous changes", len(e.Changes))
+}
+
 // CreateMigrationTable ensures the migration tracking table exists.
-func CreateMigrationTable(ctx context.Context, db Database) error {
+func CreateMigrationTable(ctx context.Context, db Querier) error {
 	_, err := db.Exec(ctx, `
 		CREATE TABLE IF NOT EXISTS _forge_migrations (
 			version TEXT PRIMARY KEY,
@@ -133,8 +365,8 @@ func CreateMigrationTable(ctx context.Context, db Database) error {
 }
 
 // GetAppliedMigrations returns list of already applied migration versions.
-func GetAppliedMigrations(ctx context.Context, db Database) ([]string, error) {
-	rows, err := db.Query(ctx, "SELECT version FROM _forge_migrations ORDER BY applied_at")
+func GetAppliedMigrations(ctx context.Context, db Querier) ([]string, error) {
+	rows, err := db.Query(ctx, "SELECT version FROM _forge_migrations ORDER BY applied_at, version")
 	if err != nil {
 		// Table might not exist yet
 		if strings.Contains(err.Error(), "does not exist") {
@@ -157,7 +389,7 @@ func GetAppliedMigrations(ctx context.Context, db Database) ([]string, error) {
 }
 
 // RecordMigration records that a migration version was applied.
-func RecordMigration(ctx context.Context, db Database, version string) error {
+func RecordMigration(ctx context.Context, db Querier, version string) error {
 	_, err := db.Exec(ctx, "INSERT INTO _forge_migrations (version) VALUES ($1) ON CONFLICT (version) DO NOTHING", version)
 	return err
 }
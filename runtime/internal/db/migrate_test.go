@@ -0,0 +1,283 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// migrationDB records executed statements and keeps _forge_migrations in
+// memory. Its transactions apply their changes only on commit.
+type migrationDB struct {
+	Database
+	applied []string
+	execs   []string
+	commits [][]string // statements of each committed transaction
+	failOn  string
+}
+
+func (m *migrationDB) Begin(ctx context.Context) (Tx, error) {
+	return &migrationTx{db: m, applied: slices.Clone(m.applied)}, nil
+}
+
+type migrationTx struct {
+	Tx
+	db      *migrationDB
+	applied []string
+	execs   []string
+}
+
+func (tx *migrationTx) Exec(ctx context.Context, query string, args ...any) (Result, error) {
+	switch {
+	case tx.db.failOn != "" && strings.Contains(query, tx.db.failOn):
+		return nil, errors.New(`ERROR: relation "tickets" already exists (SQLSTATE 42P07)`)
+	case strings.HasPrefix(query, "INSERT INTO _forge_migrations"):
+		tx.applied = append(tx.applied, args[0].(string))
+	case strings.HasPrefix(query, "DELETE FROM _forge_migrations"):
+		tx.applied = slices.DeleteFunc(tx.applied, func(v string) bool { return v == args[0] })
+	case strings.Contains(query, "_forge_migrations"), strings.Contains(query, "SAVEPOINT"), strings.Contains(query, "pg_advisory"):
+	default:
+		tx.execs = append(tx.execs, query)
+	}
+	return nil, nil
+}
+
+func (tx *migrationTx) Query(ctx context.Context, query string, args ...any) (Rows, error) {
+	return &versionRows{versions: tx.applied, i: -1}, nil
+}
+
+func (tx *migrationTx) Commit(ctx context.Context) error {
+	tx.db.applied = tx.applied
+	tx.db.execs = append(tx.db.execs, tx.execs...)
+	tx.db.commits = append(tx.db.commits, tx.execs)
+	return nil
+}
+
+func (tx *migrationTx) Rollback(ctx context.Context) error { return nil }
+
+type versionRows struct {
+	Rows
+	versions []string
+	i        int
+}
+
+func (r *versionRows) Next() bool { r.i++; return r.i < len(r.versions) }
+func (r *versionRows) Scan(dest ...any) error {
+	*dest[0].(*string) = r.versions[r.i]
+	return nil
+}
+func (r *versionRows) Close() error { return nil }
+func (r *versionRows) Err() error   { return nil }
+
+func TestApplyMigrations(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	migration := &Migration{
+		Version: "002",
+		Steps: []*MigrationStep{
+			{Version: "001", Up: []string{"-- tables", "CREATE TABLE tickets (id uuid);", ""}},
+			{Version: "002", Up: []string{"ALTER TABLE tickets ADD COLUMN IF NOT EXISTS priority integer;"}},
+		},
+	}
+
+	t.Run("applies pending steps in order", func(t *testing.T) {
+		database := &migrationDB{}
+		result, err := ApplyMigrations(context.Background(), database, migration, false, logger)
+		if err != nil {
+			t.Fatalf("ApplyMigrations: %v", err)
+		}
+		if !reflect.DeepEqual(result.Versions, []string{"001", "002"}) || !reflect.DeepEqual(database.applied, []string{"001", "002"}) {
+			t.Errorf("applied %v, recorded %v", result.Versions, database.applied)
+		}
+		if len(database.execs) != 2 {
+			t.Errorf("expected 2 statements, got %v", database.execs)
+		}
+
+		// A second run has nothing to do
+		result, err = ApplyMigrations(context.Background(), database, migration, false, logger)
+		if err != nil || len(result.Versions) != 0 || len(database.execs) != 2 {
+			t.Errorf("rerun applied %v (err %v)", result.Versions, err)
+		}
+	})
+
+	t.Run("only new steps run on a migrated database", func(t *testing.T) {
+		database := &migrationDB{applied: []string{"001"}}
+		result, err := ApplyMigrations(context.Background(), database, migration, false, logger)
+		if err != nil {
+			t.Fatalf("ApplyMigrations: %v", err)
+		}
+		if !reflect.DeepEqual(result.Versions, []string{"002"}) || len(database.execs) != 1 {
+			t.Errorf("applied %v with statements %v", result.Versions, database.execs)
+		}
+	})
+
+	t.Run("baseline tolerates existing objects", func(t *testing.T) {
+		database := &migrationDB{failOn: "CREATE TABLE tickets"}
+		result, err := ApplyMigrations(context.Background(), database, migration, false, logger)
+		if err != nil {
+			t.Fatalf("ApplyMigrations: %v", err)
+		}
+		if result.Skipped != 1 || !reflect.DeepEqual(database.applied, []string{"001", "002"}) {
+			t.Errorf("skipped %d, recorded %v", result.Skipped, database.applied)
+		}
+	})
+
+	t.Run("incremental steps fail on errors", func(t *testing.T) {
+		database := &migrationDB{applied: []string{"001"}, failOn: "ADD COLUMN"}
+		_, err := ApplyMigrations(context.Background(), database, migration, false, logger)
+		if err == nil || !strings.Contains(err.Error(), "migration 002") {
+			t.Fatalf("expected step 002 to fail, got %v", err)
+		}
+		if !reflect.DeepEqual(database.applied, []string{"001"}) {
+			t.Errorf("failed step must not be recorded, got %v", database.applied)
+		}
+	})
+
+	t.Run("a failure rolls back every pending step", func(t *testing.T) {
+		three := &Migration{Steps: append(slices.Clone(migration.Steps),
+			&MigrationStep{Version: "003", Up: []string{"ALTER TABLE tickets DROP COLUMN IF EXISTS legacy;"}},
+			&MigrationStep{Version: "004", Up: []string{"ALTER TABLE tickets ADD COLUMN broken integer;"}},
+		)}
+		database := &migrationDB{applied: []string{"001"}, failOn: "broken"}
+		if _, err := ApplyMigrations(context.Background(), database, three, false, logger); err == nil {
+			t.Fatal("expected step 004 to fail")
+		}
+		if !reflect.DeepEqual(database.applied, []string{"001"}) || len(database.execs) != 0 {
+			t.Errorf("expected nothing applied, got versions %v and statements %v", database.applied, database.execs)
+		}
+	})
+
+	t.Run("enum values are committed before the steps using them", func(t *testing.T) {
+		addValue := "ALTER TYPE tickets_status ADD VALUE IF NOT EXISTS 'pending';"
+		setDefault := "ALTER TABLE tickets ALTER COLUMN status SET DEFAULT 'pending';"
+		enum := &Migration{Steps: append(slices.Clone(migration.Steps),
+			&MigrationStep{Version: "003", Up: []string{addValue}},
+			&MigrationStep{Version: "004", Up: []string{setDefault}},
+		)}
+		database := &migrationDB{applied: []string{"001"}}
+		result, err := ApplyMigrations(context.Background(), database, enum, false, logger)
+		if err != nil {
+			t.Fatalf("ApplyMigrations: %v", err)
+		}
+		if !reflect.DeepEqual(result.Versions, []string{"002", "003", "004"}) {
+			t.Errorf("applied %v", result.Versions)
+		}
+		want := [][]string{{migration.Steps[1].Up[0], addValue}, {setDefault}}
+		if len(database.commits) < 2 || !reflect.DeepEqual(database.commits[:2], want) {
+			t.Errorf("committed %q, want %q", database.commits, want)
+		}
+
+		// A later failure keeps the committed enum values
+		database = &migrationDB{applied: []string{"001", "002"}, failOn: "SET DEFAULT"}
+		if _, err := ApplyMigrations(context.Background(), database, enum, false, logger); err == nil {
+			t.Fatal("expected step 004 to fail")
+		}
+		if !reflect.DeepEqual(database.applied, []string{"001", "002", "003"}) {
+			t.Errorf("recorded %v, want the enum step committed", database.applied)
+		}
+	})
+}
+
+func TestApplyMigrations_Dangerous(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	drop := "ALTER TABLE tickets DROP COLUMN IF EXISTS priority;"
+	migration := &Migration{Steps: []*MigrationStep{
+		{Version: "001", Up: []string{"CREATE TABLE tickets (id uuid);"}},
+		{Version: "002", Up: []string{drop}},
+		{Version: "003", Up: []string{"ALTER TABLE tickets ADD COLUMN IF NOT EXISTS status text;"}},
+	}}
+
+	database := &migrationDB{applied: []string{"001"}}
+	_, err := ApplyMigrations(context.Background(), database, migration, false, logger)
+	var dangerous *DangerousMigrationError
+	if !errors.As(err, &dangerous) || len(dangerous.Changes) != 1 {
+		t.Fatalf("expected the dangerous step refused, got %v", err)
+	}
+	if len(database.commits) != 0 || !reflect.DeepEqual(database.applied, []string{"001"}) {
+		t.Errorf("expected nothing applied, got %q", database.commits)
+	}
+
+	// The check sees the versions recorded once the lock is held: a step
+	// another process applied in the meantime is no longer pending
+	database = &migrationDB{applied: []string{"001", "002"}}
+	result, err := ApplyMigrations(context.Background(), database, migration, false, logger)
+	if err != nil || !reflect.DeepEqual(result.Versions, []string{"003"}) {
+		t.Errorf("applied %v, %v; want 003", result, err)
+	}
+
+	database = &migrationDB{applied: []string{"001"}}
+	result, err = ApplyMigrations(context.Background(), database, migration, true, logger)
+	if err != nil || !reflect.DeepEqual(result.Versions, []string{"002", "003"}) {
+		t.Errorf("with allowDangerous applied %v, %v; want 002 and 003", result, err)
+	}
+}
+
+func TestRollbackMigrations(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	migration := &Migration{Steps: []*MigrationStep{
+		{Version: "001", Down: []string{"DROP TABLE IF EXISTS tickets CASCADE;"}},
+		{Version: "002", Down: []string{"ALTER TABLE tickets DROP COLUMN IF EXISTS priority;"}},
+		{Version: "003", Down: []string{"DROP TABLE IF EXISTS tags CASCADE;"}},
+	}}
+	applied := []string{"001", "002", "003"}
+
+	steps, err := RollbackSteps(migration, applied, "")
+	if err != nil || len(steps) != 1 || steps[0].Version != "003" {
+		t.Fatalf("default rollback = %v (err %v), want only 003", steps, err)
+	}
+
+	steps, err = RollbackSteps(migration, applied, "001")
+	if err != nil || len(steps) != 2 || steps[0].Version != "003" || steps[1].Version != "002" {
+		t.Fatalf("rollback to 001 = %v (err %v), want 003 then 002", steps, err)
+	}
+	if _, err := RollbackSteps(migration, applied, "009"); err == nil {
+		t.Error("expected an error for an unknown target version")
+	}
+	if _, err := RollbackSteps(migration, []string{"001", "007"}, ""); err == nil {
+		t.Error("expected an error for an applied version missing from the artifact")
+	}
+
+	database := &migrationDB{applied: slices.Clone(applied)}
+	result, err := RollbackMigrations(context.Background(), database, steps, logger)
+	if err != nil {
+		t.Fatalf("RollbackMigrations: %v", err)
+	}
+	if !reflect.DeepEqual(result.Versions, []string{"003", "002"}) || !reflect.DeepEqual(database.applied, []string{"001"}) {
+		t.Errorf("rolled back %v, still applied %v", result.Versions, database.applied)
+	}
+	if !reflect.DeepEqual(database.execs, []string{"DROP TABLE IF EXISTS tags CASCADE;", "ALTER TABLE tickets DROP COLUMN IF EXISTS priority;"}) {
+		t.Errorf("unexpected statements %v", database.execs)
+	}
+}
+
+func TestValidateStatements(t *testing.T) {
+	dangerous := ValidateStatements([]string{
+		"ALTER TYPE tickets_status ADD VALUE IF NOT EXISTS 'pending';",
+		"ALTER TABLE tickets ADD COLUMN IF NOT EXISTS ticket_type text;",
+		"ALTER TABLE tickets DROP COLUMN IF EXISTS legacy;",
+		"ALTER TABLE tickets ALTER COLUMN score TYPE float USING score::text::float;",
+		"DROP TABLE IF EXISTS tags CASCADE;",
+	})
+	if len(dangerous) != 3 {
+		for _, d := range dangerous {
+			t.Logf("  %s: %s", d.Reason, d.Statement)
+		}
+		t.Errorf("expected 3 dangerous changes, got %d", len(dangerous))
+	}
+}
+
+func TestPendingSteps_LegacyArtifact(t *testing.T) {
+	migration := &Migration{Version: "001", Up: []string{"CREATE TABLE tickets (id uuid);"}}
+
+	pending := PendingSteps(migration, nil)
+	if len(pending) != 1 || pending[0].Version != "001" || len(pending[0].Up) != 1 {
+		t.Errorf("expected the full schema as step 001, got %+v", pending)
+	}
+	if pending := PendingSteps(migration, []string{"001"}); len(pending) != 0 {
+		t.Errorf("expected nothing pending, got %+v", pending)
+	}
+}
@@ -240,6 +240,33 @@ func (p *Postgres) Begin(ctx context.Context) (Tx, error) {
 	return &pgxTx{tx: tx}, nil
 }
 
+// Listen runs LISTEN on a connection taken out of the pool and calls handle
+// with each notification on channel. The connection is closed when Listen
+// returns.
+func (p *Postgres) Listen(ctx context.Context, channel string, handle func(payload string)) error {
+	conn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	// A listening connection must not go back to the pool
+	pgConn := conn.Hijack()
+	defer pgConn.Close(context.Background())
+
+	if _, err := pgConn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+	for {
+		notification, err := pgConn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		handle(notification.Payload)
+	}
+}
+
 // IsEmbedded returns false for external PostgreSQL.
 func (p *Postgres) IsEmbedded() bool {
 	return false
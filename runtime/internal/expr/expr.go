@@ -0,0 +1,417 @@
+// Package expr parses and evaluates the CEL-style conditions the compiler
+// emits for rules and access policies.
+//
+// The compiler renders conditions such as `(status == closed)` or
+// `((user == author) || (user.role == agent))`. Identifiers and paths are
+// resolved at evaluation time through a Resolver, which lets the runtime
+// decide how fields, relations and the current user map onto stored rows.
+package expr
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Node is a parsed expression node.
+type Node interface {
+	String() string
+}
+
+// Path is an identifier or dotted path such as `status` or `user.role`.
+type Path struct {
+	Parts []string
+}
+
+func (p *Path) String() string { return strings.Join(p.Parts, ".") }
+
+// Literal is a string, number, boolean or null constant.
+type Literal struct {
+	Value any
+}
+
+func (l *Literal) String() string {
+	if s, ok := l.Value.(string); ok {
+		return strconv.Quote(s)
+	}
+	if l.Value == nil {
+		return "null"
+	}
+	return fmt.Sprint(l.Value)
+}
+
+// Binary is a binary operation. Op is one of == != < > <= >= && || + - * /.
+type Binary struct {
+	Op          string
+	Left, Right Node
+}
+
+func (b *Binary) String() string {
+	return fmt.Sprintf("(%s %s %s)", b.Left, b.Op, b.Right)
+}
+
+// Unary is a prefix operation. Op is ! or -.
+type Unary struct {
+	Op      string
+	Operand Node
+}
+
+func (u *Unary) String() string { return u.Op + u.Operand.String() }
+
+// In is a membership test: `user in org.members`.
+type In struct {
+	Left, Right Node
+}
+
+func (n *In) String() string { return fmt.Sprintf("%s in %s", n.Left, n.Right) }
+
+// Call is a builtin function call such as `now()`.
+type Call struct {
+	Func string
+	Args []Node
+}
+
+func (c *Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", c.Func, strings.Join(args, ", "))
+}
+
+// Resolver resolves identifiers and paths to values.
+//
+// Resolve reports found=false when the path does not name anything the
+// resolver knows about. A single unresolved identifier evaluates to its own
+// name so that enum values like `closed` compare as strings.
+type Resolver interface {
+	Resolve(ctx context.Context, path []string) (value any, found bool, err error)
+}
+
+// MapResolver resolves paths against nested maps. It is mainly useful for
+// tests and for evaluating conditions against in-memory records.
+type MapResolver map[string]any
+
+// Resolve implements Resolver.
+func (m MapResolver) Resolve(_ context.Context, path []string) (any, bool, error) {
+	var cur any = map[string]any(m)
+	for _, part := range path {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false, nil
+		}
+		cur, ok = obj[part]
+		if !ok {
+			return nil, false, nil
+		}
+	}
+	return cur, true, nil
+}
+
+// Eval evaluates a node against the resolver.
+func Eval(ctx context.Context, n Node, r Resolver) (any, error) {
+	switch n := n.(type) {
+	case *Literal:
+		return n.Value, nil
+
+	case *Path:
+		v, found, err := r.Resolve(ctx, n.Parts)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", n, err)
+		}
+		if !found {
+			if len(n.Parts) == 1 {
+				return n.Parts[0], nil
+			}
+			return nil, nil
+		}
+		return v, nil
+
+	case *Unary:
+		v, err := Eval(ctx, n.Operand, r)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case "!":
+			return !Truthy(v), nil
+		case "-":
+			f, ok := toFloat(v)
+			if !ok {
+				return nil, fmt.Errorf("cannot negate %T", v)
+			}
+			return -f, nil
+		}
+		return nil, fmt.Errorf("unknown unary operator %q", n.Op)
+
+	case *In:
+		left, err := Eval(ctx, n.Left, r)
+		if err != nil {
+			return nil, err
+		}
+		right, err := Eval(ctx, n.Right, r)
+		if err != nil {
+			return nil, err
+		}
+		return Contains(right, left), nil
+
+	case *Binary:
+		return evalBinary(ctx, n, r)
+
+	case *Call:
+		return evalCall(ctx, n, r)
+	}
+	return nil, fmt.Errorf("unknown node %T", n)
+}
+
+// EvalBool evaluates a node and reports whether the result is truthy.
+func EvalBool(ctx context.Context, n Node, r Resolver) (bool, error) {
+	v, err := Eval(ctx, n, r)
+	if err != nil {
+		return false, err
+	}
+	return Truthy(v), nil
+}
+
+func evalBinary(ctx context.Context, n *Binary, r Resolver) (any, error) {
+	left, err := Eval(ctx, n.Left, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit logical operators so paths on the right are only
+	// resolved (and possibly loaded from the database) when needed.
+	switch n.Op {
+	case "&&":
+		if !Truthy(left) {
+			return false, nil
+		}
+		return EvalBool(ctx, n.Right, r)
+	case "||":
+		if Truthy(left) {
+			return true, nil
+		}
+		return EvalBool(ctx, n.Right, r)
+	}
+
+	right, err := Eval(ctx, n.Right, r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Op {
+	case "==":
+		return Equal(left, right), nil
+	case "!=":
+		return !Equal(left, right), nil
+	case "<", ">", "<=", ">=":
+		c, ok := Compare(left, right)
+		if !ok {
+			return false, nil
+		}
+		switch n.Op {
+		case "<":
+			return c < 0, nil
+		case ">":
+			return c > 0, nil
+		case "<=":
+			return c <= 0, nil
+		default:
+			return c >= 0, nil
+		}
+	case "+":
+		if ls, ok := left.(string); ok {
+			return ls + fmt.Sprint(right), nil
+		}
+		fallthrough
+	case "-", "*", "/":
+		lf, lok := toFloat(left)
+		rf, rok := toFloat(right)
+		if !lok || !rok {
+			return nil, fmt.Errorf("operator %s requires numbers, got %T and %T", n.Op, left, right)
+		}
+		switch n.Op {
+		case "+":
+			return lf + rf, nil
+		case "-":
+			return lf - rf, nil
+		case "*":
+			return lf * rf, nil
+		default:
+			if rf == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return lf / rf, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operator %q", n.Op)
+}
+
+func evalCall(ctx context.Context, n *Call, r Resolver) (any, error) {
+	args := make([]any, len(n.Args))
+	for i, arg := range n.Args {
+		v, err := Eval(ctx, arg, r)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	switch n.Func {
+	case "now":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("now() takes no arguments")
+		}
+		return time.Now().UTC().Format(time.RFC3339), nil
+	case "len":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("len() takes one argument")
+		}
+		switch v := args[0].(type) {
+		case nil:
+			return int64(0), nil
+		case string:
+			return int64(len([]rune(v))), nil
+		case []any:
+			return int64(len(v)), nil
+		}
+		return nil, fmt.Errorf("len() of %T", args[0])
+	}
+	return nil, fmt.Errorf("unknown function %s()", n.Func)
+}
+
+// Truthy reports whether a value counts as true in a condition.
+// Nil, false, zero and the empty string are false; everything else is true.
+func Truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	}
+	if f, ok := toFloat(v); ok {
+		return f != 0
+	}
+	return true
+}
+
+// Equal compares two values loosely: numbers compare numerically, and
+// everything else compares by its string form so that UUIDs, enum values
+// and strings read from the database match identifiers in the condition.
+func Equal(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			return af == bf
+		}
+	}
+	if ab, ok := a.(bool); ok {
+		if bb, ok := b.(bool); ok {
+			return ab == bb
+		}
+	}
+	return toString(a) == toString(b)
+}
+
+// Compare orders two values as the comparison operators do: numbers
+// numerically, times chronologically and everything else by its string form.
+// ok is false when either value is nil.
+func Compare(a, b any) (c int, ok bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			switch {
+			case af < bf:
+				return -1, true
+			case af > bf:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	if at, ok := toTime(a); ok {
+		if bt, ok := toTime(b); ok {
+			return at.Compare(bt), true
+		}
+	}
+	return strings.Compare(toString(a), toString(b)), true
+}
+
+// Contains reports whether collection holds item, as the in operator does.
+func Contains(collection, item any) bool {
+	switch c := collection.(type) {
+	case nil:
+		return false
+	case []any:
+		for _, v := range c {
+			if Equal(v, item) {
+				return true
+			}
+		}
+		return false
+	case []string:
+		for _, v := range c {
+			if Equal(v, item) {
+				return true
+			}
+		}
+		return false
+	}
+	// A single related value behaves like a one-element collection.
+	return Equal(collection, item)
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func toTime(v any) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		if parsed, err := time.Parse(time.RFC3339, t); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func toString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
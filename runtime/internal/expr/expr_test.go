@@ -0,0 +1,111 @@
+package expr
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"(status == closed)", "(status == closed)"},
+		{"((user == author) || (user.role == agent))", "((user == author) || (user.role == agent))"},
+		{"user in org.members", "user in org.members"},
+		{"(user in members || (user == owner))", "(user in members || (user == owner))"},
+		{`(title != "")`, `(title != "")`},
+		{"!deleted", "!deleted"},
+		{"a and b or not c", "((a && b) || !c)"},
+		{"(count + 1 > 2 * 3)", "((count + 1) > (2 * 3))"},
+		{"now()", "now()"},
+		{"(len(body) >= 1)", "(len(body) >= 1)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			n, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.src, err)
+			}
+			if got := n.String(); got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{"(status == ", "status ==", `"open`, "a # b", "user.", "(a == b"} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("Parse(%q) expected error", src)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	record := MapResolver{
+		"status":   "closed",
+		"priority": int64(3),
+		"deleted":  false,
+		"body":     "",
+		"user":     "u-1",
+		"author":   "u-1",
+		"members":  []any{"u-1", "u-2"},
+		"org":      map[string]any{"members": []any{"u-3"}},
+		"due":      "2024-01-02T00:00:00Z",
+	}
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"(status == closed)", true},
+		{"(status != closed)", false},
+		{`(status == "closed")`, true},
+		{"(priority >= 3)", true},
+		{"(priority < 3)", false},
+		{"(priority == 3.0)", true},
+		{"(deleted == true)", false},
+		{"!deleted", true},
+		{"body", false},
+		{"(author != user)", false},
+		{"user in members", true},
+		{"user in org.members", false},
+		{"((user == author) || missing.path)", true},
+		{"((status == open) && missing.path)", false},
+		{`(due > "2024-01-01T00:00:00Z")`, true},
+		{"(missing.path == null)", true},
+		{"((priority + 1) == 4)", true},
+		{"(len(body) >= 1)", false},
+		{"(len(status) == 6)", true},
+		{"(now() > due)", true},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			n, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.src, err)
+			}
+			got, err := EvalBool(ctx, n, record)
+			if err != nil {
+				t.Fatalf("EvalBool(%q) error: %v", tt.src, err)
+			}
+			if got != tt.want {
+				t.Errorf("EvalBool(%q) = %v, want %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalArithmeticError(t *testing.T) {
+	n, err := Parse(`(status - 1)`)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if _, err := Eval(context.Background(), n, MapResolver{"status": "open"}); err == nil {
+		t.Error("expected error subtracting from a string")
+	}
+}
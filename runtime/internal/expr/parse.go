@@ -0,0 +1,353 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokDot
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// Parse parses a condition string into a Node.
+func Parse(src string) (Node, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, src: src}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d in %q", t.text, t.pos, src)
+	}
+	return n, nil
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			toks = append(toks, token{tokIdent, src[start:i], start})
+
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			toks = append(toks, token{tokNumber, src[start:i], start})
+
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(src) && rune(src[i]) != c {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string at offset %d in %q", start, src)
+			}
+			i++
+			toks = append(toks, token{tokString, sb.String(), start})
+
+		case c == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case c == '.':
+			toks = append(toks, token{tokDot, ".", i})
+			i++
+		case c == ',':
+			toks = append(toks, token{tokComma, ",", i})
+			i++
+
+		default:
+			if i+1 < len(src) {
+				switch two := src[i : i+2]; two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					toks = append(toks, token{tokOp, two, i})
+					i += 2
+					continue
+				}
+			}
+			switch c {
+			case '<', '>', '!', '+', '-', '*', '/':
+				toks = append(toks, token{tokOp, string(c), i})
+				i++
+			default:
+				return nil, fmt.Errorf("unexpected character %q at offset %d in %q", c, i, src)
+			}
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src)}), nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+	src  string
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isOp reports whether the next token is one of the given operators.
+// The word forms `and`, `or` and `not` are accepted alongside && || !.
+func (p *parser) isOp(ops ...string) (string, bool) {
+	t := p.peek()
+	text := t.text
+	if t.kind == tokIdent {
+		switch text {
+		case "and":
+			text = "&&"
+		case "or":
+			text = "||"
+		case "not":
+			text = "!"
+		case "in":
+		default:
+			return "", false
+		}
+	} else if t.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if text == op {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.isOp("||"); !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: "||", Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.isOp("&&"); !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: "&&", Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseComparison() (Node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.isOp("==", "!=", "<", ">", "<=", ">=", "in")
+	if !ok {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if op == "in" {
+		return &In{Left: left, Right: right}, nil
+	}
+	return &Binary{Op: op, Left: left, Right: right}, nil
+}
+
+func (p *parser) parseAdditive() (Node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.isOp("+", "-")
+		if !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.isOp("*", "/")
+		if !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if op, ok := p.isOp("!", "-"); ok {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{Op: op, Operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRParen {
+			return nil, fmt.Errorf("missing ) in %q", p.src)
+		}
+		return inner, nil
+
+	case tokNumber:
+		if strings.Contains(t.text, ".") {
+			f, err := strconv.ParseFloat(t.text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q in %q", t.text, p.src)
+			}
+			return &Literal{Value: f}, nil
+		}
+		n, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in %q", t.text, p.src)
+		}
+		return &Literal{Value: n}, nil
+
+	case tokString:
+		return &Literal{Value: t.text}, nil
+
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &Literal{Value: true}, nil
+		case "false":
+			return &Literal{Value: false}, nil
+		case "null", "nil":
+			return &Literal{Value: nil}, nil
+		}
+		parts := []string{t.text}
+		for p.peek().kind == tokDot {
+			p.next()
+			seg := p.next()
+			if seg.kind != tokIdent {
+				return nil, fmt.Errorf("expected identifier after . at offset %d in %q", seg.pos, p.src)
+			}
+			parts = append(parts, seg.text)
+		}
+		if len(parts) == 1 && p.peek().kind == tokLParen {
+			return p.parseCall(parts[0])
+		}
+		return &Path{Parts: parts}, nil
+	}
+
+	if t.kind == tokEOF {
+		return nil, fmt.Errorf("unexpected end of expression in %q", p.src)
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d in %q", t.text, t.pos, p.src)
+}
+
+func (p *parser) parseCall(name string) (Node, error) {
+	p.next() // (
+	call := &Call{Func: name}
+	if p.peek().kind == tokRParen {
+		p.next()
+		return call, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+
+		t := p.next()
+		if t.kind == tokRParen {
+			return call, nil
+		}
+		if t.kind != tokComma {
+			return nil, fmt.Errorf("expected , or ) in call to %s in %q", name, p.src)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Package imperative runs the Go functions that implement imperative
+// declarations.
+//
+// An imperative is the escape hatch for logic the declarative spec cannot
+// express. The .forge file declares it; a Go function registered under the
+// same name implements it. Like providers, implementations compile into the
+// binary - nothing is loaded at runtime.
+//
+// Functions receive a capability-limited Context rather than the server's
+// resources: database access is read-only and scoped to the calling user,
+// and only the effects listed in the declaration can be executed.
+package imperative
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/google/uuid"
+)
+
+// Func implements an imperative. Input is the JSON body of the request, or
+// the triggering record when called from a job. The result is returned to
+// the client as JSON, except []byte and string results which are sent as-is.
+type Func func(ctx *Context, input map[string]any) (any, error)
+
+// DB is the read-only database access given to an imperative.
+type DB interface {
+	// Query runs a read-only query and returns its rows as column -> value maps.
+	Query(ctx context.Context, query string, args ...any) ([]map[string]any, error)
+}
+
+// EffectFunc executes a provider capability.
+type EffectFunc func(ctx context.Context, capability string, data map[string]any) error
+
+// ErrUndeclaredEffect is returned when an imperative executes an effect its
+// declaration does not list.
+var ErrUndeclaredEffect = errors.New("effect not declared")
+
+// ErrNotRegistered is returned when no function is registered for a name.
+var ErrNotRegistered = errors.New("imperative not registered")
+
+// Error rejects a call with a message the client may see. Any other error is
+// logged and reported to the client as an internal error.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Context is everything an imperative can reach. It carries the request's
+// deadline and cancellation.
+type Context struct {
+	context.Context
+
+	Name   string       // imperative being called
+	UserID uuid.UUID    // calling user; uuid.Nil when called from a job
+	Logger *slog.Logger // tagged with the imperative name
+
+	db      DB
+	effects map[string]bool
+	exec    EffectFunc
+}
+
+// NewContext creates the context for one call. effects are the capabilities
+// the declaration lists; exec runs them.
+func NewContext(ctx context.Context, name string, userID uuid.UUID, db DB, effects []string, exec EffectFunc, logger *slog.Logger) *Context {
+	allowed := make(map[string]bool, len(effects))
+	for _, effect := range effects {
+		allowed[effect] = true
+	}
+	return &Context{
+		Context: ctx,
+		Name:    name,
+		UserID:  userID,
+		Logger:  logger.With("imperative", name),
+		db:      db,
+		effects: allowed,
+		exec:    exec,
+	}
+}
+
+// Query runs a read-only query as the calling user. Writes fail, and row
+// level security applies as it does to the user's own requests.
+func (c *Context) Query(query string, args ...any) ([]map[string]any, error) {
+	if c.db == nil {
+		return nil, errors.New("no database available")
+	}
+	return c.db.Query(c, query, args...)
+}
+
+// Effect executes a capability, such as email.send, through its provider.
+// Only effects listed in the declaration are allowed.
+func (c *Context) Effect(capability string, data map[string]any) error {
+	if !c.effects[capability] {
+		return fmt.Errorf("%w: %s is not listed in imperative %s", ErrUndeclaredEffect, capability, c.Name)
+	}
+	return c.exec(c, capability, data)
+}
+
+// Call runs the function registered for ctx.Name. A panic in the function is
+// logged with its stack and returned as an error.
+func Call(ctx *Context, input map[string]any) (result any, err error) {
+	fn := Get(ctx.Name)
+	if fn == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotRegistered, ctx.Name)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			ctx.Logger.Error("imperative panicked", "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("imperative %s panicked: %v", ctx.Name, r)
+		}
+	}()
+	return fn(ctx, input)
+}
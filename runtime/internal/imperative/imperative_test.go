@@ -0,0 +1,90 @@
+package imperative
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func newTestContext(name string, effects []string, exec EffectFunc) *Context {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewContext(context.Background(), name, uuid.Nil, nil, effects, exec, logger)
+}
+
+func TestRegister(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	fn := func(ctx *Context, input map[string]any) (any, error) { return nil, nil }
+	Register("export_csv", fn)
+	Register("calculate_metrics", fn)
+
+	if Get("export_csv") == nil {
+		t.Error("expected export_csv to be registered")
+	}
+	if Get("unknown") != nil {
+		t.Error("expected no function for unknown")
+	}
+	if got, want := Names(), []string{"calculate_metrics", "export_csv"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+	if got, want := Missing([]string{"sync_crm", "export_csv", "archive"}), []string{"archive", "sync_crm"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Missing() = %v, want %v", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic registering export_csv twice")
+		}
+	}()
+	Register("export_csv", fn)
+}
+
+func TestCall(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	Register("echo", func(ctx *Context, input map[string]any) (any, error) {
+		return input["value"], nil
+	})
+	Register("explode", func(ctx *Context, input map[string]any) (any, error) {
+		panic("boom")
+	})
+
+	result, err := Call(newTestContext("echo", nil, nil), map[string]any{"value": 42})
+	if err != nil || result != 42 {
+		t.Errorf("echo = %v, %v; want 42", result, err)
+	}
+
+	if _, err := Call(newTestContext("explode", nil, nil), nil); err == nil {
+		t.Error("expected the panic to be returned as an error")
+	}
+
+	if _, err := Call(newTestContext("missing", nil, nil), nil); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("expected ErrNotRegistered, got %v", err)
+	}
+}
+
+func TestContext_Effect(t *testing.T) {
+	var executed []string
+	exec := func(ctx context.Context, capability string, data map[string]any) error {
+		executed = append(executed, capability)
+		return nil
+	}
+	ctx := newTestContext("export_csv", []string{"email.send"}, exec)
+
+	if err := ctx.Effect("email.send", map[string]any{"to": "a@example.com"}); err != nil {
+		t.Errorf("declared effect failed: %v", err)
+	}
+	if err := ctx.Effect("http.call", nil); !errors.Is(err, ErrUndeclaredEffect) {
+		t.Errorf("expected ErrUndeclaredEffect, got %v", err)
+	}
+	if !reflect.DeepEqual(executed, []string{"email.send"}) {
+		t.Errorf("executed %v, want only email.send", executed)
+	}
+}
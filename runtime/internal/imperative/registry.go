@@ -0,0 +1,73 @@
+package imperative
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// registry holds the registered functions by name. Functions register
+// themselves during init(), before the server starts.
+var registry = struct {
+	mu    sync.RWMutex
+	funcs map[string]Func
+}{funcs: make(map[string]Func)}
+
+// Register adds the function implementing the imperative name.
+// Panics if name is already registered or fn is nil.
+func Register(name string, fn Func) {
+	if fn == nil {
+		panic(fmt.Sprintf("imperative %s registered with a nil function", name))
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if _, exists := registry.funcs[name]; exists {
+		panic(fmt.Sprintf("imperative already registered: %s", name))
+	}
+	registry.funcs[name] = fn
+}
+
+// Get returns the function registered for name, or nil.
+func Get(name string) Func {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return registry.funcs[name]
+}
+
+// Names returns the registered names in sorted order.
+func Names() []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	names := make([]string, 0, len(registry.funcs))
+	for name := range registry.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Missing returns the declared names that have no registered function, in
+// sorted order.
+func Missing(declared []string) []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	var missing []string
+	for _, name := range declared {
+		if _, ok := registry.funcs[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Reset clears the registry. Used for testing only.
+func Reset() {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.funcs = make(map[string]Func)
+}
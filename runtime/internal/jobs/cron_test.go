@@ -0,0 +1,47 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// 2025-01-01 is a Wednesday.
+	from := time.Date(2025, 1, 1, 6, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"0 7 * * *", time.Date(2025, 1, 1, 7, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 1, 6, 45, 0, 0, time.UTC)},
+		{"30 6 * * *", time.Date(2025, 1, 2, 6, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 6,7", time.Date(2025, 1, 4, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 15 * 5", time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC)}, // day-of-month or Friday
+		{"@hourly", time.Date(2025, 1, 1, 7, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			c, err := ParseCron(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseCron: %v", err)
+			}
+			if got := c.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{"", "0 7 * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "x * * * *", "@sometimes"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want error", spec)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrJobNotFound is returned when a dead-lettered job does not exist.
+var ErrJobNotFound = errors.New("job not found")
+
+// AttemptError records why one execution attempt failed.
+type AttemptError struct {
+	Attempt int       `json:"attempt"`
+	Error   string    `json:"error"`
+	At      time.Time `json:"at"`
+}
+
+// DeadJob is a job that exhausted its attempts, kept so an operator can
+// inspect it and either replay or discard it.
+type DeadJob struct {
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	Capability   string         `json:"capability"`
+	TargetEntity string         `json:"target_entity,omitempty"`
+	Data         map[string]any `json:"data"`
+	Attempts     int            `json:"attempts"`
+	MaxAttempts  int            `json:"max_attempts"`
+	LastError    string         `json:"last_error"`
+	Errors       []AttemptError `json:"errors"`
+	EnqueuedAt   time.Time      `json:"enqueued_at"`
+	FailedAt     time.Time      `json:"failed_at"`
+
+	// retry policy restored on replay from the in-memory store
+	timeout time.Duration
+	backoff *Backoff
+}
+
+// DeadLetterStore holds jobs that failed permanently.
+type DeadLetterStore interface {
+	// ListDead returns up to limit failed jobs, most recently failed first.
+	ListDead(ctx context.Context, limit int) ([]*DeadJob, error)
+
+	// GetDead returns one failed job, or ErrJobNotFound.
+	GetDead(ctx context.Context, id string) (*DeadJob, error)
+
+	// Replay moves a failed job back to the queue with its attempts reset.
+	// The error history is kept.
+	Replay(ctx context.Context, id string) error
+
+	// Discard deletes a failed job.
+	Discard(ctx context.Context, id string) error
+}
+
+// maxMemoryDeadJobs bounds the in-memory dead-letter store; the oldest
+// failures are dropped first.
+const maxMemoryDeadJobs = 1000
+
+// memoryDeadLetters keeps failed jobs for the in-memory queue. Like the
+// queue itself, its contents are lost on restart.
+type memoryDeadLetters struct {
+	mu   sync.Mutex
+	jobs map[string]*DeadJob
+}
+
+func newMemoryDeadLetters() *memoryDeadLetters {
+	return &memoryDeadLetters{jobs: make(map[string]*DeadJob)}
+}
+
+func (d *memoryDeadLetters) add(job *Job) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.jobs) >= maxMemoryDeadJobs {
+		var oldest *DeadJob
+		for _, dj := range d.jobs {
+			if oldest == nil || dj.FailedAt.Before(oldest.FailedAt) {
+				oldest = dj
+			}
+		}
+		delete(d.jobs, oldest.ID)
+	}
+	d.jobs[job.ID] = newDeadJob(job, time.Now())
+}
+
+func (d *memoryDeadLetters) list(limit int) []*DeadJob {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make([]*DeadJob, 0, len(d.jobs))
+	for _, dj := range d.jobs {
+		out = append(out, dj)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].FailedAt.After(out[j].FailedAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+func (d *memoryDeadLetters) get(id string) (*DeadJob, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dj, ok := d.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return dj, nil
+}
+
+func (d *memoryDeadLetters) remove(id string) (*DeadJob, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dj, ok := d.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	delete(d.jobs, id)
+	return dj, nil
+}
+
+func (d *memoryDeadLetters) restore(dj *DeadJob) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.jobs[dj.ID] = dj
+}
+
+func newDeadJob(job *Job, failedAt time.Time) *DeadJob {
+	return &DeadJob{
+		ID:           job.ID,
+		Name:         job.Name,
+		Capability:   job.Capability,
+		TargetEntity: job.TargetEntity,
+		Data:         job.Data,
+		Attempts:     job.Attempts,
+		MaxAttempts:  job.MaxAttempts,
+		LastError:    job.LastError,
+		Errors:       append([]AttemptError(nil), job.Errors...),
+		EnqueuedAt:   job.ScheduledAt,
+		FailedAt:     failedAt,
+		timeout:      job.Timeout,
+		backoff:      job.Backoff,
+	}
+}
+
+// job rebuilds a runnable job from the dead-letter entry with its attempts
+// reset.
+func (dj *DeadJob) job() *Job {
+	return &Job{
+		ID:           dj.ID,
+		Name:         dj.Name,
+		Capability:   dj.Capability,
+		Data:         dj.Data,
+		TargetEntity: dj.TargetEntity,
+		ScheduledAt:  time.Now(),
+		MaxAttempts:  dj.MaxAttempts,
+		Timeout:      dj.timeout,
+		Backoff:      dj.backoff,
+		LastError:    dj.LastError,
+		Errors:       dj.Errors,
+	}
+}
@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryQueue_DeadLetters(t *testing.T) {
+	q := newMemoryQueue(1, newTestLogger(), make(chan struct{}))
+	ctx := context.Background()
+
+	job := &Job{ID: "job_1", Name: "notify", Capability: "email.send", Attempts: 3, MaxAttempts: 3, LastError: "boom",
+		Errors: []AttemptError{{Attempt: 3, Error: "boom", At: time.Now()}}}
+	if err := q.Fail(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	dead, err := q.ListDead(ctx, 10)
+	if err != nil || len(dead) != 1 || dead[0].ID != "job_1" || dead[0].LastError != "boom" {
+		t.Fatalf("ListDead = %+v, %v", dead, err)
+	}
+	if _, err := q.GetDead(ctx, "job_missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("GetDead on missing job = %v, want ErrJobNotFound", err)
+	}
+
+	// Replay fails while the queue is full and keeps the job.
+	if err := q.Push(ctx, nil, &Job{ID: "filler"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Replay(ctx, "job_1"); err == nil {
+		t.Fatal("expected replay into a full queue to fail")
+	}
+	if _, err := q.GetDead(ctx, "job_1"); err != nil {
+		t.Fatalf("job lost after failed replay: %v", err)
+	}
+
+	q.Lease(ctx) // drain the filler
+	if err := q.Replay(ctx, "job_1"); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	replayed, err := q.Lease(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.ID != "job_1" || replayed.Attempts != 0 || len(replayed.Errors) != 1 {
+		t.Errorf("replayed job = %+v, want attempts reset and history kept", replayed)
+	}
+
+	if err := q.Discard(ctx, "job_1"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Discard after replay = %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestExecutorDeadLettersExhaustedJobs(t *testing.T) {
+	mock := &mockProvider{
+		name:         "failing",
+		capabilities: []string{"failing.call"},
+		executeFn: func(ctx context.Context, capability string, data map[string]any) error {
+			return errors.New("upstream unavailable")
+		},
+	}
+	reg := setupRegistry(mock)
+
+	ex := NewExecutor(reg, newTestLogger(), 1)
+	ex.Start()
+	defer ex.Stop()
+
+	if err := ex.Enqueue(&Job{ID: "job_1", Name: "sync", Capability: "failing.call", MaxAttempts: 2}); err != nil {
+		t.Fatal(err)
+	}
+	// First attempt retries after 1s; the second is dead-lettered.
+	if results := drainResults(ex.Results(), 2, 5*time.Second); len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+
+	dead, err := ex.DeadLetters().GetDead(context.Background(), "job_1")
+	if err != nil {
+		t.Fatalf("GetDead: %v", err)
+	}
+	if dead.Attempts != 2 || len(dead.Errors) != 2 {
+		t.Fatalf("dead job = %+v, want 2 attempts with 2 errors", dead)
+	}
+	for i, e := range dead.Errors {
+		if e.Attempt != i+1 || e.Error != "upstream unavailable" || e.At.IsZero() {
+			t.Errorf("errors[%d] = %+v", i, e)
+		}
+	}
+}
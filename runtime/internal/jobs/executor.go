@@ -7,12 +7,17 @@ package jobs
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+
+	"github.com/forge-lang/forge/compiler/naming"
 	"github.com/forge-lang/forge/runtime/internal/provider"
 )
 
@@ -21,12 +26,21 @@ type Job struct {
 	ID           string         // Unique job identifier
 	Name         string         // Job name from artifact (e.g., "notify_agents")
 	Capability   string         // Effect to execute (e.g., "email.send")
-	Data         map[string]any // Data from needs clause
+	Data         map[string]any // Triggering record; needs are resolved when the job runs
 	TargetEntity string         // Entity this job creates (empty for non-entity jobs)
-	ScheduledAt  time.Time      // When the job was enqueued
+	ScheduledAt  time.Time      // When the job becomes runnable (enqueue time unless delayed)
 	Attempts     int            // Number of execution attempts
-	MaxAttempts  int            // Maximum retry attempts
+	MaxAttempts  int            // Maximum attempts, including the first
+	Timeout      time.Duration  // Per-attempt timeout (0 uses the default)
+	Backoff      *Backoff       // Delay between retries (nil uses the default)
 	LastError    string         // Error from last attempt
+	Errors       []AttemptError // Error history, one entry per failed attempt
+}
+
+// recordError stores the error of the current attempt.
+func (j *Job) recordError(msg string) {
+	j.LastError = msg
+	j.Errors = append(j.Errors, AttemptError{Attempt: j.Attempts, Error: msg, At: time.Now().UTC()})
 }
 
 // JobResult contains the outcome of a job execution.
@@ -43,7 +57,10 @@ type Executor struct {
 	logger   *slog.Logger
 
 	// queue holds pending jobs
-	queue chan *Job
+	queue Queue
+	// needs loads the data declared by a job's needs clause; nil hands
+	// providers the raw job data
+	needs NeedsResolver
 	// results receives job outcomes
 	results chan *JobResult
 
@@ -52,8 +69,9 @@ type Executor struct {
 
 	// wg tracks running workers
 	wg sync.WaitGroup
-	// done signals shutdown
-	done chan struct{}
+	// ctx is cancelled on shutdown; workers and in-memory retries watch it
+	ctx    context.Context
+	cancel context.CancelFunc
 	// stopOnce ensures Stop() is safe to call multiple times
 	stopOnce sync.Once
 }
@@ -64,16 +82,42 @@ func NewExecutor(registry *provider.Registry, logger *slog.Logger, workers int)
 		workers = 10
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Executor{
 		registry: registry,
 		logger:   logger,
-		queue:    make(chan *Job, 1000),
+		queue:    newMemoryQueue(1000, logger, ctx.Done()),
 		results:  make(chan *JobResult, 1000),
 		workers:  workers,
-		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
 	}
 }
 
+// SetQueue replaces the default in-memory queue, e.g. with a PostgresQueue.
+// It must be called before Start.
+func (e *Executor) SetQueue(q Queue) {
+	e.queue = q
+}
+
+// SetNeedsResolver sets how jobs' needs clauses are resolved before they
+// execute. It must be called before Start.
+func (e *Executor) SetNeedsResolver(r NeedsResolver) {
+	e.needs = r
+}
+
+// Durable reports whether enqueued jobs survive a restart. Callers use it to
+// decide whether to enqueue inside their transaction (durable) or only after
+// it commits (in-memory).
+func (e *Executor) Durable() bool {
+	return e.queue.Durable()
+}
+
+// DeadLetters returns the store of jobs that exhausted their attempts.
+func (e *Executor) DeadLetters() DeadLetterStore {
+	return e.queue
+}
+
 // Start starts the executor workers.
 func (e *Executor) Start() {
 	for i := 0; i < e.workers; i++ {
@@ -89,7 +133,7 @@ func (e *Executor) Start() {
 // will terminate cleanly.
 func (e *Executor) Stop() {
 	e.stopOnce.Do(func() {
-		close(e.done)
+		e.cancel()
 		e.wg.Wait()
 		close(e.results)
 		e.logger.Info("job executor stopped")
@@ -98,28 +142,50 @@ func (e *Executor) Stop() {
 
 // Enqueue adds a job to the execution queue.
 func (e *Executor) Enqueue(job *Job) error {
+	return e.EnqueueTx(context.Background(), nil, job)
+}
+
+// EnqueueTx adds a job to the execution queue, writing it through q when the
+// queue is durable. Pass the caller's transaction as q so the job is only
+// visible to workers if that transaction commits.
+func (e *Executor) EnqueueTx(ctx context.Context, q Execer, job *Job) error {
+	e.setDefaults(job)
+
+	if e.ctx.Err() != nil {
+		return fmt.Errorf("executor is shutting down")
+	}
+	if err := e.queue.Push(ctx, q, job); err != nil {
+		return err
+	}
+
+	e.logger.Debug("job enqueued",
+		"job_id", job.ID,
+		"name", job.Name,
+		"capability", job.Capability,
+	)
+	return nil
+}
+
+// ClaimTick enqueues job for a schedule's tick unless another scheduler
+// already did, and reports whether this call enqueued it.
+func (e *Executor) ClaimTick(ctx context.Context, schedule string, tick time.Time, job *Job) (bool, error) {
+	e.setDefaults(job)
+
+	if e.ctx.Err() != nil {
+		return false, fmt.Errorf("executor is shutting down")
+	}
+	return e.queue.ClaimTick(ctx, schedule, tick, job)
+}
+
+func (e *Executor) setDefaults(job *Job) {
 	if job.ID == "" {
-		job.ID = fmt.Sprintf("job_%d", time.Now().UnixNano())
+		job.ID = "job_" + uuid.NewString()
 	}
 	if job.ScheduledAt.IsZero() {
 		job.ScheduledAt = time.Now()
 	}
 	if job.MaxAttempts <= 0 {
-		job.MaxAttempts = 3
-	}
-
-	select {
-	case e.queue <- job:
-		e.logger.Debug("job enqueued",
-			"job_id", job.ID,
-			"name", job.Name,
-			"capability", job.Capability,
-		)
-		return nil
-	case <-e.done:
-		return fmt.Errorf("executor is shutting down")
-	default:
-		return fmt.Errorf("job queue is full")
+		job.MaxAttempts = defaultMaxAttempts
 	}
 }
 
@@ -133,14 +199,19 @@ func (e *Executor) Workers() int {
 	return e.workers
 }
 
-// QueueCapacity returns the total capacity of the job queue.
+// QueueCapacity returns the total capacity of the job queue, or 0 if the
+// queue is unbounded.
 func (e *Executor) QueueCapacity() int {
-	return cap(e.queue)
+	return e.queue.Cap()
 }
 
 // QueueLength returns the current number of pending jobs in the queue.
 func (e *Executor) QueueLength() int {
-	return len(e.queue)
+	n, err := e.queue.Len(e.ctx)
+	if err != nil {
+		e.logger.Warn("job queue length unavailable", "error", err)
+	}
+	return n
 }
 
 // worker processes jobs from the queue.
@@ -148,31 +219,42 @@ func (e *Executor) worker(id int) {
 	defer e.wg.Done()
 
 	for {
-		select {
-		case <-e.done:
-			return
-		case job := <-e.queue:
-			result := e.execute(job)
+		job, err := e.queue.Lease(e.ctx)
+		if err != nil {
+			if e.ctx.Err() != nil {
+				return
+			}
+			e.logger.Error("job lease failed", "worker", id, "error", err)
 			select {
-			case e.results <- result:
-			default:
-				// Results channel full, log and continue
-				e.logger.Warn("results channel full, dropping result",
-					"job_id", job.ID,
-					"success", result.Success,
-				)
+			case <-e.ctx.Done():
+				return
+			case <-time.After(time.Second):
 			}
+			continue
+		}
+
+		result := e.execute(job)
+		select {
+		case e.results <- result:
+		default:
+			// Results channel full, log and continue
+			e.logger.Warn("results channel full, dropping result",
+				"job_id", job.ID,
+				"success", result.Success,
+			)
 		}
 	}
 }
 
-// execute runs a single job.
+// execute runs a single job and records the outcome in the queue.
 func (e *Executor) execute(job *Job) *JobResult {
 	start := time.Now()
 	result := &JobResult{
 		JobID: job.ID,
 	}
 
+	job.Attempts++
+
 	// Get capability provider
 	cap := e.registry.GetCapability(job.Capability)
 	if cap == nil {
@@ -182,24 +264,37 @@ func (e *Executor) execute(job *Job) *JobResult {
 			"capability", job.Capability,
 			"error", result.Error,
 		)
+		job.recordError(result.Error)
+		e.deadLetter(job)
 		return result
 	}
 
 	// Execute with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	timeout := job.Timeout
+	if timeout <= 0 {
+		timeout = defaultJobTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	job.Attempts++
-
-	err := cap.Execute(ctx, job.Capability, job.Data)
+	err := e.run(ctx, cap, job)
 	result.Duration = time.Since(start)
 
 	if err != nil {
 		result.Error = err.Error()
-		job.LastError = err.Error()
+		job.recordError(err.Error())
 
 		// Check if we should retry
-		if job.Attempts < job.MaxAttempts {
+		if provider.IsPermanent(err) {
+			e.logger.Error("job failed, not retryable",
+				"job_id", job.ID,
+				"name", job.Name,
+				"capability", job.Capability,
+				"attempt", job.Attempts,
+				"error", err,
+			)
+			e.deadLetter(job)
+		} else if job.Attempts < job.MaxAttempts {
 			e.logger.Warn("job failed, will retry",
 				"job_id", job.ID,
 				"name", job.Name,
@@ -208,26 +303,8 @@ func (e *Executor) execute(job *Job) *JobResult {
 				"max_attempts", job.MaxAttempts,
 				"error", err,
 			)
-			// Re-enqueue for retry with backoff.
-			// Capture attempts before spawning goroutine to avoid a data race
-			// on the Job struct (which may be read by another worker).
-			attempts := job.Attempts
-			go func() {
-				backoff := time.Duration(attempts*attempts) * time.Second
-				select {
-				case <-time.After(backoff):
-					if err := e.Enqueue(job); err != nil {
-						e.logger.Warn("retry enqueue failed",
-							"job_id", job.ID,
-							"error", err,
-						)
-					}
-				case <-e.done:
-					e.logger.Info("retry cancelled, executor shutting down",
-						"job_id", job.ID,
-					)
-				}
-			}()
+			// Re-enqueue for retry after the job's backoff.
+			e.record(job, e.queue.Retry(context.Background(), job, time.Now().Add(retryDelay(job))))
 		} else {
 			e.logger.Error("job failed, max attempts reached",
 				"job_id", job.ID,
@@ -236,6 +313,7 @@ func (e *Executor) execute(job *Job) *JobResult {
 				"attempts", job.Attempts,
 				"error", err,
 			)
+			e.deadLetter(job)
 		}
 	} else {
 		result.Success = true
@@ -245,51 +323,221 @@ func (e *Executor) execute(job *Job) *JobResult {
 			"capability", job.Capability,
 			"duration", result.Duration,
 		)
+		e.record(job, e.queue.Complete(context.Background(), job))
 	}
 
 	return result
 }
 
+// run resolves the job's needs and executes its capability. The resolved
+// records are passed as data["needs"], or, for a fan-out capability, the
+// capability runs once per record with it as data["recipient"]. A fan-out job
+// fails if any recipient fails; the recipients that succeeded are kept in the
+// job's data so a retry only runs the capability for the others.
+func (e *Executor) run(ctx context.Context, cap provider.CapabilityProvider, job *Job) error {
+	if e.needs == nil {
+		return cap.Execute(ctx, job.Capability, job.Data)
+	}
+
+	records, ok, err := e.needs.ResolveNeeds(ctx, job)
+	if err != nil {
+		return fmt.Errorf("resolving needs: %w", err)
+	}
+	if !ok {
+		return cap.Execute(ctx, job.Capability, job.Data)
+	}
+
+	if fo, isFanOut := cap.(provider.FanOutProvider); isFanOut && fo.FansOut(job.Capability) {
+		done := doneRecipients(job.Data)
+		var errs []error
+		skipped := 0
+		for _, record := range records {
+			id := fmt.Sprint(record["id"])
+			if done[id] {
+				skipped++
+				continue
+			}
+			data := withData(job.Data, "recipient", record)
+			if err := cap.Execute(ctx, job.Capability, data); err != nil {
+				errs = append(errs, fmt.Errorf("recipient %v: %w", record["id"], err))
+				continue
+			}
+			done[id] = true
+		}
+		if len(errs) > 0 {
+			setDoneRecipients(job, done)
+		}
+		e.logger.Debug("job fanned out",
+			"job_id", job.ID,
+			"recipients", len(records),
+			"skipped", skipped,
+			"failed", len(errs),
+		)
+		return errors.Join(errs...)
+	}
+
+	return cap.Execute(ctx, job.Capability, withData(job.Data, "needs", records))
+}
+
+// doneRecipientsKey holds, in the data of a fan-out job, the ids of the
+// recipients an earlier attempt already ran the capability for.
+const doneRecipientsKey = "_done_recipients"
+
+// doneRecipients returns the recipients recorded as done in data. Data read
+// back from a durable queue holds them as a JSON array.
+func doneRecipients(data map[string]any) map[string]bool {
+	done := make(map[string]bool)
+	switch ids := data[doneRecipientsKey].(type) {
+	case []string:
+		for _, id := range ids {
+			done[id] = true
+		}
+	case []any:
+		for _, id := range ids {
+			done[fmt.Sprint(id)] = true
+		}
+	}
+	return done
+}
+
+// setDoneRecipients records done in the job's data, which the queue keeps for
+// the next attempt.
+func setDoneRecipients(job *Job, done map[string]bool) {
+	ids := make([]string, 0, len(done))
+	for id := range done {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if job.Data == nil {
+		job.Data = make(map[string]any)
+	}
+	job.Data[doneRecipientsKey] = ids
+}
+
+// withData returns a copy of data with key set to value, leaving the job's
+// own data untouched across attempts. The recipients recorded as done are
+// left out.
+func withData(data map[string]any, key string, value any) map[string]any {
+	out := make(map[string]any, len(data)+1)
+	for k, v := range data {
+		if k != doneRecipientsKey {
+			out[k] = v
+		}
+	}
+	out[key] = value
+	return out
+}
+
+// deadLetter moves a job that failed permanently to the dead-letter store.
+func (e *Executor) deadLetter(job *Job) {
+	if err := e.queue.Fail(context.Background(), job); err != nil {
+		e.record(job, err)
+		return
+	}
+	e.logger.Error("job.dead_letter",
+		"job_id", job.ID,
+		"name", job.Name,
+		"capability", job.Capability,
+		"attempts", job.Attempts,
+		"last_error", job.LastError,
+	)
+}
+
+// record logs a failure to persist a job outcome. A durable queue hands the
+// job out again once its lease expires, so the outcome is retried rather than
+// lost. A lost lease means another worker runs the job now and records its
+// own outcome.
+func (e *Executor) record(job *Job, err error) {
+	if errors.Is(err, ErrLeaseLost) {
+		e.logger.Warn("job.lease_lost",
+			"job_id", job.ID,
+			"name", job.Name,
+			"attempt", job.Attempts,
+		)
+		return
+	}
+	if err != nil {
+		e.logger.Error("job outcome not recorded",
+			"job_id", job.ID,
+			"name", job.Name,
+			"error", err,
+		)
+	}
+}
+
 // EnqueueFromHook creates and enqueues jobs from a hook trigger.
 // This is called by the server when an entity lifecycle hook fires.
 func (e *Executor) EnqueueFromHook(jobNames []string, entityData map[string]any, jobSchemas map[string]*JobSchema) error {
+	return e.EnqueueFromHookTx(context.Background(), nil, jobNames, entityData, jobSchemas)
+}
+
+// EnqueueFromHookTx is EnqueueFromHook writing through q; see EnqueueTx.
+func (e *Executor) EnqueueFromHookTx(ctx context.Context, q Execer, jobNames []string, entityData map[string]any, jobSchemas map[string]*JobSchema) error {
 	for _, jobName := range jobNames {
-		schema, ok := jobSchemas[jobName]
-		if !ok {
-			e.logger.Warn("job schema not found", "job", jobName)
-			continue
+		if err := e.EnqueueDelayedFromHookTx(ctx, q, jobName, 0, entityData, jobSchemas); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		// Use first capability from job schema
-		capability := ""
-		if len(schema.Capabilities) > 0 {
-			capability = schema.Capabilities[0]
-		}
+// EnqueueDelayedFromHookTx enqueues one hook job that becomes runnable after
+// delay ("enqueue job in 24h").
+func (e *Executor) EnqueueDelayedFromHookTx(ctx context.Context, q Execer, jobName string, delay time.Duration, entityData map[string]any, jobSchemas map[string]*JobSchema) error {
+	schema, ok := jobSchemas[jobName]
+	if !ok {
+		e.logger.Warn("job schema not found", "job", jobName)
+		return nil
+	}
 
-		data := entityData
+	job := newJob(jobName, schema, entityData)
+	if delay > 0 {
+		job.ScheduledAt = time.Now().Add(delay)
+	}
 
-		// If this job has a creates clause (TargetEntity + FieldMappings),
-		// resolve field mappings and set up the entity.create data envelope.
-		if schema.TargetEntity != "" && len(schema.FieldMappings) > 0 {
-			fieldValues := resolveFieldMappings(schema.FieldMappings, entityData)
-			data = map[string]any{
-				"_target_table": entityToTableName(schema.TargetEntity),
-				"_field_values": fieldValues,
-			}
-		}
+	if err := e.EnqueueTx(ctx, q, job); err != nil {
+		return fmt.Errorf("failed to enqueue job %s: %w", jobName, err)
+	}
+	return nil
+}
+
+// newJob builds a job from its schema and the triggering data.
+func newJob(name string, schema *JobSchema, entityData map[string]any) *Job {
+	// Use first capability from job schema
+	capability := ""
+	if len(schema.Capabilities) > 0 {
+		capability = schema.Capabilities[0]
+	}
+
+	data := entityData
 
-		job := &Job{
-			Name:         jobName,
-			Capability:   capability,
-			Data:         data,
-			TargetEntity: schema.TargetEntity,
+	// If this job has a creates clause (TargetEntity + FieldMappings),
+	// resolve field mappings and set up the entity.create data envelope.
+	if schema.TargetEntity != "" && len(schema.FieldMappings) > 0 {
+		fieldValues := resolveFieldMappings(schema.FieldMappings, entityData)
+		data = map[string]any{
+			"_target_table": schema.targetTable(),
+			"_field_values": fieldValues,
 		}
+	}
 
-		if err := e.Enqueue(job); err != nil {
-			return fmt.Errorf("failed to enqueue job %s: %w", jobName, err)
+	// A job calling an imperative passes the triggering record as its input.
+	if schema.Imperative != "" {
+		data = map[string]any{
+			"_imperative": schema.Imperative,
+			"_input":      entityData,
 		}
 	}
-	return nil
+
+	return &Job{
+		Name:         name,
+		Capability:   capability,
+		Data:         data,
+		TargetEntity: schema.TargetEntity,
+		MaxAttempts:  schema.MaxAttempts,
+		Timeout:      schema.Timeout,
+		Backoff:      schema.Backoff,
+	}
 }
 
 // resolveFieldMappings evaluates field mapping expressions against entity data.
@@ -341,17 +589,12 @@ func resolveFieldExpr(expr string, entityData map[string]any) any {
 	return expr
 }
 
-// entityToTableName converts a PascalCase entity name to a snake_case plural
-// SQL table name. For example: "AuditLog" -> "audit_logs", "Ticket" -> "tickets".
-func entityToTableName(entity string) string {
-	var result strings.Builder
-	for i, r := range entity {
-		if i > 0 && r >= 'A' && r <= 'Z' {
-			result.WriteByte('_')
-		}
-		result.WriteRune(r)
-	}
-	return strings.ToLower(result.String()) + "s"
+// NeedsResolver loads the data a job declares in its needs clause, e.g. the
+// members of a ticket's organization for `needs: Ticket.org.members`.
+type NeedsResolver interface {
+	// ResolveNeeds returns the records selected by the job's needs clause,
+	// or ok false if the job declares none.
+	ResolveNeeds(ctx context.Context, job *Job) (records []map[string]any, ok bool, err error)
 }
 
 // JobSchema mirrors the artifact's job schema for use by the executor.
@@ -361,6 +604,20 @@ type JobSchema struct {
 	NeedsPath     string
 	NeedsFilter   string
 	Capabilities  []string
+	Imperative    string // imperative called by the imperative.call capability
 	TargetEntity  string
+	TargetTable   string // table of TargetEntity; empty derives it from the name
 	FieldMappings map[string]string
+	Schedule      string        // cron expression; empty if the job is not scheduled
+	MaxAttempts   int           // 0 uses the default of 3
+	Timeout       time.Duration // per attempt; 0 uses the default of 30s
+	Backoff       *Backoff      // nil uses quadratic backoff
+}
+
+// targetTable returns the table the job's creates clause writes to.
+func (s *JobSchema) targetTable() string {
+	if s.TargetTable != "" {
+		return s.TargetTable
+	}
+	return naming.TableName(s.TargetEntity)
 }
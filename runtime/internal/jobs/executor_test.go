@@ -2,6 +2,7 @@ package jobs
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
@@ -773,23 +774,21 @@ func TestResolveFieldMappings(t *testing.T) {
 	}
 }
 
-func TestEntityToTableName(t *testing.T) {
+func TestJobSchemaTargetTable(t *testing.T) {
 	tests := []struct {
-		entity   string
+		schema   JobSchema
 		expected string
 	}{
-		{"Ticket", "tickets"},
-		{"AuditLog", "audit_logs"},
-		{"User", "users"},
-		{"ActivityLog", "activity_logs"},
-		{"HTTPRequest", "h_t_t_p_requests"}, // consecutive caps
+		{JobSchema{TargetEntity: "AuditLog"}, "audit_logs"},
+		{JobSchema{TargetEntity: "Category"}, "categories"},
+		{JobSchema{TargetEntity: "HTTPRequest"}, "http_requests"},
+		{JobSchema{TargetEntity: "Person", TargetTable: "legacy_people"}, "legacy_people"},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.entity, func(t *testing.T) {
-			result := entityToTableName(tt.entity)
-			if result != tt.expected {
-				t.Errorf("entityToTableName(%q) = %q, want %q", tt.entity, result, tt.expected)
+		t.Run(tt.schema.TargetEntity, func(t *testing.T) {
+			if got := tt.schema.targetTable(); got != tt.expected {
+				t.Errorf("targetTable() = %q, want %q", got, tt.expected)
 			}
 		})
 	}
@@ -865,3 +864,194 @@ func TestEnqueueFromHookEntityCreate(t *testing.T) {
 		t.Errorf("entity_id = %v, want 'ticket_999'", fieldValues["entity_id"])
 	}
 }
+
+func TestEnqueueFromHookImperative(t *testing.T) {
+	var capturedData map[string]any
+	mock := &mockProvider{
+		name:         "imperative",
+		capabilities: []string{"imperative.call"},
+		executeFn: func(ctx context.Context, capability string, data map[string]any) error {
+			capturedData = data
+			return nil
+		},
+	}
+	reg := setupRegistry(mock)
+
+	ex := NewExecutor(reg, newTestLogger(), 2)
+	ex.Start()
+	defer ex.Stop()
+
+	jobSchemas := map[string]*JobSchema{
+		"export_ticket": {
+			Name:         "export_ticket",
+			InputEntity:  "Ticket",
+			Capabilities: []string{"imperative.call"},
+			Imperative:   "export_csv",
+		},
+	}
+
+	entityData := map[string]any{"id": "ticket_999", "subject": "Broken login"}
+	if err := ex.EnqueueFromHook([]string{"export_ticket"}, entityData, jobSchemas); err != nil {
+		t.Fatalf("EnqueueFromHook failed: %v", err)
+	}
+
+	results := drainResults(ex.Results(), 1, 3*time.Second)
+	if len(results) != 1 || !results[0].Success {
+		t.Fatalf("expected 1 successful result, got %+v", results)
+	}
+
+	if capturedData["_imperative"] != "export_csv" {
+		t.Errorf("_imperative = %v, want 'export_csv'", capturedData["_imperative"])
+	}
+	input, ok := capturedData["_input"].(map[string]any)
+	if !ok || input["id"] != "ticket_999" {
+		t.Errorf("_input = %v, want the triggering record", capturedData["_input"])
+	}
+}
+
+// fanOutProvider is a mockProvider whose capabilities execute per recipient.
+type fanOutProvider struct {
+	mockProvider
+}
+
+func (f *fanOutProvider) FansOut(capability string) bool { return true }
+
+// needsFunc adapts a function to NeedsResolver.
+type needsFunc func(ctx context.Context, job *Job) ([]map[string]any, bool, error)
+
+func (f needsFunc) ResolveNeeds(ctx context.Context, job *Job) ([]map[string]any, bool, error) {
+	return f(ctx, job)
+}
+
+func TestExecuteResolvesNeeds(t *testing.T) {
+	agents := []map[string]any{
+		{"id": "u1", "email": "a@example.com"},
+		{"id": "u2", "email": "b@example.com"},
+	}
+	resolver := needsFunc(func(ctx context.Context, job *Job) ([]map[string]any, bool, error) {
+		switch job.Name {
+		case "no_needs":
+			return nil, false, nil
+		case "broken":
+			return nil, false, fmt.Errorf("relation missing")
+		}
+		return agents, true, nil
+	})
+
+	t.Run("job without needs gets its data", func(t *testing.T) {
+		mock := &mockProvider{name: "http", capabilities: []string{"http.call"}}
+		ex := NewExecutor(setupRegistry(mock), newTestLogger(), 1)
+		ex.SetNeedsResolver(resolver)
+
+		result := ex.execute(&Job{Name: "no_needs", Capability: "http.call", Data: map[string]any{"id": "t1"}, MaxAttempts: 1})
+		if !result.Success {
+			t.Fatalf("expected success, got %s", result.Error)
+		}
+		calls := mock.getCalls()
+		if len(calls) != 1 || calls[0].Data["id"] != "t1" || calls[0].Data["needs"] != nil {
+			t.Errorf("unexpected calls %+v", calls)
+		}
+	})
+
+	t.Run("resolved records are passed as needs", func(t *testing.T) {
+		mock := &mockProvider{name: "http", capabilities: []string{"http.call"}}
+		ex := NewExecutor(setupRegistry(mock), newTestLogger(), 1)
+		ex.SetNeedsResolver(resolver)
+
+		job := &Job{Name: "sync", Capability: "http.call", Data: map[string]any{"id": "t1"}, MaxAttempts: 1}
+		if result := ex.execute(job); !result.Success {
+			t.Fatalf("expected success, got %s", result.Error)
+		}
+		calls := mock.getCalls()
+		if len(calls) != 1 {
+			t.Fatalf("expected 1 call, got %d", len(calls))
+		}
+		needs, _ := calls[0].Data["needs"].([]map[string]any)
+		if len(needs) != 2 || calls[0].Data["id"] != "t1" {
+			t.Errorf("unexpected data %+v", calls[0].Data)
+		}
+		if _, ok := job.Data["needs"]; ok {
+			t.Error("resolved needs leaked into the job's data")
+		}
+	})
+
+	t.Run("fan-out capability runs once per recipient", func(t *testing.T) {
+		mock := &fanOutProvider{mockProvider{name: "email", capabilities: []string{"email.send"}}}
+		mock.executeFn = func(ctx context.Context, capability string, data map[string]any) error {
+			if data["recipient"].(map[string]any)["id"] == "u2" {
+				return fmt.Errorf("mailbox full")
+			}
+			return nil
+		}
+		ex := NewExecutor(setupRegistry(mock), newTestLogger(), 1)
+		ex.SetNeedsResolver(resolver)
+
+		result := ex.execute(&Job{Name: "notify_agents", Capability: "email.send", Data: map[string]any{"id": "t1"}, MaxAttempts: 1})
+		if result.Success || !strings.Contains(result.Error, "recipient u2: mailbox full") {
+			t.Errorf("expected recipient u2 failure, got %+v", result)
+		}
+		calls := mock.getCalls()
+		if len(calls) != 2 {
+			t.Fatalf("expected 2 calls, got %d", len(calls))
+		}
+		for i, call := range calls {
+			if call.Data["recipient"].(map[string]any)["id"] != agents[i]["id"] || call.Data["id"] != "t1" {
+				t.Errorf("call %d: unexpected data %+v", i, call.Data)
+			}
+		}
+	})
+
+	t.Run("retry skips recipients already done", func(t *testing.T) {
+		full := true
+		mock := &fanOutProvider{mockProvider{name: "email", capabilities: []string{"email.send"}}}
+		mock.executeFn = func(ctx context.Context, capability string, data map[string]any) error {
+			if full && data["recipient"].(map[string]any)["id"] == "u2" {
+				return fmt.Errorf("mailbox full")
+			}
+			return nil
+		}
+		ex := NewExecutor(setupRegistry(mock), newTestLogger(), 1)
+		ex.SetNeedsResolver(resolver)
+
+		job := &Job{Name: "notify_agents", Capability: "email.send", Data: map[string]any{"id": "t1"}, MaxAttempts: 2}
+		if err := ex.run(context.Background(), mock, job); err == nil {
+			t.Fatal("expected the first attempt to fail")
+		}
+
+		// A durable queue hands the job back with its data read from JSON
+		encoded, err := json.Marshal(job.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.Data = nil
+		if err := json.Unmarshal(encoded, &job.Data); err != nil {
+			t.Fatal(err)
+		}
+
+		full = false
+		if err := ex.run(context.Background(), mock, job); err != nil {
+			t.Fatalf("retry failed: %v", err)
+		}
+		calls := mock.getCalls()
+		if len(calls) != 3 || calls[2].Data["recipient"].(map[string]any)["id"] != "u2" {
+			t.Fatalf("expected the retry to only run for u2, got %+v", calls)
+		}
+		if _, ok := calls[2].Data[doneRecipientsKey]; ok {
+			t.Error("the recipients done must not be passed to the capability")
+		}
+	})
+
+	t.Run("resolution failure fails the attempt", func(t *testing.T) {
+		mock := &mockProvider{name: "http", capabilities: []string{"http.call"}}
+		ex := NewExecutor(setupRegistry(mock), newTestLogger(), 1)
+		ex.SetNeedsResolver(resolver)
+
+		result := ex.execute(&Job{Name: "broken", Capability: "http.call", MaxAttempts: 1})
+		if result.Success || !strings.Contains(result.Error, "resolving needs: relation missing") {
+			t.Errorf("expected needs error, got %+v", result)
+		}
+		if len(mock.getCalls()) != 0 {
+			t.Error("capability executed despite unresolved needs")
+		}
+	})
+}
@@ -0,0 +1,432 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+)
+
+// PostgresQueue is a durable queue backed by the _forge_jobs table.
+//
+// Workers lease jobs with SELECT ... FOR UPDATE SKIP LOCKED, so any number of
+// runtime replicas can share one table without handing the same job to two
+// workers. A lease lasts VisibilityTimeout; if a worker dies mid-job the lease
+// expires and another worker picks the job up again.
+type PostgresQueue struct {
+	db db.Database
+
+	// VisibilityTimeout is how long a leased job stays hidden from other
+	// workers. It should exceed the default job timeout; a job declaring a
+	// longer timeout keeps its lease for that timeout plus a minute.
+	VisibilityTimeout time.Duration
+
+	// PollInterval is how long Lease waits before polling an empty queue again.
+	PollInterval time.Duration
+}
+
+// NewPostgresQueue creates the _forge_jobs table if needed and returns a
+// queue backed by it.
+func NewPostgresQueue(ctx context.Context, database db.Database) (*PostgresQueue, error) {
+	if err := CreateJobsTable(ctx, database); err != nil {
+		return nil, fmt.Errorf("creating _forge_jobs table: %w", err)
+	}
+	return &PostgresQueue{
+		db:                database,
+		VisibilityTimeout: 5 * time.Minute,
+		PollInterval:      time.Second,
+	}, nil
+}
+
+// CreateJobsTable ensures the job queue table and the schedule tick table
+// exist.
+func CreateJobsTable(ctx context.Context, database db.Database) error {
+	if _, err := database.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS _forge_jobs (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			capability TEXT NOT NULL,
+			target_entity TEXT NOT NULL DEFAULT '',
+			data JSONB NOT NULL DEFAULT '{}',
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL DEFAULT 3,
+			last_error TEXT NOT NULL DEFAULT '',
+			run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			locked_until TIMESTAMPTZ,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`); err != nil {
+		return err
+	}
+	// Columns added after the table's first release; existing tables are
+	// upgraded in place.
+	if _, err := database.Exec(ctx, `
+		ALTER TABLE _forge_jobs
+			ADD COLUMN IF NOT EXISTS errors JSONB NOT NULL DEFAULT '[]',
+			ADD COLUMN IF NOT EXISTS timeout_ms BIGINT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS backoff JSONB NOT NULL DEFAULT 'null'
+	`); err != nil {
+		return err
+	}
+	if _, err := database.Exec(ctx, `
+		CREATE INDEX IF NOT EXISTS _forge_jobs_ready_idx
+			ON _forge_jobs (run_at) WHERE status IN ('pending', 'running')
+	`); err != nil {
+		return err
+	}
+	_, err := database.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS _forge_schedules (
+			name TEXT PRIMARY KEY,
+			last_tick TIMESTAMPTZ NOT NULL
+		)
+	`)
+	return err
+}
+
+// Push inserts the job through q, or through the queue's database when q is nil.
+func (p *PostgresQueue) Push(ctx context.Context, q Execer, job *Job) error {
+	if q == nil {
+		q = p.db
+	}
+
+	data, err := json.Marshal(job.Data)
+	if err != nil {
+		return fmt.Errorf("encoding job data: %w", err)
+	}
+	backoff, err := json.Marshal(job.Backoff)
+	if err != nil {
+		return fmt.Errorf("encoding job backoff: %w", err)
+	}
+
+	_, err = q.Exec(ctx, `
+		INSERT INTO _forge_jobs (id, name, capability, target_entity, data, attempts, max_attempts, last_error, run_at, timeout_ms, backoff)
+		VALUES ($1, $2, $3, $4, $5::jsonb, $6, $7, $8, $9, $10, $11::jsonb)`,
+		job.ID, job.Name, job.Capability, job.TargetEntity, string(data),
+		job.Attempts, job.MaxAttempts, job.LastError, job.ScheduledAt,
+		job.Timeout.Milliseconds(), string(backoff),
+	)
+	return err
+}
+
+// ClaimTick records tick as the schedule's last fired tick and pushes job in
+// the same transaction. The upsert only succeeds for a tick later than the
+// recorded one, so when several replicas reach the same tick exactly one of
+// them inserts the job.
+func (p *PostgresQueue) ClaimTick(ctx context.Context, schedule string, tick time.Time, job *Job) (bool, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+		INSERT INTO _forge_schedules (name, last_tick) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET last_tick = EXCLUDED.last_tick
+		WHERE _forge_schedules.last_tick < EXCLUDED.last_tick`,
+		schedule, tick,
+	)
+	if err != nil {
+		return false, fmt.Errorf("claiming tick for %s: %w", schedule, err)
+	}
+	if result.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if err := p.Push(ctx, tx, job); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("claiming tick for %s: %w", schedule, err)
+	}
+	return true, nil
+}
+
+// leaseQuery claims the oldest runnable job: a pending job that is due, or a
+// running job whose lease has expired. The attempt is counted when the lease
+// is taken so a worker crash still uses up an attempt; RETURNING reports the
+// count before this attempt because the executor increments it itself. The
+// lease outlasts the job's own timeout so a slow attempt is not handed out
+// twice.
+const leaseQuery = `
+	UPDATE _forge_jobs
+	SET status = 'running',
+		attempts = attempts + 1,
+		locked_until = NOW() + GREATEST($1::bigint, timeout_ms + 60000) * INTERVAL '1 millisecond',
+		updated_at = NOW()
+	WHERE id = (
+		SELECT id FROM _forge_jobs
+		WHERE (status = 'pending' AND run_at <= NOW())
+		   OR (status = 'running' AND locked_until < NOW())
+		ORDER BY run_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, name, capability, target_entity, data::text, attempts - 1, max_attempts, last_error, errors::text,
+		timeout_ms, backoff::text, run_at`
+
+// Lease polls for a runnable job until one is claimed or ctx is done.
+func (p *PostgresQueue) Lease(ctx context.Context) (*Job, error) {
+	for {
+		job, err := p.tryLease(ctx)
+		if err != nil || job != nil {
+			return job, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(p.PollInterval):
+		}
+	}
+}
+
+// tryLease claims one job, or returns nil if none is runnable. The claim runs
+// in its own transaction so the rows are read on a connection that stays
+// checked out until commit.
+func (p *PostgresQueue) tryLease(ctx context.Context) (*Job, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("leasing job: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	job, err := scanLeasedJob(tx.Query(ctx, leaseQuery, p.VisibilityTimeout.Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("leasing job: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("leasing job: %w", err)
+	}
+	return job, nil
+}
+
+func scanLeasedJob(rows db.Rows, err error) (*Job, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	var job Job
+	var data, history, backoff string
+	var timeoutMs int64
+	if err := rows.Scan(&job.ID, &job.Name, &job.Capability, &job.TargetEntity, &data,
+		&job.Attempts, &job.MaxAttempts, &job.LastError, &history,
+		&timeoutMs, &backoff, &job.ScheduledAt); err != nil {
+		return nil, fmt.Errorf("scanning job: %w", err)
+	}
+	if err := decodeJobJSON(job.ID, data, history, &job.Data, &job.Errors); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(backoff), &job.Backoff); err != nil {
+		return nil, fmt.Errorf("decoding backoff for job %s: %w", job.ID, err)
+	}
+	job.Timeout = time.Duration(timeoutMs) * time.Millisecond
+	return &job, rows.Err()
+}
+
+// Complete deletes a succeeded job.
+func (p *PostgresQueue) Complete(ctx context.Context, job *Job) error {
+	result, err := p.db.Exec(ctx, "DELETE FROM _forge_jobs WHERE id = $1 AND status = 'running' AND attempts = $2",
+		job.ID, job.Attempts)
+	return leaseHeld(job, result, err)
+}
+
+// leaseHeld checks the result of writing the outcome of job. Every outcome
+// is fenced on the lease it was run under: the job must still be running
+// with the attempt count its lease gave it, or its lease expired and another
+// worker leased it again.
+func leaseHeld(job *Job, result db.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("job %s attempt %d: %w", job.ID, job.Attempts, ErrLeaseLost)
+	}
+	return nil
+}
+
+// Retry releases the lease and reschedules the job for runAt. The job's data
+// is written back, since an attempt records the recipients it is done with.
+func (p *PostgresQueue) Retry(ctx context.Context, job *Job, runAt time.Time) error {
+	history, err := encodeErrors(job.Errors)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(job.Data)
+	if err != nil {
+		return fmt.Errorf("encoding job data: %w", err)
+	}
+	result, err := p.db.Exec(ctx, `
+		UPDATE _forge_jobs
+		SET status = 'pending', last_error = $3, run_at = $4,
+			errors = $5::jsonb, data = $6::jsonb, locked_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'running' AND attempts = $2`,
+		job.ID, job.Attempts, job.LastError, runAt, history, string(data),
+	)
+	return leaseHeld(job, result, err)
+}
+
+// Fail keeps the job with status failed; failed rows are the dead-letter
+// store. The job's data is written back as by Retry, so a replayed fan-out
+// job skips the recipients already done.
+func (p *PostgresQueue) Fail(ctx context.Context, job *Job) error {
+	history, err := encodeErrors(job.Errors)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(job.Data)
+	if err != nil {
+		return fmt.Errorf("encoding job data: %w", err)
+	}
+	result, err := p.db.Exec(ctx, `
+		UPDATE _forge_jobs
+		SET status = 'failed', last_error = $3, errors = $4::jsonb,
+			data = $5::jsonb, locked_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'running' AND attempts = $2`,
+		job.ID, job.Attempts, job.LastError, history, string(data),
+	)
+	return leaseHeld(job, result, err)
+}
+
+// Durable reports true: jobs survive restarts.
+func (p *PostgresQueue) Durable() bool { return true }
+
+// Len returns the number of pending and running jobs.
+func (p *PostgresQueue) Len(ctx context.Context) (int, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var n int
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM _forge_jobs WHERE status IN ('pending', 'running')").Scan(&n)
+	return n, err
+}
+
+// Cap returns 0: the table is unbounded.
+func (p *PostgresQueue) Cap() int { return 0 }
+
+const deadJobColumns = `id, name, capability, target_entity, data::text, attempts, max_attempts,
+	last_error, errors::text, created_at, updated_at`
+
+// ListDead returns failed jobs, most recently failed first.
+func (p *PostgresQueue) ListDead(ctx context.Context, limit int) ([]*DeadJob, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT `+deadJobColumns+` FROM _forge_jobs
+		WHERE status = 'failed' ORDER BY updated_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("listing failed jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var dead []*DeadJob
+	for rows.Next() {
+		dj, err := scanDeadJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		dead = append(dead, dj)
+	}
+	return dead, rows.Err()
+}
+
+// GetDead returns one failed job.
+func (p *PostgresQueue) GetDead(ctx context.Context, id string) (*DeadJob, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT `+deadJobColumns+` FROM _forge_jobs
+		WHERE id = $1 AND status = 'failed'`, id)
+	if err != nil {
+		return nil, fmt.Errorf("loading failed job: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrJobNotFound
+	}
+	return scanDeadJob(rows)
+}
+
+// Replay makes a failed job pending again with its attempts reset.
+func (p *PostgresQueue) Replay(ctx context.Context, id string) error {
+	result, err := p.db.Exec(ctx, `
+		UPDATE _forge_jobs
+		SET status = 'pending', attempts = 0, run_at = NOW(),
+			locked_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'failed'`, id)
+	return affectedOne(result, err)
+}
+
+// Discard deletes a failed job.
+func (p *PostgresQueue) Discard(ctx context.Context, id string) error {
+	result, err := p.db.Exec(ctx, "DELETE FROM _forge_jobs WHERE id = $1 AND status = 'failed'", id)
+	return affectedOne(result, err)
+}
+
+func affectedOne(result db.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+func scanDeadJob(rows db.Rows) (*DeadJob, error) {
+	var dj DeadJob
+	var data, history string
+	if err := rows.Scan(&dj.ID, &dj.Name, &dj.Capability, &dj.TargetEntity, &data,
+		&dj.Attempts, &dj.MaxAttempts, &dj.LastError, &history, &dj.EnqueuedAt, &dj.FailedAt); err != nil {
+		return nil, fmt.Errorf("scanning job: %w", err)
+	}
+	if err := decodeJobJSON(dj.ID, data, history, &dj.Data, &dj.Errors); err != nil {
+		return nil, err
+	}
+	return &dj, nil
+}
+
+func decodeJobJSON(id, data, history string, dataOut *map[string]any, errorsOut *[]AttemptError) error {
+	if err := json.Unmarshal([]byte(data), dataOut); err != nil {
+		return fmt.Errorf("decoding data for job %s: %w", id, err)
+	}
+	if err := json.Unmarshal([]byte(history), errorsOut); err != nil {
+		return fmt.Errorf("decoding errors for job %s: %w", id, err)
+	}
+	return nil
+}
+
+func encodeErrors(history []AttemptError) (string, error) {
+	if history == nil {
+		history = []AttemptError{}
+	}
+	b, err := json.Marshal(history)
+	if err != nil {
+		return "", fmt.Errorf("encoding job errors: %w", err)
+	}
+	return string(b), nil
+}
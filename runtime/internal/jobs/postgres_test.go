@@ -0,0 +1,405 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+)
+
+// ---------------------------------------------------------------------------
+// Fake database
+// ---------------------------------------------------------------------------
+
+type execCall struct {
+	query string
+	args  []any
+}
+
+// fakeDB records statements and answers the next query from queryRows.
+type fakeDB struct {
+	mu           sync.Mutex
+	execs        []execCall
+	queryRows    [][]any
+	rowsAffected int64
+}
+
+func (f *fakeDB) Connect(context.Context) error                       { return nil }
+func (f *fakeDB) Close() error                                        { return nil }
+func (f *fakeDB) ApplyMigration(context.Context, *db.Migration) error { return nil }
+func (f *fakeDB) WithUser(uuid.UUID) db.Database                      { return f }
+func (f *fakeDB) IsEmbedded() bool                                    { return false }
+func (f *fakeDB) Begin(context.Context) (db.Tx, error)                { return &fakeTx{f}, nil }
+
+func (f *fakeDB) QueryRow(ctx context.Context, query string, args ...any) db.Row {
+	return &fakeRow{}
+}
+
+func (f *fakeDB) Query(ctx context.Context, query string, args ...any) (db.Rows, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rows := &fakeRows{values: f.queryRows}
+	f.queryRows = nil
+	return rows, nil
+}
+
+func (f *fakeDB) Exec(ctx context.Context, query string, args ...any) (db.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.execs = append(f.execs, execCall{query: query, args: args})
+	return fakeResult(f.rowsAffected), nil
+}
+
+type fakeResult int64
+
+func (r fakeResult) RowsAffected() int64 { return int64(r) }
+
+func (f *fakeDB) statements() []execCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]execCall(nil), f.execs...)
+}
+
+type fakeTx struct{ db *fakeDB }
+
+func (t *fakeTx) Query(ctx context.Context, query string, args ...any) (db.Rows, error) {
+	return t.db.Query(ctx, query, args...)
+}
+func (t *fakeTx) QueryRow(ctx context.Context, query string, args ...any) db.Row {
+	return t.db.QueryRow(ctx, query, args...)
+}
+func (t *fakeTx) Exec(ctx context.Context, query string, args ...any) (db.Result, error) {
+	return t.db.Exec(ctx, query, args...)
+}
+func (t *fakeTx) Commit(context.Context) error   { return nil }
+func (t *fakeTx) Rollback(context.Context) error { return nil }
+
+type fakeRow struct{}
+
+func (r *fakeRow) Scan(dest ...any) error { return nil }
+
+// fakeRows scans a query's columns from values.
+type fakeRows struct {
+	values [][]any
+	idx    int
+}
+
+func (r *fakeRows) Next() bool {
+	if r.idx < len(r.values) {
+		r.idx++
+		return true
+	}
+	return false
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	row := r.values[r.idx-1]
+	for i, d := range dest {
+		switch d := d.(type) {
+		case *string:
+			*d = row[i].(string)
+		case *int:
+			*d = row[i].(int)
+		case *int64:
+			*d = row[i].(int64)
+		case *time.Time:
+			*d = row[i].(time.Time)
+		}
+	}
+	return nil
+}
+
+func (r *fakeRows) Values() ([]any, error)                   { return r.values[r.idx-1], nil }
+func (r *fakeRows) FieldDescriptions() []db.FieldDescription { return nil }
+func (r *fakeRows) Close() error                             { return nil }
+func (r *fakeRows) Err() error                               { return nil }
+
+// setupStatements is the number of statements NewPostgresQueue runs.
+const setupStatements = 4
+
+func newTestPostgresQueue(t *testing.T) (*PostgresQueue, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{}
+	q, err := NewPostgresQueue(context.Background(), fake)
+	if err != nil {
+		t.Fatalf("NewPostgresQueue: %v", err)
+	}
+	q.PollInterval = 10 * time.Millisecond
+	return q, fake
+}
+
+// ---------------------------------------------------------------------------
+// PostgresQueue tests
+// ---------------------------------------------------------------------------
+
+func TestPostgresQueue_CreatesTable(t *testing.T) {
+	_, fake := newTestPostgresQueue(t)
+
+	stmts := fake.statements()
+	if len(stmts) == 0 || !strings.Contains(stmts[0].query, "CREATE TABLE IF NOT EXISTS _forge_jobs") {
+		t.Fatalf("expected _forge_jobs to be created, got %v", stmts)
+	}
+	if len(stmts) < 2 || !strings.Contains(stmts[1].query, "ADD COLUMN IF NOT EXISTS errors") {
+		t.Errorf("expected later columns to be added to existing tables, got %v", stmts)
+	}
+}
+
+func TestPostgresQueue_PushThroughTransaction(t *testing.T) {
+	q, fake := newTestPostgresQueue(t)
+	tx := &fakeDB{}
+
+	job := &Job{ID: "job_1", Name: "notify", Capability: "email.send", Data: map[string]any{"id": "t1"}, MaxAttempts: 3}
+	if err := q.Push(context.Background(), tx, job); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	if n := len(fake.statements()); n != setupStatements {
+		t.Errorf("queue database saw %d statements after setup, want %d", n, setupStatements)
+	}
+	stmts := tx.statements()
+	if len(stmts) != 1 || !strings.Contains(stmts[0].query, "INSERT INTO _forge_jobs") {
+		t.Fatalf("expected INSERT through the transaction, got %v", stmts)
+	}
+	if data := stmts[0].args[4].(string); data != `{"id":"t1"}` {
+		t.Errorf("data = %s, want JSON-encoded job data", data)
+	}
+	if stmts[0].args[9] != int64(0) || stmts[0].args[10] != "null" {
+		t.Errorf("timeout, backoff = %v, %v, want defaults", stmts[0].args[9], stmts[0].args[10])
+	}
+}
+
+func TestPostgresQueue_Lease(t *testing.T) {
+	q, fake := newTestPostgresQueue(t)
+	runAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake.queryRows = [][]any{{"job_1", "notify", "email.send", "Ticket", `{"id":"t1"}`, 1, 3, "timeout",
+		`[{"attempt":1,"error":"timeout","at":"2025-01-01T00:00:00Z"}]`,
+		int64(120000), `{"strategy":"exponential","base":2000000000,"max":600000000000}`, runAt}}
+
+	job, err := q.Lease(context.Background())
+	if err != nil {
+		t.Fatalf("Lease: %v", err)
+	}
+	if job.ID != "job_1" || job.Capability != "email.send" || job.TargetEntity != "Ticket" {
+		t.Errorf("unexpected job %+v", job)
+	}
+	if job.Attempts != 1 || job.MaxAttempts != 3 || job.LastError != "timeout" || !job.ScheduledAt.Equal(runAt) {
+		t.Errorf("persisted fields not restored: %+v", job)
+	}
+	if job.Data["id"] != "t1" {
+		t.Errorf("data = %v, want id t1", job.Data)
+	}
+	if len(job.Errors) != 1 || job.Errors[0].Error != "timeout" {
+		t.Errorf("errors = %+v, want the first attempt's error", job.Errors)
+	}
+	if job.Timeout != 2*time.Minute {
+		t.Errorf("timeout = %v, want 2m", job.Timeout)
+	}
+	if b := job.Backoff; b == nil || b.Strategy != "exponential" || b.Base != 2*time.Second || b.Max != 10*time.Minute {
+		t.Errorf("backoff = %+v, want exponential(2s, max 10m)", job.Backoff)
+	}
+}
+
+func TestPostgresQueue_LeaseWaitsForContext(t *testing.T) {
+	q, _ := newTestPostgresQueue(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := q.Lease(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded on empty queue, got %v", err)
+	}
+}
+
+func TestPostgresQueue_Outcomes(t *testing.T) {
+	q, fake := newTestPostgresQueue(t)
+	job := &Job{ID: "job_1", Attempts: 2, LastError: "boom",
+		Data:   map[string]any{doneRecipientsKey: []string{"u1"}},
+		Errors: []AttemptError{{Attempt: 1, Error: "boom", At: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}}}
+	ctx := context.Background()
+	fake.rowsAffected = 1
+
+	retryAt := time.Now().Add(time.Minute)
+	if err := q.Retry(ctx, job, retryAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Fail(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Complete(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	stmts := fake.statements()[setupStatements:]
+	if len(stmts) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(stmts))
+	}
+	if !strings.Contains(stmts[0].query, "status = 'pending'") || stmts[0].args[1] != 2 || stmts[0].args[3] != retryAt ||
+		stmts[0].args[5] != `{"_done_recipients":["u1"]}` {
+		t.Errorf("retry statement = %+v", stmts[0])
+	}
+	if !strings.Contains(stmts[1].query, "status = 'failed'") || stmts[1].args[2] != "boom" ||
+		stmts[1].args[3] != `[{"attempt":1,"error":"boom","at":"2025-01-01T00:00:00Z"}]` || stmts[1].args[4] != `{"_done_recipients":["u1"]}` {
+		t.Errorf("fail statement = %+v", stmts[1])
+	}
+	if !strings.HasPrefix(stmts[2].query, "DELETE FROM _forge_jobs") {
+		t.Errorf("complete statement = %+v", stmts[2])
+	}
+}
+
+// A worker whose lease expired must not overwrite the outcome of the worker
+// that leased the job again.
+func TestPostgresQueue_OutcomesFencedOnLease(t *testing.T) {
+	q, fake := newTestPostgresQueue(t)
+	job := &Job{ID: "job_1", Attempts: 2}
+	ctx := context.Background()
+
+	outcomes := map[string]func() error{
+		"complete": func() error { return q.Complete(ctx, job) },
+		"retry":    func() error { return q.Retry(ctx, job, time.Now()) },
+		"fail":     func() error { return q.Fail(ctx, job) },
+	}
+	for name, outcome := range outcomes {
+		if err := outcome(); !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("%s after the lease was taken over = %v, want ErrLeaseLost", name, err)
+		}
+	}
+	for _, stmt := range fake.statements()[setupStatements:] {
+		if !strings.Contains(stmt.query, "status = 'running' AND attempts = $2") || stmt.args[1] != 2 {
+			t.Errorf("outcome not fenced on the lease: %+v", stmt)
+		}
+	}
+}
+
+func TestPostgresQueue_DeadLetters(t *testing.T) {
+	q, fake := newTestPostgresQueue(t)
+	ctx := context.Background()
+	enqueued := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	failed := enqueued.Add(time.Minute)
+	fake.queryRows = [][]any{{"job_1", "notify", "email.send", "", `{"id":"t1"}`, 3, 3, "timeout",
+		`[{"attempt":3,"error":"timeout","at":"2025-01-01T00:01:00Z"}]`, enqueued, failed}}
+
+	dead, err := q.ListDead(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListDead: %v", err)
+	}
+	if len(dead) != 1 || dead[0].ID != "job_1" || !dead[0].FailedAt.Equal(failed) || !dead[0].EnqueuedAt.Equal(enqueued) {
+		t.Fatalf("unexpected dead jobs %+v", dead)
+	}
+	if len(dead[0].Errors) != 1 || dead[0].Errors[0].Attempt != 3 {
+		t.Errorf("errors = %+v, want attempt 3", dead[0].Errors)
+	}
+
+	if _, err := q.GetDead(ctx, "job_missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("GetDead on missing job = %v, want ErrJobNotFound", err)
+	}
+
+	fake.rowsAffected = 0
+	if err := q.Replay(ctx, "job_missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Replay on missing job = %v, want ErrJobNotFound", err)
+	}
+	if err := q.Discard(ctx, "job_missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Discard on missing job = %v, want ErrJobNotFound", err)
+	}
+
+	fake.rowsAffected = 1
+	if err := q.Replay(ctx, "job_1"); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	stmts := fake.statements()
+	replay := stmts[len(stmts)-1]
+	if !strings.Contains(replay.query, "status = 'pending', attempts = 0") || !strings.Contains(replay.query, "status = 'failed'") {
+		t.Errorf("replay statement = %+v", replay)
+	}
+}
+
+func TestPostgresQueue_ClaimTick(t *testing.T) {
+	q, fake := newTestPostgresQueue(t)
+	ctx := context.Background()
+	tick := time.Date(2025, 1, 1, 7, 0, 0, 0, time.UTC)
+	job := &Job{ID: "job_1", Name: "digest", Capability: "email.send", ScheduledAt: tick}
+
+	fake.rowsAffected = 0
+	claimed, err := q.ClaimTick(ctx, "digest", tick, job)
+	if err != nil || claimed {
+		t.Fatalf("ClaimTick on a claimed tick = %v, %v; want false", claimed, err)
+	}
+	stmts := fake.statements()[setupStatements:]
+	if len(stmts) != 1 || !strings.Contains(stmts[0].query, "WHERE _forge_schedules.last_tick < EXCLUDED.last_tick") {
+		t.Fatalf("expected only the claim upsert, got %v", stmts)
+	}
+
+	fake.rowsAffected = 1
+	claimed, err = q.ClaimTick(ctx, "digest", tick, job)
+	if err != nil || !claimed {
+		t.Fatalf("ClaimTick = %v, %v; want true", claimed, err)
+	}
+	stmts = fake.statements()[setupStatements+1:]
+	if len(stmts) != 2 || !strings.Contains(stmts[1].query, "INSERT INTO _forge_jobs") {
+		t.Fatalf("expected claim then insert, got %v", stmts)
+	}
+	if stmts[1].args[8] != tick {
+		t.Errorf("run_at = %v, want %v", stmts[1].args[8], tick)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Executor with a durable queue
+// ---------------------------------------------------------------------------
+
+func TestExecutorRecordsOutcomesInQueue(t *testing.T) {
+	mock := &mockProvider{
+		name:         "flaky",
+		capabilities: []string{"flaky.call"},
+		executeFn: func(ctx context.Context, capability string, data map[string]any) error {
+			if data["fail"] == true {
+				return errors.New("upstream unavailable")
+			}
+			return nil
+		},
+	}
+	reg := setupRegistry(mock)
+
+	tests := []struct {
+		name     string
+		job      []any
+		wantStmt string
+	}{
+		{"success completes", []any{"job_ok", "ok", "flaky.call", "", `{}`, 0, 3, "", "[]", int64(0), "null", time.Now()}, "DELETE FROM _forge_jobs"},
+		{"failure retries", []any{"job_retry", "retry", "flaky.call", "", `{"fail":true}`, 0, 3, "", "[]", int64(0), "null", time.Now()}, "status = 'pending'"},
+		{"last attempt fails", []any{"job_dead", "dead", "flaky.call", "", `{"fail":true}`, 2, 3, "", "[]", int64(0), "null", time.Now()}, "status = 'failed'"},
+		{"unknown capability fails", []any{"job_nocap", "nocap", "missing.call", "", `{}`, 0, 3, "", "[]", int64(0), "null", time.Now()}, "status = 'failed'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, fake := newTestPostgresQueue(t)
+			fake.queryRows = [][]any{tt.job}
+
+			ex := NewExecutor(reg, newTestLogger(), 1)
+			ex.SetQueue(q)
+			ex.Start()
+
+			results := drainResults(ex.Results(), 1, 2*time.Second)
+			ex.Stop()
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %d", len(results))
+			}
+
+			var found bool
+			for _, stmt := range fake.statements() {
+				if strings.Contains(stmt.query, tt.wantStmt) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected a statement containing %q, got %v", tt.wantStmt, fake.statements())
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+)
+
+// Execer executes a statement. Both db.Database and db.Tx satisfy it, which
+// lets a durable queue write a job inside the caller's transaction.
+type Execer interface {
+	Exec(ctx context.Context, query string, args ...any) (db.Result, error)
+}
+
+// ErrLeaseLost is returned when the outcome of a job is recorded after its
+// lease expired and another worker leased it again.
+var ErrLeaseLost = errors.New("job lease lost")
+
+// Queue stores pending jobs for the executor's workers.
+type Queue interface {
+	// Push adds a job. Durable queues write through q when it is non-nil,
+	// so a job pushed inside a transaction only becomes visible once that
+	// transaction commits. A job whose ScheduledAt is in the future is not
+	// leased before then.
+	Push(ctx context.Context, q Execer, job *Job) error
+
+	// ClaimTick pushes job for a schedule's tick unless that tick, or a
+	// later one, was already claimed, and reports whether this call claimed
+	// it. Durable queues record ticks in the database so each tick fires
+	// once however many replicas run the scheduler.
+	ClaimTick(ctx context.Context, schedule string, tick time.Time, job *Job) (bool, error)
+
+	// Lease blocks until a job is ready to run or ctx is done. The job is
+	// hidden from other workers until it is completed, retried or failed,
+	// or until its lease expires.
+	Lease(ctx context.Context) (*Job, error)
+
+	// Complete records that a leased job succeeded. Complete, Retry and
+	// Fail return ErrLeaseLost when the job's lease expired and it was
+	// leased again, leaving the job to the worker that holds it now.
+	Complete(ctx context.Context, job *Job) error
+
+	// Retry returns a leased job to the queue to run again at runAt.
+	Retry(ctx context.Context, job *Job, runAt time.Time) error
+
+	// Fail records that a leased job exhausted its attempts and moves it to
+	// the dead-letter store.
+	Fail(ctx context.Context, job *Job) error
+
+	// Durable reports whether pushed jobs survive a restart.
+	Durable() bool
+
+	// Len returns the number of pending jobs.
+	Len(ctx context.Context) (int, error)
+
+	// Cap returns the queue capacity, or 0 if it is unbounded.
+	Cap() int
+
+	DeadLetterStore
+}
+
+// memoryQueue is the default in-process queue. Jobs are lost on restart.
+type memoryQueue struct {
+	jobs   chan *Job
+	dead   *memoryDeadLetters
+	logger *slog.Logger
+	// done is closed on executor shutdown and abandons pending retries
+	done <-chan struct{}
+
+	mu    sync.Mutex
+	ticks map[string]time.Time // last claimed tick per schedule
+}
+
+func newMemoryQueue(capacity int, logger *slog.Logger, done <-chan struct{}) *memoryQueue {
+	return &memoryQueue{
+		jobs:   make(chan *Job, capacity),
+		dead:   newMemoryDeadLetters(),
+		logger: logger,
+		done:   done,
+		ticks:  make(map[string]time.Time),
+	}
+}
+
+// Push queues the job, or holds it until ScheduledAt when that is in the
+// future. Held jobs are dropped at shutdown.
+func (m *memoryQueue) Push(_ context.Context, _ Execer, job *Job) error {
+	if time.Until(job.ScheduledAt) > 0 {
+		m.pushAt(job, job.ScheduledAt)
+		return nil
+	}
+	select {
+	case m.jobs <- job:
+		return nil
+	default:
+		return fmt.Errorf("job queue is full")
+	}
+}
+
+func (m *memoryQueue) ClaimTick(ctx context.Context, schedule string, tick time.Time, job *Job) (bool, error) {
+	m.mu.Lock()
+	if last, ok := m.ticks[schedule]; ok && !tick.After(last) {
+		m.mu.Unlock()
+		return false, nil
+	}
+	m.ticks[schedule] = tick
+	m.mu.Unlock()
+
+	return true, m.Push(ctx, nil, job)
+}
+
+func (m *memoryQueue) Lease(ctx context.Context) (*Job, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case job := <-m.jobs:
+		return job, nil
+	}
+}
+
+func (m *memoryQueue) Complete(context.Context, *Job) error { return nil }
+
+// Retry re-pushes the job once runAt passes. Retries still waiting at
+// shutdown are dropped.
+func (m *memoryQueue) Retry(_ context.Context, job *Job, runAt time.Time) error {
+	m.pushAt(job, runAt)
+	return nil
+}
+
+// pushAt pushes the job once runAt passes, unless the executor shuts down
+// first.
+func (m *memoryQueue) pushAt(job *Job, runAt time.Time) {
+	go func() {
+		select {
+		case <-time.After(time.Until(runAt)):
+			select {
+			case m.jobs <- job:
+			default:
+				m.logger.Warn("delayed enqueue failed",
+					"job_id", job.ID,
+					"error", "job queue is full",
+				)
+			}
+		case <-m.done:
+			m.logger.Info("delayed job dropped, executor shutting down",
+				"job_id", job.ID,
+			)
+		}
+	}()
+}
+
+func (m *memoryQueue) Fail(_ context.Context, job *Job) error {
+	m.dead.add(job)
+	return nil
+}
+
+func (m *memoryQueue) Durable() bool { return false }
+
+func (m *memoryQueue) Len(context.Context) (int, error) { return len(m.jobs), nil }
+
+func (m *memoryQueue) Cap() int { return cap(m.jobs) }
+
+func (m *memoryQueue) ListDead(_ context.Context, limit int) ([]*DeadJob, error) {
+	return m.dead.list(limit), nil
+}
+
+func (m *memoryQueue) GetDead(_ context.Context, id string) (*DeadJob, error) {
+	return m.dead.get(id)
+}
+
+// Replay pushes the job back onto the queue. If the queue is full the job
+// stays in the dead-letter store.
+func (m *memoryQueue) Replay(ctx context.Context, id string) error {
+	dj, err := m.dead.remove(id)
+	if err != nil {
+		return err
+	}
+	if err := m.Push(ctx, nil, dj.job()); err != nil {
+		m.dead.restore(dj)
+		return err
+	}
+	return nil
+}
+
+func (m *memoryQueue) Discard(_ context.Context, id string) error {
+	_, err := m.dead.remove(id)
+	return err
+}
@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	// defaultJobTimeout bounds one attempt of a job that declares no timeout.
+	defaultJobTimeout = 30 * time.Second
+
+	// defaultMaxAttempts is used for jobs that declare no retry count.
+	defaultMaxAttempts = 3
+)
+
+// Backoff is a job's declared delay between retries, e.g.
+// `backoff: exponential(2s, max 10m)`.
+type Backoff struct {
+	Strategy string        `json:"strategy"` // "exponential", "linear" or "fixed"
+	Base     time.Duration `json:"base"`
+	Max      time.Duration `json:"max,omitempty"` // 0 means uncapped
+}
+
+// Delay returns the delay before the given retry (1 for the first) without
+// jitter: base * 2^(retry-1) for exponential, base * retry for linear and
+// base for fixed, capped at Max.
+func (b *Backoff) Delay(retry int) time.Duration {
+	if retry < 1 {
+		retry = 1
+	}
+
+	d := b.Base
+	switch b.Strategy {
+	case "exponential":
+		// Stop doubling once past the cap; it is applied below.
+		for i := 1; i < retry && d < maxBackoff; i++ {
+			d *= 2
+		}
+	case "linear":
+		d = b.Base * time.Duration(retry)
+	}
+
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// maxBackoff caps uncapped backoffs so long retry chains cannot overflow.
+const maxBackoff = 7 * 24 * time.Hour
+
+// retryDelay returns how long to wait before retrying job after its current
+// attempt. Declared backoffs get "equal jitter": a random delay between half
+// and all of the computed one, so jobs that failed together do not retry in
+// lockstep. Jobs without a backoff keep the quadratic default (1s, 4s, 9s...).
+func retryDelay(job *Job) time.Duration {
+	if job.Backoff == nil {
+		return time.Duration(job.Attempts*job.Attempts) * time.Second
+	}
+	d := job.Backoff.Delay(job.Attempts)
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + rand.N(d-half+1)
+}
@@ -0,0 +1,109 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forge-lang/forge/runtime/internal/provider"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff Backoff
+		retry   int
+		want    time.Duration
+	}{
+		{"exponential first retry", Backoff{Strategy: "exponential", Base: 2 * time.Second}, 1, 2 * time.Second},
+		{"exponential doubles", Backoff{Strategy: "exponential", Base: 2 * time.Second}, 4, 16 * time.Second},
+		{"exponential capped", Backoff{Strategy: "exponential", Base: 2 * time.Second, Max: 10 * time.Minute}, 20, 10 * time.Minute},
+		{"exponential uncapped stays bounded", Backoff{Strategy: "exponential", Base: time.Second}, 200, maxBackoff},
+		{"linear", Backoff{Strategy: "linear", Base: 5 * time.Second}, 3, 15 * time.Second},
+		{"linear capped", Backoff{Strategy: "linear", Base: 5 * time.Second, Max: 12 * time.Second}, 3, 12 * time.Second},
+		{"fixed", Backoff{Strategy: "fixed", Base: 30 * time.Second}, 7, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.backoff.Delay(tt.retry); got != tt.want {
+				t.Errorf("Delay(%d) = %v, want %v", tt.retry, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if got := retryDelay(&Job{Attempts: 3}); got != 9*time.Second {
+		t.Errorf("default backoff = %v, want quadratic 9s", got)
+	}
+
+	job := &Job{Attempts: 3, Backoff: &Backoff{Strategy: "exponential", Base: 2 * time.Second}}
+	for i := 0; i < 100; i++ {
+		if got := retryDelay(job); got < 4*time.Second || got > 8*time.Second {
+			t.Fatalf("jittered delay %v outside [4s, 8s]", got)
+		}
+	}
+}
+
+func TestExecuteRetryPolicy(t *testing.T) {
+	t.Run("permanent error is not retried", func(t *testing.T) {
+		mock := &mockProvider{name: "http", capabilities: []string{"http.call"},
+			executeFn: func(ctx context.Context, capability string, data map[string]any) error {
+				return provider.Permanent(errors.New("HTTP 404: not found"))
+			}}
+		ex := NewExecutor(setupRegistry(mock), newTestLogger(), 1)
+
+		job := &Job{ID: "job_1", Name: "sync", Capability: "http.call", MaxAttempts: 5}
+		ex.execute(job)
+
+		dead, err := ex.DeadLetters().GetDead(context.Background(), "job_1")
+		if err != nil {
+			t.Fatalf("expected the job to be dead-lettered after one attempt: %v", err)
+		}
+		if dead.Attempts != 1 {
+			t.Errorf("attempts = %d, want 1", dead.Attempts)
+		}
+	})
+
+	t.Run("transient fan-out failure is retried", func(t *testing.T) {
+		err := errors.Join(provider.Permanent(errors.New("bad address")), errors.New("connection reset"))
+		if provider.IsPermanent(err) {
+			t.Error("a partly transient failure must be retried")
+		}
+		if !provider.IsPermanent(errors.Join(provider.Permanent(errors.New("a")), provider.Permanent(errors.New("b")))) {
+			t.Error("a failure where every recipient failed permanently must not be retried")
+		}
+	})
+
+	t.Run("timeout bounds the attempt", func(t *testing.T) {
+		var deadline time.Duration
+		mock := &mockProvider{name: "http", capabilities: []string{"http.call"},
+			executeFn: func(ctx context.Context, capability string, data map[string]any) error {
+				d, _ := ctx.Deadline()
+				deadline = time.Until(d)
+				return nil
+			}}
+		ex := NewExecutor(setupRegistry(mock), newTestLogger(), 1)
+
+		ex.execute(&Job{Name: "sync", Capability: "http.call", Timeout: 2 * time.Minute})
+		if deadline <= defaultJobTimeout || deadline > 2*time.Minute {
+			t.Errorf("attempt deadline in %v, want about 2m", deadline)
+		}
+	})
+}
+
+func TestNewJobAppliesRetryPolicy(t *testing.T) {
+	backoff := &Backoff{Strategy: "fixed", Base: time.Second}
+	job := newJob("sync", &JobSchema{
+		Capabilities: []string{"http.call"},
+		MaxAttempts:  6,
+		Timeout:      2 * time.Minute,
+		Backoff:      backoff,
+	}, map[string]any{"id": "t1"})
+
+	if job.MaxAttempts != 6 || job.Timeout != 2*time.Minute || job.Backoff != backoff {
+		t.Errorf("retry policy not copied from schema: %+v", job)
+	}
+}
@@ -0,0 +1,194 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxSchedulerSleep bounds how long the scheduler sleeps between checks, so
+// it recovers from clock jumps and suspended hosts within a minute.
+const maxSchedulerSleep = time.Minute
+
+// Scheduler enqueues jobs that declare a cron schedule.
+//
+// Every runtime replica runs a scheduler. When a tick comes due each of them
+// tries to claim it through Queue.ClaimTick, and only the claim that records
+// the tick enqueues the job, so a tick fires once however many replicas are
+// running (with the postgres backend; the memory backend only deduplicates
+// within one process). Ticks missed while no replica was running are not
+// backfilled.
+type Scheduler struct {
+	executor *Executor
+	logger   *slog.Logger
+
+	mu        sync.Mutex
+	schedules map[string]*scheduledJob
+	// changed wakes the loop when schedules are replaced
+	changed chan struct{}
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// now is the clock, replaced in tests
+	now func() time.Time
+}
+
+type scheduledJob struct {
+	schema *JobSchema
+	cron   *Cron
+	next   time.Time
+}
+
+// NewScheduler creates a scheduler that enqueues through executor.
+func NewScheduler(executor *Executor, logger *slog.Logger) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		executor:  executor,
+		logger:    logger,
+		schedules: make(map[string]*scheduledJob),
+		changed:   make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		now:       time.Now,
+	}
+}
+
+// SetSchedules replaces the scheduled jobs with the schemas that have a
+// Schedule. A job whose schedule is unchanged keeps its next tick. Schedules
+// that fail to parse are skipped and reported in the returned error.
+func (s *Scheduler) SetSchedules(schemas map[string]*JobSchema) error {
+	now := s.now()
+	var errs []error
+
+	s.mu.Lock()
+	schedules := make(map[string]*scheduledJob)
+	for name, schema := range schemas {
+		if schema.Schedule == "" {
+			continue
+		}
+		if prev, ok := s.schedules[name]; ok && prev.schema.Schedule == schema.Schedule {
+			schedules[name] = &scheduledJob{schema: schema, cron: prev.cron, next: prev.next}
+			continue
+		}
+
+		cron, err := ParseCron(schema.Schedule)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("job %s: %w", name, err))
+			continue
+		}
+		next := cron.Next(now)
+		if next.IsZero() {
+			errs = append(errs, fmt.Errorf("job %s: schedule %q never fires", name, schema.Schedule))
+			continue
+		}
+		schedules[name] = &scheduledJob{schema: schema, cron: cron, next: next}
+	}
+	s.schedules = schedules
+	s.mu.Unlock()
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+	return errors.Join(errs...)
+}
+
+// Start runs the scheduler loop in the background.
+func (s *Scheduler) Start() {
+	go s.run()
+	s.logger.Info("job scheduler started")
+}
+
+// Stop stops the scheduler and waits for an in-flight tick. Safe to call
+// multiple times.
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		<-s.done
+		s.logger.Info("job scheduler stopped")
+	})
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+
+	for {
+		timer := time.NewTimer(s.fireDue())
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-s.changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// fireDue enqueues every schedule whose tick has passed and returns how long
+// to sleep until the next one.
+func (s *Scheduler) fireDue() time.Duration {
+	now := s.now()
+
+	type dueTick struct {
+		name   string
+		schema *JobSchema
+		tick   time.Time
+	}
+	var due []dueTick
+	wait := maxSchedulerSleep
+
+	s.mu.Lock()
+	for name, sj := range s.schedules {
+		if !sj.next.After(now) {
+			due = append(due, dueTick{name, sj.schema, sj.next})
+			// Skip ticks missed while this replica was busy or asleep.
+			sj.next = sj.cron.Next(now)
+		}
+		if d := sj.next.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	s.mu.Unlock()
+
+	for _, d := range due {
+		s.fire(d.name, d.schema, d.tick)
+	}
+	return wait
+}
+
+// fire claims tick for the job and enqueues it if this replica won.
+func (s *Scheduler) fire(name string, schema *JobSchema, tick time.Time) {
+	job := newJob(name, schema, map[string]any{
+		"scheduled_at": tick.Format(time.RFC3339),
+	})
+
+	claimed, err := s.executor.ClaimTick(s.ctx, name, tick, job)
+	if err != nil {
+		if s.ctx.Err() == nil {
+			s.logger.Error("job.schedule_failed",
+				"job", name,
+				"tick", tick,
+				"error", err,
+			)
+		}
+		return
+	}
+	if !claimed {
+		s.logger.Debug("schedule tick already claimed", "job", name, "tick", tick)
+		return
+	}
+
+	s.logger.Info("job.scheduled",
+		"job", name,
+		"job_id", job.ID,
+		"tick", tick,
+	)
+}
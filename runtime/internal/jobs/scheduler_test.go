@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulerFiresEachTickOnce(t *testing.T) {
+	ex := NewExecutor(setupRegistry(), newTestLogger(), 1)
+	defer ex.Stop()
+
+	schemas := map[string]*JobSchema{
+		"nightly_digest": {Name: "nightly_digest", Capabilities: []string{"email.send"}, Schedule: "0 7 * * *"},
+		"on_demand":      {Name: "on_demand", Capabilities: []string{"email.send"}},
+	}
+
+	// Two replicas sharing one queue.
+	clock := time.Date(2025, 1, 1, 6, 59, 30, 0, time.UTC)
+	replicas := []*Scheduler{NewScheduler(ex, newTestLogger()), NewScheduler(ex, newTestLogger())}
+	for _, s := range replicas {
+		s.now = func() time.Time { return clock }
+		if err := s.SetSchedules(schemas); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if wait := replicas[0].fireDue(); wait != 30*time.Second {
+		t.Errorf("wait before the tick = %v, want 30s", wait)
+	}
+	if n := ex.QueueLength(); n != 0 {
+		t.Fatalf("queue length before the tick = %d, want 0", n)
+	}
+
+	clock = clock.Add(31 * time.Second)
+	for _, s := range replicas {
+		s.fireDue()
+	}
+	if n := ex.QueueLength(); n != 1 {
+		t.Fatalf("queue length after the tick = %d, want 1", n)
+	}
+
+	job, err := ex.queue.Lease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Name != "nightly_digest" || job.Capability != "email.send" || job.Data["scheduled_at"] != "2025-01-01T07:00:00Z" {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	// The next tick is a day later.
+	for _, s := range replicas {
+		if wait := s.fireDue(); wait != maxSchedulerSleep {
+			t.Errorf("wait after the tick = %v, want %v", wait, maxSchedulerSleep)
+		}
+	}
+}
+
+func TestSchedulerSkipsInvalidSchedules(t *testing.T) {
+	ex := NewExecutor(setupRegistry(), newTestLogger(), 1)
+	defer ex.Stop()
+
+	s := NewScheduler(ex, newTestLogger())
+	err := s.SetSchedules(map[string]*JobSchema{
+		"broken": {Name: "broken", Schedule: "not a cron"},
+		"ok":     {Name: "ok", Schedule: "@hourly"},
+	})
+	if err == nil {
+		t.Fatal("expected an error for the invalid schedule")
+	}
+	if len(s.schedules) != 1 || s.schedules["ok"] == nil {
+		t.Errorf("schedules = %v, want only ok", s.schedules)
+	}
+}
+
+func TestMemoryQueueHoldsDelayedJobs(t *testing.T) {
+	q := newMemoryQueue(10, newTestLogger(), make(chan struct{}))
+
+	if err := q.Push(context.Background(), nil, &Job{ID: "later", ScheduledAt: time.Now().Add(100 * time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if job, err := q.Lease(ctx); err == nil {
+		t.Fatalf("leased %s before its ScheduledAt", job.ID)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	job, err := q.Lease(ctx)
+	if err != nil || job.ID != "later" {
+		t.Fatalf("Lease = %v, %v; want the delayed job", job, err)
+	}
+}
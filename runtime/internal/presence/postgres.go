@@ -0,0 +1,126 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+)
+
+// PostgresStore keeps entries in the _forge_presence table, shared by every
+// replica on the database. The table is UNLOGGED: writes skip the WAL, and
+// the entries are lost if the database crashes, which only ends presence
+// early.
+type PostgresStore struct {
+	db db.Database
+}
+
+// NewPostgresStore creates the _forge_presence table if needed and returns a
+// store backed by it.
+func NewPostgresStore(ctx context.Context, database db.Database) (*PostgresStore, error) {
+	if _, err := database.Exec(ctx, `
+		CREATE UNLOGGED TABLE IF NOT EXISTS _forge_presence (
+			presence TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			source TEXT NOT NULL,
+			state JSONB NOT NULL DEFAULT '{}',
+			updated_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (presence, scope, source)
+		)
+	`); err != nil {
+		return nil, fmt.Errorf("creating _forge_presence table: %w", err)
+	}
+	if _, err := database.Exec(ctx, `
+		CREATE INDEX IF NOT EXISTS _forge_presence_expires_idx ON _forge_presence (expires_at)
+	`); err != nil {
+		return nil, fmt.Errorf("creating _forge_presence index: %w", err)
+	}
+	return &PostgresStore{db: database}, nil
+}
+
+// Update implements Store. The state of an entry that already expired, but
+// was not removed yet, is replaced rather than merged.
+func (p *PostgresStore) Update(ctx context.Context, e *Entry) (*Entry, error) {
+	state, err := json.Marshal(e.State)
+	if err != nil {
+		return nil, fmt.Errorf("encoding presence state: %w", err)
+	}
+
+	var merged string
+	if err := p.db.QueryRow(ctx, `
+		INSERT INTO _forge_presence (presence, scope, source, state, updated_at, expires_at)
+		VALUES ($1, $2, $3, $4::jsonb, $5, $6)
+		ON CONFLICT (presence, scope, source) DO UPDATE SET
+			state = CASE WHEN _forge_presence.expires_at > EXCLUDED.updated_at
+				THEN _forge_presence.state || EXCLUDED.state
+				ELSE EXCLUDED.state END,
+			updated_at = EXCLUDED.updated_at,
+			expires_at = EXCLUDED.expires_at
+		RETURNING state::text`,
+		e.Presence, e.Scope, e.Source, string(state), e.UpdatedAt, e.ExpiresAt,
+	).Scan(&merged); err != nil {
+		return nil, err
+	}
+
+	stored := *e
+	if err := json.Unmarshal([]byte(merged), &stored.State); err != nil {
+		return nil, fmt.Errorf("decoding presence state: %w", err)
+	}
+	return &stored, nil
+}
+
+// List implements Store.
+func (p *PostgresStore) List(ctx context.Context, presence, scope string, now time.Time) ([]*Entry, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT presence, scope, source, state::text, updated_at, expires_at
+		FROM _forge_presence
+		WHERE presence = $1 AND ($2 = '' OR scope = $2) AND expires_at > $3
+		ORDER BY scope, source`,
+		presence, scope, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+// Expire implements Store. Concurrent calls delete disjoint rows, so each
+// replica reports the entries it removed.
+func (p *PostgresStore) Expire(ctx context.Context, now time.Time) ([]*Entry, error) {
+	rows, err := p.db.Query(ctx, `
+		DELETE FROM _forge_presence
+		WHERE expires_at <= $1
+		RETURNING presence, scope, source, state::text, updated_at, expires_at`,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := scanEntries(rows)
+	if err != nil {
+		return nil, err
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func scanEntries(rows db.Rows) ([]*Entry, error) {
+	defer rows.Close()
+
+	var entries []*Entry
+	for rows.Next() {
+		var e Entry
+		var state string
+		if err := rows.Scan(&e.Presence, &e.Scope, &e.Source, &state, &e.UpdatedAt, &e.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(state), &e.State); err != nil {
+			return nil, fmt.Errorf("decoding presence state: %w", err)
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,129 @@
+// Package presence stores the ephemeral state of presence declarations: one
+// entry per source record and scope, which expires when it is not updated
+// within the presence's TTL. An expired entry is removed, and reads as the
+// presence's default state.
+package presence
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry is the state a source record holds in a scope.
+type Entry struct {
+	Presence  string         `json:"presence"`
+	Scope     string         `json:"scope"`  // id of the scope record
+	Source    string         `json:"source"` // id of the source record
+	State     map[string]any `json:"state"`  // fields set by updates
+	UpdatedAt time.Time      `json:"updated_at"`
+	ExpiresAt time.Time      `json:"expires_at"`
+}
+
+// Store holds presence entries.
+type Store interface {
+	// Update merges the state of e into the entry of its source in its
+	// scope, or creates the entry when there is no live one, and sets its
+	// UpdatedAt and ExpiresAt to those of e. It returns the stored entry.
+	Update(ctx context.Context, e *Entry) (*Entry, error)
+
+	// List returns the entries of presence that are live at now, ordered by
+	// scope and source. An empty scope lists every scope.
+	List(ctx context.Context, presence, scope string, now time.Time) ([]*Entry, error)
+
+	// Expire removes the entries that expired by now and returns them. With
+	// a shared store each entry is returned by one call only.
+	Expire(ctx context.Context, now time.Time) ([]*Entry, error)
+}
+
+type entryKey struct {
+	presence, scope, source string
+}
+
+// MemoryStore keeps entries in process. They are lost on restart and not
+// shared between replicas.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[entryKey]*Entry
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[entryKey]*Entry)}
+}
+
+// Update implements Store.
+func (m *MemoryStore) Update(_ context.Context, e *Entry) (*Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := entryKey{e.Presence, e.Scope, e.Source}
+	state := make(map[string]any, len(e.State))
+	if current, ok := m.entries[key]; ok && current.ExpiresAt.After(e.UpdatedAt) {
+		for k, v := range current.State {
+			state[k] = v
+		}
+	}
+	for k, v := range e.State {
+		state[k] = v
+	}
+
+	stored := *e
+	stored.State = state
+	m.entries[key] = &stored
+	return stored.clone(), nil
+}
+
+// List implements Store.
+func (m *MemoryStore) List(_ context.Context, presence, scope string, now time.Time) ([]*Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []*Entry
+	for key, e := range m.entries {
+		if key.presence == presence && (scope == "" || key.scope == scope) && e.ExpiresAt.After(now) {
+			entries = append(entries, e.clone())
+		}
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// Expire implements Store.
+func (m *MemoryStore) Expire(_ context.Context, now time.Time) ([]*Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expired []*Entry
+	for key, e := range m.entries {
+		if !e.ExpiresAt.After(now) {
+			expired = append(expired, e)
+			delete(m.entries, key)
+		}
+	}
+	sortEntries(expired)
+	return expired, nil
+}
+
+func (e *Entry) clone() *Entry {
+	c := *e
+	c.State = make(map[string]any, len(e.State))
+	for k, v := range e.State {
+		c.State[k] = v
+	}
+	return &c
+}
+
+func sortEntries(entries []*Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Presence != b.Presence {
+			return a.Presence < b.Presence
+		}
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+		return a.Source < b.Source
+	})
+}
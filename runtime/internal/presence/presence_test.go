@@ -0,0 +1,60 @@
+package presence
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStore()
+	now := time.Now()
+	update := func(scope, source string, at time.Time, state map[string]any) *Entry {
+		t.Helper()
+		e, err := m.Update(ctx, &Entry{Presence: "UserPresence", Scope: scope, Source: source, State: state, UpdatedAt: at, ExpiresAt: at.Add(time.Minute)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	update("w1", "u2", now, map[string]any{"status": "online"})
+	update("w1", "u1", now, map[string]any{"status": "online", "typing": true})
+	update("w2", "u1", now, map[string]any{"status": "away"})
+
+	// A live entry merges the update into its state.
+	if e := update("w1", "u1", now.Add(time.Second), map[string]any{"typing": false}); e.State["status"] != "online" || e.State["typing"] != false {
+		t.Errorf("merged state = %v", e.State)
+	}
+
+	entries, _ := m.List(ctx, "UserPresence", "w1", now)
+	if len(entries) != 2 || entries[0].Source != "u1" || entries[1].Source != "u2" {
+		t.Fatalf("List(w1) = %+v, want u1 and u2", entries)
+	}
+	entries[0].State["status"] = "changed"
+	if again, _ := m.List(ctx, "UserPresence", "w1", now); again[0].State["status"] != "online" {
+		t.Error("List returned the stored state rather than a copy")
+	}
+	if all, _ := m.List(ctx, "UserPresence", "", now); len(all) != 3 {
+		t.Errorf("List(all scopes) = %d entries, want 3", len(all))
+	}
+
+	// Entries past their expiry are not listed, and are removed once.
+	later := now.Add(time.Minute + time.Second/2)
+	if live, _ := m.List(ctx, "UserPresence", "", later); len(live) != 1 || live[0].Source != "u1" || live[0].Scope != "w1" {
+		t.Errorf("List after expiry = %+v, want the refreshed entry", live)
+	}
+	expired, _ := m.Expire(ctx, later)
+	if len(expired) != 2 || expired[0].Scope != "w1" || expired[0].Source != "u2" || expired[1].Scope != "w2" {
+		t.Errorf("Expire = %+v, want w1/u2 and w2/u1", expired)
+	}
+	if again, _ := m.Expire(ctx, later); len(again) != 0 {
+		t.Errorf("second Expire = %+v, want none", again)
+	}
+
+	// An expired entry is replaced rather than merged into.
+	if e := update("w1", "u1", now.Add(2*time.Minute), map[string]any{"status": "away"}); len(e.State) != 1 {
+		t.Errorf("state after expiry = %v, want only the new update", e.State)
+	}
+}
@@ -21,8 +21,9 @@ type EmailProvider struct {
 	useTLS   bool
 }
 
-// Ensure EmailProvider implements CapabilityProvider
+// Ensure EmailProvider implements CapabilityProvider and fans out
 var _ provider.CapabilityProvider = (*EmailProvider)(nil)
+var _ provider.FanOutProvider = (*EmailProvider)(nil)
 
 // init registers the email provider with the global registry
 func init() {
@@ -68,9 +69,15 @@ func (p *EmailProvider) Capabilities() []string {
 	}
 }
 
+// FansOut reports that email.send sends one email per resolved recipient.
+func (p *EmailProvider) FansOut(capability string) bool {
+	return capability == "email.send"
+}
+
 // Execute sends an email.
 // Data fields:
-// - to: recipient email address (required)
+// - to: recipient email address (required unless recipient has an email)
+// - recipient: record resolved from the job's needs clause (set on fan-out)
 // - subject: email subject (required)
 // - body: email body (required)
 // - from: sender address (optional, uses default if not provided)
@@ -81,6 +88,11 @@ func (p *EmailProvider) Execute(ctx context.Context, capability string, data map
 	}
 
 	to, ok := data["to"].(string)
+	if !ok || to == "" {
+		if recipient, isRecord := data["recipient"].(map[string]any); isRecord {
+			to, ok = recipient["email"].(string)
+		}
+	}
 	if !ok || to == "" {
 		return fmt.Errorf("email.send requires 'to' field")
 	}
@@ -131,11 +131,11 @@ func (p *HTTPProvider) Execute(ctx context.Context, capability string, data map[
 			body, _ = json.Marshal(b)
 		}
 	default:
-		return fmt.Errorf("unknown HTTP capability: %s", capability)
+		return provider.Permanent(fmt.Errorf("unknown HTTP capability: %s", capability))
 	}
 
 	if url == "" {
-		return fmt.Errorf("url is required for %s", capability)
+		return provider.Permanent(fmt.Errorf("url is required for %s", capability))
 	}
 
 	// Create request
@@ -164,10 +164,15 @@ func (p *HTTPProvider) Execute(ctx context.Context, capability string, data map[
 	}
 	defer resp.Body.Close()
 
-	// Check status code
+	// Check status code. A 4xx means the request itself is wrong and is not
+	// retried, except for timeouts and rate limiting.
 	if resp.StatusCode >= 400 {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+		err := fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return provider.Permanent(err)
+		}
+		return err
 	}
 
 	return nil
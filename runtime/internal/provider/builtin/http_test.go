@@ -11,6 +11,8 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/forge-lang/forge/runtime/internal/provider"
 )
 
 func TestHTTPProvider_Name(t *testing.T) {
@@ -322,3 +324,37 @@ func TestHTTPProvider_Execute_UnknownCapability(t *testing.T) {
 		t.Errorf("expected error about unknown capability, got %q", err.Error())
 	}
 }
+
+func TestHTTPProvider_Execute_Retryable(t *testing.T) {
+	tests := []struct {
+		status        int
+		wantPermanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusNotFound, true},
+		{http.StatusRequestTimeout, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusBadGateway, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			p := &HTTPProvider{}
+			p.Init(map[string]string{})
+
+			err := p.Execute(context.Background(), "http.get", map[string]any{"url": server.URL})
+			if err == nil {
+				t.Fatalf("expected error for %d response", tt.status)
+			}
+			if got := provider.IsPermanent(err); got != tt.wantPermanent {
+				t.Errorf("IsPermanent = %v, want %v (%v)", got, tt.wantPermanent, err)
+			}
+		})
+	}
+}
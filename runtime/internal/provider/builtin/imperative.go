@@ -0,0 +1,97 @@
+package builtin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/forge-lang/forge/runtime/internal/imperative"
+	"github.com/forge-lang/forge/runtime/internal/provider"
+)
+
+// ImperativeRunner is the interface needed by the imperative provider to call
+// registered imperative functions. The server injects it at startup, as it
+// does the entity provider's writer.
+type ImperativeRunner interface {
+	RunImperative(ctx context.Context, name string, input map[string]any) (any, error)
+}
+
+// ImperativeProvider lets jobs call imperative functions. A job whose effect
+// names an imperative executes imperative.call; the function's result is
+// discarded.
+type ImperativeProvider struct {
+	runner ImperativeRunner
+}
+
+// Ensure ImperativeProvider implements CapabilityProvider
+var _ provider.CapabilityProvider = (*ImperativeProvider)(nil)
+
+// init registers the imperative provider with the global registry.
+func init() {
+	provider.Register(&ImperativeProvider{})
+}
+
+// Name returns the provider identifier.
+func (p *ImperativeProvider) Name() string {
+	return "imperative"
+}
+
+// Init initializes the provider. The imperative provider does not require
+// external configuration - it receives its runner via SetRunner.
+func (p *ImperativeProvider) Init(config map[string]string) error {
+	return nil
+}
+
+// Capabilities returns the list of effects this provider handles.
+func (p *ImperativeProvider) Capabilities() []string {
+	return []string{
+		"imperative.call",
+	}
+}
+
+// SetRunner injects the runner into the imperative provider.
+// This must be called by the server before any imperative jobs are executed.
+func (p *ImperativeProvider) SetRunner(r ImperativeRunner) {
+	p.runner = r
+}
+
+// Execute calls an imperative function.
+// Data fields:
+//   - _imperative (string): the imperative name (required)
+//   - _input (map[string]any): the record that triggered the job
+//   - needs (optional): records resolved from the job's needs clause,
+//     passed to the function as input["needs"]
+//
+// A rejection by the function (an *imperative.Error) is permanent; other
+// errors are retried according to the job's retry policy.
+func (p *ImperativeProvider) Execute(ctx context.Context, capability string, data map[string]any) error {
+	if capability != "imperative.call" {
+		return fmt.Errorf("unknown capability: %s", capability)
+	}
+
+	if p.runner == nil {
+		return fmt.Errorf("imperative provider has no runner configured")
+	}
+
+	name, ok := data["_imperative"].(string)
+	if !ok || name == "" {
+		return provider.Permanent(fmt.Errorf("imperative.call requires '_imperative' field"))
+	}
+
+	input := make(map[string]any)
+	if record, ok := data["_input"].(map[string]any); ok {
+		for k, v := range record {
+			input[k] = v
+		}
+	}
+	if needs, ok := data["needs"]; ok {
+		input["needs"] = needs
+	}
+
+	_, err := p.runner.RunImperative(ctx, name, input)
+	var rejected *imperative.Error
+	if errors.As(err, &rejected) || errors.Is(err, imperative.ErrNotRegistered) {
+		return provider.Permanent(err)
+	}
+	return err
+}
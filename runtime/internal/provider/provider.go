@@ -13,6 +13,7 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"net/http"
 )
 
@@ -45,11 +46,23 @@ type CapabilityProvider interface {
 	// - Deadline from job timeout configuration
 	// - Cancellation for graceful shutdown
 	//
-	// Returns an error if the effect fails. Errors are logged and may trigger
-	// retry logic depending on job configuration.
+	// Returns an error if the effect fails. Errors are logged and retried
+	// according to the job's retry policy, unless wrapped with Permanent.
 	Execute(ctx context.Context, capability string, data map[string]any) error
 }
 
+// FanOutProvider is implemented by capability providers whose effects address
+// a single recipient, such as email.send. When a job's needs clause resolves
+// to several records, the runtime executes a fan-out capability once per
+// record, passing it as data["recipient"]; other capabilities receive the
+// whole list as data["needs"].
+type FanOutProvider interface {
+	CapabilityProvider
+
+	// FansOut reports whether capability executes once per recipient.
+	FansOut(capability string) bool
+}
+
 // WebhookProvider handles inbound events (external service → FORGE).
 // When a webhook arrives, the runtime finds the matching provider,
 // validates the request signature, and parses the event data.
@@ -120,3 +133,38 @@ type ExecutionResult struct {
 	// Metadata for debugging (rate limits, retries, etc.)
 	Metadata map[string]any
 }
+
+// PermanentError marks an effect failure that retrying cannot fix, such as an
+// HTTP 4xx response or missing required data. The runtime moves the job to
+// the dead-letter store instead of retrying it.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Permanent wraps err as non-retryable. It returns nil if err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err is non-retryable. An error joining several
+// failures (e.g. one per fan-out recipient) is permanent only if all of them
+// are, so transient failures are still retried.
+func IsPermanent(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		for _, e := range errs {
+			if !IsPermanent(e) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	}
+	var perm *PermanentError
+	return errors.As(err, &perm)
+}
@@ -77,7 +77,7 @@ func Build(schema *ViewSchema, r *http.Request) (*QueryResult, error) {
 	query := r.URL.Query()
 
 	// 1. Parse client parameters
-	limit, err := parseLimit(query.Get("limit"))
+	limit, err := ParseLimit(query.Get("limit"))
 	if err != nil {
 		return nil, err
 	}
@@ -469,8 +469,9 @@ func buildOrderBy(sorts []ViewSort) string {
 	return "ORDER BY " + strings.Join(parts, ", ")
 }
 
-// parseLimit parses and validates the limit query parameter.
-func parseLimit(s string) (int, error) {
+// ParseLimit parses and validates the limit query parameter, defaulting to
+// DefaultLimit when it is empty.
+func ParseLimit(s string) (int, error) {
 	if s == "" {
 		return DefaultLimit, nil
 	}
@@ -712,7 +712,7 @@ func TestParseLimit(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run("limit="+tt.input, func(t *testing.T) {
-			got, err := parseLimit(tt.input)
+			got, err := ParseLimit(tt.input)
 			if tt.wantErr {
 				if err == nil {
 					t.Fatalf("expected error, got nil (value=%d)", got)
@@ -724,7 +724,7 @@ func TestParseLimit(t *testing.T) {
 				t.Fatalf("unexpected error: %v", err)
 			}
 			if got != tt.want {
-				t.Errorf("parseLimit(%q) = %d, want %d", tt.input, got, tt.want)
+				t.Errorf("ParseLimit(%q) = %d, want %d", tt.input, got, tt.want)
 			}
 		})
 	}
@@ -0,0 +1,244 @@
+// Package server provides application-side access control.
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/forge-lang/forge/runtime/internal/expr"
+	"github.com/forge-lang/forge/runtime/internal/query"
+)
+
+// Access rules are enforced by RLS only on connections scoped with
+// app.user_id. The runtime also evaluates them itself, so the owner-role
+// pool, unauthenticated requests, jobs, webhooks and WebSocket pushes are
+// held to the same rules.
+
+// principal is who an operation acts for: the authenticated user, or the
+// system for trusted contexts such as jobs and verified webhooks. The system
+// principal bypasses access rules, and every bypass is logged with its
+// reason.
+type principal struct {
+	UserID string
+	System bool
+	Reason string
+}
+
+type principalContextKey struct{}
+
+// withSystemPrincipal marks ctx as acting for the system. reason names the
+// trusted context, e.g. "webhook:stripe", and is recorded in the audit log.
+func withSystemPrincipal(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal{System: true, Reason: reason})
+}
+
+// principalFrom returns the principal ctx acts for: the system when marked
+// by withSystemPrincipal, otherwise the authenticated user, if any.
+func principalFrom(ctx context.Context) principal {
+	if p, ok := ctx.Value(principalContextKey{}).(principal); ok {
+		return p
+	}
+	userID, _ := ctx.Value(userContextKey{}).(string)
+	return principal{UserID: userID}
+}
+
+// accessRule returns the parsed read or write rule of entity for the
+// principal in ctx. It returns nil when access is unrestricted: the entity
+// declares no rule for kind, or ctx acts for the system.
+func (s *Server) accessRule(ctx context.Context, entity *EntitySchema, kind string) (expr.Node, error) {
+	acc, ok := s.getArtifact().Access[entity.Name]
+	if !ok {
+		return nil, nil
+	}
+	condition := acc.ReadCEL
+	if kind == "write" {
+		condition = acc.WriteCEL
+	}
+	if condition == "" {
+		return nil, nil
+	}
+
+	if p := principalFrom(ctx); p.System {
+		s.logger.Info("access.system", "entity", entity.Name, "access", kind, "reason", p.Reason)
+		return nil, nil
+	}
+
+	node, err := expr.Parse(condition)
+	if err != nil {
+		return nil, fmt.Errorf("%s access for %s: %w", kind, entity.Name, err)
+	}
+	return node, nil
+}
+
+// canAccess reports whether the principal in ctx may read or write record.
+// Paths resolve as they do in rules: bare fields against record, `user`
+// against the authenticated user and relations through their rows.
+func (s *Server) canAccess(ctx context.Context, q querier, entity *EntitySchema, kind string, record map[string]any) (bool, error) {
+	rule, err := s.accessRule(ctx, entity, kind)
+	if err != nil || rule == nil {
+		return err == nil, err
+	}
+	return s.evalAccess(ctx, q, entity, rule, record)
+}
+
+func (s *Server) evalAccess(ctx context.Context, q querier, entity *EntitySchema, rule expr.Node, record map[string]any) (bool, error) {
+	allowed, err := expr.EvalBool(ctx, rule, s.newRecordResolver(ctx, q, entity, record, nil))
+	if err != nil {
+		return false, fmt.Errorf("access for %s: %w", entity.Name, err)
+	}
+	return allowed, nil
+}
+
+// filterReadable returns the records the principal in ctx may read, in order.
+func (s *Server) filterReadable(ctx context.Context, q querier, entity *EntitySchema, records []map[string]any) ([]map[string]any, error) {
+	rule, err := s.accessRule(ctx, entity, "read")
+	if err != nil || rule == nil {
+		return records, err
+	}
+
+	readable := records[:0:0]
+	for _, record := range records {
+		allowed, err := s.evalAccess(ctx, q, entity, rule, record)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			readable = append(readable, record)
+		}
+	}
+	return readable, nil
+}
+
+// checkWriteAccess returns an *actionError unless the principal in ctx may
+// write every record given: the stored row and the row as it will be
+// written, for updates. Nil records are skipped. Like rules, access fails
+// closed when a rule cannot be evaluated.
+func (s *Server) checkWriteAccess(ctx context.Context, q querier, entity *EntitySchema, records ...map[string]any) error {
+	rule, err := s.accessRule(ctx, entity, "write")
+	if err != nil {
+		return accessEvaluationError(err)
+	}
+	if rule == nil {
+		return nil
+	}
+
+	for _, record := range records {
+		if record == nil {
+			continue
+		}
+		allowed, err := s.evalAccess(ctx, q, entity, rule, record)
+		if err != nil {
+			return accessEvaluationError(err)
+		}
+		if !allowed {
+			s.logger.Info("access.denied", "entity", entity.Name, "access", "write", "user", principalFrom(ctx).UserID)
+			return &actionError{
+				Status:  http.StatusForbidden,
+				Message: Message{Code: "ACCESS_DENIED", Message: fmt.Sprintf("Not allowed to write %s", entity.Name)},
+			}
+		}
+	}
+	return nil
+}
+
+func accessEvaluationError(err error) error {
+	return &actionError{
+		Status:  http.StatusInternalServerError,
+		Message: Message{Code: "ACCESS_EVALUATION_FAILED", Message: "Failed to evaluate access rules"},
+		Err:     err,
+	}
+}
+
+// hasAccessRule reports whether entity declares a read or write rule.
+func (s *Server) hasAccessRule(entity *EntitySchema, kind string) bool {
+	acc, ok := s.getArtifact().Access[entity.Name]
+	if !ok {
+		return false
+	}
+	if kind == "write" {
+		return acc.WriteCEL != ""
+	}
+	return acc.ReadCEL != ""
+}
+
+// viewSourceID is the alias under which view queries select the id of the
+// source row when its read rule must be checked. It is not returned.
+const viewSourceID = "__source_id"
+
+// viewQuerySchema converts view to a query schema. When the source entity
+// has a read rule, rows also select the source id and the entity is
+// returned so the rows can be passed to filterReadableViewRows.
+func (s *Server) viewQuerySchema(view *ViewSchema) (*query.ViewSchema, *EntitySchema) {
+	qs := viewToQuerySchema(view)
+	source := s.getArtifact().Entities[view.Source]
+	if source == nil || !s.hasAccessRule(source, "read") {
+		return qs, nil
+	}
+	qs.Fields = append(qs.Fields, query.ViewField{Name: viewSourceID, Column: "t.id", Alias: viewSourceID})
+	return qs, source
+}
+
+// filterReadableViewRows returns the view rows whose source row the
+// principal in ctx may read. The rules are evaluated against the full source
+// rows, which are loaded in one query, not against the projected view fields.
+func (s *Server) filterReadableViewRows(ctx context.Context, q querier, source *EntitySchema, results []map[string]any) ([]map[string]any, error) {
+	ids := make([]string, 0, len(results))
+	for _, row := range results {
+		ids = append(ids, fmt.Sprintf("%v", row[viewSourceID]))
+	}
+
+	var sources []map[string]any
+	if len(ids) > 0 {
+		var err error
+		sources, err = queryRecords(ctx, q, fmt.Sprintf("SELECT * FROM %s WHERE id = ANY($1)", source.Table), ids)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s rows: %w", source.Name, err)
+		}
+	}
+
+	readable, err := s.filterReadable(ctx, q, source, sources)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make(map[string]bool, len(readable))
+	for _, row := range readable {
+		allowed[fmt.Sprintf("%v", row["id"])] = true
+	}
+
+	filtered := results[:0]
+	for _, row := range results {
+		id := fmt.Sprintf("%v", row[viewSourceID])
+		delete(row, viewSourceID)
+		if allowed[id] {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered, nil
+}
+
+// mergedRecord returns current with the proposed input applied: the row an
+// update will write. It returns nil when there is nothing to apply.
+func mergedRecord(entity *EntitySchema, current, input map[string]any) map[string]any {
+	if current == nil || len(input) == 0 {
+		return nil
+	}
+	merged := make(map[string]any, len(current)+len(input))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range proposedRecord(entity, input) {
+		merged[k] = v
+	}
+	return merged
+}
+
+// entityByTable returns the entity stored in table, or nil.
+func (s *Server) entityByTable(table string) *EntitySchema {
+	for _, entity := range s.getArtifact().Entities {
+		if entity.Table == table {
+			return entity
+		}
+	}
+	return nil
+}
@@ -0,0 +1,407 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+)
+
+const accessTestOtherTicketID = "44444444-4444-4444-4444-444444444444"
+
+// accessArtifact has tickets readable and writable only by their author.
+func accessArtifact() *Artifact {
+	artifact := helpdeskRulesArtifact()
+	artifact.Rules = nil
+	artifact.Entities["Ticket"].Relations = map[string]*RelSchema{
+		"author": {Name: "author", Target: "User", TargetTable: "users", ForeignKey: "author_id"},
+	}
+	artifact.Actions["open_ticket"] = &ActionSchema{Name: "open_ticket", InputEntity: "Ticket", Operation: "create", TargetEntity: "Ticket"}
+	artifact.Access = map[string]*AccessSchema{
+		"Ticket": {Entity: "Ticket", Table: "tickets", ReadCEL: "(user == author)", WriteCEL: "(user == author)"},
+	}
+	artifact.Views = map[string]*ViewSchema{
+		"TicketList": {
+			Name:        "TicketList",
+			Source:      "Ticket",
+			SourceTable: "tickets",
+			Fields: []ViewField{
+				{Name: "subject", Column: "t.subject", Alias: "subject", Type: "text", Sortable: true},
+			},
+			DefaultSort: []ViewSort{{Column: "t.subject", Direction: "ASC"}},
+		},
+	}
+	return artifact
+}
+
+// accessDB answers the reads the access checks make from fixed tables and
+// records every other statement.
+type accessDB struct {
+	tables map[string][]map[string]any
+	writes []string
+}
+
+func (d *accessDB) query(ctx context.Context, query string, args ...any) (db.Rows, error) {
+	switch {
+	case strings.HasPrefix(query, "SELECT * FROM "):
+		table := d.tables[strings.Fields(query)[3]]
+		if !strings.Contains(query, "WHERE") {
+			return tableRows(table), nil
+		}
+		ids := map[string]bool{}
+		switch id := args[0].(type) {
+		case []string:
+			for _, v := range id {
+				ids[v] = true
+			}
+		default:
+			ids[id.(string)] = true
+		}
+		var matched []map[string]any
+		for _, row := range table {
+			if ids[row["id"].(string)] {
+				matched = append(matched, row)
+			}
+		}
+		return tableRows(matched), nil
+
+	case strings.Contains(query, " FROM tickets t"):
+		var rows []map[string]any
+		for _, row := range d.tables["tickets"] {
+			rows = append(rows, map[string]any{"id": row["id"], "subject": row["subject"], viewSourceID: row["id"]})
+		}
+		return tableRows(rows), nil
+	}
+
+	d.writes = append(d.writes, query)
+	return &mockRows{cols: []string{"id"}, values: [][]any{{ruleTestTicketID}}}, nil
+}
+
+func tableRows(rows []map[string]any) *mockRows {
+	if len(rows) == 0 {
+		return &mockRows{}
+	}
+	var cols []string
+	for k := range rows[0] {
+		cols = append(cols, k)
+	}
+	sort.Strings(cols)
+	result := &mockRows{cols: cols}
+	for _, row := range rows {
+		values := make([]any, len(cols))
+		for i, col := range cols {
+			values[i] = row[col]
+		}
+		result.values = append(result.values, values)
+	}
+	return result
+}
+
+func accessTables() map[string][]map[string]any {
+	return map[string][]map[string]any{
+		"tickets": {
+			{"id": ruleTestTicketID, "subject": "mine", "author_id": ruleTestUserID},
+			{"id": accessTestOtherTicketID, "subject": "theirs", "author_id": ruleTestOtherID},
+		},
+	}
+}
+
+func accessRequest(t *testing.T, s *Server, method, path, userID string) (*httptest.ResponseRecorder, APIResponse) {
+	t.Helper()
+
+	r := chi.NewRouter()
+	r.Get("/api/entities/{entity}", s.handleList)
+	r.Get("/api/entities/{entity}/{id}", s.handleGet)
+	r.Get("/api/views/{view}", s.handleView)
+
+	req := httptest.NewRequest(method, path, nil)
+	if userID != "" {
+		req = req.WithContext(context.WithValue(req.Context(), userContextKey{}, userID))
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return w, resp
+}
+
+// subjects returns the subject of every record in data, in order.
+func subjects(t *testing.T, data any) []string {
+	t.Helper()
+	raw, _ := json.Marshal(data)
+	var records []map[string]any
+	if err := json.Unmarshal(raw, &records); err != nil {
+		t.Fatalf("unexpected data %s", raw)
+	}
+	var out []string
+	for _, record := range records {
+		if _, leaked := record[viewSourceID]; leaked {
+			t.Errorf("record exposes %s: %v", viewSourceID, record)
+		}
+		out = append(out, record["subject"].(string))
+	}
+	return out
+}
+
+func TestEntityReadAccess(t *testing.T) {
+	tests := []struct {
+		name   string
+		userID string
+		want   []string
+	}{
+		{"author sees own tickets", ruleTestUserID, []string{"mine"}},
+		{"other user sees theirs", ruleTestOtherID, []string{"theirs"}},
+		{"anonymous sees nothing", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &accessDB{tables: accessTables()}
+			s := createTestServerWithMockDB(t, accessArtifact(), &mockDB{queryFunc: fake.query})
+
+			w, resp := accessRequest(t, s, "GET", "/api/entities/Ticket", tt.userID)
+			if w.Code != http.StatusOK {
+				t.Fatalf("list status = %d (body: %s)", w.Code, w.Body.String())
+			}
+			if got := subjects(t, resp.Data); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("list = %v, want %v", got, tt.want)
+			}
+
+			w, resp = accessRequest(t, s, "GET", "/api/views/TicketList", tt.userID)
+			if w.Code != http.StatusOK {
+				t.Fatalf("view status = %d (body: %s)", w.Code, w.Body.String())
+			}
+			items := resp.Data.(map[string]any)["items"]
+			if got := subjects(t, items); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("view = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Rows the caller cannot read are left out before paging, so a page is full
+// whenever readable rows follow it, and no count reveals the others.
+func TestViewReadAccess_Paging(t *testing.T) {
+	tickets := []map[string]any{
+		{"id": "00000000-0000-0000-0000-00000000000a", "subject": "a", "author_id": ruleTestOtherID},
+		{"id": "00000000-0000-0000-0000-00000000000b", "subject": "b", "author_id": ruleTestOtherID},
+		{"id": "00000000-0000-0000-0000-00000000000c", "subject": "c", "author_id": ruleTestUserID},
+		{"id": "00000000-0000-0000-0000-00000000000d", "subject": "d", "author_id": ruleTestUserID},
+		{"id": "00000000-0000-0000-0000-00000000000e", "subject": "e", "author_id": ruleTestOtherID},
+	}
+	fake := &accessDB{tables: map[string][]map[string]any{"tickets": tickets}}
+	limitPattern := regexp.MustCompile(`LIMIT (\d+)`)
+	query := func(ctx context.Context, query string, args ...any) (db.Rows, error) {
+		if !strings.Contains(query, " FROM tickets t") {
+			return fake.query(ctx, query, args...)
+		}
+		// The view query: subject order, after the cursor, limit+1 rows
+		limit, _ := strconv.Atoi(limitPattern.FindStringSubmatch(query)[1])
+		var rows []map[string]any
+		for _, row := range tickets {
+			if len(args) > 0 && row["subject"].(string) <= args[0].(string) {
+				continue
+			}
+			if len(rows) < limit {
+				rows = append(rows, map[string]any{"id": row["id"], "subject": row["subject"], viewSourceID: row["id"]})
+			}
+		}
+		return tableRows(rows), nil
+	}
+	s := createTestServerWithMockDB(t, accessArtifact(), &mockDB{queryFunc: query})
+
+	w, resp := accessRequest(t, s, "GET", "/api/views/TicketList?limit=1&include=count", ruleTestUserID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("view status = %d (body: %s)", w.Code, w.Body.String())
+	}
+	data := resp.Data.(map[string]any)
+	if got := subjects(t, data["items"]); strings.Join(got, ",") != "c" {
+		t.Errorf("first page = %v, want [c]", got)
+	}
+	pagination := data["pagination"].(map[string]any)
+	if pagination["has_next"] != true || pagination["next_cursor"] == nil {
+		t.Fatalf("first page pagination = %v, want a next page", pagination)
+	}
+	if total, ok := pagination["total"]; ok && total != nil {
+		t.Errorf("total = %v, must not count rows the caller cannot read", total)
+	}
+
+	w, resp = accessRequest(t, s, "GET", "/api/views/TicketList?limit=1&cursor="+pagination["next_cursor"].(string), ruleTestUserID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("view status = %d (body: %s)", w.Code, w.Body.String())
+	}
+	data = resp.Data.(map[string]any)
+	if got := subjects(t, data["items"]); strings.Join(got, ",") != "d" {
+		t.Errorf("second page = %v, want [d]", got)
+	}
+	if pagination := data["pagination"].(map[string]any); pagination["has_next"] != false {
+		t.Errorf("second page pagination = %v, want no next page: e is not readable", pagination)
+	}
+}
+
+func TestEntityGetAccess(t *testing.T) {
+	fake := &accessDB{tables: accessTables()}
+	s := createTestServerWithMockDB(t, accessArtifact(), &mockDB{queryFunc: fake.query})
+
+	if w, _ := accessRequest(t, s, "GET", "/api/entities/Ticket/"+ruleTestTicketID, ruleTestUserID); w.Code != http.StatusOK {
+		t.Errorf("own ticket: status = %d, want 200", w.Code)
+	}
+	w, resp := accessRequest(t, s, "GET", "/api/entities/Ticket/"+accessTestOtherTicketID, ruleTestUserID)
+	if w.Code != http.StatusNotFound || len(resp.Messages) != 1 || resp.Messages[0].Code != "NOT_FOUND" {
+		t.Errorf("other's ticket: status = %d, messages = %+v, want 404 NOT_FOUND", w.Code, resp.Messages)
+	}
+}
+
+func TestActionWriteAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		userID     string
+		input      map[string]any
+		wantStatus int
+	}{
+		{
+			name:       "author updates own ticket",
+			action:     "close_ticket",
+			userID:     ruleTestUserID,
+			input:      map[string]any{"id": ruleTestTicketID, "status": "closed"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "other user cannot update",
+			action:     "close_ticket",
+			userID:     ruleTestOtherID,
+			input:      map[string]any{"id": ruleTestTicketID, "status": "closed"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "author cannot hand the ticket to someone else",
+			action:     "close_ticket",
+			userID:     ruleTestUserID,
+			input:      map[string]any{"id": ruleTestTicketID, "author_id": ruleTestOtherID},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "other user cannot delete",
+			action:     "delete_ticket",
+			userID:     ruleTestOtherID,
+			input:      map[string]any{"id": ruleTestTicketID},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "create as author",
+			action:     "open_ticket",
+			userID:     ruleTestUserID,
+			input:      map[string]any{"subject": "new", "author": ruleTestUserID},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "create on behalf of another user",
+			action:     "open_ticket",
+			userID:     ruleTestUserID,
+			input:      map[string]any{"subject": "new", "author": ruleTestOtherID},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "anonymous create",
+			action:     "open_ticket",
+			input:      map[string]any{"subject": "new", "author": ruleTestUserID},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &accessDB{tables: accessTables()}
+			s := createTestServerWithMockDB(t, accessArtifact(), &mockDB{queryFunc: fake.query})
+
+			w, resp := postRuleAction(t, s, tt.action, tt.userID, tt.input)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusForbidden {
+				if len(fake.writes) != 1 {
+					t.Errorf("expected one write, got %v", fake.writes)
+				}
+				return
+			}
+			if len(fake.writes) != 0 {
+				t.Errorf("denied action must not write, got %v", fake.writes)
+			}
+			if len(resp.Messages) != 1 || resp.Messages[0].Code != "ACCESS_DENIED" {
+				t.Errorf("messages = %+v, want ACCESS_DENIED", resp.Messages)
+			}
+		})
+	}
+}
+
+func TestSystemPrincipal(t *testing.T) {
+	var logs bytes.Buffer
+	fake := &accessDB{tables: accessTables()}
+	s := createTestServerWithMockDB(t, accessArtifact(), &mockDB{queryFunc: fake.query})
+	s.logger = slog.New(slog.NewTextHandler(&logs, nil))
+	entity := s.getArtifact().Entities["Ticket"]
+	record := map[string]any{"id": ruleTestTicketID, "author_id": ruleTestOtherID}
+
+	ctx := context.WithValue(context.Background(), userContextKey{}, ruleTestUserID)
+	if ok, err := s.canAccess(ctx, s.db, entity, "write", record); err != nil || ok {
+		t.Fatalf("user access = %v, %v; want denied", ok, err)
+	}
+
+	ctx = withSystemPrincipal(ctx, "job:test")
+	if ok, err := s.canAccess(ctx, s.db, entity, "write", record); err != nil || !ok {
+		t.Fatalf("system access = %v, %v; want allowed", ok, err)
+	}
+	if !strings.Contains(logs.String(), "access.system") || !strings.Contains(logs.String(), "reason=job:test") {
+		t.Errorf("system access not audited: %s", logs.String())
+	}
+
+	if err := s.InsertEntity(context.Background(), "tickets", record); err != nil {
+		t.Errorf("InsertEntity: %v", err)
+	}
+	if strings.Count(logs.String(), "access.system") != 2 {
+		t.Errorf("job insert not audited: %s", logs.String())
+	}
+}
+
+func TestBroadcastReadAccess(t *testing.T) {
+	fake := &accessDB{tables: accessTables()}
+	s := createTestServerWithMockDB(t, accessArtifact(), &mockDB{queryFunc: fake.query})
+	s.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	author := &Client{send: make(chan []byte, 4), subscriptions: make(map[string]bool), userID: ruleTestUserID}
+	other := &Client{send: make(chan []byte, 4), subscriptions: make(map[string]bool), userID: ruleTestOtherID}
+	anonymous := &Client{send: make(chan []byte, 4), subscriptions: make(map[string]bool)}
+	for _, c := range []*Client{author, other, anonymous} {
+		s.hub.Subscribe(c, "Ticket:update")
+		s.hub.Subscribe(c, "Ticket:delete")
+	}
+
+	s.broadcastEntityChange("Ticket", "update", map[string]any{"id": ruleTestTicketID, "author_id": ruleTestUserID})
+	s.changePushes.wait()
+	if len(author.send) != 1 || len(other.send) != 0 || len(anonymous.send) != 0 {
+		t.Errorf("update pushes = author %d, other %d, anonymous %d; want 1, 0, 0",
+			len(author.send), len(other.send), len(anonymous.send))
+	}
+
+	s.broadcastEntityChange("Ticket", "delete", map[string]any{"id": ruleTestTicketID})
+	s.changePushes.wait()
+	if len(author.send) != 2 || len(other.send) != 1 || len(anonymous.send) != 1 {
+		t.Errorf("deletes must reach every subscriber")
+	}
+}
@@ -4,17 +4,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
 	"github.com/forge-lang/forge/runtime/internal/config"
 	"github.com/forge-lang/forge/runtime/internal/db"
+	"github.com/forge-lang/forge/runtime/internal/jobs"
+	"github.com/forge-lang/forge/runtime/internal/provider"
 )
 
 // mockRows implements db.Rows for testing
@@ -71,25 +76,51 @@ type mockResult struct {
 
 func (m *mockResult) RowsAffected() int64 { return m.rowsAffected }
 
-// mockTx implements db.Tx for testing
-type mockTx struct{}
+// mockTx implements db.Tx for testing. Statements are delegated to the
+// owning mockDB so query/exec hooks see transactional work too.
+type mockTx struct {
+	db         *mockDB
+	committed  bool
+	rolledBack bool
+}
 
 func (m *mockTx) Query(ctx context.Context, query string, args ...any) (db.Rows, error) {
+	if m.db != nil {
+		return m.db.Query(ctx, query, args...)
+	}
 	return &mockRows{}, nil
 }
 func (m *mockTx) QueryRow(ctx context.Context, query string, args ...any) db.Row {
 	return &mockRow{}
 }
 func (m *mockTx) Exec(ctx context.Context, query string, args ...any) (db.Result, error) {
+	if m.db != nil {
+		return m.db.Exec(ctx, query, args...)
+	}
 	return &mockResult{}, nil
 }
-func (m *mockTx) Commit(ctx context.Context) error   { return nil }
-func (m *mockTx) Rollback(ctx context.Context) error { return nil }
+func (m *mockTx) Commit(ctx context.Context) error {
+	if m.db != nil && m.db.commitErr != nil {
+		return m.db.commitErr
+	}
+	if !m.rolledBack {
+		m.committed = true
+	}
+	return nil
+}
+func (m *mockTx) Rollback(ctx context.Context) error {
+	if !m.committed {
+		m.rolledBack = true
+	}
+	return nil
+}
 
 // mockDB implements db.Database for testing
 type mockDB struct {
 	queryFunc func(ctx context.Context, query string, args ...any) (db.Rows, error)
 	execFunc  func(ctx context.Context, query string, args ...any) (db.Result, error)
+	commitErr error
+	txs       []*mockTx
 }
 
 func (m *mockDB) Connect(ctx context.Context) error { return nil }
@@ -100,7 +131,9 @@ func (m *mockDB) ApplyMigration(ctx context.Context, migration *db.Migration) er
 func (m *mockDB) WithUser(userID uuid.UUID) db.Database { return m }
 func (m *mockDB) IsEmbedded() bool                      { return false }
 func (m *mockDB) Begin(ctx context.Context) (db.Tx, error) {
-	return &mockTx{}, nil
+	tx := &mockTx{db: m}
+	m.txs = append(m.txs, tx)
+	return tx, nil
 }
 func (m *mockDB) QueryRow(ctx context.Context, query string, args ...any) db.Row {
 	return &mockRow{}
@@ -164,6 +197,8 @@ func (s *Server) setupActionTestRoutes() {
 	r.Route("/api", func(r chi.Router) {
 		r.Post("/actions/{action}", s.handleAction)
 	})
+
+	r.Post("/webhooks/{webhook}", s.handleWebhook)
 }
 
 // TestActionOperationTypeDispatch tests that actions are dispatched based on operation type
@@ -519,3 +554,375 @@ func TestCreateActionAutoPopulatesOwnerField(t *testing.T) {
 		t.Log("Note: owner_id auto-population depends on authentication middleware context")
 	}
 }
+
+// TestActionTransaction verifies that each action runs in a single transaction
+// and only broadcasts once that transaction has committed.
+func TestActionTransaction(t *testing.T) {
+	const projectID = "44444444-4444-4444-4444-444444444444"
+
+	tests := []struct {
+		name           string
+		rules          []*RuleSchema
+		queryErr       error
+		commitErr      error
+		expectedStatus int
+		wantCommit     bool
+		wantBroadcast  bool
+	}{
+		{
+			name:           "successful create commits and broadcasts",
+			expectedStatus: http.StatusCreated,
+			wantCommit:     true,
+			wantBroadcast:  true,
+		},
+		{
+			name: "rule rejection rolls back",
+			rules: []*RuleSchema{
+				{ID: "rule_1", Entity: "Project", Operation: "create", Condition: "(name == blocked)", EmitCode: "BLOCKED", IsForbid: true},
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "insert failure rolls back",
+			queryErr:       errors.New("constraint violation"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "commit failure does not broadcast",
+			commitErr:      errors.New("serialization failure"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			artifact := &Artifact{
+				Entities: map[string]*EntitySchema{
+					"Project": {
+						Name:  "Project",
+						Table: "projects",
+						Fields: map[string]*FieldSchema{
+							"id":   {Name: "id", Type: "uuid"},
+							"name": {Name: "name", Type: "string"},
+						},
+					},
+				},
+				Actions: map[string]*ActionSchema{
+					"create_project": {Name: "create_project", InputEntity: "Project", Operation: "create"},
+				},
+				Rules: tt.rules,
+			}
+
+			mockDatabase := &mockDB{
+				commitErr: tt.commitErr,
+				queryFunc: func(ctx context.Context, query string, args ...any) (db.Rows, error) {
+					if tt.queryErr != nil {
+						return nil, tt.queryErr
+					}
+					return &mockRows{
+						cols:   []string{"id", "name"},
+						values: [][]any{{projectID, "blocked"}},
+					}, nil
+				},
+			}
+			s := createTestServerWithMockDB(t, artifact, mockDatabase)
+
+			subscriber := &Client{send: make(chan []byte, 4), subscriptions: make(map[string]bool)}
+			s.hub.Subscribe(subscriber, "Project:create")
+
+			body, _ := json.Marshal(map[string]any{"name": "blocked"})
+			req := httptest.NewRequest("POST", "/api/actions/create_project", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", w.Code, tt.expectedStatus, w.Body.String())
+			}
+			if len(mockDatabase.txs) != 1 {
+				t.Fatalf("expected exactly one transaction, got %d", len(mockDatabase.txs))
+			}
+			tx := mockDatabase.txs[0]
+			if tx.committed != tt.wantCommit {
+				t.Errorf("committed = %v, want %v", tx.committed, tt.wantCommit)
+			}
+			if !tt.wantCommit && !tx.rolledBack {
+				t.Error("expected transaction to be rolled back")
+			}
+			s.changePushes.wait()
+			if got := len(subscriber.send) > 0; got != tt.wantBroadcast {
+				t.Errorf("broadcast = %v, want %v", got, tt.wantBroadcast)
+			}
+		})
+	}
+}
+
+// TestUpdateActionWithoutChanges tests that an update writing no columns
+// responds with the stored row, or 404 when there is none.
+func TestUpdateActionWithoutChanges(t *testing.T) {
+	const projectID = "44444444-4444-4444-4444-444444444444"
+
+	for name, stored := range map[string]bool{"stored row": true, "missing row": false} {
+		t.Run(name, func(t *testing.T) {
+			artifact := &Artifact{
+				Entities: map[string]*EntitySchema{
+					"Project": {
+						Name:  "Project",
+						Table: "projects",
+						Fields: map[string]*FieldSchema{
+							"id":   {Name: "id", Type: "uuid"},
+							"name": {Name: "name", Type: "string"},
+						},
+					},
+				},
+				Actions: map[string]*ActionSchema{
+					"touch_project": {Name: "touch_project", InputEntity: "Project", Operation: "update"},
+				},
+			}
+
+			mockDatabase := &mockDB{
+				queryFunc: func(ctx context.Context, query string, args ...any) (db.Rows, error) {
+					if strings.HasPrefix(query, "UPDATE") {
+						t.Errorf("nothing to write, got %s", query)
+					}
+					if !stored {
+						return &mockRows{}, nil
+					}
+					return &mockRows{
+						cols:   []string{"id", "name"},
+						values: [][]any{{projectID, "Apollo"}},
+					}, nil
+				},
+			}
+			s := createTestServerWithMockDB(t, artifact, mockDatabase)
+
+			subscriber := &Client{send: make(chan []byte, 4), subscriptions: make(map[string]bool)}
+			s.hub.Subscribe(subscriber, "Project:update")
+
+			body, _ := json.Marshal(map[string]any{"id": projectID})
+			req := httptest.NewRequest("POST", "/api/actions/touch_project", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+
+			if !stored {
+				if w.Code != http.StatusNotFound {
+					t.Fatalf("status = %d, want 404 (body: %s)", w.Code, w.Body.String())
+				}
+				if len(subscriber.send) != 0 {
+					t.Error("a missing record must not be broadcast")
+				}
+				return
+			}
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body: %s)", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Data map[string]any `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Data["name"] != "Apollo" {
+				t.Errorf("data = %v, want the stored row", resp.Data)
+			}
+		})
+	}
+}
+
+// recordingQueue is a durable jobs.Queue that records where jobs were pushed.
+// The dead-letter methods are not exercised.
+type recordingQueue struct {
+	jobs.DeadLetterStore
+
+	pushErr error
+	pushed  []*jobs.Job
+	via     []jobs.Execer
+}
+
+func (q *recordingQueue) Push(_ context.Context, ex jobs.Execer, job *jobs.Job) error {
+	if q.pushErr != nil {
+		return q.pushErr
+	}
+	q.pushed = append(q.pushed, job)
+	q.via = append(q.via, ex)
+	return nil
+}
+func (q *recordingQueue) ClaimTick(ctx context.Context, _ string, _ time.Time, job *jobs.Job) (bool, error) {
+	return true, q.Push(ctx, nil, job)
+}
+func (q *recordingQueue) Lease(ctx context.Context) (*jobs.Job, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+func (q *recordingQueue) Complete(context.Context, *jobs.Job) error         { return nil }
+func (q *recordingQueue) Retry(context.Context, *jobs.Job, time.Time) error { return nil }
+func (q *recordingQueue) Fail(context.Context, *jobs.Job) error             { return nil }
+func (q *recordingQueue) Durable() bool                                     { return true }
+func (q *recordingQueue) Len(context.Context) (int, error)                  { return len(q.pushed), nil }
+func (q *recordingQueue) Cap() int                                          { return 0 }
+
+func TestActionTransaction_DurableJobs(t *testing.T) {
+	const projectID = "44444444-4444-4444-4444-444444444444"
+
+	tests := []struct {
+		name           string
+		queryErr       error
+		pushErr        error
+		expectedStatus int
+		wantJobs       int
+		wantCommit     bool
+	}{
+		{
+			name:           "jobs are enqueued in the action transaction",
+			expectedStatus: http.StatusCreated,
+			wantJobs:       2,
+			wantCommit:     true,
+		},
+		{
+			name:           "failed write enqueues nothing",
+			queryErr:       errors.New("constraint violation"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "enqueue failure rolls back the write",
+			pushErr:        errors.New("connection reset"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			artifact := &Artifact{
+				Entities: map[string]*EntitySchema{
+					"Project": {
+						Name:  "Project",
+						Table: "projects",
+						Fields: map[string]*FieldSchema{
+							"id":   {Name: "id", Type: "uuid"},
+							"name": {Name: "name", Type: "string"},
+						},
+					},
+				},
+				Actions: map[string]*ActionSchema{
+					"create_project": {Name: "create_project", InputEntity: "Project", Operation: "create"},
+				},
+				Hooks: []*HookSchema{
+					{
+						Entity: "Project", Timing: "after", Operation: "create",
+						Jobs:    []string{"notify_owner"},
+						Delayed: []*DelayedJobSchema{{Job: "remind_owner", DelayMs: 24 * 60 * 60 * 1000}},
+					},
+				},
+				Jobs: map[string]*JobSchema{
+					"notify_owner": {Name: "notify_owner", InputEntity: "Project", Capabilities: []string{"email.send"}},
+					"remind_owner": {Name: "remind_owner", InputEntity: "Project", Capabilities: []string{"email.send"}},
+				},
+			}
+
+			mockDatabase := &mockDB{
+				queryFunc: func(ctx context.Context, query string, args ...any) (db.Rows, error) {
+					if tt.queryErr != nil {
+						return nil, tt.queryErr
+					}
+					return &mockRows{
+						cols:   []string{"id", "name"},
+						values: [][]any{{projectID, "apollo"}},
+					}, nil
+				},
+			}
+			s := createTestServerWithMockDB(t, artifact, mockDatabase)
+
+			queue := &recordingQueue{pushErr: tt.pushErr}
+			s.executor = jobs.NewExecutor(provider.Global(), s.logger, 1)
+			s.executor.SetQueue(queue)
+
+			body, _ := json.Marshal(map[string]any{"name": "apollo"})
+			req := httptest.NewRequest("POST", "/api/actions/create_project", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", w.Code, tt.expectedStatus, w.Body.String())
+			}
+			if len(queue.pushed) != tt.wantJobs {
+				t.Fatalf("pushed %d jobs, want %d", len(queue.pushed), tt.wantJobs)
+			}
+			for _, job := range queue.pushed {
+				delayed := time.Until(job.ScheduledAt) > 23*time.Hour
+				if delayed != (job.Name == "remind_owner") {
+					t.Errorf("job %s scheduled at %v", job.Name, job.ScheduledAt)
+				}
+			}
+			tx := mockDatabase.txs[0]
+			for _, via := range queue.via {
+				if via != tx {
+					t.Errorf("job pushed through %T, want the action transaction", via)
+				}
+			}
+			if tx.committed != tt.wantCommit {
+				t.Errorf("committed = %v, want %v", tx.committed, tt.wantCommit)
+			}
+		})
+	}
+}
+
+func TestWebhookAction_Transaction(t *testing.T) {
+	artifact := helpdeskRulesArtifact()
+	artifact.Webhooks = map[string]*WebhookSchema{
+		"support": {Name: "support", Provider: "generic", Events: []string{"comment.created"}, Action: "add_comment"},
+	}
+	artifact.Jobs = map[string]*JobSchema{
+		"notify_agents": {Name: "notify_agents", InputEntity: "Comment", Capabilities: []string{"email.send"}},
+	}
+	artifact.Hooks = []*HookSchema{
+		{Entity: "Comment", Timing: "before", Operation: "create", Steps: []*HookStepSchema{
+			{Kind: "set", Target: "body", Value: `"(no text)"`, Condition: `(body == "!")`},
+		}},
+		{Entity: "Comment", Timing: "after", Operation: "create", Jobs: []string{"notify_agents"}},
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantArgs   []any
+	}{
+		{"provider keys are dropped and hooks run", "!", http.StatusOK, []any{"(no text)"}},
+		{"rules reject the write", "", http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &rowsDB{}
+			mock := &mockDB{queryFunc: fake.query}
+			s := createTestServerWithMockDB(t, artifact, mock)
+			queue := &recordingQueue{}
+			s.executor = jobs.NewExecutor(provider.Global(), s.logger, 1)
+			s.executor.SetQueue(queue)
+
+			payload, _ := json.Marshal(map[string]any{"event": "comment.created", "id": "evt_1", "channel": "email", "body": tt.body})
+			req := httptest.NewRequest("POST", "/webhooks/support", bytes.NewReader(payload))
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if len(mock.txs) != 1 {
+				t.Fatalf("webhook used %d transactions, want 1", len(mock.txs))
+			}
+			tx := mock.txs[0]
+			if tt.wantArgs == nil {
+				if len(fake.writes) != 0 || len(queue.pushed) != 0 || tx.committed {
+					t.Errorf("rejected webhook wrote %v and pushed %d jobs", fake.writes, len(queue.pushed))
+				}
+				return
+			}
+			if len(fake.writeArgs) != 1 || len(fake.writeArgs[0]) != 1 || fake.writeArgs[0][0] != tt.wantArgs[0] {
+				t.Errorf("insert args = %v, want %v", fake.writeArgs, tt.wantArgs)
+			}
+			if len(queue.pushed) != 1 || queue.via[0] != tx || !tx.committed {
+				t.Errorf("pushed %d jobs, want notify_agents in the committed webhook transaction", len(queue.pushed))
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+// Package server provides the execution of actions declared with an input
+// block and steps.
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+	"github.com/forge-lang/forge/runtime/internal/expr"
+)
+
+// An action with an input block declares the fields its request body may
+// hold. The body is checked against them before anything runs, so an action
+// can only write what its steps say: close_ticket sets the status of the
+// ticket it is given and nothing else. The steps then run in order within
+// one transaction. Each set and create is a write of its entity, checked by
+// its hooks, rules and write access; the first failing step rolls back
+// every write before it.
+
+// hasSteps reports whether action is declared with an input block or steps
+// rather than operating on a single input entity.
+func (a *ActionSchema) hasSteps() bool {
+	return a.InputEntity == "" && (len(a.Input) > 0 || len(a.Steps) > 0)
+}
+
+// subject returns the entity of the first record input of action, which
+// tests of the action operate on.
+func (a *ActionSchema) subject() string {
+	for _, field := range a.Input {
+		if field.Entity != "" {
+			return field.Entity
+		}
+	}
+	return ""
+}
+
+// actionInput checks body against the input block of action: every key must
+// be an input field holding a value of its type, and every field without a
+// default must be present. It returns the input with defaults filled in.
+func actionInput(action *ActionSchema, body map[string]interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]*ActionInputSchema, len(action.Input))
+	for _, field := range action.Input {
+		fields[field.Name] = field
+	}
+	for name := range body {
+		if _, ok := fields[name]; !ok {
+			return nil, fmt.Errorf("unknown field %s in input of action %s", name, action.Name)
+		}
+	}
+
+	input := make(map[string]interface{}, len(action.Input))
+	for _, field := range action.Input {
+		v, ok := body[field.Name]
+		if !ok || v == nil {
+			if field.Default == nil {
+				return nil, fmt.Errorf("missing field %s in input of action %s", field.Name, action.Name)
+			}
+			v = field.Default
+		}
+		if !validFieldValue(&field.FieldSchema, v) {
+			return nil, fmt.Errorf("invalid value for %s in input of action %s", field.Name, action.Name)
+		}
+		if s, ok := v.(string); ok {
+			n := utf8.RuneCountInString(s)
+			if (field.MaxLength > 0 && n > field.MaxLength) || n < field.MinLength {
+				return nil, fmt.Errorf("invalid length of %s in input of action %s", field.Name, action.Name)
+			}
+		}
+		input[field.Name] = v
+	}
+	return input, nil
+}
+
+// handleStepAction runs an action declared with an input block and steps.
+// The response holds the records the steps wrote, in order.
+func (s *Server) handleStepAction(w http.ResponseWriter, r *http.Request, action *ActionSchema, body map[string]interface{}) {
+	input, err := actionInput(action, body)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, Message{
+			Code:    "INVALID_INPUT",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	ctx := r.Context()
+	database := s.getAuthenticatedDB(r)
+
+	// Begin sets app.user_id for the transaction when database is user-scoped.
+	tx, err := database.Begin(ctx)
+	if err != nil {
+		s.logger.Error("begin transaction failed", "error", err, "action", action.Name)
+		s.respondError(w, http.StatusInternalServerError, Message{
+			Code:    "TRANSACTION_FAILED",
+			Message: "Failed to start transaction",
+		})
+		return
+	}
+	// Rollback is a no-op once the transaction has committed.
+	defer tx.Rollback(ctx)
+
+	changes, messages, err := s.runActionSteps(ctx, tx, action, input)
+	if err != nil {
+		s.logger.Info("action.rolled_back", "action", action.Name, "error", err)
+		s.respondActionError(w, err)
+		return
+	}
+
+	// A durable job queue shares the transaction, so jobs are never emitted
+	// for a write that rolls back.
+	durableJobs := s.durableJobs()
+	if durableJobs {
+		for _, change := range changes {
+			if err := s.enqueueHookJobs(ctx, tx, change.Entity, change.Operation, change.Record); err != nil {
+				s.logger.Info("action.rolled_back", "action", action.Name, "error", err)
+				s.respondActionError(w, &actionError{
+					Status:  http.StatusInternalServerError,
+					Message: Message{Code: "JOB_ENQUEUE_FAILED", Message: "Failed to enqueue jobs"},
+					Err:     err,
+				})
+				return
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.logger.Error("commit failed", "error", err, "action", action.Name)
+		s.respondError(w, http.StatusInternalServerError, Message{
+			Code:    "TRANSACTION_FAILED",
+			Message: "Failed to commit transaction",
+		})
+		return
+	}
+	s.logger.Info("action.committed", "action", action.Name, "writes", len(changes))
+
+	artifact := s.getArtifact()
+	for _, change := range changes {
+		s.broadcastChange(change)
+		if !durableJobs {
+			s.evaluateHooks(change.Entity, change.Operation, change.Record)
+		}
+
+		// After-hook emits describe the committed record; failures are
+		// logged since the mutation can no longer be rejected.
+		emitted, err := s.runHookSteps(ctx, database, artifact.Entities[change.Entity], "after", change.Operation, change.Record, nil)
+		if err != nil {
+			s.logger.Error("hook.emit_failed", "entity", change.Entity, "operation", change.Operation, "error", err)
+		}
+		messages = append(messages, emitted...)
+	}
+
+	// The response carries the fields the caller may read
+	written := make([]*entityChange, len(changes))
+	fr := s.newFieldReader(ctx, database)
+	for i, change := range changes {
+		written[i] = &entityChange{Entity: change.Entity, Operation: change.Operation, Record: change.Record}
+		if entity, ok := artifact.Entities[change.Entity]; ok {
+			written[i].Record = fr.record(entity, change.Record)
+		}
+	}
+	s.respondWithMessages(w, http.StatusOK, written, messages)
+}
+
+// runActionSteps runs the steps of action within tx and returns the records
+// they wrote and the messages they emitted. Every record an input field
+// refers to must exist and be readable by the caller, and stays locked until
+// tx ends.
+//
+// Consecutive sets on one record are written together, as a single update
+// whose rules see the new values as input.<field>. Any other step first
+// writes the pending sets, so it sees the record as they left it.
+func (s *Server) runActionSteps(ctx context.Context, tx db.Tx, action *ActionSchema, input map[string]interface{}) ([]*entityChange, []Message, error) {
+	artifact := s.getArtifact()
+
+	for _, field := range action.Input {
+		if field.Entity == "" {
+			continue
+		}
+		entity, ok := artifact.Entities[field.Entity]
+		if !ok {
+			return nil, nil, fmt.Errorf("action %s: unknown entity %s", action.Name, field.Entity)
+		}
+		row, err := lockRow(ctx, tx, entity.Table, input[field.Name])
+		if err != nil {
+			return nil, nil, &actionError{
+				Status:  http.StatusInternalServerError,
+				Message: Message{Code: "QUERY_FAILED", Message: "Failed to load record"},
+				Err:     fmt.Errorf("loading %s %v: %w", entity.Name, input[field.Name], err),
+			}
+		}
+		if row == nil {
+			return nil, nil, &actionError{
+				Status:  http.StatusNotFound,
+				Message: Message{Code: "NOT_FOUND", Message: fmt.Sprintf("%s %v not found", entity.Name, input[field.Name])},
+			}
+		}
+	}
+
+	resolver := s.newActionResolver(ctx, tx, action, input)
+	var changes []*entityChange
+	var messages []Message
+
+	// pending is the set step whose record the updates are for
+	var pending *ActionStepSchema
+	updates := make(map[string]interface{})
+	flush := func() error {
+		if pending == nil {
+			return nil
+		}
+		entity := artifact.Entities[pending.Entity]
+		ruleInput := map[string]interface{}{"id": input[pending.Record]}
+		for k, v := range updates {
+			ruleInput[k] = v
+		}
+		record, previous, emitted, err := s.executeUpdateAction(ctx, tx, entity, ruleInput, updates)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, &entityChange{Entity: entity.Name, Operation: "update", Record: record, Previous: previous})
+		messages = append(messages, emitted...)
+		pending, updates = nil, make(map[string]interface{})
+		return nil
+	}
+
+	for _, step := range action.Steps {
+		if pending != nil && (step.Kind != "set" || step.Record != pending.Record) {
+			if err := flush(); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if step.Condition != "" {
+			holds, err := evalHookExpr(ctx, step.Condition, resolver)
+			if err != nil {
+				return nil, nil, actionStepError(action, step, err)
+			}
+			if !expr.Truthy(holds) {
+				continue
+			}
+		}
+
+		switch step.Kind {
+		case "reject":
+			s.logger.Info("action.rejected", "action", action.Name, "code", step.Message)
+			return nil, nil, &actionError{
+				Status:  http.StatusUnprocessableEntity,
+				Message: s.messageFor(step.Message, "error"),
+			}
+
+		case "emit":
+			messages = append(messages, s.messageFor(step.Message, "info"))
+
+		case "set":
+			entity, ok := artifact.Entities[step.Entity]
+			if !ok {
+				return nil, nil, actionStepError(action, step, fmt.Errorf("unknown entity %s", step.Entity))
+			}
+			value, err := evalHookExpr(ctx, step.Value, resolver)
+			if err != nil {
+				return nil, nil, actionStepError(action, step, err)
+			}
+			// A to-one relation is set by its foreign key
+			column := step.Field
+			if rel, ok := entity.Relations[step.Field]; ok && !rel.IsMany {
+				column = rel.ForeignKey
+			}
+			pending = step
+			updates[column] = value
+
+		case "create":
+			entity, ok := artifact.Entities[step.Entity]
+			if !ok {
+				return nil, nil, actionStepError(action, step, fmt.Errorf("unknown entity %s", step.Entity))
+			}
+			values := make(map[string]interface{}, len(step.Fields))
+			for field, src := range step.Fields {
+				value, err := evalHookExpr(ctx, src, resolver)
+				if err != nil {
+					return nil, nil, actionStepError(action, step, err)
+				}
+				values[field] = value
+			}
+			populateUserFields(entity, values, resolver.userID)
+			record, emitted, err := s.executeCreateAction(ctx, tx, entity, values)
+			if err != nil {
+				return nil, nil, err
+			}
+			changes = append(changes, &entityChange{Entity: entity.Name, Operation: "create", Record: record})
+			messages = append(messages, emitted...)
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, nil, err
+	}
+	return changes, messages, nil
+}
+
+// actionStepError reports an action step that could not be evaluated. Like
+// rules and hooks, steps fail closed.
+func actionStepError(action *ActionSchema, step *ActionStepSchema, err error) error {
+	return &actionError{
+		Status:  http.StatusInternalServerError,
+		Message: Message{Code: "ACTION_EVALUATION_FAILED", Message: "Failed to evaluate action"},
+		Err:     fmt.Errorf("action %s %s: %w", action.Name, step.Kind, err),
+	}
+}
+
+// actionResolver resolves the paths of action steps against the input: a
+// scalar field to its value, a record field through the record it refers
+// to, as in ticket.status. input.<field> is the same as <field>.
+type actionResolver struct {
+	*recordResolver
+}
+
+// newActionResolver returns a resolver over input, read as a record of an
+// entity whose fields are the scalar input fields and whose to-one relations
+// are the record input fields.
+func (s *Server) newActionResolver(ctx context.Context, q querier, action *ActionSchema, input map[string]interface{}) *actionResolver {
+	artifact := s.getArtifact()
+	entity := &EntitySchema{
+		Name:      action.Name,
+		Fields:    make(map[string]*FieldSchema),
+		Relations: make(map[string]*RelSchema),
+	}
+	for _, field := range action.Input {
+		if field.Entity == "" {
+			entity.Fields[field.Name] = &field.FieldSchema
+			continue
+		}
+		rel := &RelSchema{Name: field.Name, Target: field.Entity, ForeignKey: field.Name}
+		if target, ok := artifact.Entities[field.Entity]; ok {
+			rel.TargetTable = target.Table
+		}
+		entity.Relations[field.Name] = rel
+	}
+	return &actionResolver{s.newRecordResolver(ctx, q, entity, input, input)}
+}
+
+// Resolve implements expr.Resolver.
+func (r *actionResolver) Resolve(ctx context.Context, path []string) (any, bool, error) {
+	if path[0] == "input" && len(path) > 1 {
+		path = path[1:]
+	}
+	return r.recordResolver.Resolve(ctx, path)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// stepArtifact adds close_ticket, declared with an input block and steps,
+// to the helpdesk rules. It rejects closed tickets, closes the ticket and
+// records the reason, when given, as a comment on it.
+func stepArtifact() *Artifact {
+	artifact := helpdeskRulesArtifact()
+	artifact.Entities["Comment"].Relations["ticket"] = &RelSchema{
+		Name: "ticket", Target: "Ticket", TargetTable: "tickets", ForeignKey: "ticket_id",
+	}
+	artifact.Messages["TICKET_CLOSED_OK"] = &MessageSchema{Code: "TICKET_CLOSED_OK", Level: "info", Default: "Ticket closed."}
+
+	closeSteps := []*ActionStepSchema{
+		{Kind: "reject", Message: "TICKET_CLOSED", Condition: "(ticket.status == closed)"},
+		{Kind: "set", Entity: "Ticket", Record: "ticket", Field: "status", Value: "closed"},
+		{Kind: "create", Entity: "Comment", Fields: map[string]string{"ticket": "input.ticket", "body": "input.reason"}, Condition: `(input.reason != "")`},
+		{Kind: "emit", Message: "TICKET_CLOSED_OK"},
+	}
+	input := []*ActionInputSchema{
+		{FieldSchema: FieldSchema{Name: "ticket", Type: "uuid"}, Entity: "Ticket"},
+		{FieldSchema: FieldSchema{Name: "reason", Type: "string", Default: "", MaxLength: 20}},
+	}
+	artifact.Actions["close_ticket"] = &ActionSchema{Name: "close_ticket", Input: input, Steps: closeSteps}
+
+	// close_with_comment always comments, which the comment rules reject
+	// without a reason
+	unconditional := *closeSteps[2]
+	unconditional.Condition = ""
+	artifact.Actions["close_with_comment"] = &ActionSchema{
+		Name:  "close_with_comment",
+		Input: input,
+		Steps: []*ActionStepSchema{closeSteps[1], &unconditional},
+	}
+	return artifact
+}
+
+func createStepTestServer(t *testing.T, status string) (*Server, *tableDB, *mockDB) {
+	t.Helper()
+	artifact := stepArtifact()
+	fake := &tableDB{artifact: artifact, tables: map[string][]map[string]any{
+		"tickets": {{"id": ruleTestTicketID, "subject": "printer", "status": status}},
+	}}
+	database := &mockDB{queryFunc: fake.Query}
+	return createTestServerWithMockDB(t, artifact, database), fake, database
+}
+
+func TestStepAction(t *testing.T) {
+	s, fake, database := createStepTestServer(t, "open")
+	watcher := replicaClient(s.hub, ruleTestUserID, "Ticket:update")
+
+	w, resp := postRuleAction(t, s, "close_ticket", ruleTestUserID, map[string]any{
+		"ticket": ruleTestTicketID,
+		"reason": "fixed",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d (body: %s)", w.Code, w.Body.String())
+	}
+	if !database.txs[0].committed {
+		t.Error("expected the steps to commit")
+	}
+
+	if got := fake.tables["tickets"][0]["status"]; got != "closed" {
+		t.Errorf("ticket status = %v, want closed", got)
+	}
+	comments := fake.tables["comments"]
+	if len(comments) != 1 || comments[0]["body"] != "fixed" || comments[0]["ticket_id"] != ruleTestTicketID {
+		t.Errorf("comments = %v, want the reason on the ticket", comments)
+	}
+
+	changes, _ := resp.Data.([]any)
+	if len(changes) != 2 {
+		t.Fatalf("data = %v, want the update and the create", resp.Data)
+	}
+	if first, _ := changes[0].(map[string]any); first["entity"] != "Ticket" || first["operation"] != "update" {
+		t.Errorf("first change = %v, want the ticket update", changes[0])
+	}
+	if len(resp.Messages) != 1 || resp.Messages[0].Code != "TICKET_CLOSED_OK" {
+		t.Errorf("messages = %+v, want TICKET_CLOSED_OK", resp.Messages)
+	}
+	s.changePushes.wait()
+	if got := drain(t, watcher); len(got) != 1 {
+		t.Errorf("subscriber received %d messages, want the ticket update", len(got))
+	}
+}
+
+func TestStepActionDefaults(t *testing.T) {
+	s, fake, _ := createStepTestServer(t, "open")
+
+	w, _ := postRuleAction(t, s, "close_ticket", ruleTestUserID, map[string]any{"ticket": ruleTestTicketID})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d (body: %s)", w.Code, w.Body.String())
+	}
+	if got := fake.tables["tickets"][0]["status"]; got != "closed" {
+		t.Errorf("ticket status = %v, want closed", got)
+	}
+	if comments := fake.tables["comments"]; len(comments) != 0 {
+		t.Errorf("comments = %v, want none without a reason", comments)
+	}
+}
+
+func TestStepActionErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		status     string
+		input      map[string]any
+		wantStatus int
+		wantCode   string
+		wantTx     bool
+	}{
+		{"unknown field", "close_ticket", "open", map[string]any{"ticket": ruleTestTicketID, "status": "open"}, http.StatusBadRequest, "INVALID_INPUT", false},
+		{"missing field", "close_ticket", "open", map[string]any{"reason": "fixed"}, http.StatusBadRequest, "INVALID_INPUT", false},
+		{"invalid record id", "close_ticket", "open", map[string]any{"ticket": "mine"}, http.StatusBadRequest, "INVALID_INPUT", false},
+		{"invalid type", "close_ticket", "open", map[string]any{"ticket": ruleTestTicketID, "reason": 3}, http.StatusBadRequest, "INVALID_INPUT", false},
+		{"too long", "close_ticket", "open", map[string]any{"ticket": ruleTestTicketID, "reason": strings.Repeat("x", 21)}, http.StatusBadRequest, "INVALID_INPUT", false},
+		{"missing record", "close_ticket", "open", map[string]any{"ticket": accessTestOtherTicketID}, http.StatusNotFound, "NOT_FOUND", true},
+		{"reject step", "close_ticket", "closed", map[string]any{"ticket": ruleTestTicketID}, http.StatusUnprocessableEntity, "TICKET_CLOSED", true},
+		{"later step fails", "close_with_comment", "open", map[string]any{"ticket": ruleTestTicketID}, http.StatusUnprocessableEntity, "COMMENT_EMPTY", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, fake, database := createStepTestServer(t, tt.status)
+			w, resp := postRuleAction(t, s, tt.action, ruleTestUserID, tt.input)
+			if w.Code != tt.wantStatus || len(resp.Messages) != 1 || resp.Messages[0].Code != tt.wantCode {
+				t.Fatalf("status = %d, messages = %+v, want %d %s", w.Code, resp.Messages, tt.wantStatus, tt.wantCode)
+			}
+			if got := len(database.txs) > 0; got != tt.wantTx {
+				t.Fatalf("transaction started = %v, want %v", got, tt.wantTx)
+			}
+			if tt.wantTx && (database.txs[0].committed || !database.txs[0].rolledBack) {
+				t.Error("expected the transaction to roll back")
+			}
+			if tt.name != "later step fails" && fake.tables["tickets"][0]["status"] != tt.status {
+				t.Errorf("ticket status = %v, want it unchanged", fake.tables["tickets"][0]["status"])
+			}
+		})
+	}
+}
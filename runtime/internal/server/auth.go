@@ -728,7 +728,9 @@ func (s *Server) getUserByID(ctx context.Context, userID string) (map[string]int
 		userData[field] = convertToJSONFriendly(values[i])
 	}
 
-	return userData, nil
+	// The user reads their own record as any record
+	userCtx := context.WithValue(ctx, userContextKey{}, userID)
+	return s.newFieldReader(userCtx, s.db).record(entity, userData), nil
 }
 
 // getUserPasswordHash retrieves only the password hash for a user.
@@ -0,0 +1,378 @@
+// Package server provides the backplane relaying WebSocket broadcasts
+// between runtime replicas.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+)
+
+// Each replica's hub serves only the sockets connected to it. Broadcasts are
+// delivered to the local clients at once and published on the backplane,
+// from which the hubs of the other replicas deliver them to theirs. Messages
+// that depend on the subscriber, like entity changes filtered by read
+// access, are not relayed as messages: the event is relayed and every
+// replica works out the messages of its own clients.
+
+// Backplane carries hub broadcasts between runtime replicas. A hub ignores
+// the broadcasts it published itself.
+type Backplane interface {
+	// Publish sends payload to every hub subscribed to the backplane.
+	Publish(ctx context.Context, payload []byte) error
+
+	// Subscribe calls handle with each payload published on the backplane
+	// until ctx is done.
+	Subscribe(ctx context.Context, handle func(payload []byte)) error
+}
+
+// hubEnvelope is a broadcast relayed between replicas.
+type hubEnvelope struct {
+	Node    string          `json:"node"`
+	Kind    string          `json:"kind"`            // view, all, relay
+	View    string          `json:"view,omitempty"`  // view kind: the subscription key
+	Topic   string          `json:"topic,omitempty"` // relay kind: the handler
+	Message json.RawMessage `json:"message"`
+}
+
+// SetBackplane connects the hub to the hubs of other replicas until ctx is
+// done.
+func (h *Hub) SetBackplane(ctx context.Context, backplane Backplane) error {
+	h.mu.Lock()
+	h.backplane = backplane
+	h.mu.Unlock()
+	return backplane.Subscribe(ctx, h.receive)
+}
+
+// OnRelay registers handle for the events other replicas relay on topic.
+func (h *Hub) OnRelay(topic string, handle func(json.RawMessage)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.relays[topic] = handle
+}
+
+// Relay sends event to the handlers the other replicas registered for topic.
+func (h *Hub) Relay(topic string, event interface{}) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[WS] Error marshaling relayed event: %v", err)
+		return
+	}
+	h.publish(hubEnvelope{Kind: "relay", Topic: topic, Message: data})
+}
+
+// publish sends env to the other replicas, if the hub has a backplane.
+func (h *Hub) publish(env hubEnvelope) {
+	h.mu.RLock()
+	backplane := h.backplane
+	h.mu.RUnlock()
+	if backplane == nil {
+		return
+	}
+
+	env.Node = h.node
+	payload, err := json.Marshal(env)
+	if err != nil {
+		log.Printf("[WS] Error marshaling relayed broadcast: %v", err)
+		return
+	}
+	if err := backplane.Publish(context.Background(), payload); err != nil {
+		log.Printf("[WS] Error publishing broadcast: %v", err)
+	}
+}
+
+// receive delivers a broadcast published by another replica to the clients
+// of this one.
+func (h *Hub) receive(payload []byte) {
+	var env hubEnvelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		log.Printf("[WS] Error decoding relayed broadcast: %v", err)
+		return
+	}
+	if env.Node == h.node {
+		return
+	}
+
+	switch env.Kind {
+	case "view":
+		h.sendToView(env.View, env.Message, nil)
+	case "all":
+		h.sendToAll(env.Message)
+	case "relay":
+		h.mu.RLock()
+		handle := h.relays[env.Topic]
+		h.mu.RUnlock()
+		if handle != nil {
+			handle(env.Message)
+		}
+	}
+}
+
+// MemoryBackplane relays broadcasts between the hubs of one process. It
+// stands in for a shared backplane in tests; payloads are delivered before
+// Publish returns.
+type MemoryBackplane struct {
+	mu       sync.RWMutex
+	handlers map[int]func([]byte)
+	next     int
+}
+
+// NewMemoryBackplane creates an in-memory backplane.
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{handlers: make(map[int]func([]byte))}
+}
+
+// Publish calls every subscribed handler with payload.
+func (b *MemoryBackplane) Publish(ctx context.Context, payload []byte) error {
+	b.mu.RLock()
+	handlers := make([]func([]byte), 0, len(b.handlers))
+	for _, handle := range b.handlers {
+		handlers = append(handlers, handle)
+	}
+	b.mu.RUnlock()
+
+	for _, handle := range handlers {
+		handle(payload)
+	}
+	return nil
+}
+
+// Subscribe adds handle until ctx is done.
+func (b *MemoryBackplane) Subscribe(ctx context.Context, handle func([]byte)) error {
+	b.mu.Lock()
+	id := b.next
+	b.next++
+	b.handlers[id] = handle
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.handlers, id)
+		b.mu.Unlock()
+	}()
+	return nil
+}
+
+const (
+	// hubChannel is the NOTIFY channel the replicas share.
+	hubChannel = "forge_hub"
+
+	// maxNotifyPayload is the largest payload sent inline. PostgreSQL
+	// rejects NOTIFY payloads of 8000 bytes or more.
+	maxNotifyPayload = 7900
+
+	// payloadRefPrefix marks a notification naming a row of
+	// _forge_hub_payloads instead of carrying the payload.
+	payloadRefPrefix = "ref:"
+
+	// payloadRetention is how long payloads sent by reference are kept for
+	// the replicas to read.
+	payloadRetention = 5 * time.Minute
+)
+
+// PostgresBackplane relays broadcasts between replicas with LISTEN/NOTIFY
+// on the database they share. Payloads too big for NOTIFY are stored in the
+// _forge_hub_payloads table and notified by reference. Broadcasts published
+// while a replica reconnects its listening connection are lost to it.
+type PostgresBackplane struct {
+	db       db.Database
+	listener db.Listener
+	logger   *slog.Logger
+
+	// RetryInterval is how long to wait before listening again after the
+	// connection failed.
+	RetryInterval time.Duration
+}
+
+// NewPostgresBackplane creates the _forge_hub_payloads table if needed and
+// returns a backplane on database, which must support LISTEN.
+func NewPostgresBackplane(ctx context.Context, database db.Database, logger *slog.Logger) (*PostgresBackplane, error) {
+	listener, ok := database.(db.Listener)
+	if !ok {
+		return nil, fmt.Errorf("database does not support LISTEN")
+	}
+	if _, err := database.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS _forge_hub_payloads (
+			id BIGSERIAL PRIMARY KEY,
+			payload TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`); err != nil {
+		return nil, fmt.Errorf("creating _forge_hub_payloads table: %w", err)
+	}
+	return &PostgresBackplane{
+		db:            database,
+		listener:      listener,
+		logger:        logger,
+		RetryInterval: time.Second,
+	}, nil
+}
+
+// Publish notifies hubChannel with payload, or with a reference to it when
+// it is too big to send inline.
+func (b *PostgresBackplane) Publish(ctx context.Context, payload []byte) error {
+	notification := string(payload)
+	if len(payload) > maxNotifyPayload {
+		var id int64
+		if err := b.db.QueryRow(ctx,
+			"INSERT INTO _forge_hub_payloads (payload) VALUES ($1) RETURNING id",
+			notification,
+		).Scan(&id); err != nil {
+			return fmt.Errorf("storing broadcast payload: %w", err)
+		}
+		notification = payloadRefPrefix + strconv.FormatInt(id, 10)
+
+		if _, err := b.db.Exec(ctx,
+			"DELETE FROM _forge_hub_payloads WHERE created_at < NOW() - make_interval(secs => $1)",
+			payloadRetention.Seconds(),
+		); err != nil {
+			b.logger.Warn("failed to prune broadcast payloads", "error", err)
+		}
+	}
+
+	_, err := b.db.Exec(ctx, "SELECT pg_notify($1, $2)", hubChannel, notification)
+	return err
+}
+
+// Subscribe listens on hubChannel in the background until ctx is done,
+// listening again whenever the connection fails.
+func (b *PostgresBackplane) Subscribe(ctx context.Context, handle func([]byte)) error {
+	go func() {
+		for {
+			err := b.listener.Listen(ctx, hubChannel, func(notification string) {
+				payload, err := b.payload(ctx, notification)
+				if err != nil {
+					b.logger.Error("failed to load broadcast payload", "notification", notification, "error", err)
+					return
+				}
+				handle(payload)
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			b.logger.Warn("backplane connection lost, listening again", "error", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(b.RetryInterval):
+			}
+		}
+	}()
+	return nil
+}
+
+// payload returns the payload of a notification, loading it when the
+// notification is a reference.
+func (b *PostgresBackplane) payload(ctx context.Context, notification string) ([]byte, error) {
+	ref, ok := strings.CutPrefix(notification, payloadRefPrefix)
+	if !ok {
+		return []byte(notification), nil
+	}
+	id, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload reference: %w", err)
+	}
+	var payload string
+	if err := b.db.QueryRow(ctx, "SELECT payload FROM _forge_hub_payloads WHERE id = $1", id).Scan(&payload); err != nil {
+		return nil, err
+	}
+	return []byte(payload), nil
+}
+
+// entityChangeTopic relays entity changes between replicas.
+const entityChangeTopic = "entity_change"
+
+// entityChange is an entity change. Previous is the stored row an update or
+// delete replaced, when it was loaded; view subscriptions use it to find the
+// parameterization the row left.
+type entityChange struct {
+	Entity    string                 `json:"entity"`
+	Operation string                 `json:"operation"`
+	Record    map[string]interface{} `json:"record"`
+	Previous  map[string]interface{} `json:"previous,omitempty"`
+}
+
+// relayedChange is an entity change as relayed to other replicas. It names
+// the row instead of carrying it, so that no field, whoever may read it,
+// passes through the backplane: each replica loads the row and projects it
+// for its own subscribers. Previous keeps only the columns of the replaced
+// row that select a view parameterization.
+type relayedChange struct {
+	Entity    string                 `json:"entity"`
+	Operation string                 `json:"operation"`
+	ID        string                 `json:"id"`
+	Previous  map[string]interface{} `json:"previous,omitempty"`
+}
+
+// relayedChange returns change as relayed to other replicas.
+func (s *Server) relayedChange(change *entityChange) *relayedChange {
+	relayed := &relayedChange{
+		Entity:    change.Entity,
+		Operation: change.Operation,
+		ID:        fmt.Sprintf("%v", change.Record["id"]),
+	}
+	if change.Previous != nil {
+		for _, column := range s.sourceParamColumns(change.Entity) {
+			if v, ok := change.Previous[column]; ok {
+				if relayed.Previous == nil {
+					relayed.Previous = make(map[string]interface{})
+				}
+				relayed.Previous[column] = v
+			}
+		}
+	}
+	return relayed
+}
+
+// pushRelayedChange pushes an entity change relayed by another replica to
+// the subscribers of this one, with the row as stored now. A row deleted
+// since is not pushed: its delete follows.
+func (s *Server) pushRelayedChange(relayed *relayedChange) {
+	change := &entityChange{
+		Entity:    relayed.Entity,
+		Operation: relayed.Operation,
+		Record:    map[string]interface{}{"id": relayed.ID},
+		Previous:  relayed.Previous,
+	}
+	if relayed.Operation != "delete" {
+		entity, ok := s.getArtifact().Entities[relayed.Entity]
+		if !ok {
+			return
+		}
+		record, err := loadRow(context.Background(), s.db, entity.Table, relayed.ID)
+		if err != nil {
+			s.logger.Error("[BROADCAST] failed to load relayed entity change", "entity", relayed.Entity, "id", relayed.ID, "error", err)
+			return
+		}
+		if record == nil {
+			return
+		}
+		change.Record = record
+	}
+	s.pushEntityChange(change)
+}
+
+// connectBackplane relays the server's broadcasts, entity changes and
+// presence changes to the other replicas on backplane until ctx is done.
+func (s *Server) connectBackplane(ctx context.Context, backplane Backplane) error {
+	s.hub.OnRelay(entityChangeTopic, func(data json.RawMessage) {
+		var relayed relayedChange
+		if err := json.Unmarshal(data, &relayed); err != nil {
+			s.logger.Error("[BROADCAST] invalid relayed entity change", "error", err)
+			return
+		}
+		s.changePushes.run(func() { s.pushRelayedChange(&relayed) })
+	})
+	s.hub.OnRelay(presenceChangeTopic, s.relayPresenceChange)
+	return s.hub.SetBackplane(ctx, backplane)
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+)
+
+// replicaClient registers a client with hub, subscribed to views.
+func replicaClient(hub *Hub, userID string, views ...string) *Client {
+	c := &Client{hub: hub, send: make(chan []byte, 16), subscriptions: make(map[string]bool), userID: userID}
+	hub.mu.Lock()
+	hub.clients[c] = true
+	hub.mu.Unlock()
+	for _, view := range views {
+		hub.Subscribe(c, view)
+	}
+	return c
+}
+
+// drain returns the types and views of the messages queued for c.
+func drain(t *testing.T, c *Client) []string {
+	t.Helper()
+	var got []string
+	for len(c.send) > 0 {
+		var msg WSMessage
+		if err := json.Unmarshal(<-c.send, &msg); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, msg.Type+" "+msg.View)
+	}
+	return got
+}
+
+func TestHubBackplane(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backplane := NewMemoryBackplane()
+	a, b := NewHub(), NewHub()
+	for _, hub := range []*Hub{a, b} {
+		if err := hub.SetBackplane(ctx, backplane); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sender := replicaClient(a, "", "Room:1")
+	local := replicaClient(a, "", "Room:1")
+	remote := replicaClient(b, "", "Room:1")
+	elsewhere := replicaClient(b, "", "Room:2")
+
+	a.BroadcastToView("Room:1", map[string]any{"text": "hi"})
+	a.BroadcastEphemeral(sender, "Room:1", map[string]any{"typing": true})
+	b.BroadcastToAll("artifact_reload", nil)
+
+	tests := []struct {
+		name   string
+		client *Client
+		want   []string
+	}{
+		{"sender", sender, []string{"data Room:1", "artifact_reload "}},
+		{"same replica", local, []string{"data Room:1", "ephemeral Room:1", "artifact_reload "}},
+		{"other replica", remote, []string{"data Room:1", "ephemeral Room:1", "artifact_reload "}},
+		{"other view", elsewhere, []string{"artifact_reload "}},
+	}
+	for _, tt := range tests {
+		if got := drain(t, tt.client); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s received %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// recordingBackplane records the payloads published on a backplane.
+type recordingBackplane struct {
+	Backplane
+	mu       sync.Mutex
+	payloads []string
+}
+
+func (b *recordingBackplane) Publish(ctx context.Context, payload []byte) error {
+	b.mu.Lock()
+	b.payloads = append(b.payloads, string(payload))
+	b.mu.Unlock()
+	return b.Backplane.Publish(ctx, payload)
+}
+
+func TestBroadcastEntityChangeAcrossReplicas(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backplane := &recordingBackplane{Backplane: NewMemoryBackplane()}
+	fake := &accessDB{tables: accessTables()}
+	replicas := []*Server{
+		createTestServerWithMockDB(t, subscriptionArtifact(), &mockDB{queryFunc: fake.query}),
+		createTestServerWithMockDB(t, subscriptionArtifact(), &mockDB{queryFunc: fake.query}),
+	}
+	for _, s := range replicas {
+		if err := s.connectBackplane(ctx, backplane); err != nil {
+			t.Fatal(err)
+		}
+	}
+	author := replicaClient(replicas[1].hub, ruleTestUserID, "Ticket:update", "TicketsByAuthor:"+ruleTestUserID)
+	other := replicaClient(replicas[1].hub, ruleTestOtherID, "Ticket:update")
+
+	// The other replica pushes the row as it loads it, not as relayed
+	replicas[0].broadcastEntityChange("Ticket", "update", map[string]any{"id": ruleTestTicketID, "subject": "draft", "author_id": ruleTestUserID})
+	replicas[1].changePushes.wait()
+
+	if got := drain(t, other); len(got) != 0 {
+		t.Errorf("the other replica ignored read access: %v", got)
+	}
+	var pushed WSMessage
+	for len(author.send) > 0 {
+		var msg WSMessage
+		if err := json.Unmarshal(<-author.send, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.View == "Ticket:update" {
+			pushed = msg
+		}
+	}
+	if record, _ := pushed.Data.(map[string]any); record["subject"] != "mine" {
+		t.Errorf("author on the other replica received %+v, want the stored row", pushed)
+	}
+
+	// A delete relays the columns selecting the parameterization it left
+	replicas[0].broadcastChange(&entityChange{
+		Entity:    "Ticket",
+		Operation: "delete",
+		Record:    map[string]any{"id": ruleTestTicketID},
+		Previous:  map[string]any{"id": ruleTestTicketID, "subject": "draft", "author_id": ruleTestUserID},
+	})
+	replicas[1].changePushes.wait()
+	if got := drain(t, author); fmt.Sprint(got) != "[data TicketsByAuthor:"+ruleTestUserID+"]" {
+		t.Errorf("author on the other replica received %v, want its parameterization queried again", got)
+	}
+
+	backplane.mu.Lock()
+	defer backplane.mu.Unlock()
+	if len(backplane.payloads) != 2 {
+		t.Fatalf("published %d payloads, want 2", len(backplane.payloads))
+	}
+	for _, payload := range backplane.payloads {
+		if strings.Contains(payload, "draft") || strings.Contains(payload, "subject") {
+			t.Errorf("relayed payload carries row fields: %s", payload)
+		}
+	}
+	if !strings.Contains(backplane.payloads[1], `"previous":{"author_id":"`+ruleTestUserID+`"}`) {
+		t.Errorf("delete relayed %s, want the previous author", backplane.payloads[1])
+	}
+}
+
+// notifyDB fakes the statements of PostgresBackplane: it stores payloads
+// and delivers notifications to its listeners.
+type notifyDB struct {
+	mockDB
+	mu        sync.Mutex
+	payloads  []string
+	notified  []string
+	listeners []func(string)
+}
+
+type notifyRow struct{ value any }
+
+func (r notifyRow) Scan(dest ...any) error {
+	switch d := dest[0].(type) {
+	case *int64:
+		*d = r.value.(int64)
+	case *string:
+		*d = r.value.(string)
+	}
+	return nil
+}
+
+func (f *notifyDB) QueryRow(ctx context.Context, query string, args ...any) db.Row {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if strings.HasPrefix(query, "INSERT") {
+		f.payloads = append(f.payloads, args[0].(string))
+		return notifyRow{int64(len(f.payloads))}
+	}
+	return notifyRow{f.payloads[args[0].(int64)-1]}
+}
+
+func (f *notifyDB) Exec(ctx context.Context, query string, args ...any) (db.Result, error) {
+	if !strings.Contains(query, "pg_notify") {
+		return &mockResult{}, nil
+	}
+	f.mu.Lock()
+	f.notified = append(f.notified, args[1].(string))
+	listeners := append([]func(string){}, f.listeners...)
+	f.mu.Unlock()
+	for _, handle := range listeners {
+		handle(args[1].(string))
+	}
+	return &mockResult{}, nil
+}
+
+func (f *notifyDB) Listen(ctx context.Context, channel string, handle func(string)) error {
+	f.mu.Lock()
+	f.listeners = append(f.listeners, handle)
+	f.mu.Unlock()
+	<-ctx.Done()
+	return nil
+}
+
+func TestPostgresBackplane(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := &notifyDB{}
+	backplane, err := NewPostgresBackplane(ctx, fake, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []byte, 2)
+	if err := backplane.Subscribe(ctx, func(payload []byte) { received <- payload }); err != nil {
+		t.Fatal(err)
+	}
+	for !listening(fake) {
+		time.Sleep(time.Millisecond)
+	}
+
+	small := []byte(`{"kind":"all"}`)
+	big := []byte(`{"kind":"all","message":"` + strings.Repeat("x", maxNotifyPayload) + `"}`)
+	for _, payload := range [][]byte{small, big} {
+		if err := backplane.Publish(ctx, payload); err != nil {
+			t.Fatal(err)
+		}
+		if got := <-received; string(got) != string(payload) {
+			t.Errorf("received %.40s, want %.40s", got, payload)
+		}
+	}
+	if want := []string{string(small), "ref:1"}; fmt.Sprint(fake.notified) != fmt.Sprint(want) {
+		t.Errorf("notified %.60v, want the small payload inline and the big one by reference", fake.notified)
+	}
+}
+
+func listening(f *notifyDB) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.listeners) > 0
+}
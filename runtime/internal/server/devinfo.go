@@ -3,16 +3,19 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
 	"os"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/forge-lang/forge/runtime/internal/jobs"
 	"github.com/forge-lang/forge/runtime/internal/provider"
 )
 
@@ -115,6 +118,10 @@ func (s *Server) setupDevRoutes() {
 		r.Get("/access", s.handleDevAccess)
 		r.Get("/views", s.handleDevViews)
 		r.Get("/jobs", s.handleDevJobs)
+		r.Get("/jobs/dead", s.handleDevDeadJobs)
+		r.Get("/jobs/dead/{id}", s.handleDevDeadJob)
+		r.Post("/jobs/dead/{id}/replay", s.handleDevReplayDeadJob)
+		r.Delete("/jobs/dead/{id}", s.handleDevDiscardDeadJob)
 		r.Get("/webhooks", s.handleDevWebhooks)
 		r.Get("/messages", s.handleDevMessages)
 		r.Get("/database", s.handleDevDatabase)
@@ -523,7 +530,21 @@ func (s *Server) getRoutes() []RouteInfo {
 		})
 	}
 
-	// 5. Entities (sorted alphabetically, CRUD grouped per entity)
+	// 5. Imperatives (sorted alphabetically)
+	imperativeNames := make([]string, 0, len(s.artifact.Imperatives))
+	for name := range s.artifact.Imperatives {
+		imperativeNames = append(imperativeNames, name)
+	}
+	sort.Strings(imperativeNames)
+
+	for _, name := range imperativeNames {
+		routes = append(routes, RouteInfo{
+			Method: "POST", Path: "/api/imperative/" + name,
+			Handler: "imperative:" + name, Access: "read-only as caller", Category: "Imperatives",
+		})
+	}
+
+	// 6. Entities (sorted alphabetically, CRUD grouped per entity)
 	entityNames := make([]string, 0, len(s.artifact.Entities))
 	for name := range s.artifact.Entities {
 		entityNames = append(entityNames, name)
@@ -770,6 +791,105 @@ func (s *Server) handleDevJobs(w http.ResponseWriter, r *http.Request) {
 	s.respondDevJSON(w, data)
 }
 
+// handleDevDeadJobs lists jobs that exhausted their attempts
+func (s *Server) handleDevDeadJobs(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.deadLetters(w)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	dead, err := store.ListDead(r.Context(), limit)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, Message{Code: "QUERY_FAILED", Message: err.Error()})
+		return
+	}
+	if dead == nil {
+		dead = []*jobs.DeadJob{}
+	}
+
+	data := map[string]interface{}{"dead_jobs": dead, "count": len(dead)}
+	if wantsHTML(r) {
+		s.respondDevHTML(w, "Dead Jobs", data)
+		return
+	}
+
+	s.respondDevJSON(w, data)
+}
+
+// handleDevDeadJob returns one dead job with its error history
+func (s *Server) handleDevDeadJob(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.deadLetters(w)
+	if !ok {
+		return
+	}
+
+	dead, err := store.GetDead(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondDeadJobError(w, err)
+		return
+	}
+
+	if wantsHTML(r) {
+		s.respondDevHTML(w, "Dead Job "+dead.ID, dead)
+		return
+	}
+
+	s.respondDevJSON(w, dead)
+}
+
+// handleDevReplayDeadJob puts a dead job back on the queue
+func (s *Server) handleDevReplayDeadJob(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.deadLetters(w)
+	if !ok {
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if err := store.Replay(r.Context(), id); err != nil {
+		s.respondDeadJobError(w, err)
+		return
+	}
+
+	s.logger.Info("job.replayed", "job_id", id)
+	s.respondDevJSON(w, map[string]interface{}{"id": id, "status": "pending"})
+}
+
+// handleDevDiscardDeadJob deletes a dead job
+func (s *Server) handleDevDiscardDeadJob(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.deadLetters(w)
+	if !ok {
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if err := store.Discard(r.Context(), id); err != nil {
+		s.respondDeadJobError(w, err)
+		return
+	}
+
+	s.logger.Info("job.discarded", "job_id", id)
+	s.respondDevJSON(w, map[string]interface{}{"id": id, "status": "discarded"})
+}
+
+// deadLetters returns the executor's dead-letter store, responding 503 if
+// there is no executor.
+func (s *Server) deadLetters(w http.ResponseWriter) (jobs.DeadLetterStore, bool) {
+	if s.executor == nil {
+		s.respondError(w, http.StatusServiceUnavailable, Message{Code: "EXECUTOR_UNAVAILABLE", Message: "job executor is not running"})
+		return nil, false
+	}
+	return s.executor.DeadLetters(), true
+}
+
+func (s *Server) respondDeadJobError(w http.ResponseWriter, err error) {
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		s.respondError(w, http.StatusNotFound, Message{Code: "JOB_NOT_FOUND", Message: err.Error()})
+		return
+	}
+	s.respondError(w, http.StatusInternalServerError, Message{Code: "QUERY_FAILED", Message: err.Error()})
+}
+
 // handleDevWebhooks returns webhook definitions
 func (s *Server) handleDevWebhooks(w http.ResponseWriter, r *http.Request) {
 	if wantsHTML(r) {
@@ -4,6 +4,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -19,7 +20,12 @@ import (
 // getAuthenticatedDB returns a database scoped to the authenticated user.
 // This enables RLS policies to work correctly.
 func (s *Server) getAuthenticatedDB(r *http.Request) db.Database {
-	userID := getUserID(r)
+	return s.dbForUser(getUserID(r))
+}
+
+// dbForUser returns a database scoped to userID for RLS, or the pool when
+// userID is empty or not a UUID.
+func (s *Server) dbForUser(userID string) db.Database {
 	if userID != "" {
 		if uid, err := uuid.Parse(userID); err == nil {
 			return s.db.WithUser(uid)
@@ -118,6 +124,60 @@ func rowToMap(cols []db.FieldDescription, values []any) map[string]interface{} {
 	return record
 }
 
+// querier is the read side shared by db.Database and db.Tx.
+type querier interface {
+	Query(ctx context.Context, query string, args ...any) (db.Rows, error)
+}
+
+// queryRecord runs a query expected to return at most one row and converts
+// it to a map. It returns nil if no row matched. Rows are closed before
+// returning so the querier can be reused, which a transaction requires.
+func queryRecord(ctx context.Context, q querier, query string, args ...any) (map[string]interface{}, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	values, err := rows.Values()
+	if err != nil {
+		return nil, err
+	}
+	return rowToMap(rows.FieldDescriptions(), values), nil
+}
+
+// queryRecords runs a query and converts every row to a map. Like
+// queryRecord, it closes the rows before returning.
+func queryRecords(ctx context.Context, q querier, query string, args ...any) ([]map[string]interface{}, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols := rows.FieldDescriptions()
+	var records []map[string]interface{}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rowToMap(cols, values))
+	}
+	return records, rows.Err()
+}
+
+// errOrNoRows returns err, or an error describing an empty result.
+func errOrNoRows(err error) error {
+	if err != nil {
+		return err
+	}
+	return errors.New("no rows returned")
+}
+
 // handleList handles GET /api/entities/{entity}
 func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
 	entityName := chi.URLParam(r, "entity")
@@ -162,8 +222,15 @@ func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
 		// Convert to map with proper type conversion
 		results = append(results, rowToMap(cols, row))
 	}
+	rows.Close()
 
-	s.respond(w, http.StatusOK, results)
+	results, err = s.filterReadable(ctx, database, entity, results)
+	if err != nil {
+		s.respondActionError(w, accessEvaluationError(err))
+		return
+	}
+
+	s.respond(w, http.StatusOK, s.newFieldReader(ctx, database).records(entity, results))
 }
 
 // handleGet handles GET /api/entities/{entity}/{id}
@@ -227,8 +294,23 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 	// Convert to map with proper type conversion
 	cols := rows.FieldDescriptions()
 	record := rowToMap(cols, row)
+	rows.Close()
+
+	// Records the caller may not read are reported missing, as RLS would.
+	readable, err := s.canAccess(ctx, database, entity, "read", record)
+	if err != nil {
+		s.respondActionError(w, accessEvaluationError(err))
+		return
+	}
+	if !readable {
+		s.respondError(w, http.StatusNotFound, Message{
+			Code:    "NOT_FOUND",
+			Message: "Record not found",
+		})
+		return
+	}
 
-	s.respond(w, http.StatusOK, record)
+	s.respond(w, http.StatusOK, s.newFieldReader(ctx, database).record(entity, record))
 }
 
 // handleCreate handles POST /api/entities/{entity}
@@ -255,105 +337,18 @@ func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build INSERT query
-	columns := []string{}
-	placeholders := []string{}
-	values := []interface{}{}
-	i := 1
-
-	// Handle custom ID if provided
-	if customID, ok := input["id"]; ok {
-		columns = append(columns, "id")
-		placeholders = append(placeholders, fmt.Sprintf("$%d", i))
-		values = append(values, customID)
-		i++
-	}
-
-	for fieldName, field := range entity.Fields {
-		// Skip auto-generated fields (id is handled above if provided)
-		if fieldName == "id" || fieldName == "created_at" || fieldName == "updated_at" {
-			continue
-		}
-
-		if val, ok := input[fieldName]; ok {
-			columns = append(columns, fieldName)
-			placeholders = append(placeholders, fmt.Sprintf("$%d", i))
-			values = append(values, val)
-			i++
-		} else if field.Default == nil && !field.Nullable {
-			// Don't error for fields with defaults, let DB handle them
-		}
-	}
-
-	// Add relation foreign keys
-	for relName, rel := range entity.Relations {
-		fkName := rel.ForeignKey
-		if val, ok := input[relName]; ok {
-			columns = append(columns, fkName)
-			placeholders = append(placeholders, fmt.Sprintf("$%d", i))
-			values = append(values, val)
-			i++
-		} else if val, ok := input[fkName]; ok {
-			columns = append(columns, fkName)
-			placeholders = append(placeholders, fmt.Sprintf("$%d", i))
-			values = append(values, val)
-			i++
-		}
-	}
-
-	query := fmt.Sprintf(
-		"INSERT INTO %s (%s) VALUES (%s) RETURNING *",
-		entity.Table,
-		strings.Join(columns, ", "),
-		strings.Join(placeholders, ", "),
-	)
-
 	ctx := r.Context()
 	database := s.getAuthenticatedDB(r)
 
-	s.logger.Debug("executing insert", "entity", entityName, "query", query, "values", values)
-
-	rows, err := database.Query(ctx, query, values...)
-	if err != nil {
-		s.logger.Error("insert failed", "error", err, "entity", entityName, "query", query)
-		s.respondError(w, http.StatusInternalServerError, Message{
-			Code:    "INSERT_FAILED",
-			Message: fmt.Sprintf("Failed to create record: %v", err),
-		})
-		return
-	}
-	defer rows.Close()
-
-	if !rows.Next() {
-		s.logger.Error("insert returned no rows", "entity", entityName, "query", query)
-		s.respondError(w, http.StatusInternalServerError, Message{
-			Code:    "INSERT_FAILED",
-			Message: "Insert returned no rows",
-		})
-		return
-	}
-
-	row, err := rows.Values()
+	change, messages, err := s.writeEntity(ctx, database, entity, "create", input)
 	if err != nil {
-		s.logger.Error("row scan failed", "error", err)
-		s.respondError(w, http.StatusInternalServerError, Message{
-			Code:    "INSERT_FAILED",
-			Message: "Failed to read created record",
-		})
+		s.respondActionError(w, err)
 		return
 	}
+	record := change.Record
+	messages = append(messages, s.afterWrite(ctx, database, entity, change)...)
 
-	// Convert to map with proper type conversion
-	cols := rows.FieldDescriptions()
-	record := rowToMap(cols, row)
-
-	// Broadcast to subscribed clients
-	s.broadcastEntityChange(entityName, "create", record)
-
-	// Evaluate hooks (fire-and-forget)
-	s.evaluateHooks(entityName, "create", record)
-
-	s.respond(w, http.StatusCreated, record)
+	s.respondWithMessages(w, http.StatusCreated, s.newFieldReader(ctx, database).record(entity, record), messages)
 }
 
 // handleUpdate handles PUT /api/entities/{entity}/{id}
@@ -390,39 +385,13 @@ func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build UPDATE query
-	sets := []string{}
-	values := []interface{}{}
-	i := 1
-
-	for fieldName := range entity.Fields {
-		// Skip auto-generated fields
-		if fieldName == "id" || fieldName == "created_at" || fieldName == "updated_at" {
-			continue
-		}
-
-		if val, ok := input[fieldName]; ok {
-			sets = append(sets, fmt.Sprintf("%s = $%d", fieldName, i))
-			values = append(values, val)
-			i++
-		}
-	}
-
-	// Add relation foreign keys
-	for relName, rel := range entity.Relations {
-		fkName := rel.ForeignKey
-		if val, ok := input[relName]; ok {
-			sets = append(sets, fmt.Sprintf("%s = $%d", fkName, i))
-			values = append(values, val)
-			i++
-		} else if val, ok := input[fkName]; ok {
-			sets = append(sets, fmt.Sprintf("%s = $%d", fkName, i))
-			values = append(values, val)
-			i++
-		}
+	columns, err := s.writeColumns(entity, "update", input)
+	if err != nil {
+		s.respondActionError(w, err)
+		return
 	}
 
-	if len(sets) == 0 {
+	if len(columns) == 0 {
 		s.respondError(w, http.StatusBadRequest, Message{
 			Code:    "NO_FIELDS",
 			Message: "No fields to update",
@@ -430,56 +399,19 @@ func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	values = append(values, id)
-	query := fmt.Sprintf(
-		"UPDATE %s SET %s WHERE id = $%d RETURNING *",
-		entity.Table,
-		strings.Join(sets, ", "),
-		i,
-	)
-
 	ctx := r.Context()
 	database := s.getAuthenticatedDB(r)
-	rows, err := database.Query(ctx, query, values...)
-	if err != nil {
-		s.logger.Error("update failed", "error", err, "entity", entityName, "id", id)
-		s.respondError(w, http.StatusInternalServerError, Message{
-			Code:    "UPDATE_FAILED",
-			Message: "Failed to update record",
-		})
-		return
-	}
-	defer rows.Close()
-
-	if !rows.Next() {
-		s.respondError(w, http.StatusNotFound, Message{
-			Code:    "NOT_FOUND",
-			Message: "Record not found",
-		})
-		return
-	}
 
-	row, err := rows.Values()
+	input["id"] = id
+	change, messages, err := s.writeEntity(ctx, database, entity, "update", input)
 	if err != nil {
-		s.logger.Error("row scan failed", "error", err)
-		s.respondError(w, http.StatusInternalServerError, Message{
-			Code:    "UPDATE_FAILED",
-			Message: "Failed to read updated record",
-		})
+		s.respondActionError(w, err)
 		return
 	}
+	record := change.Record
+	messages = append(messages, s.afterWrite(ctx, database, entity, change)...)
 
-	// Convert to map with proper type conversion
-	cols := rows.FieldDescriptions()
-	record := rowToMap(cols, row)
-
-	// Broadcast to subscribed clients
-	s.broadcastEntityChange(entityName, "update", record)
-
-	// Evaluate hooks (fire-and-forget)
-	s.evaluateHooks(entityName, "update", record)
-
-	s.respond(w, http.StatusOK, record)
+	s.respondWithMessages(w, http.StatusOK, s.newFieldReader(ctx, database).record(entity, record), messages)
 }
 
 // handleDelete handles DELETE /api/entities/{entity}/{id}
@@ -506,35 +438,93 @@ func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", entity.Table)
-
 	ctx := r.Context()
 	database := s.getAuthenticatedDB(r)
-	result, err := database.Exec(ctx, query, id)
+
+	change, messages, err := s.writeEntity(ctx, database, entity, "delete", map[string]interface{}{"id": id})
 	if err != nil {
-		s.logger.Error("delete failed", "error", err, "entity", entityName, "id", id)
-		s.respondError(w, http.StatusInternalServerError, Message{
-			Code:    "DELETE_FAILED",
-			Message: "Failed to delete record",
-		})
+		s.respondActionError(w, err)
 		return
 	}
+	messages = append(messages, s.afterWrite(ctx, database, entity, change)...)
 
-	if result.RowsAffected() == 0 {
-		s.respondError(w, http.StatusNotFound, Message{
-			Code:    "NOT_FOUND",
-			Message: "Record not found",
-		})
-		return
+	s.respondWithMessages(w, http.StatusOK, nil, messages)
+}
+
+// writeEntity creates, updates or deletes a record of entity for an action or
+// the entity endpoints. The before-hooks, rules and write access checks and
+// the write run in one transaction scoped to the user, and it returns the
+// change and the messages emitted by hooks once committed. A durable job
+// queue shares the transaction, so jobs are never emitted for a write that
+// rolls back.
+func (s *Server) writeEntity(ctx context.Context, database db.Database, entity *EntitySchema, operation string, input map[string]interface{}) (*entityChange, []Message, error) {
+	tx, err := database.Begin(ctx)
+	if err != nil {
+		return nil, nil, &actionError{
+			Status:  http.StatusInternalServerError,
+			Message: Message{Code: "TRANSACTION_FAILED", Message: "Failed to start transaction"},
+			Err:     err,
+		}
 	}
+	// Rollback is a no-op once the transaction has committed.
+	defer tx.Rollback(ctx)
 
-	// Broadcast to subscribed clients
-	s.broadcastEntityChange(entityName, "delete", map[string]interface{}{"id": id})
+	change := &entityChange{Entity: entity.Name, Operation: operation}
+	var messages []Message
+	switch operation {
+	case "create":
+		change.Record, messages, err = s.executeCreateAction(ctx, tx, entity, input)
+	case "update":
+		change.Record, change.Previous, messages, err = s.executeUpdateAction(ctx, tx, entity, input, input)
+	case "delete":
+		change.Record, change.Previous, messages, err = s.executeDeleteAction(ctx, tx, entity, input)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s.durableJobs() {
+		if err := s.enqueueHookJobs(ctx, tx, entity.Name, operation, change.Record); err != nil {
+			return nil, nil, &actionError{
+				Status:  http.StatusInternalServerError,
+				Message: Message{Code: "JOB_ENQUEUE_FAILED", Message: "Failed to enqueue jobs"},
+				Err:     err,
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, &actionError{
+			Status:  http.StatusInternalServerError,
+			Message: Message{Code: "TRANSACTION_FAILED", Message: "Failed to commit transaction"},
+			Err:     fmt.Errorf("%s %s: %w", operation, entity.Name, err),
+		}
+	}
+	return change, messages, nil
+}
 
-	// Evaluate hooks (fire-and-forget)
-	s.evaluateHooks(entityName, "delete", map[string]interface{}{"id": id})
+// afterWrite follows a committed write: it broadcasts change, enqueues the
+// hook jobs unless writeEntity enqueued them in its transaction, and runs
+// the after-hook steps. It returns the messages those steps emit; failures
+// are logged since the write can no longer be rejected.
+func (s *Server) afterWrite(ctx context.Context, database db.Database, entity *EntitySchema, change *entityChange) []Message {
+	s.broadcastChange(change)
 
-	s.respond(w, http.StatusOK, nil)
+	if !s.durableJobs() {
+		s.evaluateHooks(entity.Name, change.Operation, change.Record)
+	}
+
+	emitted, err := s.runHookSteps(ctx, database, entity, "after", change.Operation, change.Record, nil)
+	if err != nil {
+		s.logger.Error("hook.emit_failed", "entity", entity.Name, "operation", change.Operation, "error", err)
+	}
+	return emitted
+}
+
+// durableJobs reports whether hook jobs are enqueued in the transaction of
+// the write that triggers them.
+func (s *Server) durableJobs() bool {
+	return s.executor != nil && s.executor.Durable()
 }
 
 // handleView handles GET /api/views/{view}
@@ -550,9 +540,14 @@ func (s *Server) handleView(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	if view.Presence {
+		s.handlePresenceView(w, r, view)
+		return
+	}
 
 	// Convert to query schema
-	qs := viewToQuerySchema(view)
+	qs, source := s.viewQuerySchema(view)
+	checkRead := source != nil
 
 	// Build the query from schema + request params
 	qr, err := query.Build(qs, r)
@@ -573,8 +568,16 @@ func (s *Server) handleView(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 	database := s.getAuthenticatedDB(r)
-	rows, err := database.Query(ctx, qr.SQL, qr.Args...)
+	results, err := queryRecords(ctx, database, qr.SQL, qr.Args...)
+	if err == nil && checkRead {
+		results, err = s.readableViewPage(ctx, database, qs, r, qr, source, results)
+	}
 	if err != nil {
+		var aerr *actionError
+		if errors.As(err, &aerr) {
+			s.respondActionError(w, err)
+			return
+		}
 		s.logger.Error("view query failed", "error", err, "view", viewName, "query", qr.SQL, "args", qr.Args)
 		s.respondError(w, http.StatusInternalServerError, Message{
 			Code:    "QUERY_FAILED",
@@ -582,19 +585,6 @@ func (s *Server) handleView(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	defer rows.Close()
-
-	// Collect results
-	cols := rows.FieldDescriptions()
-	var results []map[string]interface{}
-	for rows.Next() {
-		row, err := rows.Values()
-		if err != nil {
-			s.logger.Error("row scan failed", "error", err)
-			continue
-		}
-		results = append(results, rowToMap(cols, row))
-	}
 
 	// Trim to limit and detect has_next
 	hasNext := len(results) > qr.Limit
@@ -611,9 +601,10 @@ func (s *Server) handleView(w http.ResponseWriter, r *http.Request) {
 
 	hasPrev := r.URL.Query().Get("cursor") != ""
 
-	// Optional count query
+	// Optional count query. The count cannot apply a read rule, so it is
+	// left out rather than reveal how many rows the caller cannot read.
 	var total *int
-	if r.URL.Query().Get("include") == "count" {
+	if r.URL.Query().Get("include") == "count" && !checkRead {
 		countResult, countErr := query.BuildCount(qs, r)
 		if countErr == nil {
 			var count int
@@ -628,6 +619,7 @@ func (s *Server) handleView(w http.ResponseWriter, r *http.Request) {
 	if results == nil {
 		results = []map[string]interface{}{}
 	}
+	results = s.newFieldReader(ctx, database).viewRows(view, results)
 
 	// Return structured response: { items, pagination }
 	s.respond(w, http.StatusOK, map[string]interface{}{
@@ -642,6 +634,42 @@ func (s *Server) handleView(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// readableViewPage filters the rows of a view query to those whose source
+// row the caller may read. Read rules are evaluated after the query, so
+// while the rows kept do not fill the page and more follow, the next rows
+// are queried after the last one seen. Like batch, the result holds one row
+// more than the page when a next page exists.
+func (s *Server) readableViewPage(ctx context.Context, database db.Database, qs *query.ViewSchema, r *http.Request, qr *query.QueryResult, source *EntitySchema, batch []map[string]interface{}) ([]map[string]interface{}, error) {
+	var page []map[string]interface{}
+	for {
+		exhausted := len(batch) <= qr.Limit
+		var last map[string]interface{}
+		if len(batch) > 0 {
+			last = batch[len(batch)-1]
+		}
+
+		readable, err := s.filterReadableViewRows(ctx, database, source, batch)
+		if err != nil {
+			return nil, accessEvaluationError(err)
+		}
+		page = append(page, readable...)
+		if len(page) > qr.Limit || exhausted {
+			return page, nil
+		}
+
+		next := r.Clone(ctx)
+		params := next.URL.Query()
+		params.Set("cursor", query.EncodeCursor(last, qr.Sorts))
+		next.URL.RawQuery = params.Encode()
+		if qr, err = query.Build(qs, next); err != nil {
+			return nil, err
+		}
+		if batch, err = queryRecords(ctx, database, qr.SQL, qr.Args...); err != nil {
+			return nil, err
+		}
+	}
+}
+
 // viewToQuerySchema converts a runtime ViewSchema to a query.ViewSchema.
 func viewToQuerySchema(view *ViewSchema) *query.ViewSchema {
 	qs := &query.ViewSchema{
@@ -677,7 +705,59 @@ func viewToQuerySchema(view *ViewSchema) *query.ViewSchema {
 	return qs
 }
 
-// handleAction handles POST /api/actions/{action}
+// actionError is a failed action step, carrying the HTTP status and message
+// to return. Err holds the underlying cause for logging.
+type actionError struct {
+	Status  int
+	Message Message
+	Err     error
+}
+
+func (e *actionError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message.Code, e.Err)
+	}
+	return e.Message.Code
+}
+
+func (e *actionError) Unwrap() error { return e.Err }
+
+// respondActionError writes the response for an error returned by an action
+// step, a rule check, a before-hook or the write policy of an entity.
+func (s *Server) respondActionError(w http.ResponseWriter, err error) {
+	var violation *RuleViolation
+	if errors.As(err, &violation) {
+		s.respondError(w, http.StatusUnprocessableEntity, violation.Message)
+		return
+	}
+
+	var werr *writeError
+	if errors.As(err, &werr) {
+		s.respondError(w, http.StatusBadRequest, werr.Messages...)
+		return
+	}
+
+	var aerr *actionError
+	if errors.As(err, &aerr) {
+		if aerr.Err != nil {
+			s.logger.Error("action step failed", "code", aerr.Message.Code, "error", aerr.Err)
+		}
+		s.respondError(w, aerr.Status, aerr.Message)
+		return
+	}
+
+	s.logger.Error("action failed", "error", err)
+	s.respondError(w, http.StatusInternalServerError, Message{
+		Code:    "INTERNAL_ERROR",
+		Message: "Action failed",
+	})
+}
+
+// handleAction handles POST /api/actions/{action}.
+//
+// Rule checks and the mutation run in a single transaction scoped to the
+// authenticated user. Broadcasts and after-hooks only fire once the
+// transaction has committed, so clients never see rolled-back writes.
 func (s *Server) handleAction(w http.ResponseWriter, r *http.Request) {
 	actionName := chi.URLParam(r, "action")
 	artifact := s.getArtifact()
@@ -703,6 +783,11 @@ func (s *Server) handleAction(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Info("action.started", "action", actionName, "input", input)
 
+	if action.hasSteps() {
+		s.handleStepAction(w, r, action, input)
+		return
+	}
+
 	// Get the entity for this action
 	entity, ok := artifact.Entities[action.InputEntity]
 	if !ok {
@@ -713,357 +798,366 @@ func (s *Server) handleAction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
-	database := s.getAuthenticatedDB(r)
-
-	// Auto-populate owner_id/author_id from authenticated user for create actions
-	userID := getUserID(r)
-	if userID != "" && action.Operation == "create" {
-		// Set common user ID fields if not already provided
-		for _, fieldName := range []string{"owner_id", "author_id", "user_id", "created_by"} {
-			if _, exists := entity.Fields[fieldName]; exists {
-				if _, provided := input[fieldName]; !provided {
-					input[fieldName] = userID
-				}
-			}
-		}
-	}
-
-	// Execute action based on operation type from action schema
 	switch action.Operation {
-	case "create":
-		s.executeCreateAction(ctx, w, database, entity, input)
-
-	case "update":
-		s.executeUpdateAction(ctx, w, database, entity, input, input)
-
-	case "delete":
-		s.executeDeleteAction(ctx, w, database, entity, input)
-
+	case "create", "update", "delete":
 	default:
 		// No operation type specified - log and acknowledge
 		s.logger.Info("action.completed", "action", actionName)
 		s.respond(w, http.StatusOK, map[string]string{
 			"message": fmt.Sprintf("action %s executed", actionName),
 		})
+		return
 	}
-}
 
-func (s *Server) executeCreateAction(ctx context.Context, w http.ResponseWriter, database db.Database, entity *EntitySchema, input map[string]interface{}) {
-	// Build INSERT query
-	columns := []string{}
-	placeholders := []string{}
-	values := []interface{}{}
-	i := 1
+	ctx := r.Context()
+	database := s.getAuthenticatedDB(r)
 
-	// Handle custom ID if provided
-	if customID, ok := input["id"]; ok {
-		columns = append(columns, "id")
-		placeholders = append(placeholders, fmt.Sprintf("$%d", i))
-		values = append(values, customID)
-		i++
+	// Auto-populate owner_id/author_id from authenticated user for create actions
+	if action.Operation == "create" {
+		populateUserFields(entity, input, getUserID(r))
 	}
 
-	for fieldName, field := range entity.Fields {
-		// Skip auto-generated fields (id is handled above if provided)
-		if fieldName == "id" || fieldName == "created_at" || fieldName == "updated_at" {
-			continue
-		}
-
-		if val, ok := input[fieldName]; ok {
-			columns = append(columns, fieldName)
-			placeholders = append(placeholders, fmt.Sprintf("$%d", i))
-			values = append(values, val)
-			i++
-		} else if field.Default == nil && !field.Nullable {
-			// Skip - let database handle defaults
-		}
+	// The transaction sets app.user_id when database is user-scoped.
+	change, messages, err := s.writeEntity(ctx, database, entity, action.Operation, input)
+	if err != nil {
+		s.logger.Info("action.rolled_back", "action", actionName, "error", err)
+		s.respondActionError(w, err)
+		return
 	}
+	record := change.Record
+	s.logger.Info("action.committed", "action", actionName, "entity", entity.Name, "operation", action.Operation)
 
-	// Add relation foreign keys
-	for relName, rel := range entity.Relations {
-		fkName := rel.ForeignKey
-		if val, ok := input[relName]; ok {
-			columns = append(columns, fkName)
-			placeholders = append(placeholders, fmt.Sprintf("$%d", i))
-			values = append(values, val)
-			i++
-		} else if val, ok := input[fkName]; ok {
-			columns = append(columns, fkName)
-			placeholders = append(placeholders, fmt.Sprintf("$%d", i))
-			values = append(values, val)
-			i++
-		}
+	messages = append(messages, s.afterWrite(ctx, database, entity, change)...)
+
+	// The response carries the fields the caller may read
+	switch action.Operation {
+	case "create":
+		s.respondWithMessages(w, http.StatusCreated, s.newFieldReader(ctx, database).record(entity, record), messages)
+	case "delete":
+		s.respondWithMessages(w, http.StatusOK, map[string]interface{}{
+			"deleted": true,
+			"id":      record["id"],
+		}, messages)
+	default:
+		s.respondWithMessages(w, http.StatusOK, s.newFieldReader(ctx, database).record(entity, record), messages)
 	}
+}
 
-	if len(columns) == 0 {
-		s.respondError(w, http.StatusBadRequest, Message{
-			Code:    "NO_FIELDS",
-			Message: "No fields provided",
-		})
+// populateUserFields sets the common user ID fields of entity, such as
+// owner_id and author_id, to userID when input does not provide them.
+func populateUserFields(entity *EntitySchema, input map[string]interface{}, userID string) {
+	if userID == "" {
 		return
 	}
+	for _, fieldName := range []string{"owner_id", "author_id", "user_id", "created_by"} {
+		if _, exists := entity.Fields[fieldName]; exists {
+			if _, provided := input[fieldName]; !provided {
+				input[fieldName] = userID
+			}
+		}
+	}
+}
 
-	query := fmt.Sprintf(
-		"INSERT INTO %s (%s) VALUES (%s) RETURNING *",
-		entity.Table,
-		strings.Join(columns, ", "),
-		strings.Join(placeholders, ", "),
-	)
-
-	rows, err := database.Query(ctx, query, values...)
+// executeCreateAction checks input against the write policy of entity, runs
+// before_create hooks, checks create rules and write access and inserts the
+// record within tx. It returns the messages emitted by hooks.
+func (s *Server) executeCreateAction(ctx context.Context, tx db.Tx, entity *EntitySchema, input map[string]interface{}) (map[string]interface{}, []Message, error) {
+	if _, err := s.writeColumns(entity, "create", input); err != nil {
+		return nil, nil, err
+	}
+	proposed := proposedRecord(entity, input)
+	messages, err := s.runHookSteps(ctx, tx, entity, "before", "create", proposed, input)
 	if err != nil {
-		s.logger.Error("insert failed", "error", err, "entity", entity.Name)
-		s.respondError(w, http.StatusInternalServerError, Message{
-			Code:    "INSERT_FAILED",
-			Message: "Failed to create record",
-		})
-		return
+		return nil, nil, err
 	}
-	defer rows.Close()
-
-	if !rows.Next() {
-		s.respondError(w, http.StatusInternalServerError, Message{
-			Code:    "INSERT_FAILED",
-			Message: "Failed to create record",
-		})
-		return
+	if err := s.evaluateRules(ctx, tx, entity, "create", proposed, input); err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkWriteAccess(ctx, tx, entity, proposed); err != nil {
+		return nil, nil, err
 	}
 
-	row, err := rows.Values()
+	// Fields set by hooks are checked like the input
+	columns, err := s.writeColumns(entity, "create", input)
 	if err != nil {
-		s.logger.Error("row scan failed", "error", err)
-		s.respondError(w, http.StatusInternalServerError, Message{
-			Code:    "INSERT_FAILED",
-			Message: "Failed to read created record",
-		})
-		return
+		return nil, nil, err
+	}
+	if len(columns) == 0 {
+		return nil, nil, &actionError{
+			Status:  http.StatusBadRequest,
+			Message: Message{Code: "NO_FIELDS", Message: "No fields provided"},
+		}
 	}
+	query, values := insertQuery(entity.Table, columns)
 
-	// Convert to map with proper type conversion
-	cols := rows.FieldDescriptions()
-	record := rowToMap(cols, row)
+	record, err := queryRecord(ctx, tx, query, values...)
+	if err != nil || record == nil {
+		return nil, nil, &actionError{
+			Status:  http.StatusInternalServerError,
+			Message: Message{Code: "INSERT_FAILED", Message: "Failed to create record"},
+			Err:     fmt.Errorf("insert into %s: %w", entity.Table, errOrNoRows(err)),
+		}
+	}
+	return record, messages, nil
+}
 
-	// Broadcast to subscribed clients
-	s.broadcastEntityChange(entity.Name, "create", record)
+// broadcastEntityChange broadcasts entity changes to WebSocket subscribers
+// on every replica
+func (s *Server) broadcastEntityChange(entityName, operation string, record map[string]interface{}) {
+	s.broadcastChange(&entityChange{Entity: entityName, Operation: operation, Record: record})
+}
 
-	// Evaluate hooks (fire-and-forget)
-	s.evaluateHooks(entity.Name, "create", record)
+// broadcastChange broadcasts change to WebSocket subscribers on every
+// replica. Access checks and view queries run after it returns, so they do
+// not hold up the request.
+func (s *Server) broadcastChange(change *entityChange) {
+	s.changePushes.run(func() { s.pushEntityChange(change) })
 
-	s.respond(w, http.StatusCreated, record)
+	// Other replicas load the row, check access and query views for their
+	// own subscribers
+	s.hub.Relay(entityChangeTopic, s.relayedChange(change))
 }
 
-// broadcastEntityChange broadcasts entity changes to WebSocket subscribers
-func (s *Server) broadcastEntityChange(entityName, operation string, record map[string]interface{}) {
+// pushEntityChange pushes an entity change to the WebSocket subscribers of
+// this replica
+func (s *Server) pushEntityChange(change *entityChange) {
+	entityName, operation, record := change.Entity, change.Operation, change.Record
 	s.logger.Info("[BROADCAST] Entity change", "entity", entityName, "operation", operation)
 
+	// Only subscribers who may read the record receive it
+	allow := s.readableBy(entityName, operation, record)
+
 	// Broadcast to entity-specific subscribers (e.g., "Message:create")
-	s.hub.BroadcastToView(fmt.Sprintf("%s:%s", entityName, operation), record)
-
-	// For Messages, also broadcast to channel-specific feed
-	if entityName == "Message" {
-		channelID := getStringField(record, "channel_id")
-		if channelID != "" {
-			viewKey := fmt.Sprintf("MessageFeed:%s", channelID)
-			s.logger.Info("[BROADCAST] Broadcasting to MessageFeed", "viewKey", viewKey)
-			s.hub.BroadcastToView(viewKey, record)
-		} else {
-			s.logger.Warn("[BROADCAST] Message missing channel_id", "record", record)
-		}
-	}
+	s.pushRecord(fmt.Sprintf("%s:%s", entityName, operation), entityName, record, allow)
 
-	// For Threads, broadcast to parent message thread list AND trigger message feed refresh
-	if entityName == "Thread" {
-		parentID := getStringField(record, "parent_id")
-		if parentID != "" {
-			viewKey := fmt.Sprintf("ThreadList:%s", parentID)
-			s.logger.Info("[BROADCAST] Broadcasting to ThreadList", "viewKey", viewKey)
-			s.hub.BroadcastToView(viewKey, record)
+	// Invalidate the views that depend on the entity
+	s.pushViewChanges(change, allow)
+}
 
-			// Also need to refresh the message feed to update thread counts
-			// Get the parent message to find its channel
-			ctx := context.Background()
-			query := "SELECT channel_id FROM messages WHERE id = $1"
-			rows, err := s.db.Query(ctx, query, parentID)
-			if err == nil {
-				defer rows.Close()
-				if rows.Next() {
-					values, err := rows.Values()
-					if err == nil && len(values) > 0 {
-						channelID := fmt.Sprintf("%v", convertValue(values[0]))
-						if channelID != "" && channelID != "<nil>" {
-							viewKey := fmt.Sprintf("MessageFeed:%s", channelID)
-							s.logger.Info("[BROADCAST] Broadcasting Thread to MessageFeed", "viewKey", viewKey)
-							s.hub.BroadcastToView(viewKey, record)
-						}
-					}
-				}
-			} else {
-				s.logger.Error("[BROADCAST] Failed to get parent message channel", "error", err)
-			}
-		} else {
-			s.logger.Warn("[BROADCAST] Thread missing parent_id", "record", record)
-		}
+// readableBy returns a filter passing the WebSocket clients whose user may
+// read record, or nil when the entity has no read rule. Deletes carry only
+// the id and go to every subscriber. Each user is checked once.
+func (s *Server) readableBy(entityName, operation string, record map[string]interface{}) func(*Client) bool {
+	entity, ok := s.getArtifact().Entities[entityName]
+	if !ok || operation == "delete" || !s.hasAccessRule(entity, "read") {
+		return nil
 	}
 
-	// For Channels, broadcast to workspace-specific list
-	if entityName == "Channel" {
-		workspaceID := getStringField(record, "workspace_id")
-		if workspaceID != "" {
-			viewKey := fmt.Sprintf("ChannelList:%s", workspaceID)
-			s.logger.Info("[BROADCAST] Broadcasting to ChannelList", "viewKey", viewKey)
-			s.hub.BroadcastToView(viewKey, record)
+	decided := make(map[string]bool)
+	return func(c *Client) bool {
+		userID := c.UserID()
+		if allowed, ok := decided[userID]; ok {
+			return allowed
 		}
-	}
-}
-
-// getStringField safely extracts a string field from a record
-func getStringField(record map[string]interface{}, field string) string {
-	if v, ok := record[field]; ok {
-		if s, ok := v.(string); ok {
-			return s
+		ctx := context.WithValue(context.Background(), userContextKey{}, userID)
+		allowed, err := s.canAccess(ctx, s.db, entity, "read", record)
+		if err != nil {
+			s.logger.Error("[BROADCAST] access check failed", "entity", entityName, "error", err)
 		}
-		// Handle other types by converting to string
-		return fmt.Sprintf("%v", v)
+		decided[userID] = allowed
+		return allowed
 	}
-	return ""
 }
 
-func (s *Server) executeUpdateAction(ctx context.Context, w http.ResponseWriter, database db.Database, entity *EntitySchema, input map[string]interface{}, updates map[string]interface{}) {
-	// Get ID from input
-	id, ok := input["id"]
-	if !ok {
-		s.respondError(w, http.StatusBadRequest, Message{
-			Code:    "MISSING_ID",
-			Message: "id is required",
-		})
-		return
-	}
-
-	// Validate UUID
-	idStr := fmt.Sprintf("%v", id)
-	if _, err := uuid.Parse(idStr); err != nil {
-		s.respondError(w, http.StatusBadRequest, Message{
-			Code:    "INVALID_ID",
-			Message: "Invalid UUID format",
-		})
+// pushRecord sends record to the subscribers of key that allow passes. When
+// key names a view over the record's entity, as "TicketsByAuthor:<author_id>"
+// does, only the view's fields are sent. A field with a read condition is
+// sent only to the users it holds for.
+func (s *Server) pushRecord(key, entityName string, record map[string]interface{}, allow func(*Client) bool) {
+	projected := s.projectRecord(key, entityName, record)
+	conditions := s.readConditions(key, entityName)
+	if len(conditions) == 0 {
+		s.hub.BroadcastToViewFunc(key, projected, allow)
 		return
 	}
 
-	// Build UPDATE query
-	sets := []string{}
-	values := []interface{}{}
-	i := 1
+	byUser := make(map[string]*WSMessage)
+	s.hub.SendToView(key, func(c *Client) *WSMessage {
+		if allow != nil && !allow(c) {
+			return nil
+		}
+		userID := c.UserID()
+		if msg, ok := byUser[userID]; ok {
+			return msg
+		}
+		fr := s.newFieldReader(context.WithValue(context.Background(), userContextKey{}, userID), s.db)
+		var denied []string
+		for name, condition := range conditions {
+			if !fr.canRead(condition) {
+				denied = append(denied, name)
+			}
+		}
+		byUser[userID] = &WSMessage{Type: "data", View: key, Data: without(projected, denied)}
+		return byUser[userID]
+	})
+}
 
-	for fieldName, val := range updates {
-		sets = append(sets, fmt.Sprintf("%s = $%d", fieldName, i))
-		values = append(values, val)
-		i++
+// projectRecord returns the part of record pushed to subscribers of key: the
+// view's source fields and the id for a view, otherwise the record without
+// its hidden fields. Joined view fields are not part of the record and are
+// left out.
+func (s *Server) projectRecord(key, entityName string, record map[string]interface{}) map[string]interface{} {
+	artifact := s.getArtifact()
+	viewName, _, _ := strings.Cut(key, ":")
+	if view, ok := artifact.Views[viewName]; ok && view.Source == entityName {
+		projected := map[string]interface{}{"id": record["id"]}
+		for _, f := range view.Fields {
+			column, ok := strings.CutPrefix(f.Column, "t.")
+			if !ok {
+				continue
+			}
+			if v, ok := record[column]; ok {
+				projected[f.Alias] = v
+			}
+		}
+		return projected
 	}
 
-	values = append(values, idStr)
-	query := fmt.Sprintf(
-		"UPDATE %s SET %s WHERE id = $%d RETURNING *",
-		entity.Table,
-		strings.Join(sets, ", "),
-		i,
-	)
+	entity, ok := artifact.Entities[entityName]
+	if !ok {
+		return record
+	}
+	return without(record, s.hiddenFields(entity))
+}
 
-	rows, err := database.Query(ctx, query, values...)
+// executeUpdateAction checks updates against the write policy of entity, runs
+// before_update hooks, checks update rules and write access against the
+// stored row and applies updates within tx. Fields set by hooks are written to
+// updates. It returns the updated record, the stored row it replaced if it
+// was loaded, and the messages emitted by hooks.
+func (s *Server) executeUpdateAction(ctx context.Context, tx db.Tx, entity *EntitySchema, input map[string]interface{}, updates map[string]interface{}) (map[string]interface{}, map[string]interface{}, []Message, error) {
+	idStr, err := actionRecordID(input)
 	if err != nil {
-		s.logger.Error("update failed", "error", err, "entity", entity.Name, "id", idStr)
-		s.respondError(w, http.StatusInternalServerError, Message{
-			Code:    "UPDATE_FAILED",
-			Message: "Failed to update record",
-		})
-		return
+		return nil, nil, nil, err
 	}
-	defer rows.Close()
 
-	if !rows.Next() {
-		s.respondError(w, http.StatusNotFound, Message{
-			Code:    "NOT_FOUND",
-			Message: "Record not found",
-		})
-		return
+	if _, err := s.writeColumns(entity, "update", updates); err != nil {
+		return nil, nil, nil, err
 	}
 
-	row, err := rows.Values()
+	current, err := s.loadStoredRow(ctx, tx, entity, "update", idStr)
 	if err != nil {
-		s.logger.Error("row scan failed", "error", err)
-		s.respondError(w, http.StatusInternalServerError, Message{
-			Code:    "UPDATE_FAILED",
-			Message: "Failed to read updated record",
-		})
-		return
+		return nil, nil, nil, err
+	}
+	messages, err := s.runHookSteps(ctx, tx, entity, "before", "update", current, updates)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := s.evaluateRules(ctx, tx, entity, "update", current, input); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := s.checkWriteAccess(ctx, tx, entity, current, mergedRecord(entity, current, updates)); err != nil {
+		return nil, nil, nil, err
 	}
 
-	// Convert to map with proper type conversion
-	cols := rows.FieldDescriptions()
-	record := rowToMap(cols, row)
-
-	// Broadcast to subscribed clients
-	s.broadcastEntityChange(entity.Name, "update", record)
-
-	// Evaluate hooks (fire-and-forget)
-	s.evaluateHooks(entity.Name, "update", record)
+	// Fields set by hooks are checked like the input
+	columns, err := s.writeColumns(entity, "update", updates)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(columns) == 0 {
+		// Nothing to write; the stored row is the updated record
+		if current == nil {
+			current, err = loadRow(ctx, tx, entity.Table, idStr)
+			if err != nil {
+				return nil, nil, nil, &actionError{
+					Status:  http.StatusInternalServerError,
+					Message: Message{Code: "QUERY_FAILED", Message: "Failed to load record"},
+					Err:     fmt.Errorf("loading %s %s: %w", entity.Name, idStr, err),
+				}
+			}
+		}
+		if current == nil {
+			return nil, nil, nil, &actionError{
+				Status:  http.StatusNotFound,
+				Message: Message{Code: "NOT_FOUND", Message: "Record not found"},
+			}
+		}
+		return current, current, messages, nil
+	}
+	query, values := updateQuery(entity.Table, columns, idStr)
 
-	s.respond(w, http.StatusOK, record)
+	record, err := queryRecord(ctx, tx, query, values...)
+	if err != nil {
+		return nil, nil, nil, &actionError{
+			Status:  http.StatusInternalServerError,
+			Message: Message{Code: "UPDATE_FAILED", Message: "Failed to update record"},
+			Err:     fmt.Errorf("update %s %s: %w", entity.Table, idStr, err),
+		}
+	}
+	if record == nil {
+		return nil, nil, nil, &actionError{
+			Status:  http.StatusNotFound,
+			Message: Message{Code: "NOT_FOUND", Message: "Record not found"},
+		}
+	}
+	return record, current, messages, nil
 }
 
-func (s *Server) executeDeleteAction(ctx context.Context, w http.ResponseWriter, database db.Database, entity *EntitySchema, input map[string]interface{}) {
-	// Get ID from input
-	id, ok := input["id"]
-	if !ok {
-		s.respondError(w, http.StatusBadRequest, Message{
-			Code:    "MISSING_ID",
-			Message: "id is required",
-		})
-		return
+// executeDeleteAction runs before_delete hooks, checks delete rules and write
+// access against the stored row and deletes it within tx. It returns the id
+// of the deleted record, the stored row if it was loaded, and the messages
+// emitted by hooks.
+func (s *Server) executeDeleteAction(ctx context.Context, tx db.Tx, entity *EntitySchema, input map[string]interface{}) (map[string]interface{}, map[string]interface{}, []Message, error) {
+	idStr, err := actionRecordID(input)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
-	// Validate UUID
-	idStr := fmt.Sprintf("%v", id)
-	if _, err := uuid.Parse(idStr); err != nil {
-		s.respondError(w, http.StatusBadRequest, Message{
-			Code:    "INVALID_ID",
-			Message: "Invalid UUID format",
-		})
-		return
+	current, err := s.loadStoredRow(ctx, tx, entity, "delete", idStr)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	messages, err := s.runHookSteps(ctx, tx, entity, "before", "delete", current, input)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := s.evaluateRules(ctx, tx, entity, "delete", current, input); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := s.checkWriteAccess(ctx, tx, entity, current); err != nil {
+		return nil, nil, nil, err
 	}
 
 	// Build DELETE query
 	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1 RETURNING id", entity.Table)
 
-	rows, err := database.Query(ctx, query, idStr)
+	deleted, err := queryRecord(ctx, tx, query, idStr)
 	if err != nil {
-		s.logger.Error("delete failed", "error", err, "entity", entity.Name, "id", idStr)
-		s.respondError(w, http.StatusInternalServerError, Message{
-			Code:    "DELETE_FAILED",
-			Message: "Failed to delete record",
-		})
-		return
+		return nil, nil, nil, &actionError{
+			Status:  http.StatusInternalServerError,
+			Message: Message{Code: "DELETE_FAILED", Message: "Failed to delete record"},
+			Err:     fmt.Errorf("delete %s %s: %w", entity.Table, idStr, err),
+		}
 	}
-	defer rows.Close()
-
-	if !rows.Next() {
-		s.respondError(w, http.StatusNotFound, Message{
-			Code:    "NOT_FOUND",
-			Message: "Record not found",
-		})
-		return
+	if deleted == nil {
+		return nil, nil, nil, &actionError{
+			Status:  http.StatusNotFound,
+			Message: Message{Code: "NOT_FOUND", Message: "Record not found"},
+		}
 	}
+	return map[string]interface{}{"id": idStr}, current, messages, nil
+}
 
-	// Broadcast deletion
-	s.broadcastEntityChange(entity.Name, "delete", map[string]interface{}{"id": idStr})
-
-	// Evaluate hooks (fire-and-forget)
-	s.evaluateHooks(entity.Name, "delete", map[string]interface{}{"id": idStr})
+// actionRecordID extracts and validates the id of the record an update or
+// delete action targets.
+func actionRecordID(input map[string]interface{}) (string, error) {
+	id, ok := input["id"]
+	if !ok {
+		return "", &actionError{
+			Status:  http.StatusBadRequest,
+			Message: Message{Code: "MISSING_ID", Message: "id is required"},
+		}
+	}
 
-	s.respond(w, http.StatusOK, map[string]interface{}{
-		"deleted": true,
-		"id":      idStr,
-	})
+	idStr := fmt.Sprintf("%v", id)
+	if _, err := uuid.Parse(idStr); err != nil {
+		return "", &actionError{
+			Status:  http.StatusBadRequest,
+			Message: Message{Code: "INVALID_ID", Message: "Invalid UUID format"},
+		}
+	}
+	return idStr, nil
 }
 
 // handleWebhook handles incoming webhook requests from external services.
@@ -1146,9 +1240,9 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	)
 
 	// Execute the action with normalized webhook data
-	// Note: Webhooks don't have user context - they run with system privileges
-	// but still go through the normal action pipeline (rules are evaluated)
-	ctx := r.Context()
+	// Note: Webhooks don't have user context - a verified webhook acts for
+	// the system principal, so access checks are bypassed and audited
+	ctx := withSystemPrincipal(r.Context(), "webhook:"+webhookName)
 	if err := s.executeWebhookAction(ctx, action, actionInput); err != nil {
 		s.logger.Error("webhook action failed",
 			"webhook", webhookName,
@@ -1372,7 +1466,9 @@ func toSnakeCase(s string) string {
 }
 
 // executeWebhookAction executes an action triggered by a webhook.
-// Similar to handleAction but without user authentication context.
+// Similar to handleAction but without user authentication context: the
+// write is checked against the principal in ctx, normally the system, and
+// runs through the same transaction, hooks and rules as any other create.
 func (s *Server) executeWebhookAction(ctx context.Context, action *ActionSchema, input map[string]any) error {
 	artifact := s.getArtifact()
 
@@ -1382,55 +1478,23 @@ func (s *Server) executeWebhookAction(ctx context.Context, action *ActionSchema,
 		return fmt.Errorf("entity %s not found for action %s", action.InputEntity, action.Name)
 	}
 
-	// Build INSERT query for create actions
-	columns := []string{"id", "created_at", "updated_at"}
-	placeholders := []string{"gen_random_uuid()", "NOW()", "NOW()"}
-	values := []any{}
-	paramCount := 0
-
+	// A provider payload carries more than the entity declares, including
+	// its own ids, so only the writable fields of the entity are kept
+	fields := map[string]any{}
 	for fieldName, value := range input {
-		// Skip if not a valid field
-		if _, exists := entity.Fields[fieldName]; !exists {
+		switch fieldName {
+		case "id", "created_at", "updated_at":
 			continue
 		}
-		columns = append(columns, fieldName)
-		paramCount++
-		placeholders = append(placeholders, fmt.Sprintf("$%d", paramCount))
-		values = append(values, value)
-	}
-
-	query := fmt.Sprintf(
-		"INSERT INTO %s (%s) VALUES (%s) RETURNING *",
-		entity.Table,
-		strings.Join(columns, ", "),
-		strings.Join(placeholders, ", "),
-	)
-
-	// Execute without user context (system operation)
-	rows, err := s.db.Query(ctx, query, values...)
-	if err != nil {
-		return fmt.Errorf("insert failed: %w", err)
-	}
-	defer rows.Close()
-
-	if !rows.Next() {
-		return fmt.Errorf("no rows returned from insert")
+		if _, exists := entity.Fields[fieldName]; exists {
+			fields[fieldName] = value
+		}
 	}
 
-	row, err := rows.Values()
+	change, _, err := s.writeEntity(ctx, s.db, entity, "create", fields)
 	if err != nil {
-		return fmt.Errorf("failed to read result: %w", err)
+		return err
 	}
-
-	// Convert to map and broadcast
-	cols := rows.FieldDescriptions()
-	record := rowToMap(cols, row)
-
-	// Broadcast the created record
-	s.broadcastEntityChange(entity.Name, "create", record)
-
-	// Evaluate hooks (fire-and-forget)
-	s.evaluateHooks(entity.Name, "create", record)
-
+	s.afterWrite(ctx, s.db, entity, change)
 	return nil
 }
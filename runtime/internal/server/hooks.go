@@ -1,22 +1,166 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/forge-lang/forge/runtime/internal/expr"
 	"github.com/forge-lang/forge/runtime/internal/jobs"
 )
 
+// hookStepsFor returns the steps of every hook matching entity, timing and
+// operation, in artifact order.
+func hookStepsFor(artifact *Artifact, entityName, timing, operation string) []*HookStepSchema {
+	var steps []*HookStepSchema
+	for _, hook := range artifact.Hooks {
+		if hook.Entity == entityName && hook.Timing == timing && hook.Operation == operation {
+			steps = append(steps, hook.Steps...)
+		}
+	}
+	return steps
+}
+
+// runHookSteps executes the emit/reject/set steps of the hooks matching
+// entity, timing and operation.
+//
+// Conditions and values resolve like rule conditions: bare fields against
+// record, proposed values as `input.<field>`. A `set` step writes its value
+// into both input and record, so it is persisted by the write that follows
+// and visible to later steps and rules. A `reject` step whose condition holds
+// aborts the action with its message; `emit` steps collect messages for the
+// response.
+func (s *Server) runHookSteps(ctx context.Context, q querier, entity *EntitySchema, timing, operation string, record, input map[string]any) ([]Message, error) {
+	steps := hookStepsFor(s.getArtifact(), entity.Name, timing, operation)
+	if len(steps) == 0 {
+		return nil, nil
+	}
+
+	resolver := s.newRecordResolver(ctx, q, entity, record, input)
+
+	var messages []Message
+	for _, step := range steps {
+		if step.Condition != "" {
+			holds, err := evalHookExpr(ctx, step.Condition, resolver)
+			if err != nil {
+				return nil, hookStepError(entity, timing, operation, step, err)
+			}
+			if !expr.Truthy(holds) {
+				continue
+			}
+		}
+
+		switch step.Kind {
+		case "reject":
+			s.logger.Info("hook.rejected",
+				"entity", entity.Name,
+				"operation", operation,
+				"code", step.Target,
+			)
+			return nil, &actionError{
+				Status:  http.StatusUnprocessableEntity,
+				Message: s.messageFor(step.Target, "error"),
+			}
+
+		case "emit":
+			messages = append(messages, s.messageFor(step.Target, "info"))
+
+		case "set":
+			value, err := evalHookExpr(ctx, step.Value, resolver)
+			if err != nil {
+				return nil, hookStepError(entity, timing, operation, step, err)
+			}
+			if input != nil {
+				input[step.Target] = value
+			}
+			if record != nil {
+				record[step.Target] = value
+			}
+		}
+	}
+	return messages, nil
+}
+
+func evalHookExpr(ctx context.Context, src string, r expr.Resolver) (any, error) {
+	node, err := expr.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return expr.Eval(ctx, node, r)
+}
+
+// hookStepError reports a hook step that could not be evaluated. Like rules,
+// hooks fail closed.
+func hookStepError(entity *EntitySchema, timing, operation string, step *HookStepSchema, err error) error {
+	return &actionError{
+		Status:  http.StatusInternalServerError,
+		Message: Message{Code: "HOOK_EVALUATION_FAILED", Message: "Failed to evaluate hook"},
+		Err:     fmt.Errorf("hook %s.%s_%s %s %s: %w", entity.Name, timing, operation, step.Kind, step.Target, err),
+	}
+}
+
 // evaluateHooks finds hooks matching entity+operation and enqueues their jobs.
 // Called AFTER the database write commits successfully.
 // This is fire-and-forget: errors are logged but do not affect the HTTP response.
 func (s *Server) evaluateHooks(entityName, operation string, record map[string]interface{}) {
+	if err := s.enqueueHookJobs(context.Background(), nil, entityName, operation, record); err != nil {
+		s.logger.Error("hook.enqueue_failed",
+			"entity", entityName,
+			"operation", operation,
+			"error", err,
+		)
+	}
+}
+
+// jobSchemas converts the artifact's job schemas for the executor.
+func (s *Server) jobSchemas() map[string]*jobs.JobSchema {
+	artifact := s.getArtifact()
+	schemas := make(map[string]*jobs.JobSchema, len(artifact.Jobs))
+	for name, js := range artifact.Jobs {
+		schemas[name] = &jobs.JobSchema{
+			Name:          js.Name,
+			InputEntity:   js.InputEntity,
+			NeedsPath:     js.NeedsPath,
+			NeedsFilter:   js.NeedsFilter,
+			Capabilities:  js.Capabilities,
+			Imperative:    js.Imperative,
+			TargetEntity:  js.TargetEntity,
+			FieldMappings: js.FieldMappings,
+			Schedule:      js.Schedule,
+			MaxAttempts:   js.MaxAttempts,
+			Timeout:       time.Duration(js.TimeoutMs) * time.Millisecond,
+		}
+		if target, ok := artifact.Entities[js.TargetEntity]; ok {
+			schemas[name].TargetTable = target.Table
+		}
+		if b := js.Backoff; b != nil {
+			schemas[name].Backoff = &jobs.Backoff{
+				Strategy: b.Strategy,
+				Base:     time.Duration(b.BaseMs) * time.Millisecond,
+				Max:      time.Duration(b.MaxMs) * time.Millisecond,
+			}
+		}
+	}
+	return schemas
+}
+
+// enqueueHookJobs enqueues the jobs of every after hook matching
+// entity+operation. With a durable queue the jobs are written through q, so
+// passing the action transaction ties them to its commit. Every hook is
+// attempted; the returned error joins the failures.
+func (s *Server) enqueueHookJobs(ctx context.Context, q jobs.Execer, entityName, operation string, record map[string]interface{}) error {
 	artifact := s.getArtifact()
 	if artifact == nil || artifact.Hooks == nil {
-		return
+		return nil
 	}
 
 	if s.executor == nil {
-		return
+		return nil
 	}
 
+	var errs []error
 	for _, hook := range artifact.Hooks {
 		if hook.Entity != entityName {
 			continue
@@ -24,11 +168,11 @@ func (s *Server) evaluateHooks(entityName, operation string, record map[string]i
 		if hook.Operation != operation {
 			continue
 		}
-		// Phase 1: only "after" hooks
+		// Before hooks run inside the action transaction (see runHookSteps).
 		if hook.Timing != "after" {
 			continue
 		}
-		if len(hook.Jobs) == 0 {
+		if len(hook.Jobs) == 0 && len(hook.Delayed) == 0 {
 			continue
 		}
 
@@ -37,21 +181,10 @@ func (s *Server) evaluateHooks(entityName, operation string, record map[string]i
 			"operation", operation,
 			"timing", hook.Timing,
 			"jobs", hook.Jobs,
+			"delayed", len(hook.Delayed),
 		)
 
-		// Convert artifact job schemas to executor job schemas
-		jobSchemas := make(map[string]*jobs.JobSchema)
-		for _, jobName := range hook.Jobs {
-			if js, ok := artifact.Jobs[jobName]; ok {
-				jobSchemas[jobName] = &jobs.JobSchema{
-					Name:          js.Name,
-					InputEntity:   js.InputEntity,
-					Capabilities:  js.Capabilities,
-					TargetEntity:  js.TargetEntity,
-					FieldMappings: js.FieldMappings,
-				}
-			}
-		}
+		jobSchemas := s.jobSchemas()
 
 		// Shallow-copy record so each hook's jobs get an independent map.
 		// This prevents one job from mutating data seen by another hook's jobs.
@@ -60,14 +193,17 @@ func (s *Server) evaluateHooks(entityName, operation string, record map[string]i
 			entityData[k] = v
 		}
 
-		// EnqueueFromHook handles all field mapping resolution for
+		// EnqueueFromHookTx handles all field mapping resolution for
 		// entity.create jobs (string literals, input.field refs, now()).
-		if err := s.executor.EnqueueFromHook(hook.Jobs, entityData, jobSchemas); err != nil {
-			s.logger.Error("hook.enqueue_failed",
-				"entity", entityName,
-				"operation", operation,
-				"error", err,
-			)
+		if err := s.executor.EnqueueFromHookTx(ctx, q, hook.Jobs, entityData, jobSchemas); err != nil {
+			errs = append(errs, err)
+		}
+		for _, d := range hook.Delayed {
+			delay := time.Duration(d.DelayMs) * time.Millisecond
+			if err := s.executor.EnqueueDelayedFromHookTx(ctx, q, d.Job, delay, entityData, jobSchemas); err != nil {
+				errs = append(errs, err)
+			}
 		}
 	}
+	return errors.Join(errs...)
 }
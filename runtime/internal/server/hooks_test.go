@@ -2,9 +2,13 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -670,3 +674,238 @@ func TestEvaluateHooks_MissingJobSchemaPartial(t *testing.T) {
 		t.Log(fmt.Sprintf("got %d calls (expected 1 for partial schema match)", len(calls)))
 	}
 }
+
+// --- Before hook steps ---
+
+func TestBeforeHookSteps(t *testing.T) {
+	artifact := helpdeskRulesArtifact()
+	artifact.Rules = nil
+	artifact.Messages["COMMENT_ADDED"] = &MessageSchema{Code: "COMMENT_ADDED", Level: "info", Default: "Comment added."}
+	artifact.Hooks = []*HookSchema{
+		{Entity: "Comment", Timing: "before", Operation: "create", Steps: []*HookStepSchema{
+			{Kind: "set", Target: "body", Value: `"(no text)"`, Condition: `(body == "")`},
+			{Kind: "emit", Target: "COMMENT_ADDED"},
+		}},
+		{Entity: "Ticket", Timing: "before", Operation: "update", Steps: []*HookStepSchema{
+			{Kind: "reject", Target: "TICKET_CLOSED", Condition: "(status == closed)"},
+		}},
+		{Entity: "Ticket", Timing: "before", Operation: "delete", Steps: []*HookStepSchema{
+			{Kind: "reject", Target: "TICKET_NOT_CLOSED", Condition: "(input.force != true) && (status != closed)"},
+		}},
+	}
+
+	t.Run("set stamps field into insert and emit adds message", func(t *testing.T) {
+		fake := &rowsDB{}
+		s := createTestServerWithMockDB(t, artifact, &mockDB{queryFunc: fake.query})
+
+		w, resp := postRuleAction(t, s, "add_comment", "", map[string]any{"body": ""})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want 201 (body: %s)", w.Code, w.Body.String())
+		}
+		if len(fake.writeArgs) != 1 || len(fake.writeArgs[0]) != 1 || fake.writeArgs[0][0] != "(no text)" {
+			t.Errorf("insert args = %v, want stamped body", fake.writeArgs)
+		}
+		if len(resp.Messages) != 1 || resp.Messages[0].Code != "COMMENT_ADDED" || resp.Messages[0].Level != "info" {
+			t.Errorf("messages = %+v, want COMMENT_ADDED", resp.Messages)
+		}
+	})
+
+	t.Run("unmet set condition leaves input alone", func(t *testing.T) {
+		fake := &rowsDB{}
+		s := createTestServerWithMockDB(t, artifact, &mockDB{queryFunc: fake.query})
+
+		w, _ := postRuleAction(t, s, "add_comment", "", map[string]any{"body": "hello"})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want 201", w.Code)
+		}
+		if len(fake.writeArgs) != 1 || fake.writeArgs[0][0] != "hello" {
+			t.Errorf("insert args = %v, want original body", fake.writeArgs)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		action     string
+		input      map[string]any
+		status     string
+		wantStatus int
+		wantCode   string
+	}{
+		{"reject on stored row", "close_ticket", map[string]any{"id": ruleTestTicketID}, "closed", http.StatusUnprocessableEntity, "TICKET_CLOSED"},
+		{"reject condition false", "close_ticket", map[string]any{"id": ruleTestTicketID}, "open", http.StatusOK, ""},
+		{"reject on delete", "delete_ticket", map[string]any{"id": ruleTestTicketID}, "open", http.StatusUnprocessableEntity, "TICKET_NOT_CLOSED"},
+		{"reject bypassed via input", "delete_ticket", map[string]any{"id": ruleTestTicketID, "force": true}, "open", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &rowsDB{rows: map[string]map[string]any{"tickets": {"id": ruleTestTicketID, "status": tt.status}}}
+			mock := &mockDB{queryFunc: fake.query}
+			s := createTestServerWithMockDB(t, artifact, mock)
+
+			w, resp := postRuleAction(t, s, tt.action, "", tt.input)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			if len(fake.writes) != 0 {
+				t.Errorf("rejected action must not write, got %v", fake.writes)
+			}
+			if len(resp.Messages) != 1 || resp.Messages[0].Code != tt.wantCode {
+				t.Errorf("messages = %+v, want %s", resp.Messages, tt.wantCode)
+			}
+			if len(mock.txs) != 1 || !mock.txs[0].rolledBack {
+				t.Error("expected the transaction to roll back")
+			}
+		})
+	}
+}
+
+func TestBeforeHookSteps_EntityEndpoints(t *testing.T) {
+	artifact := helpdeskRulesArtifact()
+	artifact.Rules = nil
+	artifact.Hooks = []*HookSchema{
+		{Entity: "Ticket", Timing: "before", Operation: "create", Steps: []*HookStepSchema{
+			{Kind: "reject", Target: "TICKET_CLOSED", Condition: "(status == closed)"},
+		}},
+		{Entity: "Ticket", Timing: "before", Operation: "update", Steps: []*HookStepSchema{
+			{Kind: "reject", Target: "TICKET_CLOSED", Condition: "(status == closed)"},
+		}},
+		{Entity: "Ticket", Timing: "before", Operation: "delete", Steps: []*HookStepSchema{
+			{Kind: "reject", Target: "TICKET_NOT_CLOSED", Condition: "(status != closed)"},
+		}},
+	}
+
+	ticket := "/api/entities/Ticket/" + ruleTestTicketID
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode string
+	}{
+		{"create", "POST", "/api/entities/Ticket", `{"subject": "printer on fire", "status": "closed"}`, "TICKET_CLOSED"},
+		{"update", "PUT", ticket, `{"subject": "printer still on fire"}`, "TICKET_CLOSED"},
+		{"delete", "DELETE", ticket, "", "TICKET_NOT_CLOSED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := "closed"
+			if tt.method == "DELETE" {
+				status = "open"
+			}
+			fake := &rowsDB{rows: map[string]map[string]any{"tickets": {"id": ruleTestTicketID, "status": status}}}
+			mock := &mockDB{queryFunc: fake.query}
+			s := createTestServerWithMockDB(t, artifact, mock)
+			r := chi.NewRouter()
+			r.Post("/api/entities/{entity}", s.handleCreate)
+			r.Put("/api/entities/{entity}/{id}", s.handleUpdate)
+			r.Delete("/api/entities/{entity}/{id}", s.handleDelete)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey{}, ruleTestUserID))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			var resp APIResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if w.Code != http.StatusUnprocessableEntity || len(resp.Messages) != 1 || resp.Messages[0].Code != tt.wantCode {
+				t.Errorf("status = %d, messages = %+v, want 422 %s", w.Code, resp.Messages, tt.wantCode)
+			}
+			if len(fake.writes) != 0 {
+				t.Errorf("rejected write must not reach the table, got %v", fake.writes)
+			}
+			if len(mock.txs) != 1 || !mock.txs[0].rolledBack {
+				t.Error("expected the transaction to roll back")
+			}
+		})
+	}
+}
+
+func TestAfterHooks_EntityEndpoints(t *testing.T) {
+	artifact := helpdeskRulesArtifact()
+	artifact.Rules = nil
+	artifact.Messages["TICKET_CHANGED"] = &MessageSchema{Code: "TICKET_CHANGED", Level: "info", Default: "Ticket changed."}
+	artifact.Jobs = map[string]*JobSchema{
+		"notify_author": {Name: "notify_author", InputEntity: "Ticket", Capabilities: []string{"email.send"}},
+	}
+	for _, op := range []string{"create", "update", "delete"} {
+		artifact.Hooks = append(artifact.Hooks, &HookSchema{
+			Entity: "Ticket", Timing: "after", Operation: op,
+			Jobs:  []string{"notify_author"},
+			Steps: []*HookStepSchema{{Kind: "emit", Target: "TICKET_CHANGED"}},
+		})
+	}
+
+	ticket := "/api/entities/Ticket/" + ruleTestTicketID
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"create", "POST", "/api/entities/Ticket", `{"subject": "printer on fire"}`},
+		{"update", "PUT", ticket, `{"subject": "printer still on fire"}`},
+		{"delete", "DELETE", ticket, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &rowsDB{rows: map[string]map[string]any{"tickets": {"id": ruleTestTicketID, "status": "open"}}}
+			mock := &mockDB{queryFunc: fake.query}
+			s := createTestServerWithMockDB(t, artifact, mock)
+			queue := &recordingQueue{}
+			s.executor = jobs.NewExecutor(provider.Global(), s.logger, 1)
+			s.executor.SetQueue(queue)
+
+			r := chi.NewRouter()
+			r.Post("/api/entities/{entity}", s.handleCreate)
+			r.Put("/api/entities/{entity}/{id}", s.handleUpdate)
+			r.Delete("/api/entities/{entity}/{id}", s.handleDelete)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey{}, ruleTestUserID))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			var resp APIResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if w.Code >= 300 {
+				t.Fatalf("status = %d (body: %s)", w.Code, w.Body.String())
+			}
+			if len(resp.Messages) != 1 || resp.Messages[0].Code != "TICKET_CHANGED" {
+				t.Errorf("messages = %+v, want the after-hook TICKET_CHANGED", resp.Messages)
+			}
+			if len(queue.pushed) != 1 || len(mock.txs) != 1 || queue.via[0] != mock.txs[0] {
+				t.Errorf("pushed %d jobs, want notify_author in the write transaction", len(queue.pushed))
+			}
+		})
+	}
+}
+
+func TestJobSchemas_RetryPolicy(t *testing.T) {
+	s := &Server{artifact: hookTestArtifact(nil, map[string]*JobSchema{
+		"sync": {
+			Name: "sync", Capabilities: []string{"http.call"},
+			MaxAttempts: 6, TimeoutMs: 120000,
+			Backoff: &BackoffSchema{Strategy: "exponential", BaseMs: 2000, MaxMs: 600000},
+		},
+		"ping": {Name: "ping", Capabilities: []string{"http.call"}},
+	})}
+
+	schemas := s.jobSchemas()
+	sync := schemas["sync"]
+	if sync.MaxAttempts != 6 || sync.Timeout != 2*time.Minute {
+		t.Errorf("sync max attempts = %d, timeout = %v", sync.MaxAttempts, sync.Timeout)
+	}
+	if b := sync.Backoff; b == nil || b.Strategy != "exponential" || b.Base != 2*time.Second || b.Max != 10*time.Minute {
+		t.Errorf("sync backoff = %+v", sync.Backoff)
+	}
+	if ping := schemas["ping"]; ping.MaxAttempts != 0 || ping.Timeout != 0 || ping.Backoff != nil {
+		t.Errorf("ping should use runtime defaults, got %+v", ping)
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+	"github.com/forge-lang/forge/runtime/internal/imperative"
+	"github.com/forge-lang/forge/runtime/internal/provider"
+)
+
+// checkImperatives fails if the artifact declares an imperative that has no
+// registered Go implementation.
+func checkImperatives(artifact *Artifact) error {
+	declared := make([]string, 0, len(artifact.Imperatives))
+	for name := range artifact.Imperatives {
+		declared = append(declared, name)
+	}
+	sort.Strings(declared)
+
+	if missing := imperative.Missing(declared); len(missing) > 0 {
+		return fmt.Errorf("imperative declared without an implementation: %s (register it with forge.RegisterImperative)",
+			strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// handleImperative handles POST /api/imperative/{name}.
+//
+// The JSON body is the function's input. The function reads the database as
+// the calling user and can only execute the effects its declaration lists.
+func (s *Server) handleImperative(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	artifact := s.getArtifact()
+	schema, ok := artifact.Imperatives[name]
+	if !ok {
+		s.respondError(w, http.StatusNotFound, Message{
+			Code:    "IMPERATIVE_NOT_FOUND",
+			Message: fmt.Sprintf("Imperative %s not found", name),
+		})
+		return
+	}
+
+	input := make(map[string]any)
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		s.respondError(w, http.StatusBadRequest, Message{
+			Code:    "INVALID_JSON",
+			Message: "Failed to parse request body",
+		})
+		return
+	}
+
+	userID := uuid.Nil
+	if uid, err := uuid.Parse(getUserID(r)); err == nil {
+		userID = uid
+	}
+
+	result, err := s.callImperative(r.Context(), schema, userID, s.getAuthenticatedDB(r), input)
+	if err != nil {
+		var rejected *imperative.Error
+		if errors.As(err, &rejected) {
+			s.respondError(w, http.StatusUnprocessableEntity, Message{
+				Code:    rejected.Code,
+				Message: rejected.Message,
+			})
+			return
+		}
+
+		s.logger.Error("imperative failed", "imperative", name, "error", err)
+		s.respondError(w, http.StatusInternalServerError, Message{
+			Code:    "IMPERATIVE_FAILED",
+			Message: "Imperative failed",
+		})
+		return
+	}
+
+	switch v := result.(type) {
+	case []byte:
+		contentType := "application/octet-stream"
+		if schema.Returns != "file" && schema.Returns != "bytes" {
+			contentType = http.DetectContentType(v)
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(v)
+	case string:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, v)
+	default:
+		s.respond(w, http.StatusOK, v)
+	}
+}
+
+// RunImperative calls an imperative function on behalf of a job. Jobs have no
+// calling user, so the function reads the database unscoped, still read-only.
+func (s *Server) RunImperative(ctx context.Context, name string, input map[string]any) (any, error) {
+	schema, ok := s.getArtifact().Imperatives[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not declared", imperative.ErrNotRegistered, name)
+	}
+	return s.callImperative(ctx, schema, uuid.Nil, s.db, input)
+}
+
+// callImperative runs the function for schema with a context limited to
+// read-only access through database and the declared effects.
+func (s *Server) callImperative(ctx context.Context, schema *ImperativeSchema, userID uuid.UUID, database db.Database, input map[string]any) (any, error) {
+	ictx := imperative.NewContext(ctx, schema.Name, userID, &readOnlyDB{db: database}, schema.Effects, executeEffect, s.logger)
+	return imperative.Call(ictx, input)
+}
+
+// executeEffect runs a capability through the provider registry.
+func executeEffect(ctx context.Context, capability string, data map[string]any) error {
+	cap := provider.Global().GetCapability(capability)
+	if cap == nil {
+		return fmt.Errorf("no provider registered for capability %s", capability)
+	}
+	return cap.Execute(ctx, capability, data)
+}
+
+// readOnlyDB runs each query in its own read-only transaction, so statements
+// that write are rejected by PostgreSQL. The transaction is always rolled back.
+type readOnlyDB struct {
+	db db.Database
+}
+
+func (r *readOnlyDB) Query(ctx context.Context, query string, args ...any) ([]map[string]any, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SET TRANSACTION READ ONLY"); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols := rows.FieldDescriptions()
+	records := []map[string]any{}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rowToMap(cols, values))
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+	"github.com/forge-lang/forge/runtime/internal/imperative"
+	"github.com/forge-lang/forge/runtime/internal/provider"
+)
+
+func imperativeArtifact() *Artifact {
+	return &Artifact{
+		AppName:  "TestApp",
+		Auth:     "jwt",
+		Entities: map[string]*EntitySchema{},
+		Imperatives: map[string]*ImperativeSchema{
+			"export_csv": {Name: "export_csv", Route: "/api/imperative/export_csv", InputEntity: "Ticket", Returns: "file"},
+			"summary":    {Name: "summary", Route: "/api/imperative/summary", Effects: []string{"email.send"}},
+			"reject":     {Name: "reject", Route: "/api/imperative/reject"},
+			"explode":    {Name: "explode", Route: "/api/imperative/explode"},
+			"undeclared": {Name: "undeclared", Route: "/api/imperative/undeclared"},
+		},
+	}
+}
+
+func registerTestImperatives(t *testing.T) {
+	t.Helper()
+	imperative.Reset()
+	t.Cleanup(imperative.Reset)
+
+	imperative.Register("export_csv", func(ctx *imperative.Context, input map[string]any) (any, error) {
+		rows, err := ctx.Query("SELECT subject FROM tickets")
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		b.WriteString("subject\n")
+		for _, row := range rows {
+			b.WriteString(row["subject"].(string) + "\n")
+		}
+		return []byte(b.String()), nil
+	})
+	imperative.Register("summary", func(ctx *imperative.Context, input map[string]any) (any, error) {
+		if err := ctx.Effect("email.send", map[string]any{"to": input["to"]}); err != nil {
+			return nil, err
+		}
+		return map[string]any{"sent": true}, nil
+	})
+	imperative.Register("reject", func(ctx *imperative.Context, input map[string]any) (any, error) {
+		return nil, &imperative.Error{Code: "EXPORT_TOO_LARGE", Message: "Narrow the export"}
+	})
+	imperative.Register("explode", func(ctx *imperative.Context, input map[string]any) (any, error) {
+		panic("boom")
+	})
+	imperative.Register("undeclared", func(ctx *imperative.Context, input map[string]any) (any, error) {
+		return nil, ctx.Effect("http.call", nil)
+	})
+}
+
+func TestHandleImperative(t *testing.T) {
+	registerTestImperatives(t)
+
+	rec := &recordingProvider{name: "test_email", capabilities: []string{"email.send"}}
+	registry := provider.Global()
+	registry.Reset()
+	provider.Register(rec)
+	t.Cleanup(registry.Reset)
+
+	var execs []string
+	mockDatabase := &mockDB{
+		queryFunc: func(ctx context.Context, query string, args ...any) (db.Rows, error) {
+			return &mockRows{cols: []string{"subject"}, values: [][]any{{"Printer jam"}, {"VPN down"}}}, nil
+		},
+		execFunc: func(ctx context.Context, query string, args ...any) (db.Result, error) {
+			execs = append(execs, query)
+			return &mockResult{}, nil
+		},
+	}
+	s := createTestServerWithMockDB(t, imperativeArtifact(), mockDatabase)
+	s.router = chi.NewRouter()
+	s.router.Post("/api/imperative/{name}", s.handleImperative)
+
+	call := func(name string, body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/api/imperative/"+name, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		s.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("raw result", func(t *testing.T) {
+		rr := call("export_csv", map[string]any{})
+		if rr.Code != http.StatusOK || rr.Body.String() != "subject\nPrinter jam\nVPN down\n" {
+			t.Fatalf("got %d %q", rr.Code, rr.Body.String())
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/octet-stream" {
+			t.Errorf("Content-Type = %q, want application/octet-stream", ct)
+		}
+		if len(execs) != 1 || execs[0] != "SET TRANSACTION READ ONLY" {
+			t.Errorf("expected the query to run in a read-only transaction, got %v", execs)
+		}
+		if tx := mockDatabase.txs[len(mockDatabase.txs)-1]; tx.committed || !tx.rolledBack {
+			t.Error("expected the read-only transaction to be rolled back")
+		}
+	})
+
+	t.Run("declared effect", func(t *testing.T) {
+		rr := call("summary", map[string]any{"to": "agent@example.com"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp struct {
+			Data map[string]any `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if resp.Data["sent"] != true {
+			t.Errorf("unexpected data %v", resp.Data)
+		}
+		if calls := rec.getCalls(); len(calls) != 1 || calls[0].Data["to"] != "agent@example.com" {
+			t.Errorf("expected one email.send call, got %+v", calls)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		wantCode int
+		wantMsg  string
+	}{
+		{"reject", http.StatusUnprocessableEntity, "EXPORT_TOO_LARGE"},
+		{"explode", http.StatusInternalServerError, "IMPERATIVE_FAILED"},
+		{"undeclared", http.StatusInternalServerError, "IMPERATIVE_FAILED"},
+		{"unknown", http.StatusNotFound, "IMPERATIVE_NOT_FOUND"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := call(tt.name, map[string]any{})
+			if rr.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantCode, rr.Body.String())
+			}
+			var resp APIResponse
+			json.NewDecoder(rr.Body).Decode(&resp)
+			if len(resp.Messages) != 1 || resp.Messages[0].Code != tt.wantMsg {
+				t.Errorf("messages = %+v, want %s", resp.Messages, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestRunImperative(t *testing.T) {
+	registerTestImperatives(t)
+	s := createTestServerWithMockDB(t, imperativeArtifact(), &mockDB{})
+
+	if _, err := s.RunImperative(context.Background(), "reject", map[string]any{}); !errors.As(err, new(*imperative.Error)) {
+		t.Errorf("expected the rejection to be returned, got %v", err)
+	}
+	if _, err := s.RunImperative(context.Background(), "missing", nil); !errors.Is(err, imperative.ErrNotRegistered) {
+		t.Errorf("expected ErrNotRegistered, got %v", err)
+	}
+}
+
+func TestCheckImperatives(t *testing.T) {
+	registerTestImperatives(t)
+
+	artifact := imperativeArtifact()
+	if err := checkImperatives(artifact); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	artifact.Imperatives["sync_crm"] = &ImperativeSchema{Name: "sync_crm"}
+	err := checkImperatives(artifact)
+	if err == nil || !strings.Contains(err.Error(), "sync_crm") {
+		t.Errorf("expected an error naming sync_crm, got %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+// Package server provides the endpoints linking records through many
+// relations.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// The records of a many relation are linked by rows of its join table.
+// Linking and unlinking a record is an update of the record owning the
+// relation: update rules and write access are checked against it, and the
+// change is pushed as its update.
+
+// linkRequest is the owning record and many relation a link endpoint
+// addresses.
+type linkRequest struct {
+	entity *EntitySchema
+	rel    *RelSchema
+	target *EntitySchema
+	id     string
+}
+
+// parseLinkRequest resolves the entity, id and relation of a link endpoint,
+// responding with an error and returning nil when they are not a record id
+// and a many relation of the entity.
+func (s *Server) parseLinkRequest(w http.ResponseWriter, r *http.Request) *linkRequest {
+	entityName := chi.URLParam(r, "entity")
+	artifact := s.getArtifact()
+
+	entity, ok := artifact.Entities[entityName]
+	if !ok {
+		s.respondError(w, http.StatusNotFound, Message{
+			Code:    "ENTITY_NOT_FOUND",
+			Message: fmt.Sprintf("entity %s not found", entityName),
+		})
+		return nil
+	}
+
+	relName := chi.URLParam(r, "relation")
+	rel, ok := entity.Relations[relName]
+	if !ok || !rel.IsMany {
+		s.respondError(w, http.StatusNotFound, Message{
+			Code:    "RELATION_NOT_FOUND",
+			Message: fmt.Sprintf("%s has no many relation %s", entityName, relName),
+		})
+		return nil
+	}
+	target, ok := artifact.Entities[rel.Target]
+	if !ok {
+		s.respondError(w, http.StatusNotFound, Message{
+			Code:    "ENTITY_NOT_FOUND",
+			Message: fmt.Sprintf("entity %s not found", rel.Target),
+		})
+		return nil
+	}
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		s.respondError(w, http.StatusBadRequest, Message{
+			Code:    "INVALID_ID",
+			Message: "Invalid UUID format",
+		})
+		return nil
+	}
+	return &linkRequest{entity: entity, rel: rel, target: target, id: id}
+}
+
+// handleListLinks handles GET /api/entities/{entity}/{id}/{relation}: the
+// linked records the caller may read, in id order.
+func (s *Server) handleListLinks(w http.ResponseWriter, r *http.Request) {
+	lr := s.parseLinkRequest(w, r)
+	if lr == nil {
+		return
+	}
+
+	ctx := r.Context()
+	database := s.getAuthenticatedDB(r)
+
+	// Links of a record the caller may not read are reported missing, as
+	// the record is.
+	owner, err := loadRow(ctx, database, lr.entity.Table, lr.id)
+	if err != nil {
+		s.logger.Error("query failed", "error", err, "entity", lr.entity.Name, "id", lr.id)
+		s.respondError(w, http.StatusInternalServerError, Message{
+			Code:    "QUERY_FAILED",
+			Message: "Failed to query database",
+		})
+		return
+	}
+	readable := owner != nil
+	if readable {
+		if readable, err = s.canAccess(ctx, database, lr.entity, "read", owner); err != nil {
+			s.respondActionError(w, accessEvaluationError(err))
+			return
+		}
+	}
+	if !readable {
+		s.respondError(w, http.StatusNotFound, Message{
+			Code:    "NOT_FOUND",
+			Message: "Record not found",
+		})
+		return
+	}
+
+	query := fmt.Sprintf("SELECT t.* FROM %s t JOIN %s m ON m.%s = t.id WHERE m.%s = $1 ORDER BY t.id",
+		lr.target.Table, lr.rel.JoinTable, lr.rel.TargetKey, lr.rel.JoinKey)
+	results, err := queryRecords(ctx, database, query, lr.id)
+	if err != nil {
+		s.logger.Error("query failed", "error", err, "entity", lr.entity.Name, "relation", lr.rel.Name)
+		s.respondError(w, http.StatusInternalServerError, Message{
+			Code:    "QUERY_FAILED",
+			Message: "Failed to query database",
+		})
+		return
+	}
+	if results, err = s.filterReadable(ctx, database, lr.target, results); err != nil {
+		s.respondActionError(w, accessEvaluationError(err))
+		return
+	}
+	if results == nil {
+		results = []map[string]interface{}{}
+	}
+	s.respond(w, http.StatusOK, s.newFieldReader(ctx, database).records(lr.target, results))
+}
+
+// handleAddLink handles POST /api/entities/{entity}/{id}/{relation}, which
+// links the record whose id the body holds, as in {"id": "<user id>"}.
+// Linking a record twice is not an error.
+func (s *Server) handleAddLink(w http.ResponseWriter, r *http.Request) {
+	lr := s.parseLinkRequest(w, r)
+	if lr == nil {
+		return
+	}
+
+	var input struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		s.respondError(w, http.StatusBadRequest, Message{
+			Code:    "INVALID_INPUT",
+			Message: "Invalid JSON input",
+		})
+		return
+	}
+	if _, err := uuid.Parse(input.ID); err != nil {
+		s.respondError(w, http.StatusBadRequest, Message{
+			Code:    "INVALID_ID",
+			Message: "Invalid UUID format",
+		})
+		return
+	}
+
+	ctx := r.Context()
+	database := s.getAuthenticatedDB(r)
+
+	if err := s.checkStoredRowRules(ctx, database, lr.entity, "update", lr.id, nil); err != nil {
+		s.respondActionError(w, err)
+		return
+	}
+	for _, record := range []struct {
+		entity *EntitySchema
+		id     string
+	}{{lr.entity, lr.id}, {lr.target, input.ID}} {
+		row, err := loadRow(ctx, database, record.entity.Table, record.id)
+		if err != nil {
+			s.logger.Error("query failed", "error", err, "entity", record.entity.Name, "id", record.id)
+			s.respondError(w, http.StatusInternalServerError, Message{
+				Code:    "QUERY_FAILED",
+				Message: "Failed to query database",
+			})
+			return
+		}
+		if row == nil {
+			s.respondError(w, http.StatusNotFound, Message{
+				Code:    "NOT_FOUND",
+				Message: fmt.Sprintf("%s %s not found", record.entity.Name, record.id),
+			})
+			return
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		lr.rel.JoinTable, lr.rel.JoinKey, lr.rel.TargetKey)
+	if _, err := database.Exec(ctx, query, lr.id, input.ID); err != nil {
+		s.logger.Error("link failed", "error", err, "entity", lr.entity.Name, "relation", lr.rel.Name)
+		s.respondError(w, http.StatusInternalServerError, Message{
+			Code:    "LINK_FAILED",
+			Message: "Failed to link record",
+		})
+		return
+	}
+
+	s.broadcastLinkChange(ctx, lr)
+	s.respond(w, http.StatusOK, map[string]interface{}{
+		lr.rel.JoinKey:   lr.id,
+		lr.rel.TargetKey: input.ID,
+	})
+}
+
+// handleRemoveLink handles DELETE
+// /api/entities/{entity}/{id}/{relation}/{target}.
+func (s *Server) handleRemoveLink(w http.ResponseWriter, r *http.Request) {
+	lr := s.parseLinkRequest(w, r)
+	if lr == nil {
+		return
+	}
+	targetID := chi.URLParam(r, "target")
+	if _, err := uuid.Parse(targetID); err != nil {
+		s.respondError(w, http.StatusBadRequest, Message{
+			Code:    "INVALID_ID",
+			Message: "Invalid UUID format",
+		})
+		return
+	}
+
+	ctx := r.Context()
+	database := s.getAuthenticatedDB(r)
+
+	if err := s.checkStoredRowRules(ctx, database, lr.entity, "update", lr.id, nil); err != nil {
+		s.respondActionError(w, err)
+		return
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s = $1 AND %s = $2",
+		lr.rel.JoinTable, lr.rel.JoinKey, lr.rel.TargetKey)
+	result, err := database.Exec(ctx, query, lr.id, targetID)
+	if err != nil {
+		s.logger.Error("unlink failed", "error", err, "entity", lr.entity.Name, "relation", lr.rel.Name)
+		s.respondError(w, http.StatusInternalServerError, Message{
+			Code:    "UNLINK_FAILED",
+			Message: "Failed to unlink record",
+		})
+		return
+	}
+	if result.RowsAffected() == 0 {
+		s.respondError(w, http.StatusNotFound, Message{
+			Code:    "NOT_FOUND",
+			Message: "Link not found",
+		})
+		return
+	}
+
+	s.broadcastLinkChange(ctx, lr)
+	s.respond(w, http.StatusOK, nil)
+}
+
+// broadcastLinkChange pushes the owning record of a changed link as updated,
+// which queries the views depending on it again.
+func (s *Server) broadcastLinkChange(ctx context.Context, lr *linkRequest) {
+	owner, err := loadRow(ctx, s.db, lr.entity.Table, lr.id)
+	if err != nil {
+		s.logger.Error("[BROADCAST] loading linked record failed", "entity", lr.entity.Name, "id", lr.id, "error", err)
+		return
+	}
+	if owner != nil {
+		s.broadcastEntityChange(lr.entity.Name, "update", owner)
+	}
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+)
+
+const linkTestMissingID = "99999999-9999-9999-9999-999999999999"
+
+// linkArtifact adds watchers, a many relation to users, to the tickets of
+// accessArtifact.
+func linkArtifact() *Artifact {
+	artifact := accessArtifact()
+	artifact.Entities["Ticket"].Relations["watchers"] = &RelSchema{
+		Name: "watchers", Target: "User", TargetTable: "users", IsMany: true,
+		JoinTable: "ticket_watchers", JoinKey: "ticket_id", TargetKey: "user_id",
+	}
+	return artifact
+}
+
+// linkDB keeps the rows of ticket_watchers on top of the fixed tables of
+// accessDB.
+type linkDB struct {
+	accessDB
+	links [][2]string
+}
+
+func (d *linkDB) query(ctx context.Context, query string, args ...any) (db.Rows, error) {
+	if !strings.Contains(query, "JOIN ticket_watchers m") {
+		return d.accessDB.query(ctx, query, args...)
+	}
+	var rows []map[string]any
+	for _, user := range d.tables["users"] {
+		for _, link := range d.links {
+			if link[0] == args[0] && link[1] == user["id"] {
+				rows = append(rows, user)
+			}
+		}
+	}
+	return tableRows(rows), nil
+}
+
+func (d *linkDB) exec(ctx context.Context, query string, args ...any) (db.Result, error) {
+	link := [2]string{args[0].(string), args[1].(string)}
+	kept := d.links[:0]
+	affected := 0
+	for _, l := range d.links {
+		if l == link {
+			affected++
+			if strings.HasPrefix(query, "DELETE") {
+				continue
+			}
+		}
+		kept = append(kept, l)
+	}
+	d.links = kept
+	if strings.HasPrefix(query, "INSERT") && affected == 0 {
+		d.links = append(d.links, link)
+		affected = 1
+	}
+	return &mockResult{rowsAffected: int64(affected)}, nil
+}
+
+func createLinkTestServer(t *testing.T) (*Server, *linkDB) {
+	t.Helper()
+	tables := accessTables()
+	tables["users"] = []map[string]any{
+		{"id": ruleTestUserID, "role": "agent"},
+		{"id": ruleTestOtherID, "role": "customer"},
+	}
+	fake := &linkDB{accessDB: accessDB{tables: tables}}
+	s := createTestServerWithMockDB(t, linkArtifact(), &mockDB{queryFunc: fake.query, execFunc: fake.exec})
+	return s, fake
+}
+
+func linkTestRequest(t *testing.T, s *Server, method, path, userID, body string) (*httptest.ResponseRecorder, APIResponse) {
+	t.Helper()
+
+	r := chi.NewRouter()
+	r.Get("/api/entities/{entity}/{id}/{relation}", s.handleListLinks)
+	r.Post("/api/entities/{entity}/{id}/{relation}", s.handleAddLink)
+	r.Delete("/api/entities/{entity}/{id}/{relation}/{target}", s.handleRemoveLink)
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), userContextKey{}, userID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return w, resp
+}
+
+// linkedRecordIDs returns the id of every record in data, in order.
+func linkedRecordIDs(t *testing.T, data any) []string {
+	t.Helper()
+	raw, _ := json.Marshal(data)
+	var records []map[string]any
+	if err := json.Unmarshal(raw, &records); err != nil {
+		t.Fatalf("unexpected data %s", raw)
+	}
+	var out []string
+	for _, r := range records {
+		out = append(out, r["id"].(string))
+	}
+	return out
+}
+
+func TestLinks(t *testing.T) {
+	s, fake := createLinkTestServer(t)
+	path := "/api/entities/Ticket/" + ruleTestTicketID + "/watchers"
+	watcher := replicaClient(s.hub, ruleTestUserID, "Ticket:update")
+
+	// Linking a record twice leaves a single link.
+	for i := 0; i < 2; i++ {
+		w, resp := linkTestRequest(t, s, "POST", path, ruleTestUserID, `{"id": "`+ruleTestOtherID+`"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("link status = %d (body: %s)", w.Code, w.Body.String())
+		}
+		if link, _ := resp.Data.(map[string]any); link["ticket_id"] != ruleTestTicketID || link["user_id"] != ruleTestOtherID {
+			t.Errorf("link response = %v", resp.Data)
+		}
+	}
+	if len(fake.links) != 1 {
+		t.Fatalf("links = %v, want one", fake.links)
+	}
+	s.changePushes.wait()
+	if got := drain(t, watcher); len(got) != 2 {
+		t.Errorf("subscriber received %d messages, want an update per link", len(got))
+	}
+
+	w, resp := linkTestRequest(t, s, "GET", path, ruleTestUserID, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list status = %d (body: %s)", w.Code, w.Body.String())
+	}
+	if got := linkedRecordIDs(t, resp.Data); len(got) != 1 || got[0] != ruleTestOtherID {
+		t.Errorf("linked = %v, want %s", got, ruleTestOtherID)
+	}
+
+	if w, _ := linkTestRequest(t, s, "DELETE", path+"/"+ruleTestOtherID, ruleTestUserID, ""); w.Code != http.StatusOK {
+		t.Fatalf("unlink status = %d (body: %s)", w.Code, w.Body.String())
+	}
+	w, resp = linkTestRequest(t, s, "DELETE", path+"/"+ruleTestOtherID, ruleTestUserID, "")
+	if w.Code != http.StatusNotFound || len(resp.Messages) != 1 || resp.Messages[0].Code != "NOT_FOUND" {
+		t.Errorf("second unlink: status = %d, messages = %+v, want 404 NOT_FOUND", w.Code, resp.Messages)
+	}
+
+	_, resp = linkTestRequest(t, s, "GET", path, ruleTestUserID, "")
+	if got := linkedRecordIDs(t, resp.Data); len(got) != 0 {
+		t.Errorf("linked after unlink = %v, want none", got)
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	ticket := "/api/entities/Ticket/" + ruleTestTicketID
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		userID     string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"link to unwritable record", "POST", ticket + "/watchers", ruleTestOtherID, `{"id": "` + ruleTestOtherID + `"}`, http.StatusForbidden, "ACCESS_DENIED"},
+		{"unlink from unwritable record", "DELETE", ticket + "/watchers/" + ruleTestOtherID, ruleTestOtherID, "", http.StatusForbidden, "ACCESS_DENIED"},
+		{"list links of unreadable record", "GET", ticket + "/watchers", ruleTestOtherID, "", http.StatusNotFound, "NOT_FOUND"},
+		{"missing record", "GET", "/api/entities/Ticket/" + linkTestMissingID + "/watchers", ruleTestUserID, "", http.StatusNotFound, "NOT_FOUND"},
+		{"missing target", "POST", ticket + "/watchers", ruleTestUserID, `{"id": "` + linkTestMissingID + `"}`, http.StatusNotFound, "NOT_FOUND"},
+		{"invalid target id", "POST", ticket + "/watchers", ruleTestUserID, `{"id": "nobody"}`, http.StatusBadRequest, "INVALID_ID"},
+		{"invalid record id", "GET", "/api/entities/Ticket/mine/watchers", ruleTestUserID, "", http.StatusBadRequest, "INVALID_ID"},
+		{"to-one relation", "GET", ticket + "/author", ruleTestUserID, "", http.StatusNotFound, "RELATION_NOT_FOUND"},
+		{"unknown entity", "GET", "/api/entities/Widget/" + ruleTestTicketID + "/watchers", ruleTestUserID, "", http.StatusNotFound, "ENTITY_NOT_FOUND"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, fake := createLinkTestServer(t)
+			w, resp := linkTestRequest(t, s, tt.method, tt.path, tt.userID, tt.body)
+			if w.Code != tt.wantStatus || len(resp.Messages) != 1 || resp.Messages[0].Code != tt.wantCode {
+				t.Fatalf("status = %d, messages = %+v, want %d %s", w.Code, resp.Messages, tt.wantStatus, tt.wantCode)
+			}
+			if len(fake.links) != 0 {
+				t.Errorf("links = %v, want none", fake.links)
+			}
+		})
+	}
+}
+
+func TestResolveManyRelation(t *testing.T) {
+	fake := &linkDB{
+		accessDB: accessDB{tables: map[string][]map[string]any{
+			"users": {{"id": ruleTestUserID, "role": "agent"}, {"id": ruleTestOtherID, "role": "customer"}},
+		}},
+		links: [][2]string{{ruleTestTicketID, ruleTestUserID}, {ruleTestTicketID, ruleTestOtherID}},
+	}
+	s := createTestServerWithMockDB(t, linkArtifact(), &mockDB{queryFunc: func(ctx context.Context, query string, args ...any) (db.Rows, error) {
+		if strings.HasPrefix(query, "SELECT user_id FROM ticket_watchers") {
+			var rows []map[string]any
+			for _, l := range fake.links {
+				if l[0] == args[0] {
+					rows = append(rows, map[string]any{"user_id": l[1]})
+				}
+			}
+			return tableRows(rows), nil
+		}
+		return fake.query(ctx, query, args...)
+	}})
+
+	r := &recordResolver{
+		q:          s.db,
+		artifact:   s.getArtifact(),
+		userEntity: "User",
+		entity:     s.getArtifact().Entities["Ticket"],
+		record:     map[string]any{"id": ruleTestTicketID},
+	}
+	for _, tt := range []struct {
+		path []string
+		want []any
+	}{
+		{[]string{"watchers"}, []any{ruleTestUserID, ruleTestOtherID}},
+		{[]string{"watchers", "role"}, []any{"agent", "customer"}},
+	} {
+		got, _, err := r.Resolve(context.Background(), tt.path)
+		if err != nil {
+			t.Fatalf("Resolve(%v): %v", tt.path, err)
+		}
+		list, _ := got.([]any)
+		if len(list) != len(tt.want) {
+			t.Fatalf("Resolve(%v) = %v, want %v", tt.path, got, tt.want)
+		}
+		for i := range list {
+			if list[i] != tt.want[i] {
+				t.Errorf("Resolve(%v) = %v, want %v", tt.path, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+	"github.com/forge-lang/forge/runtime/internal/expr"
+	"github.com/forge-lang/forge/runtime/internal/jobs"
+)
+
+// needsResolver resolves job needs clauses against the app database. Jobs
+// run without a user, so needs are loaded under the system context: a
+// transaction resets app.user_id and access policies do not narrow the
+// result.
+type needsResolver struct {
+	s *Server
+}
+
+// needsQuery is a needs path compiled to SQL.
+type needsQuery struct {
+	SQL    string
+	Args   []any
+	Target *EntitySchema // entity of the returned rows
+}
+
+// ResolveNeeds implements jobs.NeedsResolver. The needs path is compiled to a
+// join query from the job's triggering record (or, for a job without an
+// input entity, from every row of the path's root entity), and the optional
+// where filter is evaluated against each resulting row.
+func (r *needsResolver) ResolveNeeds(ctx context.Context, job *jobs.Job) ([]map[string]any, bool, error) {
+	artifact := r.s.getArtifact()
+	schema, ok := artifact.Jobs[job.Name]
+	if !ok || schema.NeedsPath == "" {
+		return nil, false, nil
+	}
+
+	nq, err := compileNeedsQuery(artifact, schema, job.Data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tx, err := systemTx(ctx, r.s.db)
+	if err != nil {
+		return nil, false, fmt.Errorf("needs %s: %w", schema.NeedsPath, err)
+	}
+	// Needs are only read, so the transaction is never committed
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, nq.SQL, nq.Args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("needs %s: %w", schema.NeedsPath, err)
+	}
+	defer rows.Close()
+
+	cols := rows.FieldDescriptions()
+	records := []map[string]any{}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, false, fmt.Errorf("needs %s: %w", schema.NeedsPath, err)
+		}
+		records = append(records, rowToMap(cols, values))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("needs %s: %w", schema.NeedsPath, err)
+	}
+
+	if schema.NeedsFilter == "" {
+		return records, true, nil
+	}
+
+	filter, err := expr.Parse(schema.NeedsFilter)
+	if err != nil {
+		return nil, false, fmt.Errorf("needs filter %q: %w", schema.NeedsFilter, err)
+	}
+	kept := records[:0]
+	for _, record := range records {
+		resolver := &recordResolver{
+			q:          tx,
+			artifact:   artifact,
+			userEntity: r.s.userEntityName(),
+			entity:     nq.Target,
+			record:     record,
+		}
+		holds, err := expr.EvalBool(ctx, filter, resolver)
+		if err != nil {
+			return nil, false, fmt.Errorf("needs filter %q: %w", schema.NeedsFilter, err)
+		}
+		if holds {
+			kept = append(kept, record)
+		}
+	}
+	return kept, true, nil
+}
+
+// systemTx begins a transaction on database under the system context. It
+// resets app.user_id rather than trusting the pooled connection to carry no
+// user, as one left by a session-level SET would narrow every query to that
+// user.
+func systemTx(ctx context.Context, database db.Database) (db.Tx, error) {
+	tx, err := database.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, "SET LOCAL app.user_id TO DEFAULT"); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+	return tx, nil
+}
+
+// compileNeedsQuery compiles a needs path such as Ticket.org.members into
+//
+//	SELECT * FROM users WHERE id IN (
+//	  SELECT m1.user_id FROM tickets n0
+//	  JOIN organizations n1 ON n1.id = n0.org_id
+//	  JOIN organization_members m1 ON m1.organization_id = n1.id
+//	  WHERE n0.id = $1)
+//
+// where a many relation such as members is followed through its join table.
+// The path starts at an entity, or at a relation of the job's input entity.
+// When it starts at the input entity the query is scoped to the triggering
+// record in data; otherwise it starts from every row of the root entity.
+func compileNeedsQuery(artifact *Artifact, schema *JobSchema, data map[string]any) (*needsQuery, error) {
+	parts := strings.Split(schema.NeedsPath, ".")
+
+	root, ok := artifact.Entities[parts[0]]
+	if ok {
+		parts = parts[1:]
+	} else if root, ok = artifact.Entities[schema.InputEntity]; !ok {
+		return nil, fmt.Errorf("needs %s: unknown entity %s", schema.NeedsPath, parts[0])
+	}
+
+	var args []any
+	where := ""
+	if root.Name == schema.InputEntity {
+		id, ok := data["id"]
+		if !ok || id == nil {
+			return nil, fmt.Errorf("needs %s: job data has no %s id", schema.NeedsPath, root.Name)
+		}
+		args = append(args, id)
+	}
+
+	if len(parts) == 0 {
+		if len(args) > 0 {
+			where = " WHERE id = $1"
+		}
+		return &needsQuery{
+			SQL:    fmt.Sprintf("SELECT * FROM %s%s ORDER BY id", root.Table, where),
+			Args:   args,
+			Target: root,
+		}, nil
+	}
+
+	var from strings.Builder
+	fmt.Fprintf(&from, "%s n0", root.Table)
+	current := root
+	var fk string
+	for i, name := range parts {
+		rel, ok := current.Relations[name]
+		if !ok {
+			return nil, fmt.Errorf("needs %s: %s is not a relation of %s", schema.NeedsPath, name, current.Name)
+		}
+		target, ok := artifact.Entities[rel.Target]
+		if !ok {
+			return nil, fmt.Errorf("needs %s: unknown entity %s", schema.NeedsPath, rel.Target)
+		}
+
+		fk = fmt.Sprintf("n%d.%s", i, rel.ForeignKey)
+		if rel.IsMany {
+			fmt.Fprintf(&from, " JOIN %s m%d ON m%d.%s = n%d.id", rel.JoinTable, i, i, rel.JoinKey, i)
+			fk = fmt.Sprintf("m%d.%s", i, rel.TargetKey)
+		}
+		if i < len(parts)-1 {
+			fmt.Fprintf(&from, " JOIN %s n%d ON n%d.id = %s", target.Table, i+1, i+1, fk)
+		}
+		current = target
+	}
+
+	if len(args) > 0 {
+		where = " WHERE n0.id = $1"
+	}
+	return &needsQuery{
+		SQL: fmt.Sprintf("SELECT * FROM %s WHERE id IN (SELECT %s FROM %s%s) ORDER BY id",
+			current.Table, fk, from.String(), where),
+		Args:   args,
+		Target: current,
+	}, nil
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+	"github.com/forge-lang/forge/runtime/internal/jobs"
+)
+
+// needsArtifact mirrors the helpdesk example's organizations and jobs.
+func needsArtifact() *Artifact {
+	return &Artifact{
+		Entities: map[string]*EntitySchema{
+			"User": {
+				Name:  "User",
+				Table: "users",
+				Fields: map[string]*FieldSchema{
+					"id":    {Name: "id", Type: "uuid"},
+					"email": {Name: "email", Type: "string"},
+					"role":  {Name: "role", Type: "enum", EnumValues: []string{"agent", "customer"}},
+				},
+			},
+			"Organization": {
+				Name:   "Organization",
+				Table:  "organizations",
+				Fields: map[string]*FieldSchema{"id": {Name: "id", Type: "uuid"}},
+				Relations: map[string]*RelSchema{
+					"members": {Name: "members", Target: "User", IsMany: true, JoinTable: "organization_members", JoinKey: "organization_id", TargetKey: "user_id"},
+				},
+			},
+			"Ticket": {
+				Name:  "Ticket",
+				Table: "tickets",
+				Fields: map[string]*FieldSchema{
+					"id":      {Name: "id", Type: "uuid"},
+					"subject": {Name: "subject", Type: "string"},
+				},
+				Relations: map[string]*RelSchema{
+					"org":    {Name: "org", Target: "Organization", ForeignKey: "org_id"},
+					"author": {Name: "author", Target: "User", ForeignKey: "author_id"},
+				},
+			},
+		},
+		Jobs: map[string]*JobSchema{
+			"notify_agents": {
+				Name: "notify_agents", InputEntity: "Ticket",
+				NeedsPath: "Ticket.org.members", NeedsFilter: "(role == agent)",
+				Capabilities: []string{"email.send"},
+			},
+			"notify_author": {Name: "notify_author", InputEntity: "Ticket", Capabilities: []string{"email.send"}},
+		},
+	}
+}
+
+func TestCompileNeedsQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   *JobSchema
+		data     map[string]any
+		wantSQL  string
+		wantArgs []any
+		wantErr  string
+	}{
+		{
+			name:     "multi-hop path joins from the triggering record",
+			schema:   &JobSchema{InputEntity: "Ticket", NeedsPath: "Ticket.org.members"},
+			data:     map[string]any{"id": "t1"},
+			wantSQL:  "SELECT * FROM users WHERE id IN (SELECT m1.user_id FROM tickets n0 JOIN organizations n1 ON n1.id = n0.org_id JOIN organization_members m1 ON m1.organization_id = n1.id WHERE n0.id = $1) ORDER BY id",
+			wantArgs: []any{"t1"},
+		},
+		{
+			name:     "single hop",
+			schema:   &JobSchema{InputEntity: "Ticket", NeedsPath: "Ticket.author"},
+			data:     map[string]any{"id": "t1"},
+			wantSQL:  "SELECT * FROM users WHERE id IN (SELECT n0.author_id FROM tickets n0 WHERE n0.id = $1) ORDER BY id",
+			wantArgs: []any{"t1"},
+		},
+		{
+			name:     "path relative to the input entity",
+			schema:   &JobSchema{InputEntity: "Ticket", NeedsPath: "org.members"},
+			data:     map[string]any{"id": "t1"},
+			wantSQL:  "SELECT * FROM users WHERE id IN (SELECT m1.user_id FROM tickets n0 JOIN organizations n1 ON n1.id = n0.org_id JOIN organization_members m1 ON m1.organization_id = n1.id WHERE n0.id = $1) ORDER BY id",
+			wantArgs: []any{"t1"},
+		},
+		{
+			name:     "input entity alone reloads the record",
+			schema:   &JobSchema{InputEntity: "Ticket", NeedsPath: "Ticket"},
+			data:     map[string]any{"id": "t1"},
+			wantSQL:  "SELECT * FROM tickets WHERE id = $1 ORDER BY id",
+			wantArgs: []any{"t1"},
+		},
+		{
+			name:    "job without input reads every row",
+			schema:  &JobSchema{NeedsPath: "User"},
+			wantSQL: "SELECT * FROM users ORDER BY id",
+		},
+		{
+			name:    "field is not a relation",
+			schema:  &JobSchema{InputEntity: "Ticket", NeedsPath: "Ticket.subject"},
+			data:    map[string]any{"id": "t1"},
+			wantErr: "subject is not a relation of Ticket",
+		},
+		{
+			name:    "triggering record without id",
+			schema:  &JobSchema{InputEntity: "Ticket", NeedsPath: "Ticket.author"},
+			data:    map[string]any{},
+			wantErr: "job data has no Ticket id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nq, err := compileNeedsQuery(needsArtifact(), tt.schema, tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if nq.SQL != tt.wantSQL {
+				t.Errorf("SQL:\n got %s\nwant %s", nq.SQL, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(nq.Args, tt.wantArgs) {
+				t.Errorf("args: got %v, want %v", nq.Args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestNeedsResolver(t *testing.T) {
+	var queries, execs []string
+	mockDatabase := &mockDB{
+		execFunc: func(ctx context.Context, query string, args ...any) (db.Result, error) {
+			execs = append(execs, query)
+			return &mockResult{}, nil
+		},
+		queryFunc: func(ctx context.Context, query string, args ...any) (db.Rows, error) {
+			queries = append(queries, query)
+			return &mockRows{
+				cols: []string{"id", "email", "role"},
+				values: [][]any{
+					{"u1", "agent@example.com", "agent"},
+					{"u2", "customer@example.com", "customer"},
+				},
+			}, nil
+		},
+	}
+	s := createTestServerWithMockDB(t, needsArtifact(), mockDatabase)
+	resolver := &needsResolver{s: s}
+
+	records, ok, err := resolver.ResolveNeeds(context.Background(), &jobs.Job{
+		Name: "notify_agents",
+		Data: map[string]any{"id": "t1"},
+	})
+	if err != nil || !ok {
+		t.Fatalf("ResolveNeeds: ok=%v err=%v", ok, err)
+	}
+	if len(records) != 1 || records[0]["email"] != "agent@example.com" {
+		t.Errorf("expected only the agent, got %v", records)
+	}
+	if len(queries) != 1 {
+		t.Errorf("expected one join query, got %d", len(queries))
+	}
+	if len(mockDatabase.txs) != 1 || len(execs) != 1 || execs[0] != "SET LOCAL app.user_id TO DEFAULT" {
+		t.Errorf("expected the query in a transaction resetting app.user_id, got %d transactions and %v", len(mockDatabase.txs), execs)
+	}
+
+	_, ok, err = resolver.ResolveNeeds(context.Background(), &jobs.Job{Name: "notify_author"})
+	if err != nil || ok {
+		t.Errorf("job without needs: ok=%v err=%v", ok, err)
+	}
+}
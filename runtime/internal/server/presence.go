@@ -0,0 +1,541 @@
+// Package server provides presence updates, their expiry and views over
+// presences.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/forge-lang/forge/runtime/internal/expr"
+	"github.com/forge-lang/forge/runtime/internal/presence"
+	"github.com/forge-lang/forge/runtime/internal/query"
+)
+
+// Presence entries live in the presence store, not in tables. A connection
+// sets the entry of its own user in a scope the user belongs to, and the
+// update lasts the presence's TTL. Entries are pushed to the members of
+// their scope on the "<Presence>:<scope_id>" topic, and the views over the
+// presence are queried again. An expired entry is removed and pushed once
+// more, in the presence's default state.
+
+const (
+	// defaultPresenceTTL is the TTL of presences declaring none, unless
+	// forge.runtime.toml sets presence.default_ttl.
+	defaultPresenceTTL = 5 * time.Minute
+
+	// presenceSweepInterval is how often expired entries are removed.
+	presenceSweepInterval = time.Second
+
+	// presenceChangeTopic relays presence changes between replicas.
+	presenceChangeTopic = "presence_change"
+)
+
+// presenceChange is a presence entry relayed to other replicas, as pushed.
+type presenceChange struct {
+	Presence string                 `json:"presence"`
+	Record   map[string]interface{} `json:"record"`
+}
+
+// updatePresence stores the state msg carries as the presence of c's user
+// in the scope msg names, and pushes the entry.
+func (s *Server) updatePresence(c *Client, msg WSMessage) error {
+	p, ok := s.getArtifact().Presences[msg.Presence]
+	if !ok {
+		return fmt.Errorf("presence %s not found", msg.Presence)
+	}
+	userID := c.UserID()
+	if userID == "" {
+		return errors.New("authentication required")
+	}
+	if p.Source != s.userEntityName() {
+		return fmt.Errorf("presence %s is not held by users", p.Name)
+	}
+	if _, err := uuid.Parse(msg.Scope); err != nil {
+		return fmt.Errorf("invalid %s id %q", p.Scope, msg.Scope)
+	}
+	state, err := presenceState(p, msg.Data)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.WithValue(context.Background(), userContextKey{}, userID)
+	member, err := s.inPresenceScope(ctx, p, userID, msg.Scope)
+	if err != nil {
+		s.logger.Error("presence scope check failed", "presence", p.Name, "error", err)
+		return errors.New("failed to check presence scope")
+	}
+	if !member {
+		return fmt.Errorf("not a member of %s %s", p.Scope, msg.Scope)
+	}
+
+	now := time.Now()
+	entry, err := s.presences.Update(ctx, &presence.Entry{
+		Presence:  p.Name,
+		Scope:     msg.Scope,
+		Source:    userID,
+		State:     state,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(s.ttlOf(p)),
+	})
+	if err != nil {
+		s.logger.Error("presence update failed", "presence", p.Name, "error", err)
+		return errors.New("failed to update presence")
+	}
+	s.broadcastPresenceChange(p.Name, presenceRecord(p, entry))
+	return nil
+}
+
+// presenceState checks the state of an update against the declared fields:
+// each key must be a field, holding a value of its type. Null resets a field
+// to its default.
+func presenceState(p *PresenceSchema, data interface{}) (map[string]interface{}, error) {
+	state, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("presence state must be an object")
+	}
+	for name, v := range state {
+		field, ok := p.Fields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %s in presence %s", name, p.Name)
+		}
+		if v != nil && !validFieldValue(field, v) {
+			return nil, fmt.Errorf("invalid value for %s.%s", p.Name, name)
+		}
+	}
+	return state, nil
+}
+
+// validFieldValue reports whether a JSON value fits field.
+func validFieldValue(field *FieldSchema, v interface{}) bool {
+	switch field.Type {
+	case "enum":
+		s, ok := v.(string)
+		return ok && slices.Contains(field.EnumValues, s)
+	case "int":
+		n, ok := v.(float64)
+		return ok && n == float64(int64(n))
+	case "float":
+		_, ok := v.(float64)
+		return ok
+	case "bool":
+		_, ok := v.(bool)
+		return ok
+	case "time":
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	case "uuid":
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, err := uuid.Parse(s)
+		return err == nil
+	default:
+		_, ok := v.(string)
+		return ok
+	}
+}
+
+// ttlOf returns how long an update of p lasts.
+func (s *Server) ttlOf(p *PresenceSchema) time.Duration {
+	if p.TTLMs > 0 {
+		return time.Duration(p.TTLMs) * time.Millisecond
+	}
+	if s.presenceTTL > 0 {
+		return s.presenceTTL
+	}
+	return defaultPresenceTTL
+}
+
+// presenceRecord returns entry as its readers see it: the source and scope
+// ids under the presence's names for them, and every field, with the
+// defaults of those the entry does not set. The source id is the record id.
+func presenceRecord(p *PresenceSchema, entry *presence.Entry) map[string]interface{} {
+	record := map[string]interface{}{
+		"id":          entry.Source,
+		p.SourceField: entry.Source,
+		p.Scope:       entry.Scope,
+		"updated_at":  entry.UpdatedAt,
+	}
+	for name, field := range p.Fields {
+		record[name] = field.Default
+	}
+	for name, v := range entry.State {
+		if v != nil {
+			record[name] = v
+		}
+	}
+	return record
+}
+
+// presenceEntity describes the records of p as an entity, so that paths
+// through its source and scope resolve like relations.
+func presenceEntity(p *PresenceSchema) *EntitySchema {
+	fields := map[string]*FieldSchema{
+		"id":         {Name: "id", Type: "uuid"},
+		"updated_at": {Name: "updated_at", Type: "time"},
+	}
+	for name, field := range p.Fields {
+		fields[name] = field
+	}
+	return &EntitySchema{
+		Name:   p.Name,
+		Fields: fields,
+		Relations: map[string]*RelSchema{
+			p.SourceField: {Name: p.SourceField, Target: p.Source, ForeignKey: p.SourceField},
+			p.Scope:       {Name: p.Scope, Target: p.ScopeEntity, ForeignKey: p.Scope},
+		},
+	}
+}
+
+// inPresenceScope reports whether the source record sourceID belongs to the
+// scope record scopeID: whether the relation linking them, read from the
+// row of the entity declaring it, holds the other id.
+func (s *Server) inPresenceScope(ctx context.Context, p *PresenceSchema, sourceID, scopeID string) (bool, error) {
+	entityName, id, other := p.Source, sourceID, scopeID
+	if p.ScopeVia == "scope" {
+		entityName, id, other = p.ScopeEntity, scopeID, sourceID
+	}
+	entity, ok := s.getArtifact().Entities[entityName]
+	if !ok {
+		return false, fmt.Errorf("entity %s not found", entityName)
+	}
+
+	row, err := loadRow(ctx, s.db, entity.Table, id)
+	if err != nil || row == nil {
+		return false, err
+	}
+	r := s.newRecordResolver(ctx, s.db, entity, row, nil)
+	related, _, err := r.resolveIn(ctx, entity, row, []string{p.ScopeRelation})
+	if err != nil {
+		return false, err
+	}
+	return expr.Contains(related, other), nil
+}
+
+// presenceMembers returns a filter passing the WebSocket clients whose user
+// belongs to the scope record scopeID of p. Each user is checked once.
+func (s *Server) presenceMembers(p *PresenceSchema, scopeID string) func(*Client) bool {
+	decided := make(map[string]bool)
+	return func(c *Client) bool {
+		userID := c.UserID()
+		if allowed, ok := decided[userID]; ok {
+			return allowed
+		}
+		allowed := false
+		if userID != "" {
+			ctx := context.WithValue(context.Background(), userContextKey{}, userID)
+			var err error
+			if allowed, err = s.inPresenceScope(ctx, p, userID, scopeID); err != nil {
+				s.logger.Error("[BROADCAST] presence scope check failed", "presence", p.Name, "error", err)
+			}
+		}
+		decided[userID] = allowed
+		return allowed
+	}
+}
+
+// broadcastPresenceChange pushes a presence record to the WebSocket
+// subscribers on every replica.
+func (s *Server) broadcastPresenceChange(name string, record map[string]interface{}) {
+	s.pushPresenceChange(name, record)
+	s.hub.Relay(presenceChangeTopic, presenceChange{Presence: name, Record: record})
+}
+
+// pushPresenceChange pushes a presence record to the members of its scope
+// subscribed to the scope's topic on this replica, and invalidates the views
+// over the presence.
+func (s *Server) pushPresenceChange(name string, record map[string]interface{}) {
+	p, ok := s.getArtifact().Presences[name]
+	if !ok {
+		return
+	}
+	scopeID := fmt.Sprintf("%v", record[p.Scope])
+	allow := s.presenceMembers(p, scopeID)
+
+	s.hub.BroadcastToViewFunc(fmt.Sprintf("%s:%s", name, scopeID), record, allow)
+	s.pushViewChanges(&entityChange{Entity: name, Operation: "update", Record: record}, allow)
+}
+
+// relayPresenceChange handles a presence change relayed by another replica.
+func (s *Server) relayPresenceChange(data json.RawMessage) {
+	var change presenceChange
+	if err := json.Unmarshal(data, &change); err != nil {
+		s.logger.Error("[BROADCAST] invalid relayed presence change", "error", err)
+		return
+	}
+	s.pushPresenceChange(change.Presence, change.Record)
+}
+
+// expirePresence removes expired presence entries every interval until ctx
+// is done.
+func (s *Server) expirePresence(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.expirePresenceEntries(ctx, now)
+		}
+	}
+}
+
+// expirePresenceEntries removes the entries that expired by now and pushes
+// each in its presence's default state.
+func (s *Server) expirePresenceEntries(ctx context.Context, now time.Time) {
+	expired, err := s.presences.Expire(ctx, now)
+	if err != nil {
+		s.logger.Error("presence expiry failed", "error", err)
+		return
+	}
+	presences := s.getArtifact().Presences
+	for _, entry := range expired {
+		p, ok := presences[entry.Presence]
+		if !ok {
+			continue
+		}
+		s.broadcastPresenceChange(p.Name, presenceRecord(p, &presence.Entry{
+			Presence:  entry.Presence,
+			Scope:     entry.Scope,
+			Source:    entry.Source,
+			UpdatedAt: entry.ExpiresAt,
+		}))
+	}
+}
+
+// presenceResolver resolves the paths of a presence view's condition: the
+// entry's fields and relations first, so that `user` names the entry's user
+// rather than the reader, then the view's params.
+type presenceResolver struct {
+	*recordResolver
+	params url.Values
+}
+
+// Resolve implements expr.Resolver.
+func (r *presenceResolver) Resolve(ctx context.Context, path []string) (any, bool, error) {
+	if r.entity.hasMember(path[0]) {
+		return r.resolveIn(ctx, r.entity, r.record, path)
+	}
+	if path[0] == "param" && len(path) == 2 {
+		return r.params.Get("param." + path[1]), true, nil
+	}
+	return r.recordResolver.Resolve(ctx, path)
+}
+
+// queryPresenceView returns the rows of a view over a presence that userID
+// may read, in the view's default sort, and the page size values ask for.
+// Readers see the entries of the scopes they belong to. values takes the
+// params and limit of GET /api/views; filters, sorts and cursors are
+// rejected.
+func (s *Server) queryPresenceView(ctx context.Context, view *ViewSchema, values url.Values, userID string) ([]map[string]interface{}, int, error) {
+	p, ok := s.getArtifact().Presences[view.Source]
+	if !ok {
+		return nil, 0, fmt.Errorf("presence %s not found", view.Source)
+	}
+	if err := checkPresenceQuery(view, values); err != nil {
+		return nil, 0, err
+	}
+	limit, err := query.ParseLimit(values.Get("limit"))
+	if err != nil {
+		return nil, 0, err
+	}
+	rows := []map[string]interface{}{}
+	if userID == "" {
+		return rows, limit, nil
+	}
+
+	var condition expr.Node
+	if view.Condition != "" {
+		if condition, err = expr.Parse(view.Condition); err != nil {
+			return nil, 0, fmt.Errorf("condition of view %s: %w", view.Name, err)
+		}
+	}
+	entries, err := s.presences.List(ctx, p.Name, presenceScopeParam(condition, p, values), time.Now())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entity := presenceEntity(p)
+	member := make(map[string]bool)
+	var keys [][]interface{}
+	for _, entry := range entries {
+		in, ok := member[entry.Scope]
+		if !ok {
+			if in, err = s.inPresenceScope(ctx, p, userID, entry.Scope); err != nil {
+				return nil, 0, err
+			}
+			member[entry.Scope] = in
+		}
+		if !in {
+			continue
+		}
+
+		record := presenceRecord(p, entry)
+		r := &presenceResolver{recordResolver: s.newRecordResolver(ctx, s.db, entity, record, nil), params: values}
+		if condition != nil {
+			keep, err := expr.EvalBool(ctx, condition, r)
+			if err != nil {
+				return nil, 0, fmt.Errorf("condition of view %s: %w", view.Name, err)
+			}
+			if !keep {
+				continue
+			}
+		}
+
+		row := make(map[string]interface{}, len(view.Fields))
+		for _, f := range view.Fields {
+			if row[f.Alias], _, err = r.resolveIn(ctx, entity, record, strings.Split(f.Column, ".")); err != nil {
+				return nil, 0, err
+			}
+		}
+		key := make([]interface{}, len(view.DefaultSort))
+		for i, sort := range view.DefaultSort {
+			if key[i], _, err = r.resolveIn(ctx, entity, record, strings.Split(sort.Column, ".")); err != nil {
+				return nil, 0, err
+			}
+		}
+		rows = append(rows, row)
+		keys = append(keys, key)
+	}
+
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		for i, sort := range view.DefaultSort {
+			c, _ := expr.Compare(keys[order[a]][i], keys[order[b]][i])
+			if c != 0 {
+				return (c < 0) == (sort.Direction != "DESC")
+			}
+		}
+		return false
+	})
+	sorted := make([]map[string]interface{}, len(rows))
+	for i, j := range order {
+		sorted[i] = rows[j]
+	}
+	return sorted, limit, nil
+}
+
+// pushPresenceViewResults queries the first page of a presence view's
+// parameterization key for each subscriber's user and pushes it as items.
+func (s *Server) pushPresenceViewResults(view *ViewSchema, key string, params url.Values) {
+	byUser := make(map[string]*WSMessage)
+	s.hub.SendToView(key, func(c *Client) *WSMessage {
+		userID := c.UserID()
+		if msg, ok := byUser[userID]; ok {
+			return msg
+		}
+		rows, err := s.queryViewSubscription(view, params, userID)
+		if err != nil {
+			s.logger.Error("[BROADCAST] view re-query failed", "view", view.Name, "key", key, "error", err)
+			byUser[userID] = nil
+			return nil
+		}
+		byUser[userID] = &WSMessage{Type: "data", View: key, Items: rows}
+		return byUser[userID]
+	})
+}
+
+// checkPresenceQuery rejects the query options a presence view does not
+// take, and reports missing params as query.Build does.
+func checkPresenceQuery(view *ViewSchema, values url.Values) error {
+	for key := range values {
+		switch {
+		case strings.HasPrefix(key, "filter["):
+			return &query.QueryError{Code: "INVALID_FILTER", Message: fmt.Sprintf("view %s over a presence cannot be filtered", view.Name)}
+		case key == "sort":
+			return &query.QueryError{Code: "INVALID_SORT", Message: fmt.Sprintf("view %s over a presence cannot be sorted", view.Name)}
+		case key == "cursor":
+			return &query.QueryError{Code: "INVALID_CURSOR", Message: fmt.Sprintf("view %s over a presence has a single page", view.Name)}
+		}
+	}
+	for _, name := range view.Params {
+		if _, ok := values["param."+name]; !ok {
+			return &query.QueryError{Code: "MISSING_PARAM", Message: fmt.Sprintf("required view parameter '%s' not provided", name)}
+		}
+	}
+	return nil
+}
+
+// presenceScopeParam returns the scope id a condition requires entries to
+// be in, when one of its conjuncts compares the scope with a param, so that
+// only that scope is listed. Otherwise it returns "".
+func presenceScopeParam(condition expr.Node, p *PresenceSchema, values url.Values) string {
+	b, ok := condition.(*expr.Binary)
+	if !ok {
+		return ""
+	}
+	switch b.Op {
+	case "&&":
+		if scope := presenceScopeParam(b.Left, p, values); scope != "" {
+			return scope
+		}
+		return presenceScopeParam(b.Right, p, values)
+	case "==":
+		left, lok := b.Left.(*expr.Path)
+		right, rok := b.Right.(*expr.Path)
+		if !lok || !rok {
+			return ""
+		}
+		if len(right.Parts) == 1 {
+			left, right = right, left
+		}
+		if len(left.Parts) == 1 && left.Parts[0] == p.Scope && len(right.Parts) == 2 && right.Parts[0] == "param" {
+			return values.Get("param." + right.Parts[1])
+		}
+	}
+	return ""
+}
+
+// handlePresenceView serves GET /api/views for a view over a presence.
+func (s *Server) handlePresenceView(w http.ResponseWriter, r *http.Request, view *ViewSchema) {
+	rows, limit, err := s.queryPresenceView(r.Context(), view, r.URL.Query(), getUserID(r))
+	if err != nil {
+		if qe, ok := err.(*query.QueryError); ok {
+			s.respondError(w, http.StatusBadRequest, Message{Code: qe.Code, Message: qe.Message})
+			return
+		}
+		s.logger.Error("presence view query failed", "error", err, "view", view.Name)
+		s.respondError(w, http.StatusInternalServerError, Message{
+			Code:    "QUERY_FAILED",
+			Message: "Failed to query view",
+		})
+		return
+	}
+
+	var total *int
+	if r.URL.Query().Get("include") == "count" {
+		count := len(rows)
+		total = &count
+	}
+	hasNext := len(rows) > limit
+	if hasNext {
+		rows = rows[:limit]
+	}
+	s.respond(w, http.StatusOK, map[string]interface{}{
+		"items": rows,
+		"pagination": query.PaginationMeta{
+			Limit:   limit,
+			HasNext: hasNext,
+			Total:   total,
+		},
+	})
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forge-lang/forge/runtime/internal/presence"
+)
+
+const (
+	presenceTestWorkspaceID = "55555555-5555-5555-5555-555555555555"
+	presenceTestElsewhereID = "66666666-6666-6666-6666-666666666666"
+	presenceTestOutsiderID  = "77777777-7777-7777-7777-777777777777"
+)
+
+// presenceArtifact has users in workspaces, and the status they show there.
+func presenceArtifact() *Artifact {
+	status := &FieldSchema{Name: "status", Type: "enum", EnumValues: []string{"online", "away", "offline"}, Default: "offline"}
+	return &Artifact{
+		AppName: "Chat",
+		Entities: map[string]*EntitySchema{
+			"User": {
+				Name:  "User",
+				Table: "users",
+				Fields: map[string]*FieldSchema{
+					"id":           {Name: "id", Type: "uuid"},
+					"display_name": {Name: "display_name", Type: "string"},
+				},
+				Relations: map[string]*RelSchema{
+					"workspace": {Name: "workspace", Target: "Workspace", TargetTable: "workspaces", ForeignKey: "workspace_id"},
+				},
+			},
+			"Workspace": {
+				Name:   "Workspace",
+				Table:  "workspaces",
+				Fields: map[string]*FieldSchema{"id": {Name: "id", Type: "uuid"}},
+			},
+		},
+		Presences: map[string]*PresenceSchema{
+			"UserPresence": {
+				Name:          "UserPresence",
+				Source:        "User",
+				SourceField:   "user",
+				Scope:         "workspace",
+				ScopeEntity:   "Workspace",
+				ScopeRelation: "workspace",
+				ScopeVia:      "source",
+				TTLMs:         60000,
+				Fields:        map[string]*FieldSchema{"status": status},
+			},
+		},
+		Views: map[string]*ViewSchema{
+			"OnlineUsers": {
+				Name:     "OnlineUsers",
+				Source:   "UserPresence",
+				Presence: true,
+				Fields: []ViewField{
+					{Name: "user.display_name", Column: "user.display_name", Alias: "user.display_name"},
+					{Name: "status", Column: "status", Alias: "status"},
+				},
+				DefaultSort:  []ViewSort{{Column: "user.display_name", Direction: "ASC"}},
+				Params:       []string{"workspace"},
+				Condition:    "((workspace == param.workspace) && (status != offline))",
+				Dependencies: []string{"User", "UserPresence", "Workspace"},
+			},
+		},
+	}
+}
+
+func presenceTables() map[string][]map[string]any {
+	return map[string][]map[string]any{
+		"users": {
+			{"id": ruleTestUserID, "display_name": "Ada", "workspace_id": presenceTestWorkspaceID},
+			{"id": ruleTestOtherID, "display_name": "Bob", "workspace_id": presenceTestWorkspaceID},
+			{"id": presenceTestOutsiderID, "display_name": "Eve", "workspace_id": presenceTestElsewhereID},
+		},
+	}
+}
+
+func createPresenceTestServer(t *testing.T) *Server {
+	t.Helper()
+	fake := &accessDB{tables: presenceTables()}
+	s := createTestServerWithMockDB(t, presenceArtifact(), &mockDB{queryFunc: fake.query})
+	s.presences = presence.NewMemoryStore()
+	return s
+}
+
+func presenceMessage(scope string, data map[string]any) WSMessage {
+	return WSMessage{Type: "presence", Presence: "UserPresence", Scope: scope, Data: data}
+}
+
+func TestUpdatePresence(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  string
+		msg     WSMessage
+		wantErr string
+	}{
+		{"member", ruleTestUserID, presenceMessage(presenceTestWorkspaceID, map[string]any{"status": "online"}), ""},
+		{"reset to default", ruleTestUserID, presenceMessage(presenceTestWorkspaceID, map[string]any{"status": nil}), ""},
+		{"anonymous", "", presenceMessage(presenceTestWorkspaceID, map[string]any{"status": "online"}), "authentication required"},
+		{"unknown presence", ruleTestUserID, WSMessage{Presence: "Typing", Scope: presenceTestWorkspaceID, Data: map[string]any{}}, "presence Typing not found"},
+		{"invalid scope", ruleTestUserID, presenceMessage("general", map[string]any{"status": "online"}), "invalid workspace id"},
+		{"unknown field", ruleTestUserID, presenceMessage(presenceTestWorkspaceID, map[string]any{"mood": "happy"}), "unknown field mood"},
+		{"invalid enum value", ruleTestUserID, presenceMessage(presenceTestWorkspaceID, map[string]any{"status": "busy"}), "invalid value for UserPresence.status"},
+		{"state not an object", ruleTestUserID, WSMessage{Presence: "UserPresence", Scope: presenceTestWorkspaceID, Data: "online"}, "presence state must be an object"},
+		{"other workspace", presenceTestOutsiderID, presenceMessage(presenceTestWorkspaceID, map[string]any{"status": "online"}), "not a member of workspace"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := createPresenceTestServer(t)
+			c := replicaClient(s.hub, tt.userID)
+
+			err := s.updatePresence(c, tt.msg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			entries, _ := s.presences.List(context.Background(), "UserPresence", presenceTestWorkspaceID, time.Now())
+			if len(entries) != 1 || entries[0].Source != tt.userID {
+				t.Fatalf("entries = %+v, want one for %s", entries, tt.userID)
+			}
+			if ttl := time.Until(entries[0].ExpiresAt); ttl <= 50*time.Second || ttl > time.Minute {
+				t.Errorf("entry expires in %v, want the presence's 1m TTL", ttl)
+			}
+		})
+	}
+}
+
+func TestUpdatePresencePushesToScopeMembers(t *testing.T) {
+	s := createPresenceTestServer(t)
+	topic := "UserPresence:" + presenceTestWorkspaceID
+	member := replicaClient(s.hub, ruleTestOtherID, topic)
+	outsider := replicaClient(s.hub, presenceTestOutsiderID, topic)
+
+	if err := s.updatePresence(replicaClient(s.hub, ruleTestUserID), presenceMessage(presenceTestWorkspaceID, map[string]any{"status": "away"})); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(member.send) != 1 {
+		t.Fatalf("member received %d messages, want 1", len(member.send))
+	}
+	var msg WSMessage
+	if err := json.Unmarshal(<-member.send, &msg); err != nil {
+		t.Fatal(err)
+	}
+	record, _ := msg.Data.(map[string]any)
+	if msg.View != topic || record["user"] != ruleTestUserID || record["workspace"] != presenceTestWorkspaceID || record["status"] != "away" {
+		t.Errorf("member received %+v", msg)
+	}
+	if got := drain(t, outsider); len(got) != 0 {
+		t.Errorf("outsider received %v", got)
+	}
+}
+
+func TestExpirePresenceEntries(t *testing.T) {
+	s := createPresenceTestServer(t)
+	topic := "UserPresence:" + presenceTestWorkspaceID
+	member := replicaClient(s.hub, ruleTestOtherID, topic)
+
+	if err := s.updatePresence(replicaClient(s.hub, ruleTestUserID), presenceMessage(presenceTestWorkspaceID, map[string]any{"status": "online"})); err != nil {
+		t.Fatal(err)
+	}
+	drain(t, member)
+
+	s.expirePresenceEntries(context.Background(), time.Now())
+	if len(member.send) != 0 {
+		t.Fatalf("live entry expired early")
+	}
+
+	s.expirePresenceEntries(context.Background(), time.Now().Add(2*time.Minute))
+	if len(member.send) != 1 {
+		t.Fatalf("member received %d messages, want 1", len(member.send))
+	}
+	var msg WSMessage
+	if err := json.Unmarshal(<-member.send, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if record, _ := msg.Data.(map[string]any); record["user"] != ruleTestUserID || record["status"] != "offline" {
+		t.Errorf("expired entry pushed as %+v, want the default status", msg.Data)
+	}
+
+	entries, _ := s.presences.List(context.Background(), "UserPresence", "", time.Now())
+	if len(entries) != 0 {
+		t.Errorf("expired entries still listed: %+v", entries)
+	}
+}
+
+func TestPresenceView(t *testing.T) {
+	s := createPresenceTestServer(t)
+	for _, update := range []struct{ userID, status string }{
+		{ruleTestOtherID, "online"},
+		{ruleTestUserID, "away"},
+		{presenceTestOutsiderID, "online"},
+	} {
+		scope := presenceTestWorkspaceID
+		if update.userID == presenceTestOutsiderID {
+			scope = presenceTestElsewhereID
+		}
+		if err := s.updatePresence(replicaClient(s.hub, update.userID), presenceMessage(scope, map[string]any{"status": update.status})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		userID   string
+		query    string
+		wantCode string
+		want     []string
+	}{
+		{"member", ruleTestUserID, "param.workspace=" + presenceTestWorkspaceID, "", []string{"Ada away", "Bob online"}},
+		{"limit", ruleTestUserID, "param.workspace=" + presenceTestWorkspaceID + "&limit=1", "", []string{"Ada away"}},
+		{"outsider", presenceTestOutsiderID, "param.workspace=" + presenceTestWorkspaceID, "", nil},
+		{"anonymous", "", "param.workspace=" + presenceTestWorkspaceID, "", nil},
+		{"missing param", ruleTestUserID, "", "MISSING_PARAM", nil},
+		{"sort", ruleTestUserID, "param.workspace=" + presenceTestWorkspaceID + "&sort=status", "INVALID_SORT", nil},
+		{"filter", ruleTestUserID, "param.workspace=" + presenceTestWorkspaceID + "&filter[status]=online", "INVALID_FILTER", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, resp := accessRequest(t, s, "GET", "/api/views/OnlineUsers?"+tt.query, tt.userID)
+			if tt.wantCode != "" {
+				if w.Code != http.StatusBadRequest || len(resp.Messages) != 1 || resp.Messages[0].Code != tt.wantCode {
+					t.Fatalf("status = %d, messages = %+v, want 400 %s", w.Code, resp.Messages, tt.wantCode)
+				}
+				return
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d (body: %s)", w.Code, w.Body.String())
+			}
+
+			raw, _ := json.Marshal(resp.Data)
+			var data struct {
+				Items []map[string]any `json:"items"`
+			}
+			if err := json.Unmarshal(raw, &data); err != nil {
+				t.Fatalf("unexpected data %s", raw)
+			}
+			var got []string
+			for _, row := range data.Items {
+				got = append(got, row["user.display_name"].(string)+" "+row["status"].(string))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("rows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+// Package server provides rule evaluation for mutations.
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/forge-lang/forge/runtime/internal/expr"
+)
+
+// RuleViolation is returned when a forbid/require rule rejects a mutation.
+type RuleViolation struct {
+	Rule    *RuleSchema
+	Message Message
+}
+
+func (v *RuleViolation) Error() string {
+	return fmt.Sprintf("rule %s rejected %s.%s: %s", v.Rule.ID, v.Rule.Entity, v.Rule.Operation, v.Message.Code)
+}
+
+// rulesFor returns the rules declared for an entity operation, in artifact order.
+func rulesFor(artifact *Artifact, entityName, operation string) []*RuleSchema {
+	var matched []*RuleSchema
+	for _, rule := range artifact.Rules {
+		if rule.Entity == entityName && rule.Operation == operation && rule.Condition != "" {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+// evaluateRules checks every rule for entity+operation.
+//
+// Bare fields in a condition resolve against record: the proposed input for
+// creates, and the current row for updates and deletes, so `forbid if status
+// == closed` on update inspects the stored status. The proposed values are
+// always reachable as `input.<field>`. `user` resolves to the authenticated
+// user's ID from ctx and relation names resolve to their foreign key, loading
+// the related row when the path continues (e.g. `user.role`, `ticket.org`).
+//
+// It returns a *RuleViolation for the first rule that rejects, or an
+// *actionError if a condition cannot be evaluated.
+func (s *Server) evaluateRules(ctx context.Context, q querier, entity *EntitySchema, operation string, record, input map[string]any) error {
+	artifact := s.getArtifact()
+	rules := rulesFor(artifact, entity.Name, operation)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	resolver := s.newRecordResolver(ctx, q, entity, record, input)
+
+	for _, rule := range rules {
+		node, err := expr.Parse(rule.Condition)
+		if err != nil {
+			return ruleEvaluationError(rule, err)
+		}
+
+		holds, err := expr.EvalBool(ctx, node, resolver)
+		if err != nil {
+			return ruleEvaluationError(rule, err)
+		}
+
+		// forbid rejects when the condition holds; require rejects when it doesn't.
+		if holds != rule.IsForbid {
+			continue
+		}
+
+		s.logger.Info("rule.rejected",
+			"rule", rule.ID,
+			"entity", rule.Entity,
+			"operation", rule.Operation,
+			"code", rule.EmitCode,
+		)
+		return &RuleViolation{Rule: rule, Message: s.ruleMessage(rule)}
+	}
+	return nil
+}
+
+// ruleMessage builds the API message for a rejected rule from artifact.Messages.
+func (s *Server) ruleMessage(rule *RuleSchema) Message {
+	if rule.EmitCode == "" {
+		return Message{
+			Code:    "RULE_VIOLATION",
+			Level:   "error",
+			Message: fmt.Sprintf("%s.%s rule violated", rule.Entity, rule.Operation),
+		}
+	}
+	return s.messageFor(rule.EmitCode, "error")
+}
+
+// messageFor resolves a message code through artifact.Messages. level is used
+// when the message declares none.
+func (s *Server) messageFor(code, level string) Message {
+	msg := Message{Code: code, Level: level}
+	if def, ok := s.getArtifact().Messages[code]; ok {
+		msg.Message = def.Default
+		if def.Level != "" {
+			msg.Level = def.Level
+		}
+	}
+	return msg
+}
+
+// ruleEvaluationError reports a condition that could not be evaluated.
+// Rules fail closed: the mutation is rejected.
+func ruleEvaluationError(rule *RuleSchema, err error) error {
+	return &actionError{
+		Status:  http.StatusInternalServerError,
+		Message: Message{Code: "RULE_EVALUATION_FAILED", Message: "Failed to evaluate rules"},
+		Err:     fmt.Errorf("rule %s: %w", rule.ID, err),
+	}
+}
+
+// loadStoredRow loads the row an update or delete targets when rules,
+// before-hooks or a write access rule for the operation need it, or when
+// subscriptions to a parameterized view need the params it had, and returns
+// nil otherwise. Within a transaction the row stays locked until it ends.
+func (s *Server) loadStoredRow(ctx context.Context, q querier, entity *EntitySchema, operation, id string) (map[string]any, error) {
+	artifact := s.getArtifact()
+	if len(rulesFor(artifact, entity.Name, operation)) == 0 && len(hookStepsFor(artifact, entity.Name, "before", operation)) == 0 &&
+		!s.hasAccessRule(entity, "write") && !s.hasParamViews(entity.Name) {
+		return nil, nil
+	}
+
+	current, err := lockRow(ctx, q, entity.Table, id)
+	if err != nil {
+		return nil, &actionError{
+			Status:  http.StatusInternalServerError,
+			Message: Message{Code: "QUERY_FAILED", Message: "Failed to load record"},
+			Err:     fmt.Errorf("loading %s %s: %w", entity.Name, id, err),
+		}
+	}
+	if current == nil {
+		return nil, &actionError{
+			Status:  http.StatusNotFound,
+			Message: Message{Code: "NOT_FOUND", Message: "Record not found"},
+		}
+	}
+	return current, nil
+}
+
+// checkStoredRowRules evaluates update/delete rules and write access against
+// the stored row. Updates must also leave a row the caller may write.
+func (s *Server) checkStoredRowRules(ctx context.Context, q querier, entity *EntitySchema, operation, id string, input map[string]any) error {
+	current, err := s.loadStoredRow(ctx, q, entity, operation, id)
+	if err != nil {
+		return err
+	}
+	if err := s.evaluateRules(ctx, q, entity, operation, current, input); err != nil {
+		return err
+	}
+	return s.checkWriteAccess(ctx, q, entity, current, mergedRecord(entity, current, input))
+}
+
+// userEntityName returns the entity that `user` paths traverse into.
+func (s *Server) userEntityName() string {
+	if s.runtimeConf != nil && s.runtimeConf.Auth.Password.UserEntity != "" {
+		return s.runtimeConf.Auth.Password.UserEntity
+	}
+	return "User"
+}
+
+// proposedRecord maps relation names in input to their foreign key columns so
+// a create's input can be evaluated like a stored row.
+func proposedRecord(entity *EntitySchema, input map[string]any) map[string]any {
+	record := make(map[string]any, len(input))
+	for k, v := range input {
+		record[k] = v
+	}
+	for relName, rel := range entity.Relations {
+		if rel.IsMany {
+			continue
+		}
+		if v, ok := input[relName]; ok {
+			if _, set := record[rel.ForeignKey]; !set {
+				record[rel.ForeignKey] = v
+			}
+		}
+	}
+	return record
+}
+
+// loadRow loads a single row by ID. It returns nil if no row matches.
+func loadRow(ctx context.Context, q querier, table string, id any) (map[string]any, error) {
+	return queryRecord(ctx, q, fmt.Sprintf("SELECT * FROM %s WHERE id = $1", table), id)
+}
+
+// lockRow loads a single row by ID like loadRow and locks it until the
+// transaction q belongs to ends, so the row rules were checked against is
+// the row that gets written.
+func lockRow(ctx context.Context, q querier, table string, id any) (map[string]any, error) {
+	return queryRecord(ctx, q, fmt.Sprintf("SELECT * FROM %s WHERE id = $1 FOR UPDATE", table), id)
+}
+
+// newRecordResolver returns a resolver for conditions evaluated against record,
+// with the authenticated user taken from ctx.
+func (s *Server) newRecordResolver(ctx context.Context, q querier, entity *EntitySchema, record, input map[string]any) *recordResolver {
+	r := &recordResolver{
+		q:          q,
+		artifact:   s.getArtifact(),
+		userEntity: s.userEntityName(),
+		entity:     entity,
+		record:     record,
+		input:      input,
+	}
+	r.userID, _ = ctx.Value(userContextKey{}).(string)
+	return r
+}
+
+// recordResolver resolves condition paths against a record and its relations.
+type recordResolver struct {
+	q          querier
+	artifact   *Artifact
+	userEntity string
+	entity     *EntitySchema
+	record     map[string]any
+	input      map[string]any
+	userID     string
+}
+
+// Resolve implements expr.Resolver.
+func (r *recordResolver) Resolve(ctx context.Context, path []string) (any, bool, error) {
+	head, rest := path[0], path[1:]
+
+	switch head {
+	case "user":
+		if r.userID == "" {
+			return nil, true, nil
+		}
+		if len(rest) == 0 {
+			return r.userID, true, nil
+		}
+		users, ok := r.artifact.Entities[r.userEntity]
+		if !ok {
+			return nil, false, nil
+		}
+		return r.traverse(ctx, users, r.userID, rest)
+
+	case "input":
+		if !r.entity.hasMember("input") {
+			if len(rest) == 0 {
+				return r.input, true, nil
+			}
+			return lookupField(r.entity, r.input, rest[0]), true, nil
+		}
+	}
+
+	return r.resolveIn(ctx, r.entity, r.record, path)
+}
+
+func (r *recordResolver) resolveIn(ctx context.Context, entity *EntitySchema, record map[string]any, path []string) (any, bool, error) {
+	head, rest := path[0], path[1:]
+
+	if rel, ok := entity.Relations[head]; ok && rel.IsMany {
+		return r.resolveMany(ctx, rel, record["id"], rest)
+	}
+	if rel, ok := entity.Relations[head]; ok {
+		fk := record[rel.ForeignKey]
+		if len(rest) == 0 || fk == nil {
+			return fk, true, nil
+		}
+		target, ok := r.artifact.Entities[rel.Target]
+		if !ok {
+			return nil, false, nil
+		}
+		return r.traverse(ctx, target, fk, rest)
+	}
+
+	if v, ok := record[head]; ok {
+		if len(rest) > 0 {
+			return nil, true, nil
+		}
+		return v, true, nil
+	}
+	if _, ok := entity.Fields[head]; ok {
+		return nil, true, nil
+	}
+	return nil, false, nil
+}
+
+// resolveMany resolves a path through a many relation of the record id to a
+// list: the ids of the linked records, or the value of the rest of the path
+// for each of them.
+func (r *recordResolver) resolveMany(ctx context.Context, rel *RelSchema, id any, rest []string) (any, bool, error) {
+	values := []any{}
+	if id == nil {
+		return values, true, nil
+	}
+	ids, err := linkedIDs(ctx, r.q, rel, id)
+	if err != nil {
+		return nil, false, fmt.Errorf("loading %s of %v: %w", rel.Name, id, err)
+	}
+	if len(rest) == 0 {
+		return ids, true, nil
+	}
+	target, ok := r.artifact.Entities[rel.Target]
+	if !ok {
+		return nil, false, nil
+	}
+	for _, targetID := range ids {
+		v, _, err := r.traverse(ctx, target, targetID, rest)
+		if err != nil {
+			return nil, false, err
+		}
+		if v != nil {
+			values = append(values, v)
+		}
+	}
+	return values, true, nil
+}
+
+// linkedIDs returns the ids of the records the many relation rel links to
+// the record id, from its join table.
+func linkedIDs(ctx context.Context, q querier, rel *RelSchema, id any) ([]any, error) {
+	rows, err := queryRecords(ctx, q, fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1 ORDER BY %s",
+		rel.TargetKey, rel.JoinTable, rel.JoinKey, rel.TargetKey), id)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]any, len(rows))
+	for i, row := range rows {
+		ids[i] = row[rel.TargetKey]
+	}
+	return ids, nil
+}
+
+func (r *recordResolver) traverse(ctx context.Context, entity *EntitySchema, id any, path []string) (any, bool, error) {
+	row, err := loadRow(ctx, r.q, entity.Table, id)
+	if err != nil {
+		return nil, false, fmt.Errorf("loading %s %v: %w", entity.Name, id, err)
+	}
+	if row == nil {
+		return nil, true, nil
+	}
+	return r.resolveIn(ctx, entity, row, path)
+}
+
+// lookupField reads a field from input, accepting a relation by name or by
+// its foreign key column.
+func lookupField(entity *EntitySchema, input map[string]any, name string) any {
+	if v, ok := input[name]; ok {
+		return v
+	}
+	if rel, ok := entity.Relations[name]; ok && !rel.IsMany {
+		return input[rel.ForeignKey]
+	}
+	return nil
+}
+
+// hasMember reports whether name is a field or relation of the entity.
+func (e *EntitySchema) hasMember(name string) bool {
+	if _, ok := e.Fields[name]; ok {
+		return true
+	}
+	_, ok := e.Relations[name]
+	return ok
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+)
+
+const (
+	ruleTestTicketID = "11111111-1111-1111-1111-111111111111"
+	ruleTestUserID   = "22222222-2222-2222-2222-222222222222"
+	ruleTestOtherID  = "33333333-3333-3333-3333-333333333333"
+)
+
+// helpdeskRulesArtifact mirrors the helpdesk example's rules and messages.
+func helpdeskRulesArtifact() *Artifact {
+	return &Artifact{
+		AppName: "Helpdesk",
+		Entities: map[string]*EntitySchema{
+			"Ticket": {
+				Name:  "Ticket",
+				Table: "tickets",
+				Fields: map[string]*FieldSchema{
+					"id":      {Name: "id", Type: "uuid"},
+					"subject": {Name: "subject", Type: "string"},
+					"status":  {Name: "status", Type: "enum", EnumValues: []string{"open", "closed"}},
+				},
+			},
+			"Comment": {
+				Name:  "Comment",
+				Table: "comments",
+				Fields: map[string]*FieldSchema{
+					"id":   {Name: "id", Type: "uuid"},
+					"body": {Name: "body", Type: "string"},
+				},
+				Relations: map[string]*RelSchema{
+					"author": {Name: "author", Target: "User", TargetTable: "users", ForeignKey: "author_id"},
+				},
+			},
+			"User": {
+				Name:  "User",
+				Table: "users",
+				Fields: map[string]*FieldSchema{
+					"id":   {Name: "id", Type: "uuid"},
+					"role": {Name: "role", Type: "enum"},
+				},
+			},
+		},
+		Actions: map[string]*ActionSchema{
+			"close_ticket":  {Name: "close_ticket", InputEntity: "Ticket", Operation: "update", TargetEntity: "Ticket"},
+			"delete_ticket": {Name: "delete_ticket", InputEntity: "Ticket", Operation: "delete", TargetEntity: "Ticket"},
+			"add_comment":   {Name: "add_comment", InputEntity: "Comment", Operation: "create", TargetEntity: "Comment"},
+			"edit_comment":  {Name: "edit_comment", InputEntity: "Comment", Operation: "update", TargetEntity: "Comment"},
+		},
+		Rules: []*RuleSchema{
+			{ID: "rule_1", Entity: "Ticket", Operation: "update", Condition: "(status == closed)", EmitCode: "TICKET_CLOSED", IsForbid: true},
+			{ID: "rule_2", Entity: "Ticket", Operation: "delete", Condition: "(status != closed)", EmitCode: "TICKET_NOT_CLOSED", IsForbid: true},
+			{ID: "rule_3", Entity: "Comment", Operation: "create", Condition: "body", EmitCode: "COMMENT_EMPTY"},
+			{ID: "rule_4", Entity: "Comment", Operation: "update", Condition: "((author != user) && (user.role != agent))", EmitCode: "NOT_AUTHOR", IsForbid: true},
+		},
+		Messages: map[string]*MessageSchema{
+			"TICKET_CLOSED":     {Code: "TICKET_CLOSED", Level: "error", Default: "This ticket is already closed and cannot be modified."},
+			"TICKET_NOT_CLOSED": {Code: "TICKET_NOT_CLOSED", Level: "error", Default: "Only closed tickets can be deleted."},
+			"NOT_AUTHOR":        {Code: "NOT_AUTHOR", Level: "error", Default: "Only the author can edit this comment."},
+		},
+	}
+}
+
+// rowsDB answers SELECT-by-id queries from fixed rows and records every write.
+type rowsDB struct {
+	rows      map[string]map[string]any // table -> row
+	writes    []string
+	writeArgs [][]any
+}
+
+func (d *rowsDB) query(ctx context.Context, query string, args ...any) (db.Rows, error) {
+	if strings.HasPrefix(query, "SELECT * FROM ") {
+		table := strings.Fields(query)[3]
+		row, ok := d.rows[table]
+		if !ok {
+			return &mockRows{}, nil
+		}
+		var cols []string
+		var vals []any
+		for k, v := range row {
+			cols = append(cols, k)
+			vals = append(vals, v)
+		}
+		return &mockRows{cols: cols, values: [][]any{vals}}, nil
+	}
+
+	d.writes = append(d.writes, query)
+	d.writeArgs = append(d.writeArgs, args)
+	return &mockRows{cols: []string{"id"}, values: [][]any{{ruleTestTicketID}}}, nil
+}
+
+func postRuleAction(t *testing.T, s *Server, action, userID string, input map[string]any) (*httptest.ResponseRecorder, APIResponse) {
+	t.Helper()
+
+	body, _ := json.Marshal(input)
+	req := httptest.NewRequest("POST", "/api/actions/"+action, bytes.NewReader(body))
+	if userID != "" {
+		req = req.WithContext(context.WithValue(req.Context(), userContextKey{}, userID))
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	var resp APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return w, resp
+}
+
+func TestActionRules(t *testing.T) {
+	tests := []struct {
+		name        string
+		action      string
+		userID      string
+		input       map[string]any
+		rows        map[string]map[string]any
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+	}{
+		{
+			name:        "forbid on update rejects closed ticket",
+			action:      "close_ticket",
+			input:       map[string]any{"id": ruleTestTicketID, "status": "closed"},
+			rows:        map[string]map[string]any{"tickets": {"id": ruleTestTicketID, "status": "closed"}},
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    "TICKET_CLOSED",
+			wantMessage: "This ticket is already closed and cannot be modified.",
+		},
+		{
+			name:       "forbid on update evaluates stored row not input",
+			action:     "close_ticket",
+			input:      map[string]any{"id": ruleTestTicketID, "status": "closed"},
+			rows:       map[string]map[string]any{"tickets": {"id": ruleTestTicketID, "status": "open"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "forbid on delete rejects open ticket",
+			action:     "delete_ticket",
+			input:      map[string]any{"id": ruleTestTicketID},
+			rows:       map[string]map[string]any{"tickets": {"id": ruleTestTicketID, "status": "open"}},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   "TICKET_NOT_CLOSED",
+		},
+		{
+			name:       "update of missing row is not found",
+			action:     "close_ticket",
+			input:      map[string]any{"id": ruleTestTicketID},
+			wantStatus: http.StatusNotFound,
+			wantCode:   "NOT_FOUND",
+		},
+		{
+			name:        "require on create without message uses emit code",
+			action:      "add_comment",
+			input:       map[string]any{"body": ""},
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    "COMMENT_EMPTY",
+			wantMessage: "",
+		},
+		{
+			name:       "require on create passes",
+			action:     "add_comment",
+			input:      map[string]any{"body": "hello"},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "author may edit own comment",
+			action:     "edit_comment",
+			userID:     ruleTestUserID,
+			input:      map[string]any{"id": ruleTestTicketID, "body": "edited"},
+			rows:       map[string]map[string]any{"comments": {"id": ruleTestTicketID, "author_id": ruleTestUserID}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "non-author customer is rejected via user.role traversal",
+			action: "edit_comment",
+			userID: ruleTestUserID,
+			input:  map[string]any{"id": ruleTestTicketID, "body": "edited"},
+			rows: map[string]map[string]any{
+				"comments": {"id": ruleTestTicketID, "author_id": ruleTestOtherID},
+				"users":    {"id": ruleTestUserID, "role": "customer"},
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   "NOT_AUTHOR",
+		},
+		{
+			name:   "non-author agent passes",
+			action: "edit_comment",
+			userID: ruleTestUserID,
+			input:  map[string]any{"id": ruleTestTicketID, "body": "edited"},
+			rows: map[string]map[string]any{
+				"comments": {"id": ruleTestTicketID, "author_id": ruleTestOtherID},
+				"users":    {"id": ruleTestUserID, "role": "agent"},
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &rowsDB{rows: tt.rows}
+			s := createTestServerWithMockDB(t, helpdeskRulesArtifact(), &mockDB{queryFunc: fake.query})
+
+			w, resp := postRuleAction(t, s, tt.action, tt.userID, tt.input)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantCode == "" {
+				if len(fake.writes) != 1 {
+					t.Errorf("expected one write, got %v", fake.writes)
+				}
+				return
+			}
+
+			if len(fake.writes) != 0 {
+				t.Errorf("rejected action must not write, got %v", fake.writes)
+			}
+			if len(resp.Messages) != 1 || resp.Messages[0].Code != tt.wantCode {
+				t.Fatalf("messages = %+v, want code %s", resp.Messages, tt.wantCode)
+			}
+			if tt.wantMessage != "" && resp.Messages[0].Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", resp.Messages[0].Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+// The stored row rules see is locked, so a concurrent write cannot change it
+// between the rule check and the update.
+func TestActionRules_LockStoredRow(t *testing.T) {
+	for _, action := range []string{"close_ticket", "delete_ticket"} {
+		t.Run(action, func(t *testing.T) {
+			fake := &rowsDB{rows: map[string]map[string]any{"tickets": {"id": ruleTestTicketID, "status": "closed"}}}
+			var loads []string
+			mock := &mockDB{queryFunc: func(ctx context.Context, query string, args ...any) (db.Rows, error) {
+				if strings.HasPrefix(query, "SELECT * FROM tickets") {
+					loads = append(loads, query)
+				}
+				return fake.query(ctx, query, args...)
+			}}
+			s := createTestServerWithMockDB(t, helpdeskRulesArtifact(), mock)
+
+			w, _ := postRuleAction(t, s, action, "", map[string]any{"id": ruleTestTicketID, "status": "open"})
+			if w.Code >= 500 {
+				t.Fatalf("status = %d (body: %s)", w.Code, w.Body.String())
+			}
+			if len(loads) == 0 || !strings.HasSuffix(loads[0], " FOR UPDATE") {
+				t.Errorf("stored row loaded with %q, want SELECT ... FOR UPDATE", loads)
+			}
+		})
+	}
+}
+
+func TestEvaluateRules_InputPath(t *testing.T) {
+	artifact := helpdeskRulesArtifact()
+	artifact.Rules = []*RuleSchema{
+		{ID: "rule_1", Entity: "Ticket", Operation: "update", Condition: "((status == closed) && (input.status != open))", EmitCode: "TICKET_CLOSED", IsForbid: true},
+	}
+	s := createTestServerWithMockDB(t, artifact, &mockDB{})
+	entity := artifact.Entities["Ticket"]
+	current := map[string]any{"id": ruleTestTicketID, "status": "closed"}
+
+	if err := s.evaluateRules(context.Background(), s.db, entity, "update", current, map[string]any{"status": "open"}); err != nil {
+		t.Errorf("reopening should pass, got %v", err)
+	}
+
+	err := s.evaluateRules(context.Background(), s.db, entity, "update", current, map[string]any{"subject": "x"})
+	if _, ok := err.(*RuleViolation); !ok {
+		t.Errorf("expected RuleViolation, got %v", err)
+	}
+}
+
+func TestEvaluateRules_InvalidCondition(t *testing.T) {
+	artifact := helpdeskRulesArtifact()
+	artifact.Rules = []*RuleSchema{
+		{ID: "rule_1", Entity: "Ticket", Operation: "create", Condition: "(status ==", IsForbid: true},
+	}
+	s := createTestServerWithMockDB(t, artifact, &mockDB{})
+
+	err := s.evaluateRules(context.Background(), s.db, artifact.Entities["Ticket"], "create", map[string]any{}, nil)
+	if err == nil {
+		t.Fatal("expected error for invalid condition")
+	}
+	if _, ok := err.(*RuleViolation); ok {
+		t.Error("parse failures must not be reported as rule violations")
+	}
+}
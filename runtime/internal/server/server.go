@@ -5,7 +5,9 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
@@ -22,6 +24,7 @@ import (
 	"github.com/forge-lang/forge/runtime/internal/config"
 	"github.com/forge-lang/forge/runtime/internal/db"
 	"github.com/forge-lang/forge/runtime/internal/jobs"
+	"github.com/forge-lang/forge/runtime/internal/presence"
 	"github.com/forge-lang/forge/runtime/internal/provider"
 	"github.com/forge-lang/forge/runtime/internal/provider/builtin"
 	"github.com/forge-lang/forge/runtime/internal/security"
@@ -35,6 +38,7 @@ type Config struct {
 	RedisURL     string
 	LogLevel     string
 	ProjectDir   string // Project directory containing forge.runtime.toml
+	Testing      bool   // Run 'forge test': ephemeral database, no request logging or rate limits
 }
 
 // Server is the FORGE runtime server.
@@ -50,31 +54,58 @@ type Server struct {
 	watcher      *ArtifactWatcher
 	turnstile    *security.TurnstileVerifier
 	executor     *jobs.Executor // Job execution engine
+	scheduler    *jobs.Scheduler // Enqueues jobs with a cron schedule
+
+	// stopBackplane disconnects the hub from the other replicas
+	stopBackplane context.CancelFunc
+
+	// changePushes pushes entity changes to this replica's subscribers in
+	// order, off the goroutine of the request that made them
+	changePushes pushQueue
+
+	presences   presence.Store // entries of presence declarations
+	presenceTTL time.Duration  // for presences declaring no ttl
+
+	// stopPresence stops expiring presence entries
+	stopPresence context.CancelFunc
 }
 
 // Artifact represents the loaded runtime artifact.
 type Artifact struct {
-	Version   string                     `json:"version"`
-	AppName   string                     `json:"app_name"`
-	Auth      string                     `json:"auth"`
-	Database  string                     `json:"database"`
-	Entities  map[string]*EntitySchema   `json:"entities"`
-	Actions   map[string]*ActionSchema   `json:"actions"`
-	Rules     []*RuleSchema              `json:"rules"`
-	Access    map[string]*AccessSchema   `json:"access"`
-	Views     map[string]*ViewSchema     `json:"views"`
-	Jobs      map[string]*JobSchema      `json:"jobs"`
-	Hooks     []*HookSchema              `json:"hooks"`
-	Webhooks  map[string]*WebhookSchema  `json:"webhooks"`
-	Messages  map[string]*MessageSchema  `json:"messages"`
-	Migration *MigrationSchema           `json:"migration"`
+	Version     string                       `json:"version"`
+	AppName     string                       `json:"app_name"`
+	Auth        string                       `json:"auth"`
+	Database    string                       `json:"database"`
+	Entities    map[string]*EntitySchema     `json:"entities"`
+	Actions     map[string]*ActionSchema     `json:"actions"`
+	Rules       []*RuleSchema                `json:"rules"`
+	Access      map[string]*AccessSchema     `json:"access"`
+	Views       map[string]*ViewSchema       `json:"views"`
+	Presences   map[string]*PresenceSchema   `json:"presences,omitempty"`
+	Jobs        map[string]*JobSchema        `json:"jobs"`
+	Hooks       []*HookSchema                `json:"hooks"`
+	Webhooks    map[string]*WebhookSchema    `json:"webhooks"`
+	Imperatives map[string]*ImperativeSchema `json:"imperatives"`
+	Messages    map[string]*MessageSchema    `json:"messages"`
+	Migration   *MigrationSchema             `json:"migration"`
 }
 
 // MigrationSchema represents the database migration.
 type MigrationSchema struct {
-	Version string   `json:"version"`
-	Up      []string `json:"up"`
-	Down    []string `json:"down"`
+	Version string              `json:"version"`
+	Up      []string            `json:"up"`
+	Down    []string            `json:"down"`
+	Steps   []*db.MigrationStep `json:"steps,omitempty"`
+}
+
+// dbMigration converts the artifact's migration for the db package.
+func (m *MigrationSchema) dbMigration() *db.Migration {
+	return &db.Migration{
+		Version: m.Version,
+		Up:      m.Up,
+		Down:    m.Down,
+		Steps:   m.Steps,
+	}
 }
 
 // EntitySchema represents an entity.
@@ -94,6 +125,9 @@ type FieldSchema struct {
 	Unique     bool        `json:"unique"`
 	Default    interface{} `json:"default,omitempty"`
 	EnumValues []string    `json:"enum_values,omitempty"`
+	MaxLength  int         `json:"max_length,omitempty"`
+	Hidden     bool        `json:"hidden,omitempty"` // never read through the API
+	Read       string      `json:"read,omitempty"`   // CEL condition on the user reading the field
 }
 
 // RelSchema represents a relation.
@@ -104,15 +138,42 @@ type RelSchema struct {
 	ForeignKey  string `json:"foreign_key"`
 	IsMany      bool   `json:"is_many"`
 	OnDelete    string `json:"on_delete"`
+	JoinTable   string `json:"join_table,omitempty"` // many relations only
+	JoinKey     string `json:"join_key,omitempty"`   // join table column referencing the owner
+	TargetKey   string `json:"target_key,omitempty"` // join table column referencing the target
 }
 
-// ActionSchema represents an action.
+// ActionSchema represents an action. An action either operates on its
+// InputEntity, or validates the fields of its Input and runs its Steps.
 type ActionSchema struct {
-	Name         string   `json:"name"`
-	InputEntity  string   `json:"input_entity"`
-	Operation    string   `json:"operation,omitempty"`     // "create", "update", "delete"
-	TargetEntity string   `json:"target_entity,omitempty"` // entity being created/updated/deleted
-	Rules        []string `json:"rules"`
+	Name         string               `json:"name"`
+	InputEntity  string               `json:"input_entity"`
+	Operation    string               `json:"operation,omitempty"`     // "create", "update", "delete"
+	TargetEntity string               `json:"target_entity,omitempty"` // entity being created/updated/deleted
+	Rules        []string             `json:"rules"`
+	Input        []*ActionInputSchema `json:"input,omitempty"`
+	Steps        []*ActionStepSchema  `json:"steps,omitempty"`
+}
+
+// ActionInputSchema represents a field of an action's input block. A field
+// referring to a record holds its id and names its entity.
+type ActionInputSchema struct {
+	FieldSchema
+	Entity    string `json:"entity,omitempty"`
+	MinLength int    `json:"min_length,omitempty"`
+}
+
+// ActionStepSchema represents a set, create, emit or reject statement in an
+// action.
+type ActionStepSchema struct {
+	Kind      string            `json:"kind"`
+	Entity    string            `json:"entity,omitempty"` // entity set or created
+	Record    string            `json:"record,omitempty"` // input field holding the id of the record set
+	Field     string            `json:"field,omitempty"`
+	Value     string            `json:"value,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`  // create only
+	Message   string            `json:"message,omitempty"` // emit and reject
+	Condition string            `json:"condition,omitempty"`
 }
 
 // RuleSchema represents a rule.
@@ -132,6 +193,8 @@ type AccessSchema struct {
 	Table    string `json:"table"`
 	ReadSQL  string `json:"read_sql"`
 	WriteSQL string `json:"write_sql"`
+	ReadCEL  string `json:"read_cel"`
+	WriteCEL string `json:"write_cel"`
 }
 
 // ViewSchema represents a view.
@@ -143,8 +206,26 @@ type ViewSchema struct {
 	Joins        []ViewJoin  `json:"joins,omitempty"`
 	Filter       string      `json:"filter,omitempty"`
 	Params       []string    `json:"params,omitempty"`
+	ParamColumns []string    `json:"param_columns,omitempty"` // source column each param is compared with
 	DefaultSort  []ViewSort  `json:"default_sort,omitempty"`
 	Dependencies []string    `json:"dependencies"`
+	Presence     bool        `json:"presence,omitempty"`  // reads the presence store instead of SQL
+	Condition    string      `json:"condition,omitempty"` // CEL filter of a presence view
+}
+
+// PresenceSchema represents a presence. Entries refer to their source and
+// scope by SourceField and Scope; ScopeVia names the entity declaring
+// ScopeRelation, "source" or "scope".
+type PresenceSchema struct {
+	Name          string                  `json:"name"`
+	Source        string                  `json:"source"`
+	SourceField   string                  `json:"source_field"`
+	Scope         string                  `json:"scope"`
+	ScopeEntity   string                  `json:"scope_entity"`
+	ScopeRelation string                  `json:"scope_relation"`
+	ScopeVia      string                  `json:"scope_via"`
+	TTLMs         int64                   `json:"ttl_ms,omitempty"`
+	Fields        map[string]*FieldSchema `json:"fields"`
 }
 
 // ViewField represents a resolved field in a view.
@@ -155,6 +236,7 @@ type ViewField struct {
 	Type       string `json:"type"`
 	Filterable bool   `json:"filterable"`
 	Sortable   bool   `json:"sortable"`
+	Read       string `json:"read,omitempty"`
 }
 
 // ViewJoin represents a JOIN required by a view.
@@ -175,17 +257,47 @@ type ViewSort struct {
 type JobSchema struct {
 	Name          string            `json:"name"`
 	InputEntity   string            `json:"input_entity"`
+	NeedsPath     string            `json:"needs_path,omitempty"`
+	NeedsFilter   string            `json:"needs_filter,omitempty"`
 	Capabilities  []string          `json:"capabilities"`
+	Imperative    string            `json:"imperative,omitempty"`
 	TargetEntity  string            `json:"target_entity,omitempty"`
 	FieldMappings map[string]string `json:"field_mappings,omitempty"`
+	Schedule      string            `json:"schedule,omitempty"`
+	MaxAttempts   int               `json:"max_attempts,omitempty"`
+	Backoff       *BackoffSchema    `json:"backoff,omitempty"`
+	TimeoutMs     int64             `json:"timeout_ms,omitempty"`
+}
+
+// BackoffSchema represents a job's retry backoff.
+type BackoffSchema struct {
+	Strategy string `json:"strategy"`
+	BaseMs   int64  `json:"base_ms"`
+	MaxMs    int64  `json:"max_ms,omitempty"`
 }
 
 // HookSchema represents a hook.
 type HookSchema struct {
-	Entity    string   `json:"entity"`
-	Timing    string   `json:"timing"`
-	Operation string   `json:"operation"`
-	Jobs      []string `json:"jobs"`
+	Entity    string            `json:"entity"`
+	Timing    string            `json:"timing"`
+	Operation string            `json:"operation"`
+	Jobs      []string            `json:"jobs"`
+	Delayed   []*DelayedJobSchema `json:"delayed,omitempty"`
+	Steps     []*HookStepSchema   `json:"steps,omitempty"`
+}
+
+// DelayedJobSchema is a job a hook enqueues to run after a delay.
+type DelayedJobSchema struct {
+	Job     string `json:"job"`
+	DelayMs int64  `json:"delay_ms"`
+}
+
+// HookStepSchema represents a before/after hook step (emit, reject, set).
+type HookStepSchema struct {
+	Kind      string `json:"kind"`
+	Target    string `json:"target"`
+	Value     string `json:"value,omitempty"`
+	Condition string `json:"condition,omitempty"`
 }
 
 // MessageSchema represents a message.
@@ -205,6 +317,15 @@ type WebhookSchema struct {
 	Action   string   `json:"action"`
 }
 
+// ImperativeSchema represents an imperative function.
+type ImperativeSchema struct {
+	Name        string   `json:"name"`
+	Route       string   `json:"route"`
+	InputEntity string   `json:"input_entity,omitempty"`
+	Returns     string   `json:"returns,omitempty"`
+	Effects     []string `json:"effects,omitempty"`
+}
+
 // New creates a new Server.
 func New(cfg *Config) (*Server, error) {
 	// Setup logger first
@@ -222,7 +343,11 @@ func New(cfg *Config) (*Server, error) {
 		level = slog.LevelInfo
 	}
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	var logOutput io.Writer = os.Stdout
+	if cfg.Testing && cfg.LogLevel == "" {
+		logOutput = io.Discard
+	}
+	logger := slog.New(slog.NewJSONHandler(logOutput, &slog.HandlerOptions{Level: level}))
 
 	// Load artifact
 	artifactData, err := os.ReadFile(cfg.ArtifactPath)
@@ -235,6 +360,11 @@ func New(cfg *Config) (*Server, error) {
 		return nil, fmt.Errorf("failed to parse artifact: %w", err)
 	}
 
+	// Every declared imperative needs a Go implementation compiled in
+	if err := checkImperatives(&artifact); err != nil {
+		return nil, err
+	}
+
 	// Determine project directory from artifact path
 	projectDir := cfg.ProjectDir
 	if projectDir == "" {
@@ -254,6 +384,22 @@ func New(cfg *Config) (*Server, error) {
 		runtimeConf.Database.Postgres.URL = cfg.DatabaseURL
 	}
 
+	// Tests run against a throwaway embedded database unless one is given
+	if cfg.Testing && cfg.DatabaseURL == "" {
+		port, err := freePort()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find a port for the test database: %w", err)
+		}
+		runtimeConf.Database.Adapter = "embedded"
+		runtimeConf.Database.Embedded.Ephemeral = true
+		runtimeConf.Database.Embedded.Port = port
+	}
+	if cfg.Testing {
+		runtimeConf.Jobs.Backend = "memory"
+		runtimeConf.Realtime.Backplane = "memory"
+		runtimeConf.Presence.Backend = "memory"
+	}
+
 	// Resolve secrets from environment
 	runtimeConf.ResolveSecrets()
 
@@ -282,21 +428,16 @@ func New(cfg *Config) (*Server, error) {
 		logger.Info("connected to external PostgreSQL")
 	}
 
-	// Apply migrations from artifact
+	// Apply pending migrations from artifact. They may run well past the
+	// connect timeout, so they do not share its context.
 	if artifact.Migration != nil {
-		migration := &db.Migration{
-			Version: artifact.Migration.Version,
-			Up:      artifact.Migration.Up,
-			Down:    artifact.Migration.Down,
-		}
-
-		result, err := db.ApplyMigrationWithLog(ctx, database, migration, logger)
+		result, err := applyMigrations(context.Background(), database, artifact.Migration, logger)
 		if err != nil {
 			database.Close()
 			return nil, fmt.Errorf("failed to apply migration: %w", err)
 		}
 
-		logger.Info("schema ready", "applied", result.Applied, "skipped", result.Skipped)
+		logger.Info("schema ready", "version", artifact.Migration.Version, "applied", result.Applied, "skipped", result.Skipped)
 	}
 
 	// Initialize provider registry with config from forge.runtime.toml
@@ -318,6 +459,26 @@ func New(cfg *Config) (*Server, error) {
 	}
 	executor := jobs.NewExecutor(registry, logger, workerCount)
 
+	switch runtimeConf.Jobs.Backend {
+	case "postgres":
+		queue, err := jobs.NewPostgresQueue(ctx, database)
+		if err != nil {
+			database.Close()
+			return nil, fmt.Errorf("failed to set up job queue: %w", err)
+		}
+		if secs := runtimeConf.Jobs.VisibilityTimeoutSeconds; secs > 0 {
+			queue.VisibilityTimeout = time.Duration(secs) * time.Second
+		}
+		if ms := runtimeConf.Jobs.PollIntervalMs; ms > 0 {
+			queue.PollInterval = time.Duration(ms) * time.Millisecond
+		}
+		executor.SetQueue(queue)
+		logger.Info("using postgres job queue", "visibility_timeout", queue.VisibilityTimeout)
+	case "memory", "":
+	default:
+		logger.Warn("job backend not supported, using in-memory queue", "backend", runtimeConf.Jobs.Backend)
+	}
+
 	s := &Server{
 		config:      cfg,
 		runtimeConf: runtimeConf,
@@ -327,8 +488,55 @@ func New(cfg *Config) (*Server, error) {
 		hub:         NewHub(),
 		logger:      logger,
 		executor:    executor,
+		scheduler:   jobs.NewScheduler(executor, logger),
 	}
 
+	switch runtimeConf.Realtime.Backplane {
+	case "postgres":
+		backplane, err := NewPostgresBackplane(ctx, database, logger)
+		if err != nil {
+			database.Close()
+			return nil, fmt.Errorf("failed to set up hub backplane: %w", err)
+		}
+		backplaneCtx, stop := context.WithCancel(context.Background())
+		if err := s.connectBackplane(backplaneCtx, backplane); err != nil {
+			stop()
+			database.Close()
+			return nil, fmt.Errorf("failed to connect hub backplane: %w", err)
+		}
+		s.stopBackplane = stop
+		logger.Info("using postgres hub backplane")
+	case "memory", "":
+	default:
+		logger.Warn("hub backplane not supported, broadcasts stay in this process", "backplane", runtimeConf.Realtime.Backplane)
+	}
+
+	s.presences = presence.NewMemoryStore()
+	switch runtimeConf.Presence.Backend {
+	case "postgres":
+		store, err := presence.NewPostgresStore(ctx, database)
+		if err != nil {
+			database.Close()
+			return nil, fmt.Errorf("failed to set up presence store: %w", err)
+		}
+		s.presences = store
+		logger.Info("using postgres presence store")
+	case "memory", "":
+	default:
+		logger.Warn("presence backend not supported, using in-memory store", "backend", runtimeConf.Presence.Backend)
+	}
+	s.presenceTTL = defaultPresenceTTL
+	if ttl, err := time.ParseDuration(runtimeConf.Presence.DefaultTTL); err == nil && ttl > 0 {
+		s.presenceTTL = ttl
+	} else if runtimeConf.Presence.DefaultTTL != "" {
+		logger.Warn("invalid presence default_ttl, using 5m", "default_ttl", runtimeConf.Presence.DefaultTTL)
+	}
+
+	if err := s.scheduler.SetSchedules(s.jobSchemas()); err != nil {
+		logger.Warn("some job schedules were skipped", "error", err)
+	}
+	executor.SetNeedsResolver(&needsResolver{s: s})
+
 	// Wire up the entity provider with the server's database writer.
 	// The entity provider is registered during init() and needs a concrete
 	// EntityWriter implementation to perform INSERT operations from jobs.
@@ -339,6 +547,13 @@ func New(cfg *Config) (*Server, error) {
 		}
 	}
 
+	// Wire up the imperative provider so jobs can call imperative functions.
+	if ip := registry.GetProvider("imperative"); ip != nil {
+		if impProv, ok := ip.(*builtin.ImperativeProvider); ok {
+			impProv.SetRunner(s)
+		}
+	}
+
 	// Initialize Turnstile verifier if configured
 	if runtimeConf.Security.Turnstile.SecretKey != "" {
 		s.turnstile = security.NewTurnstileVerifier(runtimeConf.Security.Turnstile.SecretKey)
@@ -363,6 +578,9 @@ func (s *Server) setupRoutes() {
 	if s.runtimeConf.Security.Enabled != nil {
 		secEnabled = *s.runtimeConf.Security.Enabled
 	}
+	if s.config.Testing {
+		secEnabled = false
+	}
 	botEnabled := true
 	if s.runtimeConf.Security.BotFilter.Enabled != nil {
 		botEnabled = *s.runtimeConf.Security.BotFilter.Enabled
@@ -377,7 +595,9 @@ func (s *Server) setupRoutes() {
 		Logger:           s.logger,
 	}))
 
-	r.Use(middleware.Logger)
+	if !s.config.Testing {
+		r.Use(middleware.Logger)
+	}
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
 
@@ -425,6 +645,9 @@ func (s *Server) setupRoutes() {
 		// Views
 		r.Get("/views/{view}", s.handleView)
 
+		// Imperative functions
+		r.Post("/imperative/{name}", s.handleImperative)
+
 		// Entities (CRUD)
 		r.Route("/entities/{entity}", func(r chi.Router) {
 			r.Get("/", s.handleList)
@@ -432,6 +655,11 @@ func (s *Server) setupRoutes() {
 			r.Post("/", s.handleCreate)
 			r.Put("/{id}", s.handleUpdate)
 			r.Delete("/{id}", s.handleDelete)
+
+			// Links of many relations
+			r.Get("/{id}/{relation}", s.handleListLinks)
+			r.Post("/{id}/{relation}", s.handleAddLink)
+			r.Delete("/{id}/{relation}/{target}", s.handleRemoveLink)
 		})
 	})
 
@@ -473,6 +701,14 @@ func (s *Server) Run() error {
 		s.executor.Start()
 		go s.drainJobResults()
 	}
+	if s.scheduler != nil {
+		s.scheduler.Start()
+	}
+
+	// Expire presence entries
+	presenceCtx, stopPresence := context.WithCancel(context.Background())
+	s.stopPresence = stopPresence
+	go s.expirePresence(presenceCtx, presenceSweepInterval)
 
 	// Start artifact watcher for hot reload (development mode only)
 	s.startWatcher()
@@ -499,12 +735,23 @@ func (s *Server) Run() error {
 			s.logger.Error("server shutdown error", "error", err)
 		}
 
+		// Stop the scheduler before the executor it enqueues into
+		if s.scheduler != nil {
+			s.scheduler.Stop()
+		}
+
 		// Stop job executor (drain in-flight jobs)
 		if s.executor != nil {
 			s.logger.Info("stopping job executor")
 			s.executor.Stop()
 		}
 
+		// Stop listening and expiring before the database closes
+		if s.stopBackplane != nil {
+			s.stopBackplane()
+		}
+		s.stopPresence()
+
 		// Close database connection
 		if s.db != nil {
 			s.logger.Info("closing database connection")
@@ -531,9 +778,18 @@ func (s *Server) Close() error {
 	if s.watcher != nil {
 		s.watcher.Stop()
 	}
+	if s.scheduler != nil {
+		s.scheduler.Stop()
+	}
 	if s.executor != nil {
 		s.executor.Stop()
 	}
+	if s.stopBackplane != nil {
+		s.stopBackplane()
+	}
+	if s.stopPresence != nil {
+		s.stopPresence()
+	}
 	if s.db != nil {
 		return s.db.Close()
 	}
@@ -543,11 +799,21 @@ func (s *Server) Close() error {
 // InsertEntity implements builtin.EntityWriter. It builds a parameterized INSERT
 // statement from the given table and fields and executes it against the server's
 // database. Column order is deterministic (sorted) to produce stable queries.
+//
+// Inserts come from jobs, which act for the system principal: write access
+// is bypassed and the bypass is audited.
 func (s *Server) InsertEntity(ctx context.Context, table string, fields map[string]any) error {
 	if len(fields) == 0 {
 		return fmt.Errorf("InsertEntity: no fields provided")
 	}
 
+	ctx = withSystemPrincipal(ctx, "job:entity.create")
+	if entity := s.entityByTable(table); entity != nil {
+		if err := s.checkWriteAccess(ctx, s.db, entity, fields); err != nil {
+			return fmt.Errorf("InsertEntity into %s: %w", table, err)
+		}
+	}
+
 	// Sort column names for deterministic query ordering.
 	columns := make([]string, 0, len(fields))
 	for col := range fields {
@@ -590,6 +856,22 @@ func (s *Server) getArtifact() *Artifact {
 	return s.artifact
 }
 
+// applyMigrations applies the pending steps of an artifact's migration. The
+// server does not apply changes that drop or rewrite data on its own: it
+// refuses them, and the operator applies them with
+// 'forge migrate -apply -allow-dangerous' after reviewing them.
+func applyMigrations(ctx context.Context, database db.Database, migration *MigrationSchema, logger *slog.Logger) (*db.MigrationResult, error) {
+	result, err := db.ApplyMigrations(ctx, database, migration.dbMigration(), false, logger)
+	var dangerous *db.DangerousMigrationError
+	if errors.As(err, &dangerous) {
+		for _, d := range dangerous.Changes {
+			logger.Error("dangerous migration", "statement", d.Statement, "reason", d.Reason)
+		}
+		return nil, fmt.Errorf("%w; review them with 'forge migrate -plan' and apply them with 'forge migrate -apply -allow-dangerous'", err)
+	}
+	return result, err
+}
+
 // ReloadArtifact reloads the artifact from disk and broadcasts the change.
 func (s *Server) ReloadArtifact() error {
 	artifactData, err := os.ReadFile(s.config.ArtifactPath)
@@ -601,6 +883,16 @@ func (s *Server) ReloadArtifact() error {
 	if err := json.Unmarshal(artifactData, &newArtifact); err != nil {
 		return fmt.Errorf("failed to parse artifact: %w", err)
 	}
+	if err := checkImperatives(&newArtifact); err != nil {
+		return err
+	}
+
+	// Apply schema changes from the rebuild before serving the new artifact
+	if newArtifact.Migration != nil {
+		if _, err := applyMigrations(context.Background(), s.db, newArtifact.Migration, s.logger); err != nil {
+			return fmt.Errorf("failed to apply migration: %w", err)
+		}
+	}
 
 	// Swap artifact atomically
 	s.artifactMu.Lock()
@@ -609,6 +901,12 @@ func (s *Server) ReloadArtifact() error {
 
 	s.logger.Info("artifact reloaded", "app", newArtifact.AppName, "version", newArtifact.Version)
 
+	if s.scheduler != nil {
+		if err := s.scheduler.SetSchedules(s.jobSchemas()); err != nil {
+			s.logger.Warn("some job schedules were skipped", "error", err)
+		}
+	}
+
 	// Broadcast reload event to all connected WebSocket clients
 	s.hub.BroadcastToAll("artifact_reload", map[string]string{
 		"app":     newArtifact.AppName,
@@ -643,6 +941,7 @@ type APIResponse struct {
 // Message represents an error/info message.
 type Message struct {
 	Code    string `json:"code"`
+	Level   string `json:"level,omitempty"`
 	Message string `json:"message,omitempty"`
 }
 
@@ -655,6 +954,18 @@ func (s *Server) respond(w http.ResponseWriter, status int, data interface{}) {
 	})
 }
 
+// respondWithMessages is respond with informational messages, such as those
+// emitted by hooks, attached to the envelope.
+func (s *Server) respondWithMessages(w http.ResponseWriter, status int, data interface{}, messages []Message) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:   "ok",
+		Data:     data,
+		Messages: messages,
+	})
+}
+
 func (s *Server) respondError(w http.ResponseWriter, status int, messages ...Message) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -679,8 +990,27 @@ func (s *Server) handleArtifact(w http.ResponseWriter, r *http.Request) {
 	s.respond(w, http.StatusOK, s.getArtifact())
 }
 
+// handleWebSocket upgrades the connection. A socket authenticates with the
+// Authorization header or a ?token= parameter on connect, since browsers
+// cannot set headers on WebSocket requests, or with an auth message later.
+// A socket without a token is anonymous.
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	ServeWs(s.hub, w, r)
+	// The Authorization header is verified here rather than taken from
+	// authMiddleware, which accepts unsigned tokens without a password provider
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); token == "" && strings.HasPrefix(auth, "Bearer ") {
+		token = auth[7:]
+	}
+	userID := ""
+	if token != "" {
+		id, err := s.verifiedUserID(token)
+		if err != nil {
+			s.respondError(w, http.StatusUnauthorized, Message{Code: AuthInvalidToken, Message: "Invalid token"})
+			return
+		}
+		userID = id
+	}
+	ServeWs(s.hub, w, r, userID, s.verifiedUserID, s)
 }
 
 // userContextKey is the context key for user ID
@@ -690,34 +1020,12 @@ type userContextKey struct{}
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		auth := r.Header.Get("Authorization")
-		if auth == "" {
-			next.ServeHTTP(w, r)
-			return
-		}
 
 		// Extract Bearer token
 		if len(auth) > 7 && auth[:7] == "Bearer " {
-			token := auth[7:]
-
-			// Use proper JWT validation when password auth is enabled with a secret
-			if s.runtimeConf.Auth.Provider == "password" && s.runtimeConf.Auth.JWT.Secret != "" {
-				claims, err := s.validateToken(token)
-				if err == nil && claims.TokenType == "access" {
-					ctx := context.WithValue(r.Context(), userContextKey{}, claims.UserID)
-					r = r.WithContext(ctx)
-				}
-			} else {
-				// Fallback: Decode base64 JWT payload (simple mock JWT for testing)
-				if decoded, err := base64Decode(token); err == nil {
-					var claims map[string]interface{}
-					if err := json.Unmarshal(decoded, &claims); err == nil {
-						if sub, ok := claims["sub"].(string); ok {
-							// Add user ID to context
-							ctx := context.WithValue(r.Context(), userContextKey{}, sub)
-							r = r.WithContext(ctx)
-						}
-					}
-				}
+			if userID, err := s.userIDFromToken(auth[7:]); err == nil {
+				ctx := context.WithValue(r.Context(), userContextKey{}, userID)
+				r = r.WithContext(ctx)
 			}
 		}
 
@@ -725,6 +1033,46 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// userIDFromToken returns the user an access token was issued to.
+func (s *Server) userIDFromToken(token string) (string, error) {
+	// Use proper JWT validation when password auth is enabled with a secret
+	if s.runtimeConf.Auth.Provider == "password" && s.runtimeConf.Auth.JWT.Secret != "" {
+		return s.verifiedUserID(token)
+	}
+
+	// Fallback: Decode base64 JWT payload (simple mock JWT for testing)
+	decoded, err := base64Decode(token)
+	if err != nil {
+		return "", err
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(decoded, &claims); err != nil {
+		return "", err
+	}
+	sub, ok := claims["sub"].(string)
+	if !ok {
+		return "", errors.New("token has no subject")
+	}
+	return sub, nil
+}
+
+// verifiedUserID returns the user an access token signed with the configured
+// secret was issued to. WebSocket tokens must be signed: without a secret
+// every token is rejected rather than trusting an unsigned subject.
+func (s *Server) verifiedUserID(token string) (string, error) {
+	if s.runtimeConf.Auth.JWT.Secret == "" {
+		return "", errors.New("no token secret is configured")
+	}
+	claims, err := s.validateToken(token)
+	if err != nil {
+		return "", err
+	}
+	if claims.TokenType != "access" {
+		return "", errors.New("not an access token")
+	}
+	return claims.UserID, nil
+}
+
 // getUserID extracts user ID from request context
 func getUserID(r *http.Request) string {
 	if id, ok := r.Context().Value(userContextKey{}).(string); ok {
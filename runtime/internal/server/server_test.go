@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"io"
@@ -15,6 +16,9 @@ import (
 	"github.com/go-chi/chi/v5"
 
 	"github.com/forge-lang/forge/runtime/internal/config"
+	"github.com/forge-lang/forge/runtime/internal/db"
+	"github.com/forge-lang/forge/runtime/internal/jobs"
+	"github.com/forge-lang/forge/runtime/internal/provider"
 )
 
 // createTestArtifact creates a minimal artifact for testing
@@ -265,6 +269,107 @@ func TestDevEndpointsInProduction(t *testing.T) {
 	}
 }
 
+// TestDevDeadJobs tests listing, inspecting, replaying and discarding dead jobs
+func TestDevDeadJobs(t *testing.T) {
+	originalEnv := os.Getenv("FORGE_ENV")
+	os.Setenv("FORGE_ENV", "development")
+	defer os.Setenv("FORGE_ENV", originalEnv)
+
+	s := createTestServerWithoutDB(t)
+
+	s.executor = jobs.NewExecutor(provider.Global(), s.logger, 1)
+	s.executor.Start()
+	if err := s.executor.Enqueue(&jobs.Job{ID: "job_dead", Name: "notify", Capability: "missing.call"}); err != nil {
+		t.Fatal(err)
+	}
+	<-s.executor.Results()
+	s.executor.Stop()
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		contains string
+	}{
+		{"GET", "/_dev/jobs/dead", http.StatusOK, "job_dead"},
+		{"GET", "/_dev/jobs/dead/job_dead", http.StatusOK, "no provider for capability"},
+		{"GET", "/_dev/jobs/dead/job_missing", http.StatusNotFound, "JOB_NOT_FOUND"},
+		{"POST", "/_dev/jobs/dead/job_dead/replay", http.StatusOK, "pending"},
+		{"DELETE", "/_dev/jobs/dead/job_dead", http.StatusNotFound, "JOB_NOT_FOUND"},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		rr := httptest.NewRecorder()
+
+		s.router.ServeHTTP(rr, req)
+
+		if rr.Code != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.path, tc.status, rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), tc.contains) {
+			t.Errorf("%s %s: expected body to contain %q, got %s", tc.method, tc.path, tc.contains, rr.Body.String())
+		}
+	}
+}
+
+func TestReloadArtifact_Migrations(t *testing.T) {
+	reload := func(t *testing.T, steps []map[string]any) (*Server, []string, error) {
+		t.Helper()
+		s := createTestServerWithoutDB(t)
+		execs := new([]string)
+		s.db = &mockDB{execFunc: func(ctx context.Context, query string, args ...any) (db.Result, error) {
+			*execs = append(*execs, query)
+			return &mockResult{}, nil
+		}}
+		data, err := json.Marshal(map[string]any{
+			"app_name":  "TestApp",
+			"version":   "2.0.0",
+			"migration": map[string]any{"version": "002", "steps": steps},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(s.config.ArtifactPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		err = s.ReloadArtifact()
+		return s, *execs, err
+	}
+
+	t.Run("applies safe steps", func(t *testing.T) {
+		s, execs, err := reload(t, []map[string]any{
+			{"version": "001", "up": []string{"CREATE TABLE IF NOT EXISTS tickets (id uuid);"}},
+			{"version": "002", "up": []string{"ALTER TABLE tickets ADD COLUMN IF NOT EXISTS priority integer;"}},
+		})
+		if err != nil {
+			t.Fatalf("ReloadArtifact: %v", err)
+		}
+		if !strings.Contains(strings.Join(execs, "\n"), "ADD COLUMN IF NOT EXISTS priority") {
+			t.Errorf("expected step 002 to be applied, got %v", execs)
+		}
+		if s.getArtifact().Version != "2.0.0" {
+			t.Error("expected the new artifact to be served")
+		}
+	})
+
+	t.Run("refuses dangerous steps", func(t *testing.T) {
+		s, execs, err := reload(t, []map[string]any{
+			{"version": "001", "up": []string{"CREATE TABLE IF NOT EXISTS tickets (id uuid);"}},
+			{"version": "002", "up": []string{"ALTER TABLE tickets DROP COLUMN IF EXISTS priority;"}},
+		})
+		if err == nil || !strings.Contains(err.Error(), "forge migrate -apply -allow-dangerous") {
+			t.Fatalf("expected the reload to be refused, got %v", err)
+		}
+		if s.getArtifact().Version == "2.0.0" {
+			t.Error("the new artifact must not be served")
+		}
+		if strings.Contains(strings.Join(execs, "\n"), "tickets") {
+			t.Errorf("expected no migration to run, got %v", execs)
+		}
+	})
+}
+
 // TestAuthMiddleware tests the authentication middleware
 func TestAuthMiddleware(t *testing.T) {
 	s := createTestServerWithoutDB(t)
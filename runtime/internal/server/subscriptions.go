@@ -0,0 +1,549 @@
+// Package server provides view subscriptions and their invalidation.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/forge-lang/forge/runtime/internal/query"
+)
+
+// Clients subscribe to a declared view with a query, or to a topic: one
+// parameterization of a view with the param values appended in view.Params
+// order, as in "ChannelMessages:<channel_id>". When an entity changes, every
+// view that depends on it is invalidated. View subscriptions run their query
+// again and receive the changes to their page. Topic subscribers receive the
+// changed row when it is all the view shows of the change, otherwise the
+// view's first page is queried again and pushed whole.
+
+// viewParamColumns returns the source column each of view's params is
+// compared with, in view.Params order, as the compiler records them. exact
+// reports whether the filter is nothing but these comparisons, so that a
+// row's columns alone decide which parameterization it belongs to.
+func viewParamColumns(view *ViewSchema) (columns []string, exact bool) {
+	if view.Filter == "" {
+		return nil, true
+	}
+	if len(view.Params) == 0 || len(view.ParamColumns) != len(view.Params) {
+		return nil, false
+	}
+	return view.ParamColumns, true
+}
+
+// dependentViews returns the views that depend on entityName, by name.
+func (s *Server) dependentViews(entityName string) []*ViewSchema {
+	var views []*ViewSchema
+	for _, view := range s.getArtifact().Views {
+		for _, dep := range view.Dependencies {
+			if dep == entityName {
+				views = append(views, view)
+				break
+			}
+		}
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views
+}
+
+// hasParamViews reports whether entityName is the source of a view with
+// params.
+func (s *Server) hasParamViews(entityName string) bool {
+	for _, view := range s.getArtifact().Views {
+		if view.Source == entityName && len(view.Params) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceParamColumns returns the param columns of the views over
+// entityName.
+func (s *Server) sourceParamColumns(entityName string) []string {
+	var columns []string
+	for _, view := range s.dependentViews(entityName) {
+		if view.Source != entityName {
+			continue
+		}
+		viewColumns, _ := viewParamColumns(view)
+		for _, column := range viewColumns {
+			if !slices.Contains(columns, column) {
+				columns = append(columns, column)
+			}
+		}
+	}
+	return columns
+}
+
+// affectedSubscriptions returns the subscription keys of view that change
+// may affect, and whether the changed row is all the view shows of it. A row
+// of the source carrying its param columns affects only its own
+// parameterization, and an update that changed them also the one the row
+// left; any other change affects every subscribed one. Deleted rows and rows
+// that moved are not pushed: the parameterizations they affect are queried
+// again.
+func (s *Server) affectedSubscriptions(view *ViewSchema, change *entityChange) (keys []string, rowOnly bool) {
+	source := s.getArtifact().Entities[view.Source]
+	if view.Source != change.Entity || source == nil {
+		return s.hub.SubscribedKeys(view.Name), false
+	}
+
+	columns, exact := viewParamColumns(view)
+	rowOnly = exact && len(view.Joins) == 0 && change.Operation != "delete"
+	if len(view.Params) == 0 {
+		return []string{view.Name}, rowOnly
+	}
+	if !exact {
+		return s.hub.SubscribedKeys(view.Name), false
+	}
+
+	// A delete carries only the id; the stored row has the params
+	record := change.Record
+	if change.Operation == "delete" {
+		record = change.Previous
+	}
+	key, ok := subscriptionKey(view, columns, record)
+	if !ok {
+		return s.hub.SubscribedKeys(view.Name), rowOnly
+	}
+	if change.Operation == "update" {
+		if old, ok := subscriptionKey(view, columns, change.Previous); ok && old != key {
+			return []string{old, key}, false
+		}
+	}
+	return []string{key}, rowOnly
+}
+
+// subscriptionKey returns the key of the parameterization of view that
+// record belongs to, given the param columns of view. ok is false when record
+// lacks one of them.
+func subscriptionKey(view *ViewSchema, columns []string, record map[string]interface{}) (key string, ok bool) {
+	key = view.Name
+	for _, column := range columns {
+		v, ok := record[column]
+		if !ok || v == nil {
+			return "", false
+		}
+		key += fmt.Sprintf(":%v", v)
+	}
+	return key, true
+}
+
+// pushQueue runs pushes one at a time in the order they were queued, on a
+// goroutine of its own while any are pending. The zero value is ready to
+// use.
+type pushQueue struct {
+	mu      sync.Mutex
+	idle    sync.Cond
+	pending []func()
+	running bool
+}
+
+// run queues push.
+func (q *pushQueue) run(push func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, push)
+	if !q.running {
+		q.running = true
+		go q.drain()
+	}
+}
+
+func (q *pushQueue) drain() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.pending) > 0 {
+		push := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+		push()
+		q.mu.Lock()
+	}
+	q.running = false
+	q.cond().Broadcast()
+}
+
+// wait returns once every queued push has run.
+func (q *pushQueue) wait() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.running {
+		q.cond().Wait()
+	}
+}
+
+func (q *pushQueue) cond() *sync.Cond {
+	if q.idle.L == nil {
+		q.idle.L = &q.mu
+	}
+	return &q.idle
+}
+
+// pushViewChanges invalidates the subscriptions of every view depending on
+// the changed entity. allow filters row pushes as for pushRecord; re-queried
+// results are filtered by each subscriber's access.
+func (s *Server) pushViewChanges(change *entityChange, allow func(*Client) bool) {
+	for _, view := range s.dependentViews(change.Entity) {
+		s.refreshViewSubscriptions(view)
+
+		keys, rowOnly := s.affectedSubscriptions(view, change)
+		for _, key := range keys {
+			if rowOnly {
+				s.pushRecord(key, change.Entity, change.Record, allow)
+				continue
+			}
+			if err := s.pushViewResults(view, key); err != nil {
+				s.logger.Error("[BROADCAST] view re-query failed", "view", view.Name, "key", key, "error", err)
+			}
+		}
+	}
+}
+
+// pushViewResults queries the first page of the view parameterization named
+// by key and pushes it to the key's subscribers as items. When the source has
+// a read rule or a field has a read condition, each subscriber receives only
+// the rows and fields its user may read.
+func (s *Server) pushViewResults(view *ViewSchema, key string) error {
+	values := strings.Split(key, ":")[1:]
+	if len(values) != len(view.Params) {
+		return fmt.Errorf("subscription %s has %d params, want %d", key, len(values), len(view.Params))
+	}
+	params := url.Values{}
+	for i, name := range view.Params {
+		params.Set("param."+name, values[i])
+	}
+	if view.Presence {
+		s.pushPresenceViewResults(view, key, params)
+		return nil
+	}
+
+	qs, source := s.viewQuerySchema(view)
+	qr, err := query.Build(qs, &http.Request{URL: &url.URL{RawQuery: params.Encode()}})
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	results, err := queryRecords(ctx, s.db, qr.SQL, qr.Args...)
+	if err != nil {
+		return err
+	}
+	if len(results) > qr.Limit {
+		results = results[:qr.Limit]
+	}
+	if results == nil {
+		results = []map[string]interface{}{}
+	}
+
+	if source == nil && !hasReadConditions(view) {
+		msg := &WSMessage{Type: "data", View: key, Items: results}
+		s.hub.SendToView(key, func(*Client) *WSMessage { return msg })
+		return nil
+	}
+
+	byUser := make(map[string]*WSMessage)
+	s.hub.SendToView(key, func(c *Client) *WSMessage {
+		userID := c.UserID()
+		if msg, ok := byUser[userID]; ok {
+			return msg
+		}
+		rows := make([]map[string]interface{}, len(results))
+		for i, row := range results {
+			rows[i] = make(map[string]interface{}, len(row))
+			for k, v := range row {
+				rows[i][k] = v
+			}
+		}
+		userCtx := context.WithValue(ctx, userContextKey{}, userID)
+		if source != nil {
+			readable, err := s.filterReadableViewRows(userCtx, s.db, source, rows)
+			if err != nil {
+				s.logger.Error("[BROADCAST] access check failed", "view", view.Name, "error", err)
+				byUser[userID] = nil
+				return nil
+			}
+			rows = readable
+		}
+		rows = s.newFieldReader(userCtx, s.db).viewRows(view, rows)
+		byUser[userID] = &WSMessage{Type: "data", View: key, Items: rows}
+		return byUser[userID]
+	})
+	return nil
+}
+
+// hasReadConditions reports whether some field of view has a read condition.
+func hasReadConditions(view *ViewSchema) bool {
+	for _, f := range view.Fields {
+		if f.Read != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// viewSubscription is a client's subscription to a declared view: the query
+// it runs and the page of rows the client holds.
+type viewSubscription struct {
+	ID     string
+	View   string
+	client *Client
+	query  url.Values
+
+	// mu serializes the snapshot and the deltas of the subscription.
+	mu sync.Mutex
+	// rows is the page the client holds, in order. Nil after a message was
+	// dropped, so that the next change sends a fresh snapshot.
+	rows []map[string]interface{}
+}
+
+// hasView reports whether name is a declared view. Subscriptions to other
+// names, like "Ticket:create" or "ChannelMessages:<channel_id>", are topics.
+func (s *Server) hasView(name string) bool {
+	_, ok := s.getArtifact().Views[name]
+	return ok
+}
+
+// subscribeView starts the view subscription msg asks for and sends the
+// first page of its query to c as a snapshot. Later changes to the page are
+// sent as updates by refreshViewSubscriptions.
+func (s *Server) subscribeView(c *Client, msg WSMessage) error {
+	view, ok := s.getArtifact().Views[msg.View]
+	if !ok {
+		return fmt.Errorf("view %s not found", msg.View)
+	}
+	id := msg.ID
+	if id == "" {
+		id = uuid.NewString()
+	}
+
+	sub := &viewSubscription{ID: id, View: view.Name, client: c, query: viewSubscriptionQuery(msg)}
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if !s.hub.addViewSubscription(sub) {
+		return fmt.Errorf("subscription %s already exists", id)
+	}
+
+	rows, err := s.queryViewSubscription(view, sub.query, c.UserID())
+	if err != nil {
+		s.hub.removeViewSubscription(c, id)
+		if qe, ok := err.(*query.QueryError); ok {
+			return errors.New(qe.Message)
+		}
+		s.logger.Error("view subscription query failed", "view", view.Name, "error", err)
+		return errors.New("failed to query view")
+	}
+	s.sendViewRows(sub, rows, nil)
+	return nil
+}
+
+// viewSubscriptionQuery encodes the params, filter, sort and limit of a
+// subscribe message as the query string GET /api/views takes. Filter values
+// are a value to compare with or an object of operators, e.g.
+// {"priority": {"gte": 3}}; lists are joined for the in operator.
+func viewSubscriptionQuery(msg WSMessage) url.Values {
+	values := url.Values{}
+	for name, v := range msg.Params {
+		values.Set("param."+name, v)
+	}
+	for field, v := range msg.Filter {
+		ops, ok := v.(map[string]interface{})
+		if !ok {
+			values.Set("filter["+field+"]", filterValue(v))
+			continue
+		}
+		for op, operand := range ops {
+			values.Set("filter["+field+"]["+op+"]", filterValue(operand))
+		}
+	}
+	if msg.Sort != "" {
+		values.Set("sort", msg.Sort)
+	}
+	if msg.Limit > 0 {
+		values.Set("limit", fmt.Sprintf("%d", msg.Limit))
+	}
+	return values
+}
+
+func filterValue(v interface{}) string {
+	if list, ok := v.([]interface{}); ok {
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = fmt.Sprintf("%v", item)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// queryViewSubscription runs the first page of a subscription's query for
+// userID, as GET /api/views would for that user.
+func (s *Server) queryViewSubscription(view *ViewSchema, values url.Values, userID string) ([]map[string]interface{}, error) {
+	if view.Presence {
+		ctx := context.WithValue(context.Background(), userContextKey{}, userID)
+		rows, limit, err := s.queryPresenceView(ctx, view, values, userID)
+		if len(rows) > limit {
+			rows = rows[:limit]
+		}
+		return rows, err
+	}
+
+	qs, source := s.viewQuerySchema(view)
+	qr, err := query.Build(qs, &http.Request{URL: &url.URL{RawQuery: values.Encode()}})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(context.Background(), userContextKey{}, userID)
+	database := s.dbForUser(userID)
+	rows, err := queryRecords(ctx, database, qr.SQL, qr.Args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) > qr.Limit {
+		rows = rows[:qr.Limit]
+	}
+	if source != nil {
+		if rows, err = s.filterReadableViewRows(ctx, database, source, rows); err != nil {
+			return nil, err
+		}
+	}
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	return s.newFieldReader(ctx, database).viewRows(view, rows), nil
+}
+
+// refreshViewSubscriptions runs the query of every subscription to view
+// again and sends each client the changes to its page. Subscriptions with
+// the same query and user share one run.
+func (s *Server) refreshViewSubscriptions(view *ViewSchema) {
+	type result struct {
+		rows []map[string]interface{}
+		err  error
+	}
+	results := make(map[string]result)
+
+	for _, sub := range s.hub.viewSubscriptions(view.Name) {
+		userID := sub.client.UserID()
+		key := userID + "?" + sub.query.Encode()
+		res, ok := results[key]
+		if !ok {
+			res.rows, res.err = s.queryViewSubscription(view, sub.query, userID)
+			results[key] = res
+		}
+		if res.err != nil {
+			s.logger.Error("[BROADCAST] view subscription query failed", "view", view.Name, "subscription", sub.ID, "error", res.err)
+			continue
+		}
+
+		sub.mu.Lock()
+		changes, ok := diffViewRows(sub.rows, res.rows)
+		if sub.rows == nil || !ok {
+			s.sendViewRows(sub, res.rows, nil)
+		} else if len(changes) > 0 {
+			s.sendViewRows(sub, res.rows, changes)
+		}
+		sub.mu.Unlock()
+	}
+}
+
+// sendViewRows sends the client of sub its new page: as a snapshot when
+// changes is nil, otherwise as the changes leading to it. Callers hold
+// sub.mu.
+func (s *Server) sendViewRows(sub *viewSubscription, rows []map[string]interface{}, changes []ViewChange) {
+	msg := &WSMessage{Type: "snapshot", ID: sub.ID, View: sub.View, Items: rows}
+	if changes != nil {
+		msg = &WSMessage{Type: "update", ID: sub.ID, View: sub.View, Changes: changes}
+	}
+	if sub.client.sendMessage(msg) {
+		sub.rows = rows
+	} else {
+		s.logger.Warn("[BROADCAST] client buffer full, subscription will resync", "view", sub.View, "subscription", sub.ID)
+		sub.rows = nil
+	}
+}
+
+// diffViewRows returns the changes that turn the page old into new: deletes
+// of the rows that left it, then, in the new order, inserts of the rows that
+// joined it and updates of the rows that changed or moved. ok is false when
+// the rows have no unique ids to tell them apart, so only a snapshot can
+// replace the page.
+func diffViewRows(old, new []map[string]interface{}) (changes []ViewChange, ok bool) {
+	if !uniqueIDs(old) || !uniqueIDs(new) {
+		return nil, false
+	}
+	wanted := make(map[string]bool, len(new))
+	for _, row := range new {
+		wanted[viewRowID(row)] = true
+	}
+
+	var page []string
+	previous := make(map[string]map[string]interface{}, len(old))
+	for _, row := range old {
+		id := viewRowID(row)
+		if !wanted[id] {
+			// The rows deleted before this one are already gone
+			changes = append(changes, ViewChange{Op: "delete", ID: id, Position: len(page)})
+			continue
+		}
+		page = append(page, id)
+		previous[id] = row
+	}
+
+	for i, row := range new {
+		id := viewRowID(row)
+		prev, ok := previous[id]
+		switch {
+		case !ok:
+			changes = append(changes, ViewChange{Op: "insert", ID: id, Position: i, Data: row})
+			page = insertAt(page, i, id)
+		case page[i] != id:
+			changes = append(changes, ViewChange{Op: "update", ID: id, Position: i, Data: row})
+			page = insertAt(removeID(page, id), i, id)
+		case !reflect.DeepEqual(prev, row):
+			changes = append(changes, ViewChange{Op: "update", ID: id, Position: i, Data: row})
+		}
+	}
+	return changes, true
+}
+
+func uniqueIDs(rows []map[string]interface{}) bool {
+	seen := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		id := viewRowID(row)
+		if row["id"] == nil || seen[id] {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
+
+func viewRowID(row map[string]interface{}) string {
+	return fmt.Sprintf("%v", row["id"])
+}
+
+func insertAt(page []string, i int, id string) []string {
+	page = append(page, "")
+	copy(page[i+1:], page[i:])
+	page[i] = id
+	return page
+}
+
+func removeID(page []string, id string) []string {
+	for i, v := range page {
+		if v == id {
+			return append(page[:i], page[i+1:]...)
+		}
+	}
+	return page
+}
@@ -0,0 +1,321 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+)
+
+func TestViewParamColumns(t *testing.T) {
+	tests := []struct {
+		name         string
+		filter       string
+		params       []string
+		paramColumns []string
+		columns      []string
+		exact        bool
+	}{
+		{"relation", "(t.channel_id = $1)", []string{"channel_id"}, []string{"channel_id"}, []string{"channel_id"}, true},
+		{"several params", "((t.brand_id = $1) AND (t.status = $2))", []string{"brand", "status"}, []string{"brand_id", "status"}, []string{"brand_id", "status"}, true},
+		{"other conditions", "((t.channel_id = $1) AND (t.deleted = false))", []string{"channel_id"}, nil, nil, false},
+		{"no params", "(t.visibility = 'public')", nil, nil, nil, false},
+		{"unfiltered", "", nil, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view := &ViewSchema{Name: "Feed", Filter: tt.filter, Params: tt.params, ParamColumns: tt.paramColumns}
+			columns, exact := viewParamColumns(view)
+			if !reflect.DeepEqual(columns, tt.columns) || exact != tt.exact {
+				t.Errorf("viewParamColumns = %v, %v; want %v, %v", columns, exact, tt.columns, tt.exact)
+			}
+		})
+	}
+}
+
+// subscriptionArtifact adds a view of each author's tickets and makes
+// TicketList join the author, so only changes to its rows can be pushed as
+// they are.
+func subscriptionArtifact() *Artifact {
+	artifact := accessArtifact()
+	artifact.Views["TicketsByAuthor"] = &ViewSchema{
+		Name:         "TicketsByAuthor",
+		Source:       "Ticket",
+		SourceTable:  "tickets",
+		Fields:       []ViewField{{Name: "subject", Column: "t.subject", Alias: "subject", Type: "text"}},
+		Filter:       "(t.author_id = $1)",
+		Params:       []string{"author_id"},
+		ParamColumns: []string{"author_id"},
+		Dependencies: []string{"Ticket"},
+	}
+	list := artifact.Views["TicketList"]
+	list.Joins = []ViewJoin{{Table: "users", Alias: "j_author", On: "j_author.id = t.author_id", Type: "LEFT"}}
+	list.Dependencies = []string{"Ticket", "User"}
+	return artifact
+}
+
+func TestPushViewChanges(t *testing.T) {
+	fake := &accessDB{tables: accessTables()}
+	s := createTestServerWithMockDB(t, subscriptionArtifact(), &mockDB{queryFunc: fake.query})
+	s.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	author := &Client{send: make(chan []byte, 8), subscriptions: make(map[string]bool), userID: ruleTestUserID}
+	other := &Client{send: make(chan []byte, 8), subscriptions: make(map[string]bool), userID: ruleTestOtherID}
+	s.hub.Subscribe(author, "TicketsByAuthor:"+ruleTestUserID)
+	s.hub.Subscribe(other, "TicketsByAuthor:"+ruleTestOtherID)
+	for _, c := range []*Client{author, other} {
+		s.hub.Subscribe(c, "TicketList")
+	}
+
+	received := func(c *Client) map[string]WSMessage {
+		t.Helper()
+		s.changePushes.wait()
+		msgs := make(map[string]WSMessage)
+		for len(c.send) > 0 {
+			var msg WSMessage
+			if err := json.Unmarshal(<-c.send, &msg); err != nil {
+				t.Fatal(err)
+			}
+			msgs[msg.View] = msg
+		}
+		return msgs
+	}
+	subjects := func(msg WSMessage) []any {
+		var got []any
+		items, _ := msg.Items.([]any)
+		for _, item := range items {
+			got = append(got, item.(map[string]any)["subject"])
+		}
+		return got
+	}
+
+	s.broadcastEntityChange("Ticket", "update", map[string]any{"id": ruleTestTicketID, "subject": "mine", "author_id": ruleTestUserID})
+
+	authorMsgs, otherMsgs := received(author), received(other)
+	row, ok := authorMsgs["TicketsByAuthor:"+ruleTestUserID]
+	if !ok || !reflect.DeepEqual(row.Data, map[string]any{"id": ruleTestTicketID, "subject": "mine"}) {
+		t.Errorf("expected the row pushed to its author's parameterization, got %+v", authorMsgs)
+	}
+	if _, ok := otherMsgs["TicketsByAuthor:"+ruleTestOtherID]; ok {
+		t.Errorf("other parameterization received %+v", otherMsgs)
+	}
+	if got := subjects(authorMsgs["TicketList"]); !reflect.DeepEqual(got, []any{"mine"}) {
+		t.Errorf("author re-query = %v, want [mine]", got)
+	}
+	if got := subjects(otherMsgs["TicketList"]); !reflect.DeepEqual(got, []any{"theirs"}) {
+		t.Errorf("other re-query = %v, want [theirs]", got)
+	}
+
+	// A joined entity re-queries the views joining it and nothing else.
+	s.broadcastEntityChange("User", "update", map[string]any{"id": ruleTestUserID})
+	authorMsgs = received(author)
+	if len(authorMsgs) != 1 || subjects(authorMsgs["TicketList"]) == nil {
+		t.Errorf("expected only TicketList re-queried, got %+v", authorMsgs)
+	}
+
+	requeried := func(msgs map[string]WSMessage, key string) bool {
+		msg, ok := msgs[key]
+		return ok && msg.Data == nil && msg.Items != nil
+	}
+	authorKey, otherKey := "TicketsByAuthor:"+ruleTestUserID, "TicketsByAuthor:"+ruleTestOtherID
+
+	// A row moved to another author is queried again under both
+	s.broadcastChange(&entityChange{
+		Entity:    "Ticket",
+		Operation: "update",
+		Record:    map[string]any{"id": ruleTestTicketID, "subject": "mine", "author_id": ruleTestOtherID},
+		Previous:  map[string]any{"id": ruleTestTicketID, "subject": "mine", "author_id": ruleTestUserID},
+	})
+	if msgs := received(author); !requeried(msgs, authorKey) {
+		t.Errorf("the parameterization the row left was not queried again: %+v", msgs)
+	}
+	if msgs := received(other); !requeried(msgs, otherKey) {
+		t.Errorf("the parameterization the row joined was not queried again: %+v", msgs)
+	}
+
+	// A delete queries the parameterization of the stored row again
+	s.broadcastChange(&entityChange{
+		Entity:    "Ticket",
+		Operation: "delete",
+		Record:    map[string]any{"id": ruleTestTicketID},
+		Previous:  map[string]any{"id": ruleTestTicketID, "subject": "mine", "author_id": ruleTestUserID},
+	})
+	if msgs := received(author); !requeried(msgs, authorKey) {
+		t.Errorf("delete did not query its parameterization again: %+v", msgs)
+	}
+	if msgs := received(other); len(msgs) != 1 {
+		t.Errorf("expected only TicketList re-queried for the other author, got %+v", msgs)
+	}
+
+	// Without the stored row every parameterization is queried again
+	s.broadcastEntityChange("Ticket", "delete", map[string]any{"id": ruleTestTicketID})
+	for _, c := range []*Client{author, other} {
+		msgs := received(c)
+		if key := "TicketsByAuthor:" + c.UserID(); !requeried(msgs, key) {
+			t.Errorf("delete did not query %s again: %+v", key, msgs)
+		}
+	}
+}
+
+func TestPushViewChanges_OffRequest(t *testing.T) {
+	fake := &accessDB{tables: accessTables()}
+	release := make(chan struct{})
+	s := createTestServerWithMockDB(t, subscriptionArtifact(), &mockDB{queryFunc: func(ctx context.Context, query string, args ...any) (db.Rows, error) {
+		if strings.Contains(query, " FROM tickets t") {
+			<-release
+		}
+		return fake.query(ctx, query, args...)
+	}})
+	s.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	author := &Client{send: make(chan []byte, 8), subscriptions: make(map[string]bool), userID: ruleTestUserID}
+	s.hub.Subscribe(author, "TicketList")
+
+	done := make(chan struct{})
+	go func() {
+		s.broadcastEntityChange("Ticket", "update", map[string]any{"id": ruleTestTicketID, "subject": "first", "author_id": ruleTestUserID})
+		s.broadcastEntityChange("Ticket", "update", map[string]any{"id": ruleTestTicketID, "subject": "second", "author_id": ruleTestUserID})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("broadcast waited for the view query")
+	}
+
+	close(release)
+	s.changePushes.wait()
+	if got := drain(t, author); fmt.Sprint(got) != "[data TicketList data TicketList]" {
+		t.Errorf("subscriber received %v, want a re-query per change", got)
+	}
+}
+
+// applyViewChanges applies changes to page as a client would.
+func applyViewChanges(page []map[string]interface{}, changes []ViewChange) []map[string]interface{} {
+	page = append([]map[string]interface{}(nil), page...)
+	for _, change := range changes {
+		if change.Op != "insert" {
+			for i, row := range page {
+				if viewRowID(row) == change.ID {
+					page = append(page[:i], page[i+1:]...)
+					break
+				}
+			}
+		}
+		if change.Op != "delete" {
+			page = append(page[:change.Position], append([]map[string]interface{}{change.Data}, page[change.Position:]...)...)
+		}
+	}
+	return page
+}
+
+func TestDiffViewRows(t *testing.T) {
+	row := func(id, subject string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "subject": subject}
+	}
+	a, b, c, d := row("a", "A"), row("b", "B"), row("c", "C"), row("d", "D")
+
+	tests := []struct {
+		name string
+		old  []map[string]interface{}
+		new  []map[string]interface{}
+		ops  []string
+	}{
+		{"unchanged", []map[string]interface{}{a, b}, []map[string]interface{}{a, b}, nil},
+		{"insert", []map[string]interface{}{a, b}, []map[string]interface{}{c, a, b}, []string{"insert c 0"}},
+		{"delete", []map[string]interface{}{a, b, c}, []map[string]interface{}{a, c}, []string{"delete b 1"}},
+		{"update", []map[string]interface{}{a, b}, []map[string]interface{}{a, row("b", "B2")}, []string{"update b 1"}},
+		{"move", []map[string]interface{}{a, b, c}, []map[string]interface{}{c, a, b}, []string{"update c 0"}},
+		{"page shift", []map[string]interface{}{a, b, c}, []map[string]interface{}{d, a, b}, []string{"delete c 2", "insert d 0"}},
+		{"deletes before", []map[string]interface{}{a, b, c, d}, []map[string]interface{}{d}, []string{"delete a 0", "delete b 0", "delete c 0"}},
+	}
+
+	if _, ok := diffViewRows([]map[string]interface{}{a}, []map[string]interface{}{{"subject": "A"}, {"subject": "B"}}); ok {
+		t.Error("expected rows without unique ids to need a snapshot")
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, ok := diffViewRows(tt.old, tt.new)
+			if !ok {
+				t.Fatal("rows have unique ids")
+			}
+			var ops []string
+			for _, change := range changes {
+				ops = append(ops, fmt.Sprintf("%s %s %d", change.Op, change.ID, change.Position))
+			}
+			if !reflect.DeepEqual(ops, tt.ops) {
+				t.Errorf("changes = %v, want %v", ops, tt.ops)
+			}
+			if got := applyViewChanges(tt.old, changes); len(tt.new) > 0 && !reflect.DeepEqual(got, tt.new) {
+				t.Errorf("applied changes give %v, want %v", got, tt.new)
+			}
+		})
+	}
+}
+
+func TestViewSubscription(t *testing.T) {
+	artifact := accessArtifact()
+	artifact.Views["TicketList"].Dependencies = []string{"Ticket"}
+	fake := &accessDB{tables: accessTables()}
+	s := createTestServerWithMockDB(t, artifact, &mockDB{queryFunc: fake.query})
+	s.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	go s.hub.Run()
+	srv := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer srv.Close()
+
+	author := dialWs(t, srv, "?token="+accessToken(t, s, ruleTestUserID))
+	author.send(WSMessage{Type: "subscribe", ID: "tickets", View: "TicketList", Sort: "-subject", Limit: 10})
+	snapshot := author.expect("snapshot")
+	if snapshot.ID != "tickets" || !reflect.DeepEqual(snapshot.Items, []any{map[string]any{"id": ruleTestTicketID, "subject": "mine"}}) {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	// A new readable ticket sorts first; the other user's tickets stay out.
+	newer := "55555555-5555-5555-5555-555555555555"
+	fake.tables["tickets"] = append([]map[string]any{
+		{"id": newer, "subject": "newer", "author_id": ruleTestUserID},
+	}, fake.tables["tickets"]...)
+	s.broadcastEntityChange("Ticket", "create", fake.tables["tickets"][0])
+
+	update := author.expect("update")
+	want := []ViewChange{{Op: "insert", ID: newer, Position: 0, Data: map[string]any{"id": newer, "subject": "newer"}}}
+	if update.ID != "tickets" || !reflect.DeepEqual(update.Changes, want) {
+		t.Errorf("unexpected update %+v", update)
+	}
+
+	author.send(WSMessage{Type: "subscribe", ID: "bad", View: "TicketList", Filter: map[string]any{"author": "x"}})
+	if msg := author.expect("error"); msg.ID != "bad" || msg.Error != "field 'author' does not exist on this view" {
+		t.Errorf("unexpected error %+v", msg)
+	}
+
+	author.send(WSMessage{Type: "unsubscribe", ID: "tickets"})
+	if msg := author.expect("ack"); msg.ID != "tickets" {
+		t.Errorf("unexpected ack %+v", msg)
+	}
+	if subs := s.hub.viewSubscriptions("TicketList"); len(subs) != 0 {
+		t.Errorf("subscription not removed: %d left", len(subs))
+	}
+}
+
+func TestViewSubscriptionQuery(t *testing.T) {
+	values := viewSubscriptionQuery(WSMessage{
+		Params: map[string]string{"org_id": "o1"},
+		Filter: map[string]interface{}{"status": "open", "priority": map[string]interface{}{"in": []interface{}{1, 2}}},
+		Sort:   "-created_at",
+		Limit:  20,
+	})
+	want := "filter%5Bpriority%5D%5Bin%5D=1%2C2&filter%5Bstatus%5D=open&limit=20&param.org_id=o1&sort=-created_at"
+	if got := values.Encode(); got != want {
+		t.Errorf("query = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,485 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestCase is a compiled test declaration: seed the given field values, run
+// one operation through the HTTP pipeline and check the outcome.
+type TestCase struct {
+	Name   string
+	Given  []TestValue
+	When   TestWhen
+	Expect TestExpect
+}
+
+// TestValue is a field value a test seeds or expects.
+type TestValue struct {
+	Entity string
+	Field  string
+	Value  any
+}
+
+// TestWhen is the operation under test: create, update or delete of the
+// entity Target, or action to run the action Target.
+type TestWhen struct {
+	Operation string
+	Target    string
+}
+
+// TestExpect is the outcome a test asserts: a rejection, optionally with a
+// message code, or a field value after the operation.
+type TestExpect struct {
+	Reject  bool
+	Message string
+	TestValue
+}
+
+// TestResult is the outcome of one test.
+type TestResult struct {
+	Name     string
+	Passed   bool
+	Message  string // why the test failed
+	Duration time.Duration
+}
+
+// testRun holds the records seeded for one test.
+type testRun struct {
+	s         *Server
+	artifact  *Artifact
+	given     map[string]map[string]any // entity -> field -> value
+	records   map[string]string         // entity -> id of its seeded record
+	principal string
+}
+
+// RunTest runs tc against the server's database. The entity tables are
+// emptied first, so each test starts from its given state only. The
+// operation goes through the router as an HTTP request authenticated as a
+// seeded user, so rules, hooks and access apply as they do in production.
+func (s *Server) RunTest(ctx context.Context, tc *TestCase) *TestResult {
+	start := time.Now()
+	result := &TestResult{Name: tc.Name}
+	if err := s.runTest(ctx, tc); err != nil {
+		result.Message = err.Error()
+	} else {
+		result.Passed = true
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+func (s *Server) runTest(ctx context.Context, tc *TestCase) error {
+	artifact := s.getArtifact()
+	run := &testRun{
+		s:        s,
+		artifact: artifact,
+		given:    make(map[string]map[string]any),
+		records:  make(map[string]string),
+	}
+	for _, g := range tc.Given {
+		if run.given[g.Entity] == nil {
+			run.given[g.Entity] = make(map[string]any)
+		}
+		run.given[g.Entity][g.Field] = g.Value
+	}
+
+	if err := run.reset(ctx); err != nil {
+		return fmt.Errorf("reset database: %w", err)
+	}
+
+	// The values given for a created entity are its input, not a record
+	var input map[string]any
+	subject := tc.When.Target
+	switch tc.When.Operation {
+	case "create":
+		input = run.given[subject]
+		delete(run.given, subject)
+	case "action":
+		action, ok := artifact.Actions[tc.When.Target]
+		if !ok {
+			return fmt.Errorf("action %s not found", tc.When.Target)
+		}
+		subject = action.InputEntity
+		if action.hasSteps() {
+			subject = action.subject()
+		}
+		if action.Operation == "create" {
+			input = run.given[subject]
+			delete(run.given, subject)
+		}
+	}
+
+	// Seed the authenticated user, then every entity with given values
+	if _, ok := artifact.Entities[s.userEntityName()]; ok {
+		id, err := run.seed(ctx, s.userEntityName(), nil)
+		if err != nil {
+			return fmt.Errorf("seed user: %w", err)
+		}
+		run.principal = id
+	}
+	entities := make([]string, 0, len(run.given))
+	for name := range run.given {
+		entities = append(entities, name)
+	}
+	sort.Strings(entities)
+	for _, name := range entities {
+		if _, err := run.seed(ctx, name, nil); err != nil {
+			return fmt.Errorf("seed %s: %w", name, err)
+		}
+	}
+
+	req, written, err := run.request(ctx, tc.When, subject, input)
+	if err != nil {
+		return err
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	var resp struct {
+		Data     map[string]any `json:"data"`
+		Messages []Message      `json:"messages"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	rejected := rec.Code >= http.StatusBadRequest
+
+	if tc.Expect.Reject {
+		if !rejected {
+			return fmt.Errorf("expected reject %s, but %s %s succeeded", tc.Expect.Message, tc.When.Operation, tc.When.Target)
+		}
+		if tc.Expect.Message != "" && !slices.ContainsFunc(resp.Messages, func(m Message) bool { return m.Code == tc.Expect.Message }) {
+			return fmt.Errorf("expected reject %s, got %d %s", tc.Expect.Message, rec.Code, messageCodes(resp.Messages))
+		}
+		return nil
+	}
+	if rejected {
+		return fmt.Errorf("%s %s was rejected: %d %s", tc.When.Operation, tc.When.Target, rec.Code, messageCodes(resp.Messages))
+	}
+
+	// The operation's own record is the one its response returned
+	if id, ok := resp.Data["id"].(string); ok && written != "" {
+		run.records[written] = id
+	}
+	if tc.When.Operation == "delete" {
+		delete(run.records, written)
+	}
+	return run.check(ctx, tc.Expect.TestValue)
+}
+
+// reset empties every entity table.
+func (run *testRun) reset(ctx context.Context) error {
+	var tables []string
+	for _, entity := range run.artifact.Entities {
+		tables = append(tables, entity.Table)
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+	sort.Strings(tables)
+	_, err := run.s.db.Exec(ctx, fmt.Sprintf("TRUNCATE %s CASCADE", strings.Join(tables, ", ")))
+	return err
+}
+
+// seed inserts a record of entity with its given values and returns its ID.
+// Each entity is seeded once; later seeds of it return the same record.
+func (run *testRun) seed(ctx context.Context, name string, seeding []string) (string, error) {
+	if id, ok := run.records[name]; ok {
+		return id, nil
+	}
+	if name == run.s.userEntityName() && run.principal != "" {
+		return run.principal, nil
+	}
+	if slices.Contains(seeding, name) {
+		return "", fmt.Errorf("cannot seed %s: its relations form a cycle (%s)", name, strings.Join(append(seeding, name), " -> "))
+	}
+	entity, ok := run.artifact.Entities[name]
+	if !ok {
+		return "", fmt.Errorf("entity %s not found", name)
+	}
+
+	fields, err := run.record(ctx, entity, run.given[name], append(seeding, name))
+	if err != nil {
+		return "", err
+	}
+	columns := make([]string, 0, len(fields))
+	for col := range fields {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	placeholders := make([]string, len(columns))
+	args := make([]any, len(columns))
+	for i, col := range columns {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = fields[col]
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING *",
+		entity.Table, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+	if len(columns) == 0 {
+		query = fmt.Sprintf("INSERT INTO %s DEFAULT VALUES RETURNING *", entity.Table)
+	}
+	row, err := queryRecord(ctx, run.s.db, query, args...)
+	if err != nil {
+		return "", err
+	}
+	if row == nil {
+		return "", fmt.Errorf("insert into %s returned no rows", entity.Table)
+	}
+	id := fmt.Sprint(row["id"])
+	run.records[name] = id
+	return id, nil
+}
+
+// record returns the columns of a valid entity record: the given values,
+// a placeholder for each required field without a default, and a seeded
+// record for each relation.
+func (run *testRun) record(ctx context.Context, entity *EntitySchema, given map[string]any, seeding []string) (map[string]any, error) {
+	fields := make(map[string]any)
+	for name, field := range entity.Fields {
+		if name == "id" || name == "created_at" || name == "updated_at" {
+			continue
+		}
+		if v, ok := given[name]; ok {
+			fields[name] = v
+		} else if !field.Nullable && field.Default == nil {
+			fields[name] = placeholderValue(field)
+		}
+	}
+	for _, rel := range entity.Relations {
+		if rel.IsMany {
+			continue
+		}
+		id, err := run.seed(ctx, rel.Target, seeding)
+		if err != nil {
+			return nil, err
+		}
+		fields[rel.ForeignKey] = id
+	}
+	return fields, nil
+}
+
+// placeholderValue returns a valid value for a required field the test
+// does not set. Text is unique so unique constraints hold.
+func placeholderValue(field *FieldSchema) any {
+	if len(field.EnumValues) > 0 {
+		return field.EnumValues[0]
+	}
+	switch field.SQLType {
+	case "integer", "bigint", "double precision", "numeric":
+		return 0
+	case "boolean":
+		return false
+	case "timestamp with time zone", "date":
+		return time.Now().UTC()
+	case "uuid":
+		return uuid.NewString()
+	}
+	id := uuid.NewString()[:8]
+	if field.Type == "email" || field.Name == "email" {
+		return "test-" + id + "@example.com"
+	}
+	return "test-" + id
+}
+
+// request builds the HTTP request for the operation and returns the entity
+// whose record the operation writes.
+func (run *testRun) request(ctx context.Context, when TestWhen, subject string, input map[string]any) (*http.Request, string, error) {
+	entity, ok := run.artifact.Entities[subject]
+	if !ok && !(when.Operation == "action" && run.artifact.Actions[when.Target].hasSteps()) {
+		return nil, "", fmt.Errorf("entity %s not found", subject)
+	}
+
+	var method, path string
+	var body map[string]any
+	written := subject
+	switch when.Operation {
+	case "create":
+		fields, err := run.record(ctx, entity, input, nil)
+		if err != nil {
+			return nil, "", fmt.Errorf("seed %s: %w", subject, err)
+		}
+		method, path, body = http.MethodPost, "/api/entities/"+subject, fields
+	case "update":
+		id, err := run.seed(ctx, subject, nil)
+		if err != nil {
+			return nil, "", fmt.Errorf("seed %s: %w", subject, err)
+		}
+		// An update writes the record's given state back, which is enough
+		// to trigger its update rules and hooks
+		row, err := loadRow(ctx, run.s.db, entity.Table, id)
+		if err != nil {
+			return nil, "", fmt.Errorf("load %s: %w", subject, err)
+		}
+		body = make(map[string]any)
+		for k, v := range row {
+			if k != "id" && k != "created_at" && k != "updated_at" {
+				body[k] = v
+			}
+		}
+		method, path = http.MethodPut, "/api/entities/"+subject+"/"+id
+	case "delete":
+		id, err := run.seed(ctx, subject, nil)
+		if err != nil {
+			return nil, "", fmt.Errorf("seed %s: %w", subject, err)
+		}
+		method, path = http.MethodDelete, "/api/entities/"+subject+"/"+id
+	case "action":
+		action := run.artifact.Actions[when.Target]
+		if action.TargetEntity != "" {
+			written = action.TargetEntity
+		}
+		if action.hasSteps() {
+			fields, err := run.actionInput(ctx, action)
+			if err != nil {
+				return nil, "", err
+			}
+			body = fields
+		} else if action.Operation == "create" {
+			fields, err := run.record(ctx, entity, input, nil)
+			if err != nil {
+				return nil, "", fmt.Errorf("seed %s: %w", subject, err)
+			}
+			body = fields
+		} else {
+			id, err := run.seed(ctx, subject, nil)
+			if err != nil {
+				return nil, "", fmt.Errorf("seed %s: %w", subject, err)
+			}
+			body = map[string]any{"id": id}
+		}
+		method, path = http.MethodPost, "/api/actions/"+when.Target
+	default:
+		return nil, "", fmt.Errorf("unknown operation %s", when.Operation)
+	}
+
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, "", err
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if run.principal != "" {
+		token, err := run.token()
+		if err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, written, nil
+}
+
+// actionInput returns the input of an action with an input block: the id
+// of a seeded record for each record field and a placeholder for each field
+// without a default.
+func (run *testRun) actionInput(ctx context.Context, action *ActionSchema) (map[string]any, error) {
+	input := make(map[string]any)
+	for _, field := range action.Input {
+		switch {
+		case field.Entity != "":
+			id, err := run.seed(ctx, field.Entity, nil)
+			if err != nil {
+				return nil, fmt.Errorf("seed %s: %w", field.Entity, err)
+			}
+			input[field.Name] = id
+		case field.Default == nil:
+			input[field.Name] = placeholderValue(&field.FieldSchema)
+		}
+	}
+	return input, nil
+}
+
+// token returns a bearer token for the seeded user in the form the auth
+// middleware accepts.
+func (run *testRun) token() (string, error) {
+	conf := run.s.runtimeConf
+	if conf.Auth.Provider == "password" && conf.Auth.JWT.Secret != "" {
+		access, _, err := run.s.generateTokenPair(run.principal)
+		return access, err
+	}
+	claims, err := json.Marshal(map[string]string{"sub": run.principal})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(claims), nil
+}
+
+// check compares an expected field value with the stored record.
+func (run *testRun) check(ctx context.Context, expect TestValue) error {
+	entity, ok := run.artifact.Entities[expect.Entity]
+	if !ok {
+		return fmt.Errorf("entity %s not found", expect.Entity)
+	}
+	id, ok := run.records[expect.Entity]
+	if !ok {
+		return fmt.Errorf("expected %s.%s = %v, but there is no %s record", expect.Entity, expect.Field, expect.Value, expect.Entity)
+	}
+	row, err := loadRow(ctx, run.s.db, entity.Table, id)
+	if err != nil {
+		return fmt.Errorf("load %s: %w", expect.Entity, err)
+	}
+	if row == nil {
+		return fmt.Errorf("expected %s.%s = %v, but the %s record no longer exists", expect.Entity, expect.Field, expect.Value, expect.Entity)
+	}
+	actual := row[expect.Field]
+	if !testValuesEqual(actual, expect.Value) {
+		return fmt.Errorf("expected %s.%s = %v, got %v", expect.Entity, expect.Field, formatTestValue(expect.Value), formatTestValue(actual))
+	}
+	return nil
+}
+
+// testValuesEqual compares a stored value with an expected literal. Values
+// are compared by their printed form so an integer literal matches any
+// numeric column type.
+func testValuesEqual(actual, expected any) bool {
+	if actual == nil || expected == nil {
+		return actual == nil && expected == nil
+	}
+	return fmt.Sprint(actual) == fmt.Sprint(expected)
+}
+
+func formatTestValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprint(v)
+}
+
+// messageCodes lists the codes of messages for failure output.
+func messageCodes(messages []Message) string {
+	var codes []string
+	for _, m := range messages {
+		codes = append(codes, m.Code)
+	}
+	if len(codes) == 0 {
+		return "(no messages)"
+	}
+	return strings.Join(codes, ", ")
+}
+
+// freePort returns a TCP port that is free on the loopback interface.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/forge-lang/forge/runtime/internal/config"
+	"github.com/forge-lang/forge/runtime/internal/db"
+)
+
+// tableDB is an in-memory database that understands the statements the
+// test runner and the entity handlers issue.
+type tableDB struct {
+	db.Database
+	artifact *Artifact
+	tables   map[string][]map[string]any
+}
+
+var (
+	insertRe = regexp.MustCompile(`^INSERT INTO (\w+) \(([^)]*)\) VALUES`)
+	updateRe = regexp.MustCompile(`^UPDATE (\w+) SET (.*) WHERE id = \$\d+`)
+	selectRe = regexp.MustCompile(`^SELECT \* FROM (\w+) WHERE id = \$1`)
+	deleteRe = regexp.MustCompile(`^DELETE FROM (\w+) WHERE id = \$1`)
+)
+
+func (d *tableDB) WithUser(uuid.UUID) db.Database { return d }
+func (d *tableDB) Begin(context.Context) (db.Tx, error) {
+	return &tableTx{d}, nil
+}
+
+func (d *tableDB) Exec(ctx context.Context, query string, args ...any) (db.Result, error) {
+	if strings.HasPrefix(query, "TRUNCATE ") {
+		d.tables = make(map[string][]map[string]any)
+		return &mockResult{}, nil
+	}
+	rows, err := d.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &mockResult{rowsAffected: int64(len(rows.(*mockRows).values))}, nil
+}
+
+func (d *tableDB) Query(ctx context.Context, query string, args ...any) (db.Rows, error) {
+	switch {
+	case strings.Contains(query, "DEFAULT VALUES"):
+		table := strings.Fields(query)[2]
+		return d.result(d.insert(table, nil, nil)), nil
+	case insertRe.MatchString(query):
+		m := insertRe.FindStringSubmatch(query)
+		return d.result(d.insert(m[1], strings.Split(m[2], ", "), args)), nil
+	case updateRe.MatchString(query):
+		m := updateRe.FindStringSubmatch(query)
+		row := d.find(m[1], args[len(args)-1])
+		if row == nil {
+			return &mockRows{}, nil
+		}
+		for i, set := range strings.Split(m[2], ", ") {
+			row[strings.Fields(set)[0]] = args[i]
+		}
+		return d.result(row), nil
+	case selectRe.MatchString(query):
+		return d.result(d.find(selectRe.FindStringSubmatch(query)[1], args[0])), nil
+	case deleteRe.MatchString(query):
+		table := deleteRe.FindStringSubmatch(query)[1]
+		row := d.find(table, args[0])
+		if row == nil {
+			return &mockRows{}, nil
+		}
+		rows := d.tables[table][:0]
+		for _, r := range d.tables[table] {
+			if r["id"] != row["id"] {
+				rows = append(rows, r)
+			}
+		}
+		d.tables[table] = rows
+		return d.result(row), nil
+	}
+	return nil, fmt.Errorf("tableDB: unsupported query %q", query)
+}
+
+// insert stores a row, filling column defaults from the artifact.
+func (d *tableDB) insert(table string, columns []string, args []any) map[string]any {
+	row := map[string]any{"id": uuid.NewString()}
+	for _, entity := range d.artifact.Entities {
+		if entity.Table != table {
+			continue
+		}
+		for name, field := range entity.Fields {
+			if name != "id" {
+				row[name] = field.Default
+			}
+		}
+	}
+	for i, col := range columns {
+		row[col] = args[i]
+	}
+	d.tables[table] = append(d.tables[table], row)
+	return row
+}
+
+func (d *tableDB) find(table string, id any) map[string]any {
+	for _, row := range d.tables[table] {
+		if row["id"] == fmt.Sprint(id) {
+			return row
+		}
+	}
+	return nil
+}
+
+func (d *tableDB) result(row map[string]any) *mockRows {
+	if row == nil {
+		return &mockRows{}
+	}
+	rows := &mockRows{values: [][]any{{}}}
+	for k, v := range row {
+		rows.cols = append(rows.cols, k)
+		rows.values[0] = append(rows.values[0], v)
+	}
+	return rows
+}
+
+type tableTx struct{ *tableDB }
+
+func (tx *tableTx) Commit(context.Context) error   { return nil }
+func (tx *tableTx) Rollback(context.Context) error { return nil }
+func (tx *tableTx) QueryRow(context.Context, string, ...any) db.Row {
+	return &mockRow{}
+}
+
+func testRunnerArtifact() *Artifact {
+	return &Artifact{
+		Entities: map[string]*EntitySchema{
+			"User": {
+				Name:  "User",
+				Table: "users",
+				Fields: map[string]*FieldSchema{
+					"id":    {Name: "id", Type: "uuid", SQLType: "uuid"},
+					"email": {Name: "email", Type: "string", SQLType: "text", Unique: true},
+				},
+			},
+			"Ticket": {
+				Name:  "Ticket",
+				Table: "tickets",
+				Fields: map[string]*FieldSchema{
+					"id":      {Name: "id", Type: "uuid", SQLType: "uuid"},
+					"subject": {Name: "subject", Type: "string", SQLType: "text"},
+					"status":  {Name: "status", Type: "enum", SQLType: "tickets_status", Default: "open", EnumValues: []string{"open", "closed"}},
+				},
+				Relations: map[string]*RelSchema{
+					"author": {Name: "author", Target: "User", TargetTable: "users", ForeignKey: "author_id"},
+				},
+			},
+		},
+		Actions: map[string]*ActionSchema{
+			"close_ticket": {Name: "close_ticket", InputEntity: "Ticket", Operation: "update", TargetEntity: "Ticket"},
+			"resolve_ticket": {
+				Name: "resolve_ticket",
+				Input: []*ActionInputSchema{
+					{FieldSchema: FieldSchema{Name: "ticket", Type: "uuid", SQLType: "uuid"}, Entity: "Ticket"},
+					{FieldSchema: FieldSchema{Name: "note", Type: "string", SQLType: "text"}},
+				},
+				Steps: []*ActionStepSchema{
+					{Kind: "set", Entity: "Ticket", Record: "ticket", Field: "status", Value: "closed"},
+				},
+			},
+		},
+		Rules: []*RuleSchema{
+			{ID: "rule_1", Entity: "Ticket", Operation: "update", Condition: "(status == closed)", EmitCode: "TICKET_CLOSED", IsForbid: true},
+		},
+		Messages: map[string]*MessageSchema{
+			"TICKET_CLOSED": {Code: "TICKET_CLOSED", Level: "error", Default: "This ticket is closed."},
+		},
+	}
+}
+
+func createTestRunnerServer(t *testing.T) (*Server, *tableDB) {
+	t.Helper()
+	artifact := testRunnerArtifact()
+	database := &tableDB{artifact: artifact, tables: make(map[string][]map[string]any)}
+	s := &Server{
+		config:      &Config{Testing: true},
+		runtimeConf: &config.Config{},
+		artifact:    artifact,
+		db:          database,
+		router:      chi.NewRouter(),
+		hub:         NewHub(),
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	s.setupRoutes()
+	return s, database
+}
+
+func TestRunTest(t *testing.T) {
+	tests := []struct {
+		name    string
+		tc      *TestCase
+		failure string // empty if the test must pass
+	}{
+		{
+			name: "update rejected by rule",
+			tc: &TestCase{
+				Given:  []TestValue{{Entity: "Ticket", Field: "status", Value: "closed"}},
+				When:   TestWhen{Operation: "update", Target: "Ticket"},
+				Expect: TestExpect{Reject: true, Message: "TICKET_CLOSED"},
+			},
+		},
+		{
+			name: "update expected to reject succeeds",
+			tc: &TestCase{
+				Given:  []TestValue{{Entity: "Ticket", Field: "status", Value: "open"}},
+				When:   TestWhen{Operation: "update", Target: "Ticket"},
+				Expect: TestExpect{Reject: true, Message: "TICKET_CLOSED"},
+			},
+			failure: "expected reject TICKET_CLOSED, but update Ticket succeeded",
+		},
+		{
+			name: "create applies defaults",
+			tc: &TestCase{
+				When:   TestWhen{Operation: "create", Target: "Ticket"},
+				Expect: TestExpect{TestValue: TestValue{Entity: "Ticket", Field: "status", Value: "open"}},
+			},
+		},
+		{
+			name: "create uses given input",
+			tc: &TestCase{
+				Given:  []TestValue{{Entity: "Ticket", Field: "subject", Value: "Printer on fire"}},
+				When:   TestWhen{Operation: "create", Target: "Ticket"},
+				Expect: TestExpect{TestValue: TestValue{Entity: "Ticket", Field: "subject", Value: "Printer on fire"}},
+			},
+		},
+		{
+			name: "wrong field value",
+			tc: &TestCase{
+				When:   TestWhen{Operation: "create", Target: "Ticket"},
+				Expect: TestExpect{TestValue: TestValue{Entity: "Ticket", Field: "status", Value: "closed"}},
+			},
+			failure: `expected Ticket.status = "closed", got "open"`,
+		},
+		{
+			name: "action rejected by rule",
+			tc: &TestCase{
+				Given:  []TestValue{{Entity: "Ticket", Field: "status", Value: "closed"}},
+				When:   TestWhen{Operation: "action", Target: "close_ticket"},
+				Expect: TestExpect{Reject: true},
+			},
+		},
+		{
+			name: "unexpected rejection",
+			tc: &TestCase{
+				Given:  []TestValue{{Entity: "Ticket", Field: "status", Value: "closed"}},
+				When:   TestWhen{Operation: "action", Target: "close_ticket"},
+				Expect: TestExpect{TestValue: TestValue{Entity: "Ticket", Field: "status", Value: "closed"}},
+			},
+			failure: "action close_ticket was rejected: 422 TICKET_CLOSED",
+		},
+		{
+			name: "action with steps",
+			tc: &TestCase{
+				When:   TestWhen{Operation: "action", Target: "resolve_ticket"},
+				Expect: TestExpect{TestValue: TestValue{Entity: "Ticket", Field: "status", Value: "closed"}},
+			},
+		},
+		{
+			name: "action with steps rejected by rule",
+			tc: &TestCase{
+				Given:  []TestValue{{Entity: "Ticket", Field: "status", Value: "closed"}},
+				When:   TestWhen{Operation: "action", Target: "resolve_ticket"},
+				Expect: TestExpect{Reject: true, Message: "TICKET_CLOSED"},
+			},
+		},
+		{
+			name: "deleted record",
+			tc: &TestCase{
+				When:   TestWhen{Operation: "delete", Target: "Ticket"},
+				Expect: TestExpect{TestValue: TestValue{Entity: "Ticket", Field: "status", Value: "open"}},
+			},
+			failure: "there is no Ticket record",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := createTestRunnerServer(t)
+			result := s.RunTest(context.Background(), tt.tc)
+			if tt.failure == "" && !result.Passed {
+				t.Fatalf("expected the test to pass, got: %s", result.Message)
+			}
+			if tt.failure != "" && (result.Passed || !strings.Contains(result.Message, tt.failure)) {
+				t.Fatalf("expected failure %q, got passed=%v message=%q", tt.failure, result.Passed, result.Message)
+			}
+		})
+	}
+}
+
+func TestRunTest_SeedsRequiredRecords(t *testing.T) {
+	s, database := createTestRunnerServer(t)
+
+	// A leftover row from a previous test is removed
+	database.tables["tickets"] = []map[string]any{{"id": uuid.NewString(), "status": "closed"}}
+
+	result := s.RunTest(context.Background(), &TestCase{
+		When:   TestWhen{Operation: "create", Target: "Ticket"},
+		Expect: TestExpect{TestValue: TestValue{Entity: "Ticket", Field: "status", Value: "open"}},
+	})
+	if !result.Passed {
+		t.Fatalf("test failed: %s", result.Message)
+	}
+
+	users, tickets := database.tables["users"], database.tables["tickets"]
+	if len(users) != 1 || len(tickets) != 1 {
+		t.Fatalf("expected one user and one ticket, got %d and %d", len(users), len(tickets))
+	}
+	if tickets[0]["author_id"] != users[0]["id"] {
+		t.Errorf("ticket author = %v, want the seeded user %v", tickets[0]["author_id"], users[0]["id"])
+	}
+	if email, _ := users[0]["email"].(string); !strings.HasSuffix(email, "@example.com") {
+		t.Errorf("required email was not filled, got %v", users[0]["email"])
+	}
+	if subject, _ := tickets[0]["subject"].(string); subject == "" {
+		t.Error("required subject was not filled")
+	}
+}
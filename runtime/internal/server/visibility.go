@@ -0,0 +1,164 @@
+// Package server provides field visibility, which decides the fields of a
+// record a user reads.
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/forge-lang/forge/runtime/internal/expr"
+)
+
+// A hidden field is write-only: creates and updates may set it, but no
+// response, view or broadcast carries it. The user entity's password field
+// is hidden whether or not it is declared so. A field with a read condition,
+// as in ssn: string read: user.role == admin, is carried only to the users
+// the condition holds for. The condition depends on the user alone, so it is
+// evaluated once per user rather than once per record. The system principal
+// reads every field that is not hidden.
+
+// fieldReader decides the fields the principal in ctx reads. A condition
+// that cannot be evaluated fails closed and the field is left out.
+type fieldReader struct {
+	s     *Server
+	ctx   context.Context
+	q     querier
+	holds map[string]bool // by condition
+}
+
+func (s *Server) newFieldReader(ctx context.Context, q querier) *fieldReader {
+	return &fieldReader{s: s, ctx: ctx, q: q, holds: make(map[string]bool)}
+}
+
+// canRead reports whether the principal reads the fields with the read
+// condition.
+func (fr *fieldReader) canRead(condition string) bool {
+	if condition == "" {
+		return true
+	}
+	if held, ok := fr.holds[condition]; ok {
+		return held
+	}
+	held, err := fr.eval(condition)
+	if err != nil {
+		fr.s.logger.Error("field.read_failed", "condition", condition, "error", err)
+	}
+	fr.holds[condition] = held
+	return held
+}
+
+func (fr *fieldReader) eval(condition string) (bool, error) {
+	if principalFrom(fr.ctx).System {
+		return true, nil
+	}
+	node, err := expr.Parse(condition)
+	if err != nil {
+		return false, fmt.Errorf("read condition: %w", err)
+	}
+	// The condition refers to no record: bare names are enum values
+	return expr.EvalBool(fr.ctx, node, fr.s.newRecordResolver(fr.ctx, fr.q, &EntitySchema{}, nil, nil))
+}
+
+// record returns record without the fields of entity the principal may not
+// read. It returns record itself when every field is readable.
+func (fr *fieldReader) record(entity *EntitySchema, record map[string]interface{}) map[string]interface{} {
+	denied := fr.s.hiddenFields(entity)
+	for name, field := range entity.Fields {
+		if !fr.canRead(field.Read) {
+			denied = append(denied, name)
+		}
+	}
+	return without(record, denied)
+}
+
+// records replaces each of records with the fields the principal may read.
+func (fr *fieldReader) records(entity *EntitySchema, records []map[string]interface{}) []map[string]interface{} {
+	for i, record := range records {
+		records[i] = fr.record(entity, record)
+	}
+	return records
+}
+
+// viewRows replaces each of rows with the view fields the principal may
+// read. Hidden fields cannot be part of a view.
+func (fr *fieldReader) viewRows(view *ViewSchema, rows []map[string]interface{}) []map[string]interface{} {
+	var denied []string
+	for _, f := range view.Fields {
+		if !fr.canRead(f.Read) {
+			denied = append(denied, f.Alias)
+		}
+	}
+	if len(denied) == 0 {
+		return rows
+	}
+	for i, row := range rows {
+		rows[i] = without(row, denied)
+	}
+	return rows
+}
+
+// hiddenFields returns the fields of entity no one reads through the API.
+func (s *Server) hiddenFields(entity *EntitySchema) []string {
+	var hidden []string
+	for name, field := range entity.Fields {
+		if field.Hidden {
+			hidden = append(hidden, name)
+		}
+	}
+	if entity.Name == s.userEntityName() {
+		if field, ok := entity.Fields[s.passwordField()]; !ok || !field.Hidden {
+			hidden = append(hidden, s.passwordField())
+		}
+	}
+	return hidden
+}
+
+// readConditions returns the read conditions of the fields pushed to
+// subscribers of key, by field: those of the view key names, as
+// projectRecord does, otherwise those of the entity.
+func (s *Server) readConditions(key, entityName string) map[string]string {
+	artifact := s.getArtifact()
+	conditions := make(map[string]string)
+	viewName, _, _ := strings.Cut(key, ":")
+	if view, ok := artifact.Views[viewName]; ok && view.Source == entityName {
+		for _, f := range view.Fields {
+			if f.Read != "" {
+				conditions[f.Alias] = f.Read
+			}
+		}
+		return conditions
+	}
+	if entity, ok := artifact.Entities[entityName]; ok {
+		for name, field := range entity.Fields {
+			if field.Read != "" {
+				conditions[name] = field.Read
+			}
+		}
+	}
+	return conditions
+}
+
+// without returns a copy of record without the fields named, or record
+// itself when it has none of them.
+func without(record map[string]interface{}, names []string) map[string]interface{} {
+	found := false
+	for _, name := range names {
+		if _, ok := record[name]; ok {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return record
+	}
+
+	copied := make(map[string]interface{}, len(record))
+	for k, v := range record {
+		copied[k] = v
+	}
+	for _, name := range names {
+		delete(copied, name)
+	}
+	return copied
+}
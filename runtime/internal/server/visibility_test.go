@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/forge-lang/forge/runtime/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+const visibilityAgentID = "33333333-3333-3333-3333-333333333333"
+
+// visibilityArtifact adds a password, a hidden token and an ssn only admins
+// read to the helpdesk users.
+func visibilityArtifact() *Artifact {
+	artifact := helpdeskRulesArtifact()
+	users := artifact.Entities["User"]
+	users.Fields["password_hash"] = &FieldSchema{Name: "password_hash", Type: "string"}
+	users.Fields["api_token"] = &FieldSchema{Name: "api_token", Type: "string", Hidden: true}
+	users.Fields["ssn"] = &FieldSchema{Name: "ssn", Type: "string", Read: "(user.role == admin)"}
+	return artifact
+}
+
+// visibilityUsers answers user lookups by id: ruleTestUserID is an admin and
+// visibilityAgentID an agent.
+func visibilityUsers(ctx context.Context, query string, args ...any) (db.Rows, error) {
+	roles := map[string]string{ruleTestUserID: "admin", visibilityAgentID: "agent"}
+	role, ok := roles[args[0].(string)]
+	if !strings.HasPrefix(query, "SELECT * FROM users") || !ok {
+		return &mockRows{}, nil
+	}
+	return &mockRows{
+		cols:   []string{"id", "role", "ssn", "password_hash", "api_token"},
+		values: [][]any{{args[0], role, "123-45-6789", "$2a$hash", "secret"}},
+	}, nil
+}
+
+func visibilityRecord() map[string]any {
+	return map[string]any{"id": ruleTestUserID, "role": "admin", "ssn": "123-45-6789", "password_hash": "$2a$hash", "api_token": "secret"}
+}
+
+func TestFieldReader(t *testing.T) {
+	s := createTestServerWithMockDB(t, visibilityArtifact(), &mockDB{queryFunc: visibilityUsers})
+	users := s.getArtifact().Entities["User"]
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantSSN bool
+	}{
+		{"admin", context.WithValue(context.Background(), userContextKey{}, ruleTestUserID), true},
+		{"agent", context.WithValue(context.Background(), userContextKey{}, visibilityAgentID), false},
+		{"anonymous", context.Background(), false},
+		{"system", withSystemPrincipal(context.Background(), "test"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := visibilityRecord()
+			got := s.newFieldReader(tt.ctx, s.db).record(users, record)
+
+			if _, ok := got["ssn"]; ok != tt.wantSSN {
+				t.Errorf("ssn present = %v, want %v", ok, tt.wantSSN)
+			}
+			for _, hidden := range []string{"password_hash", "api_token"} {
+				if _, ok := got[hidden]; ok {
+					t.Errorf("%s must never be read", hidden)
+				}
+			}
+			if got["role"] != "admin" {
+				t.Errorf("role = %v, want admin", got["role"])
+			}
+			if len(record) != 5 {
+				t.Error("the record given must not be changed")
+			}
+		})
+	}
+}
+
+func TestFieldReader_ViewRows(t *testing.T) {
+	s := createTestServerWithMockDB(t, visibilityArtifact(), &mockDB{queryFunc: visibilityUsers})
+	view := &ViewSchema{Name: "UserList", Source: "User", Fields: []ViewField{
+		{Name: "id", Alias: "id"},
+		{Name: "ssn", Alias: "ssn", Read: "(user.role == admin)"},
+	}}
+
+	for userID, want := range map[string]bool{ruleTestUserID: true, visibilityAgentID: false} {
+		ctx := context.WithValue(context.Background(), userContextKey{}, userID)
+		rows := s.newFieldReader(ctx, s.db).viewRows(view, []map[string]any{{"id": ruleTestUserID, "ssn": "123-45-6789"}})
+		if _, ok := rows[0]["ssn"]; ok != want {
+			t.Errorf("user %s: ssn present = %v, want %v", userID, ok, want)
+		}
+	}
+}
+
+func TestHandleGet_FieldVisibility(t *testing.T) {
+	s := createTestServerWithMockDB(t, visibilityArtifact(), &mockDB{queryFunc: visibilityUsers})
+	r := chi.NewRouter()
+	r.Get("/api/entities/{entity}/{id}", s.handleGet)
+
+	for userID, want := range map[string]bool{ruleTestUserID: true, visibilityAgentID: false} {
+		req := httptest.NewRequest("GET", "/api/entities/User/"+ruleTestUserID, nil)
+		req = req.WithContext(context.WithValue(req.Context(), userContextKey{}, userID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var resp struct {
+			Data map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if _, ok := resp.Data["ssn"]; ok != want {
+			t.Errorf("user %s: ssn present = %v, want %v", userID, ok, want)
+		}
+		if _, ok := resp.Data["password_hash"]; ok {
+			t.Errorf("user %s: the password must never be read", userID)
+		}
+		if _, ok := resp.Data["api_token"]; ok {
+			t.Errorf("user %s: hidden fields must never be read", userID)
+		}
+	}
+}
+
+func TestPushRecord_FieldVisibility(t *testing.T) {
+	s := createTestServerWithMockDB(t, visibilityArtifact(), &mockDB{queryFunc: visibilityUsers})
+	admin := replicaClient(s.hub, ruleTestUserID, "User:update")
+	agent := replicaClient(s.hub, visibilityAgentID, "User:update")
+
+	s.pushRecord("User:update", "User", visibilityRecord(), nil)
+
+	for c, want := range map[*Client]bool{admin: true, agent: false} {
+		if len(c.send) != 1 {
+			t.Fatalf("user %s: got %d messages, want 1", c.UserID(), len(c.send))
+		}
+		var msg struct {
+			Data map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(<-c.send, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := msg.Data["ssn"]; ok != want {
+			t.Errorf("user %s: ssn present = %v, want %v", c.UserID(), ok, want)
+		}
+		if _, ok := msg.Data["api_token"]; ok {
+			t.Errorf("user %s: hidden fields must never be pushed", c.UserID())
+		}
+	}
+}
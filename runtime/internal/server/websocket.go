@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -22,8 +25,9 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// Maximum message size allowed from peer. Auth tokens and view
+	// subscriptions with filters need more than a few hundred bytes.
+	maxMessageSize = 4096
 )
 
 var upgrader = websocket.Upgrader{
@@ -40,11 +44,40 @@ type Client struct {
 	conn *websocket.Conn
 	send chan []byte
 
-	// Subscriptions
+	// userID is the user the connection acts for, empty when anonymous.
+	// Pushes are filtered by read access for this user. Guarded by mu.
+	userID string
+
+	// authenticate resolves the token of an auth message to a user ID. Nil
+	// when the app has no authentication.
+	authenticate func(token string) (string, error)
+
+	// views serves subscriptions to declared views. Nil when the client
+	// only subscribes to topics.
+	views viewServer
+
+	// Subscriptions: topics by name, view subscriptions by ID
 	subscriptions map[string]bool
+	viewSubs      map[string]*viewSubscription
 	mu            sync.RWMutex
 }
 
+// viewServer runs the queries of view subscriptions and stores presence
+// updates.
+type viewServer interface {
+	// hasView reports whether name is a declared view, subscribed to with a
+	// query rather than as a topic.
+	hasView(name string) bool
+
+	// subscribeView starts the view subscription msg asks for and sends
+	// the client its first page.
+	subscribeView(c *Client, msg WSMessage) error
+
+	// updatePresence sets the presence state of the client's user in the
+	// scope msg names and pushes it to the scope's subscribers.
+	updatePresence(c *Client, msg WSMessage) error
+}
+
 // Hub maintains the set of active clients and broadcasts messages.
 type Hub struct {
 	// Registered clients
@@ -61,7 +94,20 @@ type Hub struct {
 
 	// View subscriptions: viewName -> clients
 	viewSubs map[string]map[*Client]bool
-	mu       sync.RWMutex
+
+	// Subscriptions to declared views: viewName -> subscriptions
+	queries map[string]map[*viewSubscription]bool
+	mu      sync.RWMutex
+
+	// node identifies the hub among the replicas sharing its backplane
+	node string
+
+	// backplane relays broadcasts to the hubs of other replicas. Nil when
+	// the hub serves a single process.
+	backplane Backplane
+
+	// relays handle the events relayed by other replicas, by topic
+	relays map[string]func(json.RawMessage)
 }
 
 // NewHub creates a new Hub.
@@ -72,6 +118,9 @@ func NewHub() *Hub {
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
 		viewSubs:   make(map[string]map[*Client]bool),
+		queries:    make(map[string]map[*viewSubscription]bool),
+		node:       uuid.NewString(),
+		relays:     make(map[string]func(json.RawMessage)),
 	}
 }
 
@@ -80,22 +129,32 @@ func (h *Hub) Run() {
 	for {
 		select {
 		case client := <-h.register:
+			h.mu.Lock()
 			h.clients[client] = true
+			h.mu.Unlock()
 
 		case client := <-h.unregister:
+			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
 				close(client.send)
 
 				// Remove from all subscriptions
-				h.mu.Lock()
 				for _, clients := range h.viewSubs {
 					delete(clients, client)
 				}
-				h.mu.Unlock()
+				for _, subs := range h.queries {
+					for sub := range subs {
+						if sub.client == client {
+							delete(subs, sub)
+						}
+					}
+				}
 			}
+			h.mu.Unlock()
 
 		case message := <-h.broadcast:
+			h.mu.Lock()
 			for client := range h.clients {
 				select {
 				case client.send <- message:
@@ -104,6 +163,7 @@ func (h *Hub) Run() {
 					delete(h.clients, client)
 				}
 			}
+			h.mu.Unlock()
 		}
 	}
 }
@@ -144,33 +204,122 @@ func (h *Hub) Unsubscribe(client *Client, viewName string) {
 	client.mu.Unlock()
 }
 
-// BroadcastToView sends a message to all clients subscribed to a view.
-func (h *Hub) BroadcastToView(viewName string, data interface{}) {
+// addViewSubscription registers sub with its client. It returns false when
+// the client already has a subscription with the same ID.
+func (h *Hub) addViewSubscription(sub *viewSubscription) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c := sub.client
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.viewSubs[sub.ID]; exists {
+		return false
+	}
+	if c.viewSubs == nil {
+		c.viewSubs = make(map[string]*viewSubscription)
+	}
+	c.viewSubs[sub.ID] = sub
+
+	if h.queries[sub.View] == nil {
+		h.queries[sub.View] = make(map[*viewSubscription]bool)
+	}
+	h.queries[sub.View][sub] = true
+	return true
+}
+
+// removeViewSubscription ends the client's view subscription id. It
+// returns false when there is none.
+func (h *Hub) removeViewSubscription(client *Client, id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client.mu.Lock()
+	sub, ok := client.viewSubs[id]
+	delete(client.viewSubs, id)
+	client.mu.Unlock()
+	if ok {
+		delete(h.queries[sub.View], sub)
+	}
+	return ok
+}
+
+// viewSubscriptions returns the subscriptions to a declared view.
+func (h *Hub) viewSubscriptions(viewName string) []*viewSubscription {
 	h.mu.RLock()
-	clients := h.viewSubs[viewName]
-	clientCount := len(clients)
-	h.mu.RUnlock()
+	defer h.mu.RUnlock()
 
-	log.Printf("[WS] Broadcasting to view %s, %d clients subscribed", viewName, clientCount)
+	subs := make([]*viewSubscription, 0, len(h.queries[viewName]))
+	for sub := range h.queries[viewName] {
+		subs = append(subs, sub)
+	}
+	return subs
+}
 
-	if clientCount == 0 {
+// BroadcastToView sends a message to all clients subscribed to a view, on
+// every replica.
+func (h *Hub) BroadcastToView(viewName string, data interface{}) {
+	msgBytes, err := json.Marshal(WSMessage{Type: "data", View: viewName, Data: data})
+	if err != nil {
+		log.Printf("[WS] Error marshaling broadcast: %v", err)
 		return
 	}
+	h.sendToView(viewName, msgBytes, nil)
+	h.publish(hubEnvelope{Kind: "view", View: viewName, Message: msgBytes})
+}
 
-	msg := WSMessage{
+// BroadcastToViewFunc sends a message to the clients subscribed to a view
+// for which allow returns true. A nil allow sends to every subscriber. Only
+// the clients of this replica are reached, since allow cannot be relayed;
+// callers relay the event that caused the message instead.
+func (h *Hub) BroadcastToViewFunc(viewName string, data interface{}, allow func(*Client) bool) {
+	msg := &WSMessage{
 		Type: "data",
 		View: viewName,
 		Data: data,
 	}
+	h.SendToView(viewName, func(client *Client) *WSMessage {
+		if allow != nil && !allow(client) {
+			return nil
+		}
+		return msg
+	})
+}
 
-	msgBytes, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("[WS] Error marshaling broadcast: %v", err)
+// SendToView sends each client subscribed to a view the message returned
+// for it, skipping clients for which message returns nil. Each distinct
+// message is marshaled once.
+func (h *Hub) SendToView(viewName string, message func(*Client) *WSMessage) {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.viewSubs[viewName]))
+	for client := range h.viewSubs[viewName] {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	log.Printf("[WS] Broadcasting to view %s, %d clients subscribed", viewName, len(clients))
+
+	if len(clients) == 0 {
 		return
 	}
 
+	marshaled := make(map[*WSMessage][]byte)
 	sentCount := 0
-	for client := range clients {
+	for _, client := range clients {
+		msg := message(client)
+		if msg == nil {
+			continue
+		}
+		msgBytes, ok := marshaled[msg]
+		if !ok {
+			var err error
+			msgBytes, err = json.Marshal(msg)
+			if err != nil {
+				log.Printf("[WS] Error marshaling broadcast: %v", err)
+				return
+			}
+			marshaled[msg] = msgBytes
+		}
 		select {
 		case client.send <- msgBytes:
 			sentCount++
@@ -181,17 +330,25 @@ func (h *Hub) BroadcastToView(viewName string, data interface{}) {
 	log.Printf("[WS] Broadcast sent to %d clients", sentCount)
 }
 
-// BroadcastEphemeral broadcasts an ephemeral message to view subscribers except the sender.
-// Used for presence, typing indicators, cursor positions, and other transient state.
-func (h *Hub) BroadcastEphemeral(sender *Client, viewName string, data interface{}) {
+// SubscribedKeys returns the subscriptions to a view that have clients: the
+// view name itself and its parameterizations "<view>:<params>", sorted.
+func (h *Hub) SubscribedKeys(viewName string) []string {
 	h.mu.RLock()
-	clients := h.viewSubs[viewName]
-	h.mu.RUnlock()
+	defer h.mu.RUnlock()
 
-	if len(clients) == 0 {
-		return
+	var keys []string
+	for key, clients := range h.viewSubs {
+		if len(clients) > 0 && (key == viewName || strings.HasPrefix(key, viewName+":")) {
+			keys = append(keys, key)
+		}
 	}
+	sort.Strings(keys)
+	return keys
+}
 
+// BroadcastEphemeral broadcasts an ephemeral message to view subscribers except the sender.
+// Used for presence, typing indicators, cursor positions, and other transient state.
+func (h *Hub) BroadcastEphemeral(sender *Client, viewName string, data interface{}) {
 	msg := WSMessage{
 		Type: "ephemeral",
 		View: viewName,
@@ -204,9 +361,19 @@ func (h *Hub) BroadcastEphemeral(sender *Client, viewName string, data interface
 		return
 	}
 
-	for client := range clients {
-		// Don't send back to the sender
-		if client == sender {
+	// Don't send back to the sender, which is connected to this replica
+	h.sendToView(viewName, msgBytes, sender)
+	h.publish(hubEnvelope{Kind: "view", View: viewName, Message: msgBytes})
+}
+
+// sendToView queues msgBytes for the clients of this replica subscribed to
+// a view, except skip.
+func (h *Hub) sendToView(viewName string, msgBytes []byte, skip *Client) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for client := range h.viewSubs[viewName] {
+		if client == skip {
 			continue
 		}
 		select {
@@ -219,10 +386,44 @@ func (h *Hub) BroadcastEphemeral(sender *Client, viewName string, data interface
 
 // WSMessage represents a WebSocket message.
 type WSMessage struct {
-	Type  string      `json:"type"` // subscribe, unsubscribe, data, error
+	Type  string      `json:"type"`         // auth, subscribe, unsubscribe, presence, data, snapshot, update, error
+	ID    string      `json:"id,omitempty"` // view subscription ID
 	View  string      `json:"view,omitempty"`
 	Data  interface{} `json:"data,omitempty"`
+	Items interface{} `json:"items,omitempty"` // re-queried view results and snapshots
 	Error string      `json:"error,omitempty"`
+	Token string      `json:"token,omitempty"`
+
+	// Query of a view subscription, as the query string of GET /api/views
+	Params map[string]string      `json:"params,omitempty"`
+	Filter map[string]interface{} `json:"filter,omitempty"`
+	Sort   string                 `json:"sort,omitempty"`
+	Limit  int                    `json:"limit,omitempty"`
+
+	// Changes to the page of a view subscription, applied in order
+	Changes []ViewChange `json:"changes,omitempty"`
+
+	// Presence update: the declared presence and the id of the scope record,
+	// with the state in Data
+	Presence string `json:"presence,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+// ViewChange is a change to the page of a view subscription. Positions are
+// indexes into the page as it is when the change is applied. An update
+// replaces the row with the ID and moves it to Position.
+type ViewChange struct {
+	Op       string                 `json:"op"` // insert, update, delete
+	ID       string                 `json:"id"`
+	Position int                    `json:"position"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// UserID returns the user the client is authenticated as, or "".
+func (c *Client) UserID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.userID
 }
 
 // readPump pumps messages from the WebSocket connection to the hub.
@@ -255,18 +456,49 @@ func (c *Client) readPump() {
 		}
 
 		switch msg.Type {
+		case "auth":
+			// Authenticates the connection, or switches it to another user.
+			if c.authenticate == nil {
+				c.sendError("authentication not enabled")
+				continue
+			}
+			userID, err := c.authenticate(msg.Token)
+			if err != nil {
+				c.sendError("invalid token")
+				continue
+			}
+			c.mu.Lock()
+			c.userID = userID
+			c.mu.Unlock()
+			c.sendAck("authenticated", "")
+
 		case "subscribe":
-			if msg.View != "" {
+			if msg.View != "" && c.views != nil && c.views.hasView(msg.View) {
+				if err := c.views.subscribeView(c, msg); err != nil {
+					c.sendMessage(&WSMessage{Type: "error", ID: msg.ID, View: msg.View, Error: err.Error()})
+				}
+			} else if msg.View != "" {
 				c.hub.Subscribe(c, msg.View)
 				c.sendAck("subscribed", msg.View)
 			}
 
 		case "unsubscribe":
-			if msg.View != "" {
+			if msg.ID != "" && c.hub.removeViewSubscription(c, msg.ID) {
+				c.sendMessage(&WSMessage{Type: "ack", ID: msg.ID, View: msg.View, Data: "unsubscribed"})
+			} else if msg.View != "" {
 				c.hub.Unsubscribe(c, msg.View)
 				c.sendAck("unsubscribed", msg.View)
 			}
 
+		case "presence":
+			if c.views == nil {
+				c.sendError("presence not enabled")
+				continue
+			}
+			if err := c.views.updatePresence(c, msg); err != nil {
+				c.sendMessage(&WSMessage{Type: "error", Presence: msg.Presence, Scope: msg.Scope, Error: err.Error()})
+			}
+
 		case "broadcast":
 			// Generic ephemeral broadcast to view subscribers (excludes sender)
 			// Used for presence, typing indicators, cursor positions, etc.
@@ -297,21 +529,17 @@ func (c *Client) writePump() {
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				return
 			}
-			w.Write(message)
 
-			// Add queued messages to the current WebSocket message
+			// Send queued messages in frames of their own, so that every
+			// frame holds one JSON message
 			n := len(c.send)
 			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
-			}
-
-			if err := w.Close(); err != nil {
-				return
+				if err := c.conn.WriteMessage(websocket.TextMessage, <-c.send); err != nil {
+					return
+				}
 			}
 
 		case <-ticker.C:
@@ -323,6 +551,22 @@ func (c *Client) writePump() {
 	}
 }
 
+// sendMessage queues msg for the client. It returns false when the
+// client's buffer is full and the message was dropped.
+func (c *Client) sendMessage(msg *WSMessage) bool {
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("[WS] Error marshaling message: %v", err)
+		return false
+	}
+	select {
+	case c.send <- msgBytes:
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *Client) sendAck(action, view string) {
 	msg := WSMessage{
 		Type: "ack",
@@ -350,7 +594,7 @@ func (c *Client) sendError(errMsg string) {
 	}
 }
 
-// BroadcastToAll sends a message to all connected clients.
+// BroadcastToAll sends a message to all connected clients, on every replica.
 func (h *Hub) BroadcastToAll(msgType string, data interface{}) {
 	msg := WSMessage{
 		Type: msgType,
@@ -363,6 +607,15 @@ func (h *Hub) BroadcastToAll(msgType string, data interface{}) {
 		return
 	}
 
+	h.sendToAll(msgBytes)
+	h.publish(hubEnvelope{Kind: "all", Message: msgBytes})
+}
+
+// sendToAll queues msgBytes for every client of this replica.
+func (h *Hub) sendToAll(msgBytes []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
 	for client := range h.clients {
 		select {
 		case client.send <- msgBytes:
@@ -372,8 +625,10 @@ func (h *Hub) BroadcastToAll(msgType string, data interface{}) {
 	}
 }
 
-// ClientCount returns the number of connected clients.
+// ClientCount returns the number of clients connected to this replica.
 func (h *Hub) ClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return len(h.clients)
 }
 
@@ -386,11 +641,17 @@ func (h *Hub) SubscriptionCounts() map[string]int {
 	for view, clients := range h.viewSubs {
 		counts[view] = len(clients)
 	}
+	for view, subs := range h.queries {
+		counts[view] += len(subs)
+	}
 	return counts
 }
 
-// ServeWs handles WebSocket requests from the peer.
-func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
+// ServeWs handles WebSocket requests from the peer. The connection acts for
+// userID, empty when anonymous, until it sends an auth message; authenticate
+// resolves those tokens and may be nil. views serves subscriptions to
+// declared views and may be nil.
+func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, userID string, authenticate func(token string) (string, error), views viewServer) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("websocket upgrade error: %v", err)
@@ -402,6 +663,10 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		conn:          conn,
 		send:          make(chan []byte, 256),
 		subscriptions: make(map[string]bool),
+		viewSubs:      make(map[string]*viewSubscription),
+		userID:        userID,
+		authenticate:  authenticate,
+		views:         views,
 	}
 
 	client.hub.register <- client
@@ -1,9 +1,15 @@
 package server
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 func TestHub_BroadcastToAll(t *testing.T) {
@@ -173,3 +179,163 @@ func TestHub_BroadcastToView(t *testing.T) {
 		// Expected - no message
 	}
 }
+
+// accessToken returns an access token signed with the server's secret.
+func accessToken(t *testing.T, s *Server, userID string) string {
+	t.Helper()
+	token, _, err := s.generateTokenPair(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// unsignedToken returns a token that only carries a subject, as the
+// Authorization header accepts without a password provider.
+func unsignedToken(userID string) string {
+	return base64.StdEncoding.EncodeToString([]byte(`{"sub":"` + userID + `"}`))
+}
+
+// wsSession is a WebSocket client against a test server.
+type wsSession struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func dialWs(t *testing.T, srv *httptest.Server, query string) *wsSession {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws"+query, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &wsSession{t: t, conn: conn}
+}
+
+func (c *wsSession) send(msg WSMessage) {
+	c.t.Helper()
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+// next returns the next message, or false if none arrives in time. A timed
+// out connection cannot be read again.
+func (c *wsSession) next(wait time.Duration) (WSMessage, bool) {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(wait))
+	var msg WSMessage
+	if err := c.conn.ReadJSON(&msg); err != nil {
+		return WSMessage{}, false
+	}
+	return msg, true
+}
+
+func (c *wsSession) expect(msgType string) WSMessage {
+	c.t.Helper()
+	msg, ok := c.next(time.Second)
+	if !ok || msg.Type != msgType {
+		c.t.Fatalf("expected %s message, got %+v (received: %v)", msgType, msg, ok)
+	}
+	return msg
+}
+
+func TestServeWs_Authentication(t *testing.T) {
+	fake := &accessDB{tables: accessTables()}
+	s := createTestServerWithMockDB(t, accessArtifact(), &mockDB{queryFunc: fake.query})
+	go s.hub.Run()
+	srv := httptest.NewServer(s.authMiddleware(http.HandlerFunc(s.handleWebSocket)))
+	defer srv.Close()
+
+	onConnect := dialWs(t, srv, "?token="+accessToken(t, s, ruleTestUserID))
+	byMessage := dialWs(t, srv, "")
+	byMessage.send(WSMessage{Type: "auth", Token: accessToken(t, s, ruleTestUserID)})
+	byMessage.expect("ack")
+	other := dialWs(t, srv, "?token="+accessToken(t, s, ruleTestOtherID))
+	anonymous := dialWs(t, srv, "")
+
+	for _, c := range []*wsSession{onConnect, byMessage, other, anonymous} {
+		c.send(WSMessage{Type: "subscribe", View: "Ticket:update"})
+		c.expect("ack")
+	}
+
+	s.broadcastEntityChange("Ticket", "update", map[string]any{"id": ruleTestTicketID, "subject": "mine", "author_id": ruleTestUserID})
+
+	for name, c := range map[string]*wsSession{"token on connect": onConnect, "auth message": byMessage} {
+		if msg := c.expect("data"); msg.View != "Ticket:update" {
+			t.Errorf("%s: unexpected push %+v", name, msg)
+		}
+	}
+	for name, c := range map[string]*wsSession{"other user": other, "anonymous": anonymous} {
+		if msg, ok := c.next(50 * time.Millisecond); ok {
+			t.Errorf("%s received %+v", name, msg)
+		}
+	}
+
+	for _, token := range []string{"not-a-token", unsignedToken(ruleTestUserID)} {
+		invalid := dialWs(t, srv, "")
+		invalid.send(WSMessage{Type: "auth", Token: token})
+		if msg := invalid.expect("error"); msg.Error != "invalid token" {
+			t.Errorf("%s: error = %q, want invalid token", token, msg.Error)
+		}
+
+		_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?token="+token, nil)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s on connect: err = %v, want 401", token, err)
+		}
+	}
+
+	// authMiddleware trusts an unsigned header without a password provider;
+	// the socket must not
+	s.runtimeConf.Auth.Provider = ""
+	header := http.Header{"Authorization": {"Bearer " + unsignedToken(ruleTestUserID)}}
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", header)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unsigned Authorization header: err = %v, want 401", err)
+	}
+	header.Set("Authorization", "Bearer "+accessToken(t, s, ruleTestUserID))
+	byHeader, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", header)
+	if err != nil {
+		t.Fatalf("signed Authorization header: %v", err)
+	}
+	byHeader.Close()
+
+	// Without a secret no token can be verified
+	s.runtimeConf.Auth.JWT.Secret = ""
+	unverified := dialWs(t, srv, "")
+	unverified.send(WSMessage{Type: "auth", Token: unsignedToken(ruleTestUserID)})
+	if msg := unverified.expect("error"); msg.Error != "invalid token" {
+		t.Errorf("without a secret: error = %q, want invalid token", msg.Error)
+	}
+}
+
+func TestProjectRecord(t *testing.T) {
+	artifact := accessArtifact()
+	s := createTestServerWithMockDB(t, artifact, &mockDB{})
+	s.runtimeConf.Auth.Password.PasswordField = "password_hash"
+
+	ticket := map[string]any{"id": ruleTestTicketID, "subject": "mine", "author_id": ruleTestUserID, "status": "open"}
+	user := map[string]any{"id": ruleTestUserID, "role": "agent", "password_hash": "secret"}
+
+	tests := []struct {
+		name   string
+		key    string
+		entity string
+		record map[string]any
+		want   map[string]any
+	}{
+		{"view fields", "TicketList", "Ticket", ticket, map[string]any{"id": ruleTestTicketID, "subject": "mine"}},
+		{"parameterized view", "TicketList:" + ruleTestUserID, "Ticket", ticket, map[string]any{"id": ruleTestTicketID, "subject": "mine"}},
+		{"entity subscription", "Ticket:update", "Ticket", ticket, ticket},
+		{"user password removed", "User:update", "User", user, map[string]any{"id": ruleTestUserID, "role": "agent"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := json.Marshal(s.projectRecord(tt.key, tt.entity, tt.record))
+			want, _ := json.Marshal(tt.want)
+			if string(got) != string(want) {
+				t.Errorf("projected %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// writeError is an input rejected by the write policy of an entity. It
+// carries one message per offending key.
+type writeError struct {
+	Messages []Message
+}
+
+func (e *writeError) Error() string {
+	codes := make([]string, len(e.Messages))
+	for i, m := range e.Messages {
+		codes[i] = m.Code
+	}
+	return strings.Join(codes, ", ")
+}
+
+// writeColumns checks input against the write policy of entity for operation,
+// "create" or "update", and returns the columns it writes with their values
+// converted for SQL. It returns a *writeError when any key is not writable.
+//
+// A create or update writes only the columns its entity declares. Every key
+// of the input must be a field or a to-one relation of the entity, given by
+// name or by foreign key, and its value must fit the field's type, enum
+// values and length. The database maintains created_at and updated_at, and
+// the user entity's password is only written by the auth endpoints, so
+// neither is writable. A create may choose the id of its record; an update
+// names its record by id and never changes it. Values are converted for SQL
+// before any query is built, so a key of the input never reaches SQL.
+func (s *Server) writeColumns(entity *EntitySchema, operation string, input map[string]interface{}) (map[string]interface{}, error) {
+	keys := make([]string, 0, len(input))
+	for key := range input {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	columns := make(map[string]interface{}, len(input))
+	var messages []Message
+	reject := func(code, format string, args ...any) {
+		messages = append(messages, Message{Code: code, Level: "error", Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, key := range keys {
+		v := input[key]
+
+		if key == "id" {
+			// The id of an update names the record to update
+			if operation == "create" {
+				if !validFieldValue(&FieldSchema{Type: "uuid"}, v) {
+					reject("INVALID_FIELD", "invalid id for %s", entity.Name)
+					continue
+				}
+				columns["id"] = v
+			}
+			continue
+		}
+
+		if field, ok := entity.Fields[key]; ok {
+			if key == "created_at" || key == "updated_at" || s.isPasswordField(entity, key) {
+				reject("READONLY_FIELD", "field %s of %s is read-only", key, entity.Name)
+				continue
+			}
+			value, ok := fieldValue(field, v)
+			if !ok {
+				reject("INVALID_FIELD", "invalid value for field %s of %s", key, entity.Name)
+				continue
+			}
+			columns[key] = value
+			continue
+		}
+
+		if rel := toOneRelation(entity, key); rel != nil {
+			if v != nil && !validFieldValue(&FieldSchema{Type: "uuid"}, v) {
+				reject("INVALID_FIELD", "invalid id for relation %s of %s", rel.Name, entity.Name)
+				continue
+			}
+			// A relation given both by name and by foreign key is set by name
+			if _, byName := input[rel.Name]; byName && key != rel.Name {
+				continue
+			}
+			columns[rel.ForeignKey] = v
+			continue
+		}
+
+		if rel, ok := entity.Relations[key]; ok && rel.IsMany {
+			reject("UNKNOWN_FIELD", "relation %s of %s is linked through /api/entities/%s/{id}/%s", key, entity.Name, entity.Name, key)
+			continue
+		}
+		reject("UNKNOWN_FIELD", "unknown field %s in %s", key, entity.Name)
+	}
+
+	if len(messages) > 0 {
+		return nil, &writeError{Messages: messages}
+	}
+	return columns, nil
+}
+
+// toOneRelation returns the to-one relation of entity named key or stored in
+// the foreign key column key, or nil.
+func toOneRelation(entity *EntitySchema, key string) *RelSchema {
+	for _, rel := range entity.Relations {
+		if !rel.IsMany && (rel.Name == key || rel.ForeignKey == key) {
+			return rel
+		}
+	}
+	return nil
+}
+
+// isPasswordField reports whether name is the password field of the user
+// entity.
+func (s *Server) isPasswordField(entity *EntitySchema, name string) bool {
+	return entity.Name == s.userEntityName() && name == s.passwordField()
+}
+
+// passwordField returns the field of the user entity holding the password
+// hash.
+func (s *Server) passwordField() string {
+	if s.runtimeConf != nil && s.runtimeConf.Auth.Password.PasswordField != "" {
+		return s.runtimeConf.Auth.Password.PasswordField
+	}
+	return "password_hash"
+}
+
+// fieldValue converts v, decoded from JSON or set by a hook, to the value of
+// field written to SQL. It reports false when v does not fit the field: a
+// value of another type, an enum value the field does not declare or a
+// string longer than its maximum length. Null fits nullable fields only.
+func fieldValue(field *FieldSchema, v interface{}) (interface{}, bool) {
+	if v == nil {
+		return nil, field.Nullable
+	}
+
+	switch field.Type {
+	case "int":
+		switch n := v.(type) {
+		case int:
+			return int64(n), true
+		case int64:
+			return n, true
+		case float64:
+			return int64(n), n == float64(int64(n))
+		}
+		return nil, false
+	case "float":
+		switch n := v.(type) {
+		case int:
+			return float64(n), true
+		case int64:
+			return float64(n), true
+		case float64:
+			return n, true
+		}
+		return nil, false
+	case "time":
+		if t, ok := v.(time.Time); ok {
+			return t, true
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		return t, err == nil
+	case "string", "enum", "bool", "uuid":
+		if !validFieldValue(field, v) {
+			return nil, false
+		}
+		if s, ok := v.(string); ok && field.MaxLength > 0 && utf8.RuneCountInString(s) > field.MaxLength {
+			return nil, false
+		}
+		return v, true
+	default:
+		// Other types are checked by the database
+		return v, true
+	}
+}
+
+// insertQuery returns the INSERT of columns into table, returning the new
+// row, and its arguments. Columns are in order, so the query is stable.
+func insertQuery(table string, columns map[string]interface{}) (string, []interface{}) {
+	names := sortedColumns(columns)
+	placeholders := make([]string, len(names))
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		values[i] = columns[name]
+	}
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s) RETURNING *",
+		table,
+		strings.Join(names, ", "),
+		strings.Join(placeholders, ", "),
+	)
+	return query, values
+}
+
+// updateQuery returns the UPDATE of columns of the row of table with id,
+// returning the updated row, and its arguments.
+func updateQuery(table string, columns map[string]interface{}, id string) (string, []interface{}) {
+	names := sortedColumns(columns)
+	sets := make([]string, len(names))
+	values := make([]interface{}, 0, len(names)+1)
+	for i, name := range names {
+		sets[i] = fmt.Sprintf("%s = $%d", name, i+1)
+		values = append(values, columns[name])
+	}
+	values = append(values, id)
+	query := fmt.Sprintf(
+		"UPDATE %s SET %s WHERE id = $%d RETURNING *",
+		table,
+		strings.Join(sets, ", "),
+		len(values),
+	)
+	return query, values
+}
+
+func sortedColumns(columns map[string]interface{}) []string {
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
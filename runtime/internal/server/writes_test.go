@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// writeArtifact adds a user password, a length limit, a count, a due date
+// and relations to the helpdesk rules.
+func writeArtifact() *Artifact {
+	artifact := helpdeskRulesArtifact()
+	artifact.Rules = nil
+	ticket := artifact.Entities["Ticket"]
+	ticket.Fields["subject"].MaxLength = 10
+	ticket.Fields["replies"] = &FieldSchema{Name: "replies", Type: "int"}
+	ticket.Fields["due_at"] = &FieldSchema{Name: "due_at", Type: "time", Nullable: true}
+	ticket.Fields["created_at"] = &FieldSchema{Name: "created_at", Type: "time"}
+	ticket.Relations = map[string]*RelSchema{
+		"assignee": {Name: "assignee", Target: "User", TargetTable: "users", ForeignKey: "assignee_id"},
+		"tags":     {Name: "tags", Target: "Tag", IsMany: true},
+	}
+	artifact.Entities["User"].Fields["password_hash"] = &FieldSchema{Name: "password_hash", Type: "string"}
+	return artifact
+}
+
+func TestWriteColumns(t *testing.T) {
+	s := createTestServerWithMockDB(t, writeArtifact(), &mockDB{})
+	due := "2024-05-01T12:00:00Z"
+
+	tests := []struct {
+		name      string
+		entity    string
+		operation string
+		input     map[string]any
+		want      map[string]any
+		wantCodes []string
+	}{
+		{"fields", "Ticket", "update", map[string]any{"id": ruleTestTicketID, "subject": "printer", "status": "closed"},
+			map[string]any{"subject": "printer", "status": "closed"}, nil},
+		{"create id", "Ticket", "create", map[string]any{"id": ruleTestTicketID},
+			map[string]any{"id": ruleTestTicketID}, nil},
+		{"relation by name", "Ticket", "update", map[string]any{"assignee": ruleTestUserID},
+			map[string]any{"assignee_id": ruleTestUserID}, nil},
+		{"relation by foreign key", "Ticket", "update", map[string]any{"assignee_id": ruleTestUserID},
+			map[string]any{"assignee_id": ruleTestUserID}, nil},
+		{"converted values", "Ticket", "update", map[string]any{"replies": 3.0, "due_at": due},
+			map[string]any{"replies": int64(3), "due_at": time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}, nil},
+		{"null", "Ticket", "update", map[string]any{"due_at": nil},
+			map[string]any{"due_at": nil}, nil},
+
+		{"unknown field", "Ticket", "update", map[string]any{"status = 'open' --": "x"}, nil, []string{"UNKNOWN_FIELD"}},
+		{"many relation", "Ticket", "update", map[string]any{"tags": []any{}}, nil, []string{"UNKNOWN_FIELD"}},
+		{"system field", "Ticket", "update", map[string]any{"created_at": due}, nil, []string{"READONLY_FIELD"}},
+		{"password", "User", "update", map[string]any{"password_hash": "x"}, nil, []string{"READONLY_FIELD"}},
+		{"enum value", "Ticket", "update", map[string]any{"status": "lost"}, nil, []string{"INVALID_FIELD"}},
+		{"too long", "Ticket", "update", map[string]any{"subject": "printer on fire"}, nil, []string{"INVALID_FIELD"}},
+		{"fraction", "Ticket", "update", map[string]any{"replies": 1.5}, nil, []string{"INVALID_FIELD"}},
+		{"null not nullable", "Ticket", "update", map[string]any{"subject": nil}, nil, []string{"INVALID_FIELD"}},
+		{"invalid relation id", "Ticket", "update", map[string]any{"assignee": "me"}, nil, []string{"INVALID_FIELD"}},
+		{"invalid create id", "Ticket", "create", map[string]any{"id": "mine"}, nil, []string{"INVALID_FIELD"}},
+		{"every key reported", "Ticket", "update", map[string]any{"created_at": due, "owner": "x", "status": "lost"},
+			nil, []string{"READONLY_FIELD", "UNKNOWN_FIELD", "INVALID_FIELD"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns, err := s.writeColumns(s.getArtifact().Entities[tt.entity], tt.operation, tt.input)
+			if tt.wantCodes == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				got, _ := json.Marshal(columns)
+				want, _ := json.Marshal(tt.want)
+				if string(got) != string(want) {
+					t.Errorf("columns = %s, want %s", got, want)
+				}
+				return
+			}
+
+			werr, ok := err.(*writeError)
+			if !ok {
+				t.Fatalf("err = %v, want a write error", err)
+			}
+			var codes []string
+			for _, m := range werr.Messages {
+				codes = append(codes, m.Code)
+			}
+			if strings.Join(codes, ",") != strings.Join(tt.wantCodes, ",") {
+				t.Errorf("codes = %v, want %v", codes, tt.wantCodes)
+			}
+		})
+	}
+}
+
+func TestWritePolicy(t *testing.T) {
+	newServer := func(t *testing.T) (*Server, *rowsDB) {
+		fake := &rowsDB{rows: map[string]map[string]any{"tickets": {"id": ruleTestTicketID, "status": "open"}}}
+		return createTestServerWithMockDB(t, writeArtifact(), &mockDB{queryFunc: fake.query}), fake
+	}
+
+	t.Run("update action", func(t *testing.T) {
+		s, fake := newServer(t)
+		w, resp := postRuleAction(t, s, "close_ticket", "", map[string]any{
+			"id":          ruleTestTicketID,
+			"status":      "closed",
+			"id = id; --": true,
+			"created_at":  "2024-05-01T12:00:00Z",
+		})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400 (body: %s)", w.Code, w.Body.String())
+		}
+		if len(resp.Messages) != 2 || resp.Messages[0].Code != "READONLY_FIELD" || resp.Messages[1].Code != "UNKNOWN_FIELD" {
+			t.Errorf("messages = %+v, want READONLY_FIELD and UNKNOWN_FIELD", resp.Messages)
+		}
+		if len(fake.writes) != 0 {
+			t.Errorf("rejected input must not write, got %v", fake.writes)
+		}
+	})
+
+	t.Run("update action never writes the id", func(t *testing.T) {
+		s, fake := newServer(t)
+		w, _ := postRuleAction(t, s, "close_ticket", "", map[string]any{"id": ruleTestTicketID, "status": "closed"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 (body: %s)", w.Code, w.Body.String())
+		}
+		if len(fake.writes) != 1 || fake.writes[0] != "UPDATE tickets SET status = $1 WHERE id = $2 RETURNING *" {
+			t.Errorf("writes = %v, want the status update", fake.writes)
+		}
+	})
+
+	t.Run("entity update", func(t *testing.T) {
+		s, fake := newServer(t)
+		r := chi.NewRouter()
+		r.Put("/api/entities/{entity}/{id}", s.handleUpdate)
+
+		req := httptest.NewRequest("PUT", "/api/entities/Ticket/"+ruleTestTicketID, strings.NewReader(`{"subject": "printer on fire"}`))
+		req = req.WithContext(context.WithValue(req.Context(), userContextKey{}, ruleTestUserID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var resp APIResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if w.Code != http.StatusBadRequest || len(resp.Messages) != 1 || resp.Messages[0].Code != "INVALID_FIELD" {
+			t.Errorf("status = %d, messages = %+v, want 400 INVALID_FIELD", w.Code, resp.Messages)
+		}
+		if len(fake.writes) != 0 {
+			t.Errorf("rejected input must not write, got %v", fake.writes)
+		}
+	})
+}
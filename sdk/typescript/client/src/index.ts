@@ -40,15 +40,53 @@ export interface ViewQueryParams {
   [key: string]: string | undefined;
 }
 
+// The query of a view subscription, as for GET /api/views, and the
+// callbacks receiving its page
 export interface SubscriptionOptions<T> {
+  params?: Record<string, string>;
+  filter?: Record<string, unknown>;
+  sort?: string;
+  limit?: number;
   onData: (data: T[]) => void;
   onError?: (error: ForgeError) => void;
 }
 
+// A change to the page of a view subscription. Positions index the page as
+// it is when the change is applied.
+export interface ViewChange<T> {
+  op: 'insert' | 'update' | 'delete';
+  id: string;
+  position: number;
+  data?: T;
+}
+
+// Applies the changes of an update message to a page, in order.
+export function applyViewChanges<T>(items: T[], changes: ViewChange<T>[]): T[] {
+  const next = [...items];
+  for (const change of changes) {
+    if (change.op !== 'insert') {
+      const index = next.findIndex((item) => String((item as { id?: unknown }).id) === change.id);
+      if (index >= 0) next.splice(index, 1);
+    }
+    if (change.op !== 'delete' && change.data) {
+      next.splice(change.position, 0, change.data);
+    }
+  }
+  return next;
+}
+
+interface Subscription {
+  view: string;
+  options: SubscriptionOptions<unknown>;
+  items: unknown[];
+}
+
 export class ForgeClient {
   private config: ForgeClientConfig;
   private ws: WebSocket | null = null;
-  private subscriptions: Map<string, Set<(data: unknown[]) => void>> = new Map();
+  private subscriptions: Map<string, Subscription> = new Map();
+  private nextSubscriptionId = 0;
+  private presences: Map<string, { presence: string; scope: string; data: Record<string, unknown> }> = new Map();
 
   constructor(config: ForgeClientConfig) {
     this.config = config;
@@ -127,35 +165,91 @@ export class ForgeClient {
     return this.request<void>('DELETE', `/api/entities/${entity}/${id}`);
   }
 
-  subscribe<T>(viewName: string, options: SubscriptionOptions<T>): () => void {
-    this.ensureWebSocket();
+  // The records a many relation of a record links to, and linking and
+  // unlinking one of them.
+  async linked<T>(entity: string, id: string, relation: string): Promise<T[]> {
+    return this.request<T[]>('GET', `/api/entities/${entity}/${id}/${relation}`);
+  }
 
-    const callback = options.onData as (data: unknown[]) => void;
+  async link(entity: string, id: string, relation: string, targetId: string): Promise<void> {
+    await this.request<unknown>('POST', `/api/entities/${entity}/${id}/${relation}`, { id: targetId });
+  }
 
-    if (!this.subscriptions.has(viewName)) {
-      this.subscriptions.set(viewName, new Set());
-    }
-    this.subscriptions.get(viewName)!.add(callback);
+  async unlink(entity: string, id: string, relation: string, targetId: string): Promise<void> {
+    return this.request<void>('DELETE', `/api/entities/${entity}/${id}/${relation}/${targetId}`);
+  }
+
+  // Subscribes to a declared view, which sends a snapshot of its first page
+  // and then the changes to it, or to a topic such as 'Ticket:create'.
+  subscribe<T>(viewName: string, options: SubscriptionOptions<T>): () => void {
+    this.ensureWebSocket();
 
-    // Send subscribe message
+    const id = String(++this.nextSubscriptionId);
+    this.subscriptions.set(id, {
+      view: viewName,
+      options: options as SubscriptionOptions<unknown>,
+      items: [],
+    });
     if (this.ws?.readyState === WebSocket.OPEN) {
-      this.ws.send(JSON.stringify({ type: 'subscribe', view: viewName }));
+      this.sendSubscribe(id);
     }
 
     return () => {
-      const subs = this.subscriptions.get(viewName);
-      if (subs) {
-        subs.delete(callback);
-        if (subs.size === 0) {
-          this.subscriptions.delete(viewName);
-          if (this.ws?.readyState === WebSocket.OPEN) {
-            this.ws.send(JSON.stringify({ type: 'unsubscribe', view: viewName }));
-          }
-        }
+      if (!this.subscriptions.delete(id) || this.ws?.readyState !== WebSocket.OPEN) {
+        return;
       }
+      // A topic is shared by the subscriptions to it; leave it with the last
+      const shared = [...this.subscriptions.values()].some((sub) => sub.view === viewName);
+      this.ws!.send(JSON.stringify({ type: 'unsubscribe', id, view: shared ? undefined : viewName }));
     };
   }
 
+  // Sets this user's presence in a scope. The state is merged into the
+  // entry, and the latest state is sent again when the socket reconnects.
+  // It lasts the presence's ttl; call again before it runs out.
+  updatePresence(presence: string, scope: string, state: Record<string, unknown>): void {
+    this.ensureWebSocket();
+
+    const key = `${presence}:${scope}`;
+    const data = { ...this.presences.get(key)?.data, ...state };
+    this.presences.set(key, { presence, scope, data });
+    if (this.ws?.readyState === WebSocket.OPEN) {
+      this.ws.send(JSON.stringify({ type: 'presence', presence, scope, data: state }));
+    }
+  }
+
+  private sendSubscribe(id: string): void {
+    const sub = this.subscriptions.get(id)!;
+    const { params, filter, sort, limit } = sub.options;
+    this.ws!.send(JSON.stringify({ type: 'subscribe', id, view: sub.view, params, filter, sort, limit }));
+  }
+
+  private handleMessage(msg: {
+    type: string;
+    id?: string;
+    view?: string;
+    items?: unknown[];
+    changes?: ViewChange<unknown>[];
+    error?: string;
+  }): void {
+    // View subscriptions are addressed by ID, topics by name
+    const targets = msg.id
+      ? [this.subscriptions.get(msg.id)].filter((sub): sub is Subscription => !!sub)
+      : [...this.subscriptions.values()].filter((sub) => sub.view === msg.view);
+
+    for (const sub of targets) {
+      if (msg.type === 'snapshot' || (msg.type === 'data' && msg.items)) {
+        sub.items = msg.items!;
+        sub.options.onData(sub.items);
+      } else if (msg.type === 'update' && msg.changes) {
+        sub.items = applyViewChanges(sub.items, msg.changes);
+        sub.options.onData(sub.items);
+      } else if (msg.type === 'error' && sub.options.onError) {
+        sub.options.onError({ status: 'error', messages: [{ code: 'SUBSCRIPTION_FAILED', message: msg.error }] });
+      }
+    }
+  }
+
   private ensureWebSocket(): void {
     if (this.ws?.readyState === WebSocket.OPEN) {
       return;
@@ -165,23 +259,25 @@ export class ForgeClient {
     this.ws = new WebSocket(wsUrl);
 
     this.ws.onopen = () => {
-      // Resubscribe to all views
-      for (const viewName of this.subscriptions.keys()) {
-        this.ws!.send(JSON.stringify({ type: 'subscribe', view: viewName }));
+      // Authenticate before subscribing so pushes are filtered for this user
+      if (this.config.token) {
+        this.ws!.send(JSON.stringify({ type: 'auth', token: this.config.token }));
+      }
+
+      // Resubscribe to all views, which resends their snapshots
+      for (const id of this.subscriptions.keys()) {
+        this.sendSubscribe(id);
+      }
+
+      // Restore presence, which may have expired while disconnected
+      for (const { presence, scope, data } of this.presences.values()) {
+        this.ws!.send(JSON.stringify({ type: 'presence', presence, scope, data }));
       }
     };
 
     this.ws.onmessage = (event) => {
       try {
-        const data = JSON.parse(event.data);
-        if (data.type === 'data' && data.view) {
-          const subs = this.subscriptions.get(data.view);
-          if (subs) {
-            for (const callback of subs) {
-              callback(data.items);
-            }
-          }
-        }
+        this.handleMessage(JSON.parse(event.data));
       } catch (e) {
         console.error('Failed to parse WebSocket message:', e);
       }
@@ -203,6 +299,7 @@ export class ForgeClient {
       this.ws = null;
     }
     this.subscriptions.clear();
+    this.presences.clear();
   }
 }
 